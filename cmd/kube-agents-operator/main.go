@@ -0,0 +1,131 @@
+// Command kube-agents-operator executes TestRun and TestSuite resources in
+// the cluster it runs in; see package operator.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/agent"
+	"github.com/aslakknutsen/kube-agents-test/pkg/diagnostics"
+	"github.com/aslakknutsen/kube-agents-test/pkg/engine"
+	"github.com/aslakknutsen/kube-agents-test/pkg/fingerprint"
+	"github.com/aslakknutsen/kube-agents-test/pkg/history"
+	"github.com/aslakknutsen/kube-agents-test/pkg/kube"
+	"github.com/aslakknutsen/kube-agents-test/pkg/operator"
+	"github.com/aslakknutsen/kube-agents-test/pkg/runner"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario/remote"
+)
+
+// crdTimeout bounds how long startup waits for installed CRDs.
+const crdTimeout = time.Minute
+
+type options struct {
+	kubeconfig  string
+	kubeContext string
+	namespace   string
+	installCRDs bool
+	agentsFile  string
+	proxyImage  string
+	verifyAPI   bool
+	artifactDir string
+	stateDir    string
+	historyPath string
+	cacheDir    string
+	verbose     bool
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.kubeconfig, "kubeconfig", "", "kubeconfig of the cluster (default: standard loading rules, or the in-cluster config)")
+	flag.StringVar(&o.kubeContext, "context", "", "kubeconfig context to use")
+	flag.StringVar(&o.namespace, "namespace", "", "only reconcile TestRuns and TestSuites in this namespace (default: all)")
+	flag.BoolVar(&o.installCRDs, "install-crds", true, "create or update the TestRun and TestSuite CRDs on startup")
+	flag.StringVar(&o.agentsFile, "agents", "", "agent registry file mapping agent names to images")
+	flag.StringVar(&o.proxyImage, "apiproxy-image", "", "image of kube-agents-test-apiproxy, required by scenarios with apiFaults and by --verify-api-access")
+	flag.BoolVar(&o.verifyAPI, "verify-api-access", false, "fail scenarios in which an agent made API calls outside the allow list of its registry entry")
+	flag.StringVar(&o.artifactDir, "artifacts", filepath.Join(os.TempDir(), "kube-agents-operator"), "write results and diagnostics under <dir>/<run-id>/<scenario>/")
+	flag.StringVar(&o.stateDir, "state-dir", filepath.Join(os.TempDir(), "kube-agents-operator", runner.DefaultStateDir), "directory for state kept between runs")
+	flag.StringVar(&o.historyPath, "history", "", "append results to this run history file")
+	flag.StringVar(&o.cacheDir, "source-cache", remote.DefaultCacheDir(), "where remote scenario sources are cached")
+	flag.BoolVar(&o.verbose, "v", false, "log progress")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, o); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, o options) error {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	if o.verbose {
+		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+	}
+	clients, err := kube.ForKubeconfig(o.kubeconfig, o.kubeContext)
+	if err != nil {
+		return err
+	}
+
+	var engineOpts []engine.Option
+	var manager agent.Manager
+	if o.agentsFile != "" {
+		registry, err := agent.LoadRegistry(o.agentsFile)
+		if err != nil {
+			return err
+		}
+		manager = agent.NewPodManager(clients.Kubernetes, agent.WithRunScopedNames(true))
+		engineOpts = append(engineOpts, engine.WithAgents(manager, registry))
+	}
+	engineOpts = append(engineOpts,
+		engine.WithCollector(diagnostics.NewClusterCollector(clients.Kubernetes, manager)),
+		engine.WithAPIProxy(o.proxyImage),
+		engine.WithAPIAccessCheck(o.verifyAPI),
+		engine.WithLogger(logger),
+	)
+	eng, err := engine.New(clients.Config, engineOpts...)
+	if err != nil {
+		return err
+	}
+	defer eng.Close()
+
+	if o.installCRDs {
+		if err := operator.InstallCRDs(ctx, clients.Dynamic); err != nil {
+			return err
+		}
+	}
+	crdCtx, cancel := context.WithTimeout(ctx, crdTimeout)
+	defer cancel()
+	if err := eng.WaitForCRDEstablished(crdCtx, operator.CRDNames()...); err != nil {
+		return fmt.Errorf("waiting for CRDs: %w", err)
+	}
+
+	runnerOpts := []runner.Option{
+		runner.WithArtifacts(o.artifactDir),
+		runner.WithStateDir(o.stateDir),
+		runner.WithFingerprint(fingerprint.For(clients.Kubernetes)),
+	}
+	if o.historyPath != "" {
+		store, err := history.Open(o.historyPath)
+		if err != nil {
+			return err
+		}
+		runnerOpts = append(runnerOpts, runner.WithHistory(store))
+	}
+	return operator.New(clients.Dynamic, eng,
+		operator.WithNamespace(o.namespace),
+		operator.WithRunnerOptions(runnerOpts...),
+		operator.WithFetcher(remote.New(remote.WithCacheDir(o.cacheDir))),
+		operator.WithEvents(clients.Kubernetes),
+		operator.WithLogger(logger),
+	).Run(ctx)
+}
@@ -0,0 +1,212 @@
+// Command kube-agents-server serves the framework's HTTP API, so dashboards
+// and other services can submit scenario runs against a cluster, follow
+// their progress, and fetch results; see package server.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/agent"
+	"github.com/aslakknutsen/kube-agents-test/pkg/diagnostics"
+	"github.com/aslakknutsen/kube-agents-test/pkg/engine"
+	"github.com/aslakknutsen/kube-agents-test/pkg/fingerprint"
+	"github.com/aslakknutsen/kube-agents-test/pkg/history"
+	"github.com/aslakknutsen/kube-agents-test/pkg/kube"
+	"github.com/aslakknutsen/kube-agents-test/pkg/notify"
+	"github.com/aslakknutsen/kube-agents-test/pkg/runner"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario/remote"
+	"github.com/aslakknutsen/kube-agents-test/pkg/server"
+	"github.com/aslakknutsen/kube-agents-test/pkg/soak"
+)
+
+// tokenEnv holds the bearer token when --token-file is not given.
+const tokenEnv = "KUBE_AGENTS_SERVER_TOKEN"
+
+type options struct {
+	listen      string
+	tokenFile   string
+	tlsCert     string
+	tlsKey      string
+	root        string
+	kubeconfig  string
+	kubeContext string
+	agentsFile  string
+	proxyImage  string
+	verifyAPI   bool
+	artifactDir string
+	stateDir    string
+	historyPath string
+	cacheDir    string
+	schedule    string
+	soakSources string
+	webhook     string
+	verbose     bool
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.listen, "listen", "127.0.0.1:8080", "address to serve on")
+	flag.StringVar(&o.tokenFile, "token-file", "", "file holding the bearer token clients must send (default: env "+tokenEnv+"); one is required")
+	flag.StringVar(&o.tlsCert, "tls-cert", "", "serve HTTPS with this certificate, along with --tls-key")
+	flag.StringVar(&o.tlsKey, "tls-key", "", "key of --tls-cert")
+	flag.StringVar(&o.root, "root", "", "directory local scenario sources and the files scenarios refer to must be in (default: only remote sources and inline scenarios without files)")
+	flag.StringVar(&o.kubeconfig, "kubeconfig", "", "kubeconfig of the cluster to run against (default: standard loading rules)")
+	flag.StringVar(&o.kubeContext, "context", "", "kubeconfig context to use")
+	flag.StringVar(&o.agentsFile, "agents", "", "agent registry file mapping agent names to images")
+	flag.StringVar(&o.proxyImage, "apiproxy-image", "", "image of kube-agents-test-apiproxy, required by scenarios with apiFaults and by --verify-api-access")
+	flag.BoolVar(&o.verifyAPI, "verify-api-access", false, "fail scenarios in which an agent made API calls outside the allow list of its registry entry")
+	flag.StringVar(&o.artifactDir, "artifacts", filepath.Join(os.TempDir(), "kube-agents-server"), "write results and diagnostics under <dir>/<run-id>/<scenario>/")
+	flag.StringVar(&o.stateDir, "state-dir", runner.DefaultStateDir, "directory for state kept between runs")
+	flag.StringVar(&o.historyPath, "history", "", "append results to this run history file")
+	flag.StringVar(&o.cacheDir, "source-cache", remote.DefaultCacheDir(), "where remote scenario sources are cached")
+	flag.StringVar(&o.schedule, "soak-schedule", "", "also run --soak-sources on this cron schedule, e.g. \"*/30 * * * *\" or \"@every 1h\"")
+	flag.StringVar(&o.soakSources, "soak-sources", "", "comma-separated scenario files, dirs, or remote sources run by --soak-schedule")
+	flag.StringVar(&o.webhook, "notify-webhook", "", "post an alert to this URL when soak runs start or stop failing")
+	flag.BoolVar(&o.verbose, "v", false, "log progress")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, o); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, o options) error {
+	logger := slog.New(slog.DiscardHandler)
+	if o.verbose {
+		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+	}
+	var schedule soak.Schedule
+	if o.schedule != "" {
+		var err error
+		if schedule, err = soak.ParseSchedule(o.schedule); err != nil {
+			return err
+		}
+		if o.soakSources == "" {
+			return errors.New("--soak-schedule needs --soak-sources")
+		}
+	}
+	token, err := readToken(o.tokenFile)
+	if err != nil {
+		return err
+	}
+	if (o.tlsCert == "") != (o.tlsKey == "") {
+		return errors.New("--tls-cert and --tls-key go together")
+	}
+	if o.root == "" && schedule != nil {
+		for _, src := range strings.Split(o.soakSources, ",") {
+			if !remote.IsRemote(src) {
+				return fmt.Errorf("--soak-sources: local source %s needs --root", src)
+			}
+		}
+	}
+	clients, err := kube.ForKubeconfig(o.kubeconfig, o.kubeContext)
+	if err != nil {
+		return err
+	}
+
+	var engineOpts []engine.Option
+	var manager agent.Manager
+	if o.agentsFile != "" {
+		registry, err := agent.LoadRegistry(o.agentsFile)
+		if err != nil {
+			return err
+		}
+		manager = agent.NewPodManager(clients.Kubernetes, agent.WithRunScopedNames(true))
+		engineOpts = append(engineOpts, engine.WithAgents(manager, registry))
+	}
+	engineOpts = append(engineOpts,
+		engine.WithCollector(diagnostics.NewClusterCollector(clients.Kubernetes, manager)),
+		engine.WithAPIProxy(o.proxyImage),
+		engine.WithAPIAccessCheck(o.verifyAPI),
+		engine.WithLogger(logger),
+	)
+	eng, err := engine.New(clients.Config, engineOpts...)
+	if err != nil {
+		return err
+	}
+	defer eng.Close()
+
+	runnerOpts := []runner.Option{runner.WithStateDir(o.stateDir), runner.WithFingerprint(fingerprint.For(clients.Kubernetes))}
+	var store *history.Store
+	if o.historyPath != "" {
+		store, err = history.Open(o.historyPath)
+		if err != nil {
+			return err
+		}
+		runnerOpts = append(runnerOpts, runner.WithHistory(store))
+	}
+	srv := server.New(eng,
+		server.WithArtifacts(o.artifactDir),
+		server.WithRunnerOptions(runnerOpts...),
+		server.WithFetcher(remote.New(remote.WithCacheDir(o.cacheDir))),
+		server.WithToken(token),
+		server.WithRoot(o.root),
+		server.WithLogger(logger),
+	)
+	go srv.Start(ctx)
+	if schedule != nil {
+		req := &server.Request{Sources: strings.Split(o.soakSources, ",")}
+		soakOpts := []soak.Option{soak.WithHistory(store), soak.WithLogger(logger)}
+		if o.webhook != "" {
+			soakOpts = append(soakOpts, soak.WithNotifier(&notify.Webhook{URL: o.webhook}))
+		}
+		scheduler := soak.New(schedule, func(ctx context.Context) (*runner.SuiteResult, error) {
+			return srv.Run(ctx, req)
+		}, soakOpts...)
+		go func() {
+			if err := scheduler.Run(ctx); err != nil {
+				logger.Error("soak scheduler stopped", "error", err)
+			}
+		}()
+	}
+
+	httpSrv := &http.Server{Addr: o.listen, Handler: srv.Handler()}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = httpSrv.Shutdown(shutdownCtx)
+	}()
+	logger.Info("serving", "addr", o.listen, "tls", o.tlsCert != "")
+	if o.tlsCert != "" {
+		err = httpSrv.ListenAndServeTLS(o.tlsCert, o.tlsKey)
+	} else {
+		err = httpSrv.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// readToken returns the bearer token from path, or from the environment
+// if path is empty. A token is required.
+func readToken(path string) (string, error) {
+	token := os.Getenv(tokenEnv)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("reading token: %w", err)
+		}
+		token = string(data)
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", fmt.Errorf("a bearer token is required: set --token-file or %s", tokenEnv)
+	}
+	return token, nil
+}
@@ -0,0 +1,77 @@
+// Command kube-agents-test-apiproxy is the fault-injecting API server proxy
+// the engine deploys for scenarios with apiFaults. It runs in the cluster
+// and follows its policy ConfigMap; see package apiproxy.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/apiproxy"
+)
+
+func main() {
+	listen := flag.String("listen", fmt.Sprintf(":%d", apiproxy.Port), "address to serve on")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, *listen); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, listen string) error {
+	log := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	namespace := os.Getenv(apiproxy.NamespaceEnv)
+	if namespace == "" {
+		return fmt.Errorf("%s is not set", apiproxy.NamespaceEnv)
+	}
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return err
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	upstream, err := url.Parse(config.Host)
+	if err != nil {
+		return err
+	}
+	// Trust the API server's certificate but send no credentials: the
+	// agents' own token is forwarded.
+	transport, err := rest.TransportFor(&rest.Config{Host: config.Host, TLSClientConfig: config.TLSClientConfig})
+	if err != nil {
+		return err
+	}
+
+	h := apiproxy.NewHandler(upstream, transport, log)
+	go apiproxy.Follow(ctx, client, namespace, h, log)
+
+	srv := &http.Server{Addr: listen, Handler: h}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	log.Info("serving", "addr", listen, "upstream", upstream.String())
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
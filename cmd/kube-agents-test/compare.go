@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/agent"
+	"github.com/aslakknutsen/kube-agents-test/pkg/engine"
+	"github.com/aslakknutsen/kube-agents-test/pkg/kube"
+	"github.com/aslakknutsen/kube-agents-test/pkg/runner"
+)
+
+func compareCmd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	var (
+		kubeconfig  = fs.String("kubeconfig", "", "kubeconfig of an existing cluster (default: standard loading rules)")
+		kubeContext = fs.String("context", "", "kubeconfig context to use")
+		namespace   = fs.String("namespace", "", "namespace of scenarios that set none")
+		agentsFile  = fs.String("agents", "", "agent registry file mapping agent names to the baseline images")
+		agentNS     = fs.Bool("agent-namespaces", false, "deploy each agent in a namespace of its own, "+agent.Namespace+"-<agent>, instead of sharing "+agent.Namespace)
+		pollEvery   = fs.Duration("poll-interval", 0, "how often to check expectations (default: the engine's)")
+		outPath     = fs.String("o", "", "also write the comparison as JSON to this file")
+		verbose     = fs.Bool("v", false, "log progress")
+		images      = map[string]string{}
+		ignore      []string
+	)
+	fs.Func("image", "run the candidate with the agent image `agent=image` instead of the registry's (repeatable)", func(v string) error {
+		name, image, ok := strings.Cut(v, "=")
+		if !ok || name == "" || image == "" {
+			return errors.New("want agent=image")
+		}
+		images[name] = image
+		return nil
+	})
+	fs.Func("ignore", "leave the field at `path`, e.g. .status.observedGeneration, out of end-state comparisons (repeatable)", func(v string) error {
+		ignore = append(ignore, v)
+		return nil
+	})
+	vars := varFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: kube-agents-test compare --agents <file> --image <agent=image>... [flags] <scenario file or dir>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no scenarios given")
+	}
+	if *agentsFile == "" || len(images) == 0 {
+		return errors.New("--agents and --image are required")
+	}
+
+	scenarios, err := loadScenarios(ctx, vars, *kubeconfig, *kubeContext, fs.Args())
+	if err != nil {
+		return err
+	}
+	baseline, err := agent.LoadRegistry(*agentsFile)
+	if err != nil {
+		return err
+	}
+	candidate, err := baseline.WithImages(images)
+	if err != nil {
+		return err
+	}
+	logger := slog.New(slog.DiscardHandler)
+	if *verbose {
+		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+	}
+	clients, err := kube.ForKubeconfig(*kubeconfig, *kubeContext)
+	if err != nil {
+		return err
+	}
+	// The runs keep their failed lists to themselves, so --rerun-failed
+	// of the run command is not affected.
+	stateDir, err := os.MkdirTemp("", "kube-agents-test-compare-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stateDir)
+
+	pods := agent.NewPodManager(clients.Kubernetes, agent.WithNamespacePerAgent(*agentNS))
+	suite := func(name string, registry agent.Registry) (*runner.SuiteResult, error) {
+		opts := []engine.Option{
+			engine.WithAgents(pods, registry),
+			engine.WithEndStates(true),
+			engine.WithDefaultNamespace(*namespace),
+			engine.WithLogger(logger),
+		}
+		if *pollEvery > 0 {
+			opts = append(opts, engine.WithPollInterval(*pollEvery))
+		}
+		eng, err := engine.New(clients.Config, opts...)
+		if err != nil {
+			return nil, err
+		}
+		defer eng.Close()
+		fmt.Fprintf(os.Stderr, "running %s\n", name)
+		return runner.New(eng,
+			runner.WithStateDir(stateDir),
+			runner.WithDimensions(map[string]string{"agents": name}),
+			runner.WithLogger(logger),
+		).RunSuite(ctx, scenarios)
+	}
+	base, err := suite("baseline", baseline)
+	if err != nil {
+		return err
+	}
+	cand, err := suite("candidate", candidate)
+	if err != nil {
+		return err
+	}
+
+	results := map[string]*engine.Result{}
+	for _, res := range cand.Results {
+		results[res.Scenario] = res
+	}
+	var comparisons []*engine.Comparison
+	changed := 0
+	for _, b := range base.Results {
+		c, ok := results[b.Scenario]
+		if !ok || b.Skipped || c.Skipped {
+			fmt.Printf("SKIP     %s\n", b.Scenario)
+			continue
+		}
+		comparison, err := engine.Compare(b, c, ignore...)
+		if err != nil {
+			return err
+		}
+		comparisons = append(comparisons, comparison)
+		if comparison.Changed() {
+			changed++
+		}
+		printComparison(comparison)
+	}
+	if *outPath != "" {
+		data, err := json.MarshalIndent(comparisons, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*outPath, append(data, '\n'), 0o644); err != nil {
+			return err
+		}
+	}
+	if changed > 0 {
+		return fmt.Errorf("%d of %d scenarios behaved differently", changed, len(comparisons))
+	}
+	return nil
+}
+
+// printComparison prints the outcomes, end-state differences and metrics
+// of a comparison.
+func printComparison(c *engine.Comparison) {
+	status := "SAME"
+	if c.Changed() {
+		status = "CHANGED"
+	}
+	fmt.Printf("%-8s %s (baseline %s, candidate %s)\n", status, c.Scenario, outcome(c.Baseline), outcome(c.Candidate))
+	if c.Candidate.Error != "" && c.Candidate.Error != c.Baseline.Error {
+		fmt.Printf("      candidate: %s\n", c.Candidate.Error)
+	}
+	for _, d := range c.States {
+		fmt.Printf("      %s: %v -> %v\n", d.Subject(), d.Expected, d.Actual)
+	}
+	for _, m := range c.Metrics {
+		if m.Baseline == m.Candidate {
+			continue
+		}
+		fmt.Printf("      %s: %.4g%s -> %.4g%s\n", m.Name, m.Baseline, m.Unit, m.Candidate, m.Unit)
+	}
+}
+
+func outcome(o engine.Outcome) string {
+	if o.Passed {
+		return "passed"
+	}
+	return "failed"
+}
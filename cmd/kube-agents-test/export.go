@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/artifacts"
+	"github.com/aslakknutsen/kube-agents-test/pkg/export"
+)
+
+func exportCmd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	outDir := fs.String("o", ".", "directory to write one <scenario>/ directory per scenario to")
+	vars := varFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: kube-agents-test export [flags] <scenario file or dir>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no scenarios given")
+	}
+
+	scenarios, err := loadScenarios(ctx, vars, "", "", fs.Args())
+	if err != nil {
+		return err
+	}
+	for _, s := range scenarios {
+		dir := filepath.Join(*outDir, artifacts.Slug(s.Name))
+		if err := export.Kubectl(s, dir); err != nil {
+			return fmt.Errorf("%s: %w", s.Name, err)
+		}
+		fmt.Println(dir)
+	}
+	return nil
+}
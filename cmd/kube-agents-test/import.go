@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/convert"
+)
+
+func importCmd(_ context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	outDir := fs.String("o", ".", "directory to write scenarios and their fixtures to")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: kube-agents-test import [flags] <kuttl or chainsaw test or suite dir>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no test directories given")
+	}
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		return err
+	}
+
+	for _, dir := range fs.Args() {
+		tests, err := convert.Suite(dir)
+		if err != nil {
+			return err
+		}
+		if len(tests) == 0 {
+			return fmt.Errorf("%s: no kuttl or chainsaw tests found", dir)
+		}
+		for _, t := range tests {
+			path, err := t.Write(*outDir)
+			if err != nil {
+				return err
+			}
+			fmt.Println(path)
+			for _, w := range t.Warnings {
+				fmt.Printf("  warning: %s\n", w)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+func lintCmd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print findings as JSON")
+	vars := varFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: kube-agents-test lint [flags] <scenario file or dir>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no scenarios given")
+	}
+
+	scenarios, err := loadScenarios(ctx, vars, "", "", fs.Args())
+	if err != nil {
+		return err
+	}
+	findings := scenario.Lint(scenarios...)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if findings == nil {
+			findings = []scenario.Finding{}
+		}
+		if err := enc.Encode(findings); err != nil {
+			return err
+		}
+	} else {
+		for _, f := range findings {
+			fmt.Println(f)
+		}
+	}
+	if len(findings) > 0 {
+		return fmt.Errorf("%d findings in %d scenarios", len(findings), len(scenarios))
+	}
+	return nil
+}
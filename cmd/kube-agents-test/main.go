@@ -0,0 +1,92 @@
+// Command kube-agents-test runs kube-agents scenarios against a cluster.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario/loader"
+	"github.com/aslakknutsen/kube-agents-test/pkg/secrets"
+)
+
+const usage = `usage: kube-agents-test <command> [flags] [args]
+
+commands:
+  run     run scenarios from files or directories
+  lint    check scenarios against best-practice rules
+  import  convert kuttl or chainsaw tests into scenarios
+  export  render scenarios as kubectl scripts for manual reproduction
+  preview show what scenarios would change on a cluster, using dry runs
+  compare run scenarios against two builds of their agents and diff the behavior
+  package render a suite as a Kubernetes Job that runs it in-cluster
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "run":
+		err = runCmd(ctx, os.Args[2:])
+	case "lint":
+		err = lintCmd(ctx, os.Args[2:])
+	case "import":
+		err = importCmd(ctx, os.Args[2:])
+	case "export":
+		err = exportCmd(ctx, os.Args[2:])
+	case "preview":
+		err = previewCmd(ctx, os.Args[2:])
+	case "compare":
+		err = compareCmd(ctx, os.Args[2:])
+	case "package":
+		err = packageCmd(ctx, os.Args[2:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// varFlag defines the repeatable --var flag, which sets the template
+// variables of scenario files, and returns the variables it collects.
+func varFlag(fs *flag.FlagSet) map[string]string {
+	vars := map[string]string{}
+	fs.Func("var", "set the scenario template variable `key=value`, used as {{ .Vars.key }} (repeatable)", func(v string) error {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || key == "" {
+			return errors.New("want key=value")
+		}
+		vars[key] = value
+		return nil
+	})
+	return vars
+}
+
+// loadScenarios loads the scenarios of paths with the template variables
+// vars, resolving secret references with the default providers. The k8s
+// provider reads Secrets of the cluster of kubeconfig and kubeContext.
+func loadScenarios(ctx context.Context, vars map[string]string, kubeconfig, kubeContext string, paths []string) ([]*scenario.Scenario, error) {
+	return loader.LoadWithOptions(ctx, nil, []scenario.LoadOption{
+		scenario.WithVars(vars),
+		scenario.WithValueProviders(secrets.Defaults(kubeconfig, kubeContext)),
+	}, paths...)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/export"
+)
+
+func packageCmd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("package", flag.ExitOnError)
+	var (
+		out        = fs.String("o", "-", "file to write the manifests to, - for stdout")
+		image      = fs.String("image", "", "kube-agents-test image the Job runs, pullable from the target cluster (required)")
+		namespace  = fs.String("namespace", "", "namespace the Job runs and publishes results in (required)")
+		name       = fs.String("name", export.DefaultJobName, "name of the Job and the objects it needs")
+		agentsFile = fs.String("agents", "", "agent registry file to package along with the suite")
+		resultsPVC = fs.String("results-pvc", "", "PersistentVolumeClaim to also write a JSON report and artifacts to")
+		runArgs    []string
+	)
+	fs.Func("run-arg", "pass `flag` on to the run in the Job, e.g. --run-arg=--shard-total=2 (repeatable)", func(v string) error {
+		runArgs = append(runArgs, v)
+		return nil
+	})
+	vars := varFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: kube-agents-test package [flags] <scenario file or dir>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no scenarios given")
+	}
+	if *image == "" || *namespace == "" {
+		return errors.New("--image and --namespace are required")
+	}
+
+	scenarios, err := loadScenarios(ctx, vars, "", "", fs.Args())
+	if err != nil {
+		return err
+	}
+	for _, k := range slices.Sorted(maps.Keys(vars)) {
+		runArgs = append(runArgs, "--var", k+"="+vars[k])
+	}
+	opts := []export.JobOption{export.WithJobName(*name), export.WithRunArgs(runArgs...)}
+	if *agentsFile != "" {
+		opts = append(opts, export.WithAgents(*agentsFile))
+	}
+	if *resultsPVC != "" {
+		opts = append(opts, export.WithResultsPVC(*resultsPVC))
+	}
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return export.Job(w, fs.Args(), scenarios, *image, *namespace, opts...)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/engine"
+	"github.com/aslakknutsen/kube-agents-test/pkg/kube"
+)
+
+func previewCmd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("preview", flag.ExitOnError)
+	var (
+		kubeconfig  = fs.String("kubeconfig", "", "kubeconfig of the cluster to preview against (default: standard loading rules)")
+		kubeContext = fs.String("context", "", "kubeconfig context to use")
+		namespace   = fs.String("namespace", "", "namespace of scenarios that set none")
+		asUser      = fs.String("as", "", "user to impersonate for the dry runs, to preview with that user's RBAC")
+		asGroups    []string
+	)
+	fs.Func("as-group", "`group` to impersonate along with --as (repeatable)", func(v string) error {
+		asGroups = append(asGroups, v)
+		return nil
+	})
+	vars := varFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: kube-agents-test preview [flags] <scenario file or dir>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no scenarios given")
+	}
+
+	scenarios, err := loadScenarios(ctx, vars, *kubeconfig, *kubeContext, fs.Args())
+	if err != nil {
+		return err
+	}
+	clients, err := kube.ForKubeconfig(*kubeconfig, *kubeContext)
+	if err != nil {
+		return err
+	}
+	eng, err := engine.New(clients.Config,
+		engine.WithInformerCache(false),
+		engine.WithSchemaValidation(false),
+		engine.WithDefaultNamespace(*namespace),
+		engine.WithImpersonation(*asUser, asGroups...),
+	)
+	if err != nil {
+		return err
+	}
+	defer eng.Close()
+
+	refused := 0
+	for _, s := range scenarios {
+		p, err := eng.Preview(ctx, s)
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.Name, err)
+		}
+		refused += printPreview(p)
+	}
+	if refused > 0 {
+		return fmt.Errorf("the API server refused %d changes", refused)
+	}
+	return nil
+}
+
+// printPreview prints the changes of p and returns how many of them the
+// API server refused.
+func printPreview(p *engine.Preview) int {
+	fmt.Println(p.Scenario)
+	refused := 0
+	for _, c := range p.Changes {
+		fmt.Printf("  %-13s %s (%s)\n", c.Action, c.Resource, c.Source)
+		for _, d := range c.Diffs {
+			fmt.Printf("      %s: %v -> %v\n", d.Path, d.Expected, d.Actual)
+		}
+		if c.Note != "" {
+			fmt.Printf("      %s\n", c.Note)
+		}
+		if c.Error != "" {
+			refused++
+			fmt.Printf("      refused: %s\n", c.Error)
+		}
+	}
+	return refused
+}
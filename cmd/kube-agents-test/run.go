@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/agent"
+	"github.com/aslakknutsen/kube-agents-test/pkg/anchor"
+	"github.com/aslakknutsen/kube-agents-test/pkg/cluster"
+	"github.com/aslakknutsen/kube-agents-test/pkg/diagnostics"
+	"github.com/aslakknutsen/kube-agents-test/pkg/engine"
+	"github.com/aslakknutsen/kube-agents-test/pkg/fingerprint"
+	"github.com/aslakknutsen/kube-agents-test/pkg/history"
+	"github.com/aslakknutsen/kube-agents-test/pkg/kube"
+	"github.com/aslakknutsen/kube-agents-test/pkg/notify"
+	"github.com/aslakknutsen/kube-agents-test/pkg/publish"
+	"github.com/aslakknutsen/kube-agents-test/pkg/report"
+	"github.com/aslakknutsen/kube-agents-test/pkg/runner"
+	"github.com/aslakknutsen/kube-agents-test/pkg/soak"
+)
+
+func runCmd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	var (
+		kubeconfig  = fs.String("kubeconfig", "", "kubeconfig of an existing cluster (default: standard loading rules)")
+		kubeContext = fs.String("context", "", "kubeconfig context to use")
+		namespace   = fs.String("namespace", "", "namespace of scenarios that set none")
+		asUser      = fs.String("as", "", "user to impersonate for the requests scenarios make, to test with that user's RBAC")
+		useKind     = fs.Bool("kind", false, "run against a kind cluster, creating it if it does not exist")
+		kindName    = fs.String("kind-name", cluster.DefaultKindName, "name of the kind cluster")
+		kindImage   = fs.String("kind-image", "", "kind node image")
+		keepCluster = fs.Bool("keep-cluster", false, "keep the kind cluster after the run (it is always kept after a failed run so --rerun-failed can reuse it)")
+		agentsFile  = fs.String("agents", "", "agent registry file mapping agent names to images")
+		agentNS     = fs.Bool("agent-namespaces", false, "deploy each agent in a namespace of its own, "+agent.Namespace+"-<agent>, instead of sharing "+agent.Namespace)
+		runScoped   = fs.Bool("run-scoped-agents", false, "name agent Deployments after the run, so concurrent runs on one cluster can deploy the same agent")
+		runAnchor   = fs.Bool("run-anchor", false, "make everything a run creates owned by the namespace "+anchor.Prefix+"<run-id>, so deleting that namespace cleans up after the run")
+		pollEvery   = fs.Duration("poll-interval", 2*time.Second, "how often expectations are re-evaluated")
+		informers   = fs.Bool("informers", true, "read expectation state from shared informers instead of polling GETs")
+		resync      = fs.Duration("informer-resync", 0, "informer resync period (0 disables periodic resync)")
+		noBookmarks = fs.Bool("no-watch-bookmarks", false, "do not request watch bookmarks")
+		validate    = fs.Bool("validate-manifests", true, "validate setup manifests against the cluster's OpenAPI schemas before applying them")
+		proxyImage  = fs.String("apiproxy-image", "", "image of kube-agents-test-apiproxy, required by scenarios with apiFaults and by --verify-api-access")
+		verifyAPI   = fs.Bool("verify-api-access", false, "fail scenarios in which an agent made API calls outside the allow list of its registry entry")
+		pinImages   = fs.Bool("pin-images", false, "resolve agent image tags to digests before deploying, and record the digests in results")
+		cosignKey   = fs.String("cosign-key", "", "verify agent image signatures with cosign against this public key (implies --pin-images)")
+		cosignID    = fs.String("cosign-identity", "", "verify agent image signatures keyless with cosign, requiring a certificate identity matching this regexp (implies --pin-images)")
+		cosignIss   = fs.String("cosign-issuer", ".*", "OIDC issuer regexp the certificate of keyless signatures must match")
+		provenance  = fs.Bool("verify-provenance", false, "also require a SLSA provenance attestation verified by cosign")
+		readOnly    = fs.Bool("read-only", false, "refuse to change the cluster, e.g. to verify the health of a production cluster: scenarios with setup, triggers, or agents to deploy fail, the others only have their expectations checked")
+		update      = fs.Bool("update", false, "rewrite the golden files of scenario snapshots instead of comparing against them")
+		historyPath = fs.String("history", "", "append results to this run history file")
+		publishNS   = fs.String("publish-namespace", "", "record results as Events and in a results ConfigMap in this namespace")
+		publishCM   = fs.String("publish-configmap", publish.DefaultConfigMap, "name of the results ConfigMap written with --publish-namespace, on which Events are recorded too")
+		logSegment  = fs.Int64("log-segment-bytes", diagnostics.DefaultLogSegmentBytes, "size of each agent log segment kept for diagnostics")
+		logSegments = fs.Int("log-segments", diagnostics.DefaultLogSegments, "number of newest agent log segments kept")
+		artifactDir = fs.String("artifacts", "", "write results and diagnostics under <dir>/<run-id>/<scenario>/")
+		stateDir    = fs.String("state-dir", runner.DefaultStateDir, "directory for state kept between runs")
+		rerunFailed = fs.Bool("rerun-failed", envBool(runner.RerunFailedEnv), "only run scenarios that failed in the previous run (env "+runner.RerunFailedEnv+")")
+		shardIndex  = fs.Int("shard-index", 0, "index of the shard to run (0-based)")
+		shardTotal  = fs.Int("shard-total", 1, "number of shards the suite is split into")
+		shardByTime = fs.Bool("shard-by-duration", false, "balance shards by durations recorded in --history")
+		schedule    = fs.String("schedule", "", "keep running the suite on this cron schedule, e.g. \"*/30 * * * *\" or \"@every 1h\", until interrupted (the cluster is kept)")
+		webhook     = fs.String("notify-webhook", "", "with --schedule, post an alert to this URL when scenarios start or stop failing")
+		verbose     = fs.Bool("v", false, "log progress")
+		dimensions  = map[string]string{}
+		reporters   []runner.Reporter
+		asGroups    []string
+	)
+	fs.Func("as-group", "`group` to impersonate along with --as (repeatable)", func(v string) error {
+		asGroups = append(asGroups, v)
+		return nil
+	})
+	vars := varFlag(fs)
+	var quota agent.Quota
+	quota.Hard = resourceListFlag(fs, "agent-quota", "install a ResourceQuota with the hard limit `resource=quantity`, e.g. pods=10 or limits.memory=2Gi, in agent namespaces, failing scenarios whose agents it rejects (repeatable)")
+	quota.DefaultRequest = resourceListFlag(fs, "agent-default-request", "with --agent-quota, request `resource=quantity` for agent containers that set no request (repeatable)")
+	quota.DefaultLimit = resourceListFlag(fs, "agent-default-limit", "with --agent-quota, limit agent containers that set no limit to `resource=quantity` (repeatable)")
+	fs.Func("dimension", "label results with `key=value`, e.g. a matrix parameter, for per-dimension aggregation (repeatable)", func(v string) error {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || key == "" {
+			return errors.New("want key=value")
+		}
+		dimensions[key] = value
+		return nil
+	})
+	fs.Func("report", "also write results as `format=path`, where format is junit, json, html, or ndjson, which streams progress as it happens and takes - for stdout (repeatable)", func(v string) error {
+		rep, err := parseReporter(v)
+		if err != nil {
+			return err
+		}
+		reporters = append(reporters, rep)
+		return nil
+	})
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: kube-agents-test run [flags] <scenario file, dir, or remote source>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no scenarios given")
+	}
+	if len(quota.Hard) == 0 && (len(quota.DefaultRequest) > 0 || len(quota.DefaultLimit) > 0) {
+		return errors.New("--agent-default-request and --agent-default-limit need --agent-quota")
+	}
+	if *provenance && *cosignKey == "" && *cosignID == "" {
+		return errors.New("--verify-provenance needs --cosign-key or --cosign-identity")
+	}
+	if *readOnly && (*useKind || *agentsFile != "" || *runAnchor || *publishNS != "") {
+		return errors.New("--read-only cannot be combined with --kind, --agents, --run-anchor or --publish-namespace, which change the cluster")
+	}
+
+	scenarios, err := loadScenarios(ctx, vars, *kubeconfig, *kubeContext, fs.Args())
+	if err != nil {
+		return err
+	}
+	var sched soak.Schedule
+	if *schedule != "" {
+		if sched, err = soak.ParseSchedule(*schedule); err != nil {
+			return err
+		}
+	}
+
+	logger := slog.New(slog.DiscardHandler)
+	if *verbose {
+		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+	}
+
+	var provider cluster.Provider = &cluster.Existing{Path: *kubeconfig, Context: *kubeContext}
+	if *useKind {
+		provider = &cluster.Kind{Name: *kindName, NodeImage: *kindImage}
+	}
+	if err := provider.Create(ctx); err != nil {
+		return fmt.Errorf("creating cluster: %w", err)
+	}
+	contextName := *kubeContext
+	if *useKind {
+		contextName = ""
+	}
+	clients, err := kube.ForKubeconfig(provider.Kubeconfig(), contextName)
+	if err != nil {
+		return err
+	}
+
+	var engineOpts []engine.Option
+	var runnerOpts []runner.Option
+	var podOpts []agent.PodOption
+	if *runAnchor {
+		a := anchor.New(clients.Kubernetes)
+		engineOpts = append(engineOpts, engine.WithRunAnchor(a))
+		podOpts = append(podOpts, agent.WithRunAnchor(a))
+		runnerOpts = append(runnerOpts, runner.WithObserver(func(e runner.Event) {
+			if e.Type == runner.EventRunStarted {
+				a.SetRunID(e.RunID)
+			}
+		}))
+	}
+	var manager agent.Manager
+	if *agentsFile != "" {
+		registry, err := agent.LoadRegistry(*agentsFile)
+		if err != nil {
+			return err
+		}
+		if len(quota.Hard) > 0 {
+			podOpts = append(podOpts, agent.WithNamespaceQuota(quota))
+		}
+		pods := agent.NewPodManager(clients.Kubernetes, append(podOpts, agent.WithNamespacePerAgent(*agentNS), agent.WithRunScopedNames(*runScoped))...)
+		manager = pods
+		engineOpts = append(engineOpts, engine.WithAgents(manager, registry))
+		runnerOpts = append(runnerOpts, runner.WithObserver(func(e runner.Event) {
+			if e.Type == runner.EventRunStarted {
+				pods.SetRunID(e.RunID)
+			}
+		}))
+	}
+	engineOpts = append(engineOpts,
+		engine.WithCollector(diagnostics.NewClusterCollector(clients.Kubernetes, manager,
+			diagnostics.WithLogLimit(*logSegment, *logSegments))),
+		engine.WithPollInterval(*pollEvery),
+		engine.WithInformerCache(*informers),
+		engine.WithInformerOptions(engine.InformerOptions{Resync: *resync, DisableBookmarks: *noBookmarks}),
+		engine.WithSchemaValidation(*validate),
+		engine.WithAPIProxy(*proxyImage),
+		engine.WithAPIAccessCheck(*verifyAPI),
+		engine.WithSnapshotUpdate(*update),
+		engine.WithReadOnly(*readOnly),
+		engine.WithDefaultNamespace(*namespace),
+		engine.WithImpersonation(*asUser, asGroups...),
+		engine.WithLogger(logger),
+	)
+	if *pinImages || *cosignKey != "" || *cosignID != "" {
+		engineOpts = append(engineOpts, engine.WithImageResolver(agent.RegistryResolver{}))
+	}
+	if *cosignKey != "" || *cosignID != "" {
+		engineOpts = append(engineOpts, engine.WithImageVerifier(&agent.CosignVerifier{
+			Key: *cosignKey, Identity: *cosignID, Issuer: *cosignIss, Provenance: *provenance,
+		}))
+	}
+	eng, err := engine.New(clients.Config, engineOpts...)
+	if err != nil {
+		return err
+	}
+	defer eng.Close()
+
+	runnerOpts = append(runnerOpts,
+		runner.WithStateDir(*stateDir),
+		runner.WithRerunFailed(*rerunFailed),
+		runner.WithShard(*shardIndex, *shardTotal),
+		runner.WithWeightedShards(*shardByTime),
+		runner.WithArtifacts(*artifactDir),
+		runner.WithDimensions(dimensions),
+		runner.WithFingerprint(fingerprint.For(clients.Kubernetes)),
+		runner.WithLogger(logger),
+	)
+	var store *history.Store
+	if *historyPath != "" {
+		store, err = history.Open(*historyPath)
+		if err != nil {
+			return err
+		}
+		runnerOpts = append(runnerOpts, runner.WithHistory(store))
+	}
+	// Results streamed to stdout must not mix with the summary.
+	var out io.Writer = os.Stdout
+	for _, rep := range reporters {
+		runnerOpts = append(runnerOpts, runner.WithReporter(rep))
+		if nd, ok := rep.(*report.NDJSON); ok && nd.Path == report.Stdout {
+			out = os.Stderr
+		}
+	}
+	if *publishNS != "" {
+		p := publish.New(clients.Kubernetes, *publishNS, publish.WithConfigMap(*publishCM), publish.WithLogger(logger))
+		runnerOpts = append(runnerOpts, runner.WithObserver(p.Observe))
+	}
+
+	if sched != nil {
+		soakOpts := []soak.Option{soak.WithHistory(store), soak.WithRunOnStart(true), soak.WithLogger(logger)}
+		if *webhook != "" {
+			soakOpts = append(soakOpts, soak.WithNotifier(&notify.Webhook{URL: *webhook}))
+		}
+		return soak.New(sched, func(ctx context.Context) (*runner.SuiteResult, error) {
+			// Reload every time, so edited files and moved remote refs
+			// are picked up.
+			scenarios, err := loadScenarios(ctx, vars, *kubeconfig, *kubeContext, fs.Args())
+			if err != nil {
+				return nil, err
+			}
+			suite, err := runner.New(eng, runnerOpts...).RunSuite(ctx, scenarios)
+			if suite != nil {
+				printSuite(out, suite)
+			}
+			return suite, err
+		}, soakOpts...).Run(ctx)
+	}
+
+	suite, err := runner.New(eng, runnerOpts...).RunSuite(ctx, scenarios)
+	if suite != nil {
+		printSuite(out, suite)
+	}
+
+	if kind, ok := provider.(*cluster.Kind); ok && !*keepCluster && !kind.Reused() && suite != nil && suite.Passed() {
+		if delErr := provider.Delete(context.Background()); delErr != nil {
+			fmt.Fprintln(os.Stderr, "deleting cluster:", delErr)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+	if failed := suite.Failed(); len(failed) > 0 {
+		return fmt.Errorf("%d of %d scenarios failed", len(failed), len(suite.Results))
+	}
+	return nil
+}
+
+func printSuite(w io.Writer, suite *runner.SuiteResult) {
+	for _, res := range suite.Results {
+		if res.Skipped {
+			fmt.Fprintf(w, "SKIP  %s: %s\n", res.Scenario, res.SkipReason)
+			continue
+		}
+		status := "PASS"
+		if !res.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "%s  %s (%s)\n", status, res.Scenario, res.Duration.Round(time.Millisecond))
+		if len(res.Tenants) > 0 {
+			printTenants(w, res)
+		}
+		if res.Load != nil {
+			printLoad(w, res.Load)
+		}
+		if res.Error != "" {
+			fmt.Fprintf(w, "      %s\n", res.Error)
+		}
+		if res.Report != nil {
+			fmt.Fprintln(w, res.Report)
+		}
+	}
+	printAggregate(w, suite.Results)
+	skipped := len(suite.Skipped())
+	fmt.Fprintf(w, "run %s: %d scenarios, %d failed, %d skipped\n",
+		suite.RunID, len(suite.Results), len(suite.Failed())-skipped, skipped)
+	if suite.ArtifactsDir != "" {
+		fmt.Fprintf(w, "artifacts: %s\n", suite.ArtifactsDir)
+	}
+}
+
+// printAggregate prints the outcome per value of each dimension that has
+// failures, so failures confined to one combination stand out.
+func printAggregate(w io.Writer, results []*engine.Result) {
+	for _, d := range runner.Aggregate(results) {
+		if !d.Failing() {
+			continue
+		}
+		fmt.Fprintf(w, "by %s:\n", d.Dimension)
+		for _, t := range d.Values {
+			fmt.Fprintf(w, "  %-40s %d passed, %d failed", t.Value, t.Passed, t.Failed)
+			if t.Skipped > 0 {
+				fmt.Fprintf(w, ", %d skipped", t.Skipped)
+			}
+			if t.Failed > 0 {
+				fmt.Fprintf(w, " (%s)", strings.Join(t.FailedScenarios, ", "))
+			}
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+func printTenants(w io.Writer, res *engine.Result) {
+	converged := 0
+	for _, t := range res.Tenants {
+		if t.Converged {
+			converged++
+		}
+	}
+	fmt.Fprintf(w, "      tenants: %d of %d converged", converged, len(res.Tenants))
+	if converged > 0 {
+		fastest, median, slowest := res.TenantSpread()
+		fmt.Fprintf(w, "; latency fastest %s, median %s, slowest %s, spread %s",
+			fastest.Round(time.Millisecond), median.Round(time.Millisecond),
+			slowest.Round(time.Millisecond), (slowest - fastest).Round(time.Millisecond))
+	}
+	fmt.Fprintln(w)
+}
+
+func printLoad(w io.Writer, l *engine.LoadResult) {
+	fmt.Fprintf(w, "      load: %d arrivals, %d converged, %d create errors, %d timed out (error rate %.1f%%) in %s, %.2f/s\n",
+		l.Arrivals, l.Converged(), l.CreateErrors, l.TimedOut, 100*l.ErrorRate(),
+		l.Elapsed.Round(time.Millisecond), l.Throughput())
+	if l.Converged() > 0 {
+		fmt.Fprintf(w, "      latency p50 %s, p90 %s, p99 %s, max %s\n",
+			l.Percentile(50).Round(time.Millisecond), l.Percentile(90).Round(time.Millisecond),
+			l.Percentile(99).Round(time.Millisecond), l.Percentile(100).Round(time.Millisecond))
+	}
+}
+
+// parseReporter returns the reporter for a --report value.
+func parseReporter(v string) (runner.Reporter, error) {
+	format, path, ok := strings.Cut(v, "=")
+	if !ok || path == "" {
+		return nil, errors.New("want format=path")
+	}
+	switch format {
+	case "junit":
+		return &report.JUnit{Path: path}, nil
+	case "json":
+		return &report.JSON{Path: path}, nil
+	case "html":
+		return &report.HTML{Path: path}, nil
+	case "ndjson":
+		return &report.NDJSON{Path: path}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, want junit, json, html or ndjson", format)
+}
+
+// resourceListFlag defines a repeatable flag of resource=quantity values
+// and returns the resource list it collects.
+func resourceListFlag(fs *flag.FlagSet, name, usage string) corev1.ResourceList {
+	list := corev1.ResourceList{}
+	fs.Func(name, usage, func(v string) error {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || key == "" {
+			return errors.New("want resource=quantity")
+		}
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		list[corev1.ResourceName(key)] = q
+		return nil
+	})
+	return list
+}
+
+func envBool(name string) bool {
+	v, _ := strconv.ParseBool(os.Getenv(name))
+	return v
+}
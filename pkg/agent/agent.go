@@ -0,0 +1,207 @@
+// Package agent deploys, restarts, and stops the agents under test.
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/envsubst"
+)
+
+// Spec describes how to run one agent.
+type Spec struct {
+	Name           string            `json:"name"`
+	Image          string            `json:"image"`
+	Args           []string          `json:"args,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`
+	ServiceAccount string            `json:"serviceAccount,omitempty"`
+	// ConfigMaps mounts ConfigMaps in the agent's namespace, keyed by
+	// name, at the given directories.
+	ConfigMaps map[string]string `json:"configMaps,omitempty"`
+	// Allow lists the API requests the agent is expected to make. When set
+	// and access checking is enabled, a scenario fails if the agent made
+	// any other request.
+	Allow []APIRule `json:"allow,omitempty"`
+	// FieldManager is the name the agent's writes carry in managedFields;
+	// the agent name if unset. Go clients default to their binary name.
+	FieldManager string `json:"fieldManager,omitempty"`
+	// DeploymentTemplate is a text/template, executed with TemplateData,
+	// of YAML merged into the Deployment PodManager renders for the agent,
+	// e.g. to add labels or annotations admission policies require. It is
+	// applied after the registry's global template.
+	DeploymentTemplate string `json:"deploymentTemplate,omitempty"`
+	// GlobalDeploymentTemplate is the registry's template for every
+	// agent, set by LoadRegistry.
+	GlobalDeploymentTemplate string `json:"-"`
+	// Scenario is the scenario the agent is deployed for, set by the
+	// engine; it labels the agent's namespace.
+	Scenario string `json:"-"`
+}
+
+// FieldManagerOrDefault returns FieldManager, falling back to the name.
+func (s Spec) FieldManagerOrDefault() string {
+	if s.FieldManager == "" {
+		return s.Name
+	}
+	return s.FieldManager
+}
+
+// APIRule allows API requests, like an RBAC policy rule. Resources are
+// written resource[.group][/subresource], e.g. "pods", "deployments.apps",
+// or "pods/log"; without a group a resource matches in any group, and
+// subresources must be listed explicitly. "*" matches any verb or resource.
+type APIRule struct {
+	Verbs     []string `json:"verbs"`
+	Resources []string `json:"resources"`
+}
+
+// Allows reports whether the rule allows verb on the resource in group,
+// optionally on a subresource.
+func (r APIRule) Allows(verb, group, resource, subresource string) bool {
+	if !slices.Contains(r.Verbs, "*") && !slices.Contains(r.Verbs, verb) {
+		return false
+	}
+	for _, want := range r.Resources {
+		if want == "*" {
+			return true
+		}
+		name, sub, _ := strings.Cut(want, "/")
+		name, g, grouped := strings.Cut(name, ".")
+		if name == resource && sub == subresource && (!grouped || g == group) {
+			return true
+		}
+	}
+	return false
+}
+
+// Manager controls the lifecycle of agents in the test cluster.
+type Manager interface {
+	// Deploy starts the agent. Deploying an already running agent updates it.
+	Deploy(ctx context.Context, spec Spec) error
+	// WaitReady blocks until the agent has a ready pod.
+	WaitReady(ctx context.Context, name string) error
+	// Restart kills the agent's pods and lets them be recreated.
+	Restart(ctx context.Context, name string) error
+	// Stop removes the agent.
+	Stop(ctx context.Context, name string) error
+	// KillPod deletes one of the agent's pods, picked at random, and
+	// returns its name.
+	KillPod(ctx context.Context, name string) (string, error)
+	// Isolate cuts the agent's pods off from all network traffic until
+	// Reconnect is called.
+	Isolate(ctx context.Context, name string) error
+	// Reconnect undoes Isolate.
+	Reconnect(ctx context.Context, name string) error
+	// Namespace returns the namespace the agent runs in.
+	Namespace(name string) string
+	// ReadyPod returns the namespace and name of one of the agent's ready
+	// pods.
+	ReadyPod(ctx context.Context, name string) (namespace, pod string, err error)
+	// ImageID returns the image ID, digest included, that the agent
+	// container of one of the agent's ready pods runs.
+	ImageID(ctx context.Context, name string) (string, error)
+	// Logs streams logs of the agent's newest pod to w.
+	Logs(ctx context.Context, name string, w io.Writer, opts LogOptions) error
+}
+
+// LogOptions selects which logs Manager.Logs streams. The zero value
+// streams the last hour of the agent container's logs.
+type LogOptions struct {
+	// Since limits the logs to those written at or after it.
+	Since time.Time
+	// Container defaults to the agent container; set it to read a sidecar
+	// added by a deployment template.
+	Container string
+	// Previous reads the logs of the container's previous instance, such as
+	// the one that crashed before the current restart.
+	Previous bool
+	// TailLines, when positive, limits the logs to their last lines.
+	TailLines int64
+	// Timestamps prefixes every line with its RFC 3339 timestamp.
+	Timestamps bool
+}
+
+// Registry maps agent names, as referenced by scenarios, to their specs.
+type Registry map[string]Spec
+
+// LoadRegistry reads agent specs from a YAML file of the form:
+//
+//	deploymentTemplate: |  # optional, for every agent
+//	  metadata:
+//	    annotations:
+//	      owner: platform-team
+//	agents:
+//	  - name: scaling-agent
+//	    image: registry.example.com/scaling-agent:v1
+func LoadRegistry(path string) (Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		DeploymentTemplate string `json:"deploymentTemplate,omitempty"`
+		Agents             []Spec `json:"agents"`
+	}
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if _, err := parseTemplate("deploymentTemplate", file.DeploymentTemplate); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	reg := Registry{}
+	for _, s := range file.Agents {
+		if s.Name == "" || s.Image == "" {
+			return nil, fmt.Errorf("%s: agent entries need a name and an image", path)
+		}
+		for i, r := range s.Allow {
+			if len(r.Verbs) == 0 || len(r.Resources) == 0 {
+				return nil, fmt.Errorf("%s: agent %s: allow[%d] needs verbs and resources", path, s.Name, i)
+			}
+		}
+		if s.Image, err = envsubst.Expand(s.Image); err != nil {
+			return nil, fmt.Errorf("%s: agent %s: image: %w", path, s.Name, err)
+		}
+		if _, err := parseTemplate("deploymentTemplate", s.DeploymentTemplate); err != nil {
+			return nil, fmt.Errorf("%s: agent %s: %w", path, s.Name, err)
+		}
+		s.GlobalDeploymentTemplate = file.DeploymentTemplate
+		reg[s.Name] = s
+	}
+	return reg, nil
+}
+
+// WithImages returns a copy of r in which the agents named in images, which
+// maps agent names to images, run those images, failing on unknown names.
+func (r Registry) WithImages(images map[string]string) (Registry, error) {
+	out := maps.Clone(r)
+	for name, image := range images {
+		s, ok := out[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown agent %q", name)
+		}
+		s.Image = image
+		out[name] = s
+	}
+	return out, nil
+}
+
+// Lookup returns the specs for the named agents, failing on unknown names.
+func (r Registry) Lookup(names ...string) ([]Spec, error) {
+	specs := make([]Spec, 0, len(names))
+	for _, n := range names {
+		s, ok := r[n]
+		if !ok {
+			return nil, fmt.Errorf("unknown agent %q", n)
+		}
+		specs = append(specs, s)
+	}
+	return specs, nil
+}
@@ -0,0 +1,161 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"oras.land/oras-go/v2/registry"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	"oras.land/oras-go/v2/registry/remote/credentials"
+	"oras.land/oras-go/v2/registry/remote/retry"
+)
+
+// ImageResolver pins image references to the digest they currently refer
+// to, so a deployment runs exactly the image that was resolved.
+type ImageResolver interface {
+	// Resolve returns image with the digest of what it refers to, e.g.
+	// example.com/agent:v1@sha256:... for example.com/agent:v1.
+	Resolve(ctx context.Context, image string) (string, error)
+}
+
+// ImageVerifier checks an image before it is deployed.
+type ImageVerifier interface {
+	// Verify returns an error when image, pinned by digest, must not be
+	// deployed.
+	Verify(ctx context.Context, image string) error
+}
+
+// RegistryResolver resolves tags with the registry that serves them,
+// authenticating with the credentials of the Docker config. Registries on
+// localhost are reached over plain HTTP. Images already pinned by digest
+// are returned as they are.
+type RegistryResolver struct{}
+
+var _ ImageResolver = RegistryResolver{}
+
+// Resolve asks the image's registry for the digest its tag refers to.
+func (RegistryResolver) Resolve(ctx context.Context, image string) (string, error) {
+	if strings.Contains(image, "@") {
+		return image, nil
+	}
+	name := normalizeImage(image)
+	ref, err := registry.ParseReference(name)
+	if err != nil {
+		return "", fmt.Errorf("image %s: %w", image, err)
+	}
+	repo, err := remote.NewRepository(name)
+	if err != nil {
+		return "", fmt.Errorf("image %s: %w", image, err)
+	}
+	if repo.Reference.Registry == "docker.io" {
+		repo.Reference.Registry = "registry-1.docker.io"
+	}
+	repo.PlainHTTP = isLocalhost(ref.Host())
+	store, err := credentials.NewStoreFromDocker(credentials.StoreOptions{})
+	if err != nil {
+		return "", err
+	}
+	repo.Client = &auth.Client{
+		Client:     retry.DefaultClient,
+		Cache:      auth.NewCache(),
+		Credential: credentials.Credential(store),
+	}
+	desc, err := repo.Resolve(ctx, ref.Reference)
+	if err != nil {
+		return "", fmt.Errorf("resolving image %s: %w", image, err)
+	}
+	return image + "@" + desc.Digest.String(), nil
+}
+
+// normalizeImage returns image with the registry and tag the container
+// runtime assumes when they are left out: Docker Hub, library/ for
+// single-component names, and latest.
+func normalizeImage(image string) string {
+	first, _, found := strings.Cut(image, "/")
+	switch {
+	case !found:
+		image = "docker.io/library/" + image
+	case !strings.ContainsAny(first, ".:") && first != "localhost":
+		image = "docker.io/" + image
+	}
+	if i := strings.LastIndex(image, "/"); !strings.Contains(image[i:], ":") {
+		image += ":latest"
+	}
+	return image
+}
+
+func isLocalhost(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// CosignVerifier verifies image signatures, and optionally SLSA
+// provenance attestations, with the cosign CLI, which must be installed.
+// With Key, signatures must verify against that public key; otherwise
+// they are verified keyless, against the certificate identity and OIDC
+// issuer. Verified digests are remembered, so each image is verified once.
+type CosignVerifier struct {
+	// Key is the path or KMS URI of the public key images are signed with.
+	Key string
+	// Identity and Issuer are the regular expressions the signing
+	// certificate's identity and OIDC issuer must match for keyless
+	// verification.
+	Identity string
+	Issuer   string
+	// Provenance also requires a verified SLSA provenance attestation.
+	Provenance bool
+
+	verified sync.Map
+}
+
+var _ ImageVerifier = (*CosignVerifier)(nil)
+
+// Verify runs cosign verify, and cosign verify-attestation with
+// Provenance, on image.
+func (v *CosignVerifier) Verify(ctx context.Context, image string) error {
+	if _, ok := v.verified.Load(image); ok {
+		return nil
+	}
+	if !strings.Contains(image, "@") {
+		return fmt.Errorf("image %s is not pinned by digest", image)
+	}
+	var flags []string
+	if v.Key != "" {
+		flags = append(flags, "--key", v.Key)
+	} else {
+		flags = append(flags, "--certificate-identity-regexp", v.Identity, "--certificate-oidc-issuer-regexp", v.Issuer)
+	}
+	if err := cosign(ctx, append(append([]string{"verify"}, flags...), image)...); err != nil {
+		return err
+	}
+	if v.Provenance {
+		if err := cosign(ctx, append(append([]string{"verify-attestation", "--type", "slsaprovenance"}, flags...), image)...); err != nil {
+			return err
+		}
+	}
+	v.verified.Store(image, true)
+	return nil
+}
+
+func cosign(ctx context.Context, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "cosign", args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("cosign %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,460 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/anchor"
+)
+
+const (
+	// Namespace is where PodManager deploys agents, unless each gets its
+	// own namespace.
+	Namespace = "kube-agents"
+
+	// ContainerName is the name of the agent container in its pod.
+	ContainerName = "agent"
+
+	// LabelAgent carries the agent name on everything PodManager creates.
+	LabelAgent = "kube-agents-test/agent"
+	// LabelRunID and LabelScenario label agent namespaces with the run
+	// and the scenario that last deployed an agent in them.
+	LabelRunID    = "kube-agents-test/run-id"
+	LabelScenario = "kube-agents-test/scenario"
+
+	logWindow = time.Hour
+)
+
+// PodManager runs each agent as a single-replica Deployment.
+type PodManager struct {
+	client   kubernetes.Interface
+	perAgent bool
+	anchor   *anchor.Anchor
+
+	// runScoped names Deployments after the run they are deployed for.
+	runScoped bool
+	// quota, if set, is installed in agent namespaces.
+	quota *Quota
+
+	mu           sync.Mutex
+	defaultRunID string
+}
+
+var _ Manager = (*PodManager)(nil)
+
+// PodOption configures a PodManager.
+type PodOption func(*PodManager)
+
+// WithNamespacePerAgent deploys each agent in a namespace of its own,
+// named after it, instead of sharing Namespace. Service accounts the
+// agents' specs name must exist in their namespaces.
+func WithNamespacePerAgent(enabled bool) PodOption {
+	return func(m *PodManager) { m.perAgent = enabled }
+}
+
+// WithRunAnchor makes the namespaces, Deployments and NetworkPolicies the
+// manager creates owned by the run anchor a. See package anchor.
+func WithRunAnchor(a *anchor.Anchor) PodOption {
+	return func(m *PodManager) { m.anchor = a }
+}
+
+// WithRunScopedNames gives each run its own Deployment of an agent, named
+// after the run ID, and its pods a run ID label, so concurrent runs sharing
+// a cluster can deploy the same agent side by side. The run ID comes from
+// the context of each call (see ContextWithRunID), or else from SetRunID.
+// Without it, an agent's Deployment is named after the agent alone.
+func WithRunScopedNames(enabled bool) PodOption {
+	return func(m *PodManager) { m.runScoped = enabled }
+}
+
+// NewPodManager returns a Manager that deploys agents as Deployments.
+func NewPodManager(client kubernetes.Interface, opts ...PodOption) *PodManager {
+	m := &PodManager{client: client}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// SetRunID sets the run ID agent namespaces are labeled with from the
+// next Deploy on, for calls whose context carries none.
+func (m *PodManager) SetRunID(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.defaultRunID = id
+}
+
+// Namespace returns the namespace the agent is deployed in.
+func (m *PodManager) Namespace(name string) string {
+	if !m.perAgent {
+		return Namespace
+	}
+	return agentNamespace(name)
+}
+
+// agentNamespace returns the namespace of its own an agent gets. Names too
+// long for a namespace are shortened and made unique with a hash.
+func agentNamespace(name string) string {
+	ns := Namespace + "-" + name
+	if len(ns) <= validation.DNS1123LabelMaxLength {
+		return ns
+	}
+	sum := sha256.Sum256([]byte(name))
+	suffix := "-" + hex.EncodeToString(sum[:])[:8]
+	return strings.TrimRight(ns[:validation.DNS1123LabelMaxLength-len(suffix)], "-") + suffix
+}
+
+// Deploy creates or updates the agent's Deployment.
+func (m *PodManager) Deploy(ctx context.Context, spec Spec) error {
+	ns := m.Namespace(spec.Name)
+	if err := m.ensureNamespace(ctx, ns, m.namespaceLabels(ctx, spec)); err != nil {
+		return err
+	}
+	if err := m.ensureQuota(ctx, ns); err != nil {
+		return fmt.Errorf("deploying agent %s: %w", spec.Name, err)
+	}
+	desired, err := m.deployment(ctx, spec, ns)
+	if err != nil {
+		return fmt.Errorf("deploying agent %s: %w", spec.Name, err)
+	}
+	deployments := m.client.AppsV1().Deployments(ns)
+	owned := desired.DeepCopy()
+	if err := m.anchor.Own(ctx, owned); err != nil {
+		return fmt.Errorf("deploying agent %s: %w", spec.Name, err)
+	}
+	_, err = deployments.Create(ctx, owned, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		existing, getErr := deployments.Get(ctx, desired.Name, metav1.GetOptions{})
+		if getErr != nil {
+			return fmt.Errorf("getting agent %s: %w", spec.Name, getErr)
+		}
+		update := desired.DeepCopy()
+		update.ResourceVersion = existing.ResourceVersion
+		if err := m.anchor.OwnUpdate(ctx, update, existing); err != nil {
+			return fmt.Errorf("deploying agent %s: %w", spec.Name, err)
+		}
+		_, err = deployments.Update(ctx, update, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("deploying agent %s: %w", spec.Name, err)
+	}
+	return nil
+}
+
+// WaitReady polls until the agent's Deployment reports a ready replica. It
+// fails early if a quota keeps the Deployment from creating pods.
+func (m *PodManager) WaitReady(ctx context.Context, name string) error {
+	err := wait.PollUntilContextCancel(ctx, time.Second, true, func(ctx context.Context) (bool, error) {
+		d, err := m.client.AppsV1().Deployments(m.Namespace(name)).Get(ctx, m.deploymentName(ctx, name), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if msg := quotaFailure(d); msg != "" {
+			return false, fmt.Errorf("quota forbids its pods: %s", msg)
+		}
+		return d.Status.ObservedGeneration >= d.Generation && d.Status.ReadyReplicas > 0, nil
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for agent %s: %w", name, err)
+	}
+	return nil
+}
+
+// Restart deletes the agent's pods so the Deployment recreates them.
+func (m *PodManager) Restart(ctx context.Context, name string) error {
+	err := m.client.CoreV1().Pods(m.Namespace(name)).DeleteCollection(ctx, metav1.DeleteOptions{}, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(m.podLabels(ctx, name)).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("restarting agent %s: %w", name, err)
+	}
+	return nil
+}
+
+// KillPod deletes a random pod of the agent; its ReplicaSet replaces it.
+func (m *PodManager) KillPod(ctx context.Context, name string) (string, error) {
+	pods, err := m.client.CoreV1().Pods(m.Namespace(name)).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(m.podLabels(ctx, name)).String(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("listing pods of agent %s: %w", name, err)
+	}
+	if len(pods.Items) == 0 {
+		return "", fmt.Errorf("agent %s has no pods", name)
+	}
+	victim := pods.Items[rand.IntN(len(pods.Items))].Name
+	if err := m.client.CoreV1().Pods(m.Namespace(name)).Delete(ctx, victim, metav1.DeleteOptions{}); err != nil {
+		return "", fmt.Errorf("killing pod %s of agent %s: %w", victim, name, err)
+	}
+	return victim, nil
+}
+
+// ReadyPod returns a ready pod of the agent.
+func (m *PodManager) ReadyPod(ctx context.Context, name string) (string, string, error) {
+	pods, err := m.client.CoreV1().Pods(m.Namespace(name)).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(m.podLabels(ctx, name)).String(),
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("listing pods of agent %s: %w", name, err)
+	}
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil && podReady(&pod) {
+			return m.Namespace(name), pod.Name, nil
+		}
+	}
+	return "", "", fmt.Errorf("agent %s has no ready pod", name)
+}
+
+// ImageID returns the image ID the container runtime reports for the agent
+// container of one of the agent's ready pods.
+func (m *PodManager) ImageID(ctx context.Context, name string) (string, error) {
+	ns, podName, err := m.ReadyPod(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	pod, err := m.client.CoreV1().Pods(ns).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("getting pod of agent %s: %w", name, err)
+	}
+	for _, c := range pod.Status.ContainerStatuses {
+		if c.Name == ContainerName && c.ImageID != "" {
+			return c.ImageID, nil
+		}
+	}
+	return "", fmt.Errorf("pod %s/%s of agent %s reports no image ID", ns, podName, name)
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// Isolate applies a deny-all NetworkPolicy to the agent's pods. It only
+// takes effect when the cluster's network plugin enforces NetworkPolicy.
+func (m *PodManager) Isolate(ctx context.Context, name string) error {
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      partitionPolicyName(m.deploymentName(ctx, name)),
+			Namespace: m.Namespace(name),
+			Labels:    m.podLabels(ctx, name),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: m.podLabels(ctx, name)},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+		},
+	}
+	if err := m.anchor.Own(ctx, policy); err != nil {
+		return fmt.Errorf("isolating agent %s: %w", name, err)
+	}
+	_, err := m.client.NetworkingV1().NetworkPolicies(m.Namespace(name)).Create(ctx, policy, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("isolating agent %s: %w", name, err)
+	}
+	return nil
+}
+
+// Reconnect removes the NetworkPolicy applied by Isolate.
+func (m *PodManager) Reconnect(ctx context.Context, name string) error {
+	err := m.client.NetworkingV1().NetworkPolicies(m.Namespace(name)).Delete(ctx, partitionPolicyName(m.deploymentName(ctx, name)), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("reconnecting agent %s: %w", name, err)
+	}
+	return nil
+}
+
+func partitionPolicyName(deployment string) string {
+	return deployment + "-partition"
+}
+
+// Stop deletes the agent's Deployment and its pods.
+func (m *PodManager) Stop(ctx context.Context, name string) error {
+	policy := metav1.DeletePropagationForeground
+	err := m.client.AppsV1().Deployments(m.Namespace(name)).Delete(ctx, m.deploymentName(ctx, name), metav1.DeleteOptions{
+		PropagationPolicy: &policy,
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("stopping agent %s: %w", name, err)
+	}
+	return nil
+}
+
+// Logs streams logs from the agent's newest pod to w without buffering
+// them.
+func (m *PodManager) Logs(ctx context.Context, name string, w io.Writer, opts LogOptions) error {
+	pods, err := m.client.CoreV1().Pods(m.Namespace(name)).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(m.podLabels(ctx, name)).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("listing pods of agent %s: %w", name, err)
+	}
+	if len(pods.Items) == 0 {
+		return fmt.Errorf("agent %s has no pods", name)
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[j].CreationTimestamp.Before(&pods.Items[i].CreationTimestamp)
+	})
+
+	req := m.client.CoreV1().Pods(m.Namespace(name)).GetLogs(pods.Items[0].Name, opts.podLogOptions())
+	stream, err := req.Stream(ctx)
+	if err != nil {
+		return fmt.Errorf("streaming logs of agent %s: %w", name, err)
+	}
+	defer stream.Close()
+	if _, err := io.Copy(w, stream); err != nil {
+		return fmt.Errorf("copying logs of agent %s: %w", name, err)
+	}
+	return nil
+}
+
+func (o LogOptions) podLogOptions() *corev1.PodLogOptions {
+	p := &corev1.PodLogOptions{
+		Container:  o.Container,
+		Previous:   o.Previous,
+		Timestamps: o.Timestamps,
+	}
+	if p.Container == "" {
+		p.Container = ContainerName
+	}
+	if o.Since.IsZero() {
+		since := int64(logWindow.Seconds())
+		p.SinceSeconds = &since
+	} else {
+		p.SinceTime = &metav1.Time{Time: o.Since}
+	}
+	if o.TailLines > 0 {
+		p.TailLines = &o.TailLines
+	}
+	return p
+}
+
+// namespaceLabels returns the labels of the namespace spec is deployed in.
+func (m *PodManager) namespaceLabels(ctx context.Context, spec Spec) map[string]string {
+	labels := map[string]string{}
+	if m.perAgent {
+		labels[LabelAgent] = spec.Name
+	}
+	if id := m.runID(ctx); id != "" {
+		labels[LabelRunID] = id
+	}
+	if spec.Scenario != "" && len(validation.IsValidLabelValue(spec.Scenario)) == 0 {
+		labels[LabelScenario] = spec.Scenario
+	}
+	return labels
+}
+
+// ensureNamespace creates the namespace, or adds labels to it.
+func (m *PodManager) ensureNamespace(ctx context.Context, name string, labels map[string]string) error {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	if err := m.anchor.Own(ctx, ns); err != nil {
+		return fmt.Errorf("creating agent namespace %s: %w", name, err)
+	}
+	_, err := m.client.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) && len(labels) > 0 {
+		patch, _ := json.Marshal(map[string]any{"metadata": map[string]any{"labels": labels}})
+		_, err = m.client.CoreV1().Namespaces().Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	}
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("creating agent namespace %s: %w", name, err)
+	}
+	return nil
+}
+
+// deployment renders the agent's Deployment and applies its deployment
+// templates.
+func (m *PodManager) deployment(ctx context.Context, spec Spec, namespace string) (*appsv1.Deployment, error) {
+	d := deployment(spec, m.deploymentName(ctx, spec.Name), namespace, m.podLabels(ctx, spec.Name))
+	data := TemplateData{Name: spec.Name, Namespace: namespace, Image: spec.Image, Scenario: spec.Scenario, RunID: m.runID(ctx)}
+	templates := []struct{ name, text string }{
+		{"global deploymentTemplate", spec.GlobalDeploymentTemplate},
+		{"deploymentTemplate", spec.DeploymentTemplate},
+	}
+	for _, t := range templates {
+		if t.text == "" {
+			continue
+		}
+		var err error
+		if d, err = applyTemplate(d, t.name, t.text, data); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// deployment renders the agent's Deployment, named name, whose pods carry
+// labels.
+func deployment(spec Spec, name, namespace string, labels map[string]string) *appsv1.Deployment {
+	replicas := int32(1)
+
+	env := make([]corev1.EnvVar, 0, len(spec.Env))
+	for k, v := range spec.Env {
+		env = append(env, corev1.EnvVar{Name: k, Value: v})
+	}
+	sort.Slice(env, func(i, j int) bool { return env[i].Name < env[j].Name })
+
+	var volumes []corev1.Volume
+	var mounts []corev1.VolumeMount
+	for name, dir := range spec.ConfigMaps {
+		volumes = append(volumes, corev1.Volume{
+			Name: name,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: name}},
+			},
+		})
+		mounts = append(mounts, corev1.VolumeMount{Name: name, MountPath: dir, ReadOnly: true})
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Name < volumes[j].Name })
+	sort.Slice(mounts, func(i, j int) bool { return mounts[i].Name < mounts[j].Name })
+
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: spec.ServiceAccount,
+					Containers: []corev1.Container{{
+						Name:         ContainerName,
+						Image:        spec.Image,
+						Args:         spec.Args,
+						Env:          env,
+						VolumeMounts: mounts,
+					}},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+}
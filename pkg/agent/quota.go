@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// QuotaName names the ResourceQuota and LimitRange PodManager installs in
+// agent namespaces.
+const QuotaName = "kube-agents-test"
+
+// Quota bounds what the agents in a namespace may use, so a misbehaving
+// agent cannot starve the cluster the framework shares with others.
+type Quota struct {
+	// Hard is the ResourceQuota's limits, e.g. pods, requests.cpu or
+	// limits.memory.
+	Hard corev1.ResourceList
+	// DefaultRequest and DefaultLimit are the requests and limits a
+	// LimitRange gives agent containers that set none, so that quotas on
+	// requests or limits admit them.
+	DefaultRequest corev1.ResourceList
+	DefaultLimit   corev1.ResourceList
+}
+
+// WithNamespaceQuota installs a ResourceQuota and, if q has defaults, a
+// LimitRange in the namespaces agents are deployed in.
+func WithNamespaceQuota(q Quota) PodOption {
+	return func(m *PodManager) { m.quota = &q }
+}
+
+// ensureQuota creates or updates the quota objects of ns.
+func (m *PodManager) ensureQuota(ctx context.Context, ns string) error {
+	if m.quota == nil {
+		return nil
+	}
+	if len(m.quota.Hard) > 0 {
+		quota := &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: QuotaName, Namespace: ns},
+			Spec:       corev1.ResourceQuotaSpec{Hard: m.quota.Hard},
+		}
+		if err := m.anchor.Own(ctx, quota); err != nil {
+			return fmt.Errorf("creating quota in %s: %w", ns, err)
+		}
+		quotas := m.client.CoreV1().ResourceQuotas(ns)
+		_, err := quotas.Create(ctx, quota, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			var existing *corev1.ResourceQuota
+			if existing, err = quotas.Get(ctx, QuotaName, metav1.GetOptions{}); err == nil {
+				existing.Spec = quota.Spec
+				_, err = quotas.Update(ctx, existing, metav1.UpdateOptions{})
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("creating quota in %s: %w", ns, err)
+		}
+	}
+	if len(m.quota.DefaultRequest) > 0 || len(m.quota.DefaultLimit) > 0 {
+		limits := &corev1.LimitRange{
+			ObjectMeta: metav1.ObjectMeta{Name: QuotaName, Namespace: ns},
+			Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
+				Type:           corev1.LimitTypeContainer,
+				DefaultRequest: m.quota.DefaultRequest,
+				Default:        m.quota.DefaultLimit,
+			}}},
+		}
+		if err := m.anchor.Own(ctx, limits); err != nil {
+			return fmt.Errorf("creating limit range in %s: %w", ns, err)
+		}
+		ranges := m.client.CoreV1().LimitRanges(ns)
+		_, err := ranges.Create(ctx, limits, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			var existing *corev1.LimitRange
+			if existing, err = ranges.Get(ctx, QuotaName, metav1.GetOptions{}); err == nil {
+				existing.Spec = limits.Spec
+				_, err = ranges.Update(ctx, existing, metav1.UpdateOptions{})
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("creating limit range in %s: %w", ns, err)
+		}
+	}
+	return nil
+}
+
+// quotaFailure returns why d cannot create its pods if a quota, whether
+// installed with WithNamespaceQuota or by the cluster's admins, forbids
+// them, and "" otherwise. Admission rejects such pods outright, so rather
+// than being Pending they never appear and only the Deployment tells.
+func quotaFailure(d *appsv1.Deployment) string {
+	for _, c := range d.Status.Conditions {
+		if c.Type == appsv1.DeploymentReplicaFailure && c.Status == corev1.ConditionTrue && strings.Contains(c.Message, "quota") {
+			return c.Message
+		}
+	}
+	return ""
+}
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+type runIDKey struct{}
+
+// ContextWithRunID returns a context carrying the ID of the run agents are
+// managed for. A PodManager with run-scoped names uses it to tell apart the
+// Deployments concurrent runs make of the same agent; see
+// WithRunScopedNames.
+func ContextWithRunID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, runIDKey{}, id)
+}
+
+// RunIDFromContext returns the run ID set by ContextWithRunID, or "".
+func RunIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey{}).(string)
+	return id
+}
+
+// runID returns the run an operation is for: the context's, falling back
+// to the one set with SetRunID.
+func (m *PodManager) runID(ctx context.Context) string {
+	if id := RunIDFromContext(ctx); id != "" {
+		return id
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.defaultRunID
+}
+
+// deploymentName returns the name of the agent's Deployment. With
+// run-scoped names it carries a short hash of the run ID, so the name
+// stays valid whatever the ID looks like.
+func (m *PodManager) deploymentName(ctx context.Context, name string) string {
+	id := m.runID(ctx)
+	if !m.runScoped || id == "" {
+		return name
+	}
+	sum := sha256.Sum256([]byte(id))
+	return name + "-" + hex.EncodeToString(sum[:])[:8]
+}
+
+// podLabels returns the labels selecting the agent's pods, which include
+// the run ID when names are run-scoped.
+func (m *PodManager) podLabels(ctx context.Context, name string) map[string]string {
+	labels := map[string]string{LabelAgent: name}
+	if id := m.runID(ctx); m.runScoped && id != "" {
+		labels[LabelRunID] = id
+	}
+	return labels
+}
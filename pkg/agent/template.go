@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"sigs.k8s.io/yaml"
+)
+
+// TemplateData is what deployment templates are executed with.
+type TemplateData struct {
+	// Name is the agent's name.
+	Name      string
+	Namespace string
+	Image     string
+	// Scenario and RunID are those the agent is deployed for; either may
+	// be empty.
+	Scenario string
+	RunID    string
+}
+
+// parseTemplate parses a deployment template; name identifies it in
+// errors.
+func parseTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", name, err)
+	}
+	return t, nil
+}
+
+// applyTemplate executes a deployment template with data and merges the
+// resulting YAML into d like kubectl patch --type strategic, so a template
+// can add metadata, pod spec fields, sidecars, or fields of the agent
+// container, which it names by ContainerName. Templates must not change
+// the Deployment's name, namespace or selector, nor remove the agent
+// container.
+func applyTemplate(d *appsv1.Deployment, name, text string, data TemplateData) (*appsv1.Deployment, error) {
+	t, err := parseTemplate(name, text)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := t.Execute(&out, data); err != nil {
+		return nil, fmt.Errorf("executing %s: %w", name, err)
+	}
+	patch, err := yaml.YAMLToJSON(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if string(patch) == "null" {
+		return d, nil
+	}
+	base, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := strategicpatch.StrategicMergePatch(base, patch, appsv1.Deployment{})
+	if err != nil {
+		return nil, fmt.Errorf("applying %s: %w", name, err)
+	}
+	var result appsv1.Deployment
+	if err := json.Unmarshal(merged, &result); err != nil {
+		return nil, fmt.Errorf("applying %s: %w", name, err)
+	}
+	switch {
+	case result.Name != d.Name || result.Namespace != d.Namespace:
+		return nil, fmt.Errorf("%s: must not change the Deployment's name or namespace", name)
+	case !equality.Semantic.DeepEqual(result.Spec.Selector, d.Spec.Selector):
+		return nil, fmt.Errorf("%s: must not change the Deployment's selector", name)
+	case result.Spec.Template.Labels[LabelAgent] != d.Spec.Template.Labels[LabelAgent]:
+		return nil, fmt.Errorf("%s: must not change the pod label %s", name, LabelAgent)
+	case result.Spec.Template.Labels[LabelRunID] != d.Spec.Template.Labels[LabelRunID]:
+		return nil, fmt.Errorf("%s: must not change the pod label %s", name, LabelRunID)
+	case !hasContainer(&result, ContainerName):
+		return nil, fmt.Errorf("%s: must not remove the %s container", name, ContainerName)
+	}
+	return &result, nil
+}
+
+func hasContainer(d *appsv1.Deployment, name string) bool {
+	for _, c := range d.Spec.Template.Spec.Containers {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+// Package anchor provides the per-run object that everything the framework
+// creates in the cluster is owned by, so that deleting it garbage-collects
+// whatever a run left behind, even when the run itself could not clean up:
+//
+//	kubectl delete namespace kube-agents-test-run-<run-id>
+//
+// Owner references cannot cross namespaces, so the anchor is a Namespace,
+// which as a cluster-scoped owner may own objects in any namespace as well
+// as cluster-scoped ones. Only objects the framework creates are owned,
+// by the anchor of the run that created them; pre-existing objects it
+// updates are not.
+package anchor
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// Prefix starts the name of every anchor; the run ID follows it.
+	Prefix = "kube-agents-test-run-"
+	// LabelRunID carries the run ID on the anchor, as on agent
+	// namespaces.
+	LabelRunID = "kube-agents-test/run-id"
+)
+
+// Anchor creates and references the anchor of the current run. The anchor
+// is created on first use, so runs that create nothing leave no anchor. A
+// nil *Anchor owns nothing.
+type Anchor struct {
+	client kubernetes.Interface
+
+	mu    sync.Mutex
+	runID string
+	ref   *metav1.OwnerReference
+}
+
+// New returns an Anchor that creates anchors through client.
+func New(client kubernetes.Interface) *Anchor {
+	return &Anchor{client: client}
+}
+
+// SetRunID sets the run whose anchor owns objects from now on.
+func (a *Anchor) SetRunID(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if id != a.runID {
+		a.runID = id
+		a.ref = nil
+	}
+}
+
+// Own adds an owner reference to the current run's anchor to obj, creating
+// the anchor if need be. It does nothing on a nil Anchor or before
+// SetRunID.
+func (a *Anchor) Own(ctx context.Context, obj metav1.Object) error {
+	if a == nil {
+		return nil
+	}
+	ref, err := a.ownerReference(ctx)
+	if err != nil || ref == nil {
+		return err
+	}
+	obj.SetOwnerReferences(append(obj.GetOwnerReferences(), *ref))
+	return nil
+}
+
+// OwnUpdate sets the owner references of obj, about to replace existing,
+// to those of existing, adding the current run's anchor only if an anchor
+// already owns existing, that is, a run created it. Pre-existing objects
+// keep their owners and are not collected with the run.
+func (a *Anchor) OwnUpdate(ctx context.Context, obj, existing metav1.Object) error {
+	refs := slices.Clone(existing.GetOwnerReferences())
+	obj.SetOwnerReferences(refs)
+	if a == nil || !slices.ContainsFunc(refs, isAnchor) {
+		return nil
+	}
+	ref, err := a.ownerReference(ctx)
+	if err != nil || ref == nil {
+		return err
+	}
+	if !slices.ContainsFunc(refs, func(r metav1.OwnerReference) bool { return r.UID == ref.UID }) {
+		obj.SetOwnerReferences(append(refs, *ref))
+	}
+	return nil
+}
+
+// isAnchor reports whether ref refers to a run anchor.
+func isAnchor(ref metav1.OwnerReference) bool {
+	return ref.APIVersion == "v1" && ref.Kind == "Namespace" && strings.HasPrefix(ref.Name, Prefix)
+}
+
+func (a *Anchor) ownerReference(ctx context.Context) (*metav1.OwnerReference, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.runID == "" || a.ref != nil {
+		return a.ref, nil
+	}
+	name := Prefix + a.runID
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   name,
+		Labels: map[string]string{LabelRunID: a.runID},
+	}}
+	created, err := a.client.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		created, err = a.client.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating run anchor %s: %w", name, err)
+	}
+	a.ref = &metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "Namespace",
+		Name:       created.Name,
+		UID:        created.UID,
+	}
+	return a.ref, nil
+}
@@ -0,0 +1,73 @@
+package anchor
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestOwnUpdate(t *testing.T) {
+	deployment := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "app", UID: "d"}
+	earlier := metav1.OwnerReference{APIVersion: "v1", Kind: "Namespace", Name: Prefix + "earlier", UID: "earlier"}
+	tests := []struct {
+		name     string
+		existing []metav1.OwnerReference
+		// wantCurrent is whether the current run's anchor is added.
+		wantCurrent bool
+	}{
+		{name: "pre-existing object without owners"},
+		{name: "pre-existing object keeps its owners", existing: []metav1.OwnerReference{deployment}},
+		{name: "object an earlier run created", existing: []metav1.OwnerReference{earlier}, wantCurrent: true},
+		{name: "object with an anchor among its owners", existing: []metav1.OwnerReference{deployment, earlier}, wantCurrent: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New(fake.NewSimpleClientset())
+			a.SetRunID("current")
+			ctx := context.Background()
+			current, err := a.ownerReference(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			existing := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{OwnerReferences: tt.existing}}
+			// The update carries an anchor reference of its own, which
+			// must not survive on pre-existing objects.
+			obj := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{*current}}}
+			if err := a.OwnUpdate(ctx, obj, existing); err != nil {
+				t.Fatal(err)
+			}
+			want := slices.Clone(tt.existing)
+			if tt.wantCurrent {
+				want = append(want, *current)
+			}
+			if got := obj.GetOwnerReferences(); !reflect.DeepEqual(got, want) {
+				t.Errorf("owner references = %v, want %v", got, want)
+			}
+			// Updating again must not add the anchor twice.
+			if err := a.OwnUpdate(ctx, existing, obj); err != nil {
+				t.Fatal(err)
+			}
+			if got := existing.GetOwnerReferences(); !reflect.DeepEqual(got, want) {
+				t.Errorf("owner references after a second update = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestOwnUpdateNil(t *testing.T) {
+	var a *Anchor
+	earlier := metav1.OwnerReference{APIVersion: "v1", Kind: "Namespace", Name: Prefix + "earlier", UID: "earlier"}
+	existing := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{earlier}}}
+	obj := &corev1.ConfigMap{}
+	if err := a.OwnUpdate(context.Background(), obj, existing); err != nil {
+		t.Fatal(err)
+	}
+	if got := obj.GetOwnerReferences(); !reflect.DeepEqual(got, existing.OwnerReferences) {
+		t.Errorf("owner references = %v, want %v", got, existing.OwnerReferences)
+	}
+}
@@ -0,0 +1,298 @@
+package apiproxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+const (
+	// Name is shared by the proxy's Deployment, Service, ServiceAccount,
+	// and the ConfigMap holding its policy and the agents' kubeconfigs.
+	Name = "kube-agents-test-apiproxy"
+	// Port is where the proxy listens, without TLS.
+	Port = 8080
+
+	// FaultsKey holds the policy as a JSON list of scenario.APIFault.
+	FaultsKey = "faults.json"
+	// EpochKey changes with every Configure call, so the proxy restarts
+	// fault counting and call recording even when consecutive scenarios
+	// share a policy.
+	EpochKey = "epoch"
+
+	// MountPath is where agents get the ConfigMap mounted.
+	MountPath = "/etc/kube-agents-test/apiproxy"
+
+	// NamespaceEnv tells the proxy which namespace its ConfigMap is in.
+	NamespaceEnv = "POD_NAMESPACE"
+
+	followInterval = time.Second
+)
+
+// KubeconfigKey is the ConfigMap key of agent's kubeconfig.
+func KubeconfigKey(agent string) string {
+	return "kubeconfig-" + agent
+}
+
+// KubeconfigPath is the value of KUBECONFIG given to a proxied agent.
+func KubeconfigPath(agent string) string {
+	return MountPath + "/" + KubeconfigKey(agent)
+}
+
+// Kubeconfig returns a kubeconfig for agent's pods in namespace that sends
+// their service account token to the proxy, under the agent's prefix.
+func Kubeconfig(namespace, agent string) string {
+	return fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: apiproxy
+  cluster:
+    server: http://%s.%s.svc:%d%s%s
+users:
+- name: serviceaccount
+  user:
+    tokenFile: /var/run/secrets/kubernetes.io/serviceaccount/token
+contexts:
+- name: apiproxy
+  context:
+    cluster: apiproxy
+    user: serviceaccount
+    namespace: %s
+current-context: apiproxy
+`, Name, namespace, Port, agentPrefix, agent, namespace)
+}
+
+// Deploy creates the proxy in namespace, running image, or updates it.
+// The proxy may only read its own ConfigMap.
+func Deploy(ctx context.Context, client kubernetes.Interface, namespace, image string) error {
+	labels := map[string]string{"app.kubernetes.io/name": Name}
+	meta := metav1.ObjectMeta{Name: Name, Namespace: namespace, Labels: labels}
+
+	sa := &corev1.ServiceAccount{ObjectMeta: meta}
+	if _, err := client.CoreV1().ServiceAccounts(namespace).Create(ctx, sa, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("creating API proxy service account: %w", err)
+	}
+	role := &rbacv1.Role{
+		ObjectMeta: meta,
+		Rules: []rbacv1.PolicyRule{{
+			APIGroups:     []string{""},
+			Resources:     []string{"configmaps"},
+			ResourceNames: []string{Name},
+			Verbs:         []string{"get"},
+		}},
+	}
+	if _, err := client.RbacV1().Roles(namespace).Create(ctx, role, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("creating API proxy role: %w", err)
+	}
+	binding := &rbacv1.RoleBinding{
+		ObjectMeta: meta,
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: Name},
+		Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: Name, Namespace: namespace}},
+	}
+	if _, err := client.RbacV1().RoleBindings(namespace).Create(ctx, binding, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("creating API proxy role binding: %w", err)
+	}
+	svc := &corev1.Service{
+		ObjectMeta: meta,
+		Spec: corev1.ServiceSpec{
+			Selector: labels,
+			Ports:    []corev1.ServicePort{{Name: "http", Port: Port, TargetPort: intstr.FromInt32(Port)}},
+		},
+	}
+	if _, err := client.CoreV1().Services(namespace).Create(ctx, svc, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("creating API proxy service: %w", err)
+	}
+
+	replicas := int32(1)
+	desired := &appsv1.Deployment{
+		ObjectMeta: meta,
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: Name,
+					Containers: []corev1.Container{{
+						Name:  "apiproxy",
+						Image: image,
+						Args:  []string{fmt.Sprintf("--listen=:%d", Port)},
+						Env: []corev1.EnvVar{{
+							Name:      NamespaceEnv,
+							ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"}},
+						}},
+						Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: Port}},
+						ReadinessProbe: &corev1.Probe{
+							ProbeHandler: corev1.ProbeHandler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt32(Port)}},
+						},
+					}},
+				},
+			},
+		},
+	}
+	deployments := client.AppsV1().Deployments(namespace)
+	_, err := deployments.Create(ctx, desired, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		existing, getErr := deployments.Get(ctx, Name, metav1.GetOptions{})
+		if getErr != nil {
+			return fmt.Errorf("getting API proxy: %w", getErr)
+		}
+		desired.ResourceVersion = existing.ResourceVersion
+		_, err = deployments.Update(ctx, desired, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("deploying API proxy: %w", err)
+	}
+	return nil
+}
+
+// WaitReady polls until the proxy has a ready replica.
+func WaitReady(ctx context.Context, client kubernetes.Interface, namespace string) error {
+	err := wait.PollUntilContextCancel(ctx, time.Second, true, func(ctx context.Context) (bool, error) {
+		d, err := client.AppsV1().Deployments(namespace).Get(ctx, Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return d.Status.ObservedGeneration >= d.Generation && d.Status.ReadyReplicas > 0, nil
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for API proxy: %w", err)
+	}
+	return nil
+}
+
+// Configure publishes a new policy for the proxy, together with the
+// kubeconfigs agents use to reach it, and returns its epoch. The proxy
+// picks it up within a second; WaitEpoch waits for that.
+func Configure(ctx context.Context, client kubernetes.Interface, namespace string, agents []string, faults []scenario.APIFault) (string, error) {
+	data, err := json.Marshal(faults)
+	if err != nil {
+		return "", err
+	}
+	epoch := time.Now().UTC().Format(time.RFC3339Nano)
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: Name, Namespace: namespace},
+		Data: map[string]string{
+			FaultsKey: string(data),
+			EpochKey:  epoch,
+		},
+	}
+	for _, a := range agents {
+		cm.Data[KubeconfigKey(a)] = Kubeconfig(namespace, a)
+	}
+	maps := client.CoreV1().ConfigMaps(namespace)
+	_, err = maps.Create(ctx, cm, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = maps.Update(ctx, cm, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return "", fmt.Errorf("configuring API proxy: %w", err)
+	}
+	return epoch, nil
+}
+
+// PublishKubeconfig copies agent's kubeconfig into a ConfigMap named Name
+// in agentNamespace, for agents that do not run in the proxy's namespace
+// and so cannot mount its ConfigMap.
+func PublishKubeconfig(ctx context.Context, client kubernetes.Interface, namespace, agentNamespace, agent string) error {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: Name, Namespace: agentNamespace},
+		Data:       map[string]string{KubeconfigKey(agent): Kubeconfig(namespace, agent)},
+	}
+	maps := client.CoreV1().ConfigMaps(agentNamespace)
+	_, err := maps.Create(ctx, cm, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = maps.Update(ctx, cm, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("publishing API proxy kubeconfig of agent %s: %w", agent, err)
+	}
+	return nil
+}
+
+// GetStatus reads the proxy's Status through the API server's service
+// proxy.
+func GetStatus(ctx context.Context, client kubernetes.Interface, namespace string) (*Status, error) {
+	data, err := client.CoreV1().Services(namespace).
+		ProxyGet("http", Name, strconv.Itoa(Port), StatusPath, nil).DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading API proxy status: %w", err)
+	}
+	var st Status
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("decoding API proxy status: %w", err)
+	}
+	return &st, nil
+}
+
+// WaitEpoch polls until the proxy serves the policy of epoch, so calls
+// recorded from then on belong to it.
+func WaitEpoch(ctx context.Context, client kubernetes.Interface, namespace, epoch string) error {
+	err := wait.PollUntilContextCancel(ctx, followInterval/2, true, func(ctx context.Context) (bool, error) {
+		st, err := GetStatus(ctx, client, namespace)
+		// The Service may not route to the new pod yet.
+		return err == nil && st.Epoch == epoch, nil
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for API proxy policy: %w", err)
+	}
+	return nil
+}
+
+// Follow keeps h's policy in line with the ConfigMap in namespace until ctx
+// is done. A missing ConfigMap means no faults; read errors keep the
+// current policy.
+func Follow(ctx context.Context, client kubernetes.Interface, namespace string, h *Handler, log *slog.Logger) {
+	var epoch string
+	sync := func() {
+		cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			cm, err = &corev1.ConfigMap{}, nil
+		}
+		if err != nil {
+			log.Warn("reading API faults", "error", err)
+			return
+		}
+		if cm.Data[EpochKey] == epoch {
+			return
+		}
+		var faults []scenario.APIFault
+		if data := cm.Data[FaultsKey]; data != "" {
+			if err := json.Unmarshal([]byte(data), &faults); err != nil {
+				log.Warn("decoding API faults", "error", err)
+				return
+			}
+		}
+		epoch = cm.Data[EpochKey]
+		h.SetPolicy(epoch, faults)
+		log.Info("API faults updated", "faults", len(faults), "epoch", epoch)
+	}
+	sync()
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sync()
+		}
+	}
+}
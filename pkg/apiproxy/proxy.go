@@ -0,0 +1,329 @@
+// Package apiproxy is a reverse proxy between agents and the API server that
+// injects the faults a scenario declares: latency, error responses such as
+// 429, and dropped watches. It runs in the cluster (see cmd/
+// kube-agents-test-apiproxy); the engine deploys it, publishes each
+// scenario's faults in a ConfigMap it follows, and points agents at it
+// through a mounted kubeconfig.
+//
+// The proxy forwards the agents' own credentials, so agents keep their
+// identity and RBAC. Faults are counted per rule, so "every 3rd list of
+// pods" fails the same requests on every run. Each agent reaches the proxy
+// under its own path prefix, /agents/<name>/, which lets the proxy record
+// the API calls every agent made; the engine reads them from StatusPath.
+package apiproxy
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+const (
+	// StatusPath serves the proxy's Status as JSON.
+	StatusPath = "/kube-agents-test/status"
+
+	// injectedMessage is the message of injected error responses.
+	injectedMessage = "injected by kube-agents-test"
+	// agentPrefix starts the path prefix naming the calling agent.
+	agentPrefix = "/agents/"
+)
+
+// Status is the proxy's record of the calls made since the policy of
+// Epoch was set.
+type Status struct {
+	Epoch string `json:"epoch"`
+	Calls []Call `json:"calls"`
+}
+
+// Call counts the API requests an agent made with one verb on one
+// resource. Non-resource requests, such as discovery, are not recorded.
+type Call struct {
+	Agent       string `json:"agent"`
+	Verb        string `json:"verb"`
+	Group       string `json:"group,omitempty"`
+	Resource    string `json:"resource"`
+	Subresource string `json:"subresource,omitempty"`
+	Count       int    `json:"count"`
+}
+
+// String formats c like an RBAC rule: verb resource[.group][/subresource].
+func (c Call) String() string {
+	r := c.Resource
+	if c.Group != "" {
+		r += "." + c.Group
+	}
+	if c.Subresource != "" {
+		r += "/" + c.Subresource
+	}
+	return c.Verb + " " + r
+}
+
+// Handler forwards requests to the API server, injecting the faults of the
+// current policy.
+type Handler struct {
+	proxy *httputil.ReverseProxy
+	log   *slog.Logger
+
+	mu     sync.Mutex
+	epoch  string
+	faults []scenario.APIFault
+	// counts holds the number of requests each fault has matched.
+	counts []int
+	calls  map[Call]int
+}
+
+// NewHandler returns a Handler forwarding to upstream through transport,
+// which must not add credentials of its own.
+func NewHandler(upstream *url.URL, transport http.RoundTripper, log *slog.Logger) *Handler {
+	h := &Handler{log: log, calls: map[Call]int{}}
+	h.proxy = &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(upstream)
+			r.Out.Host = upstream.Host
+		},
+		Transport: transport,
+		// Stream watch events as they arrive.
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if r.Context().Err() == nil {
+				log.Warn("forwarding request", "path", r.URL.Path, "error", err)
+				w.WriteHeader(http.StatusBadGateway)
+			}
+		},
+	}
+	return h
+}
+
+// SetPolicy replaces the faults and restarts fault counting and call
+// recording.
+func (h *Handler) SetPolicy(epoch string, faults []scenario.APIFault) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.epoch = epoch
+	h.faults = faults
+	h.counts = make([]int, len(faults))
+	h.calls = map[Call]int{}
+}
+
+// Status returns the calls recorded under the current policy, sorted.
+func (h *Handler) Status() Status {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	st := Status{Epoch: h.epoch, Calls: make([]Call, 0, len(h.calls))}
+	for c, n := range h.calls {
+		c.Count = n
+		st.Calls = append(st.Calls, c)
+	}
+	sort.Slice(st.Calls, func(i, j int) bool {
+		a, b := st.Calls[i], st.Calls[j]
+		if a.Agent != b.Agent {
+			return a.Agent < b.Agent
+		}
+		return a.String() < b.String()
+	})
+	return st
+}
+
+// ServeHTTP records r, applies the faults matching it, in policy order,
+// then forwards it unless one of them failed it.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == StatusPath {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(h.Status())
+		return
+	}
+	agent := stripAgent(r)
+	info := parseRequest(r)
+	latency, fail, drop := h.match(agent, info)
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if fail != 0 {
+		h.log.Info("injecting error", "verb", info.verb, "resource", info.resource, "status", fail)
+		writeStatus(w, info, fail)
+		return
+	}
+	if drop > 0 {
+		// Cancelling the request ends the response mid-stream, which the
+		// client sees as a dropped connection.
+		ctx, cancel := context.WithTimeout(r.Context(), drop)
+		defer cancel()
+		r = r.WithContext(ctx)
+		h.log.Info("dropping watch", "resource", info.resource, "after", drop)
+	}
+	h.proxy.ServeHTTP(w, r)
+}
+
+// match counts info against the policy and returns the total latency to
+// add, the status to fail with (0 to forward), and when to drop a watch (0
+// never). The shortest matching drop wins.
+func (h *Handler) match(agent string, info requestInfo) (latency time.Duration, fail int, drop time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if info.resource != "" {
+		h.calls[Call{Agent: agent, Verb: info.verb, Group: info.group, Resource: info.resource, Subresource: info.subresource}]++
+	}
+	for i := range h.faults {
+		f := &h.faults[i]
+		if !info.matches(f) {
+			continue
+		}
+		h.counts[i]++
+		if f.Latency != nil {
+			latency += f.Latency.Duration
+		}
+		if fail == 0 && f.Every > 0 && h.counts[i]%f.Every == 0 {
+			fail = f.StatusOrDefault()
+		}
+		if f.DropWatchAfter != nil && info.verb == "watch" && (drop == 0 || f.DropWatchAfter.Duration < drop) {
+			drop = f.DropWatchAfter.Duration
+		}
+	}
+	return latency, fail, drop
+}
+
+// writeStatus answers with a Kubernetes Status error of the given code,
+// shaped like the API server's own so clients handle it natively,
+// including Retry-After on 429s.
+func writeStatus(w http.ResponseWriter, info requestInfo, code int) {
+	retryAfter := 0
+	if code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable {
+		retryAfter = 1
+		w.Header().Set("Retry-After", "1")
+	}
+	status := apierrors.NewGenericServerResponse(code, info.verb,
+		schema.GroupResource{Group: info.group, Resource: info.resource}, info.name, injectedMessage, retryAfter, true).ErrStatus
+	status.Kind = "Status"
+	status.APIVersion = "v1"
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+// stripAgent removes the agent prefix from r's path and returns the agent
+// it names, or "" for requests without one.
+func stripAgent(r *http.Request) string {
+	rest, ok := strings.CutPrefix(r.URL.Path, agentPrefix)
+	if !ok {
+		return ""
+	}
+	agent, path, _ := strings.Cut(rest, "/")
+	r.URL.Path = "/" + path
+	r.URL.RawPath = ""
+	return agent
+}
+
+// requestInfo is what faults select requests by. Non-resource requests have
+// an empty resource.
+type requestInfo struct {
+	verb        string
+	group       string
+	resource    string
+	subresource string
+	name        string
+}
+
+func (info requestInfo) matches(f *scenario.APIFault) bool {
+	if len(f.Verbs) > 0 && !slices.Contains(f.Verbs, info.verb) {
+		return false
+	}
+	if len(f.Resources) == 0 {
+		return true
+	}
+	if info.resource == "" {
+		return false
+	}
+	qualified := info.resource
+	if info.group != "" {
+		qualified += "." + info.group
+	}
+	for _, r := range f.Resources {
+		if r == info.resource || r == qualified {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRequest derives the verb and resource of an API request from its
+// method and path, following the API server's URL layout:
+//
+//	/api/v1/[watch/][namespaces/<ns>/]<resource>[/<name>[/<subresource>]]
+//	/apis/<group>/<version>/...
+func parseRequest(r *http.Request) requestInfo {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var info requestInfo
+	switch {
+	case len(parts) >= 3 && parts[0] == "api":
+		parts = parts[2:]
+	case len(parts) >= 4 && parts[0] == "apis":
+		info.group = parts[1]
+		parts = parts[3:]
+	default:
+		info.verb = strings.ToLower(r.Method)
+		return info
+	}
+	watch := false
+	if parts[0] == "watch" {
+		watch = true
+		parts = parts[1:]
+	}
+	// namespaces/<ns>/status is a subresource of the namespace, not a
+	// resource inside it.
+	if len(parts) >= 3 && parts[0] == "namespaces" && parts[2] != "status" && parts[2] != "finalize" {
+		parts = parts[2:]
+	}
+	if len(parts) > 0 {
+		info.resource = parts[0]
+	}
+	if len(parts) > 1 {
+		info.name = parts[1]
+	}
+	if len(parts) > 2 {
+		info.subresource = parts[2]
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		q := r.URL.Query().Get("watch")
+		switch {
+		case watch || q == "true" || q == "1":
+			info.verb = "watch"
+		case info.name == "":
+			info.verb = "list"
+		default:
+			info.verb = "get"
+		}
+	case http.MethodPost:
+		info.verb = "create"
+	case http.MethodPut:
+		info.verb = "update"
+	case http.MethodPatch:
+		info.verb = "patch"
+	case http.MethodDelete:
+		info.verb = "delete"
+		if info.name == "" {
+			info.verb = "deletecollection"
+		}
+	default:
+		info.verb = strings.ToLower(r.Method)
+	}
+	return info
+}
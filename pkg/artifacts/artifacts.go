@@ -0,0 +1,188 @@
+// Package artifacts lays out run outputs on disk as
+// <root>/<run-id>/<scenario>/..., with an index.json per run describing
+// every scenario directory and the files in it.
+package artifacts
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/fingerprint"
+)
+
+// IndexFile is the name of the per-run index.
+const IndexFile = "index.json"
+
+// Outcomes recorded in the index.
+const (
+	Passed  = "passed"
+	Failed  = "failed"
+	Skipped = "skipped"
+)
+
+// Index is the machine-readable description of a run's artifacts.
+type Index struct {
+	RunID string `json:"runId"`
+	// Fingerprint is the environment the run executed in.
+	Fingerprint *fingerprint.Fingerprint `json:"fingerprint,omitempty"`
+	Scenarios   []Entry                  `json:"scenarios"`
+}
+
+// Entry describes one scenario's artifact directory. Dir and Files are
+// relative to the run directory.
+type Entry struct {
+	Name    string   `json:"name"`
+	Dir     string   `json:"dir"`
+	Outcome string   `json:"outcome,omitempty"`
+	Files   []string `json:"files"`
+}
+
+// Run is the artifact directory of one run.
+type Run struct {
+	dir         string
+	runID       string
+	fingerprint *fingerprint.Fingerprint
+
+	mu      sync.Mutex
+	entries map[string]*Entry
+	order   []string
+	dirs    map[string]bool
+}
+
+// NewRun creates <root>/<runID>.
+func NewRun(root, runID string) (*Run, error) {
+	dir := filepath.Join(root, runID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating artifact directory: %w", err)
+	}
+	return &Run{
+		dir:     dir,
+		runID:   runID,
+		entries: map[string]*Entry{},
+		dirs:    map[string]bool{},
+	}, nil
+}
+
+// Dir returns the run directory.
+func (r *Run) Dir() string {
+	return r.dir
+}
+
+// ScenarioDir returns the directory for scenario, creating it on first use.
+func (r *Run) ScenarioDir(scenario string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := r.entry(scenario)
+	path := filepath.Join(r.dir, e.Dir)
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return "", fmt.Errorf("creating artifact directory for %s: %w", scenario, err)
+	}
+	return path, nil
+}
+
+// WriteFile writes data to name (which may contain slashes) inside the
+// scenario's directory and records it in the index.
+func (r *Run) WriteFile(scenario, name string, data []byte) (string, error) {
+	dir, err := r.ScenarioDir(scenario)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", fmt.Errorf("writing artifact %s: %w", name, err)
+	}
+	r.AddFile(scenario, name)
+	return path, nil
+}
+
+// AddFile records a file that was written into the scenario's directory by
+// other means, such as a streaming writer.
+func (r *Run) AddFile(scenario, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := r.entry(scenario)
+	for _, f := range e.Files {
+		if f == name {
+			return
+		}
+	}
+	e.Files = append(e.Files, name)
+}
+
+// SetOutcome records the scenario outcome in the index.
+func (r *Run) SetOutcome(scenario, outcome string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entry(scenario).Outcome = outcome
+}
+
+// SetFingerprint records the environment of the run in the index.
+func (r *Run) SetFingerprint(f *fingerprint.Fingerprint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fingerprint = f
+}
+
+// WriteIndex writes index.json into the run directory.
+func (r *Run) WriteIndex() error {
+	r.mu.Lock()
+	idx := Index{RunID: r.runID, Fingerprint: r.fingerprint, Scenarios: make([]Entry, 0, len(r.order))}
+	for _, name := range r.order {
+		e := *r.entries[name]
+		e.Files = append([]string(nil), e.Files...)
+		sort.Strings(e.Files)
+		idx.Scenarios = append(idx.Scenarios, e)
+	}
+	r.mu.Unlock()
+
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(r.dir, IndexFile), append(data, '\n'), 0o644)
+}
+
+// entry returns the index entry for scenario, allocating its directory
+// name. Callers hold r.mu.
+func (r *Run) entry(scenario string) *Entry {
+	if e, ok := r.entries[scenario]; ok {
+		return e
+	}
+	base := Slug(scenario)
+	dir := base
+	for i := 2; r.dirs[dir]; i++ {
+		dir = fmt.Sprintf("%s-%d", base, i)
+	}
+	r.dirs[dir] = true
+	e := &Entry{Name: scenario, Dir: dir, Files: []string{}}
+	r.entries[scenario] = e
+	r.order = append(r.order, scenario)
+	return e
+}
+
+// Slug turns a scenario name into a stable directory name: lower case, with
+// anything but letters, digits, '.', '_' and '-' replaced by '-'.
+func Slug(name string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(name) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '.', c == '_', c == '-':
+			b.WriteRune(c)
+		default:
+			b.WriteByte('-')
+		}
+	}
+	s := strings.Trim(b.String(), "-.")
+	if s == "" {
+		return "scenario"
+	}
+	return s
+}
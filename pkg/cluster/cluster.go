@@ -0,0 +1,58 @@
+// Package cluster provides the clusters scenarios run against. The framework
+// does not own the cluster implementation; all it needs is a kubeconfig.
+package cluster
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Provider provisions and tears down a cluster.
+type Provider interface {
+	// Create makes the cluster available. Providers may reuse an existing
+	// cluster instead of creating a new one.
+	Create(ctx context.Context) error
+	// Kubeconfig returns the path of a kubeconfig for the cluster. Only
+	// valid after Create.
+	Kubeconfig() string
+	// Delete tears the cluster down. Providers that did not create the
+	// cluster leave it alone.
+	Delete(ctx context.Context) error
+}
+
+// Existing is a cluster the framework does not manage, reached through a
+// kubeconfig. An empty path uses the standard loading rules ($KUBECONFIG,
+// ~/.kube/config).
+type Existing struct {
+	Path    string
+	Context string
+}
+
+var _ Provider = (*Existing)(nil)
+
+// Create is a no-op.
+func (e *Existing) Create(context.Context) error { return nil }
+
+// Kubeconfig returns the configured path.
+func (e *Existing) Kubeconfig() string { return e.Path }
+
+// Delete is a no-op; existing clusters are never torn down.
+func (e *Existing) Delete(context.Context) error { return nil }
+
+// RESTConfig loads the client configuration for a kubeconfig path and
+// optional context name.
+func RESTConfig(kubeconfig, contextName string) (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfig != "" {
+		rules.ExplicitPath = kubeconfig
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: contextName}
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loading kubeconfig: %w", err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,101 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultKindName is the kind cluster name used when none is configured.
+const DefaultKindName = "kube-agents-test"
+
+// Kind provisions a local cluster with the kind CLI.
+type Kind struct {
+	// Name of the kind cluster.
+	Name string
+	// NodeImage selects the Kubernetes version, e.g. kindest/node:v1.31.0.
+	NodeImage string
+	// Config is an optional kind cluster config file.
+	Config string
+
+	kubeconfig string
+	reused     bool
+}
+
+var _ Provider = (*Kind)(nil)
+
+// Create creates the kind cluster, or reuses it if a cluster with the same
+// name already exists.
+func (k *Kind) Create(ctx context.Context) error {
+	name := k.name()
+	existing, err := kind(ctx, "get", "clusters")
+	if err != nil {
+		return err
+	}
+	k.reused = false
+	for _, c := range strings.Fields(existing) {
+		if c == name {
+			k.reused = true
+		}
+	}
+	if !k.reused {
+		args := []string{"create", "cluster", "--name", name, "--wait", "120s"}
+		if k.NodeImage != "" {
+			args = append(args, "--image", k.NodeImage)
+		}
+		if k.Config != "" {
+			args = append(args, "--config", k.Config)
+		}
+		if _, err := kind(ctx, args...); err != nil {
+			return err
+		}
+	}
+
+	cfg, err := kind(ctx, "get", "kubeconfig", "--name", name)
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "kube-agents-test-")
+	if err != nil {
+		return err
+	}
+	k.kubeconfig = filepath.Join(dir, "kubeconfig")
+	return os.WriteFile(k.kubeconfig, []byte(cfg), 0o600)
+}
+
+// Reused reports whether Create found an existing cluster.
+func (k *Kind) Reused() bool { return k.reused }
+
+// Kubeconfig returns the path of the kubeconfig written by Create.
+func (k *Kind) Kubeconfig() string { return k.kubeconfig }
+
+// Delete deletes the kind cluster.
+func (k *Kind) Delete(ctx context.Context) error {
+	if k.kubeconfig != "" {
+		os.RemoveAll(filepath.Dir(k.kubeconfig))
+	}
+	_, err := kind(ctx, "delete", "cluster", "--name", k.name())
+	return err
+}
+
+func (k *Kind) name() string {
+	if k.Name == "" {
+		return DefaultKindName
+	}
+	return k.Name
+}
+
+func kind(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "kind", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("kind %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,141 @@
+package convert
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+const chainsawTestFile = "chainsaw-test.yaml"
+
+// Chainsaw converts the chainsaw test declared by dir/chainsaw-test.yaml.
+// apply and create operations become setup, assert operations become
+// expectations, and other operations are reported as warnings.
+func Chainsaw(dir string) (*Converted, error) {
+	objs, err := scenario.ReadObjects(filepath.Join(dir, chainsawTestFile))
+	if err != nil {
+		return nil, err
+	}
+	var test map[string]any
+	for _, obj := range objs {
+		if obj["kind"] == "Test" {
+			test = obj
+			break
+		}
+	}
+	if test == nil {
+		return nil, fmt.Errorf("%s: no Test found", filepath.Join(dir, chainsawTestFile))
+	}
+
+	name := filepath.Base(dir)
+	if meta, ok := test["metadata"].(map[string]any); ok && meta["name"] != nil {
+		name = fmt.Sprint(meta["name"])
+	}
+	b := newBuilder(name)
+	spec, _ := test["spec"].(map[string]any)
+	if timeouts, ok := spec["timeouts"].(map[string]any); ok {
+		if s, ok := timeouts["assert"].(string); ok {
+			if d, err := time.ParseDuration(s); err == nil {
+				b.c.Scenario.Timeout = &metav1.Duration{Duration: d}
+			}
+		}
+	}
+
+	steps, _ := spec["steps"].([]any)
+	for i, s := range steps {
+		step, _ := s.(map[string]any)
+		label := fmt.Sprintf("step %d", i)
+		if n, ok := step["name"].(string); ok {
+			label = fmt.Sprintf("step %q", n)
+		}
+		for _, block := range []string{"catch", "finally", "cleanup"} {
+			if _, ok := step[block]; ok {
+				b.warn("%s: %s is not supported", label, block)
+			}
+		}
+		ops, _ := step["try"].([]any)
+		for _, o := range ops {
+			op, _ := o.(map[string]any)
+			for _, kind := range sortedKeys(op) {
+				if err := b.chainsawOp(dir, label, kind, op[kind]); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return b.finish()
+}
+
+// chainsawOp converts a single operation of a step's try block.
+func (b *builder) chainsawOp(dir, label, kind string, body any) error {
+	switch kind {
+	case "apply", "create", "assert":
+	case "description":
+		return nil
+	default:
+		b.warn("%s: %s is not supported", label, kind)
+		return nil
+	}
+	op, _ := body.(map[string]any)
+	var objs []map[string]any
+	source := kind
+	if res, ok := op["resource"].(map[string]any); ok {
+		objs = append(objs, res)
+	}
+	if file, ok := op["file"].(string); ok {
+		source = file
+		matches, err := filepath.Glob(filepath.Join(dir, file))
+		if err != nil {
+			return err
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			fileObjs, err := scenario.ReadObjects(m)
+			if err != nil {
+				return err
+			}
+			objs = append(objs, fileObjs...)
+		}
+	}
+	if kind != "assert" {
+		b.apply(source, objs)
+		return nil
+	}
+	for _, obj := range objs {
+		if stripExpressions(obj) {
+			b.warn("%s: assertion expressions in %s were dropped", label, source)
+		}
+	}
+	b.assertStep(source, objs)
+	return nil
+}
+
+// stripExpressions removes chainsaw's parenthesised expression keys, such
+// as (length(items)): 2, and reports whether it removed any.
+func stripExpressions(m map[string]any) bool {
+	stripped := false
+	for k, v := range m {
+		if strings.HasPrefix(k, "(") {
+			delete(m, k)
+			stripped = true
+			continue
+		}
+		switch v := v.(type) {
+		case map[string]any:
+			stripped = stripExpressions(v) || stripped
+		case []any:
+			for _, item := range v {
+				if im, ok := item.(map[string]any); ok {
+					stripped = stripExpressions(im) || stripped
+				}
+			}
+		}
+	}
+	return stripped
+}
@@ -0,0 +1,284 @@
+// Package convert imports test suites written for other Kubernetes testing
+// tools (kuttl, chainsaw) as scenarios. Applied manifests become setup
+// manifests and asserted objects become expectations, those of each assert
+// step after the first a step of their own; constructs without an
+// equivalent are reported as warnings rather than silently dropped.
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/artifacts"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// Converted is one imported test.
+type Converted struct {
+	Scenario *scenario.Scenario
+	// Manifests holds the objects of each setup manifest, keyed by the path
+	// Scenario.Setup references, relative to where the scenario is written.
+	Manifests map[string][]map[string]any
+	// Warnings lists parts of the source test that were not converted.
+	Warnings []string
+}
+
+// Dir converts the test in dir, detecting whether it is a chainsaw test
+// (it has a chainsaw-test.yaml) or a kuttl test.
+func Dir(dir string) (*Converted, error) {
+	if _, err := os.Stat(filepath.Join(dir, chainsawTestFile)); err == nil {
+		return Chainsaw(dir)
+	}
+	return Kuttl(dir)
+}
+
+// Suite converts every test under dir: dir itself when it is a test, or
+// each subdirectory that is one, as with kuttl and chainsaw suite roots.
+func Suite(dir string) ([]*Converted, error) {
+	if isTest(dir) {
+		c, err := Dir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", dir, err)
+		}
+		return []*Converted{c}, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var all []*Converted
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		sub, err := Suite(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, sub...)
+	}
+	return all, nil
+}
+
+// isTest reports whether dir holds a chainsaw test or kuttl step files.
+func isTest(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, chainsawTestFile)); err == nil {
+		return true
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if !e.IsDir() && kuttlStepFile.MatchString(e.Name()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Write stores the scenario as <outDir>/<name>.yaml and its manifests under
+// <outDir>/fixtures/<name>/, and returns the scenario file's path.
+func (c *Converted) Write(outDir string) (string, error) {
+	for rel, objs := range c.Manifests {
+		var buf bytes.Buffer
+		for i, obj := range objs {
+			if i > 0 {
+				buf.WriteString("---\n")
+			}
+			data, err := yaml.Marshal(obj)
+			if err != nil {
+				return "", err
+			}
+			buf.Write(data)
+		}
+		path := filepath.Join(outDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			return "", err
+		}
+	}
+	data, err := yaml.Marshal(c.Scenario)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(outDir, artifacts.Slug(c.Scenario.Name)+".yaml")
+	return path, os.WriteFile(path, data, 0o644)
+}
+
+// builder accumulates a Converted while walking a source test.
+type builder struct {
+	c *Converted
+	// asserts holds the expectations of each step that asserted anything,
+	// in order; the first become the scenario's, the rest its steps.
+	asserts []assertion
+	// applyAfterAssert is set when a manifest is applied after a step
+	// asserted state, an ordering scenarios cannot express.
+	applyAfterAssert bool
+	unnamespaced     bool
+}
+
+// assertion is the expectations of one asserting step of the source test.
+type assertion struct {
+	source string
+	expect []scenario.Expectation
+}
+
+func newBuilder(name string) *builder {
+	return &builder{c: &Converted{
+		Scenario:  &scenario.Scenario{Name: name},
+		Manifests: map[string][]map[string]any{},
+	}}
+}
+
+func (b *builder) warn(format string, args ...any) {
+	b.c.Warnings = append(b.c.Warnings, fmt.Sprintf(format, args...))
+}
+
+// apply adds objs as a setup manifest named after the source file.
+func (b *builder) apply(source string, objs []map[string]any) {
+	if len(objs) == 0 {
+		return
+	}
+	file := strings.NewReplacer("*", "_", "?", "_").Replace(filepath.Base(source))
+	if ext := filepath.Ext(file); ext != ".yaml" && ext != ".yml" {
+		file += ".yaml"
+	}
+	rel := fmt.Sprintf("fixtures/%s/%02d-%s", artifacts.Slug(b.c.Scenario.Name),
+		len(b.c.Scenario.Setup.Manifests), file)
+	b.c.Manifests[rel] = objs
+	b.applyAfterAssert = b.applyAfterAssert || len(b.asserts) > 0
+	b.c.Scenario.Setup.Manifests = append(b.c.Scenario.Setup.Manifests, rel)
+	for _, obj := range objs {
+		if namespaceOf(obj) == "" {
+			b.unnamespaced = true
+		}
+	}
+}
+
+// assertStep adds the expectations of objs as the next asserted state.
+func (b *builder) assertStep(source string, objs []map[string]any) {
+	var expect []scenario.Expectation
+	for _, obj := range objs {
+		exp, err := expectation(obj)
+		if err != nil {
+			b.warn("%s: %v", source, err)
+			continue
+		}
+		if exp.Resource.Namespace == "" {
+			b.unnamespaced = true
+		}
+		expect = append(expect, exp)
+	}
+	if len(expect) == 0 {
+		return
+	}
+	b.asserts = append(b.asserts, assertion{source: source, expect: expect})
+}
+
+func (b *builder) finish() (*Converted, error) {
+	if b.applyAfterAssert {
+		b.warn("manifests applied after an assert are now applied up front with the rest of the setup")
+	}
+	if b.unnamespaced {
+		b.warn("objects without a namespace now use the default namespace instead of a per-test one")
+	}
+	for i, a := range b.asserts {
+		if i == 0 {
+			b.c.Scenario.Expect = a.expect
+			continue
+		}
+		b.c.Scenario.Steps = append(b.c.Scenario.Steps, scenario.Step{
+			Name:   filepath.Base(a.source),
+			Expect: a.expect,
+		})
+	}
+	if err := b.c.Scenario.Validate(); err != nil {
+		return nil, err
+	}
+	return b.c, nil
+}
+
+// expectation turns an asserted object into an expectation on each of its
+// leaf fields.
+func expectation(obj map[string]any) (scenario.Expectation, error) {
+	meta, _ := obj["metadata"].(map[string]any)
+	name, _ := meta["name"].(string)
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	if name == "" {
+		return scenario.Expectation{}, fmt.Errorf("asserted %s has no name; matching by labels is not supported", kind)
+	}
+	exp := scenario.Expectation{Resource: scenario.ResourceRef{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Name:       name,
+		Namespace:  namespaceOf(obj),
+	}}
+	keys := sortedKeys(obj)
+	for _, k := range keys {
+		switch k {
+		case "apiVersion", "kind":
+			continue
+		case "metadata":
+			for _, mk := range sortedKeys(meta) {
+				if mk != "name" && mk != "namespace" {
+					exp.Conditions = appendLeaves(exp.Conditions, ".metadata."+mk, meta[mk])
+				}
+			}
+			continue
+		}
+		exp.Conditions = appendLeaves(exp.Conditions, "."+k, obj[k])
+	}
+	return exp, nil
+}
+
+// appendLeaves adds a condition for every scalar under v. Empty maps and
+// lists are compared as a whole.
+func appendLeaves(conds []scenario.Condition, path string, v any) []scenario.Condition {
+	switch v := v.(type) {
+	case map[string]any:
+		if len(v) == 0 {
+			break
+		}
+		for _, k := range sortedKeys(v) {
+			conds = appendLeaves(conds, path+"."+k, v[k])
+		}
+		return conds
+	case []any:
+		if len(v) == 0 {
+			break
+		}
+		for i, item := range v {
+			conds = appendLeaves(conds, fmt.Sprintf("%s[%d]", path, i), item)
+		}
+		return conds
+	}
+	return append(conds, scenario.Condition{Path: path, Value: v})
+}
+
+func namespaceOf(obj map[string]any) string {
+	meta, _ := obj["metadata"].(map[string]any)
+	ns, _ := meta["namespace"].(string)
+	return ns
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isGroup reports whether obj belongs to the API group, ignoring version.
+func isGroup(obj map[string]any, group string) bool {
+	apiVersion, _ := obj["apiVersion"].(string)
+	return strings.HasPrefix(apiVersion, group+"/")
+}
@@ -0,0 +1,293 @@
+package convert
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// writeFiles writes files, keyed by their path relative to dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func configMap(name, value string) string {
+	return `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ` + name + `
+  namespace: test
+data:
+  value: "` + value + `"
+`
+}
+
+func configMapRef(name string) scenario.ResourceRef {
+	return scenario.ResourceRef{APIVersion: "v1", Kind: "ConfigMap", Name: name, Namespace: "test"}
+}
+
+func valueIs(name, value string) []scenario.Expectation {
+	return []scenario.Expectation{{
+		Resource:   configMapRef(name),
+		Conditions: []scenario.Condition{{Path: ".data.value", Value: value}},
+	}}
+}
+
+func TestKuttl(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     map[string]string
+		manifests []string
+		expect    []scenario.Expectation
+		steps     []scenario.Step
+		timeout   time.Duration
+		warnings  []string
+	}{
+		{
+			name: "apply then assert",
+			files: map[string]string{
+				"00-install.yaml": configMap("app", "1"),
+				"00-assert.yaml":  configMap("app", "1"),
+				"README.md":       "not a step",
+			},
+			manifests: []string{"fixtures/test/00-00-install.yaml"},
+			expect:    valueIs("app", "1"),
+		},
+		{
+			name: "every assert step is kept",
+			files: map[string]string{
+				"00-install.yaml": configMap("app", "1"),
+				"00-assert.yaml":  configMap("app", "1"),
+				"01-assert.yaml":  configMap("app", "2"),
+				"02-assert.yaml":  configMap("app", "3"),
+			},
+			manifests: []string{"fixtures/test/00-00-install.yaml"},
+			expect:    valueIs("app", "1"),
+			steps: []scenario.Step{
+				{Name: "01-assert.yaml", Expect: valueIs("app", "2")},
+				{Name: "02-assert.yaml", Expect: valueIs("app", "3")},
+			},
+		},
+		{
+			name: "manifests applied after an assert",
+			files: map[string]string{
+				"00-install.yaml": configMap("app", "1"),
+				"00-assert.yaml":  configMap("app", "1"),
+				"01-update.yaml":  configMap("app", "2"),
+				"01-assert.yaml":  configMap("app", "2"),
+			},
+			manifests: []string{"fixtures/test/00-00-install.yaml", "fixtures/test/01-01-update.yaml"},
+			expect:    valueIs("app", "1"),
+			steps:     []scenario.Step{{Name: "01-assert.yaml", Expect: valueIs("app", "2")}},
+			warnings:  []string{"manifests applied after an assert are now applied up front with the rest of the setup"},
+		},
+		{
+			name: "test steps and unsupported files",
+			files: map[string]string{
+				"00-install.yaml": configMap("app", "1") + `---
+apiVersion: kuttl.dev/v1beta1
+kind: TestStep
+timeout: 90
+commands:
+- script: echo hi
+`,
+				"00-assert.yaml": configMap("app", "1"),
+				"01-errors.yaml": configMap("gone", "1"),
+			},
+			manifests: []string{"fixtures/test/00-00-install.yaml"},
+			expect:    valueIs("app", "1"),
+			timeout:   90 * time.Second,
+			warnings: []string{
+				"00-install.yaml: TestStep commands is not supported",
+				"01-errors.yaml: asserting that objects are absent is not supported",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "test")
+			writeFiles(t, dir, tt.files)
+			c, err := Dir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := c.Scenario
+			if s.Name != "test" {
+				t.Errorf("name = %q, want test", s.Name)
+			}
+			if !reflect.DeepEqual(s.Setup.Manifests, tt.manifests) {
+				t.Errorf("setup manifests = %v, want %v", s.Setup.Manifests, tt.manifests)
+			}
+			for _, m := range tt.manifests {
+				if len(c.Manifests[m]) != 1 {
+					t.Errorf("manifest %s holds %d objects, want 1", m, len(c.Manifests[m]))
+				}
+			}
+			if !reflect.DeepEqual(s.Expect, tt.expect) {
+				t.Errorf("expect = %+v, want %+v", s.Expect, tt.expect)
+			}
+			if !reflect.DeepEqual(s.Steps, tt.steps) {
+				t.Errorf("steps = %+v, want %+v", s.Steps, tt.steps)
+			}
+			if got := s.TimeoutOrDefault(); tt.timeout != 0 && got != tt.timeout {
+				t.Errorf("timeout = %s, want %s", got, tt.timeout)
+			}
+			if !reflect.DeepEqual(c.Warnings, tt.warnings) {
+				t.Errorf("warnings = %q, want %q", c.Warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestChainsaw(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dir")
+	writeFiles(t, dir, map[string]string{
+		"chainsaw-test.yaml": `apiVersion: chainsaw.kyverno.io/v1alpha1
+kind: Test
+metadata:
+  name: scale
+spec:
+  timeouts:
+    assert: 45s
+  steps:
+  - name: install
+    try:
+    - apply:
+        file: install-*.yaml
+    - assert:
+        resource:
+          apiVersion: v1
+          kind: ConfigMap
+          metadata:
+            name: app
+            namespace: test
+          data:
+            value: "1"
+            (length(keys)): 1
+  - name: update
+    try:
+    - script:
+        content: echo hi
+    - assert:
+        file: updated.yaml
+    finally:
+    - delete: {}
+`,
+		"install-b.yaml": configMap("b", "1"),
+		"install-a.yaml": configMap("app", "1"),
+		"updated.yaml":   configMap("app", "2"),
+	})
+	c, err := Dir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := c.Scenario
+	if s.Name != "scale" {
+		t.Errorf("name = %q, want scale", s.Name)
+	}
+	if want := []string{"fixtures/scale/00-install-_.yaml"}; !reflect.DeepEqual(s.Setup.Manifests, want) {
+		t.Errorf("setup manifests = %v, want %v", s.Setup.Manifests, want)
+	}
+	if objs := c.Manifests["fixtures/scale/00-install-_.yaml"]; len(objs) != 2 || objs[0]["metadata"].(map[string]any)["name"] != "app" {
+		t.Errorf("manifest objects = %v, want app then b", objs)
+	}
+	if !reflect.DeepEqual(s.Expect, valueIs("app", "1")) {
+		t.Errorf("expect = %+v", s.Expect)
+	}
+	if want := []scenario.Step{{Name: "updated.yaml", Expect: valueIs("app", "2")}}; !reflect.DeepEqual(s.Steps, want) {
+		t.Errorf("steps = %+v, want %+v", s.Steps, want)
+	}
+	if got := s.TimeoutOrDefault(); got != 45*time.Second {
+		t.Errorf("timeout = %s, want 45s", got)
+	}
+	want := []string{
+		`step "install": assertion expressions in assert were dropped`,
+		`step "update": finally is not supported`,
+		`step "update": script is not supported`,
+	}
+	if !reflect.DeepEqual(c.Warnings, want) {
+		t.Errorf("warnings = %q, want %q", c.Warnings, want)
+	}
+}
+
+func TestChainsawWithoutTest(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"chainsaw-test.yaml": configMap("app", "1")})
+	if _, err := Dir(dir); err == nil || !strings.Contains(err.Error(), "no Test found") {
+		t.Errorf("Dir() error = %v, want no Test found", err)
+	}
+}
+
+func TestExpectation(t *testing.T) {
+	obj := map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]any{
+			"name":   "app",
+			"labels": map[string]any{"tier": "web"},
+		},
+		"spec": map[string]any{
+			"replicas": float64(3),
+			"template": map[string]any{"spec": map[string]any{
+				"containers": []any{map[string]any{"name": "app"}},
+				"volumes":    []any{},
+			}},
+		},
+	}
+	got, err := expectation(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := scenario.Expectation{
+		Resource: scenario.ResourceRef{APIVersion: "apps/v1", Kind: "Deployment", Name: "app"},
+		Conditions: []scenario.Condition{
+			{Path: ".metadata.labels.tier", Value: "web"},
+			{Path: ".spec.replicas", Value: float64(3)},
+			{Path: ".spec.template.spec.containers[0].name", Value: "app"},
+			{Path: ".spec.template.spec.volumes", Value: []any{}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expectation() = %+v, want %+v", got, want)
+	}
+
+	if _, err := expectation(map[string]any{"kind": "Pod", "metadata": map[string]any{}}); err == nil {
+		t.Error("expectation() of an object without a name succeeded")
+	}
+}
+
+func TestSuite(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a/00-assert.yaml":           configMap("app", "1"),
+		"b/chainsaw-test.yaml":       "apiVersion: chainsaw.kyverno.io/v1alpha1\nkind: Test\nmetadata:\n  name: b\nspec:\n  steps: []\n",
+		"not-a-test/notes.txt":       "",
+		"nested/c/01-assert.yaml":    configMap("app", "1"),
+		"nested/c/01-something.yaml": configMap("app", "1"),
+	})
+	all, err := Suite(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range all {
+		names = append(names, c.Scenario.Name)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Suite() = %v, want %v", names, want)
+	}
+}
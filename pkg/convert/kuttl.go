@@ -0,0 +1,93 @@
+package convert
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+const kuttlGroup = "kuttl.dev"
+
+// kuttlStepFile matches kuttl step files such as 00-install.yaml or
+// 01-assert.yaml.
+var kuttlStepFile = regexp.MustCompile(`^(\d+)-([^.]+)\.ya?ml$`)
+
+// Kuttl converts the kuttl test case in dir. Files named NN-assert*.yaml
+// become expectations, NN-errors*.yaml files are not supported, and every
+// other step file is applied as setup.
+func Kuttl(dir string) (*Converted, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	type stepFile struct {
+		step int
+		name string
+		file string
+	}
+	var files []stepFile
+	for _, e := range entries {
+		m := kuttlStepFile.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+		step, _ := strconv.Atoi(m[1])
+		files = append(files, stepFile{step: step, name: m[2], file: e.Name()})
+	}
+	checks := func(f stepFile) bool {
+		return strings.HasPrefix(f.name, "assert") || strings.HasPrefix(f.name, "errors")
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].step != files[j].step {
+			return files[i].step < files[j].step
+		}
+		// kuttl applies the files of a step before checking its asserts.
+		return !checks(files[i]) && checks(files[j])
+	})
+
+	b := newBuilder(filepath.Base(dir))
+	var timeout time.Duration
+	for _, f := range files {
+		path := filepath.Join(dir, f.file)
+		objs, err := scenario.ReadObjects(path)
+		if err != nil {
+			return nil, err
+		}
+		var resources []map[string]any
+		for _, obj := range objs {
+			if !isGroup(obj, kuttlGroup) {
+				resources = append(resources, obj)
+				continue
+			}
+			for _, field := range []string{"commands", "delete", "apply", "assert", "error"} {
+				if _, ok := obj[field]; ok {
+					b.warn("%s: %s %s is not supported", f.file, obj["kind"], field)
+				}
+			}
+			if secs, ok := obj["timeout"].(float64); ok && time.Duration(secs)*time.Second > timeout {
+				timeout = time.Duration(secs) * time.Second
+			}
+		}
+
+		switch {
+		case strings.HasPrefix(f.name, "assert"):
+			b.assertStep(f.file, resources)
+		case strings.HasPrefix(f.name, "errors"):
+			b.warn("%s: asserting that objects are absent is not supported", f.file)
+		default:
+			b.apply(f.file, resources)
+		}
+	}
+	if timeout > 0 {
+		b.c.Scenario.Timeout = &metav1.Duration{Duration: timeout}
+	}
+	return b.finish()
+}
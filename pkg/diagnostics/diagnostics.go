@@ -0,0 +1,288 @@
+// Package diagnostics collects the evidence needed to debug a scenario that
+// did not converge: agent logs, namespace events, and the difference between
+// expected and actual resource state.
+package diagnostics
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/agent"
+	"github.com/aslakknutsen/kube-agents-test/pkg/artifacts"
+)
+
+// Scope selects what a Collector gathers.
+type Scope struct {
+	// Scenario names the scenario; it keys where logs are written.
+	Scenario   string
+	Namespaces []string
+	Agents     []string
+	// Since limits collected agent logs to those written after it,
+	// typically the scenario start. Zero collects the last hour.
+	Since time.Time
+}
+
+// Report is the diagnostics bundle of one failed scenario. Bulky evidence
+// such as logs stays on disk and is only referenced, so holding the reports
+// of many failed scenarios stays cheap.
+type Report struct {
+	Scenario string
+	// Logs references each agent's log files.
+	Logs   map[string]LogRef
+	Events []Event
+	Diffs  []Diff
+	// Watch holds the last watch events of the resources of unmet
+	// expectations, oldest first. A resource whose only event is ADDED
+	// did not change while it was watched.
+	Watch []WatchEvent
+	// Errors records collection steps that failed; a partial report is
+	// still more useful than none.
+	Errors []string
+}
+
+// DefaultPreviewBytes is how much of the end of a log is kept inline.
+const DefaultPreviewBytes = 4 << 10
+
+// LogRef points at an agent's logs on disk.
+type LogRef struct {
+	// Files are the log segments, oldest first.
+	Files []string
+	// Bytes is the total size of Files.
+	Bytes int64
+	// Preview is the tail of the newest segment, at most
+	// DefaultPreviewBytes.
+	Preview string
+}
+
+// Event is a condensed Kubernetes Event.
+type Event struct {
+	Namespace string
+	Object    string
+	Type      string
+	Reason    string
+	Message   string
+	Count     int32
+	LastSeen  time.Time
+}
+
+// WatchEvent is a change to a resource seen by the engine's watch.
+type WatchEvent struct {
+	Resource string
+	// Type is ADDED, MODIFIED, or DELETED.
+	Type            string
+	ResourceVersion string
+	Generation      int64
+	// Changed lists which of spec, status, labels, and annotations a
+	// MODIFIED event changed.
+	Changed []string
+	Time    time.Time
+}
+
+// Diff is one unmet condition: the value that was expected at a path and
+// the value last observed there.
+type Diff struct {
+	Resource string
+	Path     string
+	// Description says what the condition checks, if the scenario
+	// describes it.
+	Description string
+	Expected    any
+	Actual      any
+}
+
+// Subject names what the diff is about: its resource and path, if it has
+// one, after the description if there is one.
+func (d Diff) Subject() string {
+	subject := d.Resource
+	if d.Path != "" {
+		subject += " " + d.Path
+	}
+	if d.Description == "" {
+		return subject
+	}
+	return fmt.Sprintf("%s (%s)", d.Description, subject)
+}
+
+// Collector gathers diagnostics for a scope.
+type Collector interface {
+	Collect(ctx context.Context, scope Scope) (*Report, error)
+}
+
+// Default log limits: agent logs are kept in segments of at most
+// DefaultLogSegmentBytes, and only the newest DefaultLogSegments survive.
+const (
+	DefaultLogSegmentBytes = 8 << 20
+	DefaultLogSegments     = 4
+)
+
+// ClusterCollector reads events from the cluster and streams logs through
+// the agent Manager to size-capped files.
+type ClusterCollector struct {
+	client kubernetes.Interface
+	agents agent.Manager
+
+	logDir       string
+	segmentBytes int64
+	segments     int
+}
+
+var _ Collector = (*ClusterCollector)(nil)
+
+// CollectorOption configures a ClusterCollector.
+type CollectorOption func(*ClusterCollector)
+
+// WithLogDir sets where agent logs are written, one subdirectory per run,
+// named by the run ID of the context Collect is given, holding one per
+// scenario.
+func WithLogDir(dir string) CollectorOption {
+	return func(c *ClusterCollector) { c.logDir = dir }
+}
+
+// WithLogLimit caps each agent's logs at segments files of segmentBytes.
+func WithLogLimit(segmentBytes int64, segments int) CollectorOption {
+	return func(c *ClusterCollector) {
+		c.segmentBytes = segmentBytes
+		c.segments = segments
+	}
+}
+
+// NewClusterCollector returns a Collector backed by the cluster. agents may be
+// nil when agents are not managed by the framework.
+func NewClusterCollector(client kubernetes.Interface, agents agent.Manager, opts ...CollectorOption) *ClusterCollector {
+	c := &ClusterCollector{
+		client:       client,
+		agents:       agents,
+		logDir:       filepath.Join(os.TempDir(), "kube-agents-test-logs"),
+		segmentBytes: DefaultLogSegmentBytes,
+		segments:     DefaultLogSegments,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Collect gathers agent logs and events for scope. Failures of individual
+// steps are recorded in Report.Errors rather than aborting collection.
+func (c *ClusterCollector) Collect(ctx context.Context, scope Scope) (*Report, error) {
+	r := &Report{Logs: map[string]LogRef{}}
+
+	if c.agents != nil && len(scope.Agents) > 0 {
+		dir := c.logDir
+		if id := agent.RunIDFromContext(ctx); id != "" {
+			dir = filepath.Join(dir, artifacts.Slug(id))
+		}
+		dir = filepath.Join(dir, artifacts.Slug(scope.Scenario))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("creating log directory: %w", err)
+		}
+		for _, name := range scope.Agents {
+			files, err := c.streamLogs(ctx, dir, name, scope.Since)
+			if len(files) > 0 {
+				r.Logs[name] = NewLogRef(files)
+			}
+			if err != nil {
+				r.Errors = append(r.Errors, err.Error())
+			}
+		}
+	}
+
+	for _, ns := range scope.Namespaces {
+		events, err := c.client.CoreV1().Events(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			r.Errors = append(r.Errors, fmt.Sprintf("listing events in %s: %v", ns, err))
+			continue
+		}
+		for _, e := range events.Items {
+			last := e.LastTimestamp.Time
+			if last.IsZero() {
+				last = e.EventTime.Time
+			}
+			r.Events = append(r.Events, Event{
+				Namespace: e.Namespace,
+				Object:    e.InvolvedObject.Kind + "/" + e.InvolvedObject.Name,
+				Type:      e.Type,
+				Reason:    e.Reason,
+				Message:   e.Message,
+				Count:     e.Count,
+				LastSeen:  last,
+			})
+		}
+	}
+	sort.SliceStable(r.Events, func(i, j int) bool {
+		return r.Events[i].LastSeen.Before(r.Events[j].LastSeen)
+	})
+	return r, nil
+}
+
+// streamLogs copies an agent's logs into a rolling file and returns its
+// segments.
+func (c *ClusterCollector) streamLogs(ctx context.Context, dir, name string, since time.Time) ([]string, error) {
+	out := &RollingFile{
+		Path:     filepath.Join(dir, artifacts.Slug(name)+".log"),
+		MaxBytes: c.segmentBytes,
+		MaxFiles: c.segments,
+	}
+	err := c.agents.Logs(ctx, name, out, agent.LogOptions{Since: since})
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if _, statErr := os.Stat(out.Path); statErr != nil {
+		return nil, err
+	}
+	return out.Segments(), err
+}
+
+// String renders the report for terminal output.
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "=== diagnostics: %s ===\n", r.Scenario)
+	if len(r.Diffs) > 0 {
+		b.WriteString("--- unmet conditions ---\n")
+		for _, d := range r.Diffs {
+			fmt.Fprintf(&b, "%s: expected %v, got %v\n", d.Subject(), d.Expected, d.Actual)
+		}
+	}
+	if len(r.Watch) > 0 {
+		b.WriteString("--- watch ---\n")
+		for _, w := range r.Watch {
+			fmt.Fprintf(&b, "%s %s %s rv=%s generation=%d", w.Time.Format(time.RFC3339), w.Type, w.Resource, w.ResourceVersion, w.Generation)
+			if len(w.Changed) > 0 {
+				fmt.Fprintf(&b, " changed=%s", strings.Join(w.Changed, ","))
+			}
+			b.WriteString("\n")
+		}
+	}
+	if len(r.Events) > 0 {
+		b.WriteString("--- events ---\n")
+		for _, e := range r.Events {
+			fmt.Fprintf(&b, "%s %s %s %s: %s (x%d)\n",
+				e.LastSeen.Format(time.RFC3339), e.Type, e.Object, e.Reason, e.Message, e.Count)
+		}
+	}
+	names := make([]string, 0, len(r.Logs))
+	for name := range r.Logs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ref := r.Logs[name]
+		fmt.Fprintf(&b, "--- logs: %s (%d bytes in %s) ---\n%s\n",
+			name, ref.Bytes, strings.Join(ref.Files, ", "), ref.Preview)
+	}
+	if len(r.Errors) > 0 {
+		b.WriteString("--- collection errors ---\n")
+		for _, e := range r.Errors {
+			b.WriteString(e + "\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,50 @@
+package diagnostics
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/agent"
+)
+
+// logsManager is an agent.Manager whose agents log their name.
+type logsManager struct{ agent.Manager }
+
+func (logsManager) Logs(_ context.Context, name string, w io.Writer, _ agent.LogOptions) error {
+	_, err := io.WriteString(w, name+"\n")
+	return err
+}
+
+func TestCollectLogDirs(t *testing.T) {
+	dir := t.TempDir()
+	c := NewClusterCollector(fake.NewClientset(), logsManager{}, WithLogDir(dir))
+	scope := Scope{Scenario: "Scale Up", Agents: []string{"quota-agent"}}
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "no run", ctx: context.Background(), want: filepath.Join(dir, "scale-up", "quota-agent.log")},
+		{name: "run", ctx: agent.ContextWithRunID(context.Background(), "run-1"), want: filepath.Join(dir, "run-1", "scale-up", "quota-agent.log")},
+		{name: "other run", ctx: agent.ContextWithRunID(context.Background(), "run-2"), want: filepath.Join(dir, "run-2", "scale-up", "quota-agent.log")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := c.Collect(tt.ctx, scope)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(r.Errors) > 0 {
+				t.Errorf("Collect() errors = %v", r.Errors)
+			}
+			if got := r.Logs["quota-agent"].Files; !reflect.DeepEqual(got, []string{tt.want}) {
+				t.Errorf("log files = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package diagnostics
+
+import (
+	"io"
+	"os"
+)
+
+// NewLogRef describes the log segments in files (oldest first), reading only
+// the tail of the newest one for the preview.
+func NewLogRef(files []string) LogRef {
+	ref := LogRef{Files: files}
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			ref.Bytes += info.Size()
+		}
+	}
+	if len(files) > 0 {
+		ref.Preview = tail(files[len(files)-1], DefaultPreviewBytes)
+	}
+	return ref
+}
+
+// tail returns up to n bytes from the end of the file at path.
+func tail(path string, n int64) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return ""
+	}
+	offset := info.Size() - n
+	if offset < 0 {
+		offset = 0
+	}
+	buf := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return ""
+	}
+	return string(buf)
+}
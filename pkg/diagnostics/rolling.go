@@ -0,0 +1,111 @@
+package diagnostics
+
+import (
+	"fmt"
+	"os"
+)
+
+// RollingFile is an io.WriteCloser that caps disk usage: once the active
+// file reaches MaxBytes it is rotated to <path>.1 (shifting older segments
+// up) and writing continues in a fresh file. At most MaxFiles segments are
+// kept, so the newest MaxBytes*MaxFiles bytes survive.
+type RollingFile struct {
+	Path     string
+	MaxBytes int64
+	MaxFiles int
+
+	f       *os.File
+	size    int64
+	rotated int
+}
+
+// Write appends p, rotating as needed. Writes larger than MaxBytes are
+// split across segments.
+func (r *RollingFile) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if r.f == nil {
+			if err := r.open(); err != nil {
+				return written, err
+			}
+		}
+		chunk := p
+		if r.MaxBytes > 0 {
+			room := r.MaxBytes - r.size
+			if room <= 0 {
+				if err := r.rotate(); err != nil {
+					return written, err
+				}
+				continue
+			}
+			if int64(len(chunk)) > room {
+				chunk = chunk[:room]
+			}
+		}
+		n, err := r.f.Write(chunk)
+		written += n
+		r.size += int64(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Close closes the active segment.
+func (r *RollingFile) Close() error {
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+// Segments returns the files holding data, oldest first.
+func (r *RollingFile) Segments() []string {
+	var paths []string
+	for i := r.rotated; i >= 1; i-- {
+		paths = append(paths, r.segment(i))
+	}
+	return append(paths, r.Path)
+}
+
+func (r *RollingFile) open() error {
+	f, err := os.Create(r.Path)
+	if err != nil {
+		return err
+	}
+	r.f = f
+	r.size = 0
+	return nil
+}
+
+func (r *RollingFile) rotate() error {
+	if err := r.Close(); err != nil {
+		return err
+	}
+	keep := r.MaxFiles - 1
+	if keep < 1 {
+		// A single segment: start over, keeping only the newest data.
+		return r.open()
+	}
+	os.Remove(r.segment(keep))
+	for i := keep - 1; i >= 1; i-- {
+		if err := os.Rename(r.segment(i), r.segment(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(r.Path, r.segment(1)); err != nil {
+		return err
+	}
+	if r.rotated < keep {
+		r.rotated++
+	}
+	return r.open()
+}
+
+func (r *RollingFile) segment(i int) string {
+	return fmt.Sprintf("%s.%d", r.Path, i)
+}
@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/agent"
+	"github.com/aslakknutsen/kube-agents-test/pkg/apiproxy"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// needsProxy reports whether spec's API requests go through the API proxy
+// in s: for the scenario's faults, or to check the agent's allowlist.
+func (e *Engine) needsProxy(s *scenario.Scenario, spec agent.Spec) bool {
+	return len(s.APIFaults) > 0 || (e.checkAPIAccess && spec.Allow != nil)
+}
+
+// startAPIProxy deploys the API proxy on first use, publishes the
+// scenario's faults and the kubeconfigs of the agents routed through it,
+// and waits until it serves them.
+func (e *Engine) startAPIProxy(ctx context.Context, agents []string, faults []scenario.APIFault) error {
+	if e.apiProxyImage == "" {
+		return errors.New("the scenario needs the API proxy but no API proxy image is configured")
+	}
+	if !e.apiProxyDeployed {
+		e.log.Info("deploying API proxy", "image", e.apiProxyImage)
+		if err := apiproxy.Deploy(ctx, e.kube, agent.Namespace, e.apiProxyImage); err != nil {
+			return err
+		}
+		e.apiProxyDeployed = true
+	}
+	epoch, err := apiproxy.Configure(ctx, e.kube, agent.Namespace, agents, faults)
+	if err != nil {
+		return err
+	}
+	readyCtx, cancel := context.WithTimeout(ctx, e.agentTimeout)
+	defer cancel()
+	if err := apiproxy.WaitReady(readyCtx, e.kube, agent.Namespace); err != nil {
+		return err
+	}
+	return apiproxy.WaitEpoch(readyCtx, e.kube, agent.Namespace, epoch)
+}
+
+// publishKubeconfig makes the agent's proxy kubeconfig mountable in its
+// namespace, when that is not the proxy's.
+func (e *Engine) publishKubeconfig(ctx context.Context, name string) error {
+	ns := e.agents.Namespace(name)
+	if ns == agent.Namespace {
+		return nil
+	}
+	if err := e.createNamespace(ctx, ns); err != nil {
+		return err
+	}
+	return apiproxy.PublishKubeconfig(ctx, e.kube, agent.Namespace, ns, name)
+}
+
+// proxied points spec's API requests at the API proxy through a mounted
+// kubeconfig. Agents must honor KUBECONFIG, as controller-runtime and
+// clientcmd's default loading rules do.
+func proxied(spec agent.Spec) agent.Spec {
+	spec.Env["KUBECONFIG"] = apiproxy.KubeconfigPath(spec.Name)
+	spec.ConfigMaps = maps.Clone(spec.ConfigMaps)
+	if spec.ConfigMaps == nil {
+		spec.ConfigMaps = map[string]string{}
+	}
+	spec.ConfigMaps[apiproxy.Name] = apiproxy.MountPath
+	return spec
+}
+
+// verifyAPIAccess fails if an agent with an allowlist made an API call the
+// list does not allow, as recorded by the API proxy.
+func (e *Engine) verifyAPIAccess(ctx context.Context, specs []agent.Spec) error {
+	allow := map[string][]agent.APIRule{}
+	for _, spec := range specs {
+		if spec.Allow != nil {
+			allow[spec.Name] = spec.Allow
+		}
+	}
+	if !e.checkAPIAccess || len(allow) == 0 {
+		return nil
+	}
+	st, err := apiproxy.GetStatus(ctx, e.kube, agent.Namespace)
+	if err != nil {
+		return err
+	}
+	var denied []string
+	for _, c := range st.Calls {
+		rules, ok := allow[c.Agent]
+		if !ok || allowed(rules, c) {
+			continue
+		}
+		denied = append(denied, fmt.Sprintf("%s: %s (%d×)", c.Agent, c, c.Count))
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("API calls outside the agents' allowlists:\n  %s", strings.Join(denied, "\n  "))
+	}
+	return nil
+}
+
+func allowed(rules []agent.APIRule, c apiproxy.Call) bool {
+	for _, r := range rules {
+		if r.Allows(c.Verb, c.Group, c.Resource, c.Subresource) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,406 @@
+package engine
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.yaml.in/yaml/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/envsubst"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// applySetup applies the scenario's setup manifests. CustomResourceDefinitions
+// go first and must be established before the remaining objects are applied
+// in order, followed by generated resources, so fixtures can ship a CRD next
+// to resources of its kind. Each group is validated against the cluster's
+// schemas before it is applied. applySetup returns the names generated for
+// manifest objects with metadata.generateName, keyed by
+// scenario.GeneratedKey.
+func (e *Engine) applySetup(ctx context.Context, cs *compiled) (map[string]string, error) {
+	if err := e.validateObjects(cs, isCRD); err != nil {
+		return nil, err
+	}
+	var crds []string
+	for _, m := range cs.manifests {
+		for _, obj := range m.objs {
+			if !isCRD(obj) {
+				continue
+			}
+			if err := e.applyUnstructured(ctx, obj.DeepCopy()); err != nil {
+				return nil, fmt.Errorf("%s: %w", m.path, err)
+			}
+			crds = append(crds, obj.GetName())
+		}
+	}
+	if len(crds) > 0 {
+		waitCtx, cancel := context.WithTimeout(ctx, crdTimeout)
+		err := e.WaitForCRDEstablished(waitCtx, crds...)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+	}
+	notCRD := func(obj *unstructured.Unstructured) bool { return !isCRD(obj) }
+	if err := e.validateObjects(cs, notCRD); err != nil {
+		return nil, err
+	}
+	generated := map[string]string{}
+	for _, m := range cs.manifests {
+		for _, obj := range m.objs {
+			if isCRD(obj) {
+				continue
+			}
+			applied := obj.DeepCopy()
+			if err := e.applyUnstructured(ctx, applied); err != nil {
+				return nil, fmt.Errorf("%s: %w", m.path, err)
+			}
+			if obj.GetName() == "" {
+				generated[scenario.GeneratedKey(obj.GetGenerateName())] = applied.GetName()
+			}
+		}
+	}
+	for i, g := range cs.generated {
+		if err := e.generate(ctx, g); err != nil {
+			return nil, fmt.Errorf("setup.generate[%d]: %w", i, err)
+		}
+	}
+	return generated, nil
+}
+
+// validateObjects checks the setup objects selected by include against the
+// cluster's schemas and reports every violation with its file and line.
+// Failing to fetch a schema only skips the check.
+func (e *Engine) validateObjects(cs *compiled, include func(*unstructured.Unstructured) bool) error {
+	if e.validator == nil {
+		return nil
+	}
+	var errs []error
+	for _, m := range cs.manifests {
+		var docs []*yaml.Node
+		for i, obj := range m.objs {
+			if !include(obj) {
+				continue
+			}
+			violations, err := e.validator.validate(obj)
+			if err != nil {
+				e.log.Warn("skipping schema validation", "manifest", m.path, "error", err)
+				continue
+			}
+			if len(violations) > 0 && docs == nil {
+				docs = manifestDocs(m.path)
+			}
+			for _, v := range violations {
+				line := 0
+				if len(docs) == len(m.objs) {
+					line = nodeLine(docs[i], v.path)
+				}
+				errs = append(errs, fmt.Errorf("%s:%d: %s %s: %s", m.path, line, obj.GetKind(), obj.GetName(), v))
+			}
+		}
+	}
+	// Generated copies share their structure, so checking the first of
+	// each generator is enough.
+	for i, g := range cs.generated {
+		if len(g.objs) == 0 || !include(g.objs[0]) {
+			continue
+		}
+		violations, err := e.validator.validate(g.objs[0])
+		if err != nil {
+			e.log.Warn("skipping schema validation", "generator", i, "error", err)
+			continue
+		}
+		for _, v := range violations {
+			errs = append(errs, fmt.Errorf("setup.generate[%d]: %s: %s", i, g.objs[0].GetKind(), v))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid manifests:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// fireTrigger fires the scenario's triggers, if any, in order.
+func (e *Engine) fireTrigger(ctx context.Context, s *scenario.Scenario) error {
+	triggers := s.Trigger.Triggers()
+	for i, t := range triggers {
+		if err := e.fire(ctx, t); err != nil {
+			if len(triggers) > 1 {
+				return fmt.Errorf("trigger %d: %w", i, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// fire applies a single trigger after its delay: the patch, once the
+// admission webhooks in its path are serving, then the metadata change,
+// the scale, the HTTP call, the command, the Event, the node drain, and
+// the clock advance.
+func (e *Engine) fire(ctx context.Context, t *scenario.Trigger) error {
+	if t.Delay != nil {
+		if err := sleep(ctx, t.Delay.Duration); err != nil {
+			return err
+		}
+	}
+	if err := e.patchTrigger(ctx, t.Patch); err != nil {
+		return err
+	}
+	if m := t.Metadata; m != nil {
+		if err := e.metadataTrigger(ctx, m); err != nil {
+			return err
+		}
+	}
+	if sc := t.Scale; sc != nil {
+		if err := e.scaleTrigger(ctx, sc); err != nil {
+			return err
+		}
+	}
+	if h := t.HTTP; h != nil {
+		if err := e.callHTTP(ctx, h); err != nil {
+			return err
+		}
+	}
+	if x := t.Exec; x != nil {
+		if err := e.execTrigger(ctx, x); err != nil {
+			return err
+		}
+	}
+	if ev := t.Event; ev != nil {
+		if err := e.emitEvent(ctx, ev); err != nil {
+			return err
+		}
+	}
+	if d := t.Drain; d != nil {
+		if err := e.drainNode(ctx, d); err != nil {
+			return err
+		}
+	}
+	if d := t.AdvanceClock; d != nil {
+		return e.advanceClock(ctx, d.Duration)
+	}
+	return nil
+}
+
+// patchTrigger applies a trigger patch, if any.
+func (e *Engine) patchTrigger(ctx context.Context, p *scenario.ResourcePatch) error {
+	if p == nil {
+		return nil
+	}
+	ri, err := e.resourceFor(p.ResourceRef)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]any{"spec": p.Spec})
+	if err != nil {
+		return err
+	}
+	if err := e.waitForWebhooks(ctx, ri, p.Name, body); err != nil {
+		return fmt.Errorf("patching %s: %w", p.ResourceRef, err)
+	}
+	if _, err := ri.Patch(ctx, p.Name, types.MergePatchType, body, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("patching %s: %w", p.ResourceRef, err)
+	}
+	if gvk, err := refGVK(p.ResourceRef); err == nil {
+		e.fence(gvk, p.Namespace, p.Name)
+	}
+	e.log.Info("trigger fired", "resource", p.ResourceRef.String())
+	return nil
+}
+
+// metadataTrigger sets and removes the labels and annotations of a
+// metadata trigger.
+func (e *Engine) metadataTrigger(ctx context.Context, m *scenario.MetadataTrigger) error {
+	ri, err := e.resourceFor(m.ResourceRef)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(m.MetadataPatch())
+	if err != nil {
+		return err
+	}
+	if err := e.waitForWebhooks(ctx, ri, m.Name, body); err != nil {
+		return fmt.Errorf("updating metadata of %s: %w", m.ResourceRef, err)
+	}
+	if _, err := ri.Patch(ctx, m.Name, types.MergePatchType, body, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("updating metadata of %s: %w", m.ResourceRef, err)
+	}
+	if gvk, err := refGVK(m.ResourceRef); err == nil {
+		e.fence(gvk, m.Namespace, m.Name)
+	}
+	e.log.Info("trigger updated metadata", "resource", m.ResourceRef.String())
+	return nil
+}
+
+// applyUnstructured creates obj, owned by the run anchor, or updates it by
+// name if it already exists, keeping its owners. Objects with metadata.generateName are always
+// created, and obj takes the name the API server generated.
+func (e *Engine) applyUnstructured(ctx context.Context, obj *unstructured.Unstructured) error {
+	ri, err := e.resourceInterface(obj.GroupVersionKind(), obj.GetNamespace())
+	if err != nil {
+		return err
+	}
+	owned := obj.DeepCopy()
+	if err := e.anchor.Own(ctx, owned); err != nil {
+		return err
+	}
+	created, err := ri.Create(ctx, owned, metav1.CreateOptions{})
+	if err == nil {
+		// Objects with metadata.generateName learn their name here.
+		obj.SetName(created.GetName())
+	}
+	// Objects with generateName are created anew on every apply; there is
+	// no name to update by.
+	if apierrors.IsAlreadyExists(err) && obj.GetName() != "" {
+		existing, getErr := ri.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if getErr != nil {
+			return getErr
+		}
+		update := obj.DeepCopy()
+		update.SetResourceVersion(existing.GetResourceVersion())
+		if err := e.anchor.OwnUpdate(ctx, update, existing); err != nil {
+			return err
+		}
+		_, err = ri.Update(ctx, update, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("applying %s %s: %w", obj.GetKind(), cmp.Or(obj.GetName(), obj.GetGenerateName()), err)
+	}
+	e.fence(obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName())
+	return nil
+}
+
+// resourceFor returns the dynamic client for the resource ref points at.
+func (e *Engine) resourceFor(ref scenario.ResourceRef) (dynamic.ResourceInterface, error) {
+	gvk, err := refGVK(ref)
+	if err != nil {
+		return nil, err
+	}
+	return e.resourceInterface(gvk, ref.Namespace)
+}
+
+// resourceInterface returns the dynamic client for gvk, scoped to namespace
+// for namespaced kinds.
+func (e *Engine) resourceInterface(gvk schema.GroupVersionKind, namespace string) (dynamic.ResourceInterface, error) {
+	gvr, ns, err := e.locate(gvk, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if ns == "" {
+		return e.dynamic.Resource(gvr), nil
+	}
+	return e.dynamic.Resource(gvr).Namespace(ns), nil
+}
+
+// locate maps gvk to its resource and returns the namespace to address it
+// in: empty for cluster-scoped kinds, "default" for namespaced kinds when
+// none is given.
+func (e *Engine) locate(gvk schema.GroupVersionKind, namespace string) (schema.GroupVersionResource, string, error) {
+	mapping, err := e.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return schema.GroupVersionResource{}, "", fmt.Errorf("mapping %s: %w", gvk, err)
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return mapping.Resource, "", nil
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+	return mapping.Resource, namespace, nil
+}
+
+// getObject reads the resource ref points at, from the informer cache when
+// available.
+func (e *Engine) getObject(ctx context.Context, ref scenario.ResourceRef) (*unstructured.Unstructured, error) {
+	gvk, err := refGVK(ref)
+	if err != nil {
+		return nil, err
+	}
+	gvr, ns, err := e.locate(gvk, ref.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	fenced := e.cache != nil && e.cache.isFenced(gvr, ns, ref.Name)
+	if e.cache != nil && !fenced {
+		obj, err := e.cache.get(ctx, gvr, ns, ref.Name)
+		if !errors.Is(err, errNotCached) {
+			return obj, err
+		}
+	}
+	ri := e.dynamic.Resource(gvr).Namespace(ns)
+	if ns == "" {
+		ri = e.dynamic.Resource(gvr)
+	}
+	obj, err := ri.Get(ctx, ref.Name, metav1.GetOptions{})
+	if err == nil && fenced {
+		e.cache.observe(ctx, gvr, ns, obj)
+	}
+	return obj, err
+}
+
+// fence marks an object written by the engine so expectation reads do not
+// trust the cache until it has caught up.
+func (e *Engine) fence(gvk schema.GroupVersionKind, namespace, name string) {
+	if e.cache == nil {
+		return
+	}
+	gvr, ns, err := e.locate(gvk, namespace)
+	if err != nil {
+		return
+	}
+	e.cache.fence(gvr, ns, name)
+}
+
+func refGVK(ref scenario.ResourceRef) (schema.GroupVersionKind, error) {
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return schema.GroupVersionKind{}, fmt.Errorf("%s: %w", ref, err)
+	}
+	return gv.WithKind(ref.Kind), nil
+}
+
+// decodeManifestFile decodes every object in a multi-document YAML file.
+func decodeManifestFile(path string) ([]*unstructured.Unstructured, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := decodeManifests(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, obj := range objs {
+		if err := envsubst.ExpandImages(obj.Object); err != nil {
+			return nil, fmt.Errorf("%s: %s %s: %w", path, obj.GetKind(), obj.GetName(), err)
+		}
+	}
+	return objs, nil
+}
+
+func decodeManifests(data []byte) ([]*unstructured.Unstructured, error) {
+	raws, err := scenario.DecodeObjects(data)
+	if err != nil {
+		return nil, err
+	}
+	objs := make([]*unstructured.Unstructured, 0, len(raws))
+	for _, raw := range raws {
+		obj := &unstructured.Unstructured{Object: raw}
+		if obj.GetKind() == "" || obj.GetAPIVersion() == "" {
+			return nil, fmt.Errorf("object %q is missing apiVersion or kind", obj.GetName())
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
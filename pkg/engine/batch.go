@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"context"
+	"slices"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// snapshot holds objects fetched with one LIST per resource and namespace
+// for a single poll cycle. Groups whose LIST failed are left out.
+type snapshot struct {
+	lists map[cacheKey]map[string]*unstructured.Unstructured
+}
+
+// fewNames is the most distinct objects of a resource and namespace
+// prefetch reads by name, with one LIST per object selecting it by
+// metadata.name, rather than by listing the whole namespace.
+const fewNames = 3
+
+// prefetch LISTs every resource and namespace that two or more expectations
+// read directly from the API server, so a poll cycle costs one request per
+// group rather than one per expectation. Groups of a few objects are listed
+// object by object with metadata.name field selectors instead, and only if
+// that saves requests. Expectations served by the informer cache are left
+// alone, as are groups in failed, which holds the groups whose LIST failed
+// earlier in the wait; prefetch adds those that fail to it.
+func (e *Engine) prefetch(ctx context.Context, exps []scenario.Expectation, failed map[cacheKey]bool) *snapshot {
+	counts := map[cacheKey]int{}
+	names := map[cacheKey][]string{}
+	for _, exp := range exps {
+		if exp.Resource.LabelSelector != nil {
+			continue
+		}
+		key, ok := e.directReadKey(exp.Resource)
+		if !ok || failed[key] {
+			continue
+		}
+		counts[key]++
+		if !slices.Contains(names[key], exp.Resource.Name) {
+			names[key] = append(names[key], exp.Resource.Name)
+		}
+	}
+
+	snap := &snapshot{
+		lists: map[cacheKey]map[string]*unstructured.Unstructured{},
+	}
+	for key, n := range counts {
+		if n < 2 {
+			continue
+		}
+		selectors := []string{""}
+		if len(names[key]) <= fewNames {
+			if len(names[key]) == n {
+				// As many LISTs as GETs.
+				continue
+			}
+			selectors = nil
+			for _, name := range names[key] {
+				selectors = append(selectors, fields.OneTermEqualSelector("metadata.name", name).String())
+			}
+		}
+		ri := e.dynamic.Resource(key.gvr).Namespace(key.namespace)
+		if key.namespace == "" {
+			ri = e.dynamic.Resource(key.gvr)
+		}
+		byName := map[string]*unstructured.Unstructured{}
+		for _, selector := range selectors {
+			list, err := ri.List(ctx, metav1.ListOptions{FieldSelector: selector})
+			if err != nil {
+				e.log.Debug("prefetch failed, reading objects one by one", "resource", key.gvr.String(), "namespace", key.namespace, "error", err)
+				failed[key] = true
+				byName = nil
+				break
+			}
+			for i := range list.Items {
+				byName[list.Items[i].GetName()] = &list.Items[i]
+			}
+		}
+		if byName != nil {
+			snap.lists[key] = byName
+		}
+	}
+	return snap
+}
+
+// directReadKey returns the resource and namespace of ref when reading it
+// would go to the API server rather than the informer cache.
+func (e *Engine) directReadKey(ref scenario.ResourceRef) (cacheKey, bool) {
+	gvk, err := refGVK(ref)
+	if err != nil {
+		return cacheKey{}, false
+	}
+	gvr, ns, err := e.locate(gvk, ref.Namespace)
+	if err != nil {
+		return cacheKey{}, false
+	}
+	if e.cache != nil && !e.cache.bypassed(gvr, ns, ref.Name) {
+		return cacheKey{}, false
+	}
+	return cacheKey{gvr: gvr, namespace: ns}, true
+}
+
+// readObject returns the object ref points at, from snap when its group was
+// prefetched and through getObject otherwise, including when the prefetch
+// failed: LIST may be forbidden where GET is allowed, as under namespaced
+// RBAC or impersonation.
+func (e *Engine) readObject(ctx context.Context, snap *snapshot, ref scenario.ResourceRef) (*unstructured.Unstructured, error) {
+	key, ok := e.directReadKey(ref)
+	if !ok || snap == nil {
+		return e.getObject(ctx, ref)
+	}
+	objs, listed := snap.lists[key]
+	if !listed {
+		return e.getObject(ctx, ref)
+	}
+	obj, found := objs[ref.Name]
+	if !found {
+		return nil, apierrors.NewNotFound(key.gvr.GroupResource(), ref.Name)
+	}
+	if e.cache != nil {
+		e.cache.observe(ctx, key.gvr, key.namespace, obj)
+	}
+	return obj, nil
+}
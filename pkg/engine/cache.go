@@ -0,0 +1,235 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/diagnostics"
+)
+
+const cacheSyncTimeout = 30 * time.Second
+
+// failedRetry is how long reads of a resource whose informer failed to
+// sync go to the API server before an informer is tried again.
+const failedRetry = 5 * time.Minute
+
+// errNotCached is returned when an informer could not sync, e.g. because
+// watching the resource is forbidden. Callers fall back to direct reads.
+var errNotCached = errors.New("resource not cached")
+
+// objectCache serves reads from informers shared by every expectation on the
+// same resource and namespace, so polling does not cost one GET per
+// expectation per tick. Informers are started on first use and run until
+// the cache is closed; those that fail to sync are stopped at once.
+type objectCache struct {
+	client dynamic.Interface
+	opts   InformerOptions
+
+	mu        sync.Mutex
+	informers map[cacheKey]*cachedInformer
+	// failed holds when the informers that failed to sync did.
+	failed map[cacheKey]time.Time
+	// fenced holds objects the engine wrote that the cache may not have
+	// observed yet. Reads of them go to the API server until the cached
+	// copy matches a live read, so a lagging watch cannot serve the
+	// pre-trigger state.
+	fenced map[objectKey]bool
+	// history holds the last watchHistory events of each watched object
+	// that a running scenario may still report.
+	history map[objectKey][]diagnostics.WatchEvent
+	// running holds the start times of the scenarios running.
+	running []time.Time
+	// stop is closed when the cache is.
+	stop chan struct{}
+}
+
+// cachedInformer is a running informer and the channel that stops it.
+type cachedInformer struct {
+	informer informers.GenericInformer
+	stop     chan struct{}
+}
+
+type cacheKey struct {
+	gvr       schema.GroupVersionResource
+	namespace string
+}
+
+type objectKey struct {
+	cacheKey
+	name string
+}
+
+// InformerOptions tunes the watches behind the informer cache. The
+// defaults suit long soak scenarios: no periodic resync, and bookmarks on so
+// a re-established watch resumes from a recent resourceVersion instead of
+// falling back to a full relist.
+type InformerOptions struct {
+	// Resync replays every cached object to handlers at this interval. It
+	// does not contact the API server, but is rarely useful for assertions;
+	// zero disables it.
+	Resync time.Duration
+	// DisableBookmarks stops requesting watch bookmarks. Only useful
+	// against API servers that mishandle them.
+	DisableBookmarks bool
+}
+
+func newObjectCache(client dynamic.Interface, opts InformerOptions) *objectCache {
+	return &objectCache{
+		client:    client,
+		opts:      opts,
+		informers: map[cacheKey]*cachedInformer{},
+		failed:    map[cacheKey]time.Time{},
+		fenced:    map[objectKey]bool{},
+		history:   map[objectKey][]diagnostics.WatchEvent{},
+		stop:      make(chan struct{}),
+	}
+}
+
+// get returns the named object from the cache, starting and syncing an
+// informer for the resource and namespace if needed. A missing object is
+// reported as a NotFound API error, like a GET would.
+func (c *objectCache) get(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string) (*unstructured.Unstructured, error) {
+	informer, err := c.informer(ctx, gvr, namespace)
+	if err != nil {
+		return nil, err
+	}
+	lister := informer.Lister()
+	var obj any
+	if namespace == "" {
+		obj, err = lister.Get(name)
+	} else {
+		obj, err = lister.ByNamespace(namespace).Get(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected cached type %T", obj)
+	}
+	return u, nil
+}
+
+// fence marks an object as written by the engine.
+func (c *objectCache) fence(gvr schema.GroupVersionResource, namespace, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fenced[objectKey{cacheKey{gvr, namespace}, name}] = true
+}
+
+// isFenced reports whether reads of the object must bypass the cache.
+func (c *objectCache) isFenced(gvr schema.GroupVersionResource, namespace, name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fenced[objectKey{cacheKey{gvr, namespace}, name}]
+}
+
+// bypassed reports whether reads of the object go to the API server: it
+// is fenced, or its informer failed to sync.
+func (c *objectCache) bypassed(gvr schema.GroupVersionResource, namespace, name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := cacheKey{gvr, namespace}
+	return c.failedRecently(key) || c.fenced[objectKey{key, name}]
+}
+
+// observe lifts the fence on live once the cache holds the same version.
+func (c *objectCache) observe(ctx context.Context, gvr schema.GroupVersionResource, namespace string, live *unstructured.Unstructured) {
+	cached, err := c.get(ctx, gvr, namespace, live.GetName())
+	if err != nil || cached.GetResourceVersion() != live.GetResourceVersion() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.fenced, objectKey{cacheKey{gvr, namespace}, live.GetName()})
+}
+
+func (c *objectCache) informer(ctx context.Context, gvr schema.GroupVersionResource, namespace string) (informers.GenericInformer, error) {
+	key := cacheKey{gvr: gvr, namespace: namespace}
+
+	c.mu.Lock()
+	if c.failedRecently(key) {
+		c.mu.Unlock()
+		return nil, errNotCached
+	}
+	delete(c.failed, key)
+	ci, ok := c.informers[key]
+	if !ok {
+		select {
+		case <-c.stop:
+			c.mu.Unlock()
+			return nil, errNotCached
+		default:
+		}
+		informer := dynamicinformer.NewFilteredDynamicInformer(c.client, gvr, namespace, c.opts.Resync,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, c.tweakListOptions)
+		if _, err := informer.Informer().AddEventHandler(c.recorder(key)); err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+		ci = &cachedInformer{informer: informer, stop: make(chan struct{})}
+		c.informers[key] = ci
+		go informer.Informer().Run(ci.stop)
+	}
+	c.mu.Unlock()
+
+	syncCtx, cancel := context.WithTimeout(ctx, cacheSyncTimeout)
+	defer cancel()
+	if !cache.WaitForCacheSync(syncCtx.Done(), ci.informer.Informer().HasSynced) {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// Stop the informer rather than let it retry its list and watch
+		// for the engine's lifetime; a later read after failedRetry
+		// starts a new one, which succeeds once, say, the resource's CRD
+		// is installed.
+		c.mu.Lock()
+		if c.informers[key] == ci {
+			delete(c.informers, key)
+			close(ci.stop)
+			c.failed[key] = time.Now()
+		}
+		c.mu.Unlock()
+		return nil, errNotCached
+	}
+	return ci.informer, nil
+}
+
+// failedRecently reports whether the informer of key failed to sync less
+// than failedRetry ago. c.mu must be held.
+func (c *objectCache) failedRecently(key cacheKey) bool {
+	at, ok := c.failed[key]
+	return ok && time.Since(at) < failedRetry
+}
+
+// tweakListOptions applies to both the informers' lists and watches;
+// AllowWatchBookmarks is ignored by the API server on lists.
+func (c *objectCache) tweakListOptions(opts *metav1.ListOptions) {
+	opts.AllowWatchBookmarks = !c.opts.DisableBookmarks
+}
+
+// close stops all informers.
+func (c *objectCache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.stop:
+	default:
+		close(c.stop)
+		for key, ci := range c.informers {
+			close(ci.stop)
+			delete(c.informers, key)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+var configMaps = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+func TestObjectCacheGet(t *testing.T) {
+	cm := &unstructured.Unstructured{}
+	cm.SetAPIVersion("v1")
+	cm.SetKind("ConfigMap")
+	cm.SetName("app")
+	cm.SetNamespace("default")
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{configMaps: "ConfigMapList"}, cm)
+	c := newObjectCache(client, InformerOptions{})
+	defer c.close()
+
+	got, err := c.get(context.Background(), configMaps, "default", "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GetName() != "app" {
+		t.Errorf("get() = %s, want app", got.GetName())
+	}
+	if _, err := c.get(context.Background(), configMaps, "default", "missing"); !apierrors.IsNotFound(err) {
+		t.Errorf("get() of a missing object: error = %v, want not found", err)
+	}
+}
+
+func TestObjectCacheFailedInformer(t *testing.T) {
+	c := newObjectCache(nil, InformerOptions{})
+	defer c.close()
+	key := cacheKey{configMaps, "default"}
+	c.failed[key] = time.Now()
+	if _, err := c.informer(context.Background(), configMaps, "default"); !errors.Is(err, errNotCached) {
+		t.Errorf("informer() after a recent failure: error = %v, want errNotCached", err)
+	}
+	if !c.bypassed(configMaps, "default", "app") {
+		t.Error("reads of a resource whose informer just failed are not bypassed")
+	}
+
+	// The failure expires.
+	c.failed[key] = time.Now().Add(-failedRetry)
+	if c.bypassed(configMaps, "default", "app") {
+		t.Error("reads are still bypassed once the failure expired")
+	}
+}
@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// chaosRun tracks a chaos action running alongside the expectation wait.
+type chaosRun struct {
+	done chan struct{}
+	// err is set before done is closed.
+	err error
+}
+
+// startChaos runs the scenario's chaos action in the background, or returns
+// nil when it has none.
+func (e *Engine) startChaos(ctx context.Context, s *scenario.Scenario) *chaosRun {
+	var c *scenario.Chaos
+	for _, t := range s.Trigger.Triggers() {
+		if t.Chaos != nil {
+			c = t.Chaos
+		}
+	}
+	if c == nil {
+		return nil
+	}
+	run := &chaosRun{done: make(chan struct{})}
+	go func() {
+		defer close(run.done)
+		if e.agents == nil {
+			run.err = errors.New("disrupting agents needs an agent manager")
+			return
+		}
+		if run.err = sleep(ctx, c.Delay()); run.err != nil {
+			return
+		}
+		switch {
+		case c.KillAgentPod != "":
+			pod, err := e.agents.KillPod(ctx, c.KillAgentPod)
+			if err != nil {
+				run.err = err
+				return
+			}
+			e.log.Info("chaos: killed agent pod", "agent", c.KillAgentPod, "pod", pod)
+		case c.PartitionAgent != "":
+			run.err = e.partition(ctx, c.PartitionAgent, c.PartitionOrDefault())
+		}
+	}()
+	return run
+}
+
+// partition isolates the agent for d. The partition is healed even when ctx
+// ends first, so it never outlives the scenario.
+func (e *Engine) partition(ctx context.Context, agent string, d time.Duration) error {
+	if err := e.agents.Isolate(ctx, agent); err != nil {
+		return err
+	}
+	e.log.Info("chaos: agent partitioned", "agent", agent, "for", d)
+	waitErr := sleep(ctx, d)
+
+	healCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+	if err := e.agents.Reconnect(healCtx, agent); err != nil {
+		return err
+	}
+	e.log.Info("chaos: agent reconnected", "agent", agent)
+	return waitErr
+}
+
+// happened reports whether the action is over, and its error.
+func (r *chaosRun) happened() (bool, error) {
+	if r == nil {
+		return true, nil
+	}
+	select {
+	case <-r.done:
+		return true, r.err
+	default:
+		return false, nil
+	}
+}
+
+// wait blocks until the action is over.
+func (r *chaosRun) wait() {
+	if r != nil {
+		<-r.done
+	}
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,318 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// ChurnCount is how often a resource selected by a churn limit changed.
+type ChurnCount struct {
+	// Resource names the resource as Kind namespace/name.
+	Resource string
+	Creates  int
+	// Updates does not count updates that only change status or the
+	// metadata the API server and garbage collector maintain; see
+	// churnIgnored.
+	Updates int
+	Deletes int
+}
+
+// churnRecorder counts the changes to the resources the churn limits of a
+// scenario select, and checks the moves of their bounded fields, through
+// informers of its own so it works with the informer cache off.
+type churnRecorder struct {
+	limits []scenario.ChurnLimit
+	// fields holds the parsed paths of each limit's field bounds.
+	fields [][]fieldPath
+	stopCh chan struct{}
+
+	mu sync.Mutex
+	// counts holds the counts of each limit by resource.
+	counts []map[string]*ChurnCount
+	// last holds the last value of each bounded field of each limit by
+	// resource, and violations the first violation of each bound by
+	// resource and path.
+	last       []map[string][]*float64
+	violations map[string]error
+}
+
+// recordChurn starts counting the changes to the resources the churn
+// limits of s select. Resources that exist when it starts are not counted
+// as created.
+func (e *Engine) recordChurn(ctx context.Context, s *scenario.Scenario) (*churnRecorder, error) {
+	r := &churnRecorder{limits: s.Churn, stopCh: make(chan struct{}), violations: map[string]error{}}
+	if len(s.Churn) == 0 {
+		return r, nil
+	}
+	var synced []cache.InformerSynced
+	for i, l := range s.Churn {
+		var paths []fieldPath
+		for j, f := range l.Fields {
+			p, err := parsePath(f.Path)
+			if err != nil {
+				r.stop()
+				return nil, fmt.Errorf("churn[%d].fields[%d]: %w", i, j, err)
+			}
+			paths = append(paths, p)
+		}
+		r.fields = append(r.fields, paths)
+		r.last = append(r.last, map[string][]*float64{})
+		gv, err := schema.ParseGroupVersion(l.Resources.APIVersion)
+		if err != nil {
+			r.stop()
+			return nil, fmt.Errorf("churn[%d]: %w", i, err)
+		}
+		gvr, ns, err := e.locate(gv.WithKind(l.Resources.Kind), l.Resources.Namespace)
+		if err != nil {
+			r.stop()
+			return nil, fmt.Errorf("churn[%d]: %w", i, err)
+		}
+		var selector string
+		if l.Resources.Selector != nil {
+			sel, err := metav1.LabelSelectorAsSelector(l.Resources.Selector)
+			if err != nil {
+				r.stop()
+				return nil, fmt.Errorf("churn[%d]: %w", i, err)
+			}
+			selector = sel.String()
+		}
+		factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(e.dynamic, 0, ns, func(opts *metav1.ListOptions) {
+			opts.LabelSelector = selector
+		})
+		informer := factory.ForResource(gvr).Informer()
+		r.counts = append(r.counts, map[string]*ChurnCount{})
+		reg, err := informer.AddEventHandler(r.handler(i))
+		if err != nil {
+			r.stop()
+			return nil, fmt.Errorf("churn[%d]: %w", i, err)
+		}
+		synced = append(synced, reg.HasSynced)
+		factory.Start(r.stopCh)
+	}
+	syncCtx, cancel := context.WithTimeout(ctx, cacheSyncTimeout)
+	defer cancel()
+	if !cache.WaitForCacheSync(syncCtx.Done(), synced...) {
+		r.stop()
+		return nil, errors.New("churn: watches did not sync")
+	}
+	return r, nil
+}
+
+// handler counts the changes of the resources limit i selects and checks
+// their bounded fields.
+func (r *churnRecorder) handler(i int) cache.ResourceEventHandler {
+	count := func(obj any, add func(c *ChurnCount)) {
+		if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = d.Obj
+		}
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return
+		}
+		resource := fmt.Sprintf("%s %s", u.GetKind(), objectName(u))
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		c := r.counts[i][resource]
+		if c == nil {
+			c = &ChurnCount{Resource: resource}
+			r.counts[i][resource] = c
+		}
+		add(c)
+	}
+	return cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj any, isInInitialList bool) {
+			if u, ok := obj.(*unstructured.Unstructured); ok {
+				r.observe(i, u)
+			}
+			if !isInInitialList {
+				count(obj, func(c *ChurnCount) { c.Creates++ })
+			}
+		},
+		UpdateFunc: func(oldObj, newObj any) {
+			old, _ := oldObj.(*unstructured.Unstructured)
+			u, ok := newObj.(*unstructured.Unstructured)
+			if !ok || old == nil || old.GetResourceVersion() == u.GetResourceVersion() {
+				return
+			}
+			r.observe(i, u)
+			if !churned(old, u) {
+				return
+			}
+			count(u, func(c *ChurnCount) { c.Updates++ })
+		},
+		DeleteFunc: func(obj any) {
+			count(obj, func(c *ChurnCount) {
+				// A resource created again starts afresh.
+				delete(r.last[i], c.Resource)
+				c.Deletes++
+			})
+		},
+	}
+}
+
+// churnIgnored are the fields whose changes do not count as updates:
+// status, which controllers update on their own, and metadata the API
+// server and garbage collector maintain.
+var churnIgnored = [][]string{
+	{"status"},
+	{"metadata", "resourceVersion"},
+	{"metadata", "generation"},
+	{"metadata", "managedFields"},
+	{"metadata", "finalizers"},
+	{"metadata", "ownerReferences"},
+}
+
+// churned reports whether u changed from old outside churnIgnored, in its
+// spec, data, labels, annotations or any other field.
+func churned(old, u *unstructured.Unstructured) bool {
+	a, b := old.DeepCopy(), u.DeepCopy()
+	for _, path := range churnIgnored {
+		unstructured.RemoveNestedField(a.Object, path...)
+		unstructured.RemoveNestedField(b.Object, path...)
+	}
+	return !reflect.DeepEqual(a.Object, b.Object)
+}
+
+// observe checks the bounded fields of limit i on u, a new state of a
+// resource it selects.
+func (r *churnRecorder) observe(i int, u *unstructured.Unstructured) {
+	if len(r.fields[i]) == 0 {
+		return
+	}
+	resource := fmt.Sprintf("%s %s", u.GetKind(), objectName(u))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	last := r.last[i][resource]
+	if last == nil {
+		last = make([]*float64, len(r.fields[i]))
+		r.last[i][resource] = last
+	}
+	for j, p := range r.fields[i] {
+		f := r.limits[i].Fields[j]
+		key := fmt.Sprintf("%s %s", resource, f.Path)
+		raw, ok := p.lookup(u.Object)
+		if !ok {
+			continue
+		}
+		v, err := numericValue(raw)
+		if err != nil {
+			r.violate(key, fmt.Errorf("%s of %s: %w", f.Path, resource, err))
+			continue
+		}
+		if err := checkBound(f, last[j], v); err != nil {
+			r.violate(key, fmt.Errorf("%s of %s %w", f.Path, resource, err))
+		}
+		last[j] = &v
+	}
+}
+
+// violate records err for key unless an earlier violation was.
+func (r *churnRecorder) violate(key string, err error) {
+	if _, ok := r.violations[key]; !ok {
+		r.violations[key] = err
+	}
+}
+
+// checkBound checks v, the value a field moved to from last (nil for its
+// first value), against f.
+func checkBound(f scenario.FieldBound, last *float64, v float64) error {
+	switch {
+	case f.Min != nil && v < *f.Min:
+		return fmt.Errorf("was %v, below the minimum of %v", v, *f.Min)
+	case f.Max != nil && v > *f.Max:
+		return fmt.Errorf("was %v, above the maximum of %v", v, *f.Max)
+	case last == nil:
+		return nil
+	case f.Never == "increase" && v > *last:
+		return fmt.Errorf("increased from %v to %v", *last, v)
+	case f.Never == "decrease" && v < *last:
+		return fmt.Errorf("decreased from %v to %v", *last, v)
+	case f.MaxStep != nil && math.Abs(v-*last) > *f.MaxStep:
+		return fmt.Errorf("moved from %v to %v, more than the %v allowed in one change", *last, v, *f.MaxStep)
+	}
+	return nil
+}
+
+// numericValue returns the value of a number or quantity field.
+func numericValue(v any) (float64, error) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		q, err := resource.ParseQuantity(v)
+		if err != nil {
+			return 0, fmt.Errorf("%q is neither a number nor a quantity", v)
+		}
+		return q.AsApproximateFloat64(), nil
+	}
+	return 0, fmt.Errorf("%v is not a number", v)
+}
+
+// stop stops the watches and returns the counts, merged across limits.
+func (r *churnRecorder) stop() []ChurnCount {
+	select {
+	case <-r.stopCh:
+	default:
+		close(r.stopCh)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	merged := map[string]ChurnCount{}
+	for _, counts := range r.counts {
+		for resource, c := range counts {
+			merged[resource] = *c
+		}
+	}
+	var out []ChurnCount
+	for _, resource := range slices.Sorted(maps.Keys(merged)) {
+		out = append(out, merged[resource])
+	}
+	return out
+}
+
+// verify fails for each resource that changed more often than its limit
+// allows, and for each bounded field that moved out of its bounds.
+func (r *churnRecorder) verify() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for i, l := range r.limits {
+		counts := r.counts[i]
+		for _, resource := range slices.Sorted(maps.Keys(counts)) {
+			c := counts[resource]
+			for _, check := range []struct {
+				verb string
+				n    int
+				max  *int
+			}{{"created", c.Creates, l.MaxCreates}, {"updated", c.Updates, l.MaxUpdates}, {"deleted", c.Deletes, l.MaxDeletes}} {
+				if check.max != nil && check.n > *check.max {
+					errs = append(errs, fmt.Errorf("%s was %s %d times, at most %d allowed", resource, check.verb, check.n, *check.max))
+				}
+			}
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(r.violations)) {
+		errs = append(errs, r.violations[key])
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("churn:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
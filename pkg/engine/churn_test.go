@@ -0,0 +1,185 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func TestCheckBound(t *testing.T) {
+	tests := []struct {
+		name  string
+		bound scenario.FieldBound
+		last  *float64
+		v     float64
+		err   string
+	}{
+		{name: "within min and max", bound: scenario.FieldBound{Min: ptr(1.0), Max: ptr(10.0)}, v: 10},
+		{name: "below min", bound: scenario.FieldBound{Min: ptr(1.0)}, v: 0, err: "was 0, below the minimum of 1"},
+		{name: "above max", bound: scenario.FieldBound{Max: ptr(10.0)}, last: ptr(10.0), v: 11, err: "was 11, above the maximum of 10"},
+		{name: "first value never moves", bound: scenario.FieldBound{Never: "decrease", MaxStep: ptr(1.0)}, v: 100},
+		{name: "increase", bound: scenario.FieldBound{Never: "increase"}, last: ptr(2.0), v: 3, err: "increased from 2 to 3"},
+		{name: "no increase", bound: scenario.FieldBound{Never: "increase"}, last: ptr(2.0), v: 1},
+		{name: "decrease", bound: scenario.FieldBound{Never: "decrease"}, last: ptr(2.0), v: 1, err: "decreased from 2 to 1"},
+		{name: "unchanged", bound: scenario.FieldBound{Never: "decrease"}, last: ptr(2.0), v: 2},
+		{name: "step up to the limit", bound: scenario.FieldBound{MaxStep: ptr(2.0)}, last: ptr(5.0), v: 3},
+		{name: "step too far down", bound: scenario.FieldBound{MaxStep: ptr(2.0)}, last: ptr(5.0), v: 2, err: "moved from 5 to 2, more than the 2 allowed in one change"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkBound(tt.bound, tt.last, tt.v)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("checkBound() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("checkBound() = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNumericValue(t *testing.T) {
+	tests := []struct {
+		v    any
+		want float64
+		err  string
+	}{
+		{v: int64(3), want: 3},
+		{v: 2.5, want: 2.5},
+		{v: "500m", want: 0.5},
+		{v: "1Gi", want: 1 << 30},
+		{v: "many", err: `"many" is neither a number nor a quantity`},
+		{v: true, err: "true is not a number"},
+	}
+	for _, tt := range tests {
+		got, err := numericValue(tt.v)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("numericValue(%v) error = %v, want %q", tt.v, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("numericValue(%v) = %v, %v, want %v", tt.v, got, err, tt.want)
+		}
+	}
+}
+
+func TestChurnObserve(t *testing.T) {
+	path, err := parsePath(".spec.replicas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &churnRecorder{
+		limits: []scenario.ChurnLimit{{Fields: []scenario.FieldBound{
+			{Path: ".spec.replicas", Max: ptr(5.0), Never: "decrease"},
+		}}},
+		fields:     [][]fieldPath{{path}},
+		last:       []map[string][]*float64{{}},
+		counts:     []map[string]*ChurnCount{{}},
+		violations: map[string]error{},
+	}
+	deployment := func(name string, replicas any) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{Object: map[string]any{"spec": map[string]any{}}}
+		u.SetKind("Deployment")
+		u.SetNamespace("test")
+		u.SetName(name)
+		if replicas != nil {
+			u.Object["spec"].(map[string]any)["replicas"] = replicas
+		}
+		return u
+	}
+	for _, u := range []*unstructured.Unstructured{
+		deployment("web", int64(2)),
+		deployment("web", nil),
+		deployment("web", int64(3)),
+		deployment("web", int64(1)),
+		deployment("web", int64(0)),
+		deployment("db", int64(1)),
+		deployment("db", int64(6)),
+		deployment("cache", "lots"),
+	} {
+		r.observe(0, u)
+	}
+	err = r.verify()
+	if err == nil {
+		t.Fatal("verify() = nil, want violations")
+	}
+	// Only the first violation of each field is kept, and a missing field
+	// neither fails nor resets the last value.
+	want := []string{
+		`.spec.replicas of Deployment test/cache: "lots" is neither a number nor a quantity`,
+		".spec.replicas of Deployment test/db was 6, above the maximum of 5",
+		".spec.replicas of Deployment test/web decreased from 3 to 1",
+	}
+	if got := strings.Split(err.Error(), "\n")[1:]; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("verify() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestChurnHandler(t *testing.T) {
+	r := &churnRecorder{
+		limits:     []scenario.ChurnLimit{{MaxUpdates: ptr(1), MaxCreates: ptr(0)}},
+		fields:     [][]fieldPath{nil},
+		stopCh:     make(chan struct{}),
+		last:       []map[string][]*float64{{}},
+		counts:     []map[string]*ChurnCount{{}},
+		violations: map[string]error{},
+	}
+	h := r.handler(0)
+	rv := 0
+	next := func(u *unstructured.Unstructured, change func(u *unstructured.Unstructured)) *unstructured.Unstructured {
+		u = u.DeepCopy()
+		change(u)
+		rv++
+		u.SetResourceVersion(fmt.Sprint(rv))
+		return u
+	}
+	cm := &unstructured.Unstructured{Object: map[string]any{"data": map[string]any{"value": "1"}}}
+	cm.SetKind("ConfigMap")
+	cm.SetNamespace("test")
+	cm.SetName("app")
+	h.OnAdd(cm, true)
+
+	updates := []func(u *unstructured.Unstructured){
+		func(u *unstructured.Unstructured) { u.Object["status"] = map[string]any{"ready": true} },
+		func(u *unstructured.Unstructured) { u.SetFinalizers([]string{"example.com/cleanup"}) },
+		func(u *unstructured.Unstructured) { u.SetOwnerReferences([]metav1.OwnerReference{{Name: "owner"}}) },
+		func(u *unstructured.Unstructured) {
+			u.SetManagedFields([]metav1.ManagedFieldsEntry{{Manager: "agent"}})
+		},
+		func(u *unstructured.Unstructured) { u.Object["data"] = map[string]any{"value": "2"} },
+		func(u *unstructured.Unstructured) { u.SetLabels(map[string]string{"tier": "web"}) },
+	}
+	old := cm
+	for _, change := range updates {
+		u := next(old, change)
+		h.OnUpdate(old, u)
+		old = u
+	}
+	// A resync delivers the same resource version again.
+	h.OnUpdate(old, old)
+	h.OnDelete(old)
+	h.OnAdd(cm, false)
+
+	want := []ChurnCount{{Resource: "ConfigMap test/app", Creates: 1, Updates: 2, Deletes: 1}}
+	if got := r.stop(); !reflect.DeepEqual(got, want) {
+		t.Errorf("stop() = %+v, want %+v", got, want)
+	}
+	err := r.verify()
+	wantErr := "churn:\nConfigMap test/app was created 1 times, at most 0 allowed\nConfigMap test/app was updated 2 times, at most 1 allowed"
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("verify() = %v, want %q", err, wantErr)
+	}
+}
@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/agent"
+	"github.com/aslakknutsen/kube-agents-test/pkg/fakeclock"
+)
+
+var (
+	configMapResource = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	namespaceResource = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+)
+
+// clockRef is the value of fakeclock.EnvVar given to deployed agents.
+const clockRef = agent.Namespace + "/" + fakeclock.DefaultName
+
+func (e *Engine) clockMaps() dynamic.ResourceInterface {
+	return e.dynamic.Resource(configMapResource).Namespace(agent.Namespace)
+}
+
+// resetClock sets the fake clock offset back to zero, creating the clock
+// ConfigMap if needed, so every scenario starts at real time.
+func (e *Engine) resetClock(ctx context.Context) error {
+	return e.setClock(ctx, 0)
+}
+
+// advanceClock moves the fake clock forward by d.
+func (e *Engine) advanceClock(ctx context.Context, d time.Duration) error {
+	cm, err := e.clockMaps().Get(ctx, fakeclock.DefaultName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("reading fake clock: %w", err)
+	}
+	var offset time.Duration
+	if err == nil {
+		current, _, _ := unstructured.NestedString(cm.Object, "data", fakeclock.OffsetKey)
+		if offset, err = fakeclock.ParseOffset(current); err != nil {
+			return err
+		}
+	}
+	if err := e.setClock(ctx, offset+d); err != nil {
+		return err
+	}
+	e.log.Info("fake clock advanced", "by", d, "offset", offset+d)
+	return nil
+}
+
+func (e *Engine) setClock(ctx context.Context, offset time.Duration) error {
+	cm := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]any{"name": fakeclock.DefaultName, "namespace": agent.Namespace},
+		"data":       map[string]any{fakeclock.OffsetKey: offset.String()},
+	}}
+	owned := cm.DeepCopy()
+	if err := e.anchor.Own(ctx, owned); err != nil {
+		return err
+	}
+	maps := e.clockMaps()
+	_, err := maps.Create(ctx, owned, metav1.CreateOptions{})
+	if apierrors.IsNotFound(err) {
+		// The agent namespace does not exist yet.
+		ns := &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]any{"name": agent.Namespace},
+		}}
+		if err := e.anchor.Own(ctx, ns); err != nil {
+			return err
+		}
+		_, err = e.dynamic.Resource(namespaceResource).Create(ctx, ns, metav1.CreateOptions{})
+		if err == nil || apierrors.IsAlreadyExists(err) {
+			_, err = maps.Create(ctx, owned, metav1.CreateOptions{})
+		}
+	}
+	if apierrors.IsAlreadyExists(err) {
+		var existing *unstructured.Unstructured
+		if existing, err = maps.Get(ctx, fakeclock.DefaultName, metav1.GetOptions{}); err == nil {
+			update := cm.DeepCopy()
+			update.SetResourceVersion(existing.GetResourceVersion())
+			if err = e.anchor.OwnUpdate(ctx, update, existing); err == nil {
+				_, err = maps.Update(ctx, update, metav1.UpdateOptions{})
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("setting fake clock: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package engine
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/diagnostics"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// EndState is the state a resource an expectation names was left in.
+type EndState struct {
+	// Resource names the resource, or the resources a label selector
+	// matches.
+	Resource string
+	// Selected is set for the resources of a label selector.
+	Selected bool
+	// Objects holds the resource, or the resources matching, by name,
+	// without the fields that change from run to run such as its UID;
+	// empty if none exists.
+	Objects []map[string]any
+}
+
+// runFields differ between two runs even when the agents behave the same:
+// where pods were scheduled and when their containers started.
+var runFields = []string{
+	".spec.nodeName",
+	".status.hostIP",
+	".status.hostIPs",
+	".status.podIP",
+	".status.podIPs",
+	".status.startTime",
+	".status.containerStatuses",
+	".status.initContainerStatuses",
+}
+
+// endStates reads the resources the expectations of s name, steps
+// included. Resources that cannot be read are left out.
+func (e *Engine) endStates(ctx context.Context, s *scenario.Scenario) []EndState {
+	cs, err := e.compiled(s)
+	if err != nil {
+		return nil
+	}
+	expect := slices.Clone(cs.scenario.Expect)
+	for _, st := range cs.scenario.Steps {
+		expect = append(expect, st.Expect...)
+	}
+	var states []EndState
+	seen := map[string]bool{}
+	for _, exp := range expect {
+		ref := exp.Resource
+		if seen[ref.String()] {
+			continue
+		}
+		seen[ref.String()] = true
+		state := EndState{Resource: ref.String(), Selected: ref.LabelSelector != nil}
+		var objs []unstructured.Unstructured
+		if ref.LabelSelector != nil {
+			objs, err = e.listMatching(ctx, ref)
+		} else {
+			var obj *unstructured.Unstructured
+			if obj, err = e.getObject(ctx, ref); err == nil {
+				objs = append(objs, *obj)
+			} else if apierrors.IsNotFound(err) {
+				err = nil
+			}
+		}
+		if err != nil {
+			e.log.Info("reading end state", "scenario", s.Name, "resource", ref.String(), "error", err)
+			continue
+		}
+		slices.SortFunc(objs, func(a, b unstructured.Unstructured) int { return cmp.Compare(a.GetName(), b.GetName()) })
+		for _, obj := range objs {
+			o := obj.DeepCopy().Object
+			_ = stripVolatile(o, runFields)
+			state.Objects = append(state.Objects, o)
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+// Comparison is how a scenario behaved in two runs, such as against two
+// builds of its agents: a baseline and a candidate.
+type Comparison struct {
+	Scenario string
+	// Baseline and Candidate are the outcomes of the runs.
+	Baseline, Candidate Outcome
+	// States are the differences between the end states of the runs,
+	// Expected holding the baseline's value and Actual the candidate's.
+	States []diagnostics.Diff
+	// Metrics compares the timings and counts of the runs.
+	Metrics []MetricComparison
+}
+
+// Outcome is whether a run passed, and why not.
+type Outcome struct {
+	Passed bool
+	Error  string
+}
+
+// MetricComparison is a timing or count of both runs.
+type MetricComparison struct {
+	Name                string
+	Baseline, Candidate float64
+	// Unit is "s" for durations, in seconds, and empty for counts.
+	Unit string
+}
+
+// Changed reports whether the runs had different outcomes or left
+// different end states.
+func (c *Comparison) Changed() bool {
+	return c.Baseline.Passed != c.Candidate.Passed || len(c.States) > 0
+}
+
+// Compare compares the results of two runs of a scenario made with
+// WithEndStates, leaving out of the end states the fields at the ignore
+// paths, such as .status.replicas.
+func Compare(baseline, candidate *Result, ignore ...string) (*Comparison, error) {
+	c := &Comparison{
+		Scenario:  baseline.Scenario,
+		Baseline:  Outcome{Passed: baseline.Passed, Error: baseline.Error},
+		Candidate: Outcome{Passed: candidate.Passed, Error: candidate.Error},
+	}
+	var paths []fieldPath
+	for _, p := range ignore {
+		fp, err := parsePath(p)
+		if err != nil {
+			return nil, fmt.Errorf("ignore: %w", err)
+		}
+		paths = append(paths, fp)
+	}
+	states := map[string]EndState{}
+	for _, s := range candidate.EndStates {
+		states[s.Resource] = s
+	}
+	for _, b := range baseline.EndStates {
+		cand, ok := states[b.Resource]
+		if !ok {
+			continue
+		}
+		c.States = append(c.States, compareEndStates(b, cand, paths)...)
+	}
+	c.Metrics = compareMetrics(baseline, candidate)
+	return c, nil
+}
+
+// compareEndStates diffs the objects of two end states of a resource.
+// Objects a label selector matches compare in order of name without their
+// names, which pods and other generated resources do not share across runs.
+func compareEndStates(baseline, candidate EndState, ignore []fieldPath) []diagnostics.Diff {
+	if len(baseline.Objects) != len(candidate.Objects) {
+		return []diagnostics.Diff{{Resource: baseline.Resource, Path: "count", Expected: len(baseline.Objects), Actual: len(candidate.Objects)}}
+	}
+	var diffs []diagnostics.Diff
+	for i := range baseline.Objects {
+		b, c := normalize(baseline.Objects[i], ignore, baseline.Selected), normalize(candidate.Objects[i], ignore, baseline.Selected)
+		path := ""
+		if baseline.Selected {
+			path = fmt.Sprintf("[%d]", i)
+		}
+		diffs = append(diffs, diffObjects(baseline.Resource, path, b, c)...)
+	}
+	return diffs
+}
+
+// normalize returns a copy of obj without the ignored fields, the UIDs of
+// its owners, and, if unnamed, its name.
+func normalize(obj map[string]any, ignore []fieldPath, unnamed bool) map[string]any {
+	o := (&unstructured.Unstructured{Object: obj}).DeepCopy()
+	for _, p := range ignore {
+		p.remove(o.Object)
+	}
+	owners := o.GetOwnerReferences()
+	for i := range owners {
+		owners[i].UID = ""
+		if unnamed {
+			owners[i].Name = ""
+		}
+	}
+	if len(owners) > 0 {
+		o.SetOwnerReferences(owners)
+	}
+	if unnamed {
+		unstructured.RemoveNestedField(o.Object, "metadata", "name")
+		unstructured.RemoveNestedField(o.Object, "metadata", "generateName")
+	}
+	return o.Object
+}
+
+// compareMetrics compares the durations of two runs, how long their
+// expectations took to be met and their agents to become ready, how often
+// the agents flapped, and how often the resources under churn limits
+// changed.
+func compareMetrics(baseline, candidate *Result) []MetricComparison {
+	metrics := []MetricComparison{{Name: "duration", Baseline: baseline.Duration.Seconds(), Candidate: candidate.Duration.Seconds(), Unit: "s"}}
+	expectations := map[string]ExpectationResult{}
+	for _, x := range candidate.Expectations {
+		expectations[expectationKey(x)] = x
+	}
+	for _, b := range baseline.Expectations {
+		if c, ok := expectations[expectationKey(b)]; ok && b.Met && c.Met {
+			metrics = append(metrics, MetricComparison{Name: expectationKey(b) + " met after", Baseline: b.MetAfter.Seconds(), Candidate: c.MetAfter.Seconds(), Unit: "s"})
+		}
+	}
+	agents := map[string]AgentHealth{}
+	for _, a := range candidate.Agents {
+		agents[a.Agent] = a
+	}
+	for _, b := range baseline.Agents {
+		c, ok := agents[b.Agent]
+		if !ok {
+			continue
+		}
+		metrics = append(metrics,
+			MetricComparison{Name: "agent " + b.Agent + " time to ready", Baseline: b.TimeToReady.Seconds(), Candidate: c.TimeToReady.Seconds(), Unit: "s"},
+			MetricComparison{Name: "agent " + b.Agent + " flaps", Baseline: float64(len(b.Flaps)), Candidate: float64(len(c.Flaps))})
+	}
+	churn := map[string]ChurnCount{}
+	for _, c := range candidate.Churn {
+		churn[c.Resource] = c
+	}
+	for _, b := range baseline.Churn {
+		c, ok := churn[b.Resource]
+		if !ok {
+			continue
+		}
+		metrics = append(metrics,
+			MetricComparison{Name: b.Resource + " creates", Baseline: float64(b.Creates), Candidate: float64(c.Creates)},
+			MetricComparison{Name: b.Resource + " updates", Baseline: float64(b.Updates), Candidate: float64(c.Updates)},
+			MetricComparison{Name: b.Resource + " deletes", Baseline: float64(b.Deletes), Candidate: float64(c.Deletes)})
+	}
+	return metrics
+}
+
+// expectationKey names an expectation outcome across runs.
+func expectationKey(x ExpectationResult) string {
+	key := cmp.Or(x.Description, x.ID, x.Resource)
+	if x.Step != "" {
+		key = x.Step + ": " + key
+	}
+	return key
+}
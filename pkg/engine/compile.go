@@ -0,0 +1,526 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// compiled is the preprocessed form of a scenario: manifests decoded,
+// namespaces resolved, and condition paths parsed, so executions do no file
+// IO or parsing.
+type compiled struct {
+	// scenario is the scenario with the namespaces of the resources it
+	// names resolved; see scenario.ResolveNamespaces.
+	scenario  *scenario.Scenario
+	manifests []compiledManifest
+	generated []compiledGenerator
+	waitFor   []compiledExpectation
+	expect    []compiledExpectation
+	events    []compiledEvent
+	metrics   []compiledMetric
+	denials   []compiledDenial
+	evictions []compiledEviction
+	orders    []compiledOrder
+	steps     []compiledStep
+	// teardown holds the objects of the teardown manifests.
+	teardown []compiledManifest
+	// exports holds the parsed path of each of the setup exports.
+	exports []fieldPath
+}
+
+// compiledStep is a step of a multi-step scenario: the scenario as the step
+// sees it, and its expectations.
+type compiledStep struct {
+	scenario *scenario.Scenario
+	expect   []compiledExpectation
+}
+
+type compiledManifest struct {
+	path string
+	objs []*unstructured.Unstructured
+}
+
+type compiledGenerator struct {
+	objs        []*unstructured.Unstructured
+	parallelism int
+}
+
+type compiledExpectation struct {
+	scenario.Expectation
+	paths []fieldPath
+	// sources holds the parsed path of each condition's
+	// valueFrom.resourceField, or nil.
+	sources []fieldPath
+}
+
+// maxCompiledScenarios bounds the compiled scenarios an engine keeps, so
+// long-lived engines, such as those of soak runs and the server, which
+// load their scenarios anew for every suite, do not grow without end.
+const maxCompiledScenarios = 1024
+
+// compileCache holds compiled scenarios and decoded manifest files. Both
+// are immutable once stored; callers deep-copy objects before mutating.
+// Scenarios are evicted oldest first beyond maxCompiledScenarios, and
+// manifest files are decoded again once they change on disk.
+type compileCache struct {
+	mu        sync.Mutex
+	scenarios map[*scenario.Scenario]*compiled
+	// order holds the scenarios in the order they were compiled, for
+	// eviction.
+	order     []*scenario.Scenario
+	manifests map[string]cachedManifest
+}
+
+// cachedManifest is a decoded manifest file and the modification time and
+// size it had when it was read.
+type cachedManifest struct {
+	modTime time.Time
+	size    int64
+	objs    []*unstructured.Unstructured
+}
+
+func newCompileCache() *compileCache {
+	return &compileCache{
+		scenarios: map[*scenario.Scenario]*compiled{},
+		manifests: map[string]cachedManifest{},
+	}
+}
+
+// store caches cs under s and the scenario it compiled to, evicting the
+// oldest scenarios beyond maxCompiledScenarios.
+func (c *compileCache) store(s *scenario.Scenario, cs *compiled) {
+	for _, key := range []*scenario.Scenario{s, cs.scenario} {
+		if _, ok := c.scenarios[key]; !ok {
+			c.order = append(c.order, key)
+		}
+		c.scenarios[key] = cs
+	}
+	for len(c.order) > maxCompiledScenarios {
+		delete(c.scenarios, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// manifest returns the objects of the manifest file at path, decoding it
+// unless it is cached and unchanged since.
+func (c *compileCache) manifest(path string) ([]*unstructured.Unstructured, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := c.manifests[path]; ok && m.modTime.Equal(info.ModTime()) && m.size == info.Size() {
+		return m.objs, nil
+	}
+	objs, err := decodeManifestFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c.manifests[path] = cachedManifest{modTime: info.ModTime(), size: info.Size(), objs: objs}
+	return objs, nil
+}
+
+// Compile preprocesses scenarios up front, reporting every scenario that
+// cannot be compiled. Run compiles on demand, so calling Compile is only
+// needed to fail fast; compiled forms are cached either way.
+func (e *Engine) Compile(scenarios ...*scenario.Scenario) error {
+	var errs []error
+	for _, s := range scenarios {
+		if _, err := e.compiled(s); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// compiled returns the cached compiled form of s, compiling it on first use.
+func (e *Engine) compiled(s *scenario.Scenario) (*compiled, error) {
+	c := e.compileCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cs, ok := c.scenarios[s]; ok {
+		return cs, nil
+	}
+	src := s
+	if s.Namespace == "" && e.namespace != "" {
+		withNS := *s
+		withNS.Namespace = e.namespace
+		s = &withNS
+	}
+
+	cs := &compiled{}
+	if presets := s.PresetObjects(); len(presets) > 0 {
+		m := compiledManifest{path: "setup presets"}
+		for _, obj := range presets {
+			m.objs = append(m.objs, &unstructured.Unstructured{Object: obj})
+		}
+		cs.manifests = append(cs.manifests, m)
+	}
+	decode := func(m string) (compiledManifest, error) {
+		path, err := filepath.Abs(s.ManifestPath(m))
+		if err != nil {
+			return compiledManifest{}, err
+		}
+		objs, err := c.manifest(path)
+		if err != nil {
+			return compiledManifest{}, err
+		}
+		return compiledManifest{path: path, objs: objs}, nil
+	}
+	for _, m := range s.Setup.Manifests {
+		cm, err := decode(m)
+		if err != nil {
+			return nil, err
+		}
+		cs.manifests = append(cs.manifests, cm)
+	}
+	if s.Teardown != nil {
+		for i, m := range s.Teardown.Manifests {
+			cm, err := decode(m)
+			if err != nil {
+				return nil, fmt.Errorf("teardown.manifests[%d]: %w", i, err)
+			}
+			cs.teardown = append(cs.teardown, cm)
+		}
+	}
+	for i := range s.Setup.Generate {
+		g := &s.Setup.Generate[i]
+		objs, err := g.Objects()
+		if err != nil {
+			return nil, fmt.Errorf("setup.generate[%d]: %w", i, err)
+		}
+		cg := compiledGenerator{parallelism: g.ParallelismOrDefault()}
+		for _, obj := range objs {
+			cg.objs = append(cg.objs, &unstructured.Unstructured{Object: obj})
+		}
+		cs.generated = append(cs.generated, cg)
+	}
+	scope := e.scopeFunc(cs)
+	resolved, err := s.ResolveNamespaces(scope)
+	if err != nil {
+		return nil, err
+	}
+	cs.scenario = resolved
+	for i := range cs.manifests {
+		cs.manifests[i].objs = resolveObjects(cs.manifests[i].objs, scope, s.Namespace)
+	}
+	for i := range cs.generated {
+		cs.generated[i].objs = resolveObjects(cs.generated[i].objs, scope, s.Namespace)
+	}
+	for i := range cs.teardown {
+		cs.teardown[i].objs = resolveObjects(cs.teardown[i].objs, scope, s.Namespace)
+	}
+	if err := cs.compileExpectations(); err != nil {
+		return nil, err
+	}
+	if err := checkGenerated(cs); err != nil {
+		return nil, err
+	}
+	for i, x := range resolved.Setup.Exports {
+		p, err := parsePath(x.Path)
+		if err != nil {
+			return nil, fmt.Errorf("setup.exports[%d]: %w", i, err)
+		}
+		cs.exports = append(cs.exports, p)
+	}
+	// Runs go on with the resolved scenario, which compiles to the same.
+	c.store(src, cs)
+	return cs, nil
+}
+
+// compileExpectations compiles the setup.waitFor states, expectations,
+// event, metric, denial, eviction and order expectations of cs.scenario and
+// the expectations of its steps.
+func (cs *compiled) compileExpectations() error {
+	var err error
+	if cs.waitFor, err = compileExpect("setup.waitFor", cs.scenario.Setup.WaitFor); err != nil {
+		return err
+	}
+	if cs.expect, err = compileExpect("expect", cs.scenario.Expect); err != nil {
+		return err
+	}
+	if cs.events, err = compileEvents(cs.scenario.ExpectEvents); err != nil {
+		return err
+	}
+	if cs.metrics, err = compileMetrics(cs.scenario.ExpectMetrics); err != nil {
+		return err
+	}
+	if cs.denials, err = compileDenials(cs.scenario.ExpectDenied); err != nil {
+		return err
+	}
+	if cs.evictions, err = compileEvictions(cs.scenario.ExpectEvictions); err != nil {
+		return err
+	}
+	if cs.orders, err = compileOrders(cs.scenario.ExpectOrder); err != nil {
+		return err
+	}
+	cs.steps = nil
+	for i := range cs.scenario.Steps {
+		step := compiledStep{scenario: cs.scenario.StepScenario(i)}
+		if step.expect, err = compileExpect(fmt.Sprintf("steps[%d].expect", i), step.scenario.Expect); err != nil {
+			return err
+		}
+		cs.steps = append(cs.steps, step)
+	}
+	return nil
+}
+
+// checkGenerated fails when setup objects with metadata.generateName
+// cannot be told apart by scenario.GeneratedKey, or when a scenario with
+// tenants, whose setup runs once per tenant, refers to generated names or
+// exports.
+func checkGenerated(cs *compiled) error {
+	seen := map[string]string{}
+	for _, m := range cs.manifests {
+		for _, obj := range m.objs {
+			if obj.GetName() != "" || obj.GetGenerateName() == "" {
+				continue
+			}
+			key := scenario.GeneratedKey(obj.GetGenerateName())
+			if prev, ok := seen[key]; ok {
+				return fmt.Errorf("%s: generateName %q: an object in %s has the same generated name key", m.path, obj.GetGenerateName(), prev)
+			}
+			seen[key] = m.path
+		}
+	}
+	if cs.scenario.Tenants != nil && cs.scenario.HasSetupReferences() {
+		return errors.New("tenants: triggers and expectations cannot refer to generated names or exports")
+	}
+	return nil
+}
+
+// withSetupValues returns s and cs with the names generated and the
+// values exported during setup filled into the triggers and expectations;
+// see scenario.RenderSetupValues.
+func (e *Engine) withSetupValues(s *scenario.Scenario, cs *compiled, generated, exports map[string]string) (*scenario.Scenario, *compiled, error) {
+	if !s.HasSetupReferences() {
+		return s, cs, nil
+	}
+	rendered, err := s.RenderSetupValues(generated, exports)
+	if err != nil {
+		return nil, nil, err
+	}
+	rcs := *cs
+	rcs.scenario = rendered
+	if err := rcs.compileExpectations(); err != nil {
+		return nil, nil, err
+	}
+	return rendered, &rcs, nil
+}
+
+// compileExpect compiles the expectations of field.
+func compileExpect(field string, expect []scenario.Expectation) ([]compiledExpectation, error) {
+	var compiled []compiledExpectation
+	for i, exp := range expect {
+		exp.Conditions = exp.ExpandedConditions()
+		exp.HPA = nil
+		paths, sources, err := compileConditions(exp.Conditions)
+		if err != nil {
+			return nil, fmt.Errorf("%s[%d].%w", field, i, err)
+		}
+		compiled = append(compiled, compiledExpectation{Expectation: exp, paths: paths, sources: sources})
+	}
+	return compiled, nil
+}
+
+// compileConditions parses the paths of conditions and of the resource
+// fields their values are sourced from.
+func compileConditions(conds []scenario.Condition) (paths, sources []fieldPath, err error) {
+	for i, c := range conds {
+		p, err := parsePath(c.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("conditions[%d]: %w", i, err)
+		}
+		var src fieldPath
+		if c.ValueFrom != nil && c.ValueFrom.ResourceField != nil {
+			if src, err = parsePath(c.ValueFrom.ResourceField.Path); err != nil {
+				return nil, nil, fmt.Errorf("conditions[%d].valueFrom.resourceField: %w", i, err)
+			}
+		}
+		paths = append(paths, p)
+		sources = append(sources, src)
+	}
+	return paths, sources, nil
+}
+
+// fieldPath is a parsed dotted path such as .status.conditions[0].type or
+// .status.conditions[?(@.type=="Ready")].status.
+type fieldPath []pathSegment
+
+type pathSegment struct {
+	name    string
+	indexes []pathIndex
+}
+
+// pathIndex selects a list element: the one at i, or, if key is set, the
+// first map whose key field equals value.
+type pathIndex struct {
+	i          int
+	key, value string
+}
+
+// find returns the index in list of the element x selects, or -1.
+func (x pathIndex) find(list []any) int {
+	if x.key == "" {
+		if x.i >= len(list) {
+			return -1
+		}
+		return x.i
+	}
+	for i, e := range list {
+		if m, ok := e.(map[string]any); ok && m[x.key] == x.value {
+			return i
+		}
+	}
+	return -1
+}
+
+func parsePath(path string) (fieldPath, error) {
+	var p fieldPath
+	for _, seg := range splitSegments(strings.TrimPrefix(path, ".")) {
+		if seg == "" {
+			return nil, fmt.Errorf("path %q: empty segment", path)
+		}
+		name, indexes, err := splitIndexes(seg)
+		if err != nil {
+			return nil, err
+		}
+		p = append(p, pathSegment{name: name, indexes: indexes})
+	}
+	return p, nil
+}
+
+// splitSegments splits a path at the dots outside of brackets, which
+// filters have.
+func splitSegments(path string) []string {
+	var segs []string
+	depth, start := 0, 0
+	for i := 0; i < len(path); i++ {
+		switch path[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '.':
+			if depth == 0 {
+				segs = append(segs, path[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(segs, path[start:])
+}
+
+// lookup resolves the path against an unstructured object.
+func (p fieldPath) lookup(obj map[string]any) (any, bool) {
+	var cur any = obj
+	for _, seg := range p {
+		if seg.name != "" {
+			m, ok := cur.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if cur, ok = m[seg.name]; !ok {
+				return nil, false
+			}
+		}
+		for _, x := range seg.indexes {
+			list, ok := cur.([]any)
+			if !ok {
+				return nil, false
+			}
+			i := x.find(list)
+			if i < 0 {
+				return nil, false
+			}
+			cur = list[i]
+		}
+	}
+	return cur, true
+}
+
+// remove deletes the field at the path from obj, if present. A path that
+// ends in an index removes that list element.
+func (p fieldPath) remove(obj map[string]any) {
+	if len(p) == 0 {
+		return
+	}
+	parent, ok := p[:len(p)-1].lookup(obj)
+	m, isMap := parent.(map[string]any)
+	if !ok || !isMap {
+		return
+	}
+	last := p[len(p)-1]
+	if len(last.indexes) == 0 {
+		delete(m, last.name)
+		return
+	}
+	var cur any = m
+	set := func(v any) { m[last.name] = v }
+	if last.name != "" {
+		cur = m[last.name]
+	}
+	for n, x := range last.indexes {
+		list, ok := cur.([]any)
+		if !ok {
+			return
+		}
+		i := x.find(list)
+		if i < 0 {
+			return
+		}
+		if n == len(last.indexes)-1 {
+			set(slices.Delete(slices.Clone(list), i, i+1))
+			return
+		}
+		set = func(v any) { list[i] = v }
+		cur = list[i]
+	}
+}
+
+// filterIndex matches a filter such as [?(@.type=="Ready")].
+var filterIndex = regexp.MustCompile(`^\[\?\(@\.([A-Za-z0-9_-]+)\s*==\s*("(?:[^"\\]|\\.)*")\)\]`)
+
+// splitIndexes splits "conditions[0][1]" into "conditions" and [0 1], and
+// `conditions[?(@.type=="Ready")]` into "conditions" and a filter.
+func splitIndexes(seg string) (string, []pathIndex, error) {
+	open := strings.IndexByte(seg, '[')
+	if open < 0 {
+		return seg, nil, nil
+	}
+	name, rest := seg[:open], seg[open:]
+	var indexes []pathIndex
+	for rest != "" {
+		if m := filterIndex.FindStringSubmatch(rest); m != nil {
+			value, err := strconv.Unquote(m[2])
+			if err != nil {
+				return "", nil, fmt.Errorf("malformed filter in %q", seg)
+			}
+			indexes = append(indexes, pathIndex{key: m[1], value: value})
+			rest = rest[len(m[0]):]
+			continue
+		}
+		end := strings.IndexByte(rest, ']')
+		if rest[0] != '[' || end < 0 {
+			return "", nil, fmt.Errorf("malformed index in %q", seg)
+		}
+		i, err := strconv.Atoi(rest[1:end])
+		if err != nil || i < 0 {
+			return "", nil, fmt.Errorf("malformed index in %q", seg)
+		}
+		indexes = append(indexes, pathIndex{i: i})
+		rest = rest[end+1:]
+	}
+	return name, indexes, nil
+}
@@ -0,0 +1,35 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/diagnostics"
+)
+
+// checkConsistently returns diffs, plus a diff while an expectation with
+// consistentlyFor has been met for less than that. since is when the
+// expectation was first seen met without a poll failing it since; a poll
+// that finds diffs or fails with err resets it.
+func checkConsistently(exp compiledExpectation, diffs []diagnostics.Diff, err error, since *time.Time, now time.Time) []diagnostics.Diff {
+	d := exp.ConsistentlyFor
+	if d == nil {
+		return diffs
+	}
+	if err != nil || len(diffs) > 0 {
+		*since = time.Time{}
+		return diffs
+	}
+	if since.IsZero() {
+		*since = now
+	}
+	if held := now.Sub(*since); held < d.Duration {
+		return append(diffs, diagnostics.Diff{
+			Resource:    exp.Resource.String(),
+			Description: describe(exp.Expectation, nil),
+			Expected:    fmt.Sprintf("met for %s", d.Duration),
+			Actual:      fmt.Sprintf("met for %s", held.Round(time.Second)),
+		})
+	}
+	return diffs
+}
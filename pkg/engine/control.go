@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/agent"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// controlCopies returns copies of the namespaced setup objects, generated
+// ones included, moved to the control namespace ns.
+func (e *Engine) controlCopies(cs *compiled, ns string) ([]*unstructured.Unstructured, error) {
+	var all []*unstructured.Unstructured
+	for _, m := range cs.manifests {
+		all = append(all, m.objs...)
+	}
+	for _, g := range cs.generated {
+		all = append(all, g.objs...)
+	}
+	var copies []*unstructured.Unstructured
+	for _, obj := range all {
+		// Objects named by the API server could not be found again to
+		// verify them.
+		if isCRD(obj) || obj.GetName() == "" {
+			continue
+		}
+		_, objNS, err := e.locate(obj.GroupVersionKind(), obj.GetNamespace())
+		if err != nil {
+			return nil, err
+		}
+		if objNS == "" {
+			continue
+		}
+		if objNS == ns {
+			return nil, fmt.Errorf("%s %s is already in control namespace %s", obj.GetKind(), obj.GetName(), ns)
+		}
+		c := obj.DeepCopy()
+		c.SetNamespace(ns)
+		copies = append(copies, c)
+	}
+	return copies, nil
+}
+
+// seedControl creates the scenario's control namespace, if any, and
+// applies the copies of the setup objects to it.
+func (e *Engine) seedControl(ctx context.Context, s *scenario.Scenario, cs *compiled) error {
+	ns := s.Setup.ControlNamespace
+	if ns == "" {
+		return nil
+	}
+	copies, err := e.controlCopies(cs, ns)
+	if err != nil {
+		return err
+	}
+	if err := e.createNamespace(ctx, ns); err != nil {
+		return err
+	}
+	return e.generate(ctx, compiledGenerator{objs: copies, parallelism: scenario.DefaultGenerateParallelism})
+}
+
+// verifyControl fails if a copy in the control namespace was deleted, has
+// a field that differs from what was seeded, or was written to by one of
+// the scenario's agents since the scenario started. Fields added by the
+// API server or other controllers, such as status, are ignored.
+func (e *Engine) verifyControl(ctx context.Context, s *scenario.Scenario, specs []agent.Spec, since time.Time) error {
+	ns := s.Setup.ControlNamespace
+	if ns == "" {
+		return nil
+	}
+	cs, err := e.compiled(s)
+	if err != nil {
+		return err
+	}
+	copies, err := e.controlCopies(cs, ns)
+	if err != nil {
+		return err
+	}
+	managers := fieldManagers(s, specs)
+	var errs []error
+	for _, want := range copies {
+		ri, err := e.resourceInterface(want.GroupVersionKind(), ns)
+		if err != nil {
+			return err
+		}
+		what := fmt.Sprintf("%s %s/%s", want.GetKind(), ns, want.GetName())
+		live, err := ri.Get(ctx, want.GetName(), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("%s was deleted", what))
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("getting %s: %w", what, err)
+		}
+		if name, w := writtenBy(live, managers, since); w != nil {
+			errs = append(errs, fmt.Errorf("%s was written to by agent %s (%s)", what, name, w.Operation))
+			continue
+		}
+		if path, ok := seededFieldsIntact(want.Object, live.Object, ""); !ok {
+			errs = append(errs, fmt.Errorf("%s changed at %s", what, path))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("control namespace %s was touched:\n%w", ns, errors.Join(errs...))
+	}
+	return nil
+}
+
+// seededFieldsIntact reports whether every leaf of want has the same value
+// in live, returning the path of the first that does not. Metadata other
+// than labels and annotations is skipped, as the API server owns it.
+func seededFieldsIntact(want, live any, path string) (string, bool) {
+	switch w := want.(type) {
+	case map[string]any:
+		l, _ := live.(map[string]any)
+		for k, v := range w {
+			if path == "" && k == "metadata" {
+				lm, _ := l["metadata"].(map[string]any)
+				wm, _ := v.(map[string]any)
+				for _, mk := range []string{"labels", "annotations"} {
+					if p, ok := seededFieldsIntact(wm[mk], lm[mk], ".metadata."+mk); !ok {
+						return p, false
+					}
+				}
+				continue
+			}
+			if p, ok := seededFieldsIntact(v, l[k], path+"."+k); !ok {
+				return p, false
+			}
+		}
+		return "", true
+	case []any:
+		l, _ := live.([]any)
+		if len(l) != len(w) {
+			return path, false
+		}
+		for i := range w {
+			if p, ok := seededFieldsIntact(w[i], l[i], fmt.Sprintf("%s[%d]", path, i)); !ok {
+				return p, false
+			}
+		}
+		return "", true
+	case nil:
+		return "", true
+	}
+	return path, scenario.ValuesEqual(want, live)
+}
@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	crdPollInterval = 500 * time.Millisecond
+	// crdTimeout bounds how long setup waits for its CRDs.
+	crdTimeout = time.Minute
+)
+
+var crdResource = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// isCRD reports whether obj is a CustomResourceDefinition.
+func isCRD(obj *unstructured.Unstructured) bool {
+	gvk := obj.GroupVersionKind()
+	return gvk.Group == crdResource.Group && gvk.Kind == "CustomResourceDefinition"
+}
+
+// WaitForCRDEstablished blocks until each named CustomResourceDefinition
+// (e.g. "widgets.example.com") is established, its names are accepted, and
+// every served version resolves through discovery. Only then can custom
+// resources of that kind be applied and read reliably. Bound the wait with
+// ctx.
+func (e *Engine) WaitForCRDEstablished(ctx context.Context, names ...string) error {
+	for _, name := range names {
+		if err := wait.PollUntilContextCancel(ctx, crdPollInterval, true, func(ctx context.Context) (bool, error) {
+			return e.crdReady(ctx, name)
+		}); err != nil {
+			return fmt.Errorf("waiting for CRD %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// crdReady reports whether the named CRD is established and resolvable.
+func (e *Engine) crdReady(ctx context.Context, name string) (bool, error) {
+	crd, err := e.dynamic.Resource(crdResource).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !crdCondition(crd, "Established") || !crdCondition(crd, "NamesAccepted") {
+		return false, nil
+	}
+
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	gk := schema.GroupKind{Group: group, Kind: kind}
+	for _, v := range versions {
+		version, _ := v.(map[string]any)
+		if served, _ := version["served"].(bool); !served {
+			continue
+		}
+		vname, _ := version["name"].(string)
+		// A miss refreshes discovery, rate-limited by the mapper.
+		if _, err := e.mapper.RESTMapping(gk, vname); err != nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// crdCondition reports whether the CRD has condition typ set to True.
+func crdCondition(crd *unstructured.Unstructured, typ string) bool {
+	conds, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	for _, c := range conds {
+		cond, _ := c.(map[string]any)
+		if cond["type"] == typ {
+			return cond["status"] == "True"
+		}
+	}
+	return false
+}
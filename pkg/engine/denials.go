@@ -0,0 +1,191 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// DenialResult is how the API server answered a mutation the scenario
+// expects admission to deny.
+type DenialResult struct {
+	// ID and Description are the expectation's, if the scenario sets
+	// them.
+	ID          string
+	Description string
+	// Operation is create, patch or delete, and Resource the resource it
+	// was attempted on.
+	Operation string
+	Resource  string
+	// Denied is set once admission rejected the mutation with a matching
+	// message; Allowed if it let the last attempt through instead, or
+	// any attempt that was not a dry run.
+	Denied  bool
+	Allowed bool
+	// Code, Reason and Message are the status the last attempt failed
+	// with: the admission response when it was denied.
+	Code    int32
+	Reason  string
+	Message string
+}
+
+type compiledDenial struct {
+	scenario.DenialExpectation
+	message *regexp.Regexp
+}
+
+// compileDenials compiles the message patterns of denials.
+func compileDenials(denials []scenario.DenialExpectation) ([]compiledDenial, error) {
+	var compiled []compiledDenial
+	for i, d := range denials {
+		re, err := regexp.Compile(d.Message)
+		if err != nil {
+			return nil, fmt.Errorf("expectDenied[%d].message: %w", i, err)
+		}
+		compiled = append(compiled, compiledDenial{DenialExpectation: d, message: re})
+	}
+	return compiled, nil
+}
+
+// checkDenials attempts the mutations of cs's denial expectations until
+// admission denies each of them or the scenario's timeout passes,
+// recording the answers in res.Denials. Mutations admission allows for
+// real are not attempted again.
+func (e *Engine) checkDenials(ctx context.Context, s *scenario.Scenario, cs *compiled, res *Result) error {
+	if len(cs.denials) == 0 {
+		return nil
+	}
+	results := make([]DenialResult, len(cs.denials))
+	for i, d := range cs.denials {
+		results[i] = DenialResult{
+			ID:          d.ID,
+			Description: d.Description,
+			Operation:   d.Operation(),
+			Resource:    d.Resource().String(),
+		}
+	}
+	defer func() { res.Denials = results }()
+	ctx, cancel := context.WithTimeout(ctx, s.TimeoutOrDefault())
+	defer cancel()
+	_ = wait.PollUntilContextCancel(ctx, e.pollInterval, true, func(ctx context.Context) (bool, error) {
+		done := true
+		for i, d := range cs.denials {
+			if !results[i].Denied && !wronglyAllowed(d, results[i]) {
+				e.attemptDenied(ctx, d, &results[i])
+			}
+			done = done && (results[i].Denied || wronglyAllowed(d, results[i]))
+		}
+		return done, nil
+	})
+	var errs []error
+	for i, r := range results {
+		d := cs.denials[i]
+		switch {
+		case r.Denied:
+			continue
+		case r.Allowed:
+			errs = append(errs, fmt.Errorf("%s: allowed", d.Label()))
+		case isDenial(r):
+			errs = append(errs, fmt.Errorf("%s: denied with %q, which does not match %q", d.Label(), r.Message, d.Message))
+		default:
+			errs = append(errs, fmt.Errorf("%s: %s", d.Label(), r.Message))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("expectDenied:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// wronglyAllowed reports whether r is a mutation admission let through for
+// real, which is not attempted again: it would be repeated, or fail for
+// having happened, such as a delete answered with not found.
+func wronglyAllowed(d compiledDenial, r DenialResult) bool {
+	return !d.DryRun && r.Allowed
+}
+
+// attemptDenied attempts the mutation of d and records the answer in r.
+func (e *Engine) attemptDenied(ctx context.Context, d compiledDenial, r *DenialResult) {
+	err := e.mutate(ctx, d)
+	*r = DenialResult{ID: r.ID, Description: r.Description, Operation: r.Operation, Resource: r.Resource}
+	if err == nil {
+		r.Allowed = true
+		return
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		st := status.Status()
+		r.Code, r.Reason, r.Message = st.Code, string(st.Reason), st.Message
+	} else {
+		r.Message = err.Error()
+	}
+	if isDenial(*r) && d.message.MatchString(r.Message) {
+		r.Denied = true
+		e.log.Info("mutation denied", "expectation", d.Label(), "code", r.Code, "message", r.Message)
+	}
+}
+
+// mutate attempts the mutation of d. A created object admission wrongly
+// allows is deleted again.
+func (e *Engine) mutate(ctx context.Context, d compiledDenial) error {
+	ref := d.Resource()
+	ri, err := e.resourceFor(ref)
+	if err != nil {
+		return err
+	}
+	var dryRun []string
+	if d.DryRun {
+		dryRun = []string{metav1.DryRunAll}
+	}
+	switch {
+	case d.Create != nil:
+		obj := &unstructured.Unstructured{Object: runtime.DeepCopyJSON(d.Create)}
+		if _, err := ri.Create(ctx, obj, metav1.CreateOptions{DryRun: dryRun}); err != nil {
+			return err
+		}
+		if !d.DryRun {
+			delCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+			defer cancel()
+			if err := ri.Delete(delCtx, ref.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+				e.log.Warn("deleting wrongly admitted object", "resource", ref.String(), "error", err)
+			}
+		}
+		return nil
+	case d.Patch != nil:
+		body, err := json.Marshal(map[string]any{"spec": d.Patch.Spec})
+		if err != nil {
+			return err
+		}
+		_, err = ri.Patch(ctx, ref.Name, types.MergePatchType, body, metav1.PatchOptions{DryRun: dryRun})
+		return err
+	}
+	return ri.Delete(ctx, ref.Name, metav1.DeleteOptions{DryRun: dryRun})
+}
+
+// isDenial reports whether r is admission rejecting the request, as
+// opposed to the request failing otherwise, e.g. for a webhook that is not
+// serving yet. Webhooks deny with 403 Forbidden unless they give a code of
+// their own; admission policies deny with 422 Invalid.
+func isDenial(r DenialResult) bool {
+	switch {
+	case r.Allowed || r.Code == 0:
+		return false
+	case strings.Contains(r.Message, "denied the request"):
+		return true
+	}
+	return metav1.StatusReason(r.Reason) == metav1.StatusReasonForbidden ||
+		metav1.StatusReason(r.Reason) == metav1.StatusReasonInvalid ||
+		metav1.StatusReason(r.Reason) == metav1.StatusReasonBadRequest
+}
@@ -0,0 +1,38 @@
+package engine
+
+// Dimensions the engine labels every Result with.
+const (
+	// DimensionKubernetes is the cluster's Kubernetes version.
+	DimensionKubernetes = "kubernetes"
+	// DimensionAgentPrefix is followed by an agent name; the value is the
+	// image the agent ran.
+	DimensionAgentPrefix = "agent/"
+)
+
+// addDimensions labels res with the Kubernetes version and the image of
+// each agent it deployed.
+func (e *Engine) addDimensions(res *Result) {
+	if res.Dimensions == nil {
+		res.Dimensions = map[string]string{}
+	}
+	if v := e.kubernetesVersion(); v != "" {
+		res.Dimensions[DimensionKubernetes] = v
+	}
+	for name, image := range res.AgentImages {
+		res.Dimensions[DimensionAgentPrefix+name] = image
+	}
+}
+
+// kubernetesVersion returns the cluster's version, asking the API server
+// once; empty if it could not be determined.
+func (e *Engine) kubernetesVersion() string {
+	e.versionOnce.Do(func() {
+		info, err := e.discovery.ServerVersion()
+		if err != nil {
+			e.log.Warn("getting Kubernetes version", "error", err)
+			return
+		}
+		e.serverVersion = info.GitVersion
+	})
+	return e.serverVersion
+}
@@ -0,0 +1,614 @@
+// Package engine executes scenarios against a cluster: it deploys the
+// scenario's agents, applies the initial state, fires the trigger, and polls
+// until the expected state is reached or the timeout expires.
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/agent"
+	"github.com/aslakknutsen/kube-agents-test/pkg/anchor"
+	"github.com/aslakknutsen/kube-agents-test/pkg/diagnostics"
+	"github.com/aslakknutsen/kube-agents-test/pkg/fakeclock"
+	"github.com/aslakknutsen/kube-agents-test/pkg/kube"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+const (
+	defaultPollInterval = 2 * time.Second
+	defaultAgentTimeout = 2 * time.Minute
+	cleanupTimeout      = 30 * time.Second
+)
+
+// Engine runs scenarios against one cluster.
+type Engine struct {
+	clients   *kube.Clients
+	dynamic   dynamic.Interface
+	kube      kubernetes.Interface
+	discovery discovery.DiscoveryInterface
+	mapper    *refreshingMapper
+	// cache serves expectation reads; nil when informers are disabled.
+	cache        *objectCache
+	compileCache *compileCache
+	// validator checks setup manifests; nil when validation is disabled.
+	validator *schemaValidator
+
+	agents   agent.Manager
+	registry agent.Registry
+	// images pins and verifies agent images before they are deployed;
+	// either may be nil.
+	resolver  agent.ImageResolver
+	verifier  agent.ImageVerifier
+	collector diagnostics.Collector
+	log       *slog.Logger
+
+	pollInterval time.Duration
+	agentTimeout time.Duration
+	useInformers bool
+	informerOpts InformerOptions
+	validate     bool
+	// updateSnapshots rewrites golden files instead of comparing with
+	// them.
+	updateSnapshots bool
+	// recordEndStates records the end states of expected resources in
+	// results; see WithEndStates.
+	recordEndStates bool
+	// readOnly refuses scenarios that change the cluster and sends only
+	// reads; see WithReadOnly.
+	readOnly bool
+
+	// apiProxyImage runs the proxy behind scenarios' apiFaults and API
+	// access checks.
+	apiProxyImage    string
+	apiProxyDeployed bool
+	checkAPIAccess   bool
+
+	// anchor owns the objects the engine creates; nil if unset.
+	anchor *anchor.Anchor
+
+	// kubeconfig, when set, replaces the config given to New.
+	kubeconfig *kubeconfigRef
+	// impersonate is applied to every client the engine builds.
+	impersonate rest.ImpersonationConfig
+	// namespace is the default of scenarios that set no namespace.
+	namespace string
+
+	versionOnce   sync.Once
+	serverVersion string
+}
+
+// Option configures an Engine.
+type Option func(*Engine)
+
+type kubeconfigRef struct {
+	path, context string
+}
+
+// WithAgents lets the engine deploy the agents a scenario lists, resolving
+// their names through registry. Without it, agents are assumed to already
+// run in the cluster.
+func WithAgents(m agent.Manager, registry agent.Registry) Option {
+	return func(e *Engine) {
+		e.agents = m
+		e.registry = registry
+	}
+}
+
+// WithCollector enables diagnostics collection for failed scenarios.
+func WithCollector(c diagnostics.Collector) Option {
+	return func(e *Engine) { e.collector = c }
+}
+
+// WithPollInterval sets how often expectations are re-evaluated.
+func WithPollInterval(d time.Duration) Option {
+	return func(e *Engine) { e.pollInterval = d }
+}
+
+// WithAgentTimeout bounds how long agents may take to become ready.
+func WithAgentTimeout(d time.Duration) Option {
+	return func(e *Engine) { e.agentTimeout = d }
+}
+
+// WithInformerCache controls whether expectations read from shared
+// informers (the default) or GET each resource on every poll.
+func WithInformerCache(enabled bool) Option {
+	return func(e *Engine) { e.useInformers = enabled }
+}
+
+// WithInformerOptions tunes the watches behind the informer cache.
+func WithInformerOptions(o InformerOptions) Option {
+	return func(e *Engine) { e.informerOpts = o }
+}
+
+// WithSchemaValidation controls whether setup manifests are validated
+// against the cluster's OpenAPI schemas before they are applied (the
+// default).
+func WithSchemaValidation(enabled bool) Option {
+	return func(e *Engine) { e.validate = enabled }
+}
+
+// WithAPIProxy sets the image of the fault-injecting API proxy (built from
+// cmd/kube-agents-test-apiproxy) that scenarios with apiFaults route their
+// agents through.
+func WithAPIProxy(image string) Option {
+	return func(e *Engine) { e.apiProxyImage = image }
+}
+
+// WithImageResolver pins the image of each agent to a digest with r
+// before deploying it, so the agent runs, and Result.AgentImages records,
+// exactly what the tag referred to at deploy time.
+func WithImageResolver(r agent.ImageResolver) Option {
+	return func(e *Engine) { e.resolver = r }
+}
+
+// WithImageVerifier refuses to deploy agents whose image v rejects, e.g.
+// for lacking a valid signature. Images must be pinned by digest, in the
+// registry or with WithImageResolver.
+func WithImageVerifier(v agent.ImageVerifier) Option {
+	return func(e *Engine) { e.verifier = v }
+}
+
+// WithAPIAccessCheck routes agents whose spec has an allowlist through the
+// API proxy and fails scenarios in which such an agent made an API call
+// the list does not allow. It needs WithAPIProxy.
+func WithAPIAccessCheck(enabled bool) Option {
+	return func(e *Engine) { e.checkAPIAccess = enabled }
+}
+
+// WithSnapshotUpdate makes scenarios with snapshots rewrite their golden
+// files from the cluster instead of comparing against them.
+func WithSnapshotUpdate(enabled bool) Option {
+	return func(e *Engine) { e.updateSnapshots = enabled }
+}
+
+// WithEndStates records in every result the state the resources a
+// scenario's expectations name were left in, see Result.EndStates, so runs
+// against different agent builds can be compared with Compare.
+func WithEndStates(enabled bool) Option {
+	return func(e *Engine) { e.recordEndStates = enabled }
+}
+
+// WithReadOnly makes the engine refuse to change the cluster, so scenarios
+// can verify the health of production clusters. Scenarios with setup,
+// triggers, agents to deploy, or checks that send mutations fail without
+// running; the rest only have their expectations checked and, when they
+// fail, diagnostics collected. Beyond that, the engine's clients refuse
+// every request that is not a read.
+func WithReadOnly(enabled bool) Option {
+	return func(e *Engine) { e.readOnly = enabled }
+}
+
+// WithRunAnchor makes the objects the engine creates, such as setup
+// objects and namespaces, owned by the run anchor a. See package anchor.
+func WithRunAnchor(a *anchor.Anchor) Option {
+	return func(e *Engine) { e.anchor = a }
+}
+
+// WithKubeconfig makes the engine build its clients from a kubeconfig file
+// and context instead of the config given to New, which may then be nil,
+// so one process can run engines against several clusters. An empty path
+// uses the standard loading rules and an empty context the current one.
+func WithKubeconfig(path, context string) Option {
+	return func(e *Engine) { e.kubeconfig = &kubeconfigRef{path: path, context: context} }
+}
+
+// WithImpersonation makes every request the engine sends impersonate user
+// and groups, so scenarios set up, trigger and check with the RBAC of that
+// user rather than of the kubeconfig's credentials.
+func WithImpersonation(user string, groups ...string) Option {
+	return func(e *Engine) { e.impersonate = rest.ImpersonationConfig{UserName: user, Groups: groups} }
+}
+
+// WithDefaultNamespace sets the namespace of scenarios that set none, as if
+// they set it themselves.
+func WithDefaultNamespace(namespace string) Option {
+	return func(e *Engine) { e.namespace = namespace }
+}
+
+// WithLogger sets the logger for progress messages.
+func WithLogger(l *slog.Logger) Option {
+	return func(e *Engine) { e.log = l }
+}
+
+// New builds an Engine for the cluster behind config, or the kubeconfig of
+// WithKubeconfig. Clients are shared with every other user of the same
+// config through kube.ForConfig; impersonating engines get their own.
+func New(config *rest.Config, opts ...Option) (*Engine, error) {
+	e := &Engine{
+		compileCache: newCompileCache(),
+		log:          slog.New(slog.DiscardHandler),
+		pollInterval: defaultPollInterval,
+		agentTimeout: defaultAgentTimeout,
+		useInformers: true,
+		validate:     true,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	clients, err := e.buildClients(config)
+	if err != nil {
+		return nil, err
+	}
+	e.clients = clients
+	e.dynamic = clients.Dynamic
+	e.kube = clients.Kubernetes
+	e.discovery = clients.Discovery
+	e.mapper = newRefreshingMapper(clients.Discovery)
+	if e.useInformers {
+		e.cache = newObjectCache(clients.Dynamic, e.informerOpts)
+	}
+	if e.validate {
+		e.validator = newSchemaValidator(clients.Discovery.OpenAPIV3())
+	}
+	return e, nil
+}
+
+// buildClients returns the clients for config, or for the kubeconfig of
+// WithKubeconfig, impersonating as set with WithImpersonation and limited
+// to reads with WithReadOnly.
+func (e *Engine) buildClients(config *rest.Config) (*kube.Clients, error) {
+	if e.kubeconfig != nil {
+		c, err := kube.ForKubeconfig(e.kubeconfig.path, e.kubeconfig.context)
+		if err != nil {
+			return nil, err
+		}
+		config = c.Config
+	}
+	if config == nil {
+		return nil, errors.New("no cluster config: pass one to New or use WithKubeconfig")
+	}
+	if e.readOnly {
+		config = readOnlyConfig(config)
+	}
+	if e.impersonate.UserName == "" {
+		if len(e.impersonate.Groups) > 0 {
+			return nil, errors.New("impersonating groups needs a user")
+		}
+		return kube.ForConfig(config)
+	}
+	// The copy keeps the shared rate limiter, so impersonating engines
+	// still count towards the process-wide limits.
+	impersonated := rest.CopyConfig(config)
+	impersonated.Impersonate = e.impersonate
+	return kube.ForConfig(impersonated)
+}
+
+// Close stops the informers backing expectation reads.
+func (e *Engine) Close() {
+	if e.cache != nil {
+		e.cache.close()
+	}
+}
+
+// Result is the outcome of one scenario.
+type Result struct {
+	Scenario string
+	Passed   bool
+	Error    string
+	// Skipped is set when the scenario did not run, e.g. because a
+	// scenario it depends on failed. SkipReason says why.
+	Skipped    bool
+	SkipReason string
+	StartedAt  time.Time
+	Duration   time.Duration
+	// AgentImages records the image each participating agent ran, pinned
+	// by digest when the engine resolves images.
+	AgentImages map[string]string
+	// Dimensions labels the combination the scenario ran in, such as the
+	// Kubernetes version and agent images, so results from matrix runs
+	// can be aggregated per dimension value; see runner.Aggregate.
+	Dimensions map[string]string
+	// Expectations holds the outcome of each expectation at its last
+	// evaluation, steps included; empty when the scenario failed before
+	// reaching them.
+	Expectations []ExpectationResult
+	// Tenants holds the outcome of each tenant of a scenario with tenants,
+	// in the order of their namespaces.
+	Tenants []TenantResult
+	// Agents records the readiness of each agent the framework deployed,
+	// in the order the scenario lists them.
+	Agents []AgentHealth
+	// Churn counts the changes to the resources the scenario's churn
+	// limits select, from the trigger on.
+	Churn []ChurnCount
+	// Denials holds the answer to each mutation the scenario expects
+	// admission to deny.
+	Denials []DenialResult
+	// Evictions holds the outcome of each eviction the scenario expects to
+	// be blocked or allowed.
+	Evictions []EvictionResult
+	// Load summarizes the load test of a scenario with one.
+	Load *LoadResult
+	// EndStates holds, with WithEndStates, the state the resources the
+	// expectations name were left in, steps included.
+	EndStates []EndState
+	// Report holds diagnostics when the scenario failed and a collector is
+	// configured.
+	Report *diagnostics.Report
+}
+
+// ExpectationResult is the outcome of one expectation.
+type ExpectationResult struct {
+	// Step names the step of a multi-step scenario the expectation
+	// belongs to; empty for the scenario's own expectations.
+	Step     string
+	Resource string
+	// ID and Description are the expectation's, if the scenario sets
+	// them.
+	ID          string
+	Description string
+	Met         bool
+	// MetAfter is how long into the wait the expectation became met and
+	// stayed met, to within the poll interval; zero unless Met.
+	MetAfter time.Duration
+	// Message says why the expectation is not met.
+	Message string
+	// Diffs are the mismatches found by the last evaluation.
+	Diffs []diagnostics.Diff
+}
+
+// Run executes s and reports the outcome. Errors are captured in the Result;
+// Run never panics on cluster failures.
+func (e *Engine) Run(ctx context.Context, s *scenario.Scenario) *Result {
+	res := &Result{Scenario: s.Name, StartedAt: time.Now(), AgentImages: map[string]string{}}
+	defer func() { res.Duration = time.Since(res.StartedAt) }()
+	defer e.addDimensions(res)
+	if e.cache != nil {
+		defer e.cache.track(res.StartedAt)()
+	}
+
+	if len(s.APIFaults) > 0 && e.agents == nil {
+		res.Error = "apiFaults need agents deployed by the framework"
+		return res
+	}
+	cs, err := e.compiled(s)
+	if err != nil {
+		e.fail(ctx, s, res, fmt.Errorf("compiling: %w", err), nil)
+		return res
+	}
+	s = cs.scenario
+	if err := e.checkReadOnly(s); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	if err := e.preflight(ctx, s.Preflight); err != nil {
+		// Nothing was deployed, so there is nothing to collect.
+		res.Error = fmt.Sprintf("preflight: %v", err)
+		e.log.Info("scenario failed preflight", "scenario", s.Name, "error", err)
+		return res
+	}
+	// Deferred before the agents are deployed, so they are stopped by the
+	// time teardown deletes what they would reconcile.
+	setup := &setupState{}
+	defer e.teardown(ctx, cs, setup, res)
+	var specs []agent.Spec
+	if e.agents != nil && len(s.Agents) > 0 {
+		specs, err = e.registry.Lookup(s.Agents...)
+		if err != nil {
+			res.Error = err.Error()
+			return res
+		}
+		// Deferred before collection below, so agents are still running
+		// while their logs are gathered.
+		defer e.stopAgents(ctx, specs)
+		if err := e.deployAgents(ctx, s, specs, res); err != nil {
+			e.fail(ctx, s, res, err, nil)
+			return res
+		}
+		defer e.monitorAgents(ctx, res)()
+	}
+
+	triggers := s.Trigger.Triggers()
+	for _, st := range s.Steps {
+		triggers = append(triggers, st.Trigger.Triggers()...)
+	}
+	for _, t := range triggers {
+		if t.Drain != nil {
+			defer e.uncordon(t.Drain.Node)
+		}
+	}
+	var diffs []diagnostics.Diff
+	err = e.run(ctx, s, res, &diffs, setup)
+	if e.recordEndStates {
+		res.EndStates = e.endStates(ctx, s)
+	}
+	if err != nil {
+		e.fail(ctx, s, res, err, diffs)
+		return res
+	}
+	if diffs, err := e.verifySnapshots(ctx, s); err != nil {
+		e.fail(ctx, s, res, err, diffs)
+		return res
+	}
+	if err := e.verifyAPIAccess(ctx, specs); err != nil {
+		e.fail(ctx, s, res, err, nil)
+		return res
+	}
+	if err := e.verifyForbiddenMutations(ctx, s, specs, res.StartedAt); err != nil {
+		e.fail(ctx, s, res, err, nil)
+		return res
+	}
+	if err := e.verifyOrder(ctx, s, specs, res.StartedAt); err != nil {
+		e.fail(ctx, s, res, err, nil)
+		return res
+	}
+	if err := e.verifyControl(ctx, s, specs, res.StartedAt); err != nil {
+		e.fail(ctx, s, res, err, nil)
+		return res
+	}
+	res.Passed = true
+	e.log.Info("scenario passed", "scenario", s.Name)
+	return res
+}
+
+// run sets up s, fires its triggers and waits for its expectations,
+// recording in setup what teardown needs to know.
+func (e *Engine) run(ctx context.Context, s *scenario.Scenario, res *Result, diffs *[]diagnostics.Diff, setup *setupState) error {
+	cs, err := e.compiled(s)
+	if err != nil {
+		return fmt.Errorf("compiling: %w", err)
+	}
+	if s.Tenants != nil {
+		return e.runTenants(ctx, s, cs, res, diffs)
+	}
+	if s.Setup.HasPresets() {
+		// The presets go first, possibly before a manifest creates
+		// their namespace.
+		if err := e.createNamespace(ctx, s.NamespaceOrDefault()); err != nil {
+			return fmt.Errorf("setup: %w", err)
+		}
+	}
+	generated, err := e.applySetup(ctx, cs)
+	setup.generated = generated
+	if err != nil {
+		return fmt.Errorf("setup: %w", err)
+	}
+	exports, err := e.readExports(ctx, cs, generated)
+	if err != nil {
+		return fmt.Errorf("setup: %w", err)
+	}
+	if s, cs, err = e.withSetupValues(s, cs, generated, exports); err != nil {
+		return fmt.Errorf("setup: %w", err)
+	}
+	setup.scenario = s
+	if err := e.seedControl(ctx, s, cs); err != nil {
+		return fmt.Errorf("setup: control namespace: %w", err)
+	}
+	if err := e.waitForSetup(ctx, s, cs, res.StartedAt, diffs); err != nil {
+		return fmt.Errorf("setup: %w", err)
+	}
+	churn, err := e.recordChurn(ctx, s)
+	if err != nil {
+		return err
+	}
+	defer func() { res.Churn = churn.stop() }()
+	if err := e.fireTrigger(ctx, s); err != nil {
+		return fmt.Errorf("trigger: %w", err)
+	}
+	if s.Load != nil {
+		if err := e.runLoad(ctx, s, res); err != nil {
+			return fmt.Errorf("load: %w", err)
+		}
+	}
+	if err := e.waitForExpectations(ctx, s, cs, res.StartedAt, diffs, &res.Expectations); err != nil {
+		return err
+	}
+	if err := e.runSteps(ctx, s, cs, res, diffs); err != nil {
+		return err
+	}
+	if err := e.checkDenials(ctx, s, cs, res); err != nil {
+		return err
+	}
+	if err := e.checkEvictions(ctx, s, cs, res); err != nil {
+		return err
+	}
+	return churn.verify()
+}
+
+func (e *Engine) fail(ctx context.Context, s *scenario.Scenario, res *Result, err error, diffs []diagnostics.Diff) {
+	res.Error = err.Error()
+	e.log.Info("scenario failed", "scenario", s.Name, "error", err)
+	if e.collector != nil {
+		res.Report = e.collect(ctx, s, res.StartedAt, diffs)
+		res.Report.Watch = e.watchReport(s, res)
+	}
+}
+
+func (e *Engine) deployAgents(ctx context.Context, s *scenario.Scenario, specs []agent.Spec, res *Result) error {
+	if err := e.resetClock(ctx); err != nil {
+		return err
+	}
+	var viaProxy []string
+	for _, spec := range specs {
+		if e.needsProxy(s, spec) {
+			viaProxy = append(viaProxy, spec.Name)
+		}
+	}
+	if len(viaProxy) > 0 {
+		if err := e.startAPIProxy(ctx, viaProxy, s.APIFaults); err != nil {
+			return err
+		}
+	}
+	deployedAt := make([]time.Time, len(specs))
+	for i, spec := range specs {
+		spec.Scenario = s.Name
+		spec.Env = maps.Clone(spec.Env)
+		if spec.Env == nil {
+			spec.Env = map[string]string{}
+		}
+		spec.Env[fakeclock.EnvVar] = clockRef
+		if e.needsProxy(s, spec) {
+			if err := e.publishKubeconfig(ctx, spec.Name); err != nil {
+				return err
+			}
+			spec = proxied(spec)
+		}
+		if err := e.pinImage(ctx, &spec); err != nil {
+			return err
+		}
+		e.log.Info("deploying agent", "agent", spec.Name, "image", spec.Image)
+		deployedAt[i] = time.Now()
+		if err := e.agents.Deploy(ctx, spec); err != nil {
+			return err
+		}
+		res.AgentImages[spec.Name] = spec.Image
+	}
+	return e.waitReady(ctx, specs, deployedAt, res)
+}
+
+// pinImage resolves and verifies the image of spec, as configured.
+func (e *Engine) pinImage(ctx context.Context, spec *agent.Spec) error {
+	if e.resolver != nil {
+		image, err := e.resolver.Resolve(ctx, spec.Image)
+		if err != nil {
+			return fmt.Errorf("agent %s: %w", spec.Name, err)
+		}
+		spec.Image = image
+	}
+	if e.verifier != nil {
+		if err := e.verifier.Verify(ctx, spec.Image); err != nil {
+			return fmt.Errorf("agent %s: verifying image: %w", spec.Name, err)
+		}
+	}
+	return nil
+}
+
+func (e *Engine) stopAgents(ctx context.Context, specs []agent.Spec) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+	for _, spec := range specs {
+		if err := e.agents.Stop(ctx, spec.Name); err != nil {
+			e.log.Warn("stopping agent", "agent", spec.Name, "error", err)
+		}
+	}
+}
+
+func (e *Engine) collect(ctx context.Context, s *scenario.Scenario, since time.Time, diffs []diagnostics.Diff) *diagnostics.Report {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+
+	scope := diagnostics.Scope{
+		Scenario:   s.Name,
+		Namespaces: e.scopeNamespaces(s),
+		Agents:     s.Agents,
+		Since:      since,
+	}
+	report, err := e.collector.Collect(ctx, scope)
+	if err != nil {
+		report = &diagnostics.Report{Errors: []string{err.Error()}}
+	}
+	report.Scenario = s.Name
+	report.Diffs = diffs
+	return report
+}
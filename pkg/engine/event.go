@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// eventComponent is the source of the Events the framework records.
+const eventComponent = "kube-agents-test"
+
+// emitEvent records the Event of an event trigger. The involved object is
+// looked up for its UID and resource version, so agents that match Events
+// to objects by UID see them, but need not exist.
+func (e *Engine) emitEvent(ctx context.Context, ev *scenario.EventTrigger) error {
+	ref := ev.InvolvedObject
+	involved := corev1.ObjectReference{
+		APIVersion: ref.APIVersion,
+		Kind:       ref.Kind,
+		Name:       ref.Name,
+		Namespace:  ref.Namespace,
+	}
+	if ri, err := e.resourceFor(ref); err == nil {
+		obj, err := ri.Get(ctx, ref.Name, metav1.GetOptions{})
+		switch {
+		case err == nil:
+			involved.Namespace = obj.GetNamespace()
+			involved.UID = obj.GetUID()
+			involved.ResourceVersion = obj.GetResourceVersion()
+		case !apierrors.IsNotFound(err):
+			return fmt.Errorf("event about %s: %w", ref, err)
+		}
+	}
+	now := metav1.NewTime(time.Now())
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: ref.Name + ".",
+			Namespace:    ev.NamespaceOrDefault(),
+		},
+		InvolvedObject:      involved,
+		Reason:              ev.Reason,
+		Message:             ev.Message,
+		Type:                ev.TypeOrDefault(),
+		Source:              corev1.EventSource{Component: eventComponent},
+		ReportingController: eventComponent,
+		ReportingInstance:   eventComponent,
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+	}
+	created, err := e.kube.CoreV1().Events(event.Namespace).Create(ctx, event, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("event about %s: %w", ref, err)
+	}
+	e.log.Info("event recorded", "event", created.Namespace+"/"+created.Name, "reason", ev.Reason, "involvedObject", ref.String())
+	return nil
+}
@@ -0,0 +1,163 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// EvictionResult is how the API server answered an eviction the scenario
+// expects to be blocked or allowed.
+type EvictionResult struct {
+	// ID and Description are the expectation's, if the scenario sets
+	// them.
+	ID          string
+	Description string
+	// Pod is the pod the last attempt evicted, as namespace/name; empty
+	// if no pod matched.
+	Pod string
+	// Outcome is the outcome expected: blocked or allowed.
+	Outcome string
+	// Met is set once the eviction had the expected outcome. Blocked is
+	// set if the last attempt was refused, Allowed if it went through.
+	Met     bool
+	Blocked bool
+	Allowed bool
+	// Code and Message are the status the last attempt failed with,
+	// the reasons a budget gives included.
+	Code    int32
+	Message string
+}
+
+type compiledEviction struct {
+	scenario.EvictionExpectation
+	message *regexp.Regexp
+}
+
+// compileEvictions compiles the message patterns of evictions.
+func compileEvictions(evictions []scenario.EvictionExpectation) ([]compiledEviction, error) {
+	var compiled []compiledEviction
+	for i, x := range evictions {
+		re, err := regexp.Compile(x.Message)
+		if err != nil {
+			return nil, fmt.Errorf("expectEvictions[%d].message: %w", i, err)
+		}
+		compiled = append(compiled, compiledEviction{EvictionExpectation: x, message: re})
+	}
+	return compiled, nil
+}
+
+// checkEvictions attempts the evictions of cs's eviction expectations until
+// each has its expected outcome or the scenario's timeout passes,
+// recording the answers in res.Evictions. An eviction that must be blocked
+// but goes through is not attempted again unless it is a dry run, so it
+// does not go on to evict every pod the selector matches.
+func (e *Engine) checkEvictions(ctx context.Context, s *scenario.Scenario, cs *compiled, res *Result) error {
+	if len(cs.evictions) == 0 {
+		return nil
+	}
+	results := make([]EvictionResult, len(cs.evictions))
+	for i, x := range cs.evictions {
+		results[i] = EvictionResult{ID: x.ID, Description: x.Description, Outcome: x.Outcome()}
+	}
+	defer func() { res.Evictions = results }()
+	ctx, cancel := context.WithTimeout(ctx, s.TimeoutOrDefault())
+	defer cancel()
+	_ = wait.PollUntilContextCancel(ctx, e.pollInterval, true, func(ctx context.Context) (bool, error) {
+		done := true
+		for i, x := range cs.evictions {
+			if !results[i].Met && !wronglyEvicted(x, results[i]) {
+				e.attemptEviction(ctx, x, &results[i])
+			}
+			done = done && (results[i].Met || wronglyEvicted(x, results[i]))
+		}
+		return done, nil
+	})
+	var errs []error
+	for i, r := range results {
+		x := cs.evictions[i]
+		switch {
+		case r.Met:
+			continue
+		case r.Allowed:
+			errs = append(errs, fmt.Errorf("%s: eviction of %s allowed", x.Label(), r.Pod))
+		case r.Blocked && x.Blocked:
+			errs = append(errs, fmt.Errorf("%s: blocked with %q, which does not match %q", x.Label(), r.Message, x.Message))
+		case r.Blocked:
+			errs = append(errs, fmt.Errorf("%s: eviction of %s blocked: %s", x.Label(), r.Pod, r.Message))
+		default:
+			errs = append(errs, fmt.Errorf("%s: %s", x.Label(), r.Message))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("expectEvictions:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// wronglyEvicted reports whether r is a pod evicted for real that x
+// expected to be blocked.
+func wronglyEvicted(x compiledEviction, r EvictionResult) bool {
+	return x.Blocked && !x.DryRun && r.Allowed
+}
+
+// attemptEviction evicts the pod of x and records the answer in r.
+func (e *Engine) attemptEviction(ctx context.Context, x compiledEviction, r *EvictionResult) {
+	*r = EvictionResult{ID: r.ID, Description: r.Description, Outcome: r.Outcome}
+	ns, pod := x.NamespaceOrDefault(), x.Pod
+	if pod == "" {
+		var err error
+		if pod, err = e.runningPod(ctx, ns, x.Selector); err != nil {
+			r.Message = err.Error()
+			return
+		}
+	}
+	r.Pod = ns + "/" + pod
+	eviction := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Name: pod, Namespace: ns}}
+	if x.DryRun {
+		eviction.DeleteOptions = &metav1.DeleteOptions{DryRun: []string{metav1.DryRunAll}}
+	}
+	err := e.kube.CoreV1().Pods(ns).EvictV1(ctx, eviction)
+	if err == nil {
+		r.Allowed = true
+		r.Met = x.Allowed
+		e.log.Info("eviction allowed", "expectation", x.Label(), "pod", r.Pod, "dryRun", x.DryRun)
+		return
+	}
+	r.Message = err.Error()
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		st := status.Status()
+		r.Code, r.Message = st.Code, st.Message
+		if causes := evictionCauses(st); causes != "" {
+			r.Message += ": " + causes
+		}
+	}
+	if apierrors.IsTooManyRequests(err) {
+		r.Blocked = true
+		r.Met = x.Blocked && x.message.MatchString(r.Message)
+		e.log.Info("eviction blocked", "expectation", x.Label(), "pod", r.Pod, "message", r.Message)
+	}
+}
+
+// evictionCauses returns the messages of the causes of a refused eviction,
+// such as the budget that refused it.
+func evictionCauses(st metav1.Status) string {
+	if st.Details == nil {
+		return ""
+	}
+	var causes []string
+	for _, c := range st.Details.Causes {
+		causes = append(causes, c.Message)
+	}
+	return strings.Join(causes, "; ")
+}
@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilexec "k8s.io/client-go/util/exec"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/kube"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// maxExecOutput bounds how much command output an exec trigger error
+// quotes.
+const maxExecOutput = 512
+
+// execTrigger runs the trigger's command and checks its exit code, unless
+// the trigger ignores it.
+func (e *Engine) execTrigger(ctx context.Context, x *scenario.ExecTrigger) error {
+	ns := x.NamespaceOrDefault()
+	pod := x.Pod
+	if pod == "" {
+		var err error
+		if pod, err = e.runningPod(ctx, ns, x.Selector); err != nil {
+			return err
+		}
+	}
+	what := fmt.Sprintf("exec %q in pod %s/%s", strings.Join(x.Command, " "), ns, pod)
+	stdout, stderr, err := e.clients.Exec(ctx, kube.ExecOptions{
+		Namespace: ns,
+		Pod:       pod,
+		Container: x.Container,
+		Command:   x.Command,
+	})
+	code := 0
+	if err != nil {
+		var exitErr utilexec.ExitError
+		if !errors.As(err, &exitErr) {
+			return fmt.Errorf("%s: %w", what, err)
+		}
+		code = exitErr.ExitStatus()
+	}
+	if code != x.ExpectExitCode && !x.IgnoreExitCode {
+		return fmt.Errorf("%s: exit code %d, want %d; stderr: %s", what, code, x.ExpectExitCode, clip(stderr))
+	}
+	e.log.Info("exec trigger ran", "command", x.Command, "pod", ns+"/"+pod, "exitCode", code, "stdout", clip(stdout))
+	return nil
+}
+
+// runningPod returns the first running pod in ns matching selector.
+func (e *Engine) runningPod(ctx context.Context, ns string, selector map[string]string) (string, error) {
+	sel := labels.SelectorFromSet(selector).String()
+	pods, err := e.kube.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{LabelSelector: sel})
+	if err != nil {
+		return "", fmt.Errorf("listing pods %s in %s: %w", sel, ns, err)
+	}
+	for _, p := range pods.Items {
+		if p.Status.Phase == corev1.PodRunning && p.DeletionTimestamp == nil {
+			return p.Name, nil
+		}
+	}
+	return "", fmt.Errorf("no running pod matches %s in %s", sel, ns)
+}
+
+func clip(b []byte) string {
+	s := strings.TrimSpace(string(b))
+	if len(s) > maxExecOutput {
+		return strings.ToValidUTF8(s[:maxExecOutput], "") + "…"
+	}
+	return s
+}
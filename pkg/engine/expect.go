@@ -0,0 +1,320 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/yaml"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/diagnostics"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// waitForExpectations polls until every expectation and event expectation
+// is met or the scenario timeout expires, running the scenario's chaos
+// action meanwhile; met expectations only count once the disruption is
+// over. Event expectations only match Events recorded since since. On
+// timeout, diffs holds the unmet conditions from the last poll; outcomes
+// always holds each expectation's outcome from the last poll, event
+// expectations last, with how long it took to be met.
+func (e *Engine) waitForExpectations(ctx context.Context, s *scenario.Scenario, cs *compiled, since time.Time, diffs *[]diagnostics.Diff, outcomes *[]ExpectationResult) error {
+	// The wait lasts as long as the longest expectation timeout;
+	// expectations with shorter ones fail the wait once theirs pass.
+	// Event and metric expectations have the scenario's.
+	n := len(cs.expect) + len(cs.events) + len(cs.metrics)
+	timeouts := make([]time.Duration, n)
+	timeout := s.TimeoutOrDefault()
+	if n > 0 {
+		timeout = 0
+	}
+	for i := range timeouts {
+		timeouts[i] = s.TimeoutOrDefault()
+		if i < len(cs.expect) {
+			timeouts[i] = cs.expect[i].TimeoutOr(s.TimeoutOrDefault())
+		}
+		timeout = max(timeout, timeouts[i])
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	chaos := e.startChaos(ctx, s)
+	var lastErr, fatal, expired error
+	gens := generations{}
+	// listFailed holds the groups whose prefetch LIST failed, read object
+	// by object for the rest of the wait.
+	listFailed := map[cacheKey]bool{}
+	met := make([]bool, n)
+	heldSince := make([]time.Time, len(cs.expect))
+	metAfter := make([]time.Duration, n)
+	start := time.Now()
+	err := wait.PollUntilContextCancel(ctx, e.pollInterval, true, func(ctx context.Context) (bool, error) {
+		*diffs = (*diffs)[:0]
+		*outcomes = make([]ExpectationResult, 0, n)
+		lastErr = nil
+		// record adds the outcome of expectation i, labeled label, whose
+		// check found d or failed with err.
+		record := func(i int, label string, outcome ExpectationResult, d []diagnostics.Diff, err error) {
+			outcome.Met = err == nil && len(d) == 0
+			outcome.Diffs = d
+			if outcome.Met && !met[i] {
+				metAfter[i] = time.Since(start)
+				e.log.Info("expectation met", "scenario", s.Name, "expectation", label, "after", metAfter[i])
+			}
+			met[i] = outcome.Met
+			if outcome.Met {
+				outcome.MetAfter = metAfter[i]
+			}
+			switch {
+			case err != nil:
+				outcome.Message = err.Error()
+			case len(d) > 0:
+				outcome.Message = describeDiffs(d)
+			}
+			*outcomes = append(*outcomes, outcome)
+			if !outcome.Met && timeouts[i] < timeout && time.Since(start) >= timeouts[i] && expired == nil {
+				expired = fmt.Errorf("%s not met within its timeout of %s: %s", label, timeouts[i], outcome.Message)
+			}
+			var notRetried *notRetriedError
+			if errors.As(err, &notRetried) && fatal == nil {
+				fatal = err
+			}
+			if err != nil {
+				lastErr = err
+				return
+			}
+			*diffs = append(*diffs, d...)
+		}
+		snap := e.prefetch(ctx, s.Expect, listFailed)
+		for i, exp := range cs.expect {
+			d, err := e.checkExpectation(ctx, snap, exp, gens)
+			d = checkConsistently(exp, d, err, &heldSince[i], time.Now())
+			record(i, exp.Label(), ExpectationResult{
+				Resource:    exp.Resource.String(),
+				ID:          exp.ID,
+				Description: exp.Description,
+			}, d, err)
+		}
+		for i, ev := range cs.events {
+			d, err := e.checkEvent(ctx, ev, since)
+			record(len(cs.expect)+i, ev.Label(), ExpectationResult{
+				Resource:    ev.InvolvedObject.String(),
+				ID:          ev.ID,
+				Description: ev.Description,
+			}, d, err)
+		}
+		for i, m := range cs.metrics {
+			d, err := e.checkMetric(ctx, m)
+			record(len(cs.expect)+len(cs.events)+i, m.Label(), ExpectationResult{
+				Resource:    m.Endpoint.String(),
+				ID:          m.ID,
+				Description: m.Description,
+			}, d, err)
+		}
+		if fatal != nil {
+			return false, fatal
+		}
+		if expired != nil {
+			return false, expired
+		}
+		happened, chaosErr := chaos.happened()
+		if chaosErr != nil {
+			return false, chaosErr
+		}
+		return happened && lastErr == nil && len(*diffs) == 0, nil
+	})
+	// Let an interrupted action clean up before the scenario tears down.
+	cancel()
+	chaos.wait()
+	if err == nil {
+		return nil
+	}
+	if fatal != nil {
+		return fmt.Errorf("expectations: %w", fatal)
+	}
+	if expired != nil {
+		return fmt.Errorf("expectations: %w", expired)
+	}
+	if _, chaosErr := chaos.happened(); chaosErr != nil && !errors.Is(chaosErr, context.DeadlineExceeded) {
+		return fmt.Errorf("chaos: %w", chaosErr)
+	}
+	if lastErr != nil {
+		return fmt.Errorf("expectations not met within %s: %w", timeout, lastErr)
+	}
+	return fmt.Errorf("expectations not met within %s: %s", timeout, describeDiffs(*diffs))
+}
+
+// checkExpectation fetches the expected resource, or those its label
+// selector matches, and returns the conditions, matched fields, and
+// generation requirements it does not satisfy. gens tracks generations
+// across the polls of one wait.
+func (e *Engine) checkExpectation(ctx context.Context, snap *snapshot, exp compiledExpectation, gens generations) ([]diagnostics.Diff, error) {
+	if exp.Resource.LabelSelector != nil {
+		return e.checkSelected(ctx, snap, exp, gens)
+	}
+	obj, err := e.readObject(ctx, snap, exp.Resource)
+	if exp.Absent {
+		return checkAbsent(exp.Expectation, obj, err)
+	}
+	if apierrors.IsNotFound(err) {
+		return nil, readFailure(exp.Expectation, err, fmt.Errorf("%s not found", exp.Resource))
+	}
+	if err != nil {
+		return nil, readFailure(exp.Expectation, err, fmt.Errorf("getting %s: %w", exp.Resource, err))
+	}
+	return e.checkObject(ctx, snap, exp, exp.Resource.String(), obj, gens)
+}
+
+// checkObject returns the conditions, matched fields, and generation
+// requirements of exp that obj, named resource in diffs, does not satisfy.
+func (e *Engine) checkObject(ctx context.Context, snap *snapshot, exp compiledExpectation, resource string, obj *unstructured.Unstructured, gens generations) ([]diagnostics.Diff, error) {
+	var diffs []diagnostics.Diff
+	for i, c := range exp.Conditions {
+		want, err := e.expectedValue(ctx, snap, exp.Expectation, c, exp.sources[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", resource, c.Path, err)
+		}
+		actual, found := exp.paths[i].lookup(obj.Object)
+		met, err := c.Compare(want, actual, found)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", resource, c.Path, err)
+		}
+		if !met {
+			diffs = append(diffs, diagnostics.Diff{
+				Resource:    resource,
+				Path:        c.Path,
+				Description: describe(exp.Expectation, &c),
+				Expected:    c.Want(want),
+				Actual:      actual,
+			})
+		}
+	}
+	n := len(diffs)
+	if exp.Matches != nil {
+		diffs = append(diffs, matchSubset(resource, "", exp.Matches, obj.Object)...)
+	}
+	diffs = append(diffs, checkGeneration(exp, resource, obj, gens, time.Now())...)
+	for i := n; i < len(diffs); i++ {
+		diffs[i].Description = describe(exp.Expectation, nil)
+	}
+	return diffs, nil
+}
+
+// checkAbsent returns a diff if the resource of exp, read as obj or failing
+// with err, still exists.
+func checkAbsent(exp scenario.Expectation, obj *unstructured.Unstructured, err error) ([]diagnostics.Diff, error) {
+	switch {
+	case apierrors.IsNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, readFailure(exp, err, fmt.Errorf("getting %s: %w", exp.Resource, err))
+	}
+	actual := "present"
+	if obj.GetDeletionTimestamp() != nil {
+		actual = "terminating"
+	}
+	return []diagnostics.Diff{{
+		Resource:    exp.Resource.String(),
+		Description: describe(exp, nil),
+		Expected:    "absent",
+		Actual:      actual,
+	}}, nil
+}
+
+// describe returns the description of a diff of exp, or of its condition
+// c if not nil: the condition's label if it has one, else the
+// expectation's, else nothing.
+func describe(exp scenario.Expectation, c *scenario.Condition) string {
+	if c != nil && (c.Description != "" || c.ID != "") {
+		return c.Label()
+	}
+	if exp.Description != "" || exp.ID != "" {
+		return exp.Label()
+	}
+	return ""
+}
+
+// expectedValue returns the value a condition expects, reading it from its
+// source resource or environment variable if it has one. src is the parsed
+// path of the source resource field; reads of it are retried like those of
+// exp's resource.
+func (e *Engine) expectedValue(ctx context.Context, snap *snapshot, exp scenario.Expectation, c scenario.Condition, src fieldPath) (any, error) {
+	switch {
+	case c.ValueFrom == nil:
+		return c.Value, nil
+	case c.ValueFrom.ResourceField != nil:
+		f := c.ValueFrom.ResourceField
+		obj, err := e.readObject(ctx, snap, f.ResourceRef)
+		if apierrors.IsNotFound(err) {
+			return nil, readFailure(exp, err, fmt.Errorf("valueFrom: %s not found", f.ResourceRef))
+		}
+		if err != nil {
+			return nil, readFailure(exp, err, fmt.Errorf("valueFrom: getting %s: %w", f.ResourceRef, err))
+		}
+		v, found := src.lookup(obj.Object)
+		if !found {
+			return nil, fmt.Errorf("valueFrom: %s has no %s", f.ResourceRef, f.Path)
+		}
+		return v, nil
+	}
+	raw, ok := os.LookupEnv(c.ValueFrom.Env)
+	if !ok {
+		return nil, fmt.Errorf("valueFrom: environment variable %s is not set", c.ValueFrom.Env)
+	}
+	var v any
+	if err := yaml.Unmarshal([]byte(raw), &v); err != nil {
+		return nil, fmt.Errorf("valueFrom: environment variable %s: %w", c.ValueFrom.Env, err)
+	}
+	return v, nil
+}
+
+// notRetriedError is a read error of a class its expectation does not
+// retry; it ends the wait at once.
+type notRetriedError struct {
+	class string
+	err   error
+}
+
+func (e *notRetriedError) Error() string {
+	return fmt.Sprintf("%v (%s is not retried)", e.err, e.class)
+}
+
+func (e *notRetriedError) Unwrap() error { return e.err }
+
+// readFailure returns err, which reports the read error cause, marked as
+// not retried if exp does not retry the class of cause.
+func readFailure(exp scenario.Expectation, cause, err error) error {
+	if class := errorClass(cause); class != "" && !exp.Retries(class) {
+		return &notRetriedError{class: class, err: err}
+	}
+	return err
+}
+
+// errorClass returns the scenario.ErrorClasses class of a read error, or
+// "" if it has none.
+func errorClass(err error) string {
+	var netErr net.Error
+	switch {
+	case apierrors.IsNotFound(err):
+		return scenario.ErrorNotFound
+	case apierrors.IsForbidden(err):
+		return scenario.ErrorForbidden
+	case apierrors.IsTimeout(err), apierrors.IsServerTimeout(err), errors.As(err, &netErr) && netErr.Timeout():
+		return scenario.ErrorTimeout
+	}
+	return ""
+}
+
+func describeDiffs(diffs []diagnostics.Diff) string {
+	parts := make([]string, len(diffs))
+	for i, d := range diffs {
+		parts[i] = fmt.Sprintf("%s: expected %v, got %v", d.Subject(), d.Expected, d.Actual)
+	}
+	return strings.Join(parts, "; ")
+}
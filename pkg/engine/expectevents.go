@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/diagnostics"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+type compiledEvent struct {
+	scenario.EventExpectation
+	message *regexp.Regexp
+}
+
+// compileEvents compiles the message patterns of events.
+func compileEvents(events []scenario.EventExpectation) ([]compiledEvent, error) {
+	var compiled []compiledEvent
+	for i, ev := range events {
+		re, err := regexp.Compile(ev.Message)
+		if err != nil {
+			return nil, fmt.Errorf("expectEvents[%d].message: %w", i, err)
+		}
+		compiled = append(compiled, compiledEvent{EventExpectation: ev, message: re})
+	}
+	return compiled, nil
+}
+
+// checkEvent lists the Events about the involved object of ev and returns a
+// diff if none recorded since since matches it.
+func (e *Engine) checkEvent(ctx context.Context, ev compiledEvent, since time.Time) ([]diagnostics.Diff, error) {
+	ref := ev.InvolvedObject
+	list, err := e.kube.CoreV1().Events(ev.NamespaceOrDefault()).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{"involvedObject.kind": ref.Kind, "involvedObject.name": ref.Name}.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing events about %s: %w", ref, err)
+	}
+	// Event timestamps have second precision.
+	since = since.Truncate(time.Second)
+	var seen []string
+	for _, event := range list.Items {
+		if event.Source.Component == eventComponent || event.ReportingController == eventComponent || eventTime(&event).Before(since) {
+			continue
+		}
+		if ev.matches(&event) {
+			return nil, nil
+		}
+		seen = append(seen, fmt.Sprintf("%s %s: %s", event.Type, event.Reason, event.Message))
+	}
+	actual := "no events"
+	if len(seen) > 0 {
+		actual = strings.Join(seen, "; ")
+	}
+	return []diagnostics.Diff{{
+		Resource:    ref.String(),
+		Path:        "events",
+		Description: ev.describe(),
+		Expected:    ev.want(),
+		Actual:      actual,
+	}}, nil
+}
+
+func (ev compiledEvent) matches(event *corev1.Event) bool {
+	return (ev.Reason == "" || event.Reason == ev.Reason) &&
+		(ev.Type == "" || event.Type == ev.Type) &&
+		ev.message.MatchString(event.Message)
+}
+
+// want describes the Event ev looks for.
+func (ev compiledEvent) want() string {
+	var parts []string
+	if ev.Type != "" {
+		parts = append(parts, "type "+ev.Type)
+	}
+	if ev.Reason != "" {
+		parts = append(parts, "reason "+ev.Reason)
+	}
+	if ev.Message != "" {
+		parts = append(parts, fmt.Sprintf("message matching %q", ev.Message))
+	}
+	if len(parts) == 0 {
+		return "an event"
+	}
+	return "an event with " + strings.Join(parts, ", ")
+}
+
+// describe returns the description of the diffs of ev: its label if the
+// scenario gives it one.
+func (ev compiledEvent) describe() string {
+	if ev.Description != "" || ev.ID != "" {
+		return ev.Label()
+	}
+	return ""
+}
+
+// eventTime returns when event was last recorded.
+func eventTime(event *corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
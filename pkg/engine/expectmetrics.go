@@ -0,0 +1,183 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/diagnostics"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// metricsAccept asks for the Prometheus text format, which every client
+// library serves, rather than protobuf or OpenMetrics.
+const metricsAccept = "text/plain;version=0.0.4"
+
+type compiledMetric struct {
+	scenario.MetricExpectation
+	expr *scenario.MetricExpr
+}
+
+// compileMetrics parses the expressions of metrics.
+func compileMetrics(metrics []scenario.MetricExpectation) ([]compiledMetric, error) {
+	var compiled []compiledMetric
+	for i, m := range metrics {
+		expr, err := scenario.ParseMetricExpr(m.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("expectMetrics[%d].expr: %w", i, err)
+		}
+		compiled = append(compiled, compiledMetric{MetricExpectation: m, expr: expr})
+	}
+	return compiled, nil
+}
+
+// checkMetric scrapes the endpoint of m through the API server's proxy and
+// returns a diff if the sum of the series m selects fails its comparison.
+// An endpoint that cannot be scraped yet, such as an agent without a ready
+// pod, is an error and so retried.
+func (e *Engine) checkMetric(ctx context.Context, m compiledMetric) ([]diagnostics.Diff, error) {
+	target, err := e.proxyPath(ctx, &m.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("scraping %s: %w", &m.Endpoint, err)
+	}
+	data, err := e.kube.CoreV1().RESTClient().Get().AbsPath(target+m.PathOrDefault()).
+		SetHeader("Accept", metricsAccept).DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("scraping %s%s: %w", &m.Endpoint, m.PathOrDefault(), err)
+	}
+	samples, err := parseMetrics(data)
+	if err != nil {
+		return nil, fmt.Errorf("scraping %s%s: %w", &m.Endpoint, m.PathOrDefault(), err)
+	}
+	var sum float64
+	found := false
+	for _, s := range samples {
+		if s.name == m.expr.Name && m.expr.Matches(s.labels) {
+			sum += s.value
+			found = true
+		}
+	}
+	if found && m.expr.Compare(sum) {
+		return nil, nil
+	}
+	var actual any = sum
+	if !found {
+		actual = "no matching series"
+	}
+	return []diagnostics.Diff{{
+		Resource:    m.Endpoint.String(),
+		Path:        m.expr.Selector(),
+		Description: m.describe(),
+		Expected:    fmt.Sprintf("%s %s", m.expr.Op, strconv.FormatFloat(m.expr.Value, 'g', -1, 64)),
+		Actual:      actual,
+	}}, nil
+}
+
+// describe returns the description of the diffs of m: its label if the
+// scenario gives it one.
+func (m compiledMetric) describe() string {
+	if m.Description != "" || m.ID != "" {
+		return m.Label()
+	}
+	return ""
+}
+
+type sample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// parseMetrics parses the samples of the Prometheus text exposition format.
+// Comments, including HELP and TYPE lines, and timestamps are ignored.
+func parseMetrics(data []byte) ([]sample, error) {
+	var samples []sample
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		s, err := parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		samples = append(samples, s)
+	}
+	return samples, sc.Err()
+}
+
+// parseSample parses a line such as
+// http_requests_total{method="post",code="200"} 1027 1395066363000.
+func parseSample(line string) (sample, error) {
+	s := sample{labels: map[string]string{}}
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return s, fmt.Errorf("no value in %q", line)
+	}
+	s.name, line = line[:end], line[end:]
+	if strings.HasPrefix(line, "{") {
+		line = line[1:]
+		for {
+			line = strings.TrimLeft(line, " \t,")
+			if strings.HasPrefix(line, "}") {
+				line = line[1:]
+				break
+			}
+			eq := strings.Index(line, "=")
+			if eq <= 0 || len(line) < eq+2 || line[eq+1] != '"' {
+				return s, errors.New("malformed labels")
+			}
+			name := strings.TrimSpace(line[:eq])
+			value, rest, err := unquoteLabel(line[eq+2:])
+			if err != nil {
+				return s, fmt.Errorf("label %s: %w", name, err)
+			}
+			s.labels[name], line = value, rest
+		}
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return s, fmt.Errorf("no value for %s", s.name)
+	}
+	var err error
+	if s.value, err = strconv.ParseFloat(fields[0], 64); err != nil {
+		return s, fmt.Errorf("value of %s: %w", s.name, err)
+	}
+	switch {
+	case len(fields) > 2:
+		return s, fmt.Errorf("unexpected %q after the timestamp of %s", strings.Join(fields[2:], " "), s.name)
+	case len(fields) == 2:
+		if _, err := strconv.ParseInt(fields[1], 10, 64); err != nil {
+			return s, fmt.Errorf("timestamp of %s: %w", s.name, err)
+		}
+	}
+	return s, nil
+}
+
+// unquoteLabel reads a label value up to its closing quote, undoing the
+// escapes of the exposition format, and returns what follows it.
+func unquoteLabel(s string) (value, rest string, err error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			return b.String(), s[i+1:], nil
+		case c == '\\' && i+1 < len(s):
+			i++
+			if s[i] == 'n' {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", errors.New("unterminated value")
+}
@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMetrics(t *testing.T) {
+	data := `# HELP http_requests_total The total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+http_requests_total{method="post", code="400",} 3
+
+  # An indented comment.
+queue_depth 4.5
+escaped{path="C:\\dir\\",msg="say \"hi\"\nbye",empty=""} 1e3
+empty_labels{} -1
+not_a_number NaN
+upper +Inf
+`
+	got, err := parseMetrics([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []sample{
+		{name: "http_requests_total", labels: map[string]string{"method": "post", "code": "200"}, value: 1027},
+		{name: "http_requests_total", labels: map[string]string{"method": "post", "code": "400"}, value: 3},
+		{name: "queue_depth", labels: map[string]string{}, value: 4.5},
+		{name: "escaped", labels: map[string]string{"path": `C:\dir\`, "msg": "say \"hi\"\nbye", "empty": ""}, value: 1000},
+		{name: "empty_labels", labels: map[string]string{}, value: -1},
+		{name: "upper", labels: map[string]string{}, value: math.Inf(1)},
+	}
+	// NaN never equals itself; check it apart.
+	if len(got) != len(want)+1 || !math.IsNaN(got[5].value) || got[5].name != "not_a_number" {
+		t.Fatalf("parseMetrics() = %+v", got)
+	}
+	got = append(got[:5], got[6:]...)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMetrics() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseMetricsMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		err  string
+	}{
+		{name: "no value", line: "queue_depth", err: `no value in "queue_depth"`},
+		{name: "no value after labels", line: `queue_depth{a="b"}`, err: "no value for queue_depth"},
+		{name: "no name", line: `{a="b"} 1`, err: "no value in"},
+		{name: "unquoted label", line: `queue_depth{a=b} 1`, err: "malformed labels"},
+		{name: "label without value", line: `queue_depth{a} 1`, err: "malformed labels"},
+		{name: "unclosed labels", line: `queue_depth{a="b" 1`, err: "malformed labels"},
+		{name: "unterminated label value", line: `queue_depth{a="b} 1`, err: "label a: unterminated value"},
+		{name: "value not a number", line: "queue_depth high", err: "value of queue_depth"},
+		{name: "timestamp not an integer", line: "queue_depth 1 now", err: "timestamp of queue_depth"},
+		{name: "trailing fields", line: "queue_depth 1 1395066363000 extra", err: `unexpected "extra"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := "# TYPE queue_depth gauge\nok 1\n" + tt.line + "\n"
+			_, err := parseMetrics([]byte(data))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("parseMetrics(%q) error = %v, want %q", tt.line, err, tt.err)
+			}
+			if !strings.HasPrefix(err.Error(), "line 3: ") {
+				t.Errorf("parseMetrics(%q) error = %v, want it on line 3", tt.line, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// exportTimeout bounds how long setup waits for an exported field to be
+// set, such as a pod's node name once it is scheduled.
+const exportTimeout = time.Minute
+
+// readExports reads the values of the setup exports of cs, in order, so an
+// export's resource name may refer to the ones before it. generated holds
+// the names generated during setup.
+func (e *Engine) readExports(ctx context.Context, cs *compiled, generated map[string]string) (map[string]string, error) {
+	s := cs.scenario
+	if len(s.Setup.Exports) == 0 {
+		return nil, nil
+	}
+	exports := map[string]string{}
+	for i, x := range s.Setup.Exports {
+		ref, err := s.RenderExportResource(i, generated, exports)
+		if err != nil {
+			return nil, err
+		}
+		var value any
+		var lastErr error
+		waitCtx, cancel := context.WithTimeout(ctx, exportTimeout)
+		err = wait.PollUntilContextCancel(waitCtx, e.pollInterval, true, func(ctx context.Context) (bool, error) {
+			obj, err := e.getObject(ctx, ref)
+			switch {
+			case apierrors.IsNotFound(err):
+				lastErr = err
+				return false, nil
+			case err != nil:
+				return false, err
+			}
+			var found bool
+			value, found = cs.exports[i].lookup(obj.Object)
+			// An empty value is as good as unset: nothing could refer to it.
+			set := found && value != nil && value != ""
+			if !set {
+				lastErr = fmt.Errorf("%s is not set", x.Path)
+			}
+			return set, nil
+		})
+		cancel()
+		if err != nil {
+			if lastErr != nil {
+				err = lastErr
+			}
+			return nil, fmt.Errorf("setup.exports[%d]: reading %s of %s: %w", i, x.Path, ref, err)
+		}
+		if exports[x.Name], err = exportString(value); err != nil {
+			return nil, fmt.Errorf("setup.exports[%d]: %w", i, err)
+		}
+		e.log.Info("exported setup value", "name", x.Name, "resource", ref, "value", exports[x.Name])
+	}
+	return exports, nil
+}
+
+// exportString returns how an exported value is rendered: strings as they
+// are and other values as JSON.
+func exportString(v any) (string, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
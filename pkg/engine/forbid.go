@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/agent"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// verifyForbiddenMutations fails if an agent wrote to resources the
+// scenario forbids it to touch, as recorded in their managedFields since
+// the scenario started.
+func (e *Engine) verifyForbiddenMutations(ctx context.Context, s *scenario.Scenario, specs []agent.Spec, since time.Time) error {
+	managers := fieldManagers(s, specs)
+	var errs []error
+	for i, f := range s.ForbiddenMutations {
+		objs, err := e.listSelected(ctx, f.Resources)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("forbiddenMutations[%d]: %w", i, err))
+			continue
+		}
+		for _, obj := range objs {
+			if _, w := writtenBy(&obj, map[string]string{f.Agent: managers[f.Agent]}, since); w != nil {
+				errs = append(errs, fmt.Errorf("agent %s modified %s %s (%s at %s)", f.Agent,
+					obj.GetKind(), objectName(&obj), w.Operation, w.Time.UTC().Format(time.RFC3339)))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("forbidden mutations:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// fieldManagers maps the scenario's agents to the field managers their
+// writes carry.
+func fieldManagers(s *scenario.Scenario, specs []agent.Spec) map[string]string {
+	managers := map[string]string{}
+	for _, name := range s.Agents {
+		managers[name] = name
+	}
+	for _, spec := range specs {
+		managers[spec.Name] = spec.FieldManagerOrDefault()
+	}
+	return managers
+}
+
+// writtenBy returns the first agent, of managers mapping agents to field
+// managers, that wrote to obj since the given time, and its managedFields
+// entry.
+func writtenBy(obj *unstructured.Unstructured, managers map[string]string, since time.Time) (string, *metav1.ManagedFieldsEntry) {
+	// managedFields times have second precision.
+	since = since.Truncate(time.Second)
+	for _, mf := range obj.GetManagedFields() {
+		if mf.Time == nil || mf.Time.Time.Before(since) {
+			continue
+		}
+		for name, manager := range managers {
+			if mf.Manager == manager {
+				return name, &mf
+			}
+		}
+	}
+	return "", nil
+}
+
+// listSelected lists the resources sel selects.
+func (e *Engine) listSelected(ctx context.Context, sel scenario.ResourceSelector) ([]unstructured.Unstructured, error) {
+	gv, err := schema.ParseGroupVersion(sel.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	ri, err := e.resourceInterface(gv.WithKind(sel.Kind), sel.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	var opts metav1.ListOptions
+	if sel.Selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(sel.Selector)
+		if err != nil {
+			return nil, err
+		}
+		opts.LabelSelector = selector.String()
+	}
+	list, err := ri.List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("listing %s: %w", sel, err)
+	}
+	return list.Items, nil
+}
+
+func objectName(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetName()
+	}
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
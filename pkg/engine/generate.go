@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"context"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// generate creates a generator's objects, at most g.parallelism at a time,
+// and stops at the first failure.
+func (e *Engine) generate(ctx context.Context, g compiledGenerator) error {
+	err := forEach(ctx, g.objs, g.parallelism, func(ctx context.Context, obj *unstructured.Unstructured) error {
+		return e.applyUnstructured(ctx, obj.DeepCopy())
+	})
+	if err != nil {
+		return err
+	}
+	e.log.Info("generated resources", "count", len(g.objs))
+	return nil
+}
+
+// forEach calls fn for each item, at most parallelism at a time, and
+// returns the first error, cancelling the calls still running.
+func forEach[T any](ctx context.Context, items []T, parallelism int, fn func(context.Context, T) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, max(parallelism, 1))
+	for _, item := range items {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(ctx, item); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
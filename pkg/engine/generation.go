@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/diagnostics"
+)
+
+// generations remembers, per resource, the generation last seen and since
+// when, so expectations can require it to be stable. Each wait keeps its
+// own.
+type generations map[string]generationSeen
+
+type generationSeen struct {
+	generation int64
+	since      time.Time
+}
+
+// checkGeneration returns the diffs of the observedGeneration and
+// generationStableFor parts of exp against obj, named resource.
+func checkGeneration(exp compiledExpectation, resource string, obj *unstructured.Unstructured, gens generations, now time.Time) []diagnostics.Diff {
+	var diffs []diagnostics.Diff
+	generation := obj.GetGeneration()
+	if exp.ObservedGeneration {
+		observed, found, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+		if !found || observed != generation {
+			var actual any
+			if found {
+				actual = observed
+			}
+			diffs = append(diffs, diagnostics.Diff{
+				Resource: resource,
+				Path:     ".status.observedGeneration",
+				Expected: generation,
+				Actual:   actual,
+			})
+		}
+	}
+	if d := exp.GenerationStableFor; d != nil {
+		seen, ok := gens[resource]
+		if !ok || seen.generation != generation {
+			seen = generationSeen{generation: generation, since: now}
+			gens[resource] = seen
+		}
+		if stable := now.Sub(seen.since); stable < d.Duration {
+			diffs = append(diffs, diagnostics.Diff{
+				Resource: resource,
+				Path:     ".metadata.generation",
+				Expected: fmt.Sprintf("%d unchanged for %s", generation, d.Duration),
+				Actual:   fmt.Sprintf("%d unchanged for %s", generation, stable.Round(time.Second)),
+			})
+		}
+	}
+	return diffs
+}
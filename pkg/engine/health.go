@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/agent"
+)
+
+// AgentHealth is how a deployed agent's readiness behaved over a scenario.
+type AgentHealth struct {
+	Agent string
+	// TimeToReady is how long the agent took from being deployed to
+	// having a ready pod; zero if it never became ready.
+	TimeToReady time.Duration
+	// ImageID is the image, by digest, the agent's ready pod ran, so
+	// results name the exact build even when the image is given by tag.
+	ImageID string
+	// Flaps are the periods, after first becoming ready, in which the
+	// agent had no ready pod, to within the poll interval. Chaos triggers
+	// that restart or kill the agent show up here too.
+	Flaps []Flap
+}
+
+// Flap is a period in which an agent had no ready pod.
+type Flap struct {
+	At time.Time
+	// Duration is zero if the agent was still not ready when the scenario
+	// ended.
+	Duration time.Duration
+}
+
+// monitorAgents polls the readiness of the agents in res.Agents until the
+// returned function is called, recording the periods they were not ready.
+func (e *Engine) monitorAgents(ctx context.Context, res *Result) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	health := make([]AgentHealth, len(res.Agents))
+	copy(health, res.Agents)
+	go func() {
+		defer close(done)
+		wait.UntilWithContext(ctx, func(ctx context.Context) {
+			for i := range health {
+				e.pollReadiness(ctx, &health[i])
+			}
+		}, e.pollInterval)
+	}()
+	return func() {
+		cancel()
+		<-done
+		res.Agents = health
+	}
+}
+
+// pollReadiness records a flap starting or ending for h.
+func (e *Engine) pollReadiness(ctx context.Context, h *AgentHealth) {
+	_, _, err := e.agents.ReadyPod(ctx, h.Agent)
+	if ctx.Err() != nil {
+		return
+	}
+	n := len(h.Flaps)
+	flapping := n > 0 && h.Flaps[n-1].Duration == 0
+	switch {
+	case err != nil && !flapping:
+		e.log.Info("agent not ready", "agent", h.Agent, "error", err)
+		h.Flaps = append(h.Flaps, Flap{At: time.Now()})
+	case err == nil && flapping:
+		h.Flaps[n-1].Duration = time.Since(h.Flaps[n-1].At)
+		e.log.Info("agent ready again", "agent", h.Agent, "after", h.Flaps[n-1].Duration)
+	}
+}
+
+// waitReady waits for the deployed agents concurrently, so each one's
+// time to ready, counted from deployedAt, is not inflated by the others.
+func (e *Engine) waitReady(ctx context.Context, specs []agent.Spec, deployedAt []time.Time, res *Result) error {
+	readyCtx, cancel := context.WithTimeout(ctx, e.agentTimeout)
+	defer cancel()
+	health := make([]AgentHealth, len(specs))
+	errs := make([]error, len(specs))
+	var wg sync.WaitGroup
+	for i, spec := range specs {
+		health[i].Agent = spec.Name
+		wg.Go(func() {
+			if errs[i] = e.agents.WaitReady(readyCtx, spec.Name); errs[i] != nil {
+				return
+			}
+			health[i].TimeToReady = time.Since(deployedAt[i])
+			id, err := e.agents.ImageID(readyCtx, spec.Name)
+			if err != nil {
+				e.log.Warn("reading agent image ID", "agent", spec.Name, "error", err)
+				return
+			}
+			health[i].ImageID = id
+		})
+	}
+	wg.Wait()
+	res.Agents = health
+	return errors.Join(errs...)
+}
@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+const (
+	// httpTriggerTimeout bounds waiting for the endpoint of an HTTP trigger
+	// to be reachable, e.g. for a freshly applied Service to get endpoints.
+	httpTriggerTimeout = time.Minute
+	httpRetryInterval  = time.Second
+)
+
+// callHTTP performs an HTTP trigger through the API server's service or
+// pod proxy. Calls the proxy cannot deliver, such as to a Service without
+// ready endpoints yet, are retried.
+func (e *Engine) callHTTP(ctx context.Context, h *scenario.HTTPTrigger) error {
+	target, err := e.proxyPath(ctx, &h.Endpoint)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(h.Path)
+	if err != nil {
+		return fmt.Errorf("path: %w", err)
+	}
+	var body []byte
+	contentType := "text/plain"
+	switch b := h.Body.(type) {
+	case nil:
+	case string:
+		body = []byte(b)
+	default:
+		if body, err = json.Marshal(b); err != nil {
+			return fmt.Errorf("body: %w", err)
+		}
+		contentType = "application/json"
+	}
+
+	what := fmt.Sprintf("%s %s%s", h.MethodOrDefault(), target, h.Path)
+	var status int
+	var callErr error
+	ctx, cancel := context.WithTimeout(ctx, httpTriggerTimeout)
+	defer cancel()
+	err = wait.PollUntilContextCancel(ctx, httpRetryInterval, true, func(ctx context.Context) (bool, error) {
+		req := e.kube.CoreV1().RESTClient().Verb(h.MethodOrDefault()).AbsPath(target + u.Path)
+		for key, values := range u.Query() {
+			for _, v := range values {
+				req = req.Param(key, v)
+			}
+		}
+		if body != nil {
+			req = req.Body(body).SetHeader("Content-Type", contentType)
+		}
+		for key, v := range h.Headers {
+			req = req.SetHeader(key, v)
+		}
+		res := req.Do(ctx)
+		status = 0
+		res.StatusCode(&status)
+		callErr = res.Error()
+		if status == http.StatusBadGateway || status == http.StatusServiceUnavailable {
+			// The proxy could not reach the endpoint, or it is not ready
+			// yet; unless that is what the scenario expects, try again.
+			return status == h.ExpectStatus, nil
+		}
+		return status != 0 || !isTransient(callErr), nil
+	})
+	if err != nil && status == 0 {
+		return fmt.Errorf("%s: %w", what, errors.Join(err, callErr))
+	}
+	if (h.ExpectStatus != 0 && status != h.ExpectStatus) || (h.ExpectStatus == 0 && status/100 != 2) {
+		msg := fmt.Sprintf("%s: got status %d", what, status)
+		if h.ExpectStatus != 0 {
+			msg += fmt.Sprintf(", want %d", h.ExpectStatus)
+		}
+		if callErr != nil {
+			msg += ": " + callErr.Error()
+		}
+		return errors.New(msg)
+	}
+	e.log.Info("http trigger called", "request", what, "status", status)
+	return nil
+}
+
+// proxyPath returns the API server proxy path of an endpoint.
+func (e *Engine) proxyPath(ctx context.Context, h *scenario.Endpoint) (string, error) {
+	if h.Service != "" {
+		return fmt.Sprintf("/api/v1/namespaces/%s/services/%s:%s:%s/proxy",
+			h.NamespaceOrDefault(), h.SchemeOrDefault(), h.Service, h.Port.String()), nil
+	}
+	if e.agents == nil {
+		return "", errors.New("calling an agent needs agents deployed by the framework")
+	}
+	ns, pod, err := e.agents.ReadyPod(ctx, h.Agent)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("/api/v1/namespaces/%s/pods/%s:%s:%s/proxy",
+		ns, h.SchemeOrDefault(), pod, h.Port.String()), nil
+}
+
+// isTransient reports whether err may go away on retry.
+func isTransient(err error) bool {
+	return err != nil && (apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) ||
+		apierrors.IsTooManyRequests(err) || apierrors.IsServiceUnavailable(err))
+}
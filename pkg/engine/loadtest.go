@@ -0,0 +1,238 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// maxLoadErrors bounds how many arrival errors a LoadResult keeps.
+const maxLoadErrors = 5
+
+// LoadResult summarizes the load test of a scenario.
+type LoadResult struct {
+	// Arrivals is the number of objects the load test created or tried to.
+	Arrivals     int
+	CreateErrors int
+	// TimedOut counts objects that were created but did not converge
+	// within the scenario timeout.
+	TimedOut int
+	// Latencies holds the convergence latency of each object that
+	// converged, sorted, to within the poll interval.
+	Latencies []time.Duration
+	// Elapsed runs from the first arrival to the last outcome.
+	Elapsed time.Duration
+	// Errors holds the first few create errors and timeouts.
+	Errors []string
+}
+
+// Converged returns the number of objects that converged.
+func (l *LoadResult) Converged() int { return len(l.Latencies) }
+
+// ErrorRate returns the fraction of arrivals that failed to be created or
+// to converge.
+func (l *LoadResult) ErrorRate() float64 {
+	if l.Arrivals == 0 {
+		return 0
+	}
+	return float64(l.CreateErrors+l.TimedOut) / float64(l.Arrivals)
+}
+
+// Throughput returns the converged objects per second.
+func (l *LoadResult) Throughput() float64 {
+	if l.Elapsed <= 0 {
+		return 0
+	}
+	return float64(l.Converged()) / l.Elapsed.Seconds()
+}
+
+// Percentile returns the p-th percentile (0-100) convergence latency, by
+// the nearest-rank method; 0 when nothing converged.
+func (l *LoadResult) Percentile(p float64) time.Duration {
+	if len(l.Latencies) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(l.Latencies))))
+	return l.Latencies[min(max(rank, 1), len(l.Latencies))-1]
+}
+
+func (l *LoadResult) addError(err string) {
+	if len(l.Errors) < maxLoadErrors {
+		l.Errors = append(l.Errors, err)
+	}
+}
+
+// arrival is an object created by the load test, awaiting convergence.
+type arrival struct {
+	exp     compiledExpectation
+	created time.Time
+}
+
+// runLoad creates the load test's objects at its rate, from a goroutine
+// each so slow creates do not slow the arrivals, while one loop evaluates
+// every pending object each poll interval.
+func (e *Engine) runLoad(ctx context.Context, s *scenario.Scenario, res *Result) error {
+	l := s.Load
+	render, err := l.Renderer()
+	if err != nil {
+		return err
+	}
+	paths, sources, err := compileConditions(l.Expect)
+	if err != nil {
+		return fmt.Errorf("load.expect: %w", err)
+	}
+
+	lr := &LoadResult{Arrivals: l.Arrivals()}
+	res.Load = lr
+	var (
+		mu      sync.Mutex
+		pending []arrival
+		creates sync.WaitGroup
+	)
+	created := make(chan struct{})
+	evaluated := make(chan struct{})
+	start := time.Now()
+	go func() {
+		defer close(evaluated)
+		e.evaluateArrivals(ctx, s.TimeoutOrDefault(), lr, &mu, &pending, created)
+	}()
+
+	ticker := time.NewTicker(l.Interval())
+	defer ticker.Stop()
+	for i := range lr.Arrivals {
+		if i > 0 {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		obj, err := render(i)
+		if err != nil {
+			mu.Lock()
+			lr.CreateErrors++
+			lr.addError(err.Error())
+			mu.Unlock()
+			continue
+		}
+		u := &unstructured.Unstructured{Object: obj}
+		creates.Add(1)
+		go func() {
+			defer creates.Done()
+			at := time.Now()
+			err := e.applyUnstructured(ctx, u)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				lr.CreateErrors++
+				lr.addError(err.Error())
+				return
+			}
+			ref := scenario.ResourceRef{APIVersion: u.GetAPIVersion(), Kind: u.GetKind(), Name: u.GetName(), Namespace: u.GetNamespace()}
+			pending = append(pending, arrival{
+				exp:     compiledExpectation{Expectation: scenario.Expectation{Resource: ref, Conditions: l.Expect}, paths: paths, sources: sources},
+				created: at,
+			})
+		}()
+	}
+	creates.Wait()
+	close(created)
+	<-evaluated
+	lr.Elapsed = time.Since(start)
+	slices.Sort(lr.Latencies)
+	e.log.Info("load test finished", "scenario", s.Name, "arrivals", lr.Arrivals,
+		"converged", lr.Converged(), "errorRate", lr.ErrorRate(), "p99", lr.Percentile(99))
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return loadError(l, lr)
+}
+
+// evaluateArrivals checks every pending arrival each poll interval until
+// created is closed and none are pending, recording each outcome in lr.
+func (e *Engine) evaluateArrivals(ctx context.Context, timeout time.Duration, lr *LoadResult, mu *sync.Mutex, pending *[]arrival, created <-chan struct{}) {
+	ticker := time.NewTicker(e.pollInterval)
+	defer ticker.Stop()
+	gens := generations{}
+	listFailed := map[cacheKey]bool{}
+	done := false
+	for {
+		select {
+		case <-ticker.C:
+		case <-created:
+			// Keep polling at the interval; just stop waiting on created.
+			created, done = nil, true
+			continue
+		case <-ctx.Done():
+			return
+		}
+		mu.Lock()
+		batch := slices.Clone(*pending)
+		mu.Unlock()
+		if done && len(batch) == 0 {
+			return
+		}
+
+		exps := make([]scenario.Expectation, len(batch))
+		for i, a := range batch {
+			exps[i] = a.exp.Expectation
+		}
+		snap := e.prefetch(ctx, exps, listFailed)
+		now := time.Now()
+		resolved := map[string]bool{}
+		var latencies []time.Duration
+		var timedOut []string
+		for _, a := range batch {
+			d, err := e.checkExpectation(ctx, snap, a.exp, gens)
+			switch {
+			case err == nil && len(d) == 0:
+				latencies = append(latencies, now.Sub(a.created))
+			case now.Sub(a.created) > timeout:
+				msg := describeDiffs(d)
+				if err != nil {
+					msg = err.Error()
+				}
+				timedOut = append(timedOut, fmt.Sprintf("%s did not converge within %s: %s", a.exp.Resource, timeout, msg))
+			default:
+				continue
+			}
+			resolved[a.exp.Resource.String()] = true
+		}
+		mu.Lock()
+		lr.Latencies = append(lr.Latencies, latencies...)
+		lr.TimedOut += len(timedOut)
+		for _, msg := range timedOut {
+			lr.addError(msg)
+		}
+		*pending = slices.DeleteFunc(*pending, func(a arrival) bool { return resolved[a.exp.Resource.String()] })
+		mu.Unlock()
+	}
+}
+
+// loadError fails a load test that exceeded its error rate or latency
+// bounds.
+func loadError(l *scenario.LoadTest, lr *LoadResult) error {
+	if rate := lr.ErrorRate(); rate > l.MaxErrorRate {
+		err := fmt.Errorf("%d of %d arrivals failed (error rate %.3f, max %.3f)",
+			lr.CreateErrors+lr.TimedOut, lr.Arrivals, rate, l.MaxErrorRate)
+		if len(lr.Errors) > 0 {
+			err = fmt.Errorf("%w; first: %s", err, lr.Errors[0])
+		}
+		return err
+	}
+	if l.MaxP99 != nil {
+		if p99 := lr.Percentile(99); p99 > l.MaxP99.Duration {
+			return fmt.Errorf("p99 convergence latency %s exceeds maxP99 %s", p99, l.MaxP99.Duration)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/restmapper"
+)
+
+// minMapperRefresh rate-limits discovery refreshes triggered by unknown
+// kinds, so polling an expectation on a CRD that is not installed yet does
+// not re-run discovery on every tick.
+const minMapperRefresh = 2 * time.Second
+
+// refreshingMapper resolves kinds through cached discovery and refreshes the
+// cache when a kind is unknown, so CRDs installed mid-run become resolvable
+// without restarting the engine.
+type refreshingMapper struct {
+	mapper *restmapper.DeferredDiscoveryRESTMapper
+
+	mu          sync.Mutex
+	lastRefresh time.Time
+}
+
+func newRefreshingMapper(client discovery.DiscoveryInterface) *refreshingMapper {
+	cached := memory.NewMemCacheClient(client)
+	return &refreshingMapper{mapper: restmapper.NewDeferredDiscoveryRESTMapper(cached)}
+}
+
+// RESTMapping maps gk to a resource, refreshing discovery once on a miss.
+func (m *refreshingMapper) RESTMapping(gk schema.GroupKind, versions ...string) (*meta.RESTMapping, error) {
+	mapping, err := m.mapper.RESTMapping(gk, versions...)
+	if err == nil || !meta.IsNoMatchError(err) || !m.refresh() {
+		return mapping, err
+	}
+	return m.mapper.RESTMapping(gk, versions...)
+}
+
+// KindFor resolves a kind named without group or version, such as
+// Deployment, to its preferred group and version.
+func (m *refreshingMapper) KindFor(kind string) (schema.GroupVersionKind, error) {
+	gvr := schema.GroupVersionResource{Resource: strings.ToLower(kind)}
+	gvk, err := m.mapper.KindFor(gvr)
+	if err == nil || !meta.IsNoMatchError(err) || !m.refresh() {
+		return gvk, err
+	}
+	return m.mapper.KindFor(gvr)
+}
+
+// refresh invalidates the discovery cache unless that happened very
+// recently, and reports whether it did.
+func (m *refreshingMapper) refresh() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if time.Since(m.lastRefresh) < minMapperRefresh {
+		return false
+	}
+	m.mapper.Reset()
+	m.lastRefresh = time.Now()
+	return true
+}
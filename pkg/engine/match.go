@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/diagnostics"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// matchSubset compares got with want, a partial object, and returns a diff
+// for every field of want that got lacks or holds another value in. Lists
+// of objects match element by merge key when the expected elements have
+// one, and otherwise each expected element must match some element of
+// got; lists of scalars must contain every expected value, in any order.
+func matchSubset(resource, path string, want, got any) []diagnostics.Diff {
+	diff := func(path string, expected, actual any) []diagnostics.Diff {
+		return []diagnostics.Diff{{Resource: resource, Path: path, Expected: expected, Actual: actual}}
+	}
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			return diff(path, w, got)
+		}
+		var diffs []diagnostics.Diff
+		for _, k := range slices.Sorted(maps.Keys(w)) {
+			diffs = append(diffs, matchSubset(resource, path+"."+k, w[k], g[k])...)
+		}
+		return diffs
+	case []any:
+		g, ok := got.([]any)
+		if !ok {
+			return diff(path, w, got)
+		}
+		if key, ok := scenario.MergeKey(w); ok {
+			var diffs []diagnostics.Diff
+			for _, we := range w {
+				id := we.(map[string]any)[key]
+				elemPath := fmt.Sprintf("%s[%s=%v]", path, key, id)
+				i := slices.IndexFunc(g, func(ge any) bool {
+					m, ok := ge.(map[string]any)
+					return ok && scenario.ValuesEqual(id, m[key])
+				})
+				if i < 0 {
+					diffs = append(diffs, diff(elemPath, we, nil)...)
+					continue
+				}
+				diffs = append(diffs, matchSubset(resource, elemPath, we, g[i])...)
+			}
+			return diffs
+		}
+		var diffs []diagnostics.Diff
+		for i, we := range w {
+			if !slices.ContainsFunc(g, func(ge any) bool { return len(matchSubset(resource, path, we, ge)) == 0 }) {
+				diffs = append(diffs, diff(fmt.Sprintf("%s[%d]", path, i), we, g)...)
+			}
+		}
+		return diffs
+	}
+	if !scenario.ValuesEqual(want, got) {
+		return diff(path, want, got)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/diagnostics"
+)
+
+func TestMatchSubset(t *testing.T) {
+	got := map[string]any{
+		"metadata": map[string]any{
+			"name":   "app",
+			"labels": map[string]any{"tier": "web", "team": "a"},
+		},
+		"spec": map[string]any{
+			"replicas": int64(3),
+			"containers": []any{
+				map[string]any{"name": "app", "image": "app:2", "args": []any{"-v", "--port=80"}},
+				map[string]any{"name": "sidecar", "image": "proxy:1"},
+			},
+			"tolerations": []any{
+				map[string]any{"effect": "NoSchedule", "operator": "Exists"},
+			},
+		},
+	}
+	diff := func(path string, expected, actual any) diagnostics.Diff {
+		return diagnostics.Diff{Resource: "Deployment/app", Path: path, Expected: expected, Actual: actual}
+	}
+	tests := []struct {
+		name string
+		want map[string]any
+		diff []diagnostics.Diff
+	}{
+		{
+			name: "subset of fields",
+			want: map[string]any{
+				"metadata": map[string]any{"labels": map[string]any{"tier": "web"}},
+				"spec":     map[string]any{"replicas": float64(3)},
+			},
+		},
+		{
+			name: "other value and missing field",
+			want: map[string]any{
+				"metadata": map[string]any{"labels": map[string]any{"tier": "db", "zone": "a"}},
+			},
+			diff: []diagnostics.Diff{
+				diff(".metadata.labels.tier", "db", "web"),
+				diff(".metadata.labels.zone", "a", nil),
+			},
+		},
+		{
+			name: "object where a scalar is",
+			want: map[string]any{"spec": map[string]any{"replicas": map[string]any{"min": float64(1)}}},
+			diff: []diagnostics.Diff{diff(".spec.replicas", map[string]any{"min": float64(1)}, int64(3))},
+		},
+		{
+			name: "list elements by merge key, in any order",
+			want: map[string]any{"spec": map[string]any{"containers": []any{
+				map[string]any{"name": "sidecar"},
+				map[string]any{"name": "app", "image": "app:1", "args": []any{"--port=80"}},
+				map[string]any{"name": "missing"},
+			}}},
+			diff: []diagnostics.Diff{
+				diff(".spec.containers[name=app].image", "app:1", "app:2"),
+				diff(".spec.containers[name=missing]", map[string]any{"name": "missing"}, nil),
+			},
+		},
+		{
+			name: "list elements without a merge key",
+			want: map[string]any{"spec": map[string]any{"tolerations": []any{
+				map[string]any{"operator": "Exists"},
+				map[string]any{"operator": "Equal"},
+			}}},
+			diff: []diagnostics.Diff{
+				diff(".spec.tolerations[1]", map[string]any{"operator": "Equal"}, got["spec"].(map[string]any)["tolerations"]),
+			},
+		},
+		{
+			name: "list where none is",
+			want: map[string]any{"metadata": map[string]any{"name": []any{"app"}}},
+			diff: []diagnostics.Diff{diff(".metadata.name", []any{"app"}, "app")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if d := matchSubset("Deployment/app", "", tt.want, got); !reflect.DeepEqual(d, tt.diff) {
+				t.Errorf("matchSubset() = %+v, want %+v", d, tt.diff)
+			}
+		})
+	}
+}
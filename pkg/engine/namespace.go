@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// scopeFunc resolves the scope of kinds through the CRDs among the setup
+// objects of cs, which may not be installed yet, and the REST mapper.
+func (e *Engine) scopeFunc(cs *compiled) scenario.ScopeFunc {
+	crds := map[schema.GroupKind]bool{}
+	for _, m := range cs.manifests {
+		for _, obj := range m.objs {
+			if !isCRD(obj) {
+				continue
+			}
+			group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+			kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+			scope, _, _ := unstructured.NestedString(obj.Object, "spec", "scope")
+			crds[schema.GroupKind{Group: group, Kind: kind}] = scope == "Namespaced"
+		}
+	}
+	return func(apiVersion, kind string) (bool, bool) {
+		var gvk schema.GroupVersionKind
+		if apiVersion == "" {
+			var err error
+			if gvk, err = e.mapper.KindFor(kind); err != nil {
+				return false, false
+			}
+		} else {
+			gv, err := schema.ParseGroupVersion(apiVersion)
+			if err != nil {
+				return false, false
+			}
+			gvk = gv.WithKind(kind)
+		}
+		if namespaced, ok := crds[gvk.GroupKind()]; ok {
+			return namespaced, true
+		}
+		mapping, err := e.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return false, false
+		}
+		return mapping.Scope.Name() == meta.RESTScopeNameNamespace, true
+	}
+}
+
+// resolveObjects returns objs with namespaces resolved like the scenario's
+// references: cluster-scoped objects lose any namespace, and namespaced
+// objects without one are put in ns, if set. Objects are copied before
+// they are changed.
+func resolveObjects(objs []*unstructured.Unstructured, scope scenario.ScopeFunc, ns string) []*unstructured.Unstructured {
+	resolved := make([]*unstructured.Unstructured, len(objs))
+	for i, obj := range objs {
+		resolved[i] = obj
+		namespaced, known := scope(obj.GetAPIVersion(), obj.GetKind())
+		switch {
+		case !known:
+		case !namespaced && obj.GetNamespace() != "":
+			resolved[i] = obj.DeepCopy()
+			resolved[i].SetNamespace("")
+		case namespaced && obj.GetNamespace() == "" && ns != "":
+			resolved[i] = obj.DeepCopy()
+			resolved[i].SetNamespace(ns)
+		}
+	}
+	return resolved
+}
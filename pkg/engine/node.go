@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+const (
+	// drainTimeout bounds evicting a node's pods, including retries while
+	// PodDisruptionBudgets block evictions.
+	drainTimeout      = 2 * time.Minute
+	evictionRetryWait = time.Second
+)
+
+// drainNode cordons the node and, unless d.CordonOnly, evicts its pods like
+// kubectl drain --ignore-daemonsets: DaemonSet and mirror pods stay.
+func (e *Engine) drainNode(ctx context.Context, d *scenario.NodeDrain) error {
+	if err := e.setUnschedulable(ctx, d.Node, true); err != nil {
+		return err
+	}
+	e.log.Info("node cordoned", "node", d.Node)
+	if d.CordonOnly {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, drainTimeout)
+	defer cancel()
+	pods, err := e.kube.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", d.Node).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("listing pods on node %s: %w", d.Node, err)
+	}
+	var evicted []corev1.Pod
+	for _, pod := range pods.Items {
+		if !evictable(pod) {
+			continue
+		}
+		if err := e.evict(ctx, pod); err != nil {
+			return err
+		}
+		evicted = append(evicted, pod)
+	}
+	for _, pod := range evicted {
+		if err := e.waitPodGone(ctx, pod); err != nil {
+			return err
+		}
+	}
+	e.log.Info("node drained", "node", d.Node, "evicted", len(evicted))
+	return nil
+}
+
+// uncordon makes the node schedulable again once the scenario is over.
+func (e *Engine) uncordon(node string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	if err := e.setUnschedulable(ctx, node, false); err != nil {
+		e.log.Warn("uncordoning node", "node", node, "error", err)
+	}
+}
+
+func (e *Engine) setUnschedulable(ctx context.Context, node string, unschedulable bool) error {
+	patch := fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, unschedulable)
+	_, err := e.kube.CoreV1().Nodes().Patch(ctx, node, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("setting node %s unschedulable=%t: %w", node, unschedulable, err)
+	}
+	return nil
+}
+
+// evict evicts the pod, retrying while a PodDisruptionBudget refuses.
+func (e *Engine) evict(ctx context.Context, pod corev1.Pod) error {
+	eviction := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace}}
+	err := wait.PollUntilContextCancel(ctx, evictionRetryWait, true, func(ctx context.Context) (bool, error) {
+		err := e.kube.CoreV1().Pods(pod.Namespace).EvictV1(ctx, eviction)
+		switch {
+		case err == nil, apierrors.IsNotFound(err):
+			return true, nil
+		case apierrors.IsTooManyRequests(err):
+			return false, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return fmt.Errorf("evicting pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+	return nil
+}
+
+func (e *Engine) waitPodGone(ctx context.Context, pod corev1.Pod) error {
+	err := wait.PollUntilContextCancel(ctx, evictionRetryWait, true, func(ctx context.Context) (bool, error) {
+		current, err := e.kube.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		// A new pod with the same name is not the evicted one.
+		return current.UID != pod.UID, nil
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for pod %s/%s to terminate: %w", pod.Namespace, pod.Name, err)
+	}
+	return nil
+}
+
+// evictable reports whether drain evicts the pod: DaemonSet pods would be
+// recreated on the node, mirror pods are managed by the kubelet, and
+// finished pods need no eviction.
+func evictable(pod corev1.Pod) bool {
+	if _, mirror := pod.Annotations[corev1.MirrorPodAnnotationKey]; mirror {
+		return false
+	}
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return false
+	}
+	for _, ref := range pod.OwnerReferences {
+		if ref.Controller != nil && *ref.Controller && ref.Kind == "DaemonSet" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/agent"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+type compiledOrder struct {
+	scenario.OrderExpectation
+	// before and after are the Events of the changes that are Events.
+	before, after *compiledEvent
+}
+
+// compileOrders compiles the message patterns of the Events of orders.
+func compileOrders(orders []scenario.OrderExpectation) ([]compiledOrder, error) {
+	event := func(field string, c scenario.OrderedChange) (*compiledEvent, error) {
+		if c.Event == nil {
+			return nil, nil
+		}
+		re, err := regexp.Compile(c.Event.Message)
+		if err != nil {
+			return nil, fmt.Errorf("%s.event.message: %w", field, err)
+		}
+		return &compiledEvent{EventExpectation: *c.Event, message: re}, nil
+	}
+	var compiled []compiledOrder
+	for i, o := range orders {
+		co := compiledOrder{OrderExpectation: o}
+		var err error
+		if co.before, err = event(fmt.Sprintf("expectOrder[%d].before", i), o.Before); err != nil {
+			return nil, err
+		}
+		if co.after, err = event(fmt.Sprintf("expectOrder[%d].after", i), o.After); err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, co)
+	}
+	return compiled, nil
+}
+
+// verifyOrder fails if the changes of an order expectation did not both
+// happen since the scenario started, or happened out of order.
+func (e *Engine) verifyOrder(ctx context.Context, s *scenario.Scenario, specs []agent.Spec, since time.Time) error {
+	if len(s.ExpectOrder) == 0 {
+		return nil
+	}
+	cs, err := e.compiled(s)
+	if err != nil {
+		return err
+	}
+	managers := fieldManagers(s, specs)
+	var errs []error
+	for _, o := range cs.orders {
+		before, err := e.changeTime(ctx, &o.Before, o.before, managers, since)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", o.Label(), err))
+			continue
+		}
+		after, err := e.changeTime(ctx, &o.After, o.after, managers, since)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", o.Label(), err))
+			continue
+		}
+		// Both times have second precision; the same second counts as
+		// in order.
+		if after.Before(before) {
+			errs = append(errs, fmt.Errorf("%s: %s at %s came before %s at %s", o.Label(),
+				&o.After, after.UTC().Format(time.RFC3339), &o.Before, before.UTC().Format(time.RFC3339)))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("expectOrder:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// changeTime returns when c happened since the given time: when its Event,
+// ev, was first recorded, or when its agent last changed the fields it
+// owns of its resource.
+func (e *Engine) changeTime(ctx context.Context, c *scenario.OrderedChange, ev *compiledEvent, managers map[string]string, since time.Time) (time.Time, error) {
+	// managedFields and Event times have second precision.
+	since = since.Truncate(time.Second)
+	if ev != nil {
+		return e.firstEventTime(ctx, *ev, since)
+	}
+	obj, err := e.getObject(ctx, *c.Resource)
+	if apierrors.IsNotFound(err) {
+		return time.Time{}, fmt.Errorf("%s not found", c.Resource)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("getting %s: %w", c.Resource, err)
+	}
+	var last time.Time
+	for _, mf := range obj.GetManagedFields() {
+		if mf.Manager != managers[c.Agent] || mf.Time == nil || mf.Time.Time.Before(since) || !ownsField(mf, c.FieldPath()) {
+			continue
+		}
+		if mf.Time.Time.After(last) {
+			last = mf.Time.Time
+		}
+	}
+	if last.IsZero() {
+		return time.Time{}, fmt.Errorf("no %s since the scenario started", c)
+	}
+	return last, nil
+}
+
+// firstEventTime returns when the first Event matching ev since the given time
+// was first recorded.
+func (e *Engine) firstEventTime(ctx context.Context, ev compiledEvent, since time.Time) (time.Time, error) {
+	ref := ev.InvolvedObject
+	list, err := e.kube.CoreV1().Events(ev.NamespaceOrDefault()).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{"involvedObject.kind": ref.Kind, "involvedObject.name": ref.Name}.String(),
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("listing events about %s: %w", ref, err)
+	}
+	var first time.Time
+	for _, event := range list.Items {
+		if event.Source.Component == eventComponent || event.ReportingController == eventComponent || !ev.matches(&event) {
+			continue
+		}
+		t := event.FirstTimestamp.Time
+		if t.IsZero() {
+			t = eventTime(&event)
+		}
+		if !t.Before(since) && (first.IsZero() || t.Before(first)) {
+			first = t
+		}
+	}
+	if first.IsZero() {
+		return time.Time{}, fmt.Errorf("no %s since the scenario started", ev.Label())
+	}
+	return first, nil
+}
+
+// ownsField reports whether the managedFields entry mf owns the field at
+// path, or anything under it. Every entry owns the empty path.
+func ownsField(mf metav1.ManagedFieldsEntry, path []string) bool {
+	if len(path) == 0 {
+		return true
+	}
+	if mf.FieldsV1 == nil {
+		return false
+	}
+	var set map[string]any
+	if err := json.Unmarshal(mf.FieldsV1.Raw, &set); err != nil {
+		return false
+	}
+	for _, name := range path {
+		next, ok := set["f:"+name].(map[string]any)
+		if !ok {
+			return false
+		}
+		set = next
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/agent"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// preflight checks the scenario's preflight assertions, reporting every
+// one the cluster does not meet.
+func (e *Engine) preflight(ctx context.Context, p *scenario.Preflight) error {
+	if p == nil {
+		return nil
+	}
+	var errs []error
+	if p.MinKubernetesVersion != "" {
+		if err := e.checkKubernetesVersion(p.MinKubernetesVersion); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if p.MinNodes > 0 {
+		if err := e.checkNodes(ctx, p.MinNodes); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(p.AgentsAbsent) > 0 {
+		if err := e.checkAgentsAbsent(ctx, p.AgentsAbsent); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (e *Engine) checkKubernetesVersion(min string) error {
+	v := e.kubernetesVersion()
+	if v == "" {
+		return errors.New("the cluster's Kubernetes version is unknown")
+	}
+	have, err := version.ParseGeneric(v)
+	if err != nil {
+		return fmt.Errorf("parsing Kubernetes version %s: %w", v, err)
+	}
+	if !have.AtLeast(version.MustParseGeneric(min)) {
+		return fmt.Errorf("the cluster runs Kubernetes %s, the scenario needs at least %s", v, min)
+	}
+	return nil
+}
+
+func (e *Engine) checkNodes(ctx context.Context, min int) error {
+	nodes, err := e.kube.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("listing nodes: %w", err)
+	}
+	ready := 0
+	for _, n := range nodes.Items {
+		for _, c := range n.Status.Conditions {
+			if c.Type == corev1.NodeReady && c.Status == corev1.ConditionTrue {
+				ready++
+			}
+		}
+	}
+	if ready < min {
+		return fmt.Errorf("the cluster has %d ready nodes, the scenario needs at least %d", ready, min)
+	}
+	return nil
+}
+
+func (e *Engine) checkAgentsAbsent(ctx context.Context, names []string) error {
+	set := strings.Join(names, ",")
+	var found []string
+	for _, label := range []string{"app.kubernetes.io/name", agent.LabelAgent} {
+		deps, err := e.kube.AppsV1().Deployments(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("%s in (%s)", label, set),
+		})
+		if err != nil {
+			return fmt.Errorf("listing deployments: %w", err)
+		}
+		for _, d := range deps.Items {
+			if name := d.Namespace + "/" + d.Name; !slices.Contains(found, name) {
+				found = append(found, name)
+			}
+		}
+	}
+	if len(found) > 0 {
+		return fmt.Errorf("agents that must be absent are installed: %s", strings.Join(found, ", "))
+	}
+	return nil
+}
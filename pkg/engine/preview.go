@@ -0,0 +1,345 @@
+package engine
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/diagnostics"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// Actions of a previewed change.
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionPatch     = "patch"
+	ActionUnchanged = "unchanged"
+	// ActionOther is a change a dry run cannot show, such as an HTTP call
+	// or a command run in a pod; the preview only describes it.
+	ActionOther = "not previewed"
+)
+
+// Preview is what running a scenario would change on the cluster, found
+// with server-side dry runs of its setup and triggers. Nothing is written
+// and nothing is awaited.
+type Preview struct {
+	Scenario string
+	Changes  []Change
+}
+
+// Change is one write the scenario would make.
+type Change struct {
+	// Source is the part of the scenario making the change, such as a
+	// setup manifest or "trigger".
+	Source   string
+	Resource string
+	Action   string
+	// Diffs are the fields an update or patch changes, Expected holding
+	// the live value and Actual the value after the change.
+	Diffs []diagnostics.Diff
+	// Note describes a change not previewed, or why a dry run could not
+	// run against the live cluster.
+	Note string
+	// Error is why the API server refused the dry run.
+	Error string
+}
+
+// Preview dry-runs the setup and triggers of s, steps included, against the
+// cluster and returns what they would change. Agent deployments, generated
+// objects and triggers that do not go through the API server are listed
+// without a dry run. Triggers are previewed against the state the setup
+// would leave, not against what agents would make of it.
+func (e *Engine) Preview(ctx context.Context, s *scenario.Scenario) (*Preview, error) {
+	cs, err := e.compiled(s)
+	if err != nil {
+		return nil, fmt.Errorf("compiling: %w", err)
+	}
+	s = cs.scenario
+	p := &previewer{e: e, planned: map[string]*unstructured.Unstructured{}}
+	for _, name := range s.Agents {
+		p.add(Change{Source: "agents", Resource: "agent " + name, Action: ActionOther, Note: "deploys the agent"})
+	}
+	if s.Tenants != nil {
+		p.add(Change{Source: "tenants", Action: ActionOther, Note: "repeats the setup and triggers below in every tenant namespace"})
+	}
+	if s.Setup.HasPresets() {
+		p.apply(ctx, "setup presets", &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]any{"name": s.NamespaceOrDefault()},
+		}})
+	}
+	for _, m := range cs.manifests {
+		for _, obj := range m.objs {
+			p.apply(ctx, m.path, obj)
+		}
+	}
+	for i, g := range cs.generated {
+		kinds := map[string]int{}
+		for _, obj := range g.objs {
+			kinds[obj.GetKind()]++
+		}
+		for kind, n := range kinds {
+			p.add(Change{Source: fmt.Sprintf("setup.generate[%d]", i), Resource: kind, Action: ActionCreate, Note: fmt.Sprintf("creates %d objects", n)})
+		}
+	}
+	for i, exp := range s.Setup.WaitFor {
+		p.add(Change{Source: fmt.Sprintf("setup.waitFor[%d]", i), Resource: exp.Resource.String(), Action: ActionOther, Note: "waits for it before the trigger"})
+	}
+	p.triggers(ctx, "trigger", s.Trigger)
+	for i, st := range s.Steps {
+		p.triggers(ctx, fmt.Sprintf("steps[%d].trigger", i), st.Trigger)
+	}
+	if t := s.Teardown; t != nil {
+		p.teardown(cs, t)
+	}
+	return &Preview{Scenario: s.Name, Changes: p.changes}, nil
+}
+
+// previewer collects the changes of a preview. Planned holds the objects
+// the setup would create, so triggers can be previewed against them.
+type previewer struct {
+	e       *Engine
+	planned map[string]*unstructured.Unstructured
+	changes []Change
+}
+
+func (p *previewer) add(c Change) {
+	p.changes = append(p.changes, c)
+}
+
+// apply dry-runs what applyUnstructured does with obj.
+func (p *previewer) apply(ctx context.Context, source string, obj *unstructured.Unstructured) {
+	name := cmp.Or(obj.GetName(), obj.GetGenerateName())
+	c := Change{Source: source, Resource: previewKey(obj.GetKind(), obj.GetNamespace(), name), Action: ActionCreate}
+	defer func() { p.add(c) }()
+	ri, err := p.e.resourceInterface(obj.GroupVersionKind(), obj.GetNamespace())
+	if err != nil {
+		if p.plannedKind(obj.GetKind()) {
+			c.Note = "kind is defined by a CustomResourceDefinition of the setup"
+		} else {
+			c.Error = err.Error()
+		}
+		return
+	}
+	created, err := ri.Create(ctx, obj, metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}})
+	switch {
+	case err == nil:
+		p.planned[c.Resource] = created
+		return
+	case apierrors.IsAlreadyExists(err) && obj.GetName() != "":
+	case apierrors.IsNotFound(err) && p.planned[previewKey("Namespace", "", obj.GetNamespace())] != nil:
+		c.Note = "namespace is created by the setup"
+		p.planned[c.Resource] = obj
+		return
+	default:
+		c.Error = err.Error()
+		return
+	}
+	c.Action = ActionUpdate
+	existing, err := ri.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		c.Error = err.Error()
+		return
+	}
+	want := obj.DeepCopy()
+	want.SetResourceVersion(existing.GetResourceVersion())
+	updated, err := ri.Update(ctx, want, metav1.UpdateOptions{DryRun: []string{metav1.DryRunAll}})
+	if err != nil {
+		c.Error = err.Error()
+		return
+	}
+	p.planned[c.Resource] = updated
+	c.Diffs = changedFields(c.Resource, existing, updated)
+	if len(c.Diffs) == 0 {
+		c.Action = ActionUnchanged
+	}
+}
+
+// plannedKind reports whether the setup creates a CustomResourceDefinition
+// for kind.
+func (p *previewer) plannedKind(kind string) bool {
+	for _, obj := range p.planned {
+		if obj.GetKind() == "CustomResourceDefinition" {
+			if k, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind"); k == kind {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// triggers previews the triggers of t.
+func (p *previewer) triggers(ctx context.Context, source string, t *scenario.Trigger) {
+	triggers := t.Triggers()
+	for i, t := range triggers {
+		src := source
+		if len(triggers) > 1 {
+			src = fmt.Sprintf("%s[%d]", source, i)
+		}
+		if t.Patch != nil {
+			p.patch(ctx, src, t.Patch.ResourceRef, map[string]any{"spec": t.Patch.Spec}, "")
+		}
+		if m := t.Metadata; m != nil {
+			p.patch(ctx, src, m.ResourceRef, m.MetadataPatch(), "")
+		}
+		if sc := t.Scale; sc != nil {
+			ref := sc.Ref()
+			if ref.APIVersion == "" {
+				if gvk, err := p.e.scaleKind(sc); err == nil {
+					ref.APIVersion = gvk.GroupVersion().String()
+				}
+			}
+			p.patch(ctx, src, ref, map[string]any{"spec": map[string]any{"replicas": sc.Replicas}}, "scale")
+		}
+		if h := t.HTTP; h != nil {
+			p.add(Change{Source: src, Resource: h.Endpoint.String(), Action: ActionOther, Note: "calls " + cmp.Or(h.Method, "POST") + " " + cmp.Or(h.Path, "/")})
+		}
+		if x := t.Exec; x != nil {
+			p.add(Change{Source: src, Resource: "pod " + cmp.Or(x.Pod, labelString(x.Selector)), Action: ActionOther, Note: "runs " + strings.Join(x.Command, " ")})
+		}
+		if ev := t.Event; ev != nil {
+			p.add(Change{Source: src, Resource: ev.InvolvedObject.String(), Action: ActionOther, Note: "records an Event with reason " + ev.Reason})
+		}
+		if d := t.Drain; d != nil {
+			note := "cordons and drains the node"
+			if d.CordonOnly {
+				note = "cordons the node"
+			}
+			p.add(Change{Source: src, Resource: "node " + d.Node, Action: ActionOther, Note: note})
+		}
+		if d := t.AdvanceClock; d != nil {
+			p.add(Change{Source: src, Action: ActionOther, Note: "advances the fake clock of agents by " + d.Duration.String()})
+		}
+		if c := t.Chaos; c != nil {
+			p.add(Change{Source: src, Resource: "agent " + cmp.Or(c.KillAgentPod, c.PartitionAgent), Action: ActionOther, Note: "disrupts the agent while expectations are awaited"})
+		}
+	}
+}
+
+// teardown lists what the teardown of cs would change without a dry run,
+// since it acts on the state the scenario leaves.
+func (p *previewer) teardown(cs *compiled, t *scenario.Teardown) {
+	const when = " once the scenario is done"
+	for i, pt := range t.Patches {
+		p.add(Change{Source: fmt.Sprintf("teardown.patches[%d]", i), Resource: pt.ResourceRef.String(), Action: ActionOther, Note: "patches it" + when})
+	}
+	for i, x := range t.Exec {
+		p.add(Change{Source: fmt.Sprintf("teardown.exec[%d]", i), Resource: "pod " + cmp.Or(x.Pod, labelString(x.Selector)), Action: ActionOther, Note: "runs " + strings.Join(x.Command, " ") + when})
+	}
+	for _, m := range cs.teardown {
+		for _, obj := range m.objs {
+			p.add(Change{Source: m.path, Resource: previewKey(obj.GetKind(), obj.GetNamespace(), obj.GetName()), Action: ActionOther, Note: "deletes it" + when})
+		}
+	}
+	if t.DeleteSetup {
+		p.add(Change{Source: "teardown.deleteSetup", Action: ActionOther, Note: "deletes the setup objects" + when})
+	}
+}
+
+// patch dry-runs a merge patch of ref with body, on subresource if given.
+// An object the setup would create is patched locally instead, since it
+// does not exist yet.
+func (p *previewer) patch(ctx context.Context, source string, ref scenario.ResourceRef, body map[string]any, subresource string) {
+	key := previewKey(ref.Kind, ref.Namespace, ref.Name)
+	c := Change{Source: source, Resource: key, Action: ActionPatch}
+	defer func() { p.add(c) }()
+	planned := p.planned[key]
+	ri, err := p.e.resourceFor(ref)
+	if err != nil && planned == nil {
+		c.Error = err.Error()
+		return
+	}
+	var existing *unstructured.Unstructured
+	if ri != nil {
+		existing, err = p.get(ctx, ri, ref.Name, subresource)
+	}
+	if planned != nil && (ri == nil || apierrors.IsNotFound(err)) {
+		c.Note = "resource is created by the setup; patched locally"
+		patched := planned.DeepCopy()
+		patched.Object = mergePatch(patched.Object, body).(map[string]any)
+		p.planned[key] = patched
+		c.Diffs = changedFields(c.Resource, planned, patched)
+		return
+	}
+	if err != nil {
+		c.Error = err.Error()
+		return
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		c.Error = err.Error()
+		return
+	}
+	var sub []string
+	if subresource != "" {
+		sub = []string{subresource}
+	}
+	patched, err := ri.Patch(ctx, ref.Name, types.MergePatchType, data, metav1.PatchOptions{DryRun: []string{metav1.DryRunAll}}, sub...)
+	if err != nil {
+		c.Error = err.Error()
+		return
+	}
+	c.Diffs = changedFields(c.Resource, existing, patched)
+	if len(c.Diffs) == 0 {
+		c.Action = ActionUnchanged
+	}
+}
+
+func (p *previewer) get(ctx context.Context, ri dynamic.ResourceInterface, name, subresource string) (*unstructured.Unstructured, error) {
+	if subresource == "" {
+		return ri.Get(ctx, name, metav1.GetOptions{})
+	}
+	return ri.Get(ctx, name, metav1.GetOptions{}, subresource)
+}
+
+// changedFields diffs before and after, leaving out the fields every write
+// changes.
+func changedFields(resource string, before, after *unstructured.Unstructured) []diagnostics.Diff {
+	b, a := before.DeepCopy().Object, after.DeepCopy().Object
+	_ = stripVolatile(b, nil)
+	_ = stripVolatile(a, nil)
+	return diffObjects(resource, "", b, a)
+}
+
+// mergePatch applies patch to target as a JSON merge patch (RFC 7386).
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+// objectKey identifies an object by kind, namespace and name.
+func previewKey(kind, namespace, name string) string {
+	if namespace == "" {
+		return kind + "/" + name
+	}
+	return kind + "/" + namespace + "/" + name
+}
+
+// labelString formats a label selector given as a map, for output.
+func labelString(labels map[string]string) string {
+	return metav1.FormatLabelSelector(&metav1.LabelSelector{MatchLabels: labels})
+}
@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"k8s.io/client-go/rest"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// mutations lists the parts of s that would change the cluster, which an
+// engine in read-only mode refuses to run: setup, triggers, agents it would
+// deploy, the checks that send mutations, if only as dry runs, and
+// teardown.
+func (e *Engine) mutations(s *scenario.Scenario) []string {
+	var parts []string
+	add := func(set bool, part string) {
+		if set {
+			parts = append(parts, part)
+		}
+	}
+	add(len(s.Setup.Manifests) > 0, "setup.manifests")
+	add(len(s.Setup.Generate) > 0, "setup.generate")
+	add(s.Setup.Quota != nil, "setup.quota")
+	add(s.Setup.LimitRange != nil, "setup.limitRange")
+	add(s.Setup.ControlNamespace != "", "setup.controlNamespace")
+	add(s.Trigger != nil, "trigger")
+	for i, st := range s.Steps {
+		add(st.Trigger != nil, fmt.Sprintf("steps[%d].trigger", i))
+	}
+	add(e.agents != nil && len(s.Agents) > 0, "agents deployed by the framework")
+	add(len(s.APIFaults) > 0, "apiFaults")
+	add(len(s.ExpectDenied) > 0, "expectDenied")
+	add(len(s.ExpectEvictions) > 0, "expectEvictions")
+	add(s.Load != nil, "load")
+	add(s.Tenants != nil, "tenants")
+	add(s.Teardown != nil, "teardown")
+	return parts
+}
+
+// checkReadOnly fails if the engine is read-only and s would change the
+// cluster.
+func (e *Engine) checkReadOnly(s *scenario.Scenario) error {
+	if !e.readOnly {
+		return nil
+	}
+	if parts := e.mutations(s); len(parts) > 0 {
+		return fmt.Errorf("read-only mode: the scenario changes the cluster with %s", strings.Join(parts, ", "))
+	}
+	return nil
+}
+
+// readOnlyConfig returns a copy of config whose requests fail unless they
+// only read, so nothing the engine does can change the cluster even if a
+// scenario gets past checkReadOnly.
+func readOnlyConfig(config *rest.Config) *rest.Config {
+	guarded := rest.CopyConfig(config)
+	guarded.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return readOnlyTransport{rt}
+	})
+	return guarded
+}
+
+type readOnlyTransport struct {
+	next http.RoundTripper
+}
+
+func (t readOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return t.next.RoundTrip(req)
+	}
+	return nil, fmt.Errorf("read-only mode: refusing %s %s", req.Method, req.URL.Path)
+}
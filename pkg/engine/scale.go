@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// scaleTrigger sets the replicas of a resource through its scale
+// subresource. A HorizontalPodAutoscaler targeting the resource would undo
+// a count outside its bounds, so that fails the trigger instead.
+func (e *Engine) scaleTrigger(ctx context.Context, sc *scenario.ScaleTrigger) error {
+	ref := sc.Ref()
+	gvk, err := e.scaleKind(sc)
+	if err != nil {
+		return fmt.Errorf("scaling %s: %w", ref, err)
+	}
+	ri, err := e.resourceInterface(gvk, sc.Namespace)
+	if err != nil {
+		return fmt.Errorf("scaling %s: %w", ref, err)
+	}
+	_, ns, err := e.locate(gvk, sc.Namespace)
+	if err != nil {
+		return fmt.Errorf("scaling %s: %w", ref, err)
+	}
+	if ns != "" {
+		if err := e.checkAutoscaler(ctx, gvk, ns, sc); err != nil {
+			return fmt.Errorf("scaling %s: %w", ref, err)
+		}
+	}
+	body := fmt.Sprintf(`{"spec":{"replicas":%d}}`, sc.Replicas)
+	if _, err := ri.Patch(ctx, sc.Name, types.MergePatchType, []byte(body), metav1.PatchOptions{}, "scale"); err != nil {
+		return fmt.Errorf("scaling %s: %w", ref, err)
+	}
+	e.fence(gvk, sc.Namespace, sc.Name)
+	e.log.Info("trigger scaled", "resource", ref.String(), "replicas", sc.Replicas)
+	return nil
+}
+
+// scaleKind returns the kind to scale, resolving it through discovery
+// when the trigger names no API version.
+func (e *Engine) scaleKind(sc *scenario.ScaleTrigger) (schema.GroupVersionKind, error) {
+	if sc.APIVersion != "" {
+		return refGVK(sc.Ref())
+	}
+	return e.mapper.KindFor(sc.Kind)
+}
+
+// checkAutoscaler fails when a HorizontalPodAutoscaler targets the scaled
+// resource and would move its replicas back into its bounds. Scaling to
+// zero pauses autoscaling and is allowed.
+func (e *Engine) checkAutoscaler(ctx context.Context, gvk schema.GroupVersionKind, ns string, sc *scenario.ScaleTrigger) error {
+	hpas, err := e.kube.AutoscalingV2().HorizontalPodAutoscalers(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("listing autoscalers: %w", err)
+	}
+	for _, hpa := range hpas.Items {
+		if !targets(hpa, gvk, sc.Name) {
+			continue
+		}
+		minReplicas := int32(1)
+		if hpa.Spec.MinReplicas != nil {
+			minReplicas = *hpa.Spec.MinReplicas
+		}
+		if sc.Replicas != 0 && (sc.Replicas < minReplicas || sc.Replicas > hpa.Spec.MaxReplicas) {
+			return fmt.Errorf("HorizontalPodAutoscaler %s keeps replicas within %d-%d", hpa.Name, minReplicas, hpa.Spec.MaxReplicas)
+		}
+		e.log.Warn("scaled resource is autoscaled; the autoscaler may change its replicas",
+			"resource", sc.Ref().String(), "autoscaler", hpa.Name)
+	}
+	return nil
+}
+
+func targets(hpa autoscalingv2.HorizontalPodAutoscaler, gvk schema.GroupVersionKind, name string) bool {
+	ref := hpa.Spec.ScaleTargetRef
+	if ref.Kind != gvk.Kind || ref.Name != name {
+		return false
+	}
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	return err == nil && gv.Group == gvk.Group
+}
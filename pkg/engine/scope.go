@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"slices"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// scopeNamespaces returns every namespace the scenario touches, which
+// diagnostics are collected from: those of its setup objects, triggers and
+// expectations, steps included, snapshots, forbidden mutations, control and tenant
+// namespaces, and its agents' namespaces. Kinds the cluster does not know
+// count in the namespace they name, if any.
+func (e *Engine) scopeNamespaces(s *scenario.Scenario) []string {
+	var namespaces []string
+	add := func(gvk schema.GroupVersionKind, namespace string) {
+		ns := namespace
+		if _, located, err := e.locate(gvk, namespace); err == nil {
+			ns = located
+		}
+		if ns != "" && !slices.Contains(namespaces, ns) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	addRef := func(ref scenario.ResourceRef) {
+		if gvk, err := refGVK(ref); err == nil {
+			add(gvk, ref.Namespace)
+		}
+	}
+	addName := func(ns string) { add(schema.GroupVersionKind{}, ns) }
+
+	if cs, err := e.compiled(s); err == nil {
+		for _, m := range cs.manifests {
+			for _, obj := range m.objs {
+				add(obj.GroupVersionKind(), obj.GetNamespace())
+			}
+		}
+		for _, g := range cs.generated {
+			// A generator's copies share their kind and namespace.
+			if len(g.objs) > 0 {
+				add(g.objs[0].GroupVersionKind(), g.objs[0].GetNamespace())
+			}
+		}
+	}
+	addTrigger := func(t *scenario.Trigger) {
+		if t.Patch != nil {
+			addRef(t.Patch.ResourceRef)
+		}
+		if t.Metadata != nil {
+			addRef(t.Metadata.ResourceRef)
+		}
+		if t.Scale != nil {
+			if gvk, err := e.scaleKind(t.Scale); err == nil {
+				add(gvk, t.Scale.Namespace)
+			}
+		}
+		if t.HTTP != nil && t.HTTP.Service != "" {
+			addName(t.HTTP.NamespaceOrDefault())
+		}
+		if t.Exec != nil {
+			addName(t.Exec.NamespaceOrDefault())
+		}
+		if t.Event != nil {
+			addRef(t.Event.InvolvedObject)
+			addName(t.Event.NamespaceOrDefault())
+		}
+	}
+	addExpect := func(expect []scenario.Expectation) {
+		for _, exp := range expect {
+			addRef(exp.Resource)
+			for _, c := range exp.Conditions {
+				if c.ValueFrom != nil && c.ValueFrom.ResourceField != nil {
+					addRef(c.ValueFrom.ResourceField.ResourceRef)
+				}
+			}
+		}
+	}
+	for _, t := range s.Trigger.Triggers() {
+		addTrigger(t)
+	}
+	addExpect(s.Setup.WaitFor)
+	addExpect(s.Expect)
+	for _, ev := range s.ExpectEvents {
+		addRef(ev.InvolvedObject)
+		addName(ev.NamespaceOrDefault())
+	}
+	for _, d := range s.ExpectDenied {
+		addRef(d.Resource())
+	}
+	for _, x := range s.ExpectEvictions {
+		addName(x.NamespaceOrDefault())
+	}
+	for _, m := range s.ExpectMetrics {
+		if m.Service != "" {
+			addName(m.NamespaceOrDefault())
+		}
+	}
+	for _, st := range s.Steps {
+		for _, t := range st.Trigger.Triggers() {
+			addTrigger(t)
+		}
+		addExpect(st.Expect)
+	}
+	for _, sn := range s.Snapshots {
+		addRef(sn.Resource)
+	}
+	for _, f := range s.ForbiddenMutations {
+		if gv, err := schema.ParseGroupVersion(f.Resources.APIVersion); err == nil {
+			add(gv.WithKind(f.Resources.Kind), f.Resources.Namespace)
+		}
+	}
+	for _, o := range s.ExpectOrder {
+		for _, c := range []scenario.OrderedChange{o.Before, o.After} {
+			if c.Resource != nil {
+				addRef(*c.Resource)
+			}
+			if ev := c.Event; ev != nil {
+				addRef(ev.InvolvedObject)
+				addName(ev.NamespaceOrDefault())
+			}
+		}
+	}
+	for _, c := range s.Churn {
+		if gv, err := schema.ParseGroupVersion(c.Resources.APIVersion); err == nil {
+			add(gv.WithKind(c.Resources.Kind), c.Resources.Namespace)
+		}
+	}
+	addName(s.Setup.ControlNamespace)
+	if s.Tenants != nil {
+		if tenants, err := s.Tenants.Namespaces(); err == nil {
+			for _, ns := range tenants {
+				addName(ns)
+			}
+		}
+	}
+	if e.agents != nil {
+		for _, a := range s.Agents {
+			addName(e.agents.Namespace(a))
+		}
+	}
+	if len(namespaces) == 0 {
+		namespaces = append(namespaces, "default")
+	}
+	return namespaces
+}
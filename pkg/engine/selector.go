@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/diagnostics"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// checkSelected checks the resources the label selector of exp matches,
+// each under its own name: every one must meet exp, or one of them with
+// aggregate any, and their number must meet exp's count or, without one,
+// be at least one. With absent, none may match.
+func (e *Engine) checkSelected(ctx context.Context, snap *snapshot, exp compiledExpectation, gens generations) ([]diagnostics.Diff, error) {
+	objs, err := e.listMatching(ctx, exp.Resource)
+	if err != nil {
+		return nil, readFailure(exp.Expectation, err, fmt.Errorf("listing %s: %w", exp.Resource, err))
+	}
+	if exp.Absent {
+		var diffs []diagnostics.Diff
+		for i := range objs {
+			actual := "present"
+			if objs[i].GetDeletionTimestamp() != nil {
+				actual = "terminating"
+			}
+			diffs = append(diffs, diagnostics.Diff{
+				Resource:    selectedName(exp.Resource, &objs[i]),
+				Description: describe(exp.Expectation, nil),
+				Expected:    "absent",
+				Actual:      actual,
+			})
+		}
+		return diffs, nil
+	}
+	var diffs []diagnostics.Diff
+	switch {
+	case exp.Count != nil && !exp.Count.Met(len(objs)):
+		diffs = append(diffs, diagnostics.Diff{
+			Resource:    exp.Resource.String(),
+			Path:        "count",
+			Description: describe(exp.Expectation, nil),
+			Expected:    exp.Count.Want(),
+			Actual:      len(objs),
+		})
+	case exp.Count == nil && len(objs) == 0:
+		return []diagnostics.Diff{{
+			Resource:    exp.Resource.String(),
+			Description: describe(exp.Expectation, nil),
+			Expected:    "at least one match",
+			Actual:      "none",
+		}}, nil
+	}
+	if len(objs) == 0 {
+		return diffs, nil
+	}
+	oneSuffices := exp.AggregateOrDefault() == scenario.AggregateAny
+	var unmet []diagnostics.Diff
+	for i := range objs {
+		d, err := e.checkObject(ctx, snap, exp, selectedName(exp.Resource, &objs[i]), &objs[i], gens)
+		if err != nil {
+			return nil, err
+		}
+		if len(d) == 0 && oneSuffices {
+			return diffs, nil
+		}
+		unmet = append(unmet, d...)
+	}
+	return append(diffs, unmet...), nil
+}
+
+// listMatching lists the resources the label selector of ref matches.
+func (e *Engine) listMatching(ctx context.Context, ref scenario.ResourceRef) ([]unstructured.Unstructured, error) {
+	selector, err := metav1.LabelSelectorAsSelector(ref.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	ri, err := e.resourceFor(ref)
+	if err != nil {
+		return nil, err
+	}
+	list, err := ri.List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// selectedName names obj, one of the resources ref selects, in diffs.
+func selectedName(ref scenario.ResourceRef, obj *unstructured.Unstructured) string {
+	return scenario.ResourceRef{APIVersion: ref.APIVersion, Kind: ref.Kind, Name: obj.GetName(), Namespace: obj.GetNamespace()}.String()
+}
@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	discoveryfake "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/diagnostics"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+var pods = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+
+// newTestEngine returns an engine reading objs through fake clients that
+// know pods and config maps.
+func newTestEngine(objs ...runtime.Object) *Engine {
+	discovery := &discoveryfake.FakeDiscovery{Fake: &clienttesting.Fake{Resources: []*metav1.APIResourceList{{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{
+			{Name: "pods", Kind: "Pod", Namespaced: true, Verbs: []string{"get", "list"}},
+			{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: []string{"get", "list"}},
+		},
+	}}}}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{pods: "PodList", configMaps: "ConfigMapList"}, objs...)
+	return &Engine{dynamic: client, mapper: newRefreshingMapper(discovery)}
+}
+
+func testPod(name, app, phase string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]any{"status": map[string]any{"phase": phase}}}
+	u.SetAPIVersion("v1")
+	u.SetKind("Pod")
+	u.SetNamespace("test")
+	u.SetName(name)
+	u.SetLabels(map[string]string{"app": app})
+	return u
+}
+
+func TestCheckSelected(t *testing.T) {
+	e := newTestEngine(
+		testPod("web-1", "web", "Running"),
+		testPod("web-2", "web", "Pending"),
+		testPod("db-1", "db", "Running"),
+	)
+	selecting := func(app string) scenario.ResourceRef {
+		return scenario.ResourceRef{APIVersion: "v1", Kind: "Pod", Namespace: "test",
+			LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": app}}}
+	}
+	running := []scenario.Condition{{Path: ".status.phase", Value: "Running"}}
+	tests := []struct {
+		name string
+		exp  scenario.Expectation
+		want []diagnostics.Diff
+	}{
+		{
+			name: "every match meets it",
+			exp:  scenario.Expectation{Resource: selecting("db"), Conditions: running},
+		},
+		{
+			name: "one match does not",
+			exp:  scenario.Expectation{Resource: selecting("web"), Conditions: running},
+			want: []diagnostics.Diff{{Resource: "Pod/test/web-2", Path: ".status.phase", Expected: "Running", Actual: "Pending"}},
+		},
+		{
+			name: "one match suffices with aggregate any",
+			exp:  scenario.Expectation{Resource: selecting("web"), Conditions: running, Aggregate: scenario.AggregateAny},
+		},
+		{
+			name: "no match",
+			exp:  scenario.Expectation{Resource: selecting("cache"), Conditions: running},
+			want: []diagnostics.Diff{{Resource: "Pod/test matching app=cache", Expected: "at least one match", Actual: "none"}},
+		},
+		{
+			name: "count met",
+			exp:  scenario.Expectation{Resource: selecting("web"), Count: &scenario.Count{Value: 2}},
+		},
+		{
+			name: "count not met",
+			exp:  scenario.Expectation{Resource: selecting("web"), Count: &scenario.Count{Operator: scenario.OperatorGte, Value: 3}, Conditions: running},
+			want: []diagnostics.Diff{
+				{Resource: "Pod/test matching app=web", Path: "count", Expected: ">= 3", Actual: 2},
+				{Resource: "Pod/test/web-2", Path: ".status.phase", Expected: "Running", Actual: "Pending"},
+			},
+		},
+		{
+			name: "count of none",
+			exp:  scenario.Expectation{Resource: selecting("cache"), Count: &scenario.Count{Value: 0}, Conditions: running},
+		},
+		{
+			name: "absent with no match",
+			exp:  scenario.Expectation{Resource: selecting("cache"), Absent: true},
+		},
+		{
+			name: "absent with matches",
+			exp:  scenario.Expectation{Resource: selecting("web"), Absent: true, Description: "web is gone"},
+			want: []diagnostics.Diff{
+				{Resource: "Pod/test/web-1", Description: "web is gone", Expected: "absent", Actual: "present"},
+				{Resource: "Pod/test/web-2", Description: "web is gone", Expected: "absent", Actual: "present"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compiled, err := compileExpect("expect", []scenario.Expectation{tt.exp})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := e.checkSelected(context.Background(), nil, compiled[0], generations{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkSelected() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/yaml"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/diagnostics"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// volatileFields change from run to run and are stripped from snapshots.
+var volatileFields = []string{
+	".metadata.uid",
+	".metadata.resourceVersion",
+	".metadata.generation",
+	".metadata.creationTimestamp",
+	".metadata.managedFields",
+	".metadata.selfLink",
+	".status.observedGeneration",
+}
+
+// lastApplied is the annotation kubectl apply records the applied object
+// in.
+const lastApplied = "kubectl.kubernetes.io/last-applied-configuration"
+
+// volatileConditionFields are the timestamps of status conditions.
+var volatileConditionFields = []string{"lastTransitionTime", "lastUpdateTime", "lastProbeTime", "lastHeartbeatTime"}
+
+// verifySnapshots compares the scenario's snapshot resources with their
+// golden files, or rewrites the files when snapshot updates are enabled.
+// Every difference is returned as a diff.
+func (e *Engine) verifySnapshots(ctx context.Context, s *scenario.Scenario) ([]diagnostics.Diff, error) {
+	var diffs []diagnostics.Diff
+	var errs []error
+	for _, sn := range s.Snapshots {
+		d, err := e.verifySnapshot(ctx, s, sn)
+		diffs = append(diffs, d...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("snapshot of %s: %w", sn.Resource, err))
+		}
+	}
+	return diffs, errors.Join(errs...)
+}
+
+func (e *Engine) verifySnapshot(ctx context.Context, s *scenario.Scenario, sn scenario.Snapshot) ([]diagnostics.Diff, error) {
+	obj, err := e.getObject(ctx, sn.Resource)
+	if apierrors.IsNotFound(err) {
+		return nil, errors.New("not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	got := obj.DeepCopy().Object
+	if err := stripVolatile(got, sn.Ignore); err != nil {
+		return nil, err
+	}
+	path := s.SnapshotPath(sn)
+	if e.updateSnapshots {
+		data, err := yaml.Marshal(got)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return nil, err
+		}
+		e.log.Info("snapshot updated", "resource", sn.Resource.String(), "file", path)
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("golden file %s does not exist; run with snapshot updates to create it", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var want map[string]any
+	if err := yaml.Unmarshal(data, &want); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	diffs := diffObjects(sn.Resource.String(), "", want, got)
+	if len(diffs) > 0 {
+		return diffs, fmt.Errorf("differs from %s: %s", path, describeDiffs(diffs))
+	}
+	return nil, nil
+}
+
+// stripVolatile removes the fields that change from run to run, and the
+// ignored ones, from obj.
+func stripVolatile(obj map[string]any, ignore []string) error {
+	for _, p := range append(slices.Clone(volatileFields), ignore...) {
+		fp, err := parsePath(p)
+		if err != nil {
+			return fmt.Errorf("ignore: %w", err)
+		}
+		fp.remove(obj)
+	}
+	status, _ := obj["status"].(map[string]any)
+	conditions, _ := status["conditions"].([]any)
+	for _, c := range conditions {
+		if c, ok := c.(map[string]any); ok {
+			for _, f := range volatileConditionFields {
+				delete(c, f)
+			}
+		}
+	}
+	if meta, ok := obj["metadata"].(map[string]any); ok {
+		if annotations, ok := meta["annotations"].(map[string]any); ok {
+			delete(annotations, lastApplied)
+			if len(annotations) == 0 {
+				delete(meta, "annotations")
+			}
+		}
+	}
+	return nil
+}
+
+// diffObjects compares got with want in full and returns a diff for every
+// field that differs, is missing, or is extra. Lists compare by index.
+func diffObjects(resource, path string, want, got any) []diagnostics.Diff {
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			break
+		}
+		var diffs []diagnostics.Diff
+		keys := slices.Sorted(maps.Keys(w))
+		for k := range g {
+			if _, ok := w[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			diffs = append(diffs, diffObjects(resource, path+"."+k, w[k], g[k])...)
+		}
+		return diffs
+	case []any:
+		g, ok := got.([]any)
+		if !ok {
+			break
+		}
+		var diffs []diagnostics.Diff
+		for i := range max(len(w), len(g)) {
+			var we, ge any
+			if i < len(w) {
+				we = w[i]
+			}
+			if i < len(g) {
+				ge = g[i]
+			}
+			diffs = append(diffs, diffObjects(resource, fmt.Sprintf("%s[%d]", path, i), we, ge)...)
+		}
+		return diffs
+	}
+	if scenario.ValuesEqual(want, got) {
+		return nil
+	}
+	return []diagnostics.Diff{{Resource: resource, Path: path, Expected: want, Actual: got}}
+}
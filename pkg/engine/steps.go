@@ -0,0 +1,32 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/diagnostics"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// runSteps runs the steps of a multi-step scenario in order, firing each
+// step's trigger and waiting for its expectations. Their outcomes are
+// recorded in res after the scenario's own.
+func (e *Engine) runSteps(ctx context.Context, s *scenario.Scenario, cs *compiled, res *Result, diffs *[]diagnostics.Diff) error {
+	for i, step := range cs.steps {
+		name := s.StepName(i)
+		e.log.Info("step started", "scenario", s.Name, "step", name)
+		if err := e.fireTrigger(ctx, step.scenario); err != nil {
+			return fmt.Errorf("%s: trigger: %w", name, err)
+		}
+		var outcomes []ExpectationResult
+		err := e.waitForExpectations(ctx, step.scenario, &compiled{expect: step.expect}, res.StartedAt, diffs, &outcomes)
+		for _, o := range outcomes {
+			o.Step = name
+			res.Expectations = append(res.Expectations, o)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// teardownTimeout bounds a scenario's teardown, deleted objects included,
+// which may take a while to go with their finalizers.
+const teardownTimeout = 2 * time.Minute
+
+// setupState is what teardown needs to know of setup: the scenario with
+// the values setup produced filled in, and the names generated for setup
+// objects with metadata.generateName. run fills it in as setup goes.
+type setupState struct {
+	scenario  *scenario.Scenario
+	generated map[string]string
+}
+
+// teardown runs the teardown of cs.scenario, if any: its patches and
+// commands, then the deletion of its objects, waiting for them to go. A
+// failing teardown fails res if it passed; otherwise it is only logged,
+// so the scenario's own error stands.
+func (e *Engine) teardown(ctx context.Context, cs *compiled, setup *setupState, res *Result) {
+	s := cs.scenario
+	if setup.scenario != nil {
+		s = setup.scenario
+	}
+	if s.Teardown == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), teardownTimeout)
+	defer cancel()
+	e.log.Info("tearing down", "scenario", s.Name)
+	err := e.runTeardown(ctx, s.Teardown, e.teardownObjects(cs, setup.generated))
+	if err == nil {
+		return
+	}
+	if res.Passed {
+		res.Passed = false
+		res.Error = fmt.Sprintf("teardown: %v", err)
+		e.log.Info("scenario failed", "scenario", s.Name, "error", res.Error)
+		return
+	}
+	e.log.Warn("tearing down", "scenario", s.Name, "error", err)
+}
+
+// runTeardown applies the patches and runs the commands of t, then deletes
+// objs. It goes on past failures and returns them all.
+func (e *Engine) runTeardown(ctx context.Context, t *scenario.Teardown, objs []*unstructured.Unstructured) error {
+	var errs []error
+	for i := range t.Patches {
+		if err := e.patchTrigger(ctx, &t.Patches[i]); err != nil {
+			errs = append(errs, fmt.Errorf("patches[%d]: %w", i, err))
+		}
+	}
+	for i := range t.Exec {
+		if err := e.execTrigger(ctx, &t.Exec[i]); err != nil {
+			errs = append(errs, fmt.Errorf("exec[%d]: %w", i, err))
+		}
+	}
+	var deleted []*unstructured.Unstructured
+	for _, obj := range objs {
+		gone, err := e.deleteObject(ctx, obj)
+		if err != nil {
+			errs = append(errs, err)
+		} else if !gone {
+			deleted = append(deleted, obj)
+		}
+	}
+	if err := e.waitDeleted(ctx, deleted); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// teardownObjects returns the objects teardown deletes, in order: those of
+// the teardown manifests, then, with deleteSetup, the setup objects in the
+// reverse of the order they were applied in, CustomResourceDefinitions
+// last. Setup objects with metadata.generateName take the names generated
+// for them; those never created are left out.
+func (e *Engine) teardownObjects(cs *compiled, generated map[string]string) []*unstructured.Unstructured {
+	var objs []*unstructured.Unstructured
+	for _, m := range cs.teardown {
+		for _, obj := range m.objs {
+			if obj.GetName() != "" {
+				objs = append(objs, obj)
+			}
+		}
+	}
+	if !cs.scenario.Teardown.DeleteSetup {
+		return objs
+	}
+	var setup, crds []*unstructured.Unstructured
+	for _, m := range cs.manifests {
+		for _, obj := range m.objs {
+			if obj.GetName() == "" {
+				name, ok := generated[scenario.GeneratedKey(obj.GetGenerateName())]
+				if !ok {
+					continue
+				}
+				obj = obj.DeepCopy()
+				obj.SetName(name)
+			}
+			if isCRD(obj) {
+				crds = append(crds, obj)
+			} else {
+				setup = append(setup, obj)
+			}
+		}
+	}
+	for _, g := range cs.generated {
+		setup = append(setup, g.objs...)
+	}
+	slices.Reverse(setup)
+	slices.Reverse(crds)
+	return append(append(objs, setup...), crds...)
+}
+
+// deleteObject deletes obj, reporting whether it was already gone.
+func (e *Engine) deleteObject(ctx context.Context, obj *unstructured.Unstructured) (bool, error) {
+	ri, err := e.resourceInterface(obj.GroupVersionKind(), obj.GetNamespace())
+	if err != nil {
+		return false, err
+	}
+	background := metav1.DeletePropagationBackground
+	err = ri.Delete(ctx, obj.GetName(), metav1.DeleteOptions{PropagationPolicy: &background})
+	switch {
+	case apierrors.IsNotFound(err):
+		return true, nil
+	case err != nil:
+		return false, fmt.Errorf("deleting %s %s: %w", obj.GetKind(), obj.GetName(), err)
+	}
+	return false, nil
+}
+
+// waitDeleted waits for objs to be gone, so the scenarios that follow do
+// not find them terminating.
+func (e *Engine) waitDeleted(ctx context.Context, objs []*unstructured.Unstructured) error {
+	remaining := objs
+	err := wait.PollUntilContextCancel(ctx, e.pollInterval, true, func(ctx context.Context) (bool, error) {
+		var left []*unstructured.Unstructured
+		for _, obj := range remaining {
+			ri, err := e.resourceInterface(obj.GroupVersionKind(), obj.GetNamespace())
+			if err != nil {
+				return false, err
+			}
+			if _, err := ri.Get(ctx, obj.GetName(), metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+				left = append(left, obj)
+			}
+		}
+		remaining = left
+		return len(remaining) == 0, nil
+	})
+	if err != nil && len(remaining) > 0 {
+		return fmt.Errorf("%d deleted objects still there, %s %s among them: %w", len(remaining), remaining[0].GetKind(), remaining[0].GetName(), err)
+	}
+	return err
+}
@@ -0,0 +1,323 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/diagnostics"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// maxTenantErrors bounds how many failed tenants a scenario error names.
+const maxTenantErrors = 3
+
+// TenantResult is the outcome of one tenant of a scenario with tenants.
+type TenantResult struct {
+	Namespace string
+	Converged bool
+	// Latency is how long after its trigger the tenant's expectations
+	// were met, to within the poll interval.
+	Latency time.Duration
+	Error   string
+}
+
+// TenantSpread returns the fastest, median, and slowest latency of the
+// tenants that converged; all zero when none did.
+func (r *Result) TenantSpread() (fastest, median, slowest time.Duration) {
+	var latencies []time.Duration
+	for _, t := range r.Tenants {
+		if t.Converged {
+			latencies = append(latencies, t.Latency)
+		}
+	}
+	if len(latencies) == 0 {
+		return 0, 0, 0
+	}
+	slices.Sort(latencies)
+	return latencies[0], latencies[len(latencies)/2], latencies[len(latencies)-1]
+}
+
+// tenantPlan splits a compiled scenario into the setup shared by all
+// tenants and the part each tenant gets a copy of.
+type tenantPlan struct {
+	shared *compiled
+	// perTenant holds the objects in the from namespace, and every
+	// expectation; moveExpect marks those in the from namespace, and
+	// moveSource the resources their values are sourced from that are.
+	perTenant  *compiled
+	moveExpect []bool
+	moveSource [][]bool
+}
+
+// planTenants splits cs by namespace. Objects are located through the REST
+// mapper, so the scenario's CRDs must be established.
+func (e *Engine) planTenants(cs *compiled, from string) (*tenantPlan, error) {
+	p := &tenantPlan{shared: &compiled{}, perTenant: &compiled{expect: cs.expect}}
+	inFrom := func(obj *unstructured.Unstructured) (bool, error) {
+		if obj.GetKind() == "Namespace" && obj.GetAPIVersion() == "v1" {
+			return false, nil
+		}
+		_, ns, err := e.locate(obj.GroupVersionKind(), obj.GetNamespace())
+		return ns == from, err
+	}
+	for _, m := range cs.manifests {
+		shared, moved := compiledManifest{path: m.path}, compiledManifest{path: m.path}
+		for _, obj := range m.objs {
+			if isCRD(obj) {
+				continue
+			}
+			if obj.GetKind() == "Namespace" && obj.GetName() == from {
+				// Each tenant's namespace is created by the engine.
+				continue
+			}
+			ok, err := inFrom(obj)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", m.path, err)
+			}
+			if ok {
+				moved.objs = append(moved.objs, obj)
+			} else {
+				shared.objs = append(shared.objs, obj)
+			}
+		}
+		p.shared.manifests = append(p.shared.manifests, shared)
+		p.perTenant.manifests = append(p.perTenant.manifests, moved)
+	}
+	for i, g := range cs.generated {
+		if len(g.objs) == 0 {
+			continue
+		}
+		// A generator's copies share their kind and namespace.
+		ok, err := inFrom(g.objs[0])
+		if err != nil {
+			return nil, fmt.Errorf("setup.generate[%d]: %w", i, err)
+		}
+		if ok {
+			p.perTenant.generated = append(p.perTenant.generated, g)
+		} else {
+			p.shared.generated = append(p.shared.generated, g)
+		}
+	}
+	for _, exp := range cs.expect {
+		ok, err := e.refInNamespace(exp.Resource, from)
+		if err != nil {
+			return nil, err
+		}
+		p.moveExpect = append(p.moveExpect, ok)
+		sources := make([]bool, len(exp.Conditions))
+		for j, c := range exp.Conditions {
+			if c.ValueFrom == nil || c.ValueFrom.ResourceField == nil {
+				continue
+			}
+			if sources[j], err = e.refInNamespace(c.ValueFrom.ResourceField.ResourceRef, from); err != nil {
+				return nil, err
+			}
+		}
+		p.moveSource = append(p.moveSource, sources)
+	}
+	return p, nil
+}
+
+func (e *Engine) refInNamespace(ref scenario.ResourceRef, ns string) (bool, error) {
+	gvk, err := refGVK(ref)
+	if err != nil {
+		return false, err
+	}
+	_, refNS, err := e.locate(gvk, ref.Namespace)
+	return refNS == ns, err
+}
+
+// forTenant returns the tenant's copy of the per-tenant setup and the
+// expectations, moved to ns.
+func (p *tenantPlan) forTenant(ns string) *compiled {
+	cs := &compiled{}
+	move := func(objs []*unstructured.Unstructured) []*unstructured.Unstructured {
+		moved := make([]*unstructured.Unstructured, len(objs))
+		for i, obj := range objs {
+			moved[i] = obj.DeepCopy()
+			moved[i].SetNamespace(ns)
+		}
+		return moved
+	}
+	for _, m := range p.perTenant.manifests {
+		cs.manifests = append(cs.manifests, compiledManifest{path: m.path, objs: move(m.objs)})
+	}
+	for _, g := range p.perTenant.generated {
+		cs.generated = append(cs.generated, compiledGenerator{objs: move(g.objs), parallelism: g.parallelism})
+	}
+	for i, exp := range p.perTenant.expect {
+		if p.moveExpect[i] {
+			exp.Resource.Namespace = ns
+		}
+		if slices.Contains(p.moveSource[i], true) {
+			exp.Conditions = slices.Clone(exp.Conditions)
+			for j, move := range p.moveSource[i] {
+				if !move {
+					continue
+				}
+				c := &exp.Conditions[j]
+				f := *c.ValueFrom.ResourceField
+				f.Namespace = ns
+				c.ValueFrom = &scenario.ValueSource{ResourceField: &f}
+			}
+		}
+		cs.expect = append(cs.expect, exp)
+	}
+	return cs
+}
+
+// tenant is one instance of a scenario with tenants.
+type tenant struct {
+	index     int
+	namespace string
+	scenario  *scenario.Scenario
+	compiled  *compiled
+}
+
+// runTenants sets up every tenant, fires their triggers together, and waits
+// for each to converge. Setup failures fail the scenario at once; the
+// outcome of each tenant that got to its trigger is recorded in res.
+func (e *Engine) runTenants(ctx context.Context, s *scenario.Scenario, cs *compiled, res *Result, diffs *[]diagnostics.Diff) error {
+	from := s.Tenants.FromOrDefault()
+	namespaces, err := s.Tenants.Namespaces()
+	if err != nil {
+		return fmt.Errorf("tenants: %w", err)
+	}
+	// The CRDs go first: objects of their kinds can only be located once
+	// they are established.
+	crds := &compiled{}
+	for _, m := range cs.manifests {
+		notCRD := func(obj *unstructured.Unstructured) bool { return !isCRD(obj) }
+		crds.manifests = append(crds.manifests, compiledManifest{path: m.path, objs: slices.DeleteFunc(slices.Clone(m.objs), notCRD)})
+	}
+	if _, err := e.applySetup(ctx, crds); err != nil {
+		return fmt.Errorf("setup: %w", err)
+	}
+	plan, err := e.planTenants(cs, from)
+	if err != nil {
+		return fmt.Errorf("setup: %w", err)
+	}
+	if _, err := e.applySetup(ctx, plan.shared); err != nil {
+		return fmt.Errorf("setup: %w", err)
+	}
+
+	tenants := make([]tenant, len(namespaces))
+	for i, ns := range namespaces {
+		tcs := plan.forTenant(ns)
+		ts := *s
+		ts.Expect = nil
+		for _, exp := range tcs.expect {
+			ts.Expect = append(ts.Expect, exp.Expectation)
+		}
+		if s.Trigger != nil && s.Trigger.Patch != nil {
+			p := s.Trigger.Patch
+			moved, err := e.refInNamespace(p.ResourceRef, from)
+			if err != nil {
+				return fmt.Errorf("trigger: %w", err)
+			}
+			patch := *p
+			if moved {
+				patch.Namespace = ns
+			}
+			ts.Trigger = &scenario.Trigger{Patch: &patch}
+		}
+		tenants[i] = tenant{index: i, namespace: ns, scenario: &ts, compiled: tcs}
+	}
+
+	err = forEach(ctx, tenants, s.Tenants.ParallelismOrDefault(), func(ctx context.Context, t tenant) error {
+		if err := e.createNamespace(ctx, t.namespace); err != nil {
+			return fmt.Errorf("tenant %s: %w", t.namespace, err)
+		}
+		if _, err := e.applySetup(ctx, t.compiled); err != nil {
+			return fmt.Errorf("tenant %s: %w", t.namespace, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("setup: %w", err)
+	}
+	e.log.Info("tenants set up", "scenario", s.Name, "tenants", len(tenants))
+
+	var mu sync.Mutex
+	res.Tenants = make([]TenantResult, len(tenants))
+	// Every tenant waits at once, however many there are: the point is
+	// to load the agents with all of them together.
+	_ = forEach(ctx, tenants, len(tenants), func(ctx context.Context, t tenant) error {
+		tr := TenantResult{Namespace: t.namespace}
+		var tdiffs []diagnostics.Diff
+		var outcomes []ExpectationResult
+		var patch *scenario.ResourcePatch
+		if t.scenario.Trigger != nil {
+			patch = t.scenario.Trigger.Patch
+		}
+		start := time.Now()
+		err := e.patchTrigger(ctx, patch)
+		if err != nil {
+			err = fmt.Errorf("trigger: %w", err)
+		} else {
+			err = e.waitForExpectations(ctx, t.scenario, t.compiled, start, &tdiffs, &outcomes)
+		}
+		tr.Latency = time.Since(start)
+		tr.Converged = err == nil
+		if err != nil {
+			tr.Error = err.Error()
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		res.Tenants[t.index] = tr
+		res.Expectations = append(res.Expectations, outcomes...)
+		*diffs = append(*diffs, tdiffs...)
+		return nil
+	})
+	return tenantsError(s.Tenants, res)
+}
+
+// tenantsError fails a scenario whose tenants did not all converge, or
+// converged further apart than allowed.
+func tenantsError(t *scenario.Tenants, res *Result) error {
+	var failed []string
+	for _, tr := range res.Tenants {
+		if !tr.Converged {
+			failed = append(failed, fmt.Sprintf("%s: %s", tr.Namespace, tr.Error))
+		}
+	}
+	if len(failed) > 0 {
+		msg := fmt.Sprintf("%d of %d tenants did not converge", len(failed), len(res.Tenants))
+		if len(failed) > maxTenantErrors {
+			failed = append(failed[:maxTenantErrors], "...")
+		}
+		return errors.New(msg + ": " + strings.Join(failed, "; "))
+	}
+	fastest, _, slowest := res.TenantSpread()
+	if t.MaxSpread != nil && slowest-fastest > t.MaxSpread.Duration {
+		return fmt.Errorf("tenant latency spread %s (fastest %s, slowest %s) exceeds maxSpread %s",
+			slowest-fastest, fastest, slowest, t.MaxSpread.Duration)
+	}
+	return nil
+}
+
+// createNamespace creates namespace ns unless it exists.
+func (e *Engine) createNamespace(ctx context.Context, ns string) error {
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata":   map[string]any{"name": ns},
+	}}
+	if err := e.anchor.Own(ctx, obj); err != nil {
+		return err
+	}
+	_, err := e.dynamic.Resource(namespaceResource).Create(ctx, obj, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("creating namespace %s: %w", ns, err)
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.yaml.in/yaml/v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/openapi"
+	"k8s.io/client-go/openapi3"
+)
+
+// schemaValidator checks objects against the OpenAPI v3 schemas the cluster
+// publishes, which include the structural schemas of installed CRDs.
+type schemaValidator struct {
+	root openapi3.Root
+
+	mu    sync.Mutex
+	specs map[schema.GroupVersion]map[string]any
+}
+
+func newSchemaValidator(client openapi.Client) *schemaValidator {
+	return &schemaValidator{
+		root:  openapi3.NewRoot(client),
+		specs: map[schema.GroupVersion]map[string]any{},
+	}
+}
+
+// fieldError is a schema violation at a path within an object. Path
+// elements are map keys (string) and list indexes (int).
+type fieldError struct {
+	path []any
+	msg  string
+}
+
+func (f fieldError) String() string {
+	var b strings.Builder
+	for _, p := range f.path {
+		switch p := p.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", p)
+		default:
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			fmt.Fprint(&b, p)
+		}
+	}
+	return b.String() + ": " + f.msg
+}
+
+// validate returns the schema violations in obj. Kinds the cluster
+// publishes no schema for are not checked.
+func (v *schemaValidator) validate(obj *unstructured.Unstructured) ([]fieldError, error) {
+	doc, s, err := v.schemaFor(obj.GroupVersionKind())
+	if err != nil || s == nil {
+		return nil, err
+	}
+	w := &schemaWalker{doc: doc}
+	w.check(obj.Object, s, nil)
+	return w.errs, nil
+}
+
+// schemaFor returns the OpenAPI document of gvk's group version and the
+// schema of gvk within it, fetching the document again once when the kind
+// is missing from the cached copy (e.g. a CRD installed since).
+func (v *schemaValidator) schemaFor(gvk schema.GroupVersionKind) (map[string]any, map[string]any, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	gv := gvk.GroupVersion()
+	if doc, ok := v.specs[gv]; ok {
+		if s := findKind(doc, gvk); s != nil {
+			return doc, s, nil
+		}
+	}
+	doc, err := v.root.GVSpecAsMap(gv)
+	var notFound *openapi3.GroupVersionNotFoundError
+	if errors.As(err, &notFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetching OpenAPI schema of %s: %w", gv, err)
+	}
+	v.specs[gv] = doc
+	return doc, findKind(doc, gvk), nil
+}
+
+// findKind returns the component schema tagged with gvk.
+func findKind(doc map[string]any, gvk schema.GroupVersionKind) map[string]any {
+	components, _ := doc["components"].(map[string]any)
+	schemas, _ := components["schemas"].(map[string]any)
+	for _, s := range schemas {
+		s, _ := s.(map[string]any)
+		tags, _ := s["x-kubernetes-group-version-kind"].([]any)
+		for _, t := range tags {
+			t, _ := t.(map[string]any)
+			if t["group"] == gvk.Group && t["version"] == gvk.Version && t["kind"] == gvk.Kind {
+				return s
+			}
+		}
+	}
+	return nil
+}
+
+// schemaWalker checks a value against a schema, collecting violations.
+// Constructs it does not understand (oneOf, anyOf) are accepted, so it
+// reports typos and type mistakes without false positives.
+type schemaWalker struct {
+	doc  map[string]any
+	errs []fieldError
+}
+
+func (w *schemaWalker) fail(path []any, format string, args ...any) {
+	w.errs = append(w.errs, fieldError{path: append([]any(nil), path...), msg: fmt.Sprintf(format, args...)})
+}
+
+// resolve follows a $ref to a component schema.
+func (w *schemaWalker) resolve(s map[string]any) map[string]any {
+	ref, ok := s["$ref"].(string)
+	if !ok {
+		return s
+	}
+	components, _ := w.doc["components"].(map[string]any)
+	schemas, _ := components["schemas"].(map[string]any)
+	target, _ := schemas[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]any)
+	return target
+}
+
+func (w *schemaWalker) check(value any, s map[string]any, path []any) {
+	s = w.resolve(s)
+	if value == nil || s == nil {
+		return
+	}
+	if all, ok := s["allOf"].([]any); ok {
+		for _, sub := range all {
+			if sub, ok := sub.(map[string]any); ok {
+				w.check(value, sub, path)
+			}
+		}
+	}
+	if _, ok := s["oneOf"]; ok {
+		return
+	}
+	if _, ok := s["anyOf"]; ok {
+		return
+	}
+	format, _ := s["format"].(string)
+	if s["x-kubernetes-int-or-string"] == true || format == "int-or-string" {
+		if !isInteger(value) && !isString(value) {
+			w.fail(path, "expected integer or string, got %s", jsonType(value))
+		}
+		return
+	}
+
+	switch typ, _ := s["type"].(string); typ {
+	case "object":
+		m, ok := value.(map[string]any)
+		if !ok {
+			w.fail(path, "expected object, got %s", jsonType(value))
+			return
+		}
+		w.checkFields(m, s, path)
+	case "array":
+		list, ok := value.([]any)
+		if !ok {
+			w.fail(path, "expected array, got %s", jsonType(value))
+			return
+		}
+		if items, ok := s["items"].(map[string]any); ok {
+			for i, item := range list {
+				w.check(item, items, append(path, i))
+			}
+		}
+	case "string":
+		// Quantities are commonly written as bare numbers.
+		if !isString(value) && !(format == "quantity" && isNumber(value)) {
+			w.fail(path, "expected string, got %s", jsonType(value))
+		}
+	case "integer":
+		if !isInteger(value) {
+			w.fail(path, "expected integer, got %s", jsonType(value))
+		}
+	case "number":
+		if !isNumber(value) {
+			w.fail(path, "expected number, got %s", jsonType(value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			w.fail(path, "expected boolean, got %s", jsonType(value))
+		}
+	}
+}
+
+// checkFields checks the fields of an object, reporting those the schema
+// neither declares nor allows.
+func (w *schemaWalker) checkFields(m map[string]any, s map[string]any, path []any) {
+	props, _ := s["properties"].(map[string]any)
+	additional := s["additionalProperties"]
+	open := additional == true || s["x-kubernetes-preserve-unknown-fields"] == true ||
+		(len(props) == 0 && additional == nil)
+	embedded := s["x-kubernetes-embedded-resource"] == true
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fieldPath := append(path, k)
+		if ps, ok := props[k].(map[string]any); ok {
+			w.check(m[k], ps, fieldPath)
+			continue
+		}
+		if as, ok := additional.(map[string]any); ok {
+			w.check(m[k], as, fieldPath)
+			continue
+		}
+		if open || (embedded && (k == "apiVersion" || k == "kind" || k == "metadata")) {
+			continue
+		}
+		w.fail(fieldPath, "unknown field")
+	}
+}
+
+func isString(v any) bool {
+	_, ok := v.(string)
+	return ok
+}
+
+func isNumber(v any) bool {
+	switch v.(type) {
+	case int64, int, float64:
+		return true
+	}
+	return false
+}
+
+func isInteger(v any) bool {
+	switch v := v.(type) {
+	case int64, int:
+		return true
+	case float64:
+		return v == math.Trunc(v)
+	}
+	return false
+}
+
+func jsonType(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int64, int, float64:
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// manifestDocs parses a manifest file into YAML nodes, one per non-empty
+// document, in the order decodeManifests returns objects.
+func manifestDocs(path string) []*yaml.Node {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	var docs []*yaml.Node
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err != nil {
+			return docs
+		}
+		if len(doc.Content) == 1 && doc.Content[0].Kind == yaml.MappingNode && len(doc.Content[0].Content) > 0 {
+			docs = append(docs, doc.Content[0])
+		}
+	}
+}
+
+// nodeLine returns the line of the deepest node along path, falling back to
+// the line of the document itself.
+func nodeLine(doc *yaml.Node, path []any) int {
+	line := doc.Line
+	cur := doc
+	for _, p := range path {
+		var next *yaml.Node
+		switch p := p.(type) {
+		case string:
+			if cur.Kind != yaml.MappingNode {
+				return line
+			}
+			for i := 0; i+1 < len(cur.Content); i += 2 {
+				if cur.Content[i].Value == p {
+					line = cur.Content[i].Line
+					next = cur.Content[i+1]
+					break
+				}
+			}
+		case int:
+			if cur.Kind == yaml.SequenceNode && p < len(cur.Content) {
+				next = cur.Content[p]
+				line = next.Line
+			}
+		}
+		if next == nil {
+			return line
+		}
+		cur = next
+	}
+	return line
+}
@@ -0,0 +1,25 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/diagnostics"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// waitForSetup waits for the setup.waitFor states of s, so the trigger
+// does not fire before the setup objects are ready. Their diffs are left
+// in diffs for diagnostics when the wait fails.
+func (e *Engine) waitForSetup(ctx context.Context, s *scenario.Scenario, cs *compiled, since time.Time, diffs *[]diagnostics.Diff) error {
+	if len(cs.waitFor) == 0 {
+		return nil
+	}
+	e.log.Info("waiting for setup", "scenario", s.Name)
+	var outcomes []ExpectationResult
+	if err := e.waitForExpectations(ctx, s.WaitForScenario(), &compiled{expect: cs.waitFor}, since, diffs, &outcomes); err != nil {
+		return fmt.Errorf("waitFor: %w", err)
+	}
+	return nil
+}
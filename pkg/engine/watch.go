@@ -0,0 +1,165 @@
+package engine
+
+import (
+	"reflect"
+	"slices"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/diagnostics"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// watchHistory is how many watch events the cache keeps per object for
+// failure reports.
+const watchHistory = 10
+
+// recorder returns the event handler that keeps the watch history of the
+// objects of key.
+func (c *objectCache) recorder(key cacheKey) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			if u, ok := obj.(*unstructured.Unstructured); ok {
+				c.record(key, "ADDED", u, nil)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj any) {
+			old, _ := oldObj.(*unstructured.Unstructured)
+			u, ok := newObj.(*unstructured.Unstructured)
+			// Resyncs replay unchanged objects.
+			if !ok || old == nil || old.GetResourceVersion() == u.GetResourceVersion() {
+				return
+			}
+			c.record(key, "MODIFIED", u, changedParts(old, u))
+		},
+		DeleteFunc: func(obj any) {
+			if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = d.Obj
+			}
+			if u, ok := obj.(*unstructured.Unstructured); ok {
+				c.record(key, "DELETED", u, nil)
+			}
+		},
+	}
+}
+
+func (c *objectCache) record(key cacheKey, typ string, obj *unstructured.Unstructured, changed []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	okey := objectKey{key, obj.GetName()}
+	events := append(c.history[okey], diagnostics.WatchEvent{
+		Type:            typ,
+		ResourceVersion: obj.GetResourceVersion(),
+		Generation:      obj.GetGeneration(),
+		Changed:         changed,
+		Time:            time.Now(),
+	})
+	if len(events) > watchHistory {
+		events = slices.Delete(events, 0, len(events)-watchHistory)
+	}
+	c.history[okey] = events
+}
+
+// track records that a scenario started at start is running, and returns
+// the function to call when it ends. That forgets the watch history of
+// objects with no events since the oldest scenario still running started,
+// deleted objects included, so the history does not grow with every object
+// an engine ever watched.
+func (c *objectCache) track(start time.Time) func() {
+	c.mu.Lock()
+	c.running = append(c.running, start)
+	c.mu.Unlock()
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		i := slices.Index(c.running, start)
+		c.running = slices.Delete(c.running, i, i+1)
+		horizon := time.Now()
+		if len(c.running) > 0 {
+			horizon = slices.MinFunc(c.running, time.Time.Compare)
+		}
+		for key, events := range c.history {
+			if events[len(events)-1].Time.Before(horizon) {
+				delete(c.history, key)
+			}
+		}
+	}
+}
+
+// watchEvents returns the recorded watch events of an object, oldest
+// first.
+func (c *objectCache) watchEvents(key objectKey) []diagnostics.WatchEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.history[key])
+}
+
+// changedParts names the parts of an object that differ between old and
+// u.
+func changedParts(old, u *unstructured.Unstructured) []string {
+	var changed []string
+	for _, part := range []struct {
+		name string
+		path []string
+	}{
+		{"spec", []string{"spec"}},
+		{"status", []string{"status"}},
+		{"labels", []string{"metadata", "labels"}},
+		{"annotations", []string{"metadata", "annotations"}},
+	} {
+		a, _, _ := unstructured.NestedFieldNoCopy(old.Object, part.path...)
+		b, _, _ := unstructured.NestedFieldNoCopy(u.Object, part.path...)
+		if !reflect.DeepEqual(a, b) {
+			changed = append(changed, part.name)
+		}
+	}
+	return changed
+}
+
+// watchReport returns the watch history, since the scenario started, of
+// the resources of the expectations res records as unmet.
+func (e *Engine) watchReport(s *scenario.Scenario, res *Result) []diagnostics.WatchEvent {
+	if e.cache == nil {
+		return nil
+	}
+	unmet := map[string]bool{}
+	for _, o := range res.Expectations {
+		if !o.Met {
+			unmet[o.Resource] = true
+		}
+	}
+	var events []diagnostics.WatchEvent
+	seen := map[string]bool{}
+	expect := slices.Clone(s.Expect)
+	for _, st := range s.Steps {
+		expect = append(expect, st.Expect...)
+	}
+	for _, exp := range expect {
+		resource := exp.Resource.String()
+		// Only named resources have an object's watch events to show.
+		if exp.Resource.LabelSelector != nil || !unmet[resource] || seen[resource] {
+			continue
+		}
+		seen[resource] = true
+		gvk, err := refGVK(exp.Resource)
+		if err != nil {
+			continue
+		}
+		gvr, ns, err := e.locate(gvk, exp.Resource.Namespace)
+		if err != nil {
+			continue
+		}
+		for _, ev := range e.cache.watchEvents(objectKey{cacheKey{gvr, ns}, exp.Resource.Name}) {
+			// Earlier events may be of earlier scenarios' objects of
+			// the same name.
+			if ev.Time.Before(res.StartedAt) {
+				continue
+			}
+			ev.Resource = resource
+			events = append(events, ev)
+		}
+	}
+	return events
+}
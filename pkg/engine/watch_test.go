@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestTrackForgetsHistory(t *testing.T) {
+	c := newObjectCache(nil, InformerOptions{})
+	key := cacheKey{schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, "default"}
+	obj := func(name string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetName(name)
+		return u
+	}
+
+	endFirst := c.track(time.Now())
+	c.record(key, "ADDED", obj("old"), nil)
+	c.record(key, "DELETED", obj("old"), nil)
+	time.Sleep(time.Millisecond)
+	endSecond := c.track(time.Now())
+	c.record(key, "ADDED", obj("new"), nil)
+
+	// The first scenario ending leaves what the second may report.
+	endFirst()
+	if got := len(c.watchEvents(objectKey{key, "old"})); got != 0 {
+		t.Errorf("history of an object with no events since the running scenario started has %d events, want none", got)
+	}
+	if got := len(c.watchEvents(objectKey{key, "new"})); got != 1 {
+		t.Errorf("history of an object the running scenario watched has %d events, want 1", got)
+	}
+
+	endSecond()
+	if len(c.history) != 0 {
+		t.Errorf("history holds %d objects with no scenario running, want none", len(c.history))
+	}
+}
@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	webhookPollInterval = 500 * time.Millisecond
+	// webhookTimeout bounds how long the trigger waits for admission
+	// webhooks to start serving.
+	webhookTimeout = time.Minute
+)
+
+// waitForWebhooks dry-runs the trigger patch until the admission webhooks
+// that intercept it answer. A webhook registered by an agent can exist
+// before its endpoint serves; firing the real patch then would fail or,
+// with failurePolicy Ignore, silently skip the agent.
+func (e *Engine) waitForWebhooks(ctx context.Context, ri dynamic.ResourceInterface, name string, patch []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	var lastErr error
+	err := wait.PollUntilContextCancel(ctx, webhookPollInterval, true, func(ctx context.Context) (bool, error) {
+		_, err := ri.Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{
+			DryRun: []string{metav1.DryRunAll},
+		})
+		if isWebhookUnavailable(err) {
+			lastErr = err
+			return false, nil
+		}
+		return true, err
+	})
+	if err != nil && lastErr != nil {
+		return fmt.Errorf("admission webhooks not serving: %w", lastErr)
+	}
+	return err
+}
+
+// isWebhookUnavailable reports whether err is the API server failing to
+// reach an admission webhook, as opposed to the webhook rejecting the
+// request.
+func isWebhookUnavailable(err error) bool {
+	if err == nil || !apierrors.IsInternalError(err) {
+		return false
+	}
+	return strings.Contains(err.Error(), "failed calling webhook")
+}
@@ -0,0 +1,103 @@
+// Package envsubst expands ${VAR} references to environment variables in
+// the values scenarios and registries are loaded with, so CI pipelines can
+// inject registry prefixes and image digests without rewriting files.
+// Only the braced form is expanded; a bare $VAR is left as is, as is $${VAR},
+// which becomes ${VAR}. ${VAR:-default} expands to default when VAR is unset
+// or empty; referencing an unset variable without a default is an error.
+package envsubst
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var reference = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// Expand returns s with its ${VAR} references replaced by the values of
+// the environment variables.
+func Expand(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var missing []string
+	out := reference.ReplaceAllStringFunc(s, func(ref string) string {
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+		m := reference.FindStringSubmatch(ref)
+		name, def := m[1], m[2]
+		v, ok := os.LookupEnv(name)
+		if def != "" && v == "" {
+			return def[len(":-"):]
+		}
+		if !ok && !slices.Contains(missing, name) {
+			missing = append(missing, name)
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+// ExpandValue expands the strings in v, a value decoded from JSON or YAML,
+// in place where it can and returns the result.
+func ExpandValue(v any) (any, error) {
+	switch v := v.(type) {
+	case string:
+		return Expand(v)
+	case map[string]any:
+		for k, e := range v {
+			x, err := ExpandValue(e)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = x
+		}
+	case []any:
+		for i, e := range v {
+			x, err := ExpandValue(e)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = x
+		}
+	}
+	return v, nil
+}
+
+// ExpandImages expands the string values of image fields anywhere in obj,
+// a decoded Kubernetes object, such as the images of its containers.
+func ExpandImages(obj map[string]any) error {
+	var walk func(v any) error
+	walk = func(v any) error {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, e := range v {
+				if s, ok := e.(string); ok && k == "image" {
+					x, err := Expand(s)
+					if err != nil {
+						return fmt.Errorf("image %q: %w", s, err)
+					}
+					v[k] = x
+					continue
+				}
+				if err := walk(e); err != nil {
+					return err
+				}
+			}
+		case []any:
+			for _, e := range v {
+				if err := walk(e); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return walk(obj)
+}
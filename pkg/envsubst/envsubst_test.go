@@ -0,0 +1,103 @@
+package envsubst
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	t.Setenv("REGISTRY", "registry.example.com")
+	t.Setenv("TAG", "v1.2")
+	t.Setenv("EMPTY", "")
+	tests := []struct {
+		in   string
+		want string
+		err  string
+	}{
+		{in: "plain", want: "plain"},
+		{in: "${REGISTRY}/app:${TAG}", want: "registry.example.com/app:v1.2"},
+		{in: "$REGISTRY/app", want: "$REGISTRY/app"},
+		{in: "$${REGISTRY}", want: "${REGISTRY}"},
+		{in: "$$${TAG}", want: "$${TAG}"},
+		{in: "${UNSET_VAR:-fallback}", want: "fallback"},
+		{in: "${EMPTY:-fallback}", want: "fallback"},
+		{in: "${TAG:-fallback}", want: "v1.2"},
+		{in: "${UNSET_VAR:-}", want: ""},
+		{in: "${EMPTY}", want: ""},
+		{in: "$${UNSET_VAR:-x}", want: "${UNSET_VAR:-x}"},
+		{in: "${UNSET_VAR}", err: "environment variable UNSET_VAR is not set"},
+		{in: "${UNSET_B}-${UNSET_A}-${UNSET_B}", err: "environment variable UNSET_B, UNSET_A is not set"},
+		{in: "${1BAD}", want: "${1BAD}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Expand(tt.in)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("Expand(%q) error = %v, want %q", tt.in, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expand(%q) error = %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("Expand(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandImages(t *testing.T) {
+	t.Setenv("REGISTRY", "registry.example.com")
+	obj := map[string]any{
+		"kind": "Deployment",
+		"metadata": map[string]any{
+			"name": "${REGISTRY}",
+		},
+		"spec": map[string]any{
+			"template": map[string]any{
+				"spec": map[string]any{
+					"initContainers": []any{
+						map[string]any{"name": "init", "image": "${REGISTRY}/init:1"},
+					},
+					"containers": []any{
+						map[string]any{"name": "app", "image": "${REGISTRY}/app:1", "args": []any{"${REGISTRY}"}},
+						map[string]any{"name": "side", "image": "busybox"},
+					},
+				},
+			},
+		},
+	}
+	if err := ExpandImages(obj); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"kind": "Deployment",
+		"metadata": map[string]any{
+			"name": "${REGISTRY}",
+		},
+		"spec": map[string]any{
+			"template": map[string]any{
+				"spec": map[string]any{
+					"initContainers": []any{
+						map[string]any{"name": "init", "image": "registry.example.com/init:1"},
+					},
+					"containers": []any{
+						map[string]any{"name": "app", "image": "registry.example.com/app:1", "args": []any{"${REGISTRY}"}},
+						map[string]any{"name": "side", "image": "busybox"},
+					},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(obj, want) {
+		t.Errorf("ExpandImages() = %v, want %v", obj, want)
+	}
+
+	err := ExpandImages(map[string]any{"image": "${UNSET_REGISTRY}/app"})
+	if err == nil || !strings.Contains(err.Error(), `image "${UNSET_REGISTRY}/app"`) {
+		t.Errorf("ExpandImages() with an unset variable: error = %v", err)
+	}
+}
@@ -0,0 +1,313 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/publish"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+const (
+	// DefaultJobName names the objects Job renders unless WithJobName says
+	// otherwise.
+	DefaultJobName = "kube-agents-test"
+
+	// Where the Job's container finds the suite, keeps run state and, with
+	// WithResultsPVC, writes results.
+	suiteMount   = "/suite"
+	stateMount   = "/var/lib/kube-agents-test"
+	resultsMount = "/results"
+
+	// maxConfigMapBytes is what the API server accepts in a ConfigMap.
+	maxConfigMapBytes = 1 << 20
+)
+
+// configMapKeyUnsafe matches what may not appear in a ConfigMap key.
+var configMapKeyUnsafe = regexp.MustCompile(`[^-._a-zA-Z0-9]`)
+
+// JobOption configures the objects Job renders.
+type JobOption func(*jobConfig)
+
+type jobConfig struct {
+	name       string
+	agents     string
+	resultsPVC string
+	runArgs    []string
+}
+
+// WithJobName names the Job, its ServiceAccount, ClusterRoleBinding and
+// suite ConfigMap; the results ConfigMap is named <name>-results.
+func WithJobName(name string) JobOption {
+	return func(c *jobConfig) { c.name = name }
+}
+
+// WithAgents packages the agent registry file at path and passes it to the
+// run. The images it names must be pullable from the target cluster.
+func WithAgents(path string) JobOption {
+	return func(c *jobConfig) { c.agents = path }
+}
+
+// WithResultsPVC mounts the PersistentVolumeClaim claim at /results and
+// writes a JSON report and each scenario's artifacts there, in addition to
+// the results ConfigMap.
+func WithResultsPVC(claim string) JobOption {
+	return func(c *jobConfig) { c.resultsPVC = claim }
+}
+
+// WithRunArgs appends args to the run command line, e.g. --shard-index
+// and --shard-total.
+func WithRunArgs(args ...string) JobOption {
+	return func(c *jobConfig) { c.runArgs = append(c.runArgs, args...) }
+}
+
+// Job writes to w the manifests that run the suite at paths inside the
+// cluster, for clusters the framework cannot reach from outside: a
+// ConfigMap holding the scenario files and the manifests and golden files
+// they refer to, a ServiceAccount bound to cluster-admin, and a Job that
+// runs image, whose entrypoint must be kube-agents-test, against the
+// cluster it runs in. namespace must exist. Results are published there as
+// Events and in the results ConfigMap:
+//
+//	kubectl apply -f job.yaml
+//	kubectl wait -n <namespace> --for=condition=complete job/kube-agents-test
+//	kubectl get configmap -n <namespace> kube-agents-test-results -o yaml
+//	kubectl logs -n <namespace> job/kube-agents-test
+//
+// scenarios are the scenarios loaded from paths, used to find the files
+// outside paths they refer to. Files a scenario extends must be under
+// paths. The Job is not retried, so a failed verification stays failed.
+func Job(w io.Writer, paths []string, scenarios []*scenario.Scenario, image, namespace string, opts ...JobOption) error {
+	cfg := jobConfig{name: DefaultJobName}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	files, err := suiteFiles(paths, scenarios, cfg.agents)
+	if err != nil {
+		return err
+	}
+	root := commonDir(files)
+	suite := &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: jobMeta(cfg.name+"-suite", namespace),
+	}
+	var items []corev1.KeyToPath
+	size := 0
+	inSuite := func(path string) string {
+		rel, _ := filepath.Rel(root, path)
+		return filepath.ToSlash(rel)
+	}
+	for i, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		size += len(data)
+		key := fmt.Sprintf("%03d-%s", i, configMapKeyUnsafe.ReplaceAllString(filepath.Base(f), "_"))
+		if utf8.Valid(data) {
+			if suite.Data == nil {
+				suite.Data = map[string]string{}
+			}
+			suite.Data[key] = string(data)
+		} else {
+			if suite.BinaryData == nil {
+				suite.BinaryData = map[string][]byte{}
+			}
+			suite.BinaryData[key] = data
+		}
+		items = append(items, corev1.KeyToPath{Key: key, Path: inSuite(f)})
+	}
+	if size > maxConfigMapBytes {
+		return fmt.Errorf("the suite's %d files hold %d bytes; a ConfigMap holds at most %d", len(files), size, maxConfigMapBytes)
+	}
+
+	args := []string{"run", "-v",
+		"--publish-namespace", namespace,
+		"--publish-configmap", cfg.name + "-results",
+		"--state-dir", stateMount,
+	}
+	if cfg.agents != "" {
+		abs, err := filepath.Abs(cfg.agents)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--agents", suiteMount+"/"+inSuite(abs))
+	}
+	volumes := []corev1.Volume{
+		{Name: "suite", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: suite.Name},
+			Items:                items,
+		}}},
+		{Name: "state", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+	}
+	mounts := []corev1.VolumeMount{
+		{Name: "suite", MountPath: suiteMount, ReadOnly: true},
+		{Name: "state", MountPath: stateMount},
+	}
+	if cfg.resultsPVC != "" {
+		args = append(args, "--artifacts", resultsMount, "--report", "json="+resultsMount+"/results.json")
+		volumes = append(volumes, corev1.Volume{Name: "results", VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: cfg.resultsPVC},
+		}})
+		mounts = append(mounts, corev1.VolumeMount{Name: "results", MountPath: resultsMount})
+	}
+	args = append(args, cfg.runArgs...)
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		args = append(args, suiteMount+"/"+inSuite(abs))
+	}
+
+	backoff := int32(0)
+	objects := []any{
+		&corev1.ServiceAccount{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: jobMeta(cfg.name, namespace),
+		},
+		// The run creates namespaces, CRDs and agent RBAC of its own.
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+			ObjectMeta: jobMeta(cfg.name+"-"+namespace, ""),
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "cluster-admin"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: cfg.name, Namespace: namespace}},
+		},
+		suite,
+		&batchv1.Job{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+			ObjectMeta: jobMeta(cfg.name, namespace),
+			Spec: batchv1.JobSpec{
+				BackoffLimit: &backoff,
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app.kubernetes.io/name": publish.Component}},
+					Spec: corev1.PodSpec{
+						ServiceAccountName: cfg.name,
+						RestartPolicy:      corev1.RestartPolicyNever,
+						Containers: []corev1.Container{{
+							Name:         "run",
+							Image:        image,
+							Args:         args,
+							WorkingDir:   suiteMount,
+							VolumeMounts: mounts,
+						}},
+						Volumes: volumes,
+					},
+				},
+			},
+		},
+	}
+
+	var b bytes.Buffer
+	for i, obj := range objects {
+		out, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			b.WriteString("---\n")
+		}
+		b.Write(out)
+	}
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+// jobMeta is the metadata of an object Job renders.
+func jobMeta(name, namespace string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: namespace,
+		Labels:    map[string]string{"app.kubernetes.io/name": publish.Component},
+	}
+}
+
+// suiteFiles returns the absolute, sorted paths of the regular files under
+// paths, hidden directories aside, the setup manifests and existing golden
+// files of scenarios, and the agent registry file agents, if any.
+func suiteFiles(paths []string, scenarios []*scenario.Scenario, agents string) ([]string, error) {
+	var files []string
+	add := func(path string) error {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, abs)
+		return nil
+	}
+	for _, p := range paths {
+		err := filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			switch {
+			case err != nil:
+				return err
+			case d.IsDir() && path != p && strings.HasPrefix(d.Name(), "."):
+				return filepath.SkipDir
+			case !d.Type().IsRegular():
+				return nil
+			}
+			return add(path)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range scenarios {
+		for _, m := range s.Setup.Manifests {
+			if err := add(s.ManifestPath(m)); err != nil {
+				return nil, err
+			}
+		}
+		if s.Teardown != nil {
+			for _, m := range s.Teardown.Manifests {
+				if err := add(s.ManifestPath(m)); err != nil {
+					return nil, err
+				}
+			}
+		}
+		for _, sn := range s.Snapshots {
+			// Missing golden files fail the run, as they do outside it.
+			if _, err := os.Stat(s.SnapshotPath(sn)); err != nil {
+				continue
+			}
+			if err := add(s.SnapshotPath(sn)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if agents != "" {
+		if err := add(agents); err != nil {
+			return nil, err
+		}
+	}
+	slices.Sort(files)
+	return slices.Compact(files), nil
+}
+
+// commonDir returns the deepest directory all files are under.
+func commonDir(files []string) string {
+	if len(files) == 0 {
+		return string(filepath.Separator)
+	}
+	dir := filepath.Dir(files[0])
+	for _, f := range files[1:] {
+		for dir != filepath.Dir(dir) && !strings.HasPrefix(f, dir+string(filepath.Separator)) {
+			dir = filepath.Dir(dir)
+		}
+	}
+	return dir
+}
@@ -0,0 +1,734 @@
+// Package export renders scenarios into forms that run without the
+// framework, so a failing scenario can be reproduced by hand, and
+// package suites to run inside clusters the framework cannot reach.
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/agent"
+	"github.com/aslakknutsen/kube-agents-test/pkg/envsubst"
+	"github.com/aslakknutsen/kube-agents-test/pkg/fakeclock"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// Script names written by Kubectl.
+const (
+	RunScript      = "run.sh"
+	WaitScript     = "wait.sh"
+	TeardownScript = "teardown.sh"
+)
+
+// Kubectl writes s to dir as plain manifests and shell scripts that only
+// need kubectl: run.sh applies the setup and fires the trigger, wait.sh
+// polls the expectations until they hold or the scenario timeout passes,
+// and, for scenarios with a teardown, teardown.sh cleans up. The
+// scenario's agents must already run in the cluster.
+func Kubectl(s *scenario.Scenario, dir string) error {
+	if err := os.MkdirAll(filepath.Join(dir, "manifests"), 0o755); err != nil {
+		return err
+	}
+
+	var run bytes.Buffer
+	fmt.Fprintf(&run, "#!/bin/sh\n# Scenario %s: setup and trigger.\n", s.Name)
+	if len(s.Agents) > 0 {
+		fmt.Fprintf(&run, "# Requires these agents to be running: %s\n", strings.Join(s.Agents, ", "))
+	}
+	if s.Namespace != "" {
+		fmt.Fprintf(&run, "# Resources named without a namespace are in %s; make it kubectl's namespace first:\n#   kubectl config set-context --current --namespace %s\n", s.Namespace, s.Namespace)
+	}
+	if s.Preflight != nil {
+		fmt.Fprintln(&run, "# Not checked: the scenario's preflight assertions on the cluster.")
+	}
+	if len(s.APIFaults) > 0 {
+		fmt.Fprintln(&run, "# Not reproduced: apiFaults need the framework's API proxy in front of the agents.")
+	}
+	if ns := s.Setup.ControlNamespace; ns != "" {
+		fmt.Fprintf(&run, "# Not reproduced: copies of the setup objects in control namespace %s.\n", ns)
+	}
+	if s.HasSetupReferences() {
+		fmt.Fprintln(&run, "# Not reproduced: values only known once setup has run; replace the {{ .Generated }} references below with the names kubectl create prints, and the {{ .Exports }} ones with the exported values.")
+	}
+	for _, x := range s.Setup.Exports {
+		fmt.Fprintf(&run, "# Export %s: kubectl get %s%s -o jsonpath=%s\n",
+			x.Name, shellQuote(resourceArg(x.Resource)), namespaceArg(x.Resource.Namespace), shellQuote("{"+x.Path+"}"))
+	}
+	if t := s.Tenants; t != nil {
+		fmt.Fprintf(&run, "# Not reproduced: %d tenants in namespaces %s; this runs the scenario once, in %s.\n", t.Count, t.Namespace, t.FromOrDefault())
+	}
+	if l := s.Load; l != nil {
+		fmt.Fprintf(&run, "# Not reproduced: load test creating %d objects at %g/s.\n", l.Arrivals(), l.Rate)
+	}
+	for i := range s.Steps {
+		fmt.Fprintf(&run, "# Not reproduced: %s, which fires another trigger once the expected state is reached.\n", s.StepName(i))
+	}
+	for _, f := range s.ForbiddenMutations {
+		fmt.Fprintf(&run, "# Not checked: agent %s must not modify %s (see managedFields).\n", f.Agent, f.Resources)
+	}
+	for _, o := range s.ExpectOrder {
+		fmt.Fprintf(&run, "# Not checked: %s (see managedFields and Events).\n", o.Label())
+	}
+	for _, c := range s.Churn {
+		if c.MaxCreates != nil || c.MaxUpdates != nil || c.MaxDeletes != nil {
+			fmt.Fprintf(&run, "# Not checked: how often %s may be created, updated and deleted.\n", c.Resources)
+		}
+		for _, f := range c.Fields {
+			fmt.Fprintf(&run, "# Not checked: how %s of %s may move.\n", f.Path, c.Resources)
+		}
+	}
+	for _, sn := range s.Snapshots {
+		fmt.Fprintf(&run, "# Not checked: %s must match golden file %s.\n", sn.Resource, s.SnapshotPath(sn))
+	}
+	fmt.Fprintf(&run, "# Then run ./%s to wait for the expected state.\n", WaitScript)
+	if s.Teardown != nil {
+		fmt.Fprintf(&run, "# Run ./%s once done, whether the expected state was reached or not.\n", TeardownScript)
+	}
+	fmt.Fprintf(&run, "set -eu\ncd \"$(dirname \"$0\")\"\n\n")
+	applied, err := writeSetup(s, dir, &run)
+	if err != nil {
+		return err
+	}
+	if len(s.Setup.WaitFor) > 0 {
+		fmt.Fprintf(&run, "\n# Wait for the setup to be ready before the trigger.\nstart=$(date +%%s)\n")
+		writeHelpers(&run, s.Setup.WaitFor)
+		if err := writeExpect(&run, s, s.Setup.WaitFor, true); err != nil {
+			return err
+		}
+	}
+	triggers := s.Trigger.Triggers()
+	var clock time.Duration
+	for i, t := range triggers {
+		suffix := ""
+		if len(triggers) > 1 {
+			suffix = fmt.Sprintf("-%d", i)
+		}
+		if err := writeTrigger(t, dir, suffix, &clock, &run); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, RunScript), run.Bytes(), 0o755); err != nil {
+		return err
+	}
+
+	wait, err := waitScript(s)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, WaitScript), wait, 0o755); err != nil {
+		return err
+	}
+	if s.Teardown == nil {
+		return nil
+	}
+	teardown, err := teardownScript(s, dir, applied)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, TeardownScript), teardown, 0o755)
+}
+
+// teardownScript renders a script that applies the teardown patches, runs
+// its commands and deletes its objects, going on past failures as the
+// engine does. With deleteSetup, applied are the setup files run.sh
+// applies, in order, which are deleted in reverse.
+func teardownScript(s *scenario.Scenario, dir string, applied []string) ([]byte, error) {
+	t := s.Teardown
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "#!/bin/sh\n# Scenario %s: teardown.\nset -u\ncd \"$(dirname \"$0\")\"\n", s.Name)
+	for _, p := range t.Patches {
+		body, err := json.Marshal(map[string]any{"spec": p.Spec})
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "\n# Restore\nkubectl patch %s%s --type merge -p %s\n",
+			resourceArg(p.ResourceRef), namespaceArg(p.Namespace), shellQuote(string(body)))
+	}
+	for i := range t.Exec {
+		// In a subshell, since checking the exit code may exit.
+		fmt.Fprintln(&b, "\n# Command in a workload pod\n(")
+		writeExecCommand(&t.Exec[i], &b)
+		fmt.Fprintln(&b, ")")
+	}
+	var files []string
+	for i, m := range t.Manifests {
+		objs, err := readObjects(s.ManifestPath(m))
+		if err != nil {
+			return nil, err
+		}
+		name := fmt.Sprintf("teardown-%02d-%s", i+1, filepath.Base(m))
+		if err := writeObjects(filepath.Join(dir, "manifests", name), objs); err != nil {
+			return nil, err
+		}
+		files = append(files, name)
+	}
+	if t.DeleteSetup {
+		for _, m := range s.Setup.Manifests {
+			objs, err := readObjects(s.ManifestPath(m))
+			if err != nil {
+				return nil, err
+			}
+			if slices.ContainsFunc(objs, generatesName) {
+				fmt.Fprintf(&b, "\n# Not reproduced: deleting the objects of %s with generated names.\n", m)
+			}
+		}
+		for i := len(applied) - 1; i >= 0; i-- {
+			files = append(files, applied[i])
+		}
+	}
+	if len(files) > 0 {
+		fmt.Fprintln(&b, "\n# Delete")
+	}
+	for _, f := range files {
+		fmt.Fprintf(&b, "kubectl delete --ignore-not-found --wait -f manifests/%s\n", f)
+	}
+	return b.Bytes(), nil
+}
+
+// writeTrigger appends the commands firing a single trigger, after its
+// delay. Files the commands read are named with suffix, so the triggers of
+// a list do not overwrite each other's; clock is the fake clock offset,
+// which clock advances add to.
+func writeTrigger(t *scenario.Trigger, dir, suffix string, clock *time.Duration, run *bytes.Buffer) error {
+	if t.Delay != nil && t.Delay.Duration > 0 {
+		fmt.Fprintf(run, "\nsleep %s\n", strconv.FormatFloat(t.Delay.Seconds(), 'f', -1, 64))
+	}
+	if t.Patch != nil {
+		p := t.Patch
+		body, err := json.Marshal(map[string]any{"spec": p.Spec})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(run, "\n# Trigger\nkubectl patch %s%s --type merge -p %s\n",
+			resourceArg(p.ResourceRef), namespaceArg(p.Namespace), shellQuote(string(body)))
+	}
+	if t.Metadata != nil {
+		m := t.Metadata
+		body, err := json.Marshal(m.MetadataPatch())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(run, "\n# Trigger: metadata\nkubectl patch %s%s --type merge -p %s\n",
+			resourceArg(m.ResourceRef), namespaceArg(m.Namespace), shellQuote(string(body)))
+	}
+	if t.Scale != nil {
+		sc := t.Scale
+		fmt.Fprintf(run, "\n# Trigger: scale\nkubectl scale %s%s --replicas=%d\n",
+			resourceArg(sc.Ref()), namespaceArg(sc.Namespace), sc.Replicas)
+	}
+	if t.HTTP != nil {
+		if err := writeHTTPTrigger(t.HTTP, dir, "http-body"+suffix, run); err != nil {
+			return err
+		}
+	}
+	if t.Exec != nil {
+		writeExecTrigger(t.Exec, run)
+	}
+	if t.Event != nil {
+		if err := writeEventTrigger(t.Event, dir, "event"+suffix+".yaml", run); err != nil {
+			return err
+		}
+	}
+	if t.Drain != nil {
+		d := t.Drain
+		if d.CordonOnly {
+			fmt.Fprintf(run, "\n# Cordon (run kubectl uncordon %s when done)\nkubectl cordon %s\n", d.Node, d.Node)
+		} else {
+			fmt.Fprintf(run, "\n# Drain (run kubectl uncordon %s when done)\nkubectl drain %s --ignore-daemonsets --delete-emptydir-data\n", d.Node, d.Node)
+		}
+	}
+	if t.AdvanceClock != nil {
+		*clock += t.AdvanceClock.Duration
+		body := fmt.Sprintf(`{"data":{%q:%q}}`, fakeclock.OffsetKey, clock.String())
+		fmt.Fprintf(run, "\n# Advance the agents' fake clock (offset starts at 0s)\nkubectl patch configmap/%s -n %s --type merge -p %s\n",
+			fakeclock.DefaultName, agent.Namespace, shellQuote(body))
+	}
+	return nil
+}
+
+// writeHTTPTrigger appends the kubectl --raw call through the API server
+// proxy that an HTTP trigger makes.
+func writeHTTPTrigger(h *scenario.HTTPTrigger, dir, bodyFile string, run *bytes.Buffer) error {
+	fmt.Fprintln(run, "\n# Trigger: HTTP call through the API server proxy")
+	target := fmt.Sprintf("/api/v1/namespaces/%s/services/%s:%s:%s/proxy",
+		h.NamespaceOrDefault(), h.SchemeOrDefault(), h.Service, h.Port.String())
+	if h.Agent != "" {
+		fmt.Fprintf(run, "pod=$(kubectl get pods -n %s -l %s=%s -o jsonpath='{.items[0].metadata.name}')\n",
+			agent.Namespace, agent.LabelAgent, h.Agent)
+		target = fmt.Sprintf("/api/v1/namespaces/%s/pods/%s:${pod}:%s/proxy", agent.Namespace, h.SchemeOrDefault(), h.Port.String())
+	}
+	if len(h.Headers) > 0 {
+		fmt.Fprintln(run, "# Not reproduced: kubectl --raw cannot send the headers of the call.")
+	}
+	if h.ExpectStatus != 0 && h.ExpectStatus/100 != 2 {
+		fmt.Fprintf(run, "# Not checked: the call must answer %d; kubectl fails on it.\n", h.ExpectStatus)
+	}
+	raw := "\"" + target + h.Path + "\""
+	var body []byte
+	switch b := h.Body.(type) {
+	case nil:
+	case string:
+		body = []byte(b)
+	default:
+		var err error
+		if body, err = json.Marshal(b); err != nil {
+			return fmt.Errorf("trigger.http.body: %w", err)
+		}
+	}
+	if body != nil {
+		if err := os.WriteFile(filepath.Join(dir, bodyFile), body, 0o644); err != nil {
+			return err
+		}
+	}
+	switch method := h.MethodOrDefault(); {
+	case method == "GET":
+		fmt.Fprintf(run, "kubectl get --raw %s\n", raw)
+	case method == "DELETE":
+		fmt.Fprintf(run, "kubectl delete --raw %s\n", raw)
+	case method == "POST" || method == "PUT":
+		verb := map[string]string{"POST": "create", "PUT": "replace"}[method]
+		if body == nil {
+			if err := os.WriteFile(filepath.Join(dir, bodyFile), nil, 0o644); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(run, "kubectl %s --raw %s -f %s\n", verb, raw, bodyFile)
+	default:
+		fmt.Fprintf(run, "# Not reproduced: kubectl --raw cannot send %s requests.\n", method)
+	}
+	return nil
+}
+
+// writeExecTrigger appends the kubectl exec running the command of an exec
+// trigger.
+func writeExecTrigger(x *scenario.ExecTrigger, run *bytes.Buffer) {
+	fmt.Fprintln(run, "\n# Trigger: command in a workload pod")
+	writeExecCommand(x, run)
+}
+
+// writeExecCommand appends the kubectl exec running the command of x and
+// checking its exit code.
+func writeExecCommand(x *scenario.ExecTrigger, run *bytes.Buffer) {
+	pod := x.Pod
+	if pod == "" {
+		fmt.Fprintf(run, "pod=$(kubectl get pods -n %s -l %s --field-selector status.phase=Running -o jsonpath='{.items[0].metadata.name}')\n",
+			x.NamespaceOrDefault(), shellQuote(labels.SelectorFromSet(x.Selector).String()))
+		pod = "${pod}"
+	}
+	container := ""
+	if x.Container != "" {
+		container = " -c " + x.Container
+	}
+	args := make([]string, len(x.Command))
+	for i, a := range x.Command {
+		args[i] = shellQuote(a)
+	}
+	check := ""
+	switch {
+	case x.IgnoreExitCode:
+		check = " || true"
+	case x.ExpectExitCode != 0:
+		// kubectl exec exits with the command's exit code.
+		check = fmt.Sprintf(" && exit 1 || test $? -eq %d", x.ExpectExitCode)
+	}
+	fmt.Fprintf(run, "kubectl exec -n %s %s%s -- %s%s\n", x.NamespaceOrDefault(), pod, container, strings.Join(args, " "), check)
+}
+
+// writeEventTrigger writes the Event of an event trigger to file and
+// appends the command creating it. Unlike the engine's, the Event does not
+// carry the UID of the involved object.
+func writeEventTrigger(ev *scenario.EventTrigger, dir, file string, run *bytes.Buffer) error {
+	ref := ev.InvolvedObject
+	involved := map[string]any{"apiVersion": ref.APIVersion, "kind": ref.Kind, "name": ref.Name}
+	if ref.Namespace != "" {
+		involved["namespace"] = ref.Namespace
+	}
+	event := map[string]any{
+		"apiVersion":     "v1",
+		"kind":           "Event",
+		"metadata":       map[string]any{"generateName": ref.Name + ".", "namespace": ev.NamespaceOrDefault()},
+		"involvedObject": involved,
+		"reason":         ev.Reason,
+		"message":        ev.Message,
+		"type":           ev.TypeOrDefault(),
+		"source":         map[string]any{"component": "kube-agents-test"},
+	}
+	if err := writeObjects(filepath.Join(dir, file), []map[string]any{event}); err != nil {
+		return err
+	}
+	fmt.Fprintf(run, "\n# Trigger: Event\nkubectl create -f %s\n", file)
+	return nil
+}
+
+// writeSetup copies the setup manifests and the rendered generated resources
+// into dir/manifests and appends the commands applying them. As in the
+// engine, CustomResourceDefinitions are applied and established before
+// anything else. It returns the names of the files applied, in order.
+func writeSetup(s *scenario.Scenario, dir string, run *bytes.Buffer) ([]string, error) {
+	type file struct {
+		name string
+		objs []map[string]any
+	}
+	var crds []map[string]any
+	var files []file
+	var applied []string
+	for i, m := range s.Setup.Manifests {
+		objs, err := readObjects(s.ManifestPath(m))
+		if err != nil {
+			return nil, err
+		}
+		f := file{name: fmt.Sprintf("%02d-%s", i+1, filepath.Base(m))}
+		for _, obj := range objs {
+			if obj["kind"] == "CustomResourceDefinition" {
+				crds = append(crds, obj)
+				continue
+			}
+			f.objs = append(f.objs, obj)
+		}
+		if len(f.objs) > 0 {
+			files = append(files, f)
+		}
+	}
+	for i := range s.Setup.Generate {
+		objs, err := s.Setup.Generate[i].Objects()
+		if err != nil {
+			return nil, fmt.Errorf("setup.generate[%d]: %w", i, err)
+		}
+		files = append(files, file{name: fmt.Sprintf("%02d-generated-%d.yaml", len(s.Setup.Manifests)+i+1, i), objs: objs})
+	}
+
+	if len(crds) > 0 {
+		if err := writeObjects(filepath.Join(dir, "manifests", "00-crds.yaml"), crds); err != nil {
+			return nil, err
+		}
+		fmt.Fprintln(run, "kubectl apply -f manifests/00-crds.yaml")
+		applied = append(applied, "00-crds.yaml")
+		var names []string
+		for _, crd := range crds {
+			meta, _ := crd["metadata"].(map[string]any)
+			names = append(names, fmt.Sprintf("crd/%v", meta["name"]))
+		}
+		fmt.Fprintf(run, "kubectl wait --for condition=established --timeout=60s %s\n", strings.Join(names, " "))
+	}
+	if presets := s.PresetObjects(); len(presets) > 0 {
+		if err := writeObjects(filepath.Join(dir, "manifests", "00-presets.yaml"), presets); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(run, "kubectl create namespace %s --dry-run=client -o yaml | kubectl apply -f -\n", s.NamespaceOrDefault())
+		fmt.Fprintf(run, "kubectl apply%s -f manifests/00-presets.yaml\n", namespaceArg(s.Namespace))
+		applied = append(applied, "00-presets.yaml")
+	}
+	for _, f := range files {
+		if err := writeObjects(filepath.Join(dir, "manifests", f.name), f.objs); err != nil {
+			return nil, err
+		}
+		verb := "apply"
+		if slices.ContainsFunc(f.objs, generatesName) {
+			// kubectl apply needs a name to apply by.
+			verb = "create"
+		}
+		fmt.Fprintf(run, "kubectl %s -f manifests/%s\n", verb, f.name)
+		applied = append(applied, f.name)
+	}
+	return applied, nil
+}
+
+// generatesName reports whether obj leaves its name to the API server.
+func generatesName(obj map[string]any) bool {
+	meta, _ := obj["metadata"].(map[string]any)
+	return meta["name"] == nil && meta["generateName"] != nil
+}
+
+// waitScript renders a script that polls each condition with kubectl's
+// jsonpath output until all match.
+func waitScript(s *scenario.Scenario) ([]byte, error) {
+	var b bytes.Buffer
+	timeout := int(s.TimeoutOrDefault().Seconds())
+	perExpectation := slices.ContainsFunc(s.Expect, func(e scenario.Expectation) bool { return e.Timeout != nil })
+	if perExpectation {
+		timeout = 0
+		for _, exp := range s.Expect {
+			timeout = max(timeout, int(exp.TimeoutOr(s.TimeoutOrDefault()).Seconds()))
+		}
+	}
+	fmt.Fprintf(&b, `#!/bin/sh
+# Scenario %s: waits up to %ds for the expected state.
+set -u
+start=$(date +%%s)
+deadline=$(( start + %d ))
+
+`, s.Name, timeout, timeout)
+	writeHelpers(&b, s.Expect)
+	for _, t := range s.Trigger.Triggers() {
+		if t.Chaos != nil {
+			writeChaos(&b, t.Chaos)
+		}
+	}
+	if err := writeExpect(&b, s, s.Expect, perExpectation); err != nil {
+		return nil, err
+	}
+	for _, ev := range s.ExpectEvents {
+		fmt.Fprintf(&b, "# Not checked: %s.\n", ev.Label())
+	}
+	for _, d := range s.ExpectDenied {
+		fmt.Fprintf(&b, "# Not checked: %s.\n", d.Label())
+	}
+	for _, x := range s.ExpectEvictions {
+		fmt.Fprintf(&b, "# Not checked: %s.\n", x.Label())
+	}
+	for _, m := range s.ExpectMetrics {
+		fmt.Fprintf(&b, "# Not checked: %s on %s%s.\n", m.Expr, &m.Endpoint, m.PathOrDefault())
+	}
+	fmt.Fprintln(&b, "echo PASS")
+	return b.Bytes(), nil
+}
+
+// expectHelper and absentHelper are the shell functions the expectations
+// are checked with, polling until $deadline. They also work under set -e.
+const (
+	expectHelper = `# expect <resource> <namespace args> <jsonpath> <value>
+expect() {
+	while :; do
+		actual=$(kubectl get "$1" $2 -o jsonpath="{$3}" 2>/dev/null || true)
+		[ "$actual" = "$4" ] && return 0
+		if [ "$(date +%s)" -ge "$deadline" ]; then
+			echo "FAIL $1 $3: expected $4, got $actual" >&2
+			exit 1
+		fi
+		sleep 2
+	done
+}
+
+`
+	absentHelper = `# absent <resource> <namespace args>
+absent() {
+	while kubectl get "$1" $2 >/dev/null 2>&1; do
+		if [ "$(date +%s)" -ge "$deadline" ]; then
+			echo "FAIL $1: expected it not to exist" >&2
+			exit 1
+		fi
+		sleep 2
+	done
+}
+
+`
+)
+
+// writeHelpers writes the shell functions that expect needs.
+func writeHelpers(b *bytes.Buffer, expect []scenario.Expectation) {
+	b.WriteString(expectHelper)
+	if slices.ContainsFunc(expect, func(e scenario.Expectation) bool { return e.Absent }) {
+		b.WriteString(absentHelper)
+	}
+}
+
+// writeExpect writes the checks of expect, setting the deadline of each
+// from its own timeout if perExpectation.
+func writeExpect(b *bytes.Buffer, s *scenario.Scenario, expect []scenario.Expectation, perExpectation bool) error {
+	for _, exp := range expect {
+		if exp.Description != "" || exp.ID != "" {
+			fmt.Fprintf(b, "# %s\n", exp.Label())
+		}
+		if exp.Resource.LabelSelector != nil {
+			fmt.Fprintf(b, "# Not checked: %s, which is selected by label.\n", exp.Resource)
+			continue
+		}
+		if perExpectation {
+			fmt.Fprintf(b, "deadline=$(( start + %d ))\n", int(exp.TimeoutOr(s.TimeoutOrDefault()).Seconds()))
+		}
+		if exp.Absent {
+			fmt.Fprintf(b, "absent %s %s\n", shellQuote(resourceArg(exp.Resource)),
+				shellQuote(strings.TrimSpace(namespaceArg(exp.Resource.Namespace))))
+		}
+		for _, c := range exp.ExpandedConditions() {
+			if op := c.OperatorOrDefault(); op != scenario.OperatorEq {
+				fmt.Fprintf(b, "# Not checked: %s %s with operator %s.\n", exp.Resource, c.Path, op)
+				continue
+			}
+			if c.Description != "" || c.ID != "" {
+				fmt.Fprintf(b, "# %s\n", c.Label())
+			}
+			want, err := expectedArg(c)
+			if err != nil {
+				return fmt.Errorf("%s %s: %w", exp.Resource, c.Path, err)
+			}
+			fmt.Fprintf(b, "expect %s %s %s %s\n", shellQuote(resourceArg(exp.Resource)),
+				shellQuote(strings.TrimSpace(namespaceArg(exp.Resource.Namespace))), shellQuote(c.Path), want)
+		}
+		if exp.ObservedGeneration {
+			fmt.Fprintf(b, "expect %s %s .status.observedGeneration \"$(kubectl get %s%s -o jsonpath='{.metadata.generation}')\"\n",
+				shellQuote(resourceArg(exp.Resource)), shellQuote(strings.TrimSpace(namespaceArg(exp.Resource.Namespace))),
+				shellQuote(resourceArg(exp.Resource)), namespaceArg(exp.Resource.Namespace))
+		}
+		if d := exp.GenerationStableFor; d != nil {
+			fmt.Fprintf(b, "# Not checked: %s generation must stay unchanged for %s.\n", exp.Resource, d.Duration)
+		}
+		if d := exp.ConsistentlyFor; d != nil {
+			fmt.Fprintf(b, "# Not checked: %s must stay as expected for %s once it is.\n", exp.Resource, d.Duration)
+		}
+		var leaves []matchLeaf
+		var skipped []string
+		flattenMatches("", exp.Matches, &leaves, &skipped)
+		for _, path := range skipped {
+			fmt.Fprintf(b, "# Not checked: %s %s must contain the listed values.\n", exp.Resource, path)
+		}
+		for _, l := range leaves {
+			want, err := jsonpathValue(l.value)
+			if err != nil {
+				return fmt.Errorf("%s %s: %w", exp.Resource, l.path, err)
+			}
+			fmt.Fprintf(b, "expect %s %s %s %s\n", shellQuote(resourceArg(exp.Resource)),
+				shellQuote(strings.TrimSpace(namespaceArg(exp.Resource.Namespace))), shellQuote(l.path), shellQuote(want))
+		}
+	}
+	return nil
+}
+
+// matchLeaf is a scalar of an expectation's matches and its JSONPath.
+type matchLeaf struct {
+	path  string
+	value any
+}
+
+// flattenMatches collects the scalars of a partial object under path,
+// selecting list elements by merge key with JSONPath filters. Lists whose
+// elements have no merge key cannot be checked this way; their paths are
+// collected in skipped.
+func flattenMatches(path string, want any, leaves *[]matchLeaf, skipped *[]string) {
+	switch w := want.(type) {
+	case map[string]any:
+		for _, k := range slices.Sorted(maps.Keys(w)) {
+			flattenMatches(path+"."+k, w[k], leaves, skipped)
+		}
+	case []any:
+		key, ok := scenario.MergeKey(w)
+		if !ok {
+			*skipped = append(*skipped, path)
+			return
+		}
+		for _, e := range w {
+			id, _ := json.Marshal(e.(map[string]any)[key])
+			flattenMatches(fmt.Sprintf("%s[?(@.%s==%s)]", path, key, id), e, leaves, skipped)
+		}
+	default:
+		*leaves = append(*leaves, matchLeaf{path: path, value: w})
+	}
+}
+
+// expectedArg returns the shell word of the value a condition expects:
+// its literal, or the command or variable sourcing it.
+func expectedArg(c scenario.Condition) (string, error) {
+	switch {
+	case c.ValueFrom == nil:
+		want, err := jsonpathValue(c.Value)
+		return shellQuote(want), err
+	case c.ValueFrom.ResourceField != nil:
+		f := c.ValueFrom.ResourceField
+		return fmt.Sprintf(`"$(kubectl get %s%s -o jsonpath=%s)"`,
+			shellQuote(resourceArg(f.ResourceRef)), namespaceArg(f.Namespace), shellQuote("{"+f.Path+"}")), nil
+	}
+	return fmt.Sprintf(`"${%s}"`, c.ValueFrom.Env), nil
+}
+
+// writeChaos renders the chaos action as a background job of the wait
+// script.
+func writeChaos(b *bytes.Buffer, c *scenario.Chaos) {
+	delay := int(c.Delay().Seconds())
+	switch {
+	case c.KillAgentPod != "":
+		fmt.Fprintf(b, "# Chaos: kill a random pod of agent %s while waiting.\n", c.KillAgentPod)
+		fmt.Fprintf(b, "(sleep %d; kubectl delete -n %s $(kubectl get pods -n %s -l %s -o name | shuf -n 1)) &\n\n",
+			delay, agent.Namespace, agent.Namespace, shellQuote(agent.LabelAgent+"="+c.KillAgentPod))
+	case c.PartitionAgent != "":
+		name := c.PartitionAgent + "-partition"
+		fmt.Fprintf(b, "# Chaos: cut agent %s off the network for %s while waiting.\n", c.PartitionAgent, c.PartitionOrDefault())
+		fmt.Fprintf(b, `(sleep %d; kubectl apply -f - <<'EOF'
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata: {name: %s, namespace: %s}
+spec:
+  podSelector: {matchLabels: {%s: %s}}
+  policyTypes: [Ingress, Egress]
+EOF
+sleep %d; kubectl delete networkpolicy -n %s %s) &
+
+`, delay, name, agent.Namespace, agent.LabelAgent, c.PartitionAgent, int(c.PartitionOrDefault().Seconds()), agent.Namespace, name)
+	}
+}
+
+// jsonpathValue renders v the way kubectl's jsonpath output prints it:
+// strings raw, everything else as JSON.
+func jsonpathValue(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// resourceArg names ref in kubectl's kind.version.group/name form.
+func resourceArg(ref scenario.ResourceRef) string {
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	kind := strings.ToLower(ref.Kind)
+	if err != nil || gv.Group == "" {
+		return kind + "/" + ref.Name
+	}
+	return fmt.Sprintf("%s.%s.%s/%s", kind, gv.Version, gv.Group, ref.Name)
+}
+
+func namespaceArg(ns string) string {
+	if ns == "" {
+		return ""
+	}
+	return " -n " + ns
+}
+
+// shellQuote quotes s for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// readObjects reads the objects of a manifest file with their images
+// expanded, as the engine applies them.
+func readObjects(path string) ([]map[string]any, error) {
+	objs, err := scenario.ReadObjects(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objs {
+		if err := envsubst.ExpandImages(obj); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return objs, nil
+}
+
+func writeObjects(path string, objs []map[string]any) error {
+	var buf bytes.Buffer
+	for i, obj := range objs {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
@@ -0,0 +1,172 @@
+package export
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+const setupManifest = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: test
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: ${REGISTRY}/app:1
+`
+
+func TestKubectl(t *testing.T) {
+	t.Setenv("REGISTRY", "registry.example.com")
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "setup.yaml"), []byte(setupManifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	app := scenario.ResourceRef{APIVersion: "apps/v1", Kind: "Deployment", Name: "app", Namespace: "test"}
+	s := &scenario.Scenario{
+		Name:    "scale-up",
+		Dir:     src,
+		Timeout: &metav1.Duration{Duration: 90e9},
+		Setup:   scenario.Setup{Manifests: []string{"setup.yaml"}},
+		Trigger: &scenario.Trigger{Patch: &scenario.ResourcePatch{ResourceRef: app, Spec: map[string]any{"replicas": float64(3)}}},
+		Expect: []scenario.Expectation{
+			{
+				Resource: app,
+				Conditions: []scenario.Condition{
+					{Path: ".spec.replicas", Value: float64(3)},
+					{Path: ".status.readyReplicas", Value: float64(2), Operator: scenario.OperatorGte},
+				},
+				Matches: map[string]any{"metadata": map[string]any{"labels": map[string]any{"tier": "web"}}},
+			},
+			{
+				Resource: scenario.ResourceRef{APIVersion: "v1", Kind: "Pod", Namespace: "test",
+					LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "app"}}},
+			},
+		},
+		Teardown: &scenario.Teardown{DeleteSetup: true},
+	}
+	dir := t.TempDir()
+	if err := Kubectl(s, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	run, wait, teardown := read(RunScript), read(WaitScript), read(TeardownScript)
+	assertInOrder(t, RunScript, run,
+		"kubectl apply -f manifests/00-crds.yaml",
+		"kubectl wait --for condition=established --timeout=60s crd/widgets.example.com",
+		"kubectl apply -f manifests/01-setup.yaml",
+		`kubectl patch deployment.v1.apps/app -n test --type merge -p '{"spec":{"replicas":3}}'`,
+	)
+	assertInOrder(t, WaitScript, wait,
+		"# Scenario scale-up: waits up to 90s for the expected state.",
+		"expect 'deployment.v1.apps/app' '-n test' '.spec.replicas' '3'",
+		"# Not checked: Deployment/test/app .status.readyReplicas with operator gte.",
+		"expect 'deployment.v1.apps/app' '-n test' '.metadata.labels.tier' 'web'",
+		"# Not checked: Pod/test matching app=app, which is selected by label.",
+		"echo PASS",
+	)
+	assertInOrder(t, TeardownScript, teardown,
+		"kubectl delete --ignore-not-found --wait -f manifests/01-setup.yaml",
+		"kubectl delete --ignore-not-found --wait -f manifests/00-crds.yaml",
+	)
+	if setup := read("manifests/01-setup.yaml"); !strings.Contains(setup, "image: registry.example.com/app:1") {
+		t.Errorf("setup manifest images are not expanded:\n%s", setup)
+	}
+	if crds := read("manifests/00-crds.yaml"); strings.Contains(crds, "Deployment") {
+		t.Errorf("CRD manifest holds other objects:\n%s", crds)
+	}
+
+	if _, err := exec.LookPath("sh"); err != nil {
+		return
+	}
+	for _, script := range []string{RunScript, WaitScript, TeardownScript} {
+		if out, err := exec.Command("sh", "-n", filepath.Join(dir, script)).CombinedOutput(); err != nil {
+			t.Errorf("%s is not valid shell: %v\n%s", script, err, out)
+		}
+	}
+}
+
+// assertInOrder fails unless script holds each of lines, in order.
+func assertInOrder(t *testing.T, name, script string, lines ...string) {
+	t.Helper()
+	rest := script
+	for _, l := range lines {
+		i := strings.Index(rest, l)
+		if i < 0 {
+			t.Errorf("%s lacks %q after the lines before it:\n%s", name, l, script)
+			return
+		}
+		rest = rest[i+len(l):]
+	}
+}
+
+func TestFlattenMatches(t *testing.T) {
+	var leaves []matchLeaf
+	var skipped []string
+	flattenMatches("", map[string]any{
+		"spec": map[string]any{
+			"replicas": float64(2),
+			"containers": []any{
+				map[string]any{"name": "app", "image": "app:1"},
+			},
+			"args": []any{"--verbose"},
+		},
+	}, &leaves, &skipped)
+	want := []matchLeaf{
+		{path: `.spec.containers[?(@.name=="app")].image`, value: "app:1"},
+		{path: `.spec.containers[?(@.name=="app")].name`, value: "app"},
+		{path: ".spec.replicas", value: float64(2)},
+	}
+	if !reflect.DeepEqual(leaves, want) {
+		t.Errorf("leaves = %+v, want %+v", leaves, want)
+	}
+	if want := []string{".spec.args"}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("skipped = %v, want %v", skipped, want)
+	}
+}
+
+func TestShellWords(t *testing.T) {
+	tests := []struct {
+		got, want string
+	}{
+		{shellQuote("plain"), "'plain'"},
+		{shellQuote("it's"), `'it'\''s'`},
+		{resourceArg(scenario.ResourceRef{APIVersion: "v1", Kind: "ConfigMap", Name: "a"}), "configmap/a"},
+		{resourceArg(scenario.ResourceRef{APIVersion: "apps/v1", Kind: "Deployment", Name: "a"}), "deployment.v1.apps/a"},
+		{namespaceArg(""), ""},
+		{namespaceArg("test"), " -n test"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("got %q, want %q", tt.got, tt.want)
+		}
+	}
+	for v, want := range map[any]string{nil: "", "x": "x", float64(3): "3", true: "true"} {
+		if got, err := jsonpathValue(v); err != nil || got != want {
+			t.Errorf("jsonpathValue(%v) = %q, %v, want %q", v, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Package fakeclock is the contract that lets scenarios fast-forward time
+// inside agents, so TTLs and cooldown windows can be tested without sleeping
+// for real.
+//
+// The framework keeps a clock offset in a ConfigMap and tells deployed
+// agents where it is through the EnvVar environment variable, formatted as
+// <namespace>/<name>. A trigger with advanceClock adds to the offset. Agents
+// that support fake time read their clock through Clock, which follows the
+// ConfigMap; their service account needs get access to it.
+package fakeclock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// EnvVar carries the <namespace>/<name> of the clock ConfigMap.
+	EnvVar = "KUBE_AGENTS_TEST_FAKE_CLOCK"
+	// OffsetKey is the ConfigMap data key holding the offset as a Go
+	// duration string, e.g. "1h30m".
+	OffsetKey = "offset"
+	// DefaultName is the name of the clock ConfigMap the engine manages.
+	DefaultName = "kube-agents-test-clock"
+
+	pollInterval = time.Second
+)
+
+// Clock is an agent's view of the fake clock: real time shifted by the
+// offset last read from the ConfigMap.
+type Clock struct {
+	mu     sync.RWMutex
+	offset time.Duration
+}
+
+// Now returns the fake current time.
+func (c *Clock) Now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return time.Now().Add(c.offset)
+}
+
+// Since returns the fake time elapsed since t.
+func (c *Clock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// FromEnv returns a Clock following the ConfigMap named by EnvVar, polling
+// it until ctx is done. Without EnvVar the clock is the real one.
+func FromEnv(ctx context.Context, client kubernetes.Interface) (*Clock, error) {
+	c := &Clock{}
+	ref := os.Getenv(EnvVar)
+	if ref == "" {
+		return c, nil
+	}
+	namespace, name, ok := strings.Cut(ref, "/")
+	if !ok {
+		return nil, fmt.Errorf("%s=%q: want <namespace>/<name>", EnvVar, ref)
+	}
+	if err := c.sync(ctx, client, namespace, name); err != nil {
+		return nil, err
+	}
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// Keep the last offset on transient errors.
+				_ = c.sync(ctx, client, namespace, name)
+			}
+		}
+	}()
+	return c, nil
+}
+
+func (c *Clock) sync(ctx context.Context, client kubernetes.Interface, namespace, name string) error {
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("reading fake clock %s/%s: %w", namespace, name, err)
+	}
+	offset, err := ParseOffset(cm.Data[OffsetKey])
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.offset = offset
+	c.mu.Unlock()
+	return nil
+}
+
+// ParseOffset parses an offset value; empty means no offset.
+func ParseOffset(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("fake clock offset %q: %w", s, err)
+	}
+	return d, nil
+}
@@ -0,0 +1,273 @@
+// Package fingerprint captures the environment a run executed in: the
+// cluster and its nodes, the framework build, the revisions of the scenario
+// files and the host. Results carry it so runs on different environments
+// can be compared, and a regression bisected to what changed between them.
+package fingerprint
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Fingerprint describes the environment of a run.
+type Fingerprint struct {
+	Cluster   Cluster    `json:"cluster"`
+	Nodes     []NodeInfo `json:"nodes,omitempty"`
+	Framework Framework  `json:"framework"`
+	Scenarios []Source   `json:"scenarios,omitempty"`
+	Host      Host       `json:"host"`
+}
+
+// Cluster is the API server's version and the cluster's provider.
+type Cluster struct {
+	Version  string `json:"version,omitempty"`
+	Platform string `json:"platform,omitempty"`
+	// Provider is the scheme of the nodes' provider IDs, such as kind, aws
+	// or gce, or guessed from the version, such as eks or k3s.
+	Provider string `json:"provider,omitempty"`
+}
+
+// NodeInfo is what a group of nodes run. Nodes running the same are
+// counted together.
+type NodeInfo struct {
+	Count            int    `json:"count"`
+	OSImage          string `json:"osImage"`
+	KernelVersion    string `json:"kernelVersion,omitempty"`
+	KubeletVersion   string `json:"kubeletVersion"`
+	ContainerRuntime string `json:"containerRuntime,omitempty"`
+	Architecture     string `json:"architecture,omitempty"`
+}
+
+// Framework is the kube-agents-test build.
+type Framework struct {
+	Version   string `json:"version,omitempty"`
+	Revision  string `json:"revision,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Source is the git revision of a repository scenario files were loaded
+// from.
+type Source struct {
+	Repository string `json:"repository"`
+	Revision   string `json:"revision"`
+	// Dirty reports uncommitted changes in the repository.
+	Dirty bool `json:"dirty,omitempty"`
+}
+
+// Host is the machine the framework ran on.
+type Host struct {
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+	// Release is the PRETTY_NAME of /etc/os-release, where there is one.
+	Release string `json:"release,omitempty"`
+}
+
+// Capture returns the fingerprint of a run against the cluster of client
+// of scenario files loaded from dirs. Scenario directories outside a git
+// repository, or without git installed, have no Source. What could not be
+// captured is left out and reported in the error, so the fingerprint
+// returned is never nil.
+func Capture(ctx context.Context, client kubernetes.Interface, dirs []string) (*Fingerprint, error) {
+	f := &Fingerprint{
+		Framework: framework(),
+		Host:      host(),
+	}
+	var errs []error
+	if v, err := client.Discovery().ServerVersion(); err != nil {
+		errs = append(errs, fmt.Errorf("cluster version: %w", err))
+	} else {
+		f.Cluster.Version = v.GitVersion
+		f.Cluster.Platform = v.Platform
+	}
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		errs = append(errs, fmt.Errorf("nodes: %w", err))
+	} else {
+		f.Nodes = nodeInfos(nodes.Items)
+		f.Cluster.Provider = provider(nodes.Items, f.Cluster.Version)
+	}
+	for _, dir := range dirs {
+		src, ok, err := source(ctx, dir)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("revision of %s: %w", dir, err))
+		case ok && !slices.Contains(f.Scenarios, src):
+			f.Scenarios = append(f.Scenarios, src)
+		}
+	}
+	return f, errors.Join(errs...)
+}
+
+// For returns Capture bound to client, as runner.WithFingerprint takes it.
+func For(client kubernetes.Interface) func(ctx context.Context, dirs []string) (*Fingerprint, error) {
+	return func(ctx context.Context, dirs []string) (*Fingerprint, error) {
+		return Capture(ctx, client, dirs)
+	}
+}
+
+// Properties flattens f into name-value pairs, for formats that only take
+// those, such as JUnit properties.
+func (f *Fingerprint) Properties() map[string]string {
+	props := map[string]string{
+		"cluster.version":   f.Cluster.Version,
+		"cluster.provider":  f.Cluster.Provider,
+		"framework.version": f.Framework.Version,
+		"framework.go":      f.Framework.GoVersion,
+		"host.os":           f.Host.OS + "/" + f.Host.Arch,
+		"host.release":      f.Host.Release,
+	}
+	if rev := f.Framework.Revision; rev != "" {
+		if f.Framework.Modified {
+			rev += "-dirty"
+		}
+		props["framework.revision"] = rev
+	}
+	for i, n := range f.Nodes {
+		props[fmt.Sprintf("nodes.%d", i)] = n.String()
+	}
+	for _, src := range f.Scenarios {
+		rev := src.Revision
+		if src.Dirty {
+			rev += "-dirty"
+		}
+		props["scenarios."+src.Repository] = rev
+	}
+	for k, v := range props {
+		if v == "" {
+			delete(props, k)
+		}
+	}
+	return props
+}
+
+// String describes the nodes of n, such as "3x Ubuntu 22.04.4 LTS,
+// kubelet v1.31.0, containerd://1.7.18, amd64".
+func (n NodeInfo) String() string {
+	parts := []string{strconv.Itoa(n.Count) + "x " + n.OSImage, "kubelet " + n.KubeletVersion}
+	for _, p := range []string{n.ContainerRuntime, n.Architecture} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// nodeInfos groups nodes by what they run, in order of first appearance.
+func nodeInfos(nodes []corev1.Node) []NodeInfo {
+	var infos []NodeInfo
+	for _, node := range nodes {
+		ni := node.Status.NodeInfo
+		info := NodeInfo{
+			OSImage:          ni.OSImage,
+			KernelVersion:    ni.KernelVersion,
+			KubeletVersion:   ni.KubeletVersion,
+			ContainerRuntime: ni.ContainerRuntimeVersion,
+			Architecture:     ni.Architecture,
+		}
+		i := slices.IndexFunc(infos, func(in NodeInfo) bool {
+			in.Count = 0
+			return in == info
+		})
+		if i < 0 {
+			infos = append(infos, info)
+			i = len(infos) - 1
+		}
+		infos[i].Count++
+	}
+	return infos
+}
+
+// provider returns the scheme of the nodes' provider IDs, or else what
+// the version suffix of managed and packaged distributions names.
+func provider(nodes []corev1.Node, version string) string {
+	for _, node := range nodes {
+		if scheme, _, ok := strings.Cut(node.Spec.ProviderID, "://"); ok && scheme != "" {
+			return scheme
+		}
+	}
+	for _, p := range []string{"eks", "gke", "aks", "k3s", "rke2"} {
+		if strings.Contains(version, "-"+p) || strings.Contains(version, "+"+p) {
+			return p
+		}
+	}
+	return ""
+}
+
+// framework returns what the binary's build info says about its build.
+func framework() Framework {
+	fw := Framework{GoVersion: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return fw
+	}
+	fw.Version = info.Main.Version
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			fw.Revision = s.Value
+		case "vcs.modified":
+			fw.Modified = s.Value == "true"
+		}
+	}
+	return fw
+}
+
+// host describes the machine the framework runs on.
+func host() Host {
+	h := Host{OS: runtime.GOOS, Arch: runtime.GOARCH}
+	data, err := os.ReadFile("/etc/os-release")
+	if err != nil {
+		return h
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), "PRETTY_NAME="); ok {
+			if uq, err := strconv.Unquote(v); err == nil {
+				v = uq
+			}
+			h.Release = v
+		}
+	}
+	return h
+}
+
+// source returns the git revision of the repository dir is in, and false
+// if dir is in none or git is not installed.
+func source(ctx context.Context, dir string) (Source, bool, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return Source{}, false, nil
+	}
+	git := func(args ...string) (string, error) {
+		out, err := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...).Output()
+		return strings.TrimSpace(string(out)), err
+	}
+	root, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		// Not a repository.
+		return Source{}, false, nil
+	}
+	rev, err := git("rev-parse", "HEAD")
+	if err != nil {
+		return Source{}, false, err
+	}
+	status, err := git("status", "--porcelain")
+	if err != nil {
+		return Source{}, false, err
+	}
+	return Source{Repository: root, Revision: rev, Dirty: status != ""}, true, nil
+}
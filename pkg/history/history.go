@@ -0,0 +1,205 @@
+// Package history keeps a local, append-only record of scenario results so
+// pass rates and duration trends can be queried across runs.
+//
+// Records are stored as JSON lines: one Record per line, appended after every
+// run. The format is deliberately simple so the file can be inspected with
+// jq, shipped as a CI artifact, or merged by concatenation.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPath is where the store lives when no path is configured.
+const DefaultPath = ".kube-agents-test/history.jsonl"
+
+// Record is the outcome of one scenario in one run.
+type Record struct {
+	RunID         string            `json:"runId"`
+	Scenario      string            `json:"scenario"`
+	AgentVersions map[string]string `json:"agentVersions,omitempty"`
+	// Dimensions labels the combination the scenario ran in; see
+	// engine.Result.Dimensions.
+	Dimensions map[string]string `json:"dimensions,omitempty"`
+	Passed     bool              `json:"passed"`
+	Duration   time.Duration     `json:"duration"`
+	StartedAt  time.Time         `json:"startedAt"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// Key identifies the scenario and agent versions a record was produced with.
+// Records sharing a key are comparable: a change in pass rate between keys
+// points at an agent change, a change within a key points at flakiness.
+func (r Record) Key() string {
+	return Key(r.Scenario, r.AgentVersions)
+}
+
+// Key builds the canonical key for a scenario run against the given agent
+// versions, e.g. "scale-up@quota-agent=v1,scaling-agent=v2".
+func Key(scenario string, agentVersions map[string]string) string {
+	if len(agentVersions) == 0 {
+		return scenario
+	}
+	names := make([]string, 0, len(agentVersions))
+	for name := range agentVersions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + "=" + agentVersions[name]
+	}
+	return scenario + "@" + strings.Join(parts, ",")
+}
+
+// Filter selects records. Zero-valued fields match everything.
+type Filter struct {
+	// Scenario matches records by scenario name.
+	Scenario string
+	// AgentVersions matches records whose agent versions include every
+	// listed name=version pair.
+	AgentVersions map[string]string
+	// Since drops records started before this time.
+	Since time.Time
+	// Passed matches only passing records.
+	Passed bool
+	// Last keeps only the most recent N matching records.
+	Last int
+}
+
+func (f Filter) matches(r Record) bool {
+	if f.Scenario != "" && r.Scenario != f.Scenario {
+		return false
+	}
+	for name, version := range f.AgentVersions {
+		if r.AgentVersions[name] != version {
+			return false
+		}
+	}
+	if !f.Since.IsZero() && r.StartedAt.Before(f.Since) {
+		return false
+	}
+	if f.Passed && !r.Passed {
+		return false
+	}
+	return true
+}
+
+// Store is a JSON lines file of Records. It is safe for concurrent use within
+// one process.
+type Store struct {
+	path string
+	mu   sync.Mutex
+}
+
+// Open returns a Store backed by the file at path, creating parent
+// directories as needed. The file itself is created on first Append.
+func Open(path string) (*Store, error) {
+	if path == "" {
+		path = DefaultPath
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("creating history directory: %w", err)
+	}
+	return &Store{path: path}, nil
+}
+
+// Path returns the file backing the store.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Append writes records to the end of the store.
+func (s *Store) Append(records ...Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening history: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			f.Close()
+			return fmt.Errorf("encoding record for %s: %w", r.Scenario, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("writing history: %w", err)
+	}
+	return f.Close()
+}
+
+// Records returns matching records ordered by start time, oldest first.
+// A missing store yields no records.
+func (s *Store) Records(f Filter) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening history: %w", err)
+	}
+	defer file.Close()
+
+	var out []Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", s.path, line, err)
+		}
+		if f.matches(r) {
+			out = append(out, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading history: %w", err)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].StartedAt.Before(out[j].StartedAt)
+	})
+	if f.Last > 0 && len(out) > f.Last {
+		out = out[len(out)-f.Last:]
+	}
+	return out, nil
+}
+
+// Scenarios returns the distinct scenario names in the store, sorted.
+func (s *Store) Scenarios() ([]string, error) {
+	records, err := s.Records(Filter{})
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var names []string
+	for _, r := range records {
+		if !seen[r.Scenario] {
+			seen[r.Scenario] = true
+			names = append(names, r.Scenario)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
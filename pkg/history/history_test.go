@@ -0,0 +1,282 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		scenario string
+		versions map[string]string
+		want     string
+	}{
+		{scenario: "scale-up", want: "scale-up"},
+		{scenario: "scale-up", versions: map[string]string{}, want: "scale-up"},
+		{scenario: "scale-up", versions: map[string]string{"scaling-agent": "v2", "quota-agent": "v1"}, want: "scale-up@quota-agent=v1,scaling-agent=v2"},
+	}
+	for _, tt := range tests {
+		if got := Key(tt.scenario, tt.versions); got != tt.want {
+			t.Errorf("Key(%q, %v) = %q, want %q", tt.scenario, tt.versions, got, tt.want)
+		}
+		if got := (Record{Scenario: tt.scenario, AgentVersions: tt.versions}).Key(); got != tt.want {
+			t.Errorf("Record.Key() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	r := Record{
+		Scenario:      "scale-up",
+		AgentVersions: map[string]string{"quota-agent": "v1", "scaling-agent": "v2"},
+		StartedAt:     t0,
+	}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{name: "zero filter", want: true},
+		{name: "scenario", filter: Filter{Scenario: "scale-up"}, want: true},
+		{name: "other scenario", filter: Filter{Scenario: "scale-down"}},
+		{name: "subset of agent versions", filter: Filter{AgentVersions: map[string]string{"quota-agent": "v1"}}, want: true},
+		{name: "other agent version", filter: Filter{AgentVersions: map[string]string{"quota-agent": "v2"}}},
+		{name: "agent not in the record", filter: Filter{AgentVersions: map[string]string{"other-agent": "v1"}}},
+		{name: "since the start", filter: Filter{Since: t0}, want: true},
+		{name: "since after the start", filter: Filter{Since: t0.Add(time.Second)}},
+		{name: "passed of a failed record", filter: Filter{Passed: true}},
+		{name: "last is applied by Records", filter: Filter{Last: 1}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.matches(r); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testStore returns a store holding records of scenario "a", alternately
+// passing and failing and one minute apart, appended out of order, and one
+// of scenario "b".
+func testStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "nested", "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []Record
+	for _, i := range []int{3, 0, 2, 1} {
+		records = append(records, Record{
+			RunID:     string(rune('0' + i)),
+			Scenario:  "a",
+			Passed:    i%2 == 0,
+			Duration:  time.Duration(i+1) * time.Second,
+			StartedAt: t0.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	if err := s.Append(records...); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append(Record{RunID: "9", Scenario: "b", Passed: true, StartedAt: t0}); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func runIDs(records []Record) string {
+	var ids []string
+	for _, r := range records {
+		ids = append(ids, r.RunID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestStoreRecords(t *testing.T) {
+	s := testStore(t)
+	tests := []struct {
+		name   string
+		filter Filter
+		want   string
+	}{
+		{name: "all, oldest first", want: "0,9,1,2,3"},
+		{name: "scenario", filter: Filter{Scenario: "a"}, want: "0,1,2,3"},
+		{name: "last", filter: Filter{Scenario: "a", Last: 2}, want: "2,3"},
+		{name: "last beyond the records", filter: Filter{Scenario: "a", Last: 10}, want: "0,1,2,3"},
+		{name: "since", filter: Filter{Since: t0.Add(90 * time.Second)}, want: "2,3"},
+		{name: "last passed", filter: Filter{Scenario: "a", Passed: true, Last: 2}, want: "0,2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Records(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := runIDs(got); ids != tt.want {
+				t.Errorf("Records() = %s, want %s", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Records(Filter{}); err != nil || got != nil {
+		t.Fatalf("Records() of a missing store = %v, %v, want nothing", got, err)
+	}
+	want := Record{
+		RunID:         "run-1",
+		Scenario:      "scale-up",
+		AgentVersions: map[string]string{"quota-agent": "v1"},
+		Dimensions:    map[string]string{"k8s": "1.29"},
+		Passed:        false,
+		Duration:      1500 * time.Millisecond,
+		StartedAt:     t0,
+		Error:         "timed out",
+	}
+	if err := s.Append(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Records(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+		t.Errorf("Records() = %+v, want %+v", got, want)
+	}
+
+	// Blank lines, as left by concatenating stores, are skipped; corrupt
+	// ones are reported with their line.
+	f, err := os.OpenFile(s.Path(), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("\n  \n{not json\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if _, err := s.Records(Filter{}); err == nil || !strings.Contains(err.Error(), "history.jsonl:4:") {
+		t.Errorf("Records() of a corrupt store: error = %v, want one on line 4", err)
+	}
+}
+
+func TestStoreScenarios(t *testing.T) {
+	got, err := testStore(t).Scenarios()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Scenarios() = %v, want %v", got, want)
+	}
+}
+
+func TestPassRate(t *testing.T) {
+	tests := []struct {
+		rate  PassRate
+		want  float64
+		flaky bool
+	}{
+		{rate: PassRate{}, want: 0},
+		{rate: PassRate{Runs: 4, Passed: 4}, want: 1},
+		{rate: PassRate{Runs: 4, Passed: 0}, want: 0},
+		{rate: PassRate{Runs: 4, Passed: 1}, want: 0.25, flaky: true},
+	}
+	for _, tt := range tests {
+		if got := tt.rate.Rate(); got != tt.want {
+			t.Errorf("%+v.Rate() = %v, want %v", tt.rate, got, tt.want)
+		}
+		if got := tt.rate.Flaky(); got != tt.flaky {
+			t.Errorf("%+v.Flaky() = %v, want %v", tt.rate, got, tt.flaky)
+		}
+	}
+
+	s := testStore(t)
+	got, err := s.PassRate(Filter{Scenario: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (PassRate{Runs: 4, Passed: 2}); got != want {
+		t.Errorf("PassRate() = %+v, want %+v", got, want)
+	}
+	if err := s.Append(Record{Scenario: "a", AgentVersions: map[string]string{"x": "v2"}, Passed: true, StartedAt: t0}); err != nil {
+		t.Fatal(err)
+	}
+	rates, err := s.PassRates(Filter{Scenario: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]PassRate{"a": {Runs: 4, Passed: 2}, "a@x=v2": {Runs: 1, Passed: 1}}
+	if !reflect.DeepEqual(rates, want) {
+		t.Errorf("PassRates() = %+v, want %+v", rates, want)
+	}
+}
+
+func TestDurationStats(t *testing.T) {
+	secs := func(ds ...int) []time.Duration {
+		var out []time.Duration
+		for _, d := range ds {
+			out = append(out, time.Duration(d)*time.Second)
+		}
+		return out
+	}
+	tests := []struct {
+		name      string
+		durations []time.Duration
+		want      DurationStats
+	}{
+		{name: "none", want: DurationStats{}},
+		{name: "one", durations: secs(7), want: DurationStats{Count: 1, Mean: 7 * time.Second, P50: 7 * time.Second, P90: 7 * time.Second, Max: 7 * time.Second}},
+		{
+			name:      "unsorted",
+			durations: secs(10, 1, 9, 2, 8, 3, 7, 4, 6, 5),
+			want:      DurationStats{Count: 10, Mean: 5500 * time.Millisecond, P50: 5 * time.Second, P90: 9 * time.Second, Max: 10 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := durationStats(tt.durations); got != tt.want {
+				t.Errorf("durationStats() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// Only passing runs count: runs 0 and 2, of 1s and 3s.
+	got, err := testStore(t).Durations(Filter{Scenario: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (DurationStats{Count: 2, Mean: 2 * time.Second, P50: time.Second, P90: 3 * time.Second, Max: 3 * time.Second}); got != want {
+		t.Errorf("Durations() = %+v, want %+v", got, want)
+	}
+	// Last counts passing runs, so the failing run 3 does not crowd out run 0.
+	got, err = testStore(t).Durations(Filter{Scenario: "a", Last: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Count != 2 {
+		t.Errorf("Durations() of the last 2 runs counted %d, want the 2 last passing runs", got.Count)
+	}
+}
+
+func TestTrend(t *testing.T) {
+	got, err := testStore(t).Trend(Filter{Scenario: "a", Last: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TrendPoint{
+		{RunID: "2", StartedAt: t0.Add(2 * time.Minute), Duration: 3 * time.Second, Passed: true},
+		{RunID: "3", StartedAt: t0.Add(3 * time.Minute), Duration: 4 * time.Second, Passed: false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Trend() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,143 @@
+package history
+
+import (
+	"sort"
+	"time"
+)
+
+// PassRate summarizes how often a set of records passed.
+type PassRate struct {
+	Runs   int
+	Passed int
+}
+
+// Rate returns the fraction of passing runs, or 0 when there are none.
+func (p PassRate) Rate() float64 {
+	if p.Runs == 0 {
+		return 0
+	}
+	return float64(p.Passed) / float64(p.Runs)
+}
+
+// Flaky reports whether the records both passed and failed at least once.
+func (p PassRate) Flaky() bool {
+	return p.Passed > 0 && p.Passed < p.Runs
+}
+
+// DurationStats summarizes scenario durations.
+type DurationStats struct {
+	Count int
+	Mean  time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	Max   time.Duration
+}
+
+// TrendPoint is one run of a scenario, in chronological order.
+type TrendPoint struct {
+	RunID     string
+	StartedAt time.Time
+	Duration  time.Duration
+	Passed    bool
+}
+
+// PassRate computes the pass rate of matching records.
+func (s *Store) PassRate(f Filter) (PassRate, error) {
+	records, err := s.Records(f)
+	if err != nil {
+		return PassRate{}, err
+	}
+	return passRate(records), nil
+}
+
+// PassRates computes the pass rate per record Key, so the same scenario can be
+// compared across agent versions.
+func (s *Store) PassRates(f Filter) (map[string]PassRate, error) {
+	records, err := s.Records(f)
+	if err != nil {
+		return nil, err
+	}
+	byKey := map[string][]Record{}
+	for _, r := range records {
+		byKey[r.Key()] = append(byKey[r.Key()], r)
+	}
+	out := make(map[string]PassRate, len(byKey))
+	for key, rs := range byKey {
+		out[key] = passRate(rs)
+	}
+	return out, nil
+}
+
+// Durations computes duration statistics of matching records. Only passing
+// runs are counted, f.Last included: a failed run's duration is usually
+// just its timeout.
+func (s *Store) Durations(f Filter) (DurationStats, error) {
+	f.Passed = true
+	records, err := s.Records(f)
+	if err != nil {
+		return DurationStats{}, err
+	}
+	durations := make([]time.Duration, len(records))
+	for i, r := range records {
+		durations[i] = r.Duration
+	}
+	return durationStats(durations), nil
+}
+
+// Trend returns matching records as chronological points, suitable for
+// plotting duration or pass/fail over time.
+func (s *Store) Trend(f Filter) ([]TrendPoint, error) {
+	records, err := s.Records(f)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]TrendPoint, len(records))
+	for i, r := range records {
+		points[i] = TrendPoint{
+			RunID:     r.RunID,
+			StartedAt: r.StartedAt,
+			Duration:  r.Duration,
+			Passed:    r.Passed,
+		}
+	}
+	return points, nil
+}
+
+func passRate(records []Record) PassRate {
+	p := PassRate{Runs: len(records)}
+	for _, r := range records {
+		if r.Passed {
+			p.Passed++
+		}
+	}
+	return p
+}
+
+func durationStats(durations []time.Duration) DurationStats {
+	if len(durations) == 0 {
+		return DurationStats{}
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	return DurationStats{
+		Count: len(sorted),
+		Mean:  total / time.Duration(len(sorted)),
+		P50:   percentile(sorted, 50),
+		P90:   percentile(sorted, 90),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+// percentile uses the nearest-rank method over an ascending slice.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,65 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/streaming/pkg/httpstream"
+)
+
+// ExecOptions selects the container and command of Exec.
+type ExecOptions struct {
+	Namespace string
+	Pod       string
+	// Container defaults to the pod's only or default container.
+	Container string
+	Command   []string
+	// Stdin is streamed to the command when set.
+	Stdin io.Reader
+}
+
+// Exec runs a command in a pod, like kubectl exec, and returns what it
+// wrote to stdout and stderr. It speaks WebSockets and falls back to SPDY
+// for API servers that do not support them. A command that exits non-zero
+// returns a k8s.io/client-go/util/exec.ExitError.
+func (c *Clients) Exec(ctx context.Context, o ExecOptions) (stdout, stderr []byte, err error) {
+	req := c.Kubernetes.CoreV1().RESTClient().Post().
+		Namespace(o.Namespace).
+		Resource("pods").
+		Name(o.Pod).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: o.Container,
+			Command:   o.Command,
+			Stdin:     o.Stdin != nil,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	ws, err := remotecommand.NewWebSocketExecutor(c.Config, "GET", req.URL().String())
+	if err != nil {
+		return nil, nil, fmt.Errorf("exec in %s/%s: %w", o.Namespace, o.Pod, err)
+	}
+	spdy, err := remotecommand.NewSPDYExecutor(c.Config, "POST", req.URL())
+	if err != nil {
+		return nil, nil, fmt.Errorf("exec in %s/%s: %w", o.Namespace, o.Pod, err)
+	}
+	exec, err := remotecommand.NewFallbackExecutor(ws, spdy, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("exec in %s/%s: %w", o.Namespace, o.Pod, err)
+	}
+	var out, errOut bytes.Buffer
+	err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  o.Stdin,
+		Stdout: &out,
+		Stderr: &errOut,
+	})
+	return out.Bytes(), errOut.Bytes(), err
+}
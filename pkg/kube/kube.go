@@ -0,0 +1,137 @@
+// Package kube builds the Kubernetes clients used across the framework. All
+// clients for one cluster share a single rest.Config, HTTP transport, and
+// rate limiter, so TLS connections are reused and QPS limits apply to the
+// process as a whole rather than per client.
+package kube
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/cluster"
+)
+
+// Default client-side rate limits, applied when the config sets none. The
+// client-go defaults (5 QPS) are too low for suites that poll many
+// resources.
+const (
+	DefaultQPS   = 50
+	DefaultBurst = 100
+)
+
+// protobufContentTypes prefers protobuf and falls back to JSON for
+// resources not served as protobuf.
+const protobufContentTypes = runtime.ContentTypeProtobuf + "," + runtime.ContentTypeJSON
+
+// Clients bundles the clients for one cluster. The typed clientset speaks
+// protobuf, which is much cheaper to decode for large pod and event lists;
+// the dynamic and discovery clients stay on JSON, as they must.
+type Clients struct {
+	// Config is the shared configuration. It carries the shared rate
+	// limiter; copy it before changing fields.
+	Config     *rest.Config
+	Kubernetes kubernetes.Interface
+	Dynamic    dynamic.Interface
+	Discovery  discovery.DiscoveryInterface
+}
+
+type kubeconfigKey struct {
+	path    string
+	context string
+}
+
+var (
+	mu           sync.Mutex
+	byConfig     = map[*rest.Config]*Clients{}
+	byKubeconfig = map[kubeconfigKey]*Clients{}
+)
+
+// ForConfig returns the clients for config, building them on first use.
+// Calls with the same *rest.Config share one set of clients.
+func ForConfig(config *rest.Config) (*Clients, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	return forConfigLocked(config)
+}
+
+// ForKubeconfig returns the clients for a kubeconfig path and context,
+// loading the kubeconfig on first use. An empty path uses the standard
+// loading rules.
+func ForKubeconfig(path, contextName string) (*Clients, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	key := kubeconfigKey{path: path, context: contextName}
+	if c, ok := byKubeconfig[key]; ok {
+		return c, nil
+	}
+	config, err := cluster.RESTConfig(path, contextName)
+	if err != nil {
+		return nil, err
+	}
+	c, err := forConfigLocked(config)
+	if err != nil {
+		return nil, err
+	}
+	byKubeconfig[key] = c
+	return c, nil
+}
+
+func forConfigLocked(config *rest.Config) (*Clients, error) {
+	if c, ok := byConfig[config]; ok {
+		return c, nil
+	}
+	c, err := build(config)
+	if err != nil {
+		return nil, err
+	}
+	byConfig[config] = c
+	byConfig[c.Config] = c
+	return c, nil
+}
+
+// protobufConfig returns a copy of cfg negotiating protobuf. The copy keeps
+// the shared rate limiter.
+func protobufConfig(cfg *rest.Config) *rest.Config {
+	pb := rest.CopyConfig(cfg)
+	pb.ContentType = runtime.ContentTypeProtobuf
+	pb.AcceptContentTypes = protobufContentTypes
+	return pb
+}
+
+func build(config *rest.Config) (*Clients, error) {
+	cfg := rest.CopyConfig(config)
+	if cfg.QPS == 0 {
+		cfg.QPS = DefaultQPS
+	}
+	if cfg.Burst == 0 {
+		cfg.Burst = DefaultBurst
+	}
+	if cfg.RateLimiter == nil {
+		cfg.RateLimiter = flowcontrol.NewTokenBucketRateLimiter(cfg.QPS, cfg.Burst)
+	}
+
+	httpClient, err := rest.HTTPClientFor(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating HTTP client: %w", err)
+	}
+	kc, err := kubernetes.NewForConfigAndClient(protobufConfig(cfg), httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("creating clientset: %w", err)
+	}
+	dc, err := dynamic.NewForConfigAndClient(cfg, httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("creating dynamic client: %w", err)
+	}
+	disco, err := discovery.NewDiscoveryClientForConfigAndClient(cfg, httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("creating discovery client: %w", err)
+	}
+	return &Clients{Config: cfg, Kubernetes: kc, Dynamic: dc, Discovery: disco}, nil
+}
@@ -0,0 +1,100 @@
+// Package notify sends alerts about scenario failures to people, e.g. a
+// chat channel, so continuously verified environments need no one watching
+// a dashboard.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Failure is a scenario that failed.
+type Failure struct {
+	Scenario string `json:"scenario"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Alert reports how a run changed the outcome of its scenarios.
+type Alert struct {
+	RunID string    `json:"runID"`
+	Time  time.Time `json:"time"`
+	// NewFailures are scenarios that failed after passing in the previous
+	// run, or failed on their first run.
+	NewFailures []Failure `json:"newFailures,omitempty"`
+	// Recovered are scenarios that passed after failing in the previous
+	// run.
+	Recovered []string `json:"recovered,omitempty"`
+	// Failing is the number of scenarios failing in the run.
+	Failing int `json:"failing"`
+	Total   int `json:"total"`
+	// Error reports why the suite could not run.
+	Error string `json:"error,omitempty"`
+}
+
+// Text renders the alert for people.
+func (a Alert) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "kube-agents-test run %s: %d of %d scenarios failing", a.RunID, a.Failing, a.Total)
+	if a.Error != "" {
+		fmt.Fprintf(&b, "\nsuite error: %s", a.Error)
+	}
+	for _, f := range a.NewFailures {
+		fmt.Fprintf(&b, "\nnewly failing: %s", f.Scenario)
+		if f.Error != "" {
+			fmt.Fprintf(&b, ": %s", f.Error)
+		}
+	}
+	for _, s := range a.Recovered {
+		fmt.Fprintf(&b, "\nrecovered: %s", s)
+	}
+	return b.String()
+}
+
+// Notifier delivers alerts.
+type Notifier interface {
+	Notify(ctx context.Context, a Alert) error
+}
+
+// Webhook posts alerts as JSON to a URL. The body carries the Alert fields
+// and a "text" field with Alert.Text, which chat incoming webhooks such as
+// Slack's display.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify implements Notifier.
+func (w *Webhook) Notify(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(struct {
+		Text string `json:"text"`
+		Alert
+	}{a.Text(), a})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("posting alert: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("posting alert: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
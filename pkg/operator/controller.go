@@ -0,0 +1,442 @@
+// Package operator runs scenarios declaratively inside a cluster. A TestRun
+// names scenario sources and carries per-scenario and per-expectation
+// results in its status; a TestSuite creates TestRuns whenever its spec
+// changes and, optionally, at an interval, so suites kept in git and
+// applied by a GitOps tool are verified continuously.
+//
+// The controller executes one TestRun at a time, since scenarios share the
+// cluster, and needs permission to do whatever its scenarios do.
+package operator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/engine"
+	"github.com/aslakknutsen/kube-agents-test/pkg/publish"
+	"github.com/aslakknutsen/kube-agents-test/pkg/runner"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario/loader"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario/remote"
+)
+
+// finishTimeout bounds the final status update of a run interrupted by
+// shutdown.
+const finishTimeout = 10 * time.Second
+
+// Controller reconciles TestRuns and TestSuites.
+type Controller struct {
+	dynamic    dynamic.Interface
+	exec       runner.Executor
+	runnerOpts []runner.Option
+	fetcher    *remote.Fetcher
+	events     kubernetes.Interface
+	namespace  string
+	log        *slog.Logger
+
+	runs       cache.GenericLister
+	suites     cache.GenericLister
+	runQueue   workqueue.TypedRateLimitingInterface[string]
+	suiteQueue workqueue.TypedRateLimitingInterface[string]
+
+	mu sync.Mutex
+	// active cancels the TestRun being executed, by UID.
+	active map[types.UID]context.CancelFunc
+}
+
+// Option configures a Controller.
+type Option func(*Controller)
+
+// WithNamespace restricts the controller to one namespace; all namespaces
+// by default.
+func WithNamespace(ns string) Option {
+	return func(c *Controller) { c.namespace = ns }
+}
+
+// WithRunnerOptions adds options to the runner of every TestRun, e.g.
+// where artifacts are written.
+func WithRunnerOptions(opts ...runner.Option) Option {
+	return func(c *Controller) { c.runnerOpts = append(c.runnerOpts, opts...) }
+}
+
+// WithFetcher sets how remote scenario sources are fetched.
+func WithFetcher(f *remote.Fetcher) Option {
+	return func(c *Controller) { c.fetcher = f }
+}
+
+// WithEvents records the progress of each TestRun as Events on it, using
+// client.
+func WithEvents(client kubernetes.Interface) Option {
+	return func(c *Controller) { c.events = client }
+}
+
+// WithLogger sets the logger for progress messages.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Controller) { c.log = l }
+}
+
+// New returns a Controller that executes scenarios with exec.
+func New(client dynamic.Interface, exec runner.Executor, opts ...Option) *Controller {
+	c := &Controller{
+		dynamic: client,
+		exec:    exec,
+		log:     slog.New(slog.DiscardHandler),
+		runQueue: workqueue.NewTypedRateLimitingQueueWithConfig(workqueue.DefaultTypedControllerRateLimiter[string](),
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: "testruns"}),
+		suiteQueue: workqueue.NewTypedRateLimitingQueueWithConfig(workqueue.DefaultTypedControllerRateLimiter[string](),
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: "testsuites"}),
+		active: map[types.UID]context.CancelFunc{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Run reconciles until ctx is done. The CRDs must be established.
+func (c *Controller) Run(ctx context.Context) error {
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(c.dynamic, 0, c.namespace, nil)
+	runs := factory.ForResource(TestRunResource)
+	suites := factory.ForResource(TestSuiteResource)
+	c.runs, c.suites = runs.Lister(), suites.Lister()
+	if _, err := runs.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.runChanged,
+		UpdateFunc: func(_, obj any) { c.runChanged(obj) },
+		DeleteFunc: c.runDeleted,
+	}); err != nil {
+		return err
+	}
+	if _, err := suites.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj any) { enqueue(c.suiteQueue, obj) },
+		UpdateFunc: func(_, obj any) { enqueue(c.suiteQueue, obj) },
+	}); err != nil {
+		return err
+	}
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+	if !cache.WaitForCacheSync(ctx.Done(), runs.Informer().HasSynced, suites.Informer().HasSynced) {
+		return errors.New("timed out waiting for caches to sync")
+	}
+
+	go func() {
+		<-ctx.Done()
+		c.runQueue.ShutDown()
+		c.suiteQueue.ShutDown()
+	}()
+	go c.work(ctx, c.suiteQueue, c.syncSuite)
+	c.log.Info("controller started", "namespace", c.namespace)
+	c.work(ctx, c.runQueue, c.syncRun)
+	return nil
+}
+
+// work processes keys from q until it shuts down, retrying failed keys
+// with backoff.
+func (c *Controller) work(ctx context.Context, q workqueue.TypedRateLimitingInterface[string], sync func(context.Context, string) error) {
+	for {
+		key, shutdown := q.Get()
+		if shutdown {
+			return
+		}
+		if err := sync(ctx, key); err != nil && ctx.Err() == nil {
+			c.log.Warn("reconciling", "key", key, "error", err)
+			q.AddRateLimited(key)
+		} else {
+			q.Forget(key)
+		}
+		q.Done(key)
+	}
+}
+
+func (c *Controller) runChanged(obj any) {
+	enqueue(c.runQueue, obj)
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		if suite := u.GetLabels()[LabelSuite]; suite != "" {
+			c.suiteQueue.Add(cache.NewObjectName(u.GetNamespace(), suite).String())
+		}
+	}
+}
+
+// runDeleted stops a deleted TestRun that is executing.
+func (c *Controller) runDeleted(obj any) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	if cancel, ok := c.active[u.GetUID()]; ok {
+		c.log.Info("testrun deleted, stopping it", "testrun", cache.MetaObjectToName(u).String())
+		cancel()
+	}
+	c.mu.Unlock()
+	if suite := u.GetLabels()[LabelSuite]; suite != "" {
+		c.suiteQueue.Add(cache.NewObjectName(u.GetNamespace(), suite).String())
+	}
+}
+
+func enqueue(q workqueue.TypedRateLimitingInterface[string], obj any) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	q.Add(key)
+}
+
+// syncRun executes a TestRun that has not started yet. A TestRun found
+// running is left over from a previous operator process, since this one
+// executes runs from this queue only, and is marked as interrupted.
+func (c *Controller) syncRun(ctx context.Context, key string) error {
+	tr, err := getFromLister[TestRun](c.runs, key)
+	if err != nil || tr == nil {
+		return err
+	}
+	switch tr.Status.Phase {
+	case "":
+		return c.execute(ctx, tr)
+	case PhaseRunning:
+		_, err := c.updateRunStatus(ctx, tr, func(st *TestRunStatus) bool {
+			if st.Phase != PhaseRunning {
+				return false
+			}
+			finishStatus(st, PhaseError, "interrupted: the operator restarted during the run")
+			return true
+		})
+		return err
+	}
+	return nil
+}
+
+// execute runs tr's scenarios, recording each scenario's outcome in its
+// status as soon as it is known.
+func (c *Controller) execute(ctx context.Context, tr *TestRun) error {
+	runID := runner.NewRunID()
+	started, err := c.updateRunStatus(ctx, tr, func(st *TestRunStatus) bool {
+		// The cache may lag behind a run this process already finished.
+		if st.Phase != "" {
+			return false
+		}
+		now := metav1.Now()
+		*st = TestRunStatus{Phase: PhaseRunning, RunID: runID, StartTime: &now}
+		meta.SetStatusCondition(&st.Conditions, metav1.Condition{
+			Type: ConditionComplete, Status: metav1.ConditionFalse, Reason: string(PhaseRunning), Message: "scenarios are running",
+		})
+		meta.SetStatusCondition(&st.Conditions, metav1.Condition{
+			Type: ConditionSucceeded, Status: metav1.ConditionUnknown, Reason: string(PhaseRunning), Message: "scenarios are running",
+		})
+		return true
+	})
+	if err != nil || !started {
+		return ignoreNotFound(err)
+	}
+	log := c.log.With("testrun", cache.MetaObjectToName(tr).String(), "run", runID)
+	log.Info("testrun started")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c.mu.Lock()
+	c.active[tr.UID] = cancel
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.active, tr.UID)
+		c.mu.Unlock()
+	}()
+
+	phase, message := c.runScenarios(ctx, tr, runID, log)
+	if ctx.Err() != nil {
+		// Deleted, or the operator is stopping; in the latter case record
+		// why the run ended rather than leaving it to the next process.
+		phase, message = PhaseError, "interrupted: the operator stopped during the run"
+	}
+	finishCtx, cancelFinish := context.WithTimeout(context.WithoutCancel(ctx), finishTimeout)
+	defer cancelFinish()
+	_, err = c.updateRunStatus(finishCtx, tr, func(st *TestRunStatus) bool {
+		finishStatus(st, phase, message)
+		return true
+	})
+	log.Info("testrun finished", "phase", phase)
+	return ignoreNotFound(err)
+}
+
+// runScenarios loads and runs tr's scenarios and returns the run's final
+// phase and message.
+func (c *Controller) runScenarios(ctx context.Context, tr *TestRun, runID string, log *slog.Logger) (Phase, string) {
+	scenarios, err := loader.LoadWithVars(ctx, c.fetcher, tr.Spec.Vars, tr.Spec.Sources...)
+	if err != nil {
+		return PhaseError, fmt.Sprintf("loading scenarios: %v", err)
+	}
+	opts := append(slices.Clone(c.runnerOpts),
+		runner.WithRunID(runID),
+		runner.WithLogger(log),
+	)
+	if c.events != nil {
+		ref := &corev1.ObjectReference{
+			APIVersion: GroupVersion.String(),
+			Kind:       "TestRun",
+			Namespace:  tr.Namespace,
+			Name:       tr.Name,
+			UID:        tr.UID,
+		}
+		p := publish.New(c.events, tr.Namespace, publish.WithConfigMap(""), publish.WithInvolvedObject(ref), publish.WithLogger(log))
+		opts = append(opts, runner.WithObserver(p.Observe))
+	}
+	opts = append(opts,
+		runner.WithObserver(func(e runner.Event) {
+			if e.Type != runner.EventScenarioFinished {
+				return
+			}
+			if _, err := c.updateRunStatus(ctx, tr, func(st *TestRunStatus) bool {
+				st.Scenarios = append(st.Scenarios, scenarioStatus(e.Result))
+				return true
+			}); err != nil {
+				log.Warn("recording scenario result", "scenario", e.Scenario, "error", err)
+			}
+		}),
+	)
+	suite, err := runner.New(c.exec, opts...).RunSuite(ctx, scenarios)
+	switch {
+	case err != nil:
+		return PhaseError, err.Error()
+	case suite.Passed():
+		return PhasePassed, fmt.Sprintf("%d scenarios passed", len(suite.Results))
+	default:
+		failed := suite.Failed()
+		return PhaseFailed, fmt.Sprintf("%d of %d scenarios failed: %v", len(failed), len(suite.Results), failed)
+	}
+}
+
+func scenarioStatus(res *engine.Result) ScenarioStatus {
+	st := ScenarioStatus{
+		Name:     res.Scenario,
+		Passed:   res.Passed,
+		Skipped:  res.Skipped,
+		Message:  publish.Truncate(res.Error),
+		Duration: res.Duration.Round(time.Millisecond).String(),
+	}
+	if res.Skipped {
+		st.Message = publish.Truncate(res.SkipReason)
+	}
+	for _, exp := range res.Expectations {
+		var metAfter string
+		if exp.Met {
+			metAfter = exp.MetAfter.Round(time.Millisecond).String()
+		}
+		st.Expectations = append(st.Expectations, ExpectationStatus{
+			Step:        exp.Step,
+			Resource:    exp.Resource,
+			ID:          exp.ID,
+			Description: exp.Description,
+			MetAfter:    metAfter,
+			Met:         exp.Met,
+			Message:     publish.Truncate(exp.Message),
+		})
+	}
+	return st
+}
+
+func finishStatus(st *TestRunStatus, phase Phase, message string) {
+	now := metav1.Now()
+	st.Phase = phase
+	st.Message = publish.Truncate(message)
+	st.CompletionTime = &now
+	succeeded := metav1.ConditionFalse
+	if phase == PhasePassed {
+		succeeded = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(&st.Conditions, metav1.Condition{
+		Type: ConditionComplete, Status: metav1.ConditionTrue, Reason: string(phase), Message: st.Message,
+	})
+	meta.SetStatusCondition(&st.Conditions, metav1.Condition{
+		Type: ConditionSucceeded, Status: succeeded, Reason: string(phase), Message: st.Message,
+	})
+}
+
+func (c *Controller) updateRunStatus(ctx context.Context, tr *TestRun, mutate func(*TestRunStatus) bool) (bool, error) {
+	return updateStatus(ctx, c.dynamic.Resource(TestRunResource).Namespace(tr.Namespace), tr.Name, mutate)
+}
+
+// updateStatus applies mutate to the live status of the named object,
+// retrying on conflicts. mutate reports whether it changed anything;
+// updateStatus reports the same.
+func updateStatus[S any](ctx context.Context, client dynamic.ResourceInterface, name string, mutate func(*S) bool) (bool, error) {
+	var changed bool
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj, err := client.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		var status S
+		if raw, ok := obj.Object["status"].(map[string]any); ok {
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &status); err != nil {
+				return err
+			}
+		}
+		if changed = mutate(&status); !changed {
+			return nil
+		}
+		raw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+		if err != nil {
+			return err
+		}
+		obj.Object["status"] = raw
+		_, err = client.UpdateStatus(ctx, obj, metav1.UpdateOptions{FieldManager: FieldManager})
+		return err
+	})
+	return changed, err
+}
+
+// getFromLister returns the object key names, converted to T, or nil when
+// it does not exist.
+func getFromLister[T any](lister cache.GenericLister, key string) (*T, error) {
+	ns, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := lister.ByNamespace(ns).Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fromObject[T](obj)
+}
+
+func fromObject[T any](obj runtime.Object) (*T, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object type %T", obj)
+	}
+	var out T
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func ignoreNotFound(err error) error {
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
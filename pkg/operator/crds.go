@@ -0,0 +1,52 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+)
+
+//go:embed crds.yaml
+var crdManifests []byte
+
+// FieldManager is the field manager of everything the operator writes.
+const FieldManager = "kube-agents-operator"
+
+var crdResource = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// CRDNames are the names of the operator's CustomResourceDefinitions.
+func CRDNames() []string {
+	return []string{TestRunResource.GroupResource().String(), TestSuiteResource.GroupResource().String()}
+}
+
+// InstallCRDs creates or updates the operator's CustomResourceDefinitions
+// with server-side apply. They are not established yet when it returns.
+func InstallCRDs(ctx context.Context, client dynamic.Interface) error {
+	dec := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(crdManifests), 4096)
+	for {
+		var raw map[string]any
+		if err := dec.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		crd := &unstructured.Unstructured{Object: raw}
+		if _, err := client.Resource(crdResource).Apply(ctx, crd.GetName(), crd, metav1.ApplyOptions{FieldManager: FieldManager, Force: true}); err != nil {
+			return fmt.Errorf("applying %s: %w", crd.GetName(), err)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package operator
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+// syncSuite creates the suite's next TestRun when it is due, records the
+// outcome of its latest finished run, and prunes old runs. Runs are named
+// after the suite's run counter, so a sync working from a stale cache
+// cannot create a run twice.
+func (c *Controller) syncSuite(ctx context.Context, key string) error {
+	ts, err := getFromLister[TestSuite](c.suites, key)
+	if err != nil || ts == nil {
+		return err
+	}
+	runs, err := c.suiteRuns(ts)
+	if err != nil {
+		return err
+	}
+	var running bool
+	var finished []*TestRun
+	for _, tr := range runs {
+		if tr.Status.Phase.Finished() {
+			finished = append(finished, tr)
+		} else {
+			running = true
+		}
+	}
+
+	if !ts.Spec.Suspend && !running {
+		due, wait := suiteDue(ts, time.Now())
+		if due {
+			return c.startSuiteRun(ctx, ts)
+		}
+		if wait > 0 {
+			c.suiteQueue.AddAfter(key, wait)
+		}
+	}
+
+	if len(finished) > 0 {
+		last := finished[len(finished)-1].Status.Phase
+		if _, err := c.updateSuiteStatus(ctx, ts, func(st *TestSuiteStatus) bool {
+			if st.LastPhase == last {
+				return false
+			}
+			st.LastPhase = last
+			return true
+		}); err != nil {
+			return err
+		}
+	}
+	return c.prune(ctx, finished, ts.Spec.HistoryLimitOrDefault())
+}
+
+// suiteDue reports whether ts should start a run at now and, if not and it
+// runs at an interval, how long until it should.
+func suiteDue(ts *TestSuite, now time.Time) (bool, time.Duration) {
+	if ts.Status.ObservedGeneration != ts.Generation || ts.Status.LastRunTime == nil {
+		return true, 0
+	}
+	if ts.Spec.Interval == nil || ts.Spec.Interval.Duration <= 0 {
+		return false, 0
+	}
+	next := ts.Status.LastRunTime.Add(ts.Spec.Interval.Duration)
+	if !now.Before(next) {
+		return true, 0
+	}
+	return false, next.Sub(now)
+}
+
+func (c *Controller) startSuiteRun(ctx context.Context, ts *TestSuite) error {
+	n := ts.Status.Runs + 1
+	name := fmt.Sprintf("%s-%d", ts.Name, n)
+	controller := true
+	tr := &TestRun{
+		TypeMeta: metav1.TypeMeta{APIVersion: GroupVersion.String(), Kind: "TestRun"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ts.Namespace,
+			Labels:    map[string]string{LabelSuite: ts.Name},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: GroupVersion.String(),
+				Kind:       "TestSuite",
+				Name:       ts.Name,
+				UID:        ts.UID,
+				Controller: &controller,
+			}},
+		},
+		Spec: TestRunSpec{Sources: ts.Spec.Sources, Vars: ts.Spec.Vars},
+	}
+	raw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(tr)
+	if err != nil {
+		return err
+	}
+	_, err = c.dynamic.Resource(TestRunResource).Namespace(ts.Namespace).Create(ctx, &unstructured.Unstructured{Object: raw}, metav1.CreateOptions{FieldManager: FieldManager})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("creating testrun %s: %w", name, err)
+	}
+	c.log.Info("testsuite started a run", "testsuite", cache.MetaObjectToName(ts).String(), "testrun", name)
+	_, err = c.updateSuiteStatus(ctx, ts, func(st *TestSuiteStatus) bool {
+		if st.Runs >= n {
+			return false
+		}
+		now := metav1.Now()
+		st.Runs = n
+		st.LastRun = name
+		st.LastRunTime = &now
+		st.ObservedGeneration = ts.Generation
+		return true
+	})
+	return err
+}
+
+// suiteRuns returns the TestRuns ts created, oldest first.
+func (c *Controller) suiteRuns(ts *TestSuite) ([]*TestRun, error) {
+	objs, err := c.runs.ByNamespace(ts.Namespace).List(labels.SelectorFromSet(labels.Set{LabelSuite: ts.Name}))
+	if err != nil {
+		return nil, err
+	}
+	var runs []*TestRun
+	for _, obj := range objs {
+		tr, err := fromObject[TestRun](obj)
+		if err != nil {
+			return nil, err
+		}
+		if owner := metav1.GetControllerOf(tr); owner == nil || owner.UID != ts.UID {
+			continue
+		}
+		runs = append(runs, tr)
+	}
+	slices.SortFunc(runs, func(a, b *TestRun) int {
+		if c := a.CreationTimestamp.Compare(b.CreationTimestamp.Time); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return runs, nil
+}
+
+// prune deletes the oldest of finished beyond limit.
+func (c *Controller) prune(ctx context.Context, finished []*TestRun, limit int) error {
+	for i := 0; i < len(finished)-limit; i++ {
+		tr := finished[i]
+		err := c.dynamic.Resource(TestRunResource).Namespace(tr.Namespace).Delete(ctx, tr.Name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &tr.UID},
+		})
+		if err := ignoreNotFound(err); err != nil {
+			return fmt.Errorf("pruning testrun %s: %w", tr.Name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Controller) updateSuiteStatus(ctx context.Context, ts *TestSuite, mutate func(*TestSuiteStatus) bool) (bool, error) {
+	return updateStatus(ctx, c.dynamic.Resource(TestSuiteResource).Namespace(ts.Namespace), ts.Name, mutate)
+}
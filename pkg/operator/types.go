@@ -0,0 +1,165 @@
+package operator
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Group and Version of the operator's resources.
+const (
+	Group   = "kube-agents-test.io"
+	Version = "v1alpha1"
+)
+
+var (
+	// GroupVersion is the API version of the operator's resources.
+	GroupVersion = schema.GroupVersion{Group: Group, Version: Version}
+	// TestRunResource is the TestRun custom resource.
+	TestRunResource = GroupVersion.WithResource("testruns")
+	// TestSuiteResource is the TestSuite custom resource.
+	TestSuiteResource = GroupVersion.WithResource("testsuites")
+)
+
+// LabelSuite carries the name of the TestSuite that created a TestRun.
+const LabelSuite = Group + "/suite"
+
+// DefaultHistoryLimit is how many finished TestRuns a TestSuite keeps
+// unless its spec says otherwise.
+const DefaultHistoryLimit = 10
+
+// TestRun executes scenarios once.
+type TestRun struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TestRunSpec   `json:"spec"`
+	Status TestRunStatus `json:"status,omitempty"`
+}
+
+// TestRunSpec says which scenarios to run.
+type TestRunSpec struct {
+	// Sources are scenario files, directories, or remote bundles, as
+	// accepted by kube-agents-test run. Local paths are on the operator's
+	// filesystem, so these are usually git+ or oci:// references.
+	Sources []string `json:"sources"`
+	// Vars are template variables for the scenario files of Sources.
+	Vars map[string]string `json:"vars,omitempty"`
+}
+
+// Phase is where a TestRun is in its lifecycle.
+type Phase string
+
+// TestRun phases. A TestRun waiting for its turn has no phase yet; Passed,
+// Failed, and Error are final.
+const (
+	PhaseRunning Phase = "Running"
+	PhasePassed  Phase = "Passed"
+	PhaseFailed  Phase = "Failed"
+	// PhaseError means the scenarios could not run at all, e.g. because a
+	// source could not be fetched.
+	PhaseError Phase = "Error"
+)
+
+// Finished reports whether p is final.
+func (p Phase) Finished() bool {
+	return p == PhasePassed || p == PhaseFailed || p == PhaseError
+}
+
+// TestRunStatus is the observed state of a TestRun. Scenarios fill in as
+// they finish.
+type TestRunStatus struct {
+	Phase          Phase            `json:"phase,omitempty"`
+	RunID          string           `json:"runID,omitempty"`
+	StartTime      *metav1.Time     `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time     `json:"completionTime,omitempty"`
+	Message        string           `json:"message,omitempty"`
+	Scenarios      []ScenarioStatus `json:"scenarios,omitempty"`
+	// Conditions are ConditionComplete and ConditionSucceeded, for
+	// kubectl wait and generic tooling.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// TestRun condition types.
+const (
+	// ConditionComplete is true once the run is finished.
+	ConditionComplete = "Complete"
+	// ConditionSucceeded is true once every scenario passed, false once
+	// the run finished otherwise, and unknown while it runs.
+	ConditionSucceeded = "Succeeded"
+)
+
+// ScenarioStatus is the outcome of one scenario.
+type ScenarioStatus struct {
+	Name     string `json:"name"`
+	Passed   bool   `json:"passed"`
+	Skipped  bool   `json:"skipped,omitempty"`
+	Message  string `json:"message,omitempty"`
+	Duration string `json:"duration,omitempty"`
+	// Expectations are the outcomes of the scenario's expectations at
+	// their last evaluation.
+	Expectations []ExpectationStatus `json:"expectations,omitempty"`
+}
+
+// ExpectationStatus is the outcome of one expectation.
+type ExpectationStatus struct {
+	// Step names the step of a multi-step scenario the expectation
+	// belongs to.
+	Step     string `json:"step,omitempty"`
+	Resource string `json:"resource"`
+	// ID and Description are the expectation's, if the scenario sets
+	// them.
+	ID          string `json:"id,omitempty"`
+	Description string `json:"description,omitempty"`
+	// MetAfter is how long into the wait the expectation was met.
+	MetAfter string `json:"metAfter,omitempty"`
+	Met      bool   `json:"met"`
+	Message  string `json:"message,omitempty"`
+}
+
+// TestSuite creates TestRuns of its sources whenever its spec changes and,
+// optionally, at an interval, so scenarios managed in git are verified
+// continuously.
+type TestSuite struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TestSuiteSpec   `json:"spec"`
+	Status TestSuiteStatus `json:"status,omitempty"`
+}
+
+// TestSuiteSpec says what to run and how often.
+type TestSuiteSpec struct {
+	// Sources and Vars are passed on to each TestRun.
+	Sources []string          `json:"sources"`
+	Vars    map[string]string `json:"vars,omitempty"`
+	// Interval re-runs the suite this long after the previous run
+	// started. Without it, the suite runs once per spec change.
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// HistoryLimit is how many finished TestRuns are kept;
+	// DefaultHistoryLimit when unset.
+	HistoryLimit *int32 `json:"historyLimit,omitempty"`
+	// Suspend stops new runs from being created.
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// HistoryLimitOrDefault returns the history limit, falling back to
+// DefaultHistoryLimit.
+func (s *TestSuiteSpec) HistoryLimitOrDefault() int {
+	if s.HistoryLimit == nil {
+		return DefaultHistoryLimit
+	}
+	return int(*s.HistoryLimit)
+}
+
+// TestSuiteStatus is the observed state of a TestSuite.
+type TestSuiteStatus struct {
+	// ObservedGeneration is the generation the latest run was created for.
+	ObservedGeneration int64        `json:"observedGeneration,omitempty"`
+	LastRun            string       `json:"lastRun,omitempty"`
+	LastRunTime        *metav1.Time `json:"lastRunTime,omitempty"`
+	// LastPhase is the phase of the latest finished run.
+	LastPhase Phase `json:"lastPhase,omitempty"`
+	// Runs counts the TestRuns created so far; the latest is named
+	// <suite>-<runs>.
+	Runs int64 `json:"runs,omitempty"`
+}
@@ -0,0 +1,260 @@
+// Package publish makes run results visible in the cluster they ran
+// against, so operators can check agent verification status with kubectl
+// alone: each finished scenario and run is recorded as an Event, and each
+// scenario's latest outcome is kept in a results ConfigMap:
+//
+//	kubectl get events -n <ns> --field-selector involvedObject.name=kube-agents-test-results
+//	kubectl get configmap -n <ns> kube-agents-test-results -o yaml
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/engine"
+	"github.com/aslakknutsen/kube-agents-test/pkg/runner"
+)
+
+const (
+	// DefaultConfigMap is the name of the results ConfigMap unless
+	// WithConfigMap says otherwise.
+	DefaultConfigMap = "kube-agents-test-results"
+	// Component is the source of published Events.
+	Component = "kube-agents-test"
+	// LastRunAnnotation carries the ID of the run that last updated the
+	// results ConfigMap.
+	LastRunAnnotation = "kube-agents-test/last-run"
+
+	publishTimeout = 10 * time.Second
+	// MaxMessageLen bounds the messages Truncate returns, keeping objects
+	// they are copied into well below etcd's size limit however verbose a
+	// failure is.
+	MaxMessageLen = 1024
+)
+
+// Event reasons.
+const (
+	ReasonScenarioPassed  = "ScenarioPassed"
+	ReasonScenarioFailed  = "ScenarioFailed"
+	ReasonScenarioSkipped = "ScenarioSkipped"
+	ReasonRunPassed       = "RunPassed"
+	ReasonRunFailed       = "RunFailed"
+)
+
+// Outcome is a scenario's entry in the results ConfigMap, keyed by
+// ConfigMapKey of its name.
+type Outcome struct {
+	RunID      string    `json:"runID"`
+	Passed     bool      `json:"passed"`
+	Skipped    bool      `json:"skipped,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Duration   string    `json:"duration"`
+}
+
+// Publisher records the progress of runs in a namespace. Pass its Observe
+// method to runner.WithObserver.
+type Publisher struct {
+	client    kubernetes.Interface
+	namespace string
+	configMap string
+	involved  *corev1.ObjectReference
+	log       *slog.Logger
+
+	passed, failed, skipped int
+}
+
+// Option configures a Publisher.
+type Option func(*Publisher)
+
+// WithConfigMap sets the name of the results ConfigMap; an empty name
+// disables it.
+func WithConfigMap(name string) Option {
+	return func(p *Publisher) { p.configMap = name }
+}
+
+// WithInvolvedObject sets the object Events are recorded on; the results
+// ConfigMap by default. Without either, no Events are recorded.
+func WithInvolvedObject(ref *corev1.ObjectReference) Option {
+	return func(p *Publisher) { p.involved = ref }
+}
+
+// WithLogger sets the logger for publishing failures, which never fail a
+// run.
+func WithLogger(l *slog.Logger) Option {
+	return func(p *Publisher) { p.log = l }
+}
+
+// New returns a Publisher recording into namespace.
+func New(client kubernetes.Interface, namespace string, opts ...Option) *Publisher {
+	p := &Publisher{
+		client:    client,
+		namespace: namespace,
+		configMap: DefaultConfigMap,
+		log:       slog.New(slog.DiscardHandler),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Observe publishes e. Failures are logged.
+func (p *Publisher) Observe(e runner.Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	switch e.Type {
+	case runner.EventRunStarted:
+		p.passed, p.failed, p.skipped = 0, 0, 0
+	case runner.EventScenarioFinished:
+		res := e.Result
+		switch {
+		case res.Skipped:
+			p.skipped++
+		case res.Passed:
+			p.passed++
+		default:
+			p.failed++
+		}
+		if p.configMap != "" {
+			if err := p.record(ctx, e.RunID, e.Time, res); err != nil {
+				p.log.Warn("recording result", "scenario", res.Scenario, "configmap", p.configMap, "error", err)
+			}
+		}
+		reason, typ, msg := ReasonScenarioPassed, corev1.EventTypeNormal, fmt.Sprintf("scenario %s passed in %s", res.Scenario, res.Duration.Round(time.Millisecond))
+		switch {
+		case res.Skipped:
+			reason, typ, msg = ReasonScenarioSkipped, corev1.EventTypeWarning, fmt.Sprintf("scenario %s skipped: %s", res.Scenario, res.SkipReason)
+		case !res.Passed:
+			reason, typ, msg = ReasonScenarioFailed, corev1.EventTypeWarning, fmt.Sprintf("scenario %s failed: %s", res.Scenario, res.Error)
+		}
+		p.event(ctx, e, typ, reason, msg)
+	case runner.EventRunFinished:
+		var skipped string
+		if p.skipped > 0 {
+			skipped = fmt.Sprintf(", %d skipped", p.skipped)
+		}
+		if p.failed > 0 {
+			p.event(ctx, e, corev1.EventTypeWarning, ReasonRunFailed, fmt.Sprintf("run %s: %d of %d scenarios failed%s", e.RunID, p.failed, p.passed+p.failed, skipped))
+		} else {
+			p.event(ctx, e, corev1.EventTypeNormal, ReasonRunPassed, fmt.Sprintf("run %s: %d scenarios passed%s", e.RunID, p.passed, skipped))
+		}
+	}
+}
+
+// record stores res as the scenario's latest outcome.
+func (p *Publisher) record(ctx context.Context, runID string, at time.Time, res *engine.Result) error {
+	data, err := json.Marshal(Outcome{
+		RunID:      runID,
+		Passed:     res.Passed,
+		Skipped:    res.Skipped,
+		Error:      Truncate(res.Error),
+		FinishedAt: at.UTC(),
+		Duration:   res.Duration.Round(time.Millisecond).String(),
+	})
+	if err != nil {
+		return err
+	}
+	cms := p.client.CoreV1().ConfigMaps(p.namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := cms.Get(ctx, p.configMap, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: p.configMap, Namespace: p.namespace}}
+			setOutcome(cm, runID, res.Scenario, data)
+			_, err = cms.Create(ctx, cm, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// Lost a race with another run; retry as an update.
+				return apierrors.NewConflict(corev1.Resource("configmaps"), p.configMap, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		setOutcome(cm, runID, res.Scenario, data)
+		_, err = cms.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func setOutcome(cm *corev1.ConfigMap, runID, scenario string, data []byte) {
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	cm.Data[ConfigMapKey(scenario)] = string(data)
+	cm.Annotations[LastRunAnnotation] = runID
+}
+
+// event records an Event on the involved object, if there is one.
+func (p *Publisher) event(ctx context.Context, e runner.Event, typ, reason, message string) {
+	ref := p.involved
+	if ref == nil {
+		if p.configMap == "" {
+			return
+		}
+		ref = &corev1.ObjectReference{APIVersion: "v1", Kind: "ConfigMap", Namespace: p.namespace, Name: p.configMap}
+		if cm, err := p.client.CoreV1().ConfigMaps(p.namespace).Get(ctx, p.configMap, metav1.GetOptions{}); err == nil {
+			ref.UID = cm.UID
+		}
+	}
+	at := metav1.NewTime(e.Time)
+	ev := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: ref.Name + ".",
+			Namespace:    ref.Namespace,
+		},
+		InvolvedObject:      *ref,
+		Reason:              reason,
+		Message:             Truncate(message),
+		Type:                typ,
+		Source:              corev1.EventSource{Component: Component},
+		FirstTimestamp:      at,
+		LastTimestamp:       at,
+		Count:               1,
+		ReportingController: Component,
+		ReportingInstance:   instance(),
+	}
+	if _, err := p.client.CoreV1().Events(ref.Namespace).Create(ctx, ev, metav1.CreateOptions{}); err != nil {
+		p.log.Warn("recording event", "reason", reason, "error", err)
+	}
+}
+
+var invalidKeyChars = regexp.MustCompile(`[^-._a-zA-Z0-9]+`)
+
+// ConfigMapKey returns the results ConfigMap key of a scenario: its name
+// with characters ConfigMap keys do not allow replaced by "_".
+func ConfigMapKey(scenario string) string {
+	return invalidKeyChars.ReplaceAllString(scenario, "_")
+}
+
+func instance() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return Component
+	}
+	return host
+}
+
+// Truncate cuts s to MaxMessageLen bytes, on a rune boundary, marking the
+// cut with an ellipsis.
+func Truncate(s string) string {
+	if len(s) <= MaxMessageLen {
+		return s
+	}
+	return strings.ToValidUTF8(s[:MaxMessageLen], "") + "…"
+}
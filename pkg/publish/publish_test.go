@@ -0,0 +1,99 @@
+package publish
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/engine"
+	"github.com/aslakknutsen/kube-agents-test/pkg/runner"
+)
+
+func TestObserveRunOutcome(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []*engine.Result
+		reason  string
+		message string
+	}{
+		{
+			name:    "passed",
+			results: []*engine.Result{{Scenario: "a", Passed: true}},
+			reason:  ReasonRunPassed,
+			message: "run r1: 1 scenarios passed",
+		},
+		{
+			name:    "skipped only",
+			results: []*engine.Result{{Scenario: "a", Skipped: true, SkipReason: "dependency a failed"}},
+			reason:  ReasonRunPassed,
+			message: "run r1: 0 scenarios passed, 1 skipped",
+		},
+		{
+			name: "failed and skipped",
+			results: []*engine.Result{
+				{Scenario: "a", Passed: true},
+				{Scenario: "b", Error: "timed out"},
+				{Scenario: "c", Skipped: true, SkipReason: "dependency b failed"},
+			},
+			reason:  ReasonRunFailed,
+			message: "run r1: 1 of 2 scenarios failed, 1 skipped",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientset()
+			// The fake does not generate names as the API server does.
+			generated := 0
+			client.PrependReactor("create", "events", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				ev := action.(clienttesting.CreateAction).GetObject().(*corev1.Event)
+				generated++
+				ev.Name = ev.GenerateName + strconv.Itoa(generated)
+				return false, nil, nil
+			})
+			p := New(client, "test", WithInvolvedObject(&corev1.ObjectReference{Kind: "Pod", Namespace: "test", Name: "runner"}))
+			now := time.Now()
+			p.Observe(runner.Event{Type: runner.EventRunStarted, RunID: "r1", Time: now})
+			for _, res := range tt.results {
+				p.Observe(runner.Event{Type: runner.EventScenarioFinished, RunID: "r1", Time: now, Scenario: res.Scenario, Result: res})
+			}
+			p.Observe(runner.Event{Type: runner.EventRunFinished, RunID: "r1", Time: now})
+
+			events, err := client.CoreV1().Events("test").List(context.Background(), metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(events.Items); n != len(tt.results)+1 {
+				t.Fatalf("recorded %d events, want %d", n, len(tt.results)+1)
+			}
+			var run *corev1.Event
+			for i := range events.Items {
+				if r := events.Items[i].Reason; r == ReasonRunPassed || r == ReasonRunFailed {
+					run = &events.Items[i]
+				}
+			}
+			if run == nil || run.Reason != tt.reason || run.Message != tt.message {
+				t.Errorf("run event = %+v, want %s %q", run, tt.reason, tt.message)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	short := strings.Repeat("a", MaxMessageLen)
+	if got := Truncate(short); got != short {
+		t.Errorf("Truncate() of a message within the bound changed it")
+	}
+	// A two-byte rune straddles the cut.
+	long := strings.Repeat("a", MaxMessageLen-1) + "é" + "tail"
+	if got, want := Truncate(long), strings.Repeat("a", MaxMessageLen-1)+"…"; got != want {
+		t.Errorf("Truncate() = %q…, want the whole runes before the cut and an ellipsis", got[len(got)-8:])
+	}
+}
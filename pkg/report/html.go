@@ -0,0 +1,92 @@
+package report
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/engine"
+	"github.com/aslakknutsen/kube-agents-test/pkg/runner"
+)
+
+// HTML writes a self-contained HTML page of the suite's results to Path,
+// for people reading results in a browser, e.g. as a CI artifact.
+type HTML struct {
+	Path string
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>kube-agents-test run {{.RunID}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.4em; text-align: left; vertical-align: top; }
+.passed { color: #1a7f37; } .failed { color: #cf222e; } .skipped { color: #9a6700; }
+pre { background: #f6f8fa; padding: 0.5em; overflow-x: auto; }
+ul { margin: 0; padding-left: 1.2em; }
+</style>
+</head>
+<body>
+<h1>Run {{.RunID}}: {{if .Passed}}<span class="passed">passed</span>{{else}}<span class="failed">failed</span>{{end}}</h1>
+{{- with .Fingerprint}}
+<details><summary>Environment</summary>
+<ul>
+<li>Cluster {{.Cluster.Version}}{{if .Cluster.Provider}} on {{.Cluster.Provider}}{{end}}</li>
+{{- range .Nodes}}
+<li>Nodes: {{.}}</li>
+{{- end}}
+<li>kube-agents-test {{.Framework.Version}}{{if .Framework.Revision}} ({{.Framework.Revision}}{{if .Framework.Modified}}, modified{{end}}){{end}}, {{.Framework.GoVersion}}</li>
+{{- range .Scenarios}}
+<li>Scenarios from {{.Repository}} at {{.Revision}}{{if .Dirty}} with uncommitted changes{{end}}</li>
+{{- end}}
+<li>Host {{.Host.OS}}/{{.Host.Arch}}{{if .Host.Release}}, {{.Host.Release}}{{end}}</li>
+</ul>
+</details>
+{{- end}}
+<table>
+<tr><th>Scenario</th><th>Status</th><th>Duration</th><th>Details</th></tr>
+{{- range .Scenarios}}
+<tr>
+<td>{{.Name}}</td>
+<td class="{{.Status}}">{{.Status}}</td>
+<td>{{.Duration}}</td>
+<td>
+{{- if .SkipReason}}{{.SkipReason}}{{end}}
+{{- if .Error}}<p>{{.Error}}</p>{{end}}
+{{- if .Expectations}}
+<ul>
+{{- range .Expectations}}
+<li class="{{if .Met}}passed{{else}}failed{{end}}">{{if .Step}}{{.Step}}: {{end}}{{if .ID}}{{.ID}} ({{.Resource}}){{else}}{{.Resource}}{{end}}
+{{- if .Met}} met after {{.MetAfter}}{{else}} not met: {{.Message}}{{end}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- if .Diagnostics}}
+<details><summary>Diagnostics</summary><pre>{{.Diagnostics}}</pre></details>
+{{- end}}
+</td>
+</tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+var _ runner.Reporter = (*HTML)(nil)
+
+// ScenarioStarted does nothing.
+func (r *HTML) ScenarioStarted(string, string) {}
+
+// ScenarioFinished does nothing; results are written with the suite.
+func (r *HTML) ScenarioFinished(string, *engine.Result) {}
+
+// SuiteFinished writes the report.
+func (r *HTML) SuiteFinished(suite *runner.SuiteResult) error {
+	var buf bytes.Buffer
+	if err := htmlTemplate.Execute(&buf, NewSuite(suite)); err != nil {
+		return err
+	}
+	return writeFile(r.Path, buf.Bytes())
+}
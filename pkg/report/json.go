@@ -0,0 +1,174 @@
+package report
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/engine"
+	"github.com/aslakknutsen/kube-agents-test/pkg/fingerprint"
+	"github.com/aslakknutsen/kube-agents-test/pkg/runner"
+)
+
+// JSON writes the suite's results to Path as a JSON Suite document, for
+// scripts and dashboards.
+type JSON struct {
+	Path string
+}
+
+// Suite is the document written by the JSON reporter.
+type Suite struct {
+	RunID  string `json:"runID"`
+	Passed bool   `json:"passed"`
+	// Fingerprint is the environment the run executed in, if captured.
+	Fingerprint *fingerprint.Fingerprint `json:"fingerprint,omitempty"`
+	Scenarios   []Scenario               `json:"scenarios"`
+}
+
+// Scenario is a scenario's entry in a Suite.
+type Scenario struct {
+	Name         string            `json:"name"`
+	Status       string            `json:"status"`
+	SkipReason   string            `json:"skipReason,omitempty"`
+	Error        string            `json:"error,omitempty"`
+	StartedAt    time.Time         `json:"startedAt"`
+	Duration     string            `json:"duration"`
+	Dimensions   map[string]string `json:"dimensions,omitempty"`
+	Expectations []Expectation     `json:"expectations,omitempty"`
+	Agents       []Agent           `json:"agents,omitempty"`
+	Churn        []Churn           `json:"churn,omitempty"`
+	Denials      []Denial          `json:"denials,omitempty"`
+	Evictions    []Eviction        `json:"evictions,omitempty"`
+	// Diagnostics is the rendered diagnostics report of a failed
+	// scenario.
+	Diagnostics string `json:"diagnostics,omitempty"`
+}
+
+// Expectation is the outcome of one expectation of a Scenario.
+type Expectation struct {
+	Step        string `json:"step,omitempty"`
+	Resource    string `json:"resource"`
+	ID          string `json:"id,omitempty"`
+	Description string `json:"description,omitempty"`
+	Met         bool   `json:"met"`
+	MetAfter    string `json:"metAfter,omitempty"`
+	Message     string `json:"message,omitempty"`
+}
+
+// Agent is the readiness of a deployed agent of a Scenario.
+type Agent struct {
+	Name        string `json:"name"`
+	TimeToReady string `json:"timeToReady,omitempty"`
+	// ImageID is the image, by digest, the agent ran.
+	ImageID string `json:"imageID,omitempty"`
+	// Flaps counts the times the agent stopped being ready.
+	Flaps int `json:"flaps,omitempty"`
+}
+
+// Churn is how often a resource of a Scenario's churn limits changed.
+type Churn struct {
+	Resource string `json:"resource"`
+	Creates  int    `json:"creates,omitempty"`
+	Updates  int    `json:"updates,omitempty"`
+	Deletes  int    `json:"deletes,omitempty"`
+}
+
+// Denial is the API server's answer to a mutation a Scenario expects
+// admission to deny: the admission response when it was denied.
+type Denial struct {
+	ID          string `json:"id,omitempty"`
+	Description string `json:"description,omitempty"`
+	Operation   string `json:"operation"`
+	Resource    string `json:"resource"`
+	Denied      bool   `json:"denied"`
+	Allowed     bool   `json:"allowed,omitempty"`
+	Code        int32  `json:"code,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	Message     string `json:"message,omitempty"`
+}
+
+// Eviction is the API server's answer to an eviction a Scenario expects to
+// be blocked or allowed.
+type Eviction struct {
+	ID          string `json:"id,omitempty"`
+	Description string `json:"description,omitempty"`
+	Pod         string `json:"pod,omitempty"`
+	Outcome     string `json:"outcome"`
+	Met         bool   `json:"met"`
+	Blocked     bool   `json:"blocked,omitempty"`
+	Allowed     bool   `json:"allowed,omitempty"`
+	Code        int32  `json:"code,omitempty"`
+	Message     string `json:"message,omitempty"`
+}
+
+var _ runner.Reporter = (*JSON)(nil)
+
+// ScenarioStarted does nothing.
+func (r *JSON) ScenarioStarted(string, string) {}
+
+// ScenarioFinished does nothing; results are written with the suite.
+func (r *JSON) ScenarioFinished(string, *engine.Result) {}
+
+// SuiteFinished writes the report.
+func (r *JSON) SuiteFinished(suite *runner.SuiteResult) error {
+	out, err := json.MarshalIndent(NewSuite(suite), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(r.Path, append(out, '\n'))
+}
+
+// NewSuite returns the Suite document of suite.
+func NewSuite(suite *runner.SuiteResult) Suite {
+	doc := Suite{RunID: suite.RunID, Passed: suite.Passed(), Fingerprint: suite.Fingerprint, Scenarios: []Scenario{}}
+	for _, res := range suite.Results {
+		doc.Scenarios = append(doc.Scenarios, NewScenario(res))
+	}
+	return doc
+}
+
+// NewScenario returns the Scenario entry of res.
+func NewScenario(res *engine.Result) Scenario {
+	sc := Scenario{
+		Name:       res.Scenario,
+		Status:     status(res),
+		SkipReason: res.SkipReason,
+		Error:      res.Error,
+		StartedAt:  res.StartedAt,
+		Duration:   roundDuration(res.Duration),
+		Dimensions: res.Dimensions,
+	}
+	if res.Report != nil {
+		sc.Diagnostics = res.Report.String()
+	}
+	for _, exp := range res.Expectations {
+		e := Expectation{
+			Step:        exp.Step,
+			Resource:    exp.Resource,
+			ID:          exp.ID,
+			Description: exp.Description,
+			Met:         exp.Met,
+			Message:     exp.Message,
+		}
+		if exp.Met {
+			e.MetAfter = roundDuration(exp.MetAfter)
+		}
+		sc.Expectations = append(sc.Expectations, e)
+	}
+	for _, h := range res.Agents {
+		a := Agent{Name: h.Agent, ImageID: h.ImageID, Flaps: len(h.Flaps)}
+		if h.TimeToReady > 0 {
+			a.TimeToReady = roundDuration(h.TimeToReady)
+		}
+		sc.Agents = append(sc.Agents, a)
+	}
+	for _, c := range res.Churn {
+		sc.Churn = append(sc.Churn, Churn{Resource: c.Resource, Creates: c.Creates, Updates: c.Updates, Deletes: c.Deletes})
+	}
+	for _, d := range res.Denials {
+		sc.Denials = append(sc.Denials, Denial(d))
+	}
+	for _, x := range res.Evictions {
+		sc.Evictions = append(sc.Evictions, Eviction(x))
+	}
+	return sc
+}
@@ -0,0 +1,148 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/engine"
+	"github.com/aslakknutsen/kube-agents-test/pkg/runner"
+)
+
+// JUnitSuiteName names the test suite in JUnit reports.
+const JUnitSuiteName = "kube-agents-test"
+
+// JUnit writes a JUnit XML report to Path, with a test case per scenario,
+// for CI systems that display test results.
+type JUnit struct {
+	Path string
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name       string           `xml:"name,attr"`
+	ID         string           `xml:"id,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Skipped    int              `xml:"skipped,attr"`
+	Time       string           `xml:"time,attr"`
+	Timestamp  string           `xml:"timestamp,attr,omitempty"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Cases      []junitCase      `xml:"testcase"`
+}
+
+type junitProperties struct {
+	Items []junitProperty `xml:"property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Details string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+var _ runner.Reporter = (*JUnit)(nil)
+
+// ScenarioStarted does nothing.
+func (r *JUnit) ScenarioStarted(string, string) {}
+
+// ScenarioFinished does nothing; results are written with the suite.
+func (r *JUnit) ScenarioFinished(string, *engine.Result) {}
+
+// SuiteFinished writes the report.
+func (r *JUnit) SuiteFinished(suite *runner.SuiteResult) error {
+	js := junitSuite{Name: JUnitSuiteName, ID: suite.RunID}
+	var total time.Duration
+	for _, res := range suite.Results {
+		total += res.Duration
+		c := junitCase{
+			Name:      res.Scenario,
+			Classname: JUnitSuiteName,
+			Time:      seconds(res.Duration),
+			SystemOut: expectationLines(res),
+		}
+		switch status(res) {
+		case StatusSkipped:
+			js.Skipped++
+			c.Skipped = &junitSkipped{Message: res.SkipReason}
+		case StatusFailed:
+			js.Failures++
+			message, details := failure(res)
+			c.Failure = &junitFailure{Message: message, Details: details}
+		}
+		js.Cases = append(js.Cases, c)
+	}
+	js.Tests = len(js.Cases)
+	js.Time = seconds(total)
+	props := map[string]string{}
+	if f := suite.Fingerprint; f != nil {
+		props = f.Properties()
+	}
+	if len(suite.Results) > 0 {
+		js.Timestamp = suite.Results[0].StartedAt.UTC().Format(time.RFC3339)
+		// Dimensions set for the whole run are on every result.
+		maps.Copy(props, suite.Results[0].Dimensions)
+	}
+	if len(props) > 0 {
+		js.Properties = &junitProperties{}
+		for _, k := range slices.Sorted(maps.Keys(props)) {
+			js.Properties.Items = append(js.Properties.Items, junitProperty{Name: k, Value: props[k]})
+		}
+	}
+	out, err := xml.MarshalIndent(junitSuites{Suites: []junitSuite{js}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(r.Path, append([]byte(xml.Header), append(out, '\n')...))
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// expectationLines lists the outcome of each expectation of res, one per
+// line.
+func expectationLines(res *engine.Result) string {
+	var out string
+	for _, exp := range res.Expectations {
+		out += expectationLine(exp) + "\n"
+	}
+	return out
+}
+
+func expectationLine(exp engine.ExpectationResult) string {
+	subject := exp.Resource
+	if exp.ID != "" {
+		subject = exp.ID + " (" + exp.Resource + ")"
+	}
+	if exp.Step != "" {
+		subject = exp.Step + ": " + subject
+	}
+	if exp.Met {
+		return fmt.Sprintf("met      %s after %s", subject, roundDuration(exp.MetAfter))
+	}
+	return fmt.Sprintf("not met  %s: %s", subject, exp.Message)
+}
@@ -0,0 +1,118 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/engine"
+	"github.com/aslakknutsen/kube-agents-test/pkg/runner"
+)
+
+// Stdout is the Path that makes NDJSON write to standard output.
+const Stdout = "-"
+
+// NDJSON streams the suite's progress to Path as newline-delimited JSON,
+// one Record per line written as it happens, so log-based CI systems and
+// watchers need not wait for the suite to finish. Unlike the other file
+// reporters it writes from the first scenario on, truncating the file.
+type NDJSON struct {
+	// Path is the file to write; Stdout for standard output.
+	Path string
+
+	w   io.Writer
+	f   *os.File
+	err error
+}
+
+// Record is one line written by the NDJSON reporter. Type is
+// scenarioStarted, scenarioFinished or runFinished.
+type Record struct {
+	Type     runner.EventType `json:"type"`
+	RunID    string           `json:"runID"`
+	Time     time.Time        `json:"time"`
+	Scenario string           `json:"scenario,omitempty"`
+	// Result is the outcome, on scenarioFinished records.
+	Result *Scenario `json:"result,omitempty"`
+	// Passed, Failed and Skipped summarize the suite on runFinished
+	// records.
+	Passed  *bool `json:"passed,omitempty"`
+	Failed  int   `json:"failed,omitempty"`
+	Skipped int   `json:"skipped,omitempty"`
+}
+
+var _ runner.Reporter = (*NDJSON)(nil)
+
+// ScenarioStarted writes a scenarioStarted record.
+func (r *NDJSON) ScenarioStarted(runID, scenario string) {
+	r.write(Record{Type: runner.EventScenarioStarted, RunID: runID, Time: time.Now(), Scenario: scenario})
+}
+
+// ScenarioFinished writes a scenarioFinished record with the scenario's
+// outcome.
+func (r *NDJSON) ScenarioFinished(runID string, res *engine.Result) {
+	sc := NewScenario(res)
+	r.write(Record{Type: runner.EventScenarioFinished, RunID: runID, Time: time.Now(), Scenario: res.Scenario, Result: &sc})
+}
+
+// SuiteFinished writes a runFinished record and closes the file. It
+// returns the first error writing any record.
+func (r *NDJSON) SuiteFinished(suite *runner.SuiteResult) error {
+	passed := suite.Passed()
+	skipped := len(suite.Skipped())
+	r.write(Record{
+		Type:    runner.EventRunFinished,
+		RunID:   suite.RunID,
+		Time:    time.Now(),
+		Passed:  &passed,
+		Failed:  len(suite.Failed()) - skipped,
+		Skipped: skipped,
+	})
+	if r.f != nil {
+		if err := r.f.Close(); err != nil && r.err == nil {
+			r.err = err
+		}
+		r.f = nil
+	}
+	r.w = nil
+	err := r.err
+	r.err = nil
+	return err
+}
+
+// write writes rec as a line, opening the output first if needed. Once a
+// write fails, the rest are dropped.
+func (r *NDJSON) write(rec Record) {
+	if r.err != nil {
+		return
+	}
+	if r.w == nil {
+		if r.err = r.open(); r.err != nil {
+			return
+		}
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		r.err = err
+		return
+	}
+	_, r.err = r.w.Write(append(line, '\n'))
+}
+
+func (r *NDJSON) open() error {
+	if r.Path == Stdout {
+		r.w = os.Stdout
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(r.Path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(r.Path)
+	if err != nil {
+		return err
+	}
+	r.f, r.w = f, f
+	return nil
+}
@@ -0,0 +1,56 @@
+// Package report provides runner.Reporter implementations that render
+// suite results for go test, CI systems, scripts and people:
+//
+//	runner.New(eng, runner.WithReporter(&report.JUnit{Path: "junit.xml"}))
+//
+// The file reporters write their file once the suite is finished, except
+// NDJSON, which streams records as scenarios start and finish.
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/engine"
+)
+
+// Status values of a scenario, as rendered by the reporters.
+const (
+	StatusPassed  = "passed"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+)
+
+// status returns the Status value of res.
+func status(res *engine.Result) string {
+	switch {
+	case res.Skipped:
+		return StatusSkipped
+	case !res.Passed:
+		return StatusFailed
+	}
+	return StatusPassed
+}
+
+// failure returns the message and details of a failed result: its error
+// and the diagnostics report, if any.
+func failure(res *engine.Result) (message, details string) {
+	message = res.Error
+	if res.Report != nil {
+		details = res.Report.String()
+	}
+	return message, details
+}
+
+func roundDuration(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
+
+// writeFile writes data to path, creating its directory.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
@@ -0,0 +1,54 @@
+package report
+
+import (
+	"github.com/aslakknutsen/kube-agents-test/pkg/engine"
+	"github.com/aslakknutsen/kube-agents-test/pkg/runner"
+)
+
+// T is the subset of testing.TB the Testing reporter uses.
+type T interface {
+	Helper()
+	Logf(format string, args ...any)
+	Errorf(format string, args ...any)
+}
+
+// Testing reports through a Go test: progress and skips are logged, and
+// each failed scenario fails the test with its error and diagnostics.
+type Testing struct {
+	T T
+}
+
+var _ runner.Reporter = (*Testing)(nil)
+
+// ScenarioStarted logs the scenario's start.
+func (r *Testing) ScenarioStarted(runID, scenario string) {
+	r.T.Helper()
+	r.T.Logf("running scenario %s (run %s)", scenario, runID)
+}
+
+// ScenarioFinished logs or fails the scenario's outcome.
+func (r *Testing) ScenarioFinished(_ string, res *engine.Result) {
+	r.T.Helper()
+	switch status(res) {
+	case StatusSkipped:
+		r.T.Logf("SKIP  %s: %s", res.Scenario, res.SkipReason)
+	case StatusFailed:
+		message, details := failure(res)
+		if details != "" {
+			r.T.Errorf("FAIL  %s (%s): %s\n%s", res.Scenario, roundDuration(res.Duration), message, details)
+		} else {
+			r.T.Errorf("FAIL  %s (%s): %s", res.Scenario, roundDuration(res.Duration), message)
+		}
+	default:
+		r.T.Logf("PASS  %s (%s)", res.Scenario, roundDuration(res.Duration))
+	}
+}
+
+// SuiteFinished logs a summary of the run.
+func (r *Testing) SuiteFinished(suite *runner.SuiteResult) error {
+	r.T.Helper()
+	skipped := len(suite.Skipped())
+	r.T.Logf("run %s: %d scenarios, %d failed, %d skipped",
+		suite.RunID, len(suite.Results), len(suite.Failed())-skipped, skipped)
+	return nil
+}
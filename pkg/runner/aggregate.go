@@ -0,0 +1,76 @@
+package runner
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/engine"
+)
+
+// Tally counts the outcomes of the results sharing one value of a
+// dimension.
+type Tally struct {
+	Dimension string
+	Value     string
+	Passed    int
+	Failed    int
+	Skipped   int
+	// FailedScenarios names the scenarios counted in Failed.
+	FailedScenarios []string
+}
+
+// DimensionTallies holds the tallies of every value of one dimension.
+type DimensionTallies struct {
+	Dimension string
+	Values    []Tally
+}
+
+// Failing reports whether any value of the dimension has failures.
+func (d DimensionTallies) Failing() bool {
+	for _, t := range d.Values {
+		if t.Failed > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Aggregate tallies results per value of each of their dimensions, so a
+// failure confined to one Kubernetes version, agent image, or parameter
+// value stands out. Results may come from several runs, e.g. the cells of
+// a matrix. Dimensions and values are sorted by name.
+func Aggregate(results []*engine.Result) []DimensionTallies {
+	tallies := map[string]map[string]*Tally{}
+	for _, res := range results {
+		for dim, value := range res.Dimensions {
+			if tallies[dim] == nil {
+				tallies[dim] = map[string]*Tally{}
+			}
+			t := tallies[dim][value]
+			if t == nil {
+				t = &Tally{Dimension: dim, Value: value}
+				tallies[dim][value] = t
+			}
+			switch {
+			case res.Skipped:
+				t.Skipped++
+			case res.Passed:
+				t.Passed++
+			default:
+				t.Failed++
+				t.FailedScenarios = append(t.FailedScenarios, res.Scenario)
+			}
+		}
+	}
+	out := make([]DimensionTallies, 0, len(tallies))
+	for dim, values := range tallies {
+		d := DimensionTallies{Dimension: dim}
+		for _, t := range values {
+			d.Values = append(d.Values, *t)
+		}
+		slices.SortFunc(d.Values, func(a, b Tally) int { return cmp.Compare(a.Value, b.Value) })
+		out = append(out, d)
+	}
+	slices.SortFunc(out, func(a, b DimensionTallies) int { return cmp.Compare(a.Dimension, b.Dimension) })
+	return out
+}
@@ -0,0 +1,187 @@
+package runner
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/artifacts"
+	"github.com/aslakknutsen/kube-agents-test/pkg/engine"
+)
+
+// resultFile is the on-disk form of a Result; diagnostics are written as
+// separate files next to it.
+type resultFile struct {
+	Scenario    string            `json:"scenario"`
+	Passed      bool              `json:"passed"`
+	Skipped     bool              `json:"skipped,omitempty"`
+	SkipReason  string            `json:"skipReason,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	StartedAt   time.Time         `json:"startedAt"`
+	Duration    string            `json:"duration"`
+	AgentImages map[string]string `json:"agentImages,omitempty"`
+	// AgentImageIDs are the images by digest, as the agents' pods ran
+	// them.
+	AgentImageIDs map[string]string `json:"agentImageIDs,omitempty"`
+	Dimensions    map[string]string `json:"dimensions,omitempty"`
+	Tenants       []tenantFile      `json:"tenants,omitempty"`
+	Load          *loadFile         `json:"load,omitempty"`
+}
+
+type tenantFile struct {
+	Namespace string `json:"namespace"`
+	Converged bool   `json:"converged"`
+	Latency   string `json:"latency"`
+	Error     string `json:"error,omitempty"`
+}
+
+type loadFile struct {
+	Arrivals     int      `json:"arrivals"`
+	Converged    int      `json:"converged"`
+	CreateErrors int      `json:"createErrors"`
+	TimedOut     int      `json:"timedOut"`
+	ErrorRate    float64  `json:"errorRate"`
+	Throughput   float64  `json:"throughput"`
+	Elapsed      string   `json:"elapsed"`
+	P50          string   `json:"p50"`
+	P90          string   `json:"p90"`
+	P99          string   `json:"p99"`
+	Max          string   `json:"max"`
+	Errors       []string `json:"errors,omitempty"`
+}
+
+// writeArtifacts stores a scenario's result and diagnostics under its
+// artifact directory.
+func writeArtifacts(run *artifacts.Run, res *engine.Result) error {
+	outcome := artifacts.Passed
+	switch {
+	case res.Skipped:
+		outcome = artifacts.Skipped
+	case !res.Passed:
+		outcome = artifacts.Failed
+	}
+	run.SetOutcome(res.Scenario, outcome)
+
+	var tenants []tenantFile
+	for _, t := range res.Tenants {
+		tenants = append(tenants, tenantFile{
+			Namespace: t.Namespace,
+			Converged: t.Converged,
+			Latency:   t.Latency.String(),
+			Error:     t.Error,
+		})
+	}
+	var imageIDs map[string]string
+	for _, h := range res.Agents {
+		if h.ImageID == "" {
+			continue
+		}
+		if imageIDs == nil {
+			imageIDs = map[string]string{}
+		}
+		imageIDs[h.Agent] = h.ImageID
+	}
+	var load *loadFile
+	if l := res.Load; l != nil {
+		load = &loadFile{
+			Arrivals:     l.Arrivals,
+			Converged:    l.Converged(),
+			CreateErrors: l.CreateErrors,
+			TimedOut:     l.TimedOut,
+			ErrorRate:    l.ErrorRate(),
+			Throughput:   l.Throughput(),
+			Elapsed:      l.Elapsed.String(),
+			P50:          l.Percentile(50).String(),
+			P90:          l.Percentile(90).String(),
+			P99:          l.Percentile(99).String(),
+			Max:          l.Percentile(100).String(),
+			Errors:       l.Errors,
+		}
+	}
+	data, err := json.MarshalIndent(resultFile{
+		Scenario:      res.Scenario,
+		Passed:        res.Passed,
+		Skipped:       res.Skipped,
+		SkipReason:    res.SkipReason,
+		Error:         res.Error,
+		StartedAt:     res.StartedAt,
+		Duration:      res.Duration.String(),
+		AgentImages:   res.AgentImages,
+		AgentImageIDs: imageIDs,
+		Dimensions:    res.Dimensions,
+		Tenants:       tenants,
+		Load:          load,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := run.WriteFile(res.Scenario, "result.json", append(data, '\n')); err != nil {
+		return err
+	}
+
+	if res.Report == nil {
+		return nil
+	}
+	if err := moveLogs(run, res); err != nil {
+		return err
+	}
+	_, err = run.WriteFile(res.Scenario, "report.txt", []byte(res.Report.String()))
+	return err
+}
+
+// moveLogs moves the collector's log segments into the scenario's artifact
+// directory and points the report at their new location.
+func moveLogs(run *artifacts.Run, res *engine.Result) error {
+	if len(res.Report.Logs) == 0 {
+		return nil
+	}
+	dir, err := run.ScenarioDir(res.Scenario)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "logs"), 0o755); err != nil {
+		return err
+	}
+	for agent, ref := range res.Report.Logs {
+		moved := make([]string, 0, len(ref.Files))
+		for _, src := range ref.Files {
+			name := "logs/" + filepath.Base(src)
+			dst := filepath.Join(dir, filepath.FromSlash(name))
+			if err := moveFile(src, dst); err != nil {
+				return err
+			}
+			run.AddFile(res.Scenario, name)
+			moved = append(moved, dst)
+		}
+		ref.Files = moved
+		res.Report.Logs[agent] = ref
+	}
+	return nil
+}
+
+// moveFile renames src to dst, copying when they are on different
+// filesystems.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
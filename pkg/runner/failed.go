@@ -0,0 +1,59 @@
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// RerunFailedEnv enables rerun-only-failed mode when set to a true value
+// ("1", "true").
+const RerunFailedEnv = "KUBE_AGENTS_TEST_RERUN_FAILED"
+
+const failedFile = "last-failed.json"
+
+// Failed is the persisted list of scenarios that failed in a run.
+type Failed struct {
+	RunID     string   `json:"runId"`
+	Scenarios []string `json:"scenarios"`
+}
+
+// SaveFailed writes the failed list into stateDir, replacing any previous one.
+func SaveFailed(stateDir string, f Failed) error {
+	if err := os.MkdirAll(stateDir, 0o755); err != nil {
+		return fmt.Errorf("creating state directory: %w", err)
+	}
+	if f.Scenarios == nil {
+		f.Scenarios = []string{}
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(stateDir, failedFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing failed list: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadFailed reads the failed list from stateDir. It returns nil without an
+// error when no run has been recorded yet.
+func LoadFailed(stateDir string) (*Failed, error) {
+	data, err := os.ReadFile(filepath.Join(stateDir, failedFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading failed list: %w", err)
+	}
+	var f Failed
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing failed list: %w", err)
+	}
+	return &f, nil
+}
@@ -0,0 +1,459 @@
+// Package runner executes a suite of scenarios: it selects which scenarios
+// to run, runs them one by one through an Executor, and records the outcome.
+package runner
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/agent"
+	"github.com/aslakknutsen/kube-agents-test/pkg/artifacts"
+	"github.com/aslakknutsen/kube-agents-test/pkg/engine"
+	"github.com/aslakknutsen/kube-agents-test/pkg/fingerprint"
+	"github.com/aslakknutsen/kube-agents-test/pkg/history"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// DefaultStateDir holds state kept between runs, such as the failed list.
+const DefaultStateDir = ".kube-agents-test"
+
+// Executor runs a single scenario. *engine.Engine implements it.
+type Executor interface {
+	Run(ctx context.Context, s *scenario.Scenario) *engine.Result
+}
+
+// Compiler is implemented by executors that can preprocess scenarios up
+// front. The runner compiles the whole suite before running any scenario,
+// so broken scenarios fail fast.
+type Compiler interface {
+	Compile(scenarios ...*scenario.Scenario) error
+}
+
+// Runner runs suites of scenarios.
+type Runner struct {
+	exec        Executor
+	history     *history.Store
+	stateDir    string
+	rerunFailed bool
+	runID       string
+	log         *slog.Logger
+
+	shardIndex    int
+	shardTotal    int
+	weightedShard bool
+
+	artifactsRoot string
+	fingerprint   func(ctx context.Context, dirs []string) (*fingerprint.Fingerprint, error)
+	observers     []func(Event)
+	reporters     []Reporter
+	dimensions    map[string]string
+}
+
+// Reporter renders the results of a suite run in some output format. Its
+// methods are called synchronously from the goroutine running the suite.
+// Skipped scenarios are finished without being started. See package
+// report for the built-in reporters.
+type Reporter interface {
+	ScenarioStarted(runID, scenario string)
+	ScenarioFinished(runID string, res *engine.Result)
+	// SuiteFinished is called once the suite is done, including when it
+	// is interrupted, with the results so far.
+	SuiteFinished(suite *SuiteResult) error
+}
+
+// Event reports the progress of a suite run to an observer.
+type Event struct {
+	Type     EventType `json:"type"`
+	RunID    string    `json:"runID"`
+	Time     time.Time `json:"time"`
+	Scenario string    `json:"scenario,omitempty"`
+	// Result is set on EventScenarioFinished.
+	Result *engine.Result `json:"-"`
+}
+
+// EventType distinguishes Events.
+type EventType string
+
+// Event types, in the order a run emits them.
+const (
+	EventRunStarted       EventType = "runStarted"
+	EventScenarioStarted  EventType = "scenarioStarted"
+	EventScenarioFinished EventType = "scenarioFinished"
+	EventRunFinished      EventType = "runFinished"
+)
+
+// Option configures a Runner.
+type Option func(*Runner)
+
+// WithHistory records every result in store.
+func WithHistory(store *history.Store) Option {
+	return func(r *Runner) { r.history = store }
+}
+
+// WithStateDir sets where state shared between runs is kept.
+func WithStateDir(dir string) Option {
+	return func(r *Runner) { r.stateDir = dir }
+}
+
+// WithRerunFailed restricts the suite to the scenarios that failed in the
+// previous run.
+func WithRerunFailed(enabled bool) Option {
+	return func(r *Runner) { r.rerunFailed = enabled }
+}
+
+// WithShard runs only the scenarios of shard index (0-based) out of total.
+// See Shard for how scenarios are partitioned.
+func WithShard(index, total int) Option {
+	return func(r *Runner) {
+		r.shardIndex = index
+		r.shardTotal = total
+	}
+}
+
+// WithWeightedShards balances shards by the scenario durations recorded in
+// the history store configured with WithHistory. Every shard must read the
+// same history for the partition to be consistent.
+func WithWeightedShards(enabled bool) Option {
+	return func(r *Runner) { r.weightedShard = enabled }
+}
+
+// WithArtifacts writes each scenario's result and diagnostics to
+// <root>/<run-id>/<scenario>/ and an index.json per run.
+func WithArtifacts(root string) Option {
+	return func(r *Runner) { r.artifactsRoot = root }
+}
+
+// WithFingerprint captures the environment of each run with capture,
+// given the directories the suite's scenarios were loaded from, and
+// attaches it to the SuiteResult and the artifact index. What capture
+// reports it could not capture is logged.
+func WithFingerprint(capture func(ctx context.Context, dirs []string) (*fingerprint.Fingerprint, error)) Option {
+	return func(r *Runner) { r.fingerprint = capture }
+}
+
+// WithRunID overrides the generated run ID.
+func WithRunID(id string) Option {
+	return func(r *Runner) { r.runID = id }
+}
+
+// WithDimensions labels every result of the run with dimensions, such as
+// the parameter values of a CI matrix cell, in addition to those the
+// executor sets. See Aggregate.
+func WithDimensions(dims map[string]string) Option {
+	return func(r *Runner) { r.dimensions = dims }
+}
+
+// WithLogger sets the logger for progress messages.
+func WithLogger(l *slog.Logger) Option {
+	return func(r *Runner) { r.log = l }
+}
+
+// WithObserver calls fn with every progress Event, synchronously from the
+// goroutine running the suite. Observers are called in the order added.
+func WithObserver(fn func(Event)) Option {
+	return func(r *Runner) { r.observers = append(r.observers, fn) }
+}
+
+// WithReporter adds a Reporter of the run's results. Reporters are called
+// in the order added.
+func WithReporter(rep Reporter) Option {
+	return func(r *Runner) { r.reporters = append(r.reporters, rep) }
+}
+
+// New returns a Runner that executes scenarios with exec.
+func New(exec Executor, opts ...Option) *Runner {
+	r := &Runner{
+		exec:     exec,
+		stateDir: DefaultStateDir,
+		log:      slog.New(slog.DiscardHandler),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.runID == "" {
+		r.runID = NewRunID()
+	}
+	return r
+}
+
+// RunID returns the ID of the run this Runner records results under.
+func (r *Runner) RunID() string {
+	return r.runID
+}
+
+// SuiteResult is the outcome of a suite run.
+type SuiteResult struct {
+	RunID   string
+	Results []*engine.Result
+	// ArtifactsDir is the run's artifact directory, if artifacts are
+	// written.
+	ArtifactsDir string
+	// Fingerprint is the environment the run executed in, if captured;
+	// see WithFingerprint.
+	Fingerprint *fingerprint.Fingerprint
+}
+
+// Passed reports whether every scenario passed.
+func (s *SuiteResult) Passed() bool {
+	return len(s.Failed()) == 0
+}
+
+// Failed returns the names of the scenarios that did not pass, including
+// skipped ones.
+func (s *SuiteResult) Failed() []string {
+	var names []string
+	for _, res := range s.Results {
+		if !res.Passed {
+			names = append(names, res.Scenario)
+		}
+	}
+	return names
+}
+
+// Skipped returns the results of scenarios that did not run.
+func (s *SuiteResult) Skipped() []*engine.Result {
+	var skipped []*engine.Result
+	for _, res := range s.Results {
+		if res.Skipped {
+			skipped = append(skipped, res)
+		}
+	}
+	return skipped
+}
+
+// RunSuite runs scenarios in dependency order, skipping scenarios whose
+// dependencies did not pass. It persists the failed list and records results
+// in the history store when one is configured. The returned error covers
+// ordering, bookkeeping and reporting failures only; scenario failures are
+// in the results.
+func (r *Runner) RunSuite(ctx context.Context, scenarios []*scenario.Scenario) (_ *SuiteResult, err error) {
+	// Shard before anything else so a shard's scenario set does not depend
+	// on local state such as the failed list.
+	if r.shardTotal > 0 {
+		sharded, err := r.shard(scenarios)
+		if err != nil {
+			return nil, err
+		}
+		scenarios = sharded
+	}
+	if r.rerunFailed {
+		selected, err := r.selectFailed(scenarios)
+		if err != nil {
+			return nil, err
+		}
+		scenarios = selected
+	}
+	ordered, err := scenario.Order(scenarios)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := r.exec.(Compiler); ok {
+		if err := c.Compile(ordered...); err != nil {
+			return nil, fmt.Errorf("compiling scenarios: %w", err)
+		}
+	}
+
+	var run *artifacts.Run
+	if r.artifactsRoot != "" {
+		run, err = artifacts.NewRun(r.artifactsRoot, r.runID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	suite := &SuiteResult{RunID: r.runID}
+	if r.fingerprint != nil {
+		fp, err := r.fingerprint(ctx, scenarioDirs(ordered))
+		if err != nil {
+			r.log.Warn("capturing run fingerprint", "error", err)
+		}
+		suite.Fingerprint = fp
+	}
+	if run != nil {
+		suite.ArtifactsDir = run.Dir()
+		run.SetFingerprint(suite.Fingerprint)
+	}
+	defer func() {
+		for _, rep := range r.reporters {
+			if repErr := rep.SuiteFinished(suite); repErr != nil {
+				err = errors.Join(err, fmt.Errorf("reporting results: %w", repErr))
+			}
+		}
+	}()
+	r.emit(Event{Type: EventRunStarted})
+	defer r.emit(Event{Type: EventRunFinished})
+	passed := map[string]bool{}
+	for _, s := range ordered {
+		if err := ctx.Err(); err != nil {
+			return suite, err
+		}
+		if reason := skipReason(s, passed); reason != "" {
+			r.log.Info("skipping scenario", "scenario", s.Name, "reason", reason)
+			r.record(suite, run, &engine.Result{
+				Scenario:   s.Name,
+				Skipped:    true,
+				SkipReason: reason,
+				StartedAt:  time.Now(),
+			})
+			continue
+		}
+		r.log.Info("running scenario", "scenario", s.Name, "run", r.runID)
+		r.emit(Event{Type: EventScenarioStarted, Scenario: s.Name})
+		for _, rep := range r.reporters {
+			rep.ScenarioStarted(r.runID, s.Name)
+		}
+		res := r.exec.Run(agent.ContextWithRunID(ctx, r.runID), s)
+		passed[s.Name] = res.Passed
+		r.record(suite, run, res)
+	}
+
+	if run != nil {
+		if err := run.WriteIndex(); err != nil {
+			return suite, fmt.Errorf("writing artifact index: %w", err)
+		}
+	}
+
+	if err := SaveFailed(r.stateDir, Failed{RunID: r.runID, Scenarios: suite.Failed()}); err != nil {
+		return suite, err
+	}
+	if r.history != nil {
+		if err := r.history.Append(records(r.runID, suite.Results)...); err != nil {
+			return suite, fmt.Errorf("recording history: %w", err)
+		}
+	}
+	return suite, nil
+}
+
+// record adds res to the suite and writes its artifacts. Artifact failures
+// are logged, not fatal: the run itself is still valid.
+func (r *Runner) record(suite *SuiteResult, run *artifacts.Run, res *engine.Result) {
+	if len(r.dimensions) > 0 {
+		if res.Dimensions == nil {
+			res.Dimensions = map[string]string{}
+		}
+		maps.Copy(res.Dimensions, r.dimensions)
+	}
+	suite.Results = append(suite.Results, res)
+	r.emit(Event{Type: EventScenarioFinished, Scenario: res.Scenario, Result: res})
+	for _, rep := range r.reporters {
+		rep.ScenarioFinished(r.runID, res)
+	}
+	if run == nil {
+		return
+	}
+	if err := writeArtifacts(run, res); err != nil {
+		r.log.Warn("writing artifacts", "scenario", res.Scenario, "error", err)
+	}
+}
+
+func (r *Runner) emit(e Event) {
+	e.RunID = r.runID
+	e.Time = time.Now()
+	for _, fn := range r.observers {
+		fn(e)
+	}
+}
+
+func (r *Runner) selectFailed(scenarios []*scenario.Scenario) ([]*scenario.Scenario, error) {
+	failed, err := LoadFailed(r.stateDir)
+	if err != nil {
+		return nil, err
+	}
+	if failed == nil {
+		r.log.Warn("no previous run recorded, running all scenarios")
+		return scenarios, nil
+	}
+	names := map[string]bool{}
+	for _, n := range failed.Scenarios {
+		names[n] = true
+	}
+	var selected []*scenario.Scenario
+	for _, s := range scenarios {
+		if names[s.Name] {
+			selected = append(selected, s)
+		}
+	}
+	r.log.Info("rerunning failed scenarios", "previousRun", failed.RunID, "count", len(selected))
+	// Dependencies run again too: the failed scenarios may rely on the
+	// state they create.
+	return scenario.WithDependencies(selected, scenarios), nil
+}
+
+func (r *Runner) shard(scenarios []*scenario.Scenario) ([]*scenario.Scenario, error) {
+	var weights map[string]time.Duration
+	if r.weightedShard {
+		if r.history == nil {
+			return nil, errors.New("weighted shards need a history store")
+		}
+		w, err := DurationWeights(r.history, scenarios)
+		if err != nil {
+			return nil, err
+		}
+		weights = w
+	}
+	sharded, err := Shard(scenarios, r.shardIndex, r.shardTotal, weights)
+	if err != nil {
+		return nil, err
+	}
+	r.log.Info("running shard", "index", r.shardIndex, "total", r.shardTotal, "scenarios", len(sharded))
+	return sharded, nil
+}
+
+// skipReason explains why s cannot run given the outcomes so far, or returns
+// "" when all of its dependencies passed.
+func skipReason(s *scenario.Scenario, passed map[string]bool) string {
+	for _, dep := range s.DependsOn {
+		if !passed[dep] {
+			return fmt.Sprintf("dependency %q did not pass", dep)
+		}
+	}
+	return ""
+}
+
+// scenarioDirs returns the distinct directories scenarios were loaded from.
+func scenarioDirs(scenarios []*scenario.Scenario) []string {
+	var dirs []string
+	for _, s := range scenarios {
+		if s.Dir != "" && !slices.Contains(dirs, s.Dir) {
+			dirs = append(dirs, s.Dir)
+		}
+	}
+	return dirs
+}
+
+// records converts results to history records. Skipped scenarios are left
+// out so they do not skew pass rates.
+func records(runID string, results []*engine.Result) []history.Record {
+	var out []history.Record
+	for _, res := range results {
+		if res.Skipped {
+			continue
+		}
+		out = append(out, history.Record{
+			RunID:         runID,
+			Scenario:      res.Scenario,
+			AgentVersions: res.AgentImages,
+			Dimensions:    res.Dimensions,
+			Passed:        res.Passed,
+			Duration:      res.Duration,
+			StartedAt:     res.StartedAt,
+			Error:         res.Error,
+		})
+	}
+	return out
+}
+
+// NewRunID returns a sortable, unique run identifier such as
+// 20260102-150405-1a2b3c.
+func NewRunID() string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
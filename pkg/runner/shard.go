@@ -0,0 +1,136 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/history"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// defaultWeight is assumed for scenarios without recorded durations.
+const defaultWeight = time.Minute
+
+// Shard returns the scenarios assigned to shard index (0-based) out of
+// total. Scenarios linked by dependsOn always land in the same shard. The
+// partition depends only on the scenario set and weights, so parallel CI
+// jobs given the same inputs agree on it without coordination.
+//
+// Without weights, dependency groups are distributed round-robin in name
+// order. With weights (expected scenario durations), groups are assigned
+// heaviest first to the currently lightest shard.
+func Shard(scenarios []*scenario.Scenario, index, total int, weights map[string]time.Duration) ([]*scenario.Scenario, error) {
+	if total < 1 || index < 0 || index >= total {
+		return nil, fmt.Errorf("invalid shard %d/%d", index, total)
+	}
+	if total == 1 {
+		return scenarios, nil
+	}
+
+	groups := dependencyGroups(scenarios)
+	assigned := make([]int, len(groups))
+	if len(weights) == 0 {
+		for i := range groups {
+			assigned[i] = i % total
+		}
+	} else {
+		groupWeight := make([]time.Duration, len(groups))
+		for i, g := range groups {
+			for _, s := range g {
+				w, ok := weights[s.Name]
+				if !ok {
+					w = defaultWeight
+				}
+				groupWeight[i] += w
+			}
+		}
+		byWeight := make([]int, len(groups))
+		for i := range byWeight {
+			byWeight[i] = i
+		}
+		sort.SliceStable(byWeight, func(a, b int) bool {
+			return groupWeight[byWeight[a]] > groupWeight[byWeight[b]]
+		})
+		load := make([]time.Duration, total)
+		for _, g := range byWeight {
+			lightest := 0
+			for s := 1; s < total; s++ {
+				if load[s] < load[lightest] {
+					lightest = s
+				}
+			}
+			assigned[g] = lightest
+			load[lightest] += groupWeight[g]
+		}
+	}
+
+	mine := map[string]bool{}
+	for i, g := range groups {
+		if assigned[i] == index {
+			for _, s := range g {
+				mine[s.Name] = true
+			}
+		}
+	}
+	var out []*scenario.Scenario
+	for _, s := range scenarios {
+		if mine[s.Name] {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+// DurationWeights returns the mean duration of recent passing runs of each
+// scenario, for use as Shard weights.
+func DurationWeights(store *history.Store, scenarios []*scenario.Scenario) (map[string]time.Duration, error) {
+	weights := map[string]time.Duration{}
+	for _, s := range scenarios {
+		stats, err := store.Durations(history.Filter{Scenario: s.Name, Passed: true, Last: 20})
+		if err != nil {
+			return nil, err
+		}
+		if stats.Count > 0 {
+			weights[s.Name] = stats.Mean
+		}
+	}
+	return weights, nil
+}
+
+// dependencyGroups splits scenarios into the connected components of the
+// dependsOn graph. Groups are sorted by their first scenario name.
+func dependencyGroups(scenarios []*scenario.Scenario) [][]*scenario.Scenario {
+	parent := map[string]string{}
+	var find func(string) string
+	find = func(n string) string {
+		if parent[n] == n {
+			return n
+		}
+		parent[n] = find(parent[n])
+		return parent[n]
+	}
+	for _, s := range scenarios {
+		parent[s.Name] = s.Name
+	}
+	for _, s := range scenarios {
+		for _, dep := range s.DependsOn {
+			if _, ok := parent[dep]; ok {
+				parent[find(s.Name)] = find(dep)
+			}
+		}
+	}
+
+	byRoot := map[string][]*scenario.Scenario{}
+	for _, s := range scenarios {
+		root := find(s.Name)
+		byRoot[root] = append(byRoot[root], s)
+	}
+	groups := make([][]*scenario.Scenario, 0, len(byRoot))
+	for _, g := range byRoot {
+		sort.Slice(g, func(i, j int) bool { return g[i].Name < g[j].Name })
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i][0].Name < groups[j][0].Name })
+	return groups
+}
@@ -0,0 +1,183 @@
+package runner
+
+import (
+	"maps"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/history"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+func scenarios(deps map[string][]string, names ...string) []*scenario.Scenario {
+	var out []*scenario.Scenario
+	for _, n := range names {
+		out = append(out, &scenario.Scenario{Name: n, DependsOn: deps[n]})
+	}
+	return out
+}
+
+func names(scenarios []*scenario.Scenario) []string {
+	out := []string{}
+	for _, s := range scenarios {
+		out = append(out, s.Name)
+	}
+	return out
+}
+
+func TestDependencyGroups(t *testing.T) {
+	tests := []struct {
+		name      string
+		scenarios []*scenario.Scenario
+		want      [][]string
+	}{
+		{
+			name:      "independent scenarios are groups of one in name order",
+			scenarios: scenarios(nil, "c", "a", "b"),
+			want:      [][]string{{"a"}, {"b"}, {"c"}},
+		},
+		{
+			name:      "chain",
+			scenarios: scenarios(map[string][]string{"c": {"b"}, "b": {"a"}}, "c", "b", "a", "d"),
+			want:      [][]string{{"a", "b", "c"}, {"d"}},
+		},
+		{
+			name:      "shared dependency joins its dependents",
+			scenarios: scenarios(map[string][]string{"x": {"base"}, "y": {"base"}}, "x", "y", "base", "z"),
+			want:      [][]string{{"base", "x", "y"}, {"z"}},
+		},
+		{
+			name:      "dependencies outside the set are ignored",
+			scenarios: scenarios(map[string][]string{"a": {"missing"}, "b": {"missing"}}, "a", "b"),
+			want:      [][]string{{"a"}, {"b"}},
+		},
+		{
+			name: "empty",
+			want: [][]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := [][]string{}
+			for _, g := range dependencyGroups(tt.scenarios) {
+				got = append(got, names(g))
+			}
+			if !slices.EqualFunc(got, tt.want, slices.Equal[[]string]) {
+				t.Errorf("dependencyGroups() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShard(t *testing.T) {
+	deps := map[string][]string{"b": {"a"}, "c": {"b"}, "e": {"d"}}
+	all := scenarios(deps, "a", "b", "c", "d", "e", "f", "g", "h")
+	tests := []struct {
+		name    string
+		total   int
+		weights map[string]time.Duration
+		want    [][]string
+	}{
+		{
+			name:  "single shard takes everything",
+			total: 1,
+			want:  [][]string{{"a", "b", "c", "d", "e", "f", "g", "h"}},
+		},
+		{
+			name:  "round-robin over dependency groups",
+			total: 2,
+			want:  [][]string{{"a", "b", "c", "f", "h"}, {"d", "e", "g"}},
+		},
+		{
+			name:  "more shards than groups",
+			total: 6,
+			want:  [][]string{{"a", "b", "c"}, {"d", "e"}, {"f"}, {"g"}, {"h"}, {}},
+		},
+		{
+			name:  "heaviest group first to the lightest shard",
+			total: 2,
+			weights: map[string]time.Duration{
+				"a": time.Second, "b": time.Second, "c": time.Second,
+				"d": 10 * time.Second, "e": 10 * time.Second,
+				"f": time.Second, "g": time.Second, "h": time.Second,
+			},
+			want: [][]string{{"d", "e"}, {"a", "b", "c", "f", "g", "h"}},
+		},
+		{
+			name:    "unweighted scenarios count as the default weight",
+			total:   2,
+			weights: map[string]time.Duration{"f": 5 * time.Minute},
+			want:    [][]string{{"f", "g"}, {"a", "b", "c", "d", "e", "h"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shardOf := map[string]int{}
+			for i := range tt.total {
+				got, err := Shard(all, i, tt.total, tt.weights)
+				if err != nil {
+					t.Fatalf("Shard(%d/%d) error = %v", i, tt.total, err)
+				}
+				if !slices.Equal(names(got), tt.want[i]) {
+					t.Errorf("Shard(%d/%d) = %v, want %v", i, tt.total, names(got), tt.want[i])
+				}
+				for _, s := range got {
+					if prev, ok := shardOf[s.Name]; ok {
+						t.Errorf("%s is in shards %d and %d", s.Name, prev, i)
+					}
+					shardOf[s.Name] = i
+				}
+			}
+			for _, s := range all {
+				i, ok := shardOf[s.Name]
+				if !ok {
+					t.Errorf("%s is in no shard", s.Name)
+					continue
+				}
+				for _, dep := range s.DependsOn {
+					if shardOf[dep] != i {
+						t.Errorf("%s is in shard %d but its dependency %s in shard %d", s.Name, i, dep, shardOf[dep])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestShardInvalid(t *testing.T) {
+	for _, tt := range []struct{ index, total int }{{0, 0}, {-1, 2}, {2, 2}} {
+		if _, err := Shard(nil, tt.index, tt.total, nil); err == nil {
+			t.Errorf("Shard(%d/%d) succeeded, want an error", tt.index, tt.total)
+		}
+	}
+}
+
+func TestDurationWeights(t *testing.T) {
+	store, err := history.Open(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two passing runs of a, then more failures than the window holds.
+	t0 := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	var records []history.Record
+	for i := range 22 {
+		records = append(records, history.Record{
+			Scenario:  "a",
+			Passed:    i < 2,
+			Duration:  time.Duration(i+1) * time.Minute,
+			StartedAt: t0.Add(time.Duration(i) * time.Hour),
+		})
+	}
+	if err := store.Append(records...); err != nil {
+		t.Fatal(err)
+	}
+	got, err := DurationWeights(store, scenarios(nil, "a", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]time.Duration{"a": 90 * time.Second}; !maps.Equal(got, want) {
+		t.Errorf("DurationWeights() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,75 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// APIFault injects failures into the API requests of the scenario's agents
+// that match it. Faults only apply to agents the framework deploys, which
+// then reach the API server through the fault-injecting proxy (see package
+// apiproxy).
+type APIFault struct {
+	// Verbs selects requests by Kubernetes verb: get, list, watch, create,
+	// update, patch, delete, or deletecollection. Empty matches all.
+	Verbs []string `json:"verbs,omitempty"`
+	// Resources selects requests by resource, as "pods" (any group) or
+	// "deployments.apps". Subresource requests match their resource. Empty
+	// matches all, including non-resource requests.
+	Resources []string `json:"resources,omitempty"`
+
+	// Latency delays matching requests before they are forwarded.
+	Latency *metav1.Duration `json:"latency,omitempty"`
+	// Every fails every Nth matching request (1 fails all of them) with
+	// Status instead of forwarding it. Counting makes failures
+	// deterministic across runs.
+	Every int `json:"every,omitempty"`
+	// Status is the HTTP status of injected failures; 429 if unset.
+	Status int `json:"status,omitempty"`
+	// DropWatchAfter ends matching watches this long after they start, as
+	// if the connection dropped.
+	DropWatchAfter *metav1.Duration `json:"dropWatchAfter,omitempty"`
+}
+
+// Verbs an APIFault can select.
+var faultVerbs = []string{"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection"}
+
+// StatusOrDefault returns Status, falling back to 429 Too Many Requests.
+func (f *APIFault) StatusOrDefault() int {
+	if f.Status == 0 {
+		return http.StatusTooManyRequests
+	}
+	return f.Status
+}
+
+func (f *APIFault) validate() error {
+	var errs []error
+	for _, v := range f.Verbs {
+		if !slices.Contains(faultVerbs, v) {
+			errs = append(errs, fmt.Errorf("unknown verb %q", v))
+		}
+	}
+	if f.Latency == nil && f.Every == 0 && f.DropWatchAfter == nil {
+		errs = append(errs, errors.New("one of latency, every, or dropWatchAfter is required"))
+	}
+	if f.Latency != nil && f.Latency.Duration <= 0 {
+		errs = append(errs, errors.New("latency must be positive"))
+	}
+	if f.Every < 0 {
+		errs = append(errs, errors.New("every must not be negative"))
+	}
+	if f.Status != 0 && (f.Status < 400 || f.Status > 599) {
+		errs = append(errs, fmt.Errorf("status %d is not an HTTP error status", f.Status))
+	}
+	if f.Status != 0 && f.Every == 0 {
+		errs = append(errs, errors.New("status needs every"))
+	}
+	if f.DropWatchAfter != nil && f.DropWatchAfter.Duration <= 0 {
+		errs = append(errs, errors.New("dropWatchAfter must be positive"))
+	}
+	return errors.Join(errs...)
+}
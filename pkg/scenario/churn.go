@@ -0,0 +1,99 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ChurnLimit bounds how often each selected resource may be created,
+// updated, or deleted from the trigger until the expectations are met,
+// catching agents that thrash resources even when the end state is right.
+// Updates that only change status do not count, as controllers update
+// status on their own, nor do those that only change finalizers, owner
+// references or managed fields.
+type ChurnLimit struct {
+	Resources ResourceSelector `json:"resources"`
+	// MaxCreates, MaxUpdates and MaxDeletes bound the events of each
+	// resource; unset ones are not bounded.
+	MaxCreates *int `json:"maxCreates,omitempty"`
+	MaxUpdates *int `json:"maxUpdates,omitempty"`
+	MaxDeletes *int `json:"maxDeletes,omitempty"`
+	// Fields bound how numeric fields of each resource move over the same
+	// window, status updates included.
+	Fields []FieldBound `json:"fields,omitempty"`
+}
+
+func (c *ChurnLimit) validate() error {
+	var errs []error
+	if err := c.Resources.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("resources: %w", err))
+	}
+	if c.MaxCreates == nil && c.MaxUpdates == nil && c.MaxDeletes == nil && len(c.Fields) == 0 {
+		errs = append(errs, errors.New("one of maxCreates, maxUpdates, maxDeletes and fields is required"))
+	}
+	for _, max := range []struct {
+		field string
+		n     *int
+	}{{"maxCreates", c.MaxCreates}, {"maxUpdates", c.MaxUpdates}, {"maxDeletes", c.MaxDeletes}} {
+		if max.n != nil && *max.n < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative", max.field))
+		}
+	}
+	for i := range c.Fields {
+		if err := c.Fields[i].validate(); err != nil {
+			errs = append(errs, fmt.Errorf("fields[%d]: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FieldBound bounds the values a numeric field takes and how it moves
+// from one change to the next, e.g. replicas never above 10 and never
+// decreasing:
+//
+//	churn:
+//	- resources:
+//	    apiVersion: apps/v1
+//	    kind: Deployment
+//	    selector: {matchLabels: {app: web}}
+//	  fields:
+//	  - path: .spec.replicas
+//	    max: 10
+//	    never: decrease
+//
+// The value the field has when recording starts counts, so a field may not
+// start out of bounds either. Quantities such as "500m" compare by value;
+// a resource without the field is not checked until it has it.
+type FieldBound struct {
+	// Path is a dotted field path such as .spec.replicas.
+	Path string `json:"path"`
+	// Min and Max bound every value the field takes.
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+	// Never is increase or decrease: the direction the field must not
+	// move in.
+	Never string `json:"never,omitempty"`
+	// MaxStep bounds how far the field may move in a single change.
+	MaxStep *float64 `json:"maxStep,omitempty"`
+}
+
+func (f *FieldBound) validate() error {
+	var errs []error
+	if !strings.HasPrefix(f.Path, ".") {
+		errs = append(errs, errors.New("path must start with ."))
+	}
+	if f.Min == nil && f.Max == nil && f.Never == "" && f.MaxStep == nil {
+		errs = append(errs, errors.New("one of min, max, never and maxStep is required"))
+	}
+	if f.Min != nil && f.Max != nil && *f.Min > *f.Max {
+		errs = append(errs, fmt.Errorf("min %v is above max %v", *f.Min, *f.Max))
+	}
+	if f.Never != "" && f.Never != "increase" && f.Never != "decrease" {
+		errs = append(errs, fmt.Errorf("never: %q is neither increase nor decrease", f.Never))
+	}
+	if f.MaxStep != nil && *f.MaxStep < 0 {
+		errs = append(errs, errors.New("maxStep must not be negative"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,68 @@
+package scenario
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Count is how many resources the label selector of an expectation must
+// match, such as exactly 3 pods with app=worker after a scale-out. Operator
+// compares the number with Value; eq if unset.
+type Count struct {
+	Operator Operator `json:"operator,omitempty"`
+	Value    int      `json:"value"`
+}
+
+// countOperators are the operators a Count takes.
+var countOperators = []Operator{OperatorEq, OperatorNe, OperatorGt, OperatorGte, OperatorLt, OperatorLte}
+
+// count has Count's fields without its methods.
+type count Count
+
+// UnmarshalJSON decodes a count given as a number, the shorthand for eq,
+// or as an operator and value:
+//
+//	count: 3
+//	count: {operator: gte, value: 3}
+func (c *Count) UnmarshalJSON(data []byte) error {
+	*c = Count{}
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] != '{' {
+		return json.Unmarshal(data, &c.Value)
+	}
+	return strictUnmarshal(data, (*count)(c))
+}
+
+// Met reports whether n resources matching meets the count.
+func (c Count) Met(n int) bool {
+	met, _ := c.condition().Compare(c.Value, n, true)
+	return met
+}
+
+// Want describes the count expected, for output, such as 3 or ">= 3".
+func (c Count) Want() any {
+	return c.condition().Want(c.Value)
+}
+
+func (c Count) condition() Condition {
+	return Condition{Operator: c.Operator}
+}
+
+func (e Expectation) validateCount() error {
+	c := e.Count
+	switch {
+	case c == nil:
+		return nil
+	case e.Resource.LabelSelector == nil:
+		return errors.New("needs resource.labelSelector")
+	case e.Absent:
+		return errors.New("cannot be combined with absent")
+	case !slices.Contains(countOperators, c.condition().OperatorOrDefault()):
+		return fmt.Errorf("operator: %q is not one of %v", c.Operator, countOperators)
+	case c.Value < 0:
+		return errors.New("value must not be negative")
+	}
+	return nil
+}
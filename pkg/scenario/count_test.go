@@ -0,0 +1,90 @@
+package scenario
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCountUnmarshal(t *testing.T) {
+	tests := []struct {
+		data string
+		want Count
+		err  bool
+	}{
+		{data: "3", want: Count{Value: 3}},
+		{data: ` {"operator": "gte", "value": 2}`, want: Count{Operator: OperatorGte, Value: 2}},
+		{data: `{"value": 1}`, want: Count{Value: 1}},
+		{data: `{"value": 1, "extra": true}`, err: true},
+		{data: `"three"`, err: true},
+	}
+	for _, tt := range tests {
+		c := Count{Operator: OperatorLt, Value: 9}
+		err := json.Unmarshal([]byte(tt.data), &c)
+		if tt.err {
+			if err == nil {
+				t.Errorf("Unmarshal(%s) succeeded, want an error", tt.data)
+			}
+			continue
+		}
+		if err != nil || c != tt.want {
+			t.Errorf("Unmarshal(%s) = %+v, %v, want %+v", tt.data, c, err, tt.want)
+		}
+	}
+}
+
+func TestCountMet(t *testing.T) {
+	tests := []struct {
+		count Count
+		n     int
+		met   bool
+		want  any
+	}{
+		{count: Count{Value: 3}, n: 3, met: true, want: 3},
+		{count: Count{Value: 3}, n: 2, want: 3},
+		{count: Count{Operator: OperatorNe, Value: 0}, n: 1, met: true, want: "!= 0"},
+		{count: Count{Operator: OperatorGte, Value: 2}, n: 2, met: true, want: ">= 2"},
+		{count: Count{Operator: OperatorGt, Value: 2}, n: 2, want: "> 2"},
+		{count: Count{Operator: OperatorLte, Value: 1}, n: 0, met: true, want: "<= 1"},
+		{count: Count{Operator: OperatorLt, Value: 1}, n: 1, want: "< 1"},
+	}
+	for _, tt := range tests {
+		if got := tt.count.Met(tt.n); got != tt.met {
+			t.Errorf("%+v.Met(%d) = %v, want %v", tt.count, tt.n, got, tt.met)
+		}
+		if got := tt.count.Want(); got != tt.want {
+			t.Errorf("%+v.Want() = %v, want %v", tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestValidateCount(t *testing.T) {
+	pods := ResourceRef{APIVersion: "v1", Kind: "Pod", LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}}
+	tests := []struct {
+		name string
+		exp  Expectation
+		err  string
+	}{
+		{name: "count", exp: Expectation{Resource: pods, Count: &Count{Value: 0}}},
+		{name: "without a selector", exp: Expectation{Resource: ResourceRef{APIVersion: "v1", Kind: "Pod", Name: "web-1"}, Count: &Count{}}, err: "needs resource.labelSelector"},
+		{name: "with absent", exp: Expectation{Resource: pods, Count: &Count{}, Absent: true}, err: "cannot be combined with absent"},
+		{name: "other operator", exp: Expectation{Resource: pods, Count: &Count{Operator: OperatorRegex}}, err: `operator: "regex" is not one of`},
+		{name: "negative", exp: Expectation{Resource: pods, Count: &Count{Value: -1}}, err: "value must not be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.exp.validateCount()
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("validateCount() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("validateCount() = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
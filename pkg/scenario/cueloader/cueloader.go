@@ -0,0 +1,131 @@
+// Package cueloader loads scenarios defined in CUE, so large suites can use
+// CUE's typing, constraints, and comprehensions instead of repeating YAML.
+//
+// A CUE file or package declares its scenarios in a top-level scenarios
+// field, either as a list or as a struct keyed by scenario name:
+//
+//	scenarios: [Name=string]: {name: Name}
+//	scenarios: "scale-up": {
+//		timeout: "1m"
+//		expect: [...]
+//	}
+//
+// Each scenario is checked against the #Scenario schema and exported to the
+// same scenario.Scenario structs the YAML loader produces.
+package cueloader
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	cueerrors "cuelang.org/go/cue/errors"
+	"cuelang.org/go/cue/load"
+	"sigs.k8s.io/yaml"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+//go:embed schema.cue
+var schemaSource string
+
+// Ext is the file extension of CUE scenario files.
+const Ext = ".cue"
+
+// Load evaluates the CUE file, or the CUE package in the directory, at path
+// and returns the scenarios it declares, in declaration order.
+func Load(path string) ([]*scenario.Scenario, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	dir, args := filepath.Dir(path), []string{filepath.Base(path)}
+	if info.IsDir() {
+		dir, args = path, []string{"."}
+	}
+
+	ctx := cuecontext.New()
+	insts := load.Instances(args, &load.Config{Dir: dir})
+	if len(insts) != 1 {
+		return nil, fmt.Errorf("%s: expected one CUE instance, got %d", path, len(insts))
+	}
+	if err := insts[0].Err; err != nil {
+		return nil, fmt.Errorf("%s: %s", path, details(err))
+	}
+	root := ctx.BuildInstance(insts[0])
+	if err := root.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, details(err))
+	}
+	def := ctx.CompileString(schemaSource).LookupPath(cue.ParsePath("#Scenario"))
+	if err := def.Err(); err != nil {
+		return nil, fmt.Errorf("compiling scenario schema: %w", err)
+	}
+
+	list := root.LookupPath(cue.ParsePath("scenarios"))
+	if !list.Exists() {
+		return nil, fmt.Errorf("%s: no top-level scenarios field", path)
+	}
+	var values []cue.Value
+	switch list.IncompleteKind() {
+	case cue.ListKind:
+		it, err := list.List()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, details(err))
+		}
+		for it.Next() {
+			values = append(values, it.Value())
+		}
+	case cue.StructKind:
+		it, err := list.Fields()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, details(err))
+		}
+		for it.Next() {
+			values = append(values, it.Value())
+		}
+	default:
+		return nil, fmt.Errorf("%s: scenarios must be a list or a struct", path)
+	}
+
+	scenarios := make([]*scenario.Scenario, 0, len(values))
+	for _, v := range values {
+		s, err := export(def.Unify(v), dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		scenarios = append(scenarios, s)
+	}
+	return scenarios, nil
+}
+
+// export validates v and decodes it into a Scenario whose manifest paths
+// resolve relative to dir.
+func export(v cue.Value, dir string) (*scenario.Scenario, error) {
+	if err := v.Validate(cue.Concrete(true)); err != nil {
+		return nil, fmt.Errorf("%s", details(err))
+	}
+	data, err := v.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("%s", details(err))
+	}
+	var s scenario.Scenario
+	if err := yaml.UnmarshalStrict(data, &s); err != nil {
+		return nil, err
+	}
+	s.Dir = dir
+	if err := s.ExpandEnv(); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Name, err)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Name, err)
+	}
+	return &s, nil
+}
+
+// details renders CUE errors with their file positions.
+func details(err error) string {
+	return cueerrors.Details(err, nil)
+}
@@ -0,0 +1,365 @@
+// Schema of kube-agents-test scenarios. Keep in sync with the scenario
+// package's Go types.
+
+#Scenario: {
+	name:         string & !=""
+	description?: string
+	vars?: [string]: string
+	agents?: [...string]
+	dependsOn?: [...string]
+	namespace?: =~"^[a-z0-9]([-a-z0-9]*[a-z0-9])?$"
+	preflight?: {
+		minKubernetesVersion?: =~"^v?[0-9]+\\.[0-9]+(\\.[0-9]+)?$"
+		minNodes?:             int & >=0
+		agentsAbsent?: [...string & !=""]
+	}
+	setup?: {
+		manifests?: [...string]
+		generate?: [...#Generator]
+		controlNamespace?: =~"^[a-z0-9]([-a-z0-9]*[a-z0-9])?$"
+		quota?: {
+			name?: string & !=""
+			hard: [string]: #Quantity
+		}
+		limitRange?: {
+			name?: string & !=""
+			default?: [string]:        #Quantity
+			defaultRequest?: [string]: #Quantity
+			min?: [string]:            #Quantity
+			max?: [string]:            #Quantity
+		}
+		exports?: [...{
+			name:     =~"^[A-Za-z_][A-Za-z0-9_]*$"
+			resource: #ResourceRef
+			path:     string & !=""
+		}]
+		waitFor?: [...#Expectation]
+	}
+	trigger?: #Trigger | [...#Trigger]
+	expect: [...#Expectation]
+	expectEvents?: [...#EventExpectation]
+	expectMetrics?: [...{
+		id?:          string & !=""
+		description?: string & !=""
+		service?:     string & !=""
+		namespace?:   string
+		agent?:       string & !=""
+		port:         int & >0 & <=65535 | string & !=""
+		scheme?:      "http" | "https"
+		path?:        =~"^/"
+		expr:         string & !=""
+	}]
+	expectDenied?: [...{
+		id?:          string & !=""
+		description?: string & !=""
+		{
+			create: {
+				apiVersion: string & !=""
+				kind:       string & !=""
+				metadata: {
+					name:       string & !=""
+					namespace?: string
+					...
+				}
+				...
+			}
+		} | {
+			patch: {
+				#ResourceRef
+				spec: {...}
+			}
+		} | {
+			delete: #ResourceRef
+		}
+		message?: string & !=""
+		dryRun?:  bool
+	}]
+	expectEvictions?: [...{
+		id?:          string & !=""
+		description?: string & !=""
+		pod?:         string & !=""
+		selector?: [string]: string
+		namespace?: string
+		{
+			blocked:  true
+			message?: string & !=""
+		} | {
+			allowed: true
+		}
+		dryRun?: bool
+	}]
+	steps?: [...{
+		name?:    string & !=""
+		trigger?: #Trigger | [...#Trigger]
+		expect: [...#Expectation] & [_, ...]
+		timeout?: #Duration
+	}]
+	teardown?: {
+		deleteSetup?: bool
+		manifests?: [...string & !=""]
+		patches?: [...{
+			#ResourceRef
+			spec: {...}
+		}]
+		exec?: [...#Exec]
+	}
+	timeout?: #Duration
+	snapshots?: [...{
+		resource: #ResourceRef
+		file?:    string & !=""
+		ignore?: [...string & !=""]
+	}]
+	forbiddenMutations?: [...{
+		agent:     string & !=""
+		resources: #ResourceSelector
+	}]
+	expectOrder?: [...{
+		id?:          string & !=""
+		description?: string & !=""
+		before:       #OrderedChange
+		after:        #OrderedChange
+	}]
+	churn?: [...{
+		resources:   #ResourceSelector
+		maxCreates?: int & >=0
+		maxUpdates?: int & >=0
+		maxDeletes?: int & >=0
+		fields?: [...{
+			path:     =~"^\\."
+			min?:     number
+			max?:     number
+			never?:   "increase" | "decrease"
+			maxStep?: number & >=0
+		}]
+	}]
+	apiFaults?: [...#APIFault]
+	tenants?:   #Tenants
+	load?:      #LoadTest
+}
+
+#Quantity: number | string
+
+#Duration: =~"^([0-9]+(\\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$"
+
+#Generator: {
+	count: int & >0
+	template: {
+		apiVersion: string
+		kind:       string
+		metadata: {
+			name: string
+			...
+		}
+		...
+	}
+	parallelism?: int & >0
+}
+
+#APIFault: {
+	verbs?: [...("get" | "list" | "watch" | "create" | "update" | "patch" | "delete" | "deletecollection")]
+	resources?: [...string]
+	latency?:        #Duration
+	every?:          int & >=0
+	status?:         int & >=400 & <=599
+	dropWatchAfter?: #Duration
+}
+
+#Tenants: {
+	count:        int & >0
+	namespace:    string & !=""
+	from?:        =~"^[a-z0-9]([-a-z0-9]*[a-z0-9])?$"
+	maxSpread?:   #Duration
+	parallelism?: int & >0
+}
+
+#LoadTest: {
+	rate:     number & >0
+	duration: #Duration
+	template: {
+		apiVersion: string
+		kind:       string
+		metadata: {
+			name: string
+			...
+		}
+		...
+	}
+	expect?: [...#Condition]
+	maxErrorRate?: number & >=0 & <=1
+	maxP99?:       #Duration
+}
+
+#ResourceRef: {
+	apiVersion: string & !=""
+	kind:       string & !=""
+	name:       string & !=""
+	namespace?: string
+}
+
+// #SelectableRef is the resource of an expectation: one resource by name,
+// or those a label selector matches.
+#SelectableRef: {
+	apiVersion: string & !=""
+	kind:       string & !=""
+	namespace?: string
+	{
+		name: string & !=""
+	} | {
+		labelSelector: #LabelSelector
+	}
+}
+
+#EventExpectation: {
+	id?:            string & !=""
+	description?:   string & !=""
+	involvedObject: #ResourceRef
+	reason?:        string & !=""
+	type?:          "Normal" | "Warning"
+	message?:       string & !=""
+	namespace?:     string & !=""
+}
+
+#OrderedChange: {
+	agent:    string & !=""
+	resource: #ResourceRef
+	field?:   string & !=""
+} | {
+	event: #EventExpectation
+}
+
+#ResourceSelector: {
+	apiVersion: string & !=""
+	kind:       string & !=""
+	namespace?: string
+	selector?:  #LabelSelector
+}
+
+#LabelSelector: {
+	matchLabels?: [string]: string
+	matchExpressions?: [...{
+		key:      string
+		operator: "In" | "NotIn" | "Exists" | "DoesNotExist"
+		values?: [...string]
+	}]
+}
+
+#Trigger: {
+	delay?: #Duration
+	patch?: {
+		#ResourceRef
+		spec: {...}
+	}
+	metadata?: {
+		#ResourceRef
+		labels?: [string]:      string
+		annotations?: [string]: string
+		removeLabels?: [...string & !=""]
+		removeAnnotations?: [...string & !=""]
+	}
+	scale?: {
+		apiVersion?: string & !=""
+		kind:        string & !=""
+		name:        string & !=""
+		namespace?:  string
+		replicas:    int & >=0
+	}
+	http?: {
+		service?:      string & !=""
+		namespace?:    string
+		agent?:        string & !=""
+		port:          int & >0 & <=65535 | string & !=""
+		scheme?:       "http" | "https"
+		method?:       string & !=""
+		path?:         =~"^/"
+		headers?: [string]: string
+		body?:         _
+		expectStatus?: int & >=100 & <=599
+	}
+	exec?: #Exec
+	event?: {
+		involvedObject: #ResourceRef
+		reason:         string & !=""
+		message?:       string
+		type?:          "Normal" | "Warning"
+		namespace?:     string
+	}
+	drain?: {
+		node:        string & !=""
+		cordonOnly?: bool
+	}
+	advanceClock?: #Duration
+	chaos?: {
+		killAgentPod?:   string & !=""
+		partitionAgent?: string & !=""
+		duration?:       #Duration
+		after?:          #Duration
+	}
+}
+
+#Exec: {
+	pod?: string & !=""
+	selector?: [string]: string
+	namespace?: string
+	container?: string
+	command: [string, ...string]
+	expectExitCode?: int & >=0 & <=255
+	ignoreExitCode?: bool
+}
+
+#Expectation: {
+	id?:          string & !=""
+	description?: string & !=""
+	resource:     #SelectableRef
+	conditions?: [...#Condition]
+	matches?: {...}
+	hpa?: {
+		desiredReplicas?: int & >=0
+		currentReplicas?: int & >=0
+		conditions?: [string]: "True" | "False" | "Unknown"
+		scaledWithin?: #Duration
+	}
+	observedGeneration?:  bool
+	generationStableFor?: #Duration
+	consistentlyFor?:     #Duration
+	absent?:              bool
+	aggregate?:           "all" | "any"
+	count?:               int & >=0 | {
+		operator?: "eq" | "ne" | "gt" | "gte" | "lt" | "lte"
+		value:     int & >=0
+	}
+	retryOn?: [..."NotFound" | "Forbidden" | "Timeout"]
+	timeout?: #Duration
+}
+
+// #ComparisonOperator is an operator of a condition that compares with a
+// value; exists takes none.
+#ComparisonOperator: "eq" | "ne" | "gt" | "gte" | "lt" | "lte" | "in" | "contains" | "regex" | "within"
+
+#Condition: {
+	id?:          string & !=""
+	description?: string & !=""
+	{
+		path: string & !=""
+		{
+			operator: "exists"
+		} | {
+			operator?: #ComparisonOperator
+			value:     _
+		} | {
+			operator?: #ComparisonOperator
+			valueFrom: {
+				resourceField: {
+					#ResourceRef
+					path: string & !=""
+				}
+			} | {
+				env: string & !=""
+			}
+		}
+	} | {
+		condition: {
+			type:   string & !=""
+			status: "True" | "False" | "Unknown"
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// DenialExpectation is a mutation the framework attempts once the
+// expectations are met, which admission, typically a validating webhook
+// agent, must reject:
+//
+//	expectDenied:
+//	- description: replicas above the team's limit are refused
+//	  patch:
+//	    apiVersion: apps/v1
+//	    kind: Deployment
+//	    name: web
+//	    spec: {replicas: 50}
+//	  message: exceeds the limit of 10 replicas
+//
+// The attempt is repeated until it is denied or the scenario's timeout
+// passes, as webhooks take a moment to be registered. Exactly one of
+// Create, Patch and Delete is set.
+type DenialExpectation struct {
+	// ID identifies the expectation in output and reports.
+	ID string `json:"id,omitempty"`
+	// Description says what the denial shows; output shows it in place of
+	// the mutation.
+	Description string `json:"description,omitempty"`
+	// Create is an object to create, with a metadata.name. Should admission
+	// allow it, it is deleted again.
+	Create map[string]any `json:"create,omitempty"`
+	// Patch merges Spec into the spec of an existing resource.
+	Patch *ResourcePatch `json:"patch,omitempty"`
+	// Delete is a resource to delete.
+	Delete *ResourceRef `json:"delete,omitempty"`
+	// Message, if set, is a regular expression the denial's message must
+	// match, such as the reason the webhook gives.
+	Message string `json:"message,omitempty"`
+	// DryRun sends the mutation as a dry run, so one admission wrongly
+	// allows has no effect. Webhooks are only called on dry runs if they
+	// declare they have no side effects.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// Operation returns the mutation attempted: create, patch or delete.
+func (d *DenialExpectation) Operation() string {
+	switch {
+	case d.Create != nil:
+		return "create"
+	case d.Patch != nil:
+		return "patch"
+	}
+	return "delete"
+}
+
+// Resource returns the resource the mutation is attempted on.
+func (d *DenialExpectation) Resource() ResourceRef {
+	switch {
+	case d.Create != nil:
+		ref := ResourceRef{}
+		ref.APIVersion, _ = d.Create["apiVersion"].(string)
+		ref.Kind, _ = d.Create["kind"].(string)
+		if meta, ok := d.Create["metadata"].(map[string]any); ok {
+			ref.Name, _ = meta["name"].(string)
+			ref.Namespace, _ = meta["namespace"].(string)
+		}
+		return ref
+	case d.Patch != nil:
+		return d.Patch.ResourceRef
+	case d.Delete != nil:
+		return *d.Delete
+	}
+	return ResourceRef{}
+}
+
+// Label returns how output names the expectation: its description, ID,
+// or the mutation.
+func (d *DenialExpectation) Label() string {
+	switch {
+	case d.Description != "":
+		return d.Description
+	case d.ID != "":
+		return d.ID
+	}
+	return fmt.Sprintf("%s of %s denied", d.Operation(), d.Resource())
+}
+
+func (d *DenialExpectation) validate() error {
+	var errs []error
+	set := 0
+	for _, ok := range []bool{d.Create != nil, d.Patch != nil, d.Delete != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		errs = append(errs, errors.New("exactly one of create, patch and delete must be set"))
+	}
+	if ref := d.Resource(); set == 1 {
+		if err := ref.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", d.Operation(), err))
+		}
+	}
+	if _, err := regexp.Compile(d.Message); err != nil {
+		errs = append(errs, fmt.Errorf("message: %w", err))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,99 @@
+package scenario
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Order sorts scenarios so that every scenario comes after the scenarios it
+// depends on. Scenarios without an ordering constraint keep their relative
+// input order. Order fails on duplicate names, unknown dependencies, and
+// cycles.
+func Order(scenarios []*Scenario) ([]*Scenario, error) {
+	index := make(map[string]int, len(scenarios))
+	for i, s := range scenarios {
+		if _, dup := index[s.Name]; dup {
+			return nil, fmt.Errorf("duplicate scenario name %q", s.Name)
+		}
+		index[s.Name] = i
+	}
+
+	pending := make([]int, len(scenarios))
+	dependents := make([][]int, len(scenarios))
+	for i, s := range scenarios {
+		for _, dep := range s.DependsOn {
+			j, ok := index[dep]
+			if !ok {
+				return nil, fmt.Errorf("scenario %q depends on unknown scenario %q", s.Name, dep)
+			}
+			pending[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	// Kahn's algorithm, always picking the lowest input index that is
+	// ready so independent scenarios stay in input order.
+	done := make([]bool, len(scenarios))
+	ordered := make([]*Scenario, 0, len(scenarios))
+	for len(ordered) < len(scenarios) {
+		next := -1
+		for i := range scenarios {
+			if !done[i] && pending[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			return nil, fmt.Errorf("dependency cycle among scenarios: %s", strings.Join(unfinished(scenarios, done), ", "))
+		}
+		done[next] = true
+		ordered = append(ordered, scenarios[next])
+		for _, d := range dependents[next] {
+			pending[d]--
+		}
+	}
+	return ordered, nil
+}
+
+// WithDependencies returns selected plus every scenario they transitively
+// depend on, taken from all, in the order of all.
+func WithDependencies(selected, all []*Scenario) []*Scenario {
+	byName := make(map[string]*Scenario, len(all))
+	for _, s := range all {
+		byName[s.Name] = s
+	}
+	want := map[string]bool{}
+	var visit func(s *Scenario)
+	visit = func(s *Scenario) {
+		if want[s.Name] {
+			return
+		}
+		want[s.Name] = true
+		for _, dep := range s.DependsOn {
+			if d, ok := byName[dep]; ok {
+				visit(d)
+			}
+		}
+	}
+	for _, s := range selected {
+		visit(s)
+	}
+
+	var out []*Scenario
+	for _, s := range all {
+		if want[s.Name] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func unfinished(scenarios []*Scenario, done []bool) []string {
+	var names []string
+	for i, s := range scenarios {
+		if !done[i] {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,105 @@
+package scenario
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		scenarios []*Scenario
+		want      []string
+		err       string
+	}{
+		{
+			name:      "no dependencies keep input order",
+			scenarios: []*Scenario{{Name: "c"}, {Name: "a"}, {Name: "b"}},
+			want:      []string{"c", "a", "b"},
+		},
+		{
+			name: "dependency moves ahead of its dependent",
+			scenarios: []*Scenario{
+				{Name: "a", DependsOn: []string{"b"}},
+				{Name: "b"},
+			},
+			want: []string{"b", "a"},
+		},
+		{
+			name: "independent scenarios stay in input order around a chain",
+			scenarios: []*Scenario{
+				{Name: "x"},
+				{Name: "c", DependsOn: []string{"b"}},
+				{Name: "y"},
+				{Name: "b", DependsOn: []string{"a"}},
+				{Name: "a"},
+			},
+			want: []string{"x", "y", "a", "b", "c"},
+		},
+		{
+			name: "diamond",
+			scenarios: []*Scenario{
+				{Name: "d", DependsOn: []string{"b", "c"}},
+				{Name: "c", DependsOn: []string{"a"}},
+				{Name: "b", DependsOn: []string{"a"}},
+				{Name: "a"},
+			},
+			want: []string{"a", "c", "b", "d"},
+		},
+		{
+			name:      "empty",
+			scenarios: nil,
+			want:      []string{},
+		},
+		{
+			name: "unknown dependency",
+			scenarios: []*Scenario{
+				{Name: "a", DependsOn: []string{"missing"}},
+			},
+			err: `scenario "a" depends on unknown scenario "missing"`,
+		},
+		{
+			name:      "duplicate name",
+			scenarios: []*Scenario{{Name: "a"}, {Name: "a"}},
+			err:       `duplicate scenario name "a"`,
+		},
+		{
+			name: "cycle",
+			scenarios: []*Scenario{
+				{Name: "free"},
+				{Name: "a", DependsOn: []string{"b"}},
+				{Name: "b", DependsOn: []string{"a"}},
+			},
+			err: "dependency cycle among scenarios: a, b",
+		},
+		{
+			name: "self dependency",
+			scenarios: []*Scenario{
+				{Name: "a", DependsOn: []string{"a"}},
+			},
+			err: "dependency cycle among scenarios: a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Order(tt.scenarios)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Order() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Order() error = %v", err)
+			}
+			names := []string{}
+			for _, s := range got {
+				names = append(names, s.Name)
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("Order() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
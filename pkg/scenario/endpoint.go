@@ -0,0 +1,73 @@
+package scenario
+
+import (
+	"fmt"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Endpoint is an HTTP endpoint in the cluster, reached through the API
+// server's proxy so it need not be reachable from where the tests run.
+// Exactly one of Service and Agent is set.
+type Endpoint struct {
+	// Service is the name of the Service to call, in Namespace.
+	Service   string `json:"service,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// Agent names an agent of the scenario; one of its ready pods is
+	// called directly.
+	Agent string `json:"agent,omitempty"`
+	// Port is the Service port or container port, by number or name.
+	Port intstr.IntOrString `json:"port"`
+	// Scheme is http (the default) or https.
+	Scheme string `json:"scheme,omitempty"`
+}
+
+// SchemeOrDefault returns Scheme, falling back to http.
+func (ep *Endpoint) SchemeOrDefault() string {
+	if ep.Scheme == "" {
+		return "http"
+	}
+	return ep.Scheme
+}
+
+// NamespaceOrDefault returns Namespace, falling back to "default".
+func (ep *Endpoint) NamespaceOrDefault() string {
+	if ep.Namespace == "" {
+		return "default"
+	}
+	return ep.Namespace
+}
+
+// String names the endpoint for messages, e.g. agent reconciler:8080.
+func (ep *Endpoint) String() string {
+	if ep.Agent != "" {
+		return fmt.Sprintf("agent %s:%s", ep.Agent, ep.Port.String())
+	}
+	return fmt.Sprintf("service %s/%s:%s", ep.NamespaceOrDefault(), ep.Service, ep.Port.String())
+}
+
+func (ep *Endpoint) validate(s *Scenario, field string) []error {
+	var errs []error
+	switch {
+	case (ep.Service == "") == (ep.Agent == ""):
+		errs = append(errs, fmt.Errorf("%s: exactly one of service and agent must be set", field))
+	case ep.Agent != "" && !slices.Contains(s.Agents, ep.Agent):
+		errs = append(errs, fmt.Errorf("%s.agent: %q is not one of the scenario's agents", field, ep.Agent))
+	case ep.Agent != "" && ep.Namespace != "":
+		errs = append(errs, fmt.Errorf("%s.namespace: agents run in the framework's namespace", field))
+	}
+	if ep.Port.Type == intstr.Int && (ep.Port.IntVal <= 0 || ep.Port.IntVal > 65535) {
+		errs = append(errs, fmt.Errorf("%s.port: %d is out of range", field, ep.Port.IntVal))
+	}
+	if ep.Port.Type == intstr.String {
+		for _, msg := range validation.IsValidPortName(ep.Port.StrVal) {
+			errs = append(errs, fmt.Errorf("%s.port: %s", field, msg))
+		}
+	}
+	if ep.Scheme != "" && ep.Scheme != "http" && ep.Scheme != "https" {
+		errs = append(errs, fmt.Errorf("%s.scheme: %q is neither http nor https", field, ep.Scheme))
+	}
+	return errs
+}
@@ -0,0 +1,56 @@
+package scenario
+
+import (
+	"fmt"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/envsubst"
+)
+
+// ExpandEnv expands ${VAR} references to environment variables in the
+// scenario's setup and teardown manifest paths and condition values,
+// setup.waitFor and steps included.
+// Loaders call it before validation. See package envsubst.
+func (s *Scenario) ExpandEnv() error {
+	for i, m := range s.Setup.Manifests {
+		x, err := envsubst.Expand(m)
+		if err != nil {
+			return fmt.Errorf("setup.manifests[%d]: %w", i, err)
+		}
+		s.Setup.Manifests[i] = x
+	}
+	if t := s.Teardown; t != nil {
+		for i, m := range t.Manifests {
+			x, err := envsubst.Expand(m)
+			if err != nil {
+				return fmt.Errorf("teardown.manifests[%d]: %w", i, err)
+			}
+			t.Manifests[i] = x
+		}
+	}
+	if err := expandConditions("setup.waitFor", s.Setup.WaitFor); err != nil {
+		return err
+	}
+	if err := expandConditions("expect", s.Expect); err != nil {
+		return err
+	}
+	for i := range s.Steps {
+		if err := expandConditions(fmt.Sprintf("steps[%d].expect", i), s.Steps[i].Expect); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func expandConditions(field string, expect []Expectation) error {
+	for i := range expect {
+		for j := range expect[i].Conditions {
+			c := &expect[i].Conditions[j]
+			v, err := envsubst.ExpandValue(c.Value)
+			if err != nil {
+				return fmt.Errorf("%s[%d].conditions[%d].value: %w", field, i, j, err)
+			}
+			c.Value = v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+)
+
+// EventTrigger records a core/v1 Event about a resource, for agents whose
+// input signal is Events rather than the resources themselves.
+type EventTrigger struct {
+	// InvolvedObject is the resource the Event is about. It need not
+	// exist; when it does, the Event carries its UID.
+	InvolvedObject ResourceRef `json:"involvedObject"`
+	Reason         string      `json:"reason"`
+	Message        string      `json:"message,omitempty"`
+	// Type is Normal (the default) or Warning.
+	Type string `json:"type,omitempty"`
+	// Namespace holds the Event; the involved object's namespace, or
+	// "default" for cluster-scoped objects, if unset.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// TypeOrDefault returns Type, falling back to Normal.
+func (ev *EventTrigger) TypeOrDefault() string {
+	if ev.Type == "" {
+		return "Normal"
+	}
+	return ev.Type
+}
+
+// NamespaceOrDefault returns the namespace the Event is created in.
+func (ev *EventTrigger) NamespaceOrDefault() string {
+	switch {
+	case ev.Namespace != "":
+		return ev.Namespace
+	case ev.InvolvedObject.Namespace != "":
+		return ev.InvolvedObject.Namespace
+	}
+	return "default"
+}
+
+func (ev *EventTrigger) validate() []error {
+	var errs []error
+	if err := ev.InvolvedObject.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("trigger.event.involvedObject: %w", err))
+	}
+	if ev.Reason == "" {
+		errs = append(errs, errors.New("trigger.event.reason is required"))
+	}
+	if ev.Type != "" && ev.Type != "Normal" && ev.Type != "Warning" {
+		errs = append(errs, fmt.Errorf("trigger.event.type: %q is neither Normal nor Warning", ev.Type))
+	}
+	return errs
+}
@@ -0,0 +1,94 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// EvictionExpectation is a pod eviction the framework attempts once the
+// expectations are met, which must be blocked or allowed, for agents that
+// manage PodDisruptionBudgets or react to disruptions:
+//
+//	expectEvictions:
+//	- description: the last replica is protected
+//	  selector: {app: web}
+//	  namespace: shop
+//	  blocked: true
+//	  dryRun: true
+//
+// Exactly one of Pod and Selector is set; with Selector, the first running
+// pod matching it is evicted. Exactly one of Blocked and Allowed is set.
+// The attempt is repeated until it has the expected outcome or the
+// scenario's timeout passes, as agents take a moment to create or adjust
+// budgets.
+type EvictionExpectation struct {
+	// ID identifies the expectation in output and reports.
+	ID string `json:"id,omitempty"`
+	// Description says what the eviction shows; output shows it in place
+	// of the pod.
+	Description string            `json:"description,omitempty"`
+	Pod         string            `json:"pod,omitempty"`
+	Selector    map[string]string `json:"selector,omitempty"`
+	Namespace   string            `json:"namespace,omitempty"`
+	// Blocked requires the API server to refuse the eviction, as it does
+	// with 429 Too Many Requests when it would violate a budget. Unless
+	// DryRun is set, an eviction that goes through instead is not
+	// attempted again, since the pod is gone.
+	Blocked bool `json:"blocked,omitempty"`
+	// Allowed requires the eviction to go through.
+	Allowed bool `json:"allowed,omitempty"`
+	// Message, if set, is a regular expression the refusal must match,
+	// such as the name of the budget that blocks it. Only with Blocked.
+	Message string `json:"message,omitempty"`
+	// DryRun evicts as a dry run, which budgets are checked against too,
+	// so allowed evictions leave the pod running.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// NamespaceOrDefault returns Namespace, falling back to "default".
+func (x *EvictionExpectation) NamespaceOrDefault() string {
+	if x.Namespace == "" {
+		return "default"
+	}
+	return x.Namespace
+}
+
+// Outcome returns the outcome the eviction must have: blocked or allowed.
+func (x *EvictionExpectation) Outcome() string {
+	if x.Blocked {
+		return "blocked"
+	}
+	return "allowed"
+}
+
+// Label returns how output names the expectation: its description, ID,
+// or the pods and outcome.
+func (x *EvictionExpectation) Label() string {
+	switch {
+	case x.Description != "":
+		return x.Description
+	case x.ID != "":
+		return x.ID
+	case x.Pod != "":
+		return fmt.Sprintf("eviction of pod %s/%s %s", x.NamespaceOrDefault(), x.Pod, x.Outcome())
+	}
+	return fmt.Sprintf("eviction of pods %v in %s %s", x.Selector, x.NamespaceOrDefault(), x.Outcome())
+}
+
+func (x *EvictionExpectation) validate() error {
+	var errs []error
+	if (x.Pod == "") == (len(x.Selector) == 0) {
+		errs = append(errs, errors.New("exactly one of pod and selector must be set"))
+	}
+	if x.Blocked == x.Allowed {
+		errs = append(errs, errors.New("exactly one of blocked and allowed must be set"))
+	}
+	if x.Message != "" && !x.Blocked {
+		errs = append(errs, errors.New("message needs blocked"))
+	}
+	if _, err := regexp.Compile(x.Message); err != nil {
+		errs = append(errs, fmt.Errorf("message: %w", err))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,48 @@
+package scenario
+
+import "fmt"
+
+// ExecTrigger runs a command in a workload pod, to simulate a change on
+// the workload side that the agents only observe indirectly, such as a
+// file being written or a process receiving a signal. Exactly one of Pod
+// and Selector is set; with Selector, the first running pod matching it is
+// used.
+type ExecTrigger struct {
+	Pod       string            `json:"pod,omitempty"`
+	Selector  map[string]string `json:"selector,omitempty"`
+	Namespace string            `json:"namespace,omitempty"`
+	// Container defaults to the pod's only or default container.
+	Container string   `json:"container,omitempty"`
+	Command   []string `json:"command"`
+	// ExpectExitCode is the exit code the command must end with.
+	ExpectExitCode int `json:"expectExitCode,omitempty"`
+	// IgnoreExitCode accepts any exit code, for commands run only for
+	// their side effect, such as filling a disk until it fails.
+	IgnoreExitCode bool `json:"ignoreExitCode,omitempty"`
+}
+
+// NamespaceOrDefault returns Namespace, falling back to "default".
+func (x *ExecTrigger) NamespaceOrDefault() string {
+	if x.Namespace == "" {
+		return "default"
+	}
+	return x.Namespace
+}
+
+// validate checks x, the exec trigger or teardown command at field.
+func (x *ExecTrigger) validate(field string) []error {
+	var errs []error
+	if (x.Pod == "") == (len(x.Selector) == 0) {
+		errs = append(errs, fmt.Errorf("%s: exactly one of pod and selector must be set", field))
+	}
+	if len(x.Command) == 0 {
+		errs = append(errs, fmt.Errorf("%s.command is required", field))
+	}
+	if x.ExpectExitCode < 0 || x.ExpectExitCode > 255 {
+		errs = append(errs, fmt.Errorf("%s.expectExitCode: %d is out of range 0-255", field, x.ExpectExitCode))
+	}
+	if x.IgnoreExitCode && x.ExpectExitCode != 0 {
+		errs = append(errs, fmt.Errorf("%s: expectExitCode and ignoreExitCode are mutually exclusive", field))
+	}
+	return errs
+}
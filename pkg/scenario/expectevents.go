@@ -0,0 +1,69 @@
+package scenario
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// EventExpectation is a core/v1 Event an agent must record before the
+// timeout, for behavior only visible as Events. Events the framework
+// records for event triggers and those from before the run do not count.
+type EventExpectation struct {
+	// ID identifies the expectation in output and reports.
+	ID string `json:"id,omitempty"`
+	// Description says what the Event shows, such as "quota exceeded
+	// reported"; output shows it in place of the involved object.
+	Description string `json:"description,omitempty"`
+	// InvolvedObject is the resource the Event must be about. Its
+	// apiVersion is not compared, as Events may name another version.
+	InvolvedObject ResourceRef `json:"involvedObject"`
+	// Reason, if set, must equal the Event's reason.
+	Reason string `json:"reason,omitempty"`
+	// Type, if set, is Normal or Warning.
+	Type string `json:"type,omitempty"`
+	// Message, if set, is a regular expression the Event's message must
+	// match.
+	Message string `json:"message,omitempty"`
+	// Namespace holds the Event; the involved object's namespace, or
+	// "default" for cluster-scoped objects, if unset.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// NamespaceOrDefault returns the namespace the Event is looked for in.
+func (ev *EventExpectation) NamespaceOrDefault() string {
+	switch {
+	case ev.Namespace != "":
+		return ev.Namespace
+	case ev.InvolvedObject.Namespace != "":
+		return ev.InvolvedObject.Namespace
+	}
+	return "default"
+}
+
+// Label returns how output names the expectation: its description, ID,
+// or the Event it looks for.
+func (ev *EventExpectation) Label() string {
+	switch {
+	case ev.Description != "":
+		return ev.Description
+	case ev.ID != "":
+		return ev.ID
+	}
+	return fmt.Sprintf("event %s about %s", cmp.Or(ev.Reason, "of any reason"), ev.InvolvedObject)
+}
+
+func (ev *EventExpectation) validate() error {
+	var errs []error
+	if err := ev.InvolvedObject.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("involvedObject: %w", err))
+	}
+	if ev.Type != "" && ev.Type != "Normal" && ev.Type != "Warning" {
+		errs = append(errs, fmt.Errorf("type: %q is neither Normal nor Warning", ev.Type))
+	}
+	if _, err := regexp.Compile(ev.Message); err != nil {
+		errs = append(errs, fmt.Errorf("message: %w", err))
+	}
+	return errors.Join(errs...)
+}
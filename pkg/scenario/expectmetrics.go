@@ -0,0 +1,150 @@
+package scenario
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MetricExpectation is a comparison over a Prometheus metric an endpoint
+// exposes, such as an agent's /metrics, that must hold before the timeout:
+//
+//	expectMetrics:
+//	- agent: reconciler
+//	  port: metrics
+//	  expr: kube_agents_decisions_total{outcome="applied"} > 0
+type MetricExpectation struct {
+	// ID identifies the expectation in output and reports.
+	ID string `json:"id,omitempty"`
+	// Description says what the metric shows; output shows it in place of
+	// the expression.
+	Description string `json:"description,omitempty"`
+	// Endpoint serves the metrics; they are scraped through the API
+	// server's proxy.
+	Endpoint `json:",inline"`
+	// Path is /metrics if unset.
+	Path string `json:"path,omitempty"`
+	// Expr compares a metric with a number: a metric name, optionally
+	// with label matchers as in PromQL (= and !=), one of > >= < <= == !=,
+	// and the number. The value compared is the sum of the series that
+	// match, so a counter split by labels can be compared as a whole.
+	Expr string `json:"expr"`
+}
+
+// PathOrDefault returns Path, falling back to /metrics.
+func (m *MetricExpectation) PathOrDefault() string {
+	return cmp.Or(m.Path, "/metrics")
+}
+
+// Label returns how output names the expectation: its description, ID,
+// or expression.
+func (m *MetricExpectation) Label() string {
+	switch {
+	case m.Description != "":
+		return m.Description
+	case m.ID != "":
+		return m.ID
+	}
+	return m.Expr
+}
+
+func (m *MetricExpectation) validate(s *Scenario, field string) []error {
+	errs := m.Endpoint.validate(s, field)
+	if m.Path != "" && !strings.HasPrefix(m.Path, "/") {
+		errs = append(errs, fmt.Errorf("%s.path must start with /", field))
+	}
+	if _, err := ParseMetricExpr(m.Expr); err != nil {
+		errs = append(errs, fmt.Errorf("%s.expr: %w", field, err))
+	}
+	return errs
+}
+
+// MetricExpr is a parsed MetricExpectation.Expr.
+type MetricExpr struct {
+	Name     string
+	Matchers []LabelMatcher
+	Op       string
+	Value    float64
+}
+
+// LabelMatcher selects series by a label value.
+type LabelMatcher struct {
+	Name string
+	// Op is = or !=. A label a series lacks has the empty value.
+	Op    string
+	Value string
+}
+
+var (
+	metricExpr   = regexp.MustCompile(`^\s*([a-zA-Z_:][a-zA-Z0-9_:]*)\s*(?:\{(.*)\})?\s*(>=|<=|==|!=|>|<)\s*(\S+)\s*$`)
+	labelMatcher = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*(!=|=)\s*("(?:[^"\\]|\\.)*")\s*(?:,|$)`)
+)
+
+// ParseMetricExpr parses a metric expression such as
+// requests_total{code!="200"} <= 3.
+func ParseMetricExpr(expr string) (*MetricExpr, error) {
+	m := metricExpr.FindStringSubmatch(expr)
+	if m == nil {
+		return nil, fmt.Errorf("%q is not of the form metric{label=\"value\"} > number", expr)
+	}
+	e := &MetricExpr{Name: m[1], Op: m[3]}
+	var err error
+	if e.Value, err = strconv.ParseFloat(m[4], 64); err != nil {
+		return nil, fmt.Errorf("%q is not a number", m[4])
+	}
+	for rest := m[2]; strings.TrimSpace(rest) != ""; {
+		lm := labelMatcher.FindStringSubmatch(rest)
+		if lm == nil {
+			return nil, fmt.Errorf("label matchers: cannot parse %q", strings.TrimSpace(rest))
+		}
+		value, err := strconv.Unquote(lm[3])
+		if err != nil {
+			return nil, fmt.Errorf("label %s: %w", lm[1], err)
+		}
+		e.Matchers = append(e.Matchers, LabelMatcher{Name: lm[1], Op: lm[2], Value: value})
+		rest = rest[len(lm[0]):]
+	}
+	return e, nil
+}
+
+// Matches reports whether a series with labels is selected by e.
+func (e *MetricExpr) Matches(labels map[string]string) bool {
+	for _, lm := range e.Matchers {
+		if (labels[lm.Name] == lm.Value) != (lm.Op == "=") {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare reports whether v satisfies the comparison of e.
+func (e *MetricExpr) Compare(v float64) bool {
+	switch e.Op {
+	case ">":
+		return v > e.Value
+	case ">=":
+		return v >= e.Value
+	case "<":
+		return v < e.Value
+	case "<=":
+		return v <= e.Value
+	case "==":
+		return v == e.Value
+	}
+	return v != e.Value
+}
+
+// Selector returns the metric name and label matchers of e, as written in
+// PromQL.
+func (e *MetricExpr) Selector() string {
+	if len(e.Matchers) == 0 {
+		return e.Name
+	}
+	parts := make([]string, len(e.Matchers))
+	for i, lm := range e.Matchers {
+		parts[i] = lm.Name + lm.Op + strconv.Quote(lm.Value)
+	}
+	return e.Name + "{" + strings.Join(parts, ",") + "}"
+}
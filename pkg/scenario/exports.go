@@ -0,0 +1,58 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// exportName matches the names exports may have, those a template can
+// refer to as {{ .Exports.name }}.
+var exportName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Export reads a value from a setup object once setup has run, for values
+// such as UIDs, node names or cluster IPs that are not known in advance.
+// The triggers and expectations refer to it as {{ .Exports.name }}; see
+// RenderSetupValues.
+type Export struct {
+	// Name is the key the value is exported under.
+	Name string `json:"name"`
+	// Resource is the object to read. Its name may refer to generated
+	// names and to the exports before this one.
+	Resource ResourceRef `json:"resource"`
+	// Path is a dotted field path such as .spec.nodeName. Setup waits
+	// for the field to be set; strings are exported as they are and other
+	// values as JSON.
+	Path string `json:"path"`
+}
+
+func (x Export) validate() error {
+	var errs []error
+	if !exportName.MatchString(x.Name) {
+		errs = append(errs, fmt.Errorf("name %q must be a letter or underscore followed by letters, digits or underscores", x.Name))
+	}
+	if err := x.Resource.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("resource: %w", err))
+	}
+	if x.Path == "" {
+		errs = append(errs, errors.New("path is required"))
+	}
+	return errors.Join(errs...)
+}
+
+// validateExports checks the setup exports and that their names are
+// unique.
+func (s *Setup) validateExports() []error {
+	var errs []error
+	seen := map[string]bool{}
+	for i, x := range s.Exports {
+		if err := x.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("setup.exports[%d]: %w", i, err))
+		}
+		if seen[x.Name] {
+			errs = append(errs, fmt.Errorf("setup.exports[%d]: name %q is exported twice", i, x.Name))
+		}
+		seen[x.Name] = true
+	}
+	return errs
+}
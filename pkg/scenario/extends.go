@@ -0,0 +1,148 @@
+package scenario
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"sigs.k8s.io/yaml"
+)
+
+// loadDocument reads a scenario file as a generic document, rendering it as
+// a template and resolving its extends chain. values resolves the secret
+// references of every file of the chain. seen holds the files of the chain
+// so far, to catch cycles. It returns the merged document and the
+// variables the files were rendered with.
+func loadDocument(path string, supplied map[string]string, values *valueResolver, seen []string) (map[string]any, map[string]string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if slices.Contains(seen, abs) {
+		return nil, nil, fmt.Errorf("%s extends itself", abs)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, vars, err := expand(data, supplied, values)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var doc map[string]any
+	if err := yaml.UnmarshalStrict(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if doc == nil {
+		doc = map[string]any{}
+	}
+	ext, ok := doc["extends"]
+	if !ok {
+		return doc, vars, nil
+	}
+	delete(doc, "extends")
+	basePath, ok := ext.(string)
+	if !ok || basePath == "" {
+		return nil, nil, fmt.Errorf("%s: extends must be a file path", path)
+	}
+	dir := filepath.Dir(path)
+	if !filepath.IsAbs(basePath) {
+		basePath = filepath.Join(dir, basePath)
+	}
+	base, baseVars, err := loadDocument(basePath, supplied, values, append(seen, abs))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: extends: %w", path, err)
+	}
+	if err := rebasePaths(base, filepath.Dir(basePath), dir); err != nil {
+		return nil, nil, fmt.Errorf("%s: extends: %w", path, err)
+	}
+	if baseVars != nil || vars != nil {
+		merged := map[string]string{}
+		maps.Copy(merged, baseVars)
+		maps.Copy(merged, vars)
+		vars = merged
+	}
+	return mergeDocument(base, doc), vars, nil
+}
+
+// mergeDocument merges patch into base the way a JSON merge patch does
+// (RFC 7386): objects are merged key by key, null removes a key, and any
+// other value, lists included, replaces the base's.
+func mergeDocument(base, patch map[string]any) map[string]any {
+	for k, v := range patch {
+		if v == nil {
+			delete(base, k)
+			continue
+		}
+		pm, ok := v.(map[string]any)
+		bm, baseOK := base[k].(map[string]any)
+		if ok && baseOK {
+			base[k] = mergeDocument(bm, pm)
+			continue
+		}
+		base[k] = v
+	}
+	return base
+}
+
+// rebasePaths rewrites the file paths of a base document, relative to
+// from, to be relative to the extending scenario's directory to.
+func rebasePaths(doc map[string]any, from, to string) error {
+	rebase := func(p any) (any, error) {
+		s, ok := p.(string)
+		if !ok || s == "" || filepath.IsAbs(s) {
+			return p, nil
+		}
+		return filepath.Rel(to, filepath.Join(from, s))
+	}
+	var errs []error
+	if setup, ok := doc["setup"].(map[string]any); ok {
+		if manifests, ok := setup["manifests"].([]any); ok {
+			for i, m := range manifests {
+				var err error
+				if manifests[i], err = rebase(m); err != nil {
+					errs = append(errs, fmt.Errorf("setup.manifests[%d]: %w", i, err))
+				}
+			}
+		}
+	}
+	if teardown, ok := doc["teardown"].(map[string]any); ok {
+		if manifests, ok := teardown["manifests"].([]any); ok {
+			for i, m := range manifests {
+				var err error
+				if manifests[i], err = rebase(m); err != nil {
+					errs = append(errs, fmt.Errorf("teardown.manifests[%d]: %w", i, err))
+				}
+			}
+		}
+	}
+	if snapshots, ok := doc["snapshots"].([]any); ok {
+		for i, sn := range snapshots {
+			sn, ok := sn.(map[string]any)
+			if !ok {
+				continue
+			}
+			if f, ok := sn["file"]; ok {
+				var err error
+				if sn["file"], err = rebase(f); err != nil {
+					errs = append(errs, fmt.Errorf("snapshots[%d].file: %w", i, err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// decodeDocument decodes a merged document into s, rejecting unknown
+// fields as Load does.
+func decodeDocument(doc map[string]any, s *Scenario) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return yaml.UnmarshalStrict(data, s)
+}
@@ -0,0 +1,126 @@
+package scenario
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeDocument(t *testing.T) {
+	base := map[string]any{
+		"name":    "base",
+		"timeout": "1m",
+		"setup": map[string]any{
+			"manifests": []any{"a.yaml", "b.yaml"},
+			"namespace": "test",
+		},
+		"agents": []any{"quota-agent"},
+	}
+	patch := map[string]any{
+		"name":    "child",
+		"timeout": nil,
+		"setup":   map[string]any{"manifests": []any{"c.yaml"}},
+		"agents":  map[string]any{"not": "a list"},
+		"trigger": map[string]any{"patch": map[string]any{"name": "app"}},
+	}
+	want := map[string]any{
+		"name": "child",
+		"setup": map[string]any{
+			"manifests": []any{"c.yaml"},
+			"namespace": "test",
+		},
+		"agents":  map[string]any{"not": "a list"},
+		"trigger": map[string]any{"patch": map[string]any{"name": "app"}},
+	}
+	if got := mergeDocument(base, patch); !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeDocument() = %v, want %v", got, want)
+	}
+}
+
+func TestRebasePaths(t *testing.T) {
+	doc := map[string]any{
+		"setup":     map[string]any{"manifests": []any{"setup.yaml", "/abs/setup.yaml", ""}},
+		"teardown":  map[string]any{"manifests": []any{"../shared/teardown.yaml"}},
+		"snapshots": []any{map[string]any{"file": "snap.yaml"}, "not an object"},
+		"other":     map[string]any{"file": "untouched.yaml"},
+	}
+	if err := rebasePaths(doc, "/suite/base", "/suite/team/a"); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"setup":     map[string]any{"manifests": []any{"../../base/setup.yaml", "/abs/setup.yaml", ""}},
+		"teardown":  map[string]any{"manifests": []any{"../../shared/teardown.yaml"}},
+		"snapshots": []any{map[string]any{"file": "../../base/snap.yaml"}, "not an object"},
+		"other":     map[string]any{"file": "untouched.yaml"},
+	}
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("rebasePaths() = %v, want %v", doc, want)
+	}
+}
+
+func TestLoadExtends(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, data string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	writeFile("bases/root.yaml", `vars:
+  tier: web
+name: root-{{ .Vars.tier }}
+timeout: 2m
+setup:
+  manifests: [root.yaml]
+`)
+	writeFile("bases/cache.yaml", `extends: root.yaml
+vars:
+  app: cache
+name: cache
+setup:
+  manifests: [cache.yaml]
+  waitFor:
+  - resource: {apiVersion: v1, kind: ConfigMap, name: "{{ .Vars.app }}", namespace: test}
+`)
+	path := writeFile("scenarios/evicts.yaml", `extends: ../bases/cache.yaml
+name: evicts-{{ .Vars.app }}
+timeout: null
+`)
+
+	s, err := Load(path, WithVars(map[string]string{"app": "redis"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "evicts-redis" {
+		t.Errorf("name = %q, want evicts-redis", s.Name)
+	}
+	if s.Timeout != nil {
+		t.Errorf("timeout = %v, want it removed by null", s.Timeout)
+	}
+	if want := []string{"../bases/cache.yaml"}; !reflect.DeepEqual(s.Setup.Manifests, want) {
+		t.Errorf("setup manifests = %v, want %v", s.Setup.Manifests, want)
+	}
+	if got := s.Setup.WaitFor[0].Resource.Name; got != "redis" {
+		t.Errorf("waitFor name = %q, want the supplied variable", got)
+	}
+	if want := map[string]string{"app": "redis", "tier": "web"}; !reflect.DeepEqual(s.Vars, want) {
+		t.Errorf("vars = %v, want %v", s.Vars, want)
+	}
+
+	writeFile("bases/loop.yaml", "extends: ../scenarios/loop.yaml\nname: loop\n")
+	loop := writeFile("scenarios/loop.yaml", "extends: ../bases/loop.yaml\nname: loop\n")
+	if _, err := Load(loop); err == nil || !strings.Contains(err.Error(), "extends itself") {
+		t.Errorf("Load() of a cycle: error = %v, want extends itself", err)
+	}
+	bad := writeFile("scenarios/bad.yaml", "extends: [a, b]\nname: bad\n")
+	if _, err := Load(bad); err == nil || !strings.Contains(err.Error(), "extends must be a file path") {
+		t.Errorf("Load() of a list extends: error = %v, want extends must be a file path", err)
+	}
+}
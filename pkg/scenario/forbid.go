@@ -0,0 +1,68 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ForbiddenMutation asserts that an agent never modified the selected
+// resources while the scenario ran, proving it does not interfere with
+// what other agents own. It is checked against the resources'
+// managedFields once the expectations are met, so it catches creates,
+// updates, and patches, but not deletions.
+type ForbiddenMutation struct {
+	// Agent names an agent of the scenario.
+	Agent     string           `json:"agent"`
+	Resources ResourceSelector `json:"resources"`
+}
+
+// ResourceSelector selects resources of one kind by label.
+type ResourceSelector struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// Namespace is where namespaced kinds are listed; "default" if unset.
+	Namespace string `json:"namespace,omitempty"`
+	// Selector filters by label; all resources of the kind if unset.
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+func (r ResourceSelector) String() string {
+	s := r.Kind
+	if r.Namespace != "" {
+		s += " in " + r.Namespace
+	}
+	if r.Selector != nil {
+		s += " matching " + metav1.FormatLabelSelector(r.Selector)
+	}
+	return s
+}
+
+func (r ResourceSelector) validate() error {
+	var errs []error
+	if r.APIVersion == "" {
+		errs = append(errs, errors.New("apiVersion is required"))
+	}
+	if r.Kind == "" {
+		errs = append(errs, errors.New("kind is required"))
+	}
+	if r.Selector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(r.Selector); err != nil {
+			errs = append(errs, fmt.Errorf("selector: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f *ForbiddenMutation) validate(s *Scenario) error {
+	var errs []error
+	if !slices.Contains(s.Agents, f.Agent) {
+		errs = append(errs, fmt.Errorf("agent %q is not one of the scenario's agents", f.Agent))
+	}
+	if err := f.Resources.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("resources: %w", err))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,158 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// DefaultGenerateParallelism bounds concurrent creates of a Generator that
+// does not set Parallelism.
+const DefaultGenerateParallelism = 16
+
+// Generator creates Count synthetic resources from Template, e.g. to seed a
+// scaling scenario with hundreds of Deployments.
+//
+// String values in Template are Go templates evaluated with .Index, the
+// 0-based copy number, and the functions mod (mod .Index 3) and pick
+// (pick .Index "a" "b" "c", cycling through the choices). A value that is a
+// single template action rendering to a number or boolean, such as
+// "{{mod .Index 3}}", keeps that type.
+type Generator struct {
+	Count    int            `json:"count"`
+	Template map[string]any `json:"template"`
+	// Parallelism bounds concurrent creates.
+	Parallelism int `json:"parallelism,omitempty"`
+}
+
+// ParallelismOrDefault returns Parallelism, falling back to
+// DefaultGenerateParallelism.
+func (g *Generator) ParallelismOrDefault() int {
+	if g.Parallelism <= 0 {
+		return DefaultGenerateParallelism
+	}
+	return g.Parallelism
+}
+
+var generateFuncs = template.FuncMap{
+	"mod": func(i, n int) int { return i % n },
+	"pick": func(i int, choices ...string) string {
+		if len(choices) == 0 {
+			return ""
+		}
+		return choices[i%len(choices)]
+	},
+}
+
+// Objects renders the Count resources.
+func (g *Generator) Objects() ([]map[string]any, error) {
+	render, err := compileValue(g.Template)
+	if err != nil {
+		return nil, err
+	}
+	objs := make([]map[string]any, 0, g.Count)
+	for i := range g.Count {
+		v, err := render(i)
+		if err != nil {
+			return nil, fmt.Errorf("rendering copy %d: %w", i, err)
+		}
+		objs = append(objs, v.(map[string]any))
+	}
+	return objs, nil
+}
+
+func (g *Generator) validate() error {
+	var errs []error
+	if g.Count <= 0 {
+		errs = append(errs, errors.New("count must be positive"))
+	}
+	meta, _ := g.Template["metadata"].(map[string]any)
+	name, _ := meta["name"].(string)
+	switch {
+	case g.Template["apiVersion"] == nil || g.Template["kind"] == nil || name == "":
+		errs = append(errs, errors.New("template needs apiVersion, kind, and metadata.name"))
+	case g.Count > 1 && !strings.Contains(name, "{{"):
+		errs = append(errs, errors.New("template metadata.name must vary with .Index"))
+	}
+	if _, err := compileValue(g.Template); err != nil {
+		errs = append(errs, fmt.Errorf("template: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+type renderFunc func(index int) (any, error)
+
+// compileValue parses every template string in v once and returns a
+// function rendering a fresh copy of v for an index.
+func compileValue(v any) (renderFunc, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		fields := make(map[string]renderFunc, len(v))
+		for k, fv := range v {
+			r, err := compileValue(fv)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			fields[k] = r
+		}
+		return func(i int) (any, error) {
+			out := make(map[string]any, len(fields))
+			for k, r := range fields {
+				fv, err := r(i)
+				if err != nil {
+					return nil, err
+				}
+				out[k] = fv
+			}
+			return out, nil
+		}, nil
+	case []any:
+		items := make([]renderFunc, len(v))
+		for j, item := range v {
+			r, err := compileValue(item)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", j, err)
+			}
+			items[j] = r
+		}
+		return func(i int) (any, error) {
+			out := make([]any, len(items))
+			for j, r := range items {
+				item, err := r(i)
+				if err != nil {
+					return nil, err
+				}
+				out[j] = item
+			}
+			return out, nil
+		}, nil
+	case string:
+		if !strings.Contains(v, "{{") {
+			return func(int) (any, error) { return v, nil }, nil
+		}
+		tmpl, err := template.New("").Funcs(generateFuncs).Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		typed := strings.HasPrefix(v, "{{") && strings.HasSuffix(v, "}}") && strings.Count(v, "{{") == 1
+		return func(i int) (any, error) {
+			var b strings.Builder
+			if err := tmpl.Execute(&b, struct{ Index int }{i}); err != nil {
+				return nil, err
+			}
+			out := b.String()
+			if typed {
+				if n, err := strconv.ParseInt(out, 10, 64); err == nil {
+					return n, nil
+				}
+				if bv, err := strconv.ParseBool(out); err == nil {
+					return bv, nil
+				}
+			}
+			return out, nil
+		}, nil
+	}
+	return func(int) (any, error) { return v, nil }, nil
+}
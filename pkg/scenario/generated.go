@@ -0,0 +1,310 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// setupRef matches the references to values only known once setup has
+// run in a scenario file: {{ .Generated.key }} or {{ index .Generated "key" }}
+// for generated names, and likewise with .Exports for exports.
+var setupRef = regexp.MustCompile(`\.(Generated|Exports)\.([A-Za-z_][A-Za-z0-9_]*)|index\s+\.(Generated|Exports)\s+["` + "`" + `]([^"` + "`" + `]*)["` + "`" + `]`)
+
+// GeneratedKey returns the key under which the name generated for an object
+// with generateName is available to templated resource names: the
+// generateName without its trailing dash.
+func GeneratedKey(generateName string) string {
+	return strings.TrimSuffix(generateName, "-")
+}
+
+// passThroughSetupValues returns the Generated and Exports template data
+// used while a file is loaded: each referenced key maps to the reference
+// itself, so it survives loading and is rendered by RenderSetupValues once
+// setup has run.
+func passThroughSetupValues(data []byte) (generated, exports map[string]string) {
+	values := map[string]map[string]string{"Generated": {}, "Exports": {}}
+	for _, m := range setupRef.FindAllSubmatch(data, -1) {
+		field, key := string(m[1])+string(m[3]), string(m[2])+string(m[4])
+		values[field][key] = "{{ index ." + field + " `" + key + "` }}"
+	}
+	return values["Generated"], values["Exports"]
+}
+
+// isTemplated reports whether s is rendered by RenderSetupValues.
+func isTemplated(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+// HasSetupReferences reports whether the triggers or expectations of s
+// refer to generated names or exports.
+func (s *Scenario) HasSetupReferences() bool {
+	templated := false
+	s.renderSetupReferences(func(string) (string, error) {
+		templated = true
+		return "", nil
+	})
+	return templated
+}
+
+// RenderSetupValues returns a copy of s in which the templated resource
+// names, condition values, and patch and metadata values of its triggers
+// and expectations are executed with what setup produced: generated, the
+// names the API server generated for setup objects with
+// metadata.generateName, keyed by GeneratedKey, and exports, the values of
+// Setup.Exports by name:
+//
+//	trigger:
+//	  patch:
+//	    apiVersion: batch/v1
+//	    kind: Job
+//	    name: "{{ .Generated.migration }}"
+//	expect:
+//	- resource: {apiVersion: v1, kind: Pod, name: replacement}
+//	  conditions:
+//	  - path: .spec.nodeName
+//	    value: "{{ .Exports.node }}"
+//
+// Rendered values are strings; compare numbers through
+// valueFrom.resourceField instead.
+func (s *Scenario) RenderSetupValues(generated, exports map[string]string) (*Scenario, error) {
+	data := TemplateData{Generated: generated, Exports: exports}
+	return s.renderSetupReferences(func(text string) (string, error) {
+		return renderSetupValues(text, data)
+	})
+}
+
+// renderSetupValues executes text with data.
+func renderSetupValues(text string, data TemplateData) (string, error) {
+	// index yields "" for missing keys whatever the missingkey option.
+	for _, m := range setupRef.FindAllStringSubmatch(text, -1) {
+		key := m[2] + m[4]
+		switch field := m[1] + m[3]; {
+		case field == "Generated" && data.Generated[key] == "":
+			return "", fmt.Errorf("no name was generated for %q; no setup object has generateName %q", key, key+"-")
+		case field == "Exports" && data.Exports[key] == "":
+			return "", fmt.Errorf("no value was exported as %q", key)
+		}
+	}
+	t, err := template.New("value").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// RenderExportResource returns the resource export i reads, its name
+// rendered with the names generated during setup and the values exported
+// before it.
+func (s *Scenario) RenderExportResource(i int, generated, exports map[string]string) (ResourceRef, error) {
+	ref := s.Setup.Exports[i].Resource
+	if !isTemplated(ref.Name) {
+		return ref, nil
+	}
+	name, err := renderSetupValues(ref.Name, TemplateData{Generated: generated, Exports: exports})
+	if err != nil {
+		return ResourceRef{}, fmt.Errorf("setup.exports[%d].resource.name: %w", i, err)
+	}
+	ref.Name = name
+	return ref, nil
+}
+
+// renderSetupReferences returns a copy of s with each templated resource
+// name, string condition value, and string patch and metadata value of its
+// triggers and expectations, denied mutations, evicted pods and teardown
+// included, replaced by what render returns for it.
+func (s *Scenario) renderSetupReferences(render func(text string) (string, error)) (*Scenario, error) {
+	var errs []error
+	name := func(field string, n *string) {
+		if !isTemplated(*n) {
+			return
+		}
+		out, err := render(*n)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+			return
+		}
+		*n = out
+	}
+	var value func(field string, v any) any
+	value = func(field string, v any) any {
+		switch v := v.(type) {
+		case string:
+			name(field, &v)
+			return v
+		case map[string]any:
+			out := make(map[string]any, len(v))
+			for k, e := range v {
+				out[k] = value(field+"."+k, e)
+			}
+			return out
+		case []any:
+			out := make([]any, len(v))
+			for i, e := range v {
+				out[i] = value(fmt.Sprintf("%s[%d]", field, i), e)
+			}
+			return out
+		}
+		return v
+	}
+	values := func(field string, m map[string]string) map[string]string {
+		if m == nil {
+			return nil
+		}
+		out := make(map[string]string, len(m))
+		for k, v := range m {
+			name(field+"."+k, &v)
+			out[k] = v
+		}
+		return out
+	}
+	var renderTrigger func(field string, t *Trigger) *Trigger
+	renderTrigger = func(field string, t *Trigger) *Trigger {
+		if t == nil {
+			return nil
+		}
+		rt := *t
+		if t.List != nil {
+			rt.List = make([]Trigger, len(t.List))
+			for i := range t.List {
+				rt.List[i] = *renderTrigger(fmt.Sprintf("%s[%d]", field, i), &t.List[i])
+			}
+		}
+		if t.Patch != nil {
+			p := *t.Patch
+			name(field+".patch.name", &p.Name)
+			if p.Spec != nil {
+				p.Spec = value(field+".patch.spec", p.Spec).(map[string]any)
+			}
+			rt.Patch = &p
+		}
+		if t.Metadata != nil {
+			m := *t.Metadata
+			name(field+".metadata.name", &m.Name)
+			m.Labels = values(field+".metadata.labels", m.Labels)
+			m.Annotations = values(field+".metadata.annotations", m.Annotations)
+			rt.Metadata = &m
+		}
+		if t.Scale != nil {
+			sc := *t.Scale
+			name(field+".scale.name", &sc.Name)
+			rt.Scale = &sc
+		}
+		if t.Exec != nil {
+			x := *t.Exec
+			name(field+".exec.pod", &x.Pod)
+			rt.Exec = &x
+		}
+		if t.Event != nil {
+			ev := *t.Event
+			name(field+".event.involvedObject.name", &ev.InvolvedObject.Name)
+			rt.Event = &ev
+		}
+		return &rt
+	}
+	renderExpect := func(field string, expect []Expectation) []Expectation {
+		expect = slices.Clone(expect)
+		for i := range expect {
+			exp := &expect[i]
+			name(fmt.Sprintf("%s[%d].resource.name", field, i), &exp.Resource.Name)
+			exp.Conditions = slices.Clone(exp.Conditions)
+			for j := range exp.Conditions {
+				c := &exp.Conditions[j]
+				if c.Value != nil {
+					c.Value = value(fmt.Sprintf("%s[%d].conditions[%d].value", field, i, j), c.Value)
+				}
+				if c.ValueFrom == nil || c.ValueFrom.ResourceField == nil {
+					continue
+				}
+				f := *c.ValueFrom.ResourceField
+				name(fmt.Sprintf("%s[%d].conditions[%d].valueFrom.resourceField.name", field, i, j), &f.Name)
+				c.ValueFrom = &ValueSource{ResourceField: &f}
+			}
+		}
+		return expect
+	}
+
+	r := *s
+	r.Setup.WaitFor = renderExpect("setup.waitFor", s.Setup.WaitFor)
+	r.Trigger = renderTrigger("trigger", s.Trigger)
+	r.Expect = renderExpect("expect", s.Expect)
+	r.ExpectEvents = slices.Clone(s.ExpectEvents)
+	for i := range r.ExpectEvents {
+		name(fmt.Sprintf("expectEvents[%d].involvedObject.name", i), &r.ExpectEvents[i].InvolvedObject.Name)
+	}
+	r.ExpectDenied = slices.Clone(s.ExpectDenied)
+	for i := range r.ExpectDenied {
+		d := &r.ExpectDenied[i]
+		field := fmt.Sprintf("expectDenied[%d]", i)
+		switch {
+		case d.Create != nil:
+			d.Create = value(field+".create", d.Create).(map[string]any)
+		case d.Patch != nil:
+			p := *d.Patch
+			name(field+".patch.name", &p.Name)
+			if p.Spec != nil {
+				p.Spec = value(field+".patch.spec", p.Spec).(map[string]any)
+			}
+			d.Patch = &p
+		case d.Delete != nil:
+			ref := *d.Delete
+			name(field+".delete.name", &ref.Name)
+			d.Delete = &ref
+		}
+	}
+	r.ExpectEvictions = slices.Clone(s.ExpectEvictions)
+	for i := range r.ExpectEvictions {
+		name(fmt.Sprintf("expectEvictions[%d].pod", i), &r.ExpectEvictions[i].Pod)
+	}
+	renderChange := func(field string, c *OrderedChange) {
+		if c.Resource != nil {
+			ref := *c.Resource
+			name(field+".resource.name", &ref.Name)
+			c.Resource = &ref
+		}
+		if c.Event != nil {
+			ev := *c.Event
+			name(field+".event.involvedObject.name", &ev.InvolvedObject.Name)
+			c.Event = &ev
+		}
+	}
+	r.ExpectOrder = slices.Clone(s.ExpectOrder)
+	for i := range r.ExpectOrder {
+		o := &r.ExpectOrder[i]
+		renderChange(fmt.Sprintf("expectOrder[%d].before", i), &o.Before)
+		renderChange(fmt.Sprintf("expectOrder[%d].after", i), &o.After)
+	}
+	r.Steps = slices.Clone(s.Steps)
+	for i := range r.Steps {
+		st := &r.Steps[i]
+		st.Trigger = renderTrigger(fmt.Sprintf("steps[%d].trigger", i), st.Trigger)
+		st.Expect = renderExpect(fmt.Sprintf("steps[%d].expect", i), st.Expect)
+	}
+	if s.Teardown != nil {
+		t := *s.Teardown
+		t.Patches = slices.Clone(t.Patches)
+		for i := range t.Patches {
+			p := &t.Patches[i]
+			name(fmt.Sprintf("teardown.patches[%d].name", i), &p.Name)
+			if p.Spec != nil {
+				p.Spec = value(fmt.Sprintf("teardown.patches[%d].spec", i), p.Spec).(map[string]any)
+			}
+		}
+		t.Exec = slices.Clone(t.Exec)
+		for i := range t.Exec {
+			name(fmt.Sprintf("teardown.exec[%d].pod", i), &t.Exec[i].Pod)
+		}
+		r.Teardown = &t
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return &r, nil
+}
@@ -0,0 +1,101 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HPAStatus is shorthand for conditions on the status of a
+// HorizontalPodAutoscaler, which scaling agents act on and scenarios
+// check:
+//
+//	expect:
+//	- resource: {apiVersion: autoscaling/v2, kind: HorizontalPodAutoscaler, name: web, namespace: shop}
+//	  hpa:
+//	    desiredReplicas: 5
+//	    conditions: {AbleToScale: "True", ScalingLimited: "False"}
+//	    scaledWithin: 5m
+//
+// stands for
+//
+//	conditions:
+//	- path: .status.desiredReplicas
+//	  value: 5
+//	- condition: {type: AbleToScale, status: "True"}
+//	- condition: {type: ScalingLimited, status: "False"}
+//	- path: .status.lastScaleTime
+//	  operator: within
+//	  value: 5m
+type HPAStatus struct {
+	// DesiredReplicas is the replica count the autoscaler last computed.
+	DesiredReplicas *int32 `json:"desiredReplicas,omitempty"`
+	// CurrentReplicas is the replica count the autoscaler last saw.
+	CurrentReplicas *int32 `json:"currentReplicas,omitempty"`
+	// Conditions maps condition types, such as AbleToScale, ScalingActive
+	// and ScalingLimited, to the status each must have.
+	Conditions map[string]metav1.ConditionStatus `json:"conditions,omitempty"`
+	// ScaledWithin requires the autoscaler to have last scaled no longer
+	// ago than this.
+	ScaledWithin *metav1.Duration `json:"scaledWithin,omitempty"`
+}
+
+// conditions returns the conditions h stands for, its status conditions
+// in order of type.
+func (h *HPAStatus) conditions() []Condition {
+	if h == nil {
+		return nil
+	}
+	var conds []Condition
+	if h.DesiredReplicas != nil {
+		conds = append(conds, Condition{Path: ".status.desiredReplicas", Value: int64(*h.DesiredReplicas)})
+	}
+	if h.CurrentReplicas != nil {
+		conds = append(conds, Condition{Path: ".status.currentReplicas", Value: int64(*h.CurrentReplicas)})
+	}
+	for _, t := range slices.Sorted(maps.Keys(h.Conditions)) {
+		conds = append(conds, Condition{Condition: &StatusCondition{Type: t, Status: h.Conditions[t]}})
+	}
+	if h.ScaledWithin != nil {
+		conds = append(conds, Condition{Path: ".status.lastScaleTime", Operator: OperatorWithin, Value: h.ScaledWithin.Duration.String()})
+	}
+	return conds
+}
+
+func (h *HPAStatus) validate(ref ResourceRef) error {
+	var errs []error
+	if ref.Kind != "HorizontalPodAutoscaler" {
+		errs = append(errs, fmt.Errorf("needs a HorizontalPodAutoscaler resource, not %s", ref.Kind))
+	}
+	if h.DesiredReplicas == nil && h.CurrentReplicas == nil && len(h.Conditions) == 0 && h.ScaledWithin == nil {
+		errs = append(errs, errors.New("sets nothing to check"))
+	}
+	if n := h.DesiredReplicas; n != nil && *n < 0 {
+		errs = append(errs, errors.New("desiredReplicas must not be negative"))
+	}
+	if n := h.CurrentReplicas; n != nil && *n < 0 {
+		errs = append(errs, errors.New("currentReplicas must not be negative"))
+	}
+	for _, t := range slices.Sorted(maps.Keys(h.Conditions)) {
+		if err := (&StatusCondition{Type: t, Status: h.Conditions[t]}).validate(); err != nil {
+			errs = append(errs, fmt.Errorf("conditions.%s: %w", t, err))
+		}
+	}
+	if d := h.ScaledWithin; d != nil && d.Duration <= 0 {
+		errs = append(errs, errors.New("scaledWithin must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// ExpandedConditions returns the conditions of e with its shorthands, of
+// status conditions and HPA status, replaced by the paths and values they
+// stand for, which is how the engine and exporters evaluate them.
+func (e Expectation) ExpandedConditions() []Condition {
+	if e.HPA == nil {
+		return ExpandConditions(e.Conditions)
+	}
+	return ExpandConditions(append(slices.Clone(e.Conditions), e.HPA.conditions()...))
+}
@@ -0,0 +1,43 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// HTTPTrigger calls an HTTP endpoint in the cluster, for agents that start
+// reconciling on a webhook or an API of their own.
+type HTTPTrigger struct {
+	Endpoint `json:",inline"`
+	// Method is POST if unset.
+	Method string `json:"method,omitempty"`
+	// Path may carry a query string, e.g. /reconcile?all=true.
+	Path    string            `json:"path,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Body is sent as is when it is a string, and as JSON otherwise.
+	Body any `json:"body,omitempty"`
+	// ExpectStatus is the status the call must answer with; any 2xx if
+	// unset.
+	ExpectStatus int `json:"expectStatus,omitempty"`
+}
+
+// MethodOrDefault returns Method, falling back to POST.
+func (h *HTTPTrigger) MethodOrDefault() string {
+	if h.Method == "" {
+		return http.MethodPost
+	}
+	return strings.ToUpper(h.Method)
+}
+
+func (h *HTTPTrigger) validate(s *Scenario) []error {
+	errs := h.Endpoint.validate(s, "trigger.http")
+	if h.Path != "" && !strings.HasPrefix(h.Path, "/") {
+		errs = append(errs, errors.New("trigger.http.path must start with /"))
+	}
+	if h.ExpectStatus != 0 && (h.ExpectStatus < 100 || h.ExpectStatus > 599) {
+		errs = append(errs, fmt.Errorf("trigger.http.expectStatus: %d is not an HTTP status", h.ExpectStatus))
+	}
+	return errs
+}
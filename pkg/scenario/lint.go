@@ -0,0 +1,175 @@
+package scenario
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// Lint rules.
+const (
+	RuleNoTimeout         = "expectation-without-timeout"
+	RuleDefaultNamespace  = "hard-coded-default-namespace"
+	RuleTriggerNotInSetup = "trigger-not-in-setup"
+	RuleDuplicateName     = "duplicate-scenario-name"
+)
+
+// Finding is one best-practice violation reported by Lint.
+type Finding struct {
+	Scenario string `json:"scenario"`
+	Rule     string `json:"rule"`
+	Message  string `json:"message"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.Scenario, f.Rule, f.Message)
+}
+
+// Lint checks scenarios against best-practice rules that Validate does not
+// enforce because the scenarios still run. Findings follow the order of
+// scenarios.
+func Lint(scenarios ...*Scenario) []Finding {
+	var findings []Finding
+	seen := map[string]bool{}
+	for _, s := range scenarios {
+		add := func(rule, format string, args ...any) {
+			findings = append(findings, Finding{Scenario: s.Name, Rule: rule, Message: fmt.Sprintf(format, args...)})
+		}
+
+		noTimeout := func(e Expectation) bool { return e.Timeout == nil }
+		if s.Timeout == nil && slices.ContainsFunc(s.Expect, noTimeout) {
+			add(RuleNoTimeout, "expectations rely on the default timeout of %s; set timeout to what the agents need", DefaultTimeout)
+		}
+
+		objects, err := s.setupObjects()
+		for _, ref := range s.refs() {
+			if ref.ref.Namespace == "default" {
+				add(RuleDefaultNamespace, "%s uses the default namespace; use a dedicated one so scenarios do not interfere", ref.field)
+			}
+		}
+		for _, obj := range objects {
+			if obj.Namespace == "default" {
+				add(RuleDefaultNamespace, "setup object %s uses the default namespace; use a dedicated one so scenarios do not interfere", obj)
+			}
+		}
+
+		for _, t := range s.Trigger.Triggers() {
+			if err == nil && t.Patch != nil && !isTemplated(t.Patch.Name) && !containsRef(objects, t.Patch.ResourceRef) {
+				add(RuleTriggerNotInSetup, "trigger patches %s, which no setup manifest creates", t.Patch.ResourceRef)
+			}
+		}
+
+		if seen[s.Name] {
+			add(RuleDuplicateName, "another scenario has the same name")
+		}
+		seen[s.Name] = true
+	}
+	return findings
+}
+
+type namedRef struct {
+	field string
+	ref   ResourceRef
+}
+
+// refs returns every resource reference in the scenario with its field path.
+func (s *Scenario) refs() []namedRef {
+	var refs []namedRef
+	triggers := s.Trigger.Triggers()
+	for i, t := range triggers {
+		field := "trigger.patch"
+		if len(triggers) > 1 {
+			field = fmt.Sprintf("trigger[%d].patch", i)
+		}
+		if t.Patch != nil {
+			refs = append(refs, namedRef{field, t.Patch.ResourceRef})
+		}
+	}
+	for i, e := range s.Expect {
+		refs = append(refs, namedRef{fmt.Sprintf("expect[%d].resource", i), e.Resource})
+	}
+	return refs
+}
+
+// setupObjects reads the references of the objects the setup manifests,
+// presets, and generators create.
+func (s *Scenario) setupObjects() ([]ResourceRef, error) {
+	var refs []ResourceRef
+	for _, m := range s.Setup.Manifests {
+		data, err := os.ReadFile(s.ManifestPath(m))
+		if err != nil {
+			return nil, err
+		}
+		dec := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+		for {
+			var obj struct {
+				APIVersion string `json:"apiVersion"`
+				Kind       string `json:"kind"`
+				Metadata   struct {
+					Name      string `json:"name"`
+					Namespace string `json:"namespace"`
+				} `json:"metadata"`
+			}
+			if err := dec.Decode(&obj); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, fmt.Errorf("%s: %w", m, err)
+			}
+			if obj.Kind == "" {
+				continue
+			}
+			refs = append(refs, ResourceRef{
+				APIVersion: obj.APIVersion,
+				Kind:       obj.Kind,
+				Name:       obj.Metadata.Name,
+				Namespace:  obj.Metadata.Namespace,
+			})
+		}
+	}
+	for _, obj := range s.PresetObjects() {
+		refs = append(refs, objectRef(obj))
+	}
+	for i := range s.Setup.Generate {
+		objs, err := s.Setup.Generate[i].Objects()
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			refs = append(refs, objectRef(obj))
+		}
+	}
+	return refs, nil
+}
+
+func objectRef(obj map[string]any) ResourceRef {
+	meta, _ := obj["metadata"].(map[string]any)
+	ref := ResourceRef{}
+	ref.APIVersion, _ = obj["apiVersion"].(string)
+	ref.Kind, _ = obj["kind"].(string)
+	ref.Name, _ = meta["name"].(string)
+	ref.Namespace, _ = meta["namespace"].(string)
+	return ref
+}
+
+// containsRef reports whether refs holds ref, treating an empty namespace
+// as "default".
+func containsRef(refs []ResourceRef, ref ResourceRef) bool {
+	ns := func(n string) string {
+		if n == "" {
+			return "default"
+		}
+		return n
+	}
+	for _, r := range refs {
+		if r.APIVersion == ref.APIVersion && r.Kind == ref.Kind && r.Name == ref.Name && ns(r.Namespace) == ns(ref.Namespace) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package scenario
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLint(t *testing.T) {
+	dir := t.TempDir()
+	manifest := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+  namespace: test
+`
+	shared := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: shared
+  namespace: default
+`
+	for name, data := range map[string]string{"setup.yaml": manifest, "shared.yaml": shared} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	configMap := func(name, ns string) ResourceRef {
+		return ResourceRef{APIVersion: "v1", Kind: "ConfigMap", Name: name, Namespace: ns}
+	}
+	timeout := &metav1.Duration{Duration: DefaultTimeout}
+	patch := func(ref ResourceRef) *Trigger {
+		return &Trigger{Patch: &ResourcePatch{ResourceRef: ref}}
+	}
+	clean := func(name string) *Scenario {
+		return &Scenario{
+			Name:    name,
+			Dir:     dir,
+			Timeout: timeout,
+			Setup:   Setup{Manifests: []string{"setup.yaml"}},
+			Trigger: patch(configMap("app", "test")),
+			Expect:  []Expectation{{Resource: configMap("app", "test")}},
+		}
+	}
+	tests := []struct {
+		name      string
+		scenarios func() []*Scenario
+		want      []string
+	}{
+		{
+			name: "clean",
+			scenarios: func() []*Scenario {
+				s := clean("a")
+				s.Setup.Manifests = nil
+				s.Trigger = nil
+				return []*Scenario{s}
+			},
+		},
+		{
+			name: "expectation without a timeout",
+			scenarios: func() []*Scenario {
+				s := clean("a")
+				s.Timeout = nil
+				return []*Scenario{s}
+			},
+			want: []string{RuleNoTimeout},
+		},
+		{
+			name: "expectations with their own timeouts",
+			scenarios: func() []*Scenario {
+				s := clean("a")
+				s.Timeout = nil
+				s.Expect[0].Timeout = timeout
+				return []*Scenario{s}
+			},
+		},
+		{
+			name: "default namespace in refs and setup objects",
+			scenarios: func() []*Scenario {
+				s := clean("a")
+				s.Setup.Manifests = append(s.Setup.Manifests, "shared.yaml")
+				s.Trigger = patch(configMap("shared", "default"))
+				s.Expect = append(s.Expect, Expectation{Resource: configMap("shared", "default")})
+				return []*Scenario{s}
+			},
+			want: []string{RuleDefaultNamespace, RuleDefaultNamespace, RuleDefaultNamespace},
+		},
+		{
+			name: "trigger patches an object no manifest creates",
+			scenarios: func() []*Scenario {
+				s := clean("a")
+				s.Trigger = patch(configMap("other", "test"))
+				return []*Scenario{s}
+			},
+			want: []string{RuleTriggerNotInSetup},
+		},
+		{
+			name: "templated trigger names are not checked",
+			scenarios: func() []*Scenario {
+				s := clean("a")
+				s.Trigger = patch(configMap("{{ .generated.app }}", "test"))
+				return []*Scenario{s}
+			},
+		},
+		{
+			name: "each trigger of a list is checked",
+			scenarios: func() []*Scenario {
+				s := clean("a")
+				s.Trigger = &Trigger{List: []Trigger{*patch(configMap("app", "test")), *patch(configMap("other", "test"))}}
+				return []*Scenario{s}
+			},
+			want: []string{RuleTriggerNotInSetup},
+		},
+		{
+			name: "duplicate names",
+			scenarios: func() []*Scenario {
+				return []*Scenario{clean("a"), clean("b"), clean("a")}
+			},
+			want: []string{RuleDuplicateName},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, f := range Lint(tt.scenarios()...) {
+				got = append(got, f.Rule)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lint() rules = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
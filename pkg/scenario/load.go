@@ -0,0 +1,96 @@
+package scenario
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Load reads and validates a single scenario file, written in YAML or JSON.
+// The file is first executed as a template; see WithVars and
+// WithValueProviders. Environment variables are then expanded; see
+// ExpandEnv.
+//
+// A file may extend a base file, named by a path relative to it, sharing
+// its agents, setup and defaults:
+//
+//	extends: base/cache.yaml
+//	name: cache-evicts-on-pressure
+//	trigger:
+//	  patch: ...
+//
+// The file is merged onto its base as a JSON merge patch: objects are
+// merged key by key, null removes a key, and lists replace the base's.
+// Bases are rendered with the same variables and may extend other bases;
+// their manifest and snapshot paths stay relative to the base file. Keep
+// bases out of the directories LoadDir reads, as they are usually not
+// complete scenarios.
+func Load(path string, opts ...LoadOption) (*Scenario, error) {
+	var o loadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	doc, vars, err := loadDocument(path, o.vars, newValueResolver(o.providers), nil)
+	if err != nil {
+		return nil, err
+	}
+	var s Scenario
+	if err := decodeDocument(doc, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if vars != nil {
+		s.Vars = vars
+	}
+	s.Dir = filepath.Dir(path)
+	if err := s.ExpandEnv(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// LoadDir loads every scenario file (.yaml, .yml, or .json) directly inside
+// dir, ordered by file name.
+func LoadDir(dir string, opts ...LoadOption) ([]*Scenario, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, e := range entries {
+		if e.IsDir() || !isScenarioFile(e.Name()) {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, e.Name()))
+	}
+	sort.Strings(paths)
+
+	scenarios := make([]*Scenario, 0, len(paths))
+	for _, p := range paths {
+		s, err := Load(p, opts...)
+		if err != nil {
+			return nil, err
+		}
+		scenarios = append(scenarios, s)
+	}
+	return scenarios, nil
+}
+
+// ManifestPath resolves a setup manifest path relative to the scenario file.
+func (s *Scenario) ManifestPath(p string) string {
+	if filepath.IsAbs(p) || s.Dir == "" {
+		return p
+	}
+	return filepath.Join(s.Dir, p)
+}
+
+func isScenarioFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
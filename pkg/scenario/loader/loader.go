@@ -0,0 +1,79 @@
+// Package loader loads scenarios from every kind of source the framework
+// accepts: YAML and JSON files, CUE files, directories of either, and
+// remote bundles.
+package loader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario/cueloader"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario/remote"
+)
+
+// Load loads the scenarios of each path, in order. CUE files, and
+// directories holding a CUE package, go through the CUE loader. Remote
+// sources (git+ and oci:// references) are fetched with fetcher, or a
+// default remote.Fetcher when nil, and loaded as directories.
+func Load(ctx context.Context, fetcher *remote.Fetcher, paths ...string) ([]*scenario.Scenario, error) {
+	return LoadWithVars(ctx, fetcher, nil, paths...)
+}
+
+// LoadWithVars is Load with template variables for YAML and JSON scenario
+// files; see scenario.WithVars.
+func LoadWithVars(ctx context.Context, fetcher *remote.Fetcher, vars map[string]string, paths ...string) ([]*scenario.Scenario, error) {
+	return LoadWithOptions(ctx, fetcher, []scenario.LoadOption{scenario.WithVars(vars)}, paths...)
+}
+
+// LoadWithOptions is Load with options for YAML and JSON scenario files,
+// such as scenario.WithVars and scenario.WithValueProviders.
+func LoadWithOptions(ctx context.Context, fetcher *remote.Fetcher, opts []scenario.LoadOption, paths ...string) ([]*scenario.Scenario, error) {
+	var all []*scenario.Scenario
+	for _, p := range paths {
+		if remote.IsRemote(p) {
+			if fetcher == nil {
+				fetcher = remote.New()
+			}
+			dir, err := fetcher.Fetch(ctx, p)
+			if err != nil {
+				return nil, err
+			}
+			p = dir
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			ss, err := scenario.LoadDir(p, opts...)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, ss...)
+			if cueFiles, _ := filepath.Glob(filepath.Join(p, "*"+cueloader.Ext)); len(cueFiles) > 0 {
+				ss, err := cueloader.Load(p)
+				if err != nil {
+					return nil, err
+				}
+				all = append(all, ss...)
+			}
+			continue
+		}
+		if filepath.Ext(p) == cueloader.Ext {
+			ss, err := cueloader.Load(p)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, ss...)
+			continue
+		}
+		s, err := scenario.Load(p, opts...)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, s)
+	}
+	return all, nil
+}
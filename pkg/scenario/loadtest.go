@@ -0,0 +1,94 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LoadTest turns a scenario into a load test: after the setup and trigger,
+// a new object is created from Template Rate times per second for
+// Duration, regardless of how fast earlier ones converge. Each object must
+// reach Expect within the scenario timeout; the engine reports throughput,
+// the distribution of convergence latencies, and the error rate.
+//
+// Template is rendered like a Generator template, with .Index the arrival
+// number. The scenario's own expectations are checked once every arrival
+// has converged or timed out.
+type LoadTest struct {
+	// Rate is the number of objects created per second.
+	Rate     float64         `json:"rate"`
+	Duration metav1.Duration `json:"duration"`
+	Template map[string]any  `json:"template"`
+	// Expect are the conditions each created object must reach. With
+	// none, an object converges once it can be read back.
+	Expect []Condition `json:"expect,omitempty"`
+	// MaxErrorRate is the fraction of arrivals that may fail to be created
+	// or to converge before the scenario fails; 0 tolerates none.
+	MaxErrorRate float64 `json:"maxErrorRate,omitempty"`
+	// MaxP99 fails the scenario when the 99th percentile convergence
+	// latency exceeds it.
+	MaxP99 *metav1.Duration `json:"maxP99,omitempty"`
+}
+
+// Arrivals returns the number of objects the load test creates.
+func (l *LoadTest) Arrivals() int {
+	return int(math.Ceil(l.Rate * l.Duration.Seconds()))
+}
+
+// Interval returns the time between two arrivals.
+func (l *LoadTest) Interval() time.Duration {
+	return time.Duration(float64(time.Second) / l.Rate)
+}
+
+// Renderer returns a function rendering the object of an arrival.
+func (l *LoadTest) Renderer() (func(index int) (map[string]any, error), error) {
+	render, err := compileValue(l.Template)
+	if err != nil {
+		return nil, err
+	}
+	return func(index int) (map[string]any, error) {
+		v, err := render(index)
+		if err != nil {
+			return nil, fmt.Errorf("rendering arrival %d: %w", index, err)
+		}
+		return v.(map[string]any), nil
+	}, nil
+}
+
+func (l *LoadTest) validate() error {
+	var errs []error
+	if l.Rate <= 0 {
+		errs = append(errs, errors.New("rate must be positive"))
+	}
+	if l.Duration.Duration <= 0 {
+		errs = append(errs, errors.New("duration must be positive"))
+	}
+	meta, _ := l.Template["metadata"].(map[string]any)
+	name, _ := meta["name"].(string)
+	switch {
+	case l.Template["apiVersion"] == nil || l.Template["kind"] == nil || name == "":
+		errs = append(errs, errors.New("template needs apiVersion, kind, and metadata.name"))
+	case !strings.Contains(name, "{{"):
+		errs = append(errs, errors.New("template metadata.name must vary with .Index"))
+	}
+	if _, err := compileValue(l.Template); err != nil {
+		errs = append(errs, fmt.Errorf("template: %w", err))
+	}
+	for i, c := range l.Expect {
+		if err := c.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("expect[%d]: %w", i, err))
+		}
+	}
+	if l.MaxErrorRate < 0 || l.MaxErrorRate > 1 {
+		errs = append(errs, errors.New("maxErrorRate must be between 0 and 1"))
+	}
+	if l.MaxP99 != nil && l.MaxP99.Duration <= 0 {
+		errs = append(errs, errors.New("maxP99 must be positive"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,27 @@
+package scenario
+
+// MergeKeys identify the elements of object lists in Expectation.Matches,
+// like the patch merge keys of strategic merge patches: containers by
+// name, conditions by type.
+var MergeKeys = []string{"name", "type", "containerPort", "mountPath", "key"}
+
+// MergeKey returns the first of MergeKeys that every object in list has.
+func MergeKey(list []any) (string, bool) {
+	if len(list) == 0 {
+		return "", false
+	}
+	for _, key := range MergeKeys {
+		all := true
+		for _, e := range list {
+			m, _ := e.(map[string]any)
+			if _, ok := m[key]; !ok {
+				all = false
+				break
+			}
+		}
+		if all {
+			return key, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,68 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// MetadataTrigger sets or removes labels and annotations on an existing
+// resource, for agents that key their behavior on metadata rather than
+// spec.
+type MetadataTrigger struct {
+	ResourceRef `json:",inline"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// RemoveLabels and RemoveAnnotations list keys to delete; keys that
+	// are not present are ignored.
+	RemoveLabels      []string `json:"removeLabels,omitempty"`
+	RemoveAnnotations []string `json:"removeAnnotations,omitempty"`
+}
+
+// MetadataPatch returns the merge patch body that applies the trigger.
+func (m *MetadataTrigger) MetadataPatch() map[string]any {
+	meta := map[string]any{}
+	set := func(field string, values map[string]string, remove []string) {
+		if len(values) == 0 && len(remove) == 0 {
+			return
+		}
+		patch := map[string]any{}
+		for k, v := range values {
+			patch[k] = v
+		}
+		for _, k := range remove {
+			patch[k] = nil
+		}
+		meta[field] = patch
+	}
+	set("labels", m.Labels, m.RemoveLabels)
+	set("annotations", m.Annotations, m.RemoveAnnotations)
+	return map[string]any{"metadata": meta}
+}
+
+func (m *MetadataTrigger) validate() []error {
+	var errs []error
+	if err := m.ResourceRef.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("trigger.metadata: %w", err))
+	}
+	if len(m.Labels) == 0 && len(m.Annotations) == 0 && len(m.RemoveLabels) == 0 && len(m.RemoveAnnotations) == 0 {
+		errs = append(errs, errors.New("trigger.metadata: at least one label or annotation must be set or removed"))
+	}
+	for _, k := range m.RemoveLabels {
+		if _, ok := m.Labels[k]; ok {
+			errs = append(errs, fmt.Errorf("trigger.metadata.removeLabels: %q is also set in labels", k))
+		}
+	}
+	for _, k := range m.RemoveAnnotations {
+		if _, ok := m.Annotations[k]; ok {
+			errs = append(errs, fmt.Errorf("trigger.metadata.removeAnnotations: %q is also set in annotations", k))
+		}
+	}
+	if i := slices.Index(m.RemoveLabels, ""); i >= 0 {
+		errs = append(errs, fmt.Errorf("trigger.metadata.removeLabels[%d] is empty", i))
+	}
+	if i := slices.Index(m.RemoveAnnotations, ""); i >= 0 {
+		errs = append(errs, fmt.Errorf("trigger.metadata.removeAnnotations[%d] is empty", i))
+	}
+	return errs
+}
@@ -0,0 +1,237 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// ScopeFunc reports whether the kind apiVersion/kind is namespaced. known
+// is false when the kind cannot be resolved. apiVersion may be empty for
+// kinds named without one, such as a scale target.
+type ScopeFunc func(apiVersion, kind string) (namespaced, known bool)
+
+// ResolveNamespaces returns a copy of s in which the resources it names
+// live where they will be addressed: references to cluster-scoped kinds
+// lose any namespace, and references to namespaced kinds that name none
+// take the scenario's Namespace. References to kinds scope cannot resolve
+// are left alone. It fails when an expectation names a namespaced
+// resource without a namespace and the scenario sets no default.
+func (s *Scenario) ResolveNamespaces(scope ScopeFunc) (*Scenario, error) {
+	r := *s
+	var errs []error
+	resolve := func(apiVersion, kind, namespace string) string {
+		namespaced, known := scope(apiVersion, kind)
+		switch {
+		case !known:
+			return namespace
+		case !namespaced:
+			return ""
+		case namespace == "":
+			return s.Namespace
+		}
+		return namespace
+	}
+	resolveRef := func(ref *ResourceRef) {
+		ref.Namespace = resolve(ref.APIVersion, ref.Kind, ref.Namespace)
+	}
+	// required resolves ref and fails when it stays namespaced without a
+	// namespace.
+	required := func(field string, ref *ResourceRef) {
+		if namespaced, known := scope(ref.APIVersion, ref.Kind); known && namespaced && ref.Namespace == "" && s.Namespace == "" {
+			errs = append(errs, fmt.Errorf("%s: %s is namespaced; set its namespace or the scenario's", field, ref))
+		}
+		resolveRef(ref)
+	}
+	orDefault := func(namespace string) string {
+		if namespace == "" {
+			return s.Namespace
+		}
+		return namespace
+	}
+
+	var resolveTrigger func(t *Trigger) *Trigger
+	resolveTrigger = func(t *Trigger) *Trigger {
+		if t == nil {
+			return nil
+		}
+		rt := *t
+		if t.List != nil {
+			rt.List = make([]Trigger, len(t.List))
+			for i := range t.List {
+				rt.List[i] = *resolveTrigger(&t.List[i])
+			}
+		}
+		if t.Patch != nil {
+			p := *t.Patch
+			resolveRef(&p.ResourceRef)
+			rt.Patch = &p
+		}
+		if t.Metadata != nil {
+			m := *t.Metadata
+			resolveRef(&m.ResourceRef)
+			rt.Metadata = &m
+		}
+		if t.Scale != nil {
+			sc := *t.Scale
+			sc.Namespace = resolve(sc.APIVersion, sc.Kind, sc.Namespace)
+			rt.Scale = &sc
+		}
+		if t.HTTP != nil && t.HTTP.Agent == "" {
+			h := *t.HTTP
+			h.Namespace = orDefault(h.Namespace)
+			rt.HTTP = &h
+		}
+		if t.Exec != nil {
+			x := *t.Exec
+			x.Namespace = orDefault(x.Namespace)
+			rt.Exec = &x
+		}
+		if t.Event != nil {
+			ev := *t.Event
+			resolveRef(&ev.InvolvedObject)
+			if ev.InvolvedObject.Namespace == "" {
+				ev.Namespace = orDefault(ev.Namespace)
+			}
+			rt.Event = &ev
+		}
+		return &rt
+	}
+	resolveExpect := func(field string, expect []Expectation) []Expectation {
+		expect = slices.Clone(expect)
+		for i := range expect {
+			exp := &expect[i]
+			required(fmt.Sprintf("%s[%d].resource", field, i), &exp.Resource)
+			exp.Conditions = slices.Clone(exp.Conditions)
+			for j := range exp.Conditions {
+				c := &exp.Conditions[j]
+				if c.ValueFrom == nil || c.ValueFrom.ResourceField == nil {
+					continue
+				}
+				f := *c.ValueFrom.ResourceField
+				required(fmt.Sprintf("%s[%d].conditions[%d].valueFrom.resourceField", field, i, j), &f.ResourceRef)
+				c.ValueFrom = &ValueSource{ResourceField: &f}
+			}
+		}
+		return expect
+	}
+
+	r.Trigger = resolveTrigger(s.Trigger)
+	r.Expect = resolveExpect("expect", s.Expect)
+	r.ExpectEvents = slices.Clone(s.ExpectEvents)
+	for i := range r.ExpectEvents {
+		ev := &r.ExpectEvents[i]
+		resolveRef(&ev.InvolvedObject)
+		if ev.InvolvedObject.Namespace == "" {
+			ev.Namespace = orDefault(ev.Namespace)
+		}
+	}
+	r.ExpectMetrics = slices.Clone(s.ExpectMetrics)
+	for i := range r.ExpectMetrics {
+		if m := &r.ExpectMetrics[i]; m.Agent == "" {
+			m.Namespace = orDefault(m.Namespace)
+		}
+	}
+	r.ExpectDenied = slices.Clone(s.ExpectDenied)
+	for i := range r.ExpectDenied {
+		d := &r.ExpectDenied[i]
+		field := fmt.Sprintf("expectDenied[%d].%s", i, d.Operation())
+		switch {
+		case d.Create != nil:
+			ref := d.Resource()
+			required(field, &ref)
+			d.Create = maps.Clone(d.Create)
+			meta, _ := d.Create["metadata"].(map[string]any)
+			meta = maps.Clone(meta)
+			if meta == nil {
+				meta = map[string]any{}
+			}
+			if ref.Namespace == "" {
+				delete(meta, "namespace")
+			} else {
+				meta["namespace"] = ref.Namespace
+			}
+			d.Create["metadata"] = meta
+		case d.Patch != nil:
+			p := *d.Patch
+			required(field, &p.ResourceRef)
+			d.Patch = &p
+		case d.Delete != nil:
+			ref := *d.Delete
+			required(field, &ref)
+			d.Delete = &ref
+		}
+	}
+	r.ExpectEvictions = slices.Clone(s.ExpectEvictions)
+	for i := range r.ExpectEvictions {
+		r.ExpectEvictions[i].Namespace = orDefault(r.ExpectEvictions[i].Namespace)
+	}
+	r.Steps = slices.Clone(s.Steps)
+	for i := range r.Steps {
+		st := &r.Steps[i]
+		st.Trigger = resolveTrigger(st.Trigger)
+		st.Expect = resolveExpect(fmt.Sprintf("steps[%d].expect", i), st.Expect)
+	}
+	r.Setup.Exports = slices.Clone(s.Setup.Exports)
+	for i := range r.Setup.Exports {
+		required(fmt.Sprintf("setup.exports[%d].resource", i), &r.Setup.Exports[i].Resource)
+	}
+	r.Setup.WaitFor = resolveExpect("setup.waitFor", s.Setup.WaitFor)
+	r.Snapshots = slices.Clone(s.Snapshots)
+	for i := range r.Snapshots {
+		resolveRef(&r.Snapshots[i].Resource)
+	}
+	r.ForbiddenMutations = slices.Clone(s.ForbiddenMutations)
+	for i := range r.ForbiddenMutations {
+		sel := &r.ForbiddenMutations[i].Resources
+		sel.Namespace = resolve(sel.APIVersion, sel.Kind, sel.Namespace)
+	}
+	resolveChange := func(field string, c *OrderedChange) {
+		if c.Resource != nil {
+			ref := *c.Resource
+			required(field+".resource", &ref)
+			c.Resource = &ref
+		}
+		if c.Event != nil {
+			ev := *c.Event
+			resolveRef(&ev.InvolvedObject)
+			if ev.InvolvedObject.Namespace == "" {
+				ev.Namespace = orDefault(ev.Namespace)
+			}
+			c.Event = &ev
+		}
+	}
+	r.ExpectOrder = slices.Clone(s.ExpectOrder)
+	for i := range r.ExpectOrder {
+		o := &r.ExpectOrder[i]
+		resolveChange(fmt.Sprintf("expectOrder[%d].before", i), &o.Before)
+		resolveChange(fmt.Sprintf("expectOrder[%d].after", i), &o.After)
+	}
+	r.Churn = slices.Clone(s.Churn)
+	for i := range r.Churn {
+		sel := &r.Churn[i].Resources
+		sel.Namespace = resolve(sel.APIVersion, sel.Kind, sel.Namespace)
+	}
+	if s.Teardown != nil {
+		t := *s.Teardown
+		t.Patches = slices.Clone(t.Patches)
+		for i := range t.Patches {
+			resolveRef(&t.Patches[i].ResourceRef)
+		}
+		t.Exec = slices.Clone(t.Exec)
+		for i := range t.Exec {
+			t.Exec[i].Namespace = orDefault(t.Exec[i].Namespace)
+		}
+		r.Teardown = &t
+	}
+	if s.Tenants != nil {
+		t := *s.Tenants
+		t.From = orDefault(t.From)
+		r.Tenants = &t
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return &r, nil
+}
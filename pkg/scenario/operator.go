@@ -0,0 +1,268 @@
+package scenario
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Operator is how a condition compares the value at its path with the
+// value it expects.
+type Operator string
+
+const (
+	// OperatorEq is met when the values are equal, compared in their JSON
+	// form so numbers compare by value. It is the default.
+	OperatorEq Operator = "eq"
+	// OperatorNe is met when the values differ or the field is not set.
+	OperatorNe Operator = "ne"
+	// OperatorGt, OperatorGte, OperatorLt and OperatorLte compare numbers.
+	// Quantities such as "500m" compare by value.
+	OperatorGt  Operator = "gt"
+	OperatorGte Operator = "gte"
+	OperatorLt  Operator = "lt"
+	OperatorLte Operator = "lte"
+	// OperatorIn is met when the value equals one of the expected list.
+	OperatorIn Operator = "in"
+	// OperatorContains is met when a string contains the expected string,
+	// or a list has an element equal to the expected value.
+	OperatorContains Operator = "contains"
+	// OperatorRegex is met when a string matches the expected regular
+	// expression.
+	OperatorRegex Operator = "regex"
+	// OperatorExists is met when the field is set, whatever its value. It
+	// expects no value.
+	OperatorExists Operator = "exists"
+	// OperatorWithin is met when a timestamp, such as
+	// .status.lastScaleTime, lies no further back than the expected
+	// duration, such as "5m".
+	OperatorWithin Operator = "within"
+)
+
+var operators = []Operator{
+	OperatorEq, OperatorNe, OperatorGt, OperatorGte, OperatorLt, OperatorLte,
+	OperatorIn, OperatorContains, OperatorRegex, OperatorExists, OperatorWithin,
+}
+
+// OperatorOrDefault returns Operator, falling back to OperatorEq.
+func (c Condition) OperatorOrDefault() Operator {
+	if c.Operator == "" {
+		return OperatorEq
+	}
+	return c.Operator
+}
+
+// Compare reports whether actual, the value at the condition's path, meets
+// the condition given want, the value it expects; found is false when the
+// field is not set. It fails when the values cannot be compared with the
+// condition's operator, such as a string with gt.
+func (c Condition) Compare(want, actual any, found bool) (bool, error) {
+	op := c.OperatorOrDefault()
+	switch op {
+	case OperatorExists:
+		return found, nil
+	case OperatorNe:
+		return !found || !ValuesEqual(want, actual), nil
+	}
+	if !found {
+		return false, nil
+	}
+	switch op {
+	case OperatorGt, OperatorGte, OperatorLt, OperatorLte:
+		w, err := number(want)
+		if err != nil {
+			return false, fmt.Errorf("expected value: %w", err)
+		}
+		a, err := number(actual)
+		if err != nil {
+			return false, err
+		}
+		switch op {
+		case OperatorGt:
+			return a > w, nil
+		case OperatorGte:
+			return a >= w, nil
+		case OperatorLt:
+			return a < w, nil
+		}
+		return a <= w, nil
+	case OperatorIn:
+		list, ok := want.([]any)
+		if !ok {
+			return false, fmt.Errorf("in expects a list, not %v", want)
+		}
+		for _, w := range list {
+			if ValuesEqual(w, actual) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case OperatorContains:
+		switch a := actual.(type) {
+		case string:
+			w, ok := want.(string)
+			if !ok {
+				return false, fmt.Errorf("a string contains strings, not %v", want)
+			}
+			return strings.Contains(a, w), nil
+		case []any:
+			for _, e := range a {
+				if ValuesEqual(want, e) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+		return false, fmt.Errorf("contains needs a string or list, not %v", actual)
+	case OperatorRegex:
+		w, ok := want.(string)
+		if !ok {
+			return false, fmt.Errorf("regex expects a string, not %v", want)
+		}
+		re, err := regexp.Compile(w)
+		if err != nil {
+			return false, err
+		}
+		a, ok := actual.(string)
+		if !ok {
+			return false, fmt.Errorf("regex needs a string, not %v", actual)
+		}
+		return re.MatchString(a), nil
+	case OperatorWithin:
+		w, err := duration(want)
+		if err != nil {
+			return false, fmt.Errorf("expected value: %w", err)
+		}
+		a, ok := actual.(string)
+		if !ok {
+			return false, fmt.Errorf("within needs a timestamp, not %v", actual)
+		}
+		t, err := time.Parse(time.RFC3339, a)
+		if err != nil {
+			return false, fmt.Errorf("within needs a timestamp: %w", err)
+		}
+		return time.Since(t) <= w, nil
+	}
+	return ValuesEqual(want, actual), nil
+}
+
+// Want describes what the condition expects given want, for output, such
+// as 3 or "<= 3".
+func (c Condition) Want(want any) any {
+	switch op := c.OperatorOrDefault(); op {
+	case OperatorEq:
+		return want
+	case OperatorExists:
+		return "to exist"
+	case OperatorNe:
+		return fmt.Sprintf("!= %v", want)
+	case OperatorGt:
+		return fmt.Sprintf("> %v", want)
+	case OperatorGte:
+		return fmt.Sprintf(">= %v", want)
+	case OperatorLt:
+		return fmt.Sprintf("< %v", want)
+	case OperatorLte:
+		return fmt.Sprintf("<= %v", want)
+	case OperatorRegex:
+		return fmt.Sprintf("matching %v", want)
+	default:
+		return fmt.Sprintf("%s %v", op, want)
+	}
+}
+
+func (c Condition) validateOperator() error {
+	op := c.OperatorOrDefault()
+	var known bool
+	for _, o := range operators {
+		known = known || o == op
+	}
+	if !known {
+		return fmt.Errorf("operator: %q is not one of %v", c.Operator, operators)
+	}
+	if op == OperatorExists {
+		if c.Value != nil || c.ValueFrom != nil {
+			return errors.New("operator exists expects no value or valueFrom")
+		}
+		return nil
+	}
+	if c.ValueFrom != nil {
+		return nil
+	}
+	// Values sourced at run time are checked when compared.
+	var err error
+	switch op {
+	case OperatorGt, OperatorGte, OperatorLt, OperatorLte:
+		_, err = number(c.Value)
+	case OperatorIn:
+		if _, ok := c.Value.([]any); !ok {
+			err = errors.New("in expects a list")
+		}
+	case OperatorRegex:
+		if s, ok := c.Value.(string); !ok {
+			err = errors.New("regex expects a string")
+		} else {
+			_, err = regexp.Compile(s)
+		}
+	case OperatorWithin:
+		_, err = duration(c.Value)
+	}
+	if err != nil {
+		return fmt.Errorf("value: %w", err)
+	}
+	return nil
+}
+
+// ValuesEqual compares two values in their JSON form, so that numeric
+// types (float64 from YAML, int64 from the API) compare by value.
+func ValuesEqual(a, b any) bool {
+	x, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	y, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(x) == string(y)
+}
+
+// duration returns the value of a duration such as "5m".
+func duration(v any) (time.Duration, error) {
+	s, ok := v.(string)
+	if !ok {
+		return 0, fmt.Errorf("%v is not a duration", v)
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration %s must be positive", s)
+	}
+	return d, nil
+}
+
+// number returns the value of a number or quantity.
+func number(v any) (float64, error) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		q, err := resource.ParseQuantity(v)
+		if err != nil {
+			return 0, fmt.Errorf("%q is neither a number nor a quantity", v)
+		}
+		return q.AsApproximateFloat64(), nil
+	}
+	return 0, fmt.Errorf("%v is not a number", v)
+}
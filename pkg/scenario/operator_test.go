@@ -0,0 +1,73 @@
+package scenario
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConditionCompare(t *testing.T) {
+	recent := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	old := time.Now().Add(-10 * time.Minute).UTC().Format(time.RFC3339)
+	tests := []struct {
+		name    string
+		op      Operator
+		want    any
+		actual  any
+		missing bool
+		met     bool
+		err     bool
+	}{
+		{name: "eq by default", want: float64(3), actual: int64(3), met: true},
+		{name: "eq differs", op: OperatorEq, want: "a", actual: "b"},
+		{name: "eq on a missing field", op: OperatorEq, want: "a", missing: true},
+
+		{name: "ne differs", op: OperatorNe, want: "a", actual: "b", met: true},
+		{name: "ne equal numbers", op: OperatorNe, want: float64(3), actual: int64(3)},
+		{name: "ne on a missing field", op: OperatorNe, want: "a", missing: true, met: true},
+
+		{name: "quantity gt number", op: OperatorGt, want: 0.4, actual: "500m", met: true},
+		{name: "quantity lt number", op: OperatorLt, want: 0.4, actual: "500m"},
+		{name: "number gte quantity", op: OperatorGte, want: "500m", actual: 0.4},
+		{name: "quantity lte quantity", op: OperatorLte, want: "1Gi", actual: "1024Mi", met: true},
+		{name: "gt on a missing field", op: OperatorGt, want: 1, missing: true},
+		{name: "gt on a string", op: OperatorGt, want: 1, actual: "high", err: true},
+
+		{name: "in the list", op: OperatorIn, want: []any{"Running", "Succeeded"}, actual: "Succeeded", met: true},
+		{name: "in compares numbers by value", op: OperatorIn, want: []any{float64(1), float64(3)}, actual: int64(3), met: true},
+		{name: "not in the list", op: OperatorIn, want: []any{"Running"}, actual: "Pending"},
+		{name: "in without a list", op: OperatorIn, want: "Running", actual: "Running", err: true},
+
+		{name: "list contains", op: OperatorContains, want: "b", actual: []any{"a", "b"}, met: true},
+		{name: "list contains an object", op: OperatorContains, want: map[string]any{"type": "Ready"}, actual: []any{map[string]any{"type": "Ready"}}, met: true},
+		{name: "list lacks", op: OperatorContains, want: "c", actual: []any{"a", "b"}},
+		{name: "string contains", op: OperatorContains, want: "ready", actual: "not ready", met: true},
+		{name: "string contains a number", op: OperatorContains, want: 1, actual: "1", err: true},
+		{name: "contains on a number", op: OperatorContains, want: 1, actual: int64(1), err: true},
+
+		{name: "regex matches", op: OperatorRegex, want: "^v1\\.[0-9]+$", actual: "v1.29", met: true},
+		{name: "regex does not match", op: OperatorRegex, want: "^v2", actual: "v1.29"},
+		{name: "regex on a number", op: OperatorRegex, want: "1", actual: int64(1), err: true},
+		{name: "invalid regex", op: OperatorRegex, want: "(", actual: "x", err: true},
+
+		{name: "within", op: OperatorWithin, want: "5m", actual: recent, met: true},
+		{name: "not within", op: OperatorWithin, want: "5m", actual: old},
+		{name: "within on a missing field", op: OperatorWithin, want: "5m", missing: true},
+		{name: "within on a non-timestamp", op: OperatorWithin, want: "5m", actual: "yesterday", err: true},
+		{name: "within a non-duration", op: OperatorWithin, want: "soon", actual: recent, err: true},
+
+		{name: "exists", op: OperatorExists, actual: false, met: true},
+		{name: "exists on a missing field", op: OperatorExists, missing: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Condition{Operator: tt.op}
+			met, err := c.Compare(tt.want, tt.actual, !tt.missing)
+			if (err != nil) != tt.err {
+				t.Fatalf("Compare() error = %v, want error %v", err, tt.err)
+			}
+			if met != tt.met {
+				t.Errorf("Compare() = %v, want %v", met, tt.met)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// OrderExpectation requires one change to happen before another, for the
+// coordination of agents that act on each other's results:
+//
+//	expectOrder:
+//	- description: quota recorded before the scale-out
+//	  before:
+//	    agent: quota-agent
+//	    resource: {apiVersion: v1, kind: Namespace, name: shop}
+//	    field: metadata.annotations
+//	  after:
+//	    agent: scaling-agent
+//	    resource: {apiVersion: apps/v1, kind: Deployment, name: web, namespace: shop}
+//	    field: spec.replicas
+//
+// It is checked once the expectations are met. Both changes must have
+// happened since the scenario started. Their times have second precision,
+// so changes within the same second count as ordered.
+type OrderExpectation struct {
+	// ID identifies the expectation in output and reports.
+	ID string `json:"id,omitempty"`
+	// Description says what the order shows; output shows it in place of
+	// the changes.
+	Description string        `json:"description,omitempty"`
+	Before      OrderedChange `json:"before"`
+	After       OrderedChange `json:"after"`
+}
+
+// OrderedChange is a change an agent made to a resource, dated by the
+// agent's managedFields entry on it, or an Event, dated by when it was
+// first recorded. Either Agent and Resource, or Event, is set.
+type OrderedChange struct {
+	// Agent names an agent of the scenario.
+	Agent    string       `json:"agent,omitempty"`
+	Resource *ResourceRef `json:"resource,omitempty"`
+	// Field, if set, is a field the agent's entry must own, as a dotted
+	// path of field names such as spec.replicas. The entry dates the
+	// agent's last change to any of the fields it owns.
+	Field string `json:"field,omitempty"`
+	// Event is an Event that marks the change.
+	Event *EventExpectation `json:"event,omitempty"`
+}
+
+// String describes the change for output.
+func (c *OrderedChange) String() string {
+	if c.Event != nil {
+		return c.Event.Label()
+	}
+	s := fmt.Sprintf("change by %s to %s", c.Agent, c.Resource)
+	if c.Field != "" {
+		s += " " + c.Field
+	}
+	return s
+}
+
+// FieldPath returns the field names of Field.
+func (c *OrderedChange) FieldPath() []string {
+	if c.Field == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimPrefix(c.Field, "."), ".")
+}
+
+// Label returns how output names the expectation: its description, ID,
+// or the changes it orders.
+func (o *OrderExpectation) Label() string {
+	switch {
+	case o.Description != "":
+		return o.Description
+	case o.ID != "":
+		return o.ID
+	}
+	return fmt.Sprintf("%s before %s", &o.Before, &o.After)
+}
+
+func (o *OrderExpectation) validate(s *Scenario) error {
+	var errs []error
+	if err := o.Before.validate(s); err != nil {
+		errs = append(errs, fmt.Errorf("before: %w", err))
+	}
+	if err := o.After.validate(s); err != nil {
+		errs = append(errs, fmt.Errorf("after: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+func (c *OrderedChange) validate(s *Scenario) error {
+	if c.Event != nil {
+		if c.Agent != "" || c.Resource != nil || c.Field != "" {
+			return errors.New("event cannot be combined with agent, resource or field")
+		}
+		if err := c.Event.validate(); err != nil {
+			return fmt.Errorf("event: %w", err)
+		}
+		return nil
+	}
+	var errs []error
+	if c.Agent == "" {
+		errs = append(errs, errors.New("agent or event is required"))
+	} else if !slices.Contains(s.Agents, c.Agent) {
+		errs = append(errs, fmt.Errorf("agent %q is not one of the scenario's agents", c.Agent))
+	}
+	if c.Resource == nil {
+		errs = append(errs, errors.New("resource is required with agent"))
+	} else if err := c.Resource.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("resource: %w", err))
+	}
+	if slices.Contains(c.FieldPath(), "") {
+		errs = append(errs, fmt.Errorf("field %q: empty segment", c.Field))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,43 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// Preflight asserts what the cluster must provide for the scenario to be
+// winnable. It is checked once before anything is deployed, and a scenario
+// whose preflight fails errors out at once instead of waiting for its
+// timeout.
+type Preflight struct {
+	// MinKubernetesVersion is the oldest API server version the scenario
+	// supports, such as "1.29".
+	MinKubernetesVersion string `json:"minKubernetesVersion,omitempty"`
+	// MinNodes is how many ready nodes the cluster must have.
+	MinNodes int `json:"minNodes,omitempty"`
+	// AgentsAbsent names agents that must not already run in the cluster,
+	// such as copies installed outside the framework that would race the
+	// scenario's: no Deployment may carry one of the names in its
+	// app.kubernetes.io/name or agent label.
+	AgentsAbsent []string `json:"agentsAbsent,omitempty"`
+}
+
+func (p *Preflight) validate() error {
+	var errs []error
+	if v := p.MinKubernetesVersion; v != "" {
+		if _, err := version.ParseGeneric(v); err != nil {
+			errs = append(errs, fmt.Errorf("minKubernetesVersion: %w", err))
+		}
+	}
+	if p.MinNodes < 0 {
+		errs = append(errs, errors.New("minNodes must not be negative"))
+	}
+	for i, name := range p.AgentsAbsent {
+		if name == "" {
+			errs = append(errs, fmt.Errorf("agentsAbsent[%d] is empty", i))
+		}
+	}
+	return errors.Join(errs...)
+}
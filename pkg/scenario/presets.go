@@ -0,0 +1,122 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// PresetName names the objects of setup presets that do not set a name.
+const PresetName = "kube-agents-test"
+
+// QuotaPreset is a ResourceQuota in the scenario's namespace, declared by
+// its hard limits, e.g. {pods: 10, requests.cpu: "2"}.
+type QuotaPreset struct {
+	// Name defaults to PresetName.
+	Name string                       `json:"name,omitempty"`
+	Hard map[string]resource.Quantity `json:"hard"`
+}
+
+// LimitRangePreset is a LimitRange in the scenario's namespace that bounds
+// and defaults the resources of each container.
+type LimitRangePreset struct {
+	// Name defaults to PresetName.
+	Name string `json:"name,omitempty"`
+	// Default is the limits of containers that set none.
+	Default map[string]resource.Quantity `json:"default,omitempty"`
+	// DefaultRequest is the requests of containers that set none.
+	DefaultRequest map[string]resource.Quantity `json:"defaultRequest,omitempty"`
+	Min            map[string]resource.Quantity `json:"min,omitempty"`
+	Max            map[string]resource.Quantity `json:"max,omitempty"`
+}
+
+// NamespaceOrDefault returns Namespace, falling back to "default".
+func (s *Scenario) NamespaceOrDefault() string {
+	if s.Namespace == "" {
+		return "default"
+	}
+	return s.Namespace
+}
+
+// HasPresets reports whether the setup installs any preset.
+func (s *Setup) HasPresets() bool {
+	return s.Quota != nil || s.LimitRange != nil
+}
+
+// PresetObjects renders the setup presets, in the scenario's namespace if
+// it sets one.
+func (s *Scenario) PresetObjects() []map[string]any {
+	var objs []map[string]any
+	object := func(kind, name string, spec map[string]any) map[string]any {
+		if name == "" {
+			name = PresetName
+		}
+		meta := map[string]any{"name": name}
+		if s.Namespace != "" {
+			meta["namespace"] = s.Namespace
+		}
+		return map[string]any{"apiVersion": "v1", "kind": kind, "metadata": meta, "spec": spec}
+	}
+	if q := s.Setup.Quota; q != nil {
+		objs = append(objs, object("ResourceQuota", q.Name, map[string]any{"hard": quantities(q.Hard)}))
+	}
+	if l := s.Setup.LimitRange; l != nil {
+		limit := map[string]any{"type": "Container"}
+		for field, list := range map[string]map[string]resource.Quantity{
+			"default":        l.Default,
+			"defaultRequest": l.DefaultRequest,
+			"min":            l.Min,
+			"max":            l.Max,
+		} {
+			if len(list) > 0 {
+				limit[field] = quantities(list)
+			}
+		}
+		objs = append(objs, object("LimitRange", l.Name, map[string]any{"limits": []any{limit}}))
+	}
+	return objs
+}
+
+func quantities(list map[string]resource.Quantity) map[string]any {
+	m := make(map[string]any, len(list))
+	for name, q := range list {
+		m[name] = q.String()
+	}
+	return m
+}
+
+func (q *QuotaPreset) validate() error {
+	var errs []error
+	if len(q.Hard) == 0 {
+		errs = append(errs, errors.New("hard is required"))
+	}
+	errs = append(errs, validatePresetName(q.Name)...)
+	return errors.Join(errs...)
+}
+
+func (l *LimitRangePreset) validate() error {
+	var errs []error
+	if len(l.Default)+len(l.DefaultRequest)+len(l.Min)+len(l.Max) == 0 {
+		errs = append(errs, errors.New("one of default, defaultRequest, min, and max is required"))
+	}
+	for name, max := range l.Max {
+		if min, ok := l.Min[name]; ok && min.Cmp(max) > 0 {
+			errs = append(errs, fmt.Errorf("min %s exceeds max", name))
+		}
+	}
+	errs = append(errs, validatePresetName(l.Name)...)
+	return errors.Join(errs...)
+}
+
+func validatePresetName(name string) []error {
+	if name == "" {
+		return nil
+	}
+	var errs []error
+	for _, msg := range validation.IsDNS1123Subdomain(name) {
+		errs = append(errs, fmt.Errorf("name: %s", msg))
+	}
+	return errs
+}
@@ -0,0 +1,135 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var commitSHA = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// gitSource is a parsed git source: the repository URL, a directory
+// within it, and the ref to check out (empty for the default branch).
+type gitSource struct {
+	repo, dir, ref string
+}
+
+func parseGit(src string) (gitSource, error) {
+	u, err := url.Parse(src)
+	if err != nil {
+		return gitSource{}, err
+	}
+	var s gitSource
+	s.ref = u.Query().Get("ref")
+	u.RawQuery = ""
+	if repoPath, dir, ok := strings.Cut(u.Path, "//"); ok {
+		u.Path = repoPath
+		s.dir = filepath.Clean(filepath.FromSlash(dir))
+		if !filepath.IsLocal(s.dir) {
+			return gitSource{}, fmt.Errorf("%s: directory %q is outside the repository", src, dir)
+		}
+	}
+	if u.Scheme == "" || (u.Host == "" && u.Scheme != "file") {
+		return gitSource{}, fmt.Errorf("%s: want git+<scheme>://<host>/<repo>[//<dir>][?ref=<ref>]", src)
+	}
+	s.repo = u.String()
+	return s, nil
+}
+
+// fetchGit checks out the source's ref into the cache, keyed by the commit
+// it resolves to. Refs given as full commit SHAs need no network access
+// once cached; branches and tags are resolved on every fetch.
+func (f *Fetcher) fetchGit(ctx context.Context, src string) (string, error) {
+	s, err := parseGit(src)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(s.repo))
+	repoDir := filepath.Join(f.cacheDir, "git", hex.EncodeToString(sum[:8]))
+
+	commit := s.ref
+	if !commitSHA.MatchString(commit) {
+		if commit, err = resolveRef(ctx, s.repo, s.ref); err != nil {
+			return "", err
+		}
+	}
+	dir := filepath.Join(repoDir, commit)
+	if !exists(dir) {
+		if err := os.MkdirAll(repoDir, 0o755); err != nil {
+			return "", err
+		}
+		tmp, err := os.MkdirTemp(repoDir, "fetch-")
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(tmp)
+		if err := checkout(ctx, tmp, s.repo, commit); err != nil {
+			return "", err
+		}
+		if err := install(tmp, dir); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, s.dir), nil
+}
+
+// resolveRef returns the commit ref points at in repo, peeling annotated
+// tags.
+func resolveRef(ctx context.Context, repo, ref string) (string, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	out, err := git(ctx, "", "ls-remote", repo, ref, ref+"^{}")
+	if err != nil {
+		return "", err
+	}
+	var commit string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		sha, name, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		if commit == "" || strings.HasSuffix(name, "^{}") {
+			commit = sha
+		}
+	}
+	if commit == "" {
+		return "", fmt.Errorf("ref %q not found in %s", ref, repo)
+	}
+	return commit, nil
+}
+
+// checkout fetches commit from repo into dir, without history.
+func checkout(ctx context.Context, dir, repo, commit string) error {
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"fetch", "-q", "--depth", "1", repo, commit},
+		{"checkout", "-q", "FETCH_HEAD"},
+	} {
+		if _, err := git(ctx, dir, args...); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(filepath.Join(dir, ".git"))
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
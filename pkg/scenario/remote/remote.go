@@ -0,0 +1,104 @@
+// Package remote fetches scenario bundles published outside the repository
+// that runs them, so a platform team can publish certified suites that many
+// agent repositories consume. A bundle is a directory of scenarios and
+// their fixtures, referenced as
+//
+//	git+https://github.com/org/suites.git//scaling?ref=v1.2.0
+//	oci://registry.example.com/org/suites:v1.2.0
+//	oci://registry.example.com/org/suites@sha256:<digest>
+//
+// Git sources name a repository, an optional directory within it after
+// "//", and a branch, tag, or commit; OCI sources name an artifact pushed
+// with e.g. oras push. Fetched bundles are cached by commit or digest, so
+// sources pinned to one are only downloaded once and then work offline.
+package remote
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	gitPrefix = "git+"
+	ociPrefix = "oci://"
+)
+
+// IsRemote reports whether src references a remote bundle rather than a
+// local path.
+func IsRemote(src string) bool {
+	return strings.HasPrefix(src, gitPrefix) || strings.HasPrefix(src, ociPrefix)
+}
+
+// DefaultCacheDir is where bundles are cached unless WithCacheDir is used:
+// kube-agents-test/sources under the user's cache directory.
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "kube-agents-test", "sources")
+}
+
+// Fetcher downloads remote bundles into a local cache.
+type Fetcher struct {
+	cacheDir string
+}
+
+// Option configures a Fetcher.
+type Option func(*Fetcher)
+
+// WithCacheDir sets where fetched bundles are kept.
+func WithCacheDir(dir string) Option {
+	return func(f *Fetcher) { f.cacheDir = dir }
+}
+
+// New returns a Fetcher.
+func New(opts ...Option) *Fetcher {
+	f := &Fetcher{cacheDir: DefaultCacheDir()}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// Fetch makes the bundle src references available locally and returns its
+// directory, which must not be modified.
+func (f *Fetcher) Fetch(ctx context.Context, src string) (string, error) {
+	var dir string
+	var err error
+	switch {
+	case strings.HasPrefix(src, gitPrefix):
+		dir, err = f.fetchGit(ctx, strings.TrimPrefix(src, gitPrefix))
+	case strings.HasPrefix(src, ociPrefix):
+		dir, err = f.fetchOCI(ctx, strings.TrimPrefix(src, ociPrefix))
+	default:
+		return "", fmt.Errorf("%s: not a remote source", src)
+	}
+	if err != nil {
+		return "", fmt.Errorf("fetching %s: %w", src, err)
+	}
+	return dir, nil
+}
+
+// install moves a completely fetched bundle from tmp to dir. When another
+// process installed the same content first, its copy wins.
+func install(tmp, dir string) error {
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		if _, statErr := os.Stat(dir); statErr == nil {
+			return os.RemoveAll(tmp)
+		}
+		return err
+	}
+	return nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,32 @@
+package scenario
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Error classes of expectation reads, for Expectation.RetryOn.
+const (
+	ErrorNotFound  = "NotFound"
+	ErrorForbidden = "Forbidden"
+	ErrorTimeout   = "Timeout"
+)
+
+// ErrorClasses lists the error classes RetryOn can name.
+var ErrorClasses = []string{ErrorNotFound, ErrorForbidden, ErrorTimeout}
+
+// Retries reports whether reads of the expectation failing with an error
+// of class keep being polled.
+func (e Expectation) Retries(class string) bool {
+	return e.RetryOn == nil || slices.Contains(e.RetryOn, class)
+}
+
+func validateRetryOn(retryOn []string) []error {
+	var errs []error
+	for i, class := range retryOn {
+		if !slices.Contains(ErrorClasses, class) {
+			errs = append(errs, fmt.Errorf("retryOn[%d]: %q is not one of %v", i, class, ErrorClasses))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,39 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ScaleTrigger sets the replicas of a resource through its scale
+// subresource, like kubectl scale. Unlike a patch of .spec.replicas, this
+// works for any kind with a scale subresource, wherever it keeps its
+// replica count.
+type ScaleTrigger struct {
+	// APIVersion may be left out when Kind alone names one kind, e.g.
+	// Deployment.
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace,omitempty"`
+	Replicas   int32  `json:"replicas"`
+}
+
+// Ref returns the resource being scaled.
+func (sc *ScaleTrigger) Ref() ResourceRef {
+	return ResourceRef{APIVersion: sc.APIVersion, Kind: sc.Kind, Name: sc.Name, Namespace: sc.Namespace}
+}
+
+func (sc *ScaleTrigger) validate() []error {
+	var errs []error
+	if sc.Kind == "" {
+		errs = append(errs, errors.New("trigger.scale.kind is required"))
+	}
+	if sc.Name == "" {
+		errs = append(errs, errors.New("trigger.scale.name is required"))
+	}
+	if sc.Replicas < 0 {
+		errs = append(errs, fmt.Errorf("trigger.scale.replicas: %d is negative", sc.Replicas))
+	}
+	return errs
+}
@@ -0,0 +1,716 @@
+// Package scenario defines the declarative test scenario format: the initial
+// cluster state, an optional trigger, and the state the agents are expected to
+// converge to.
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// DefaultTimeout bounds convergence when a scenario does not set one.
+const DefaultTimeout = 2 * time.Minute
+
+// Scenario is one declarative test case.
+type Scenario struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+
+	// Agents lists the agents that take part in the scenario.
+	Agents []string `json:"agents,omitempty"`
+
+	// Vars are defaults for the variables the scenario file uses as a
+	// template. Once loaded, they hold the values the file was rendered
+	// with, supplied ones included.
+	Vars map[string]string `json:"vars,omitempty"`
+
+	// DependsOn names scenarios that must pass before this one runs.
+	DependsOn []string `json:"dependsOn,omitempty"`
+
+	// Namespace is where the namespaced resources the scenario names
+	// without a namespace live. Unset, setup objects and triggers fall
+	// back to "default", and expectations must name their namespace.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Preflight is checked before the scenario is set up.
+	Preflight *Preflight `json:"preflight,omitempty"`
+
+	Setup   Setup         `json:"setup,omitempty"`
+	Trigger *Trigger      `json:"trigger,omitempty"`
+	Expect  []Expectation `json:"expect"`
+	// ExpectEvents are Events the agents must record by the timeout,
+	// alongside the expectations.
+	ExpectEvents []EventExpectation `json:"expectEvents,omitempty"`
+	// ExpectMetrics are comparisons over the metrics agents expose that
+	// must hold by the timeout, alongside the expectations.
+	ExpectMetrics []MetricExpectation `json:"expectMetrics,omitempty"`
+	// ExpectDenied are mutations admission must reject, attempted once the
+	// expectations and steps are met.
+	ExpectDenied []DenialExpectation `json:"expectDenied,omitempty"`
+	// ExpectEvictions are pod evictions that must be blocked or allowed,
+	// attempted once the expectations and steps are met.
+	ExpectEvictions []EvictionExpectation `json:"expectEvictions,omitempty"`
+
+	// Steps follow the trigger and expectations above in order, each
+	// firing its trigger once the previous step's expectations are met.
+	Steps []Step `json:"steps,omitempty"`
+
+	// Teardown cleans up once the scenario is done, whether it passed or
+	// not.
+	Teardown *Teardown `json:"teardown,omitempty"`
+
+	// Snapshots compare resources with golden files once the
+	// expectations are met.
+	Snapshots []Snapshot `json:"snapshots,omitempty"`
+
+	// ForbiddenMutations lists resources agents must leave alone.
+	ForbiddenMutations []ForbiddenMutation `json:"forbiddenMutations,omitempty"`
+
+	// ExpectOrder requires changes of agents, or Events, to have happened
+	// in order once the expectations are met.
+	ExpectOrder []OrderExpectation `json:"expectOrder,omitempty"`
+
+	// Churn bounds how often resources may change, and how their fields
+	// may move, while the agents converge.
+	Churn []ChurnLimit `json:"churn,omitempty"`
+
+	// APIFaults are injected into the agents' API requests for the whole
+	// scenario.
+	APIFaults []APIFault `json:"apiFaults,omitempty"`
+
+	// Tenants runs the scenario once per tenant namespace, concurrently.
+	Tenants *Tenants `json:"tenants,omitempty"`
+
+	// Load creates objects at a fixed rate after the trigger, measuring
+	// how the agents keep up.
+	Load *LoadTest `json:"load,omitempty"`
+
+	// Timeout bounds how long expectations may take to be met.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// Dir is the directory the scenario was loaded from. Manifest paths are
+	// resolved relative to it.
+	Dir string `json:"-"`
+}
+
+// Setup describes the initial cluster state.
+type Setup struct {
+	// Manifests are paths to YAML files applied before the trigger.
+	Manifests []string `json:"manifests,omitempty"`
+	// Generate creates synthetic resources once the manifests are applied.
+	Generate []Generator `json:"generate,omitempty"`
+	// ControlNamespace seeds a copy of every namespaced setup object in
+	// this namespace, which the agents must ignore. The scenario fails if
+	// a copy was changed, deleted, or written to by one of its agents,
+	// catching agents that watch more than they should.
+	ControlNamespace string `json:"controlNamespace,omitempty"`
+	// Quota installs a ResourceQuota in the scenario's namespace before
+	// the manifests are applied.
+	Quota *QuotaPreset `json:"quota,omitempty"`
+	// LimitRange installs a LimitRange in the scenario's namespace before
+	// the manifests are applied.
+	LimitRange *LimitRangePreset `json:"limitRange,omitempty"`
+	// Exports read values from the setup objects once they are applied,
+	// for the triggers and expectations to refer to.
+	Exports []Export `json:"exports,omitempty"`
+	// WaitFor holds states the setup objects must reach before the
+	// trigger fires, such as the fixture's Deployments being rolled out,
+	// so triggers do not race ahead of the setup. They are checked like
+	// expectations, within their own timeout or the scenario's.
+	WaitFor []Expectation `json:"waitFor,omitempty"`
+}
+
+// Trigger is the mutation that kicks off agent activity. Written as a
+// list, it is a sequence of triggers fired in order; see List.
+type Trigger struct {
+	// Delay waits before the trigger fires, e.g. to space out the
+	// triggers of a list.
+	Delay *metav1.Duration `json:"delay,omitempty"`
+	Patch *ResourcePatch   `json:"patch,omitempty"`
+	// Metadata sets or removes labels and annotations on a resource, after
+	// the patch is applied.
+	Metadata *MetadataTrigger `json:"metadata,omitempty"`
+	// Scale sets the replicas of a resource, after the metadata change.
+	Scale *ScaleTrigger `json:"scale,omitempty"`
+	// HTTP calls an endpoint in the cluster, after the scale.
+	HTTP *HTTPTrigger `json:"http,omitempty"`
+	// Exec runs a command in a workload pod, after the HTTP call.
+	Exec *ExecTrigger `json:"exec,omitempty"`
+	// Event records an Event about a resource, after the command.
+	Event *EventTrigger `json:"event,omitempty"`
+	// AdvanceClock moves the fake clock of agents that support it forward,
+	// after the patch is applied. See package fakeclock.
+	AdvanceClock *metav1.Duration `json:"advanceClock,omitempty"`
+	// Drain cordons and drains a node, after the patch is applied. The node
+	// is uncordoned when the scenario ends.
+	Drain *NodeDrain `json:"drain,omitempty"`
+	// Chaos disrupts agents while expectations are awaited.
+	Chaos *Chaos `json:"chaos,omitempty"`
+	// List holds the triggers of a trigger written as a list, fired in
+	// order, each after its Delay. See Triggers.
+	List []Trigger `json:"-"`
+}
+
+// NodeDrain cordons a node and evicts its pods, like kubectl drain
+// --ignore-daemonsets.
+type NodeDrain struct {
+	Node string `json:"node"`
+	// CordonOnly marks the node unschedulable without evicting pods.
+	CordonOnly bool `json:"cordonOnly,omitempty"`
+}
+
+// Chaos is a disruption injected while expectations are awaited, to verify
+// that the agents still converge. Exactly one action is set. Expectations
+// only count as met once the disruption is over.
+type Chaos struct {
+	// KillAgentPod names an agent of the scenario; one of its pods, picked
+	// at random, is deleted.
+	KillAgentPod string `json:"killAgentPod,omitempty"`
+	// PartitionAgent names an agent of the scenario to cut off from the
+	// network, API server included, for Duration.
+	PartitionAgent string `json:"partitionAgent,omitempty"`
+	// Duration is how long a partition lasts; DefaultPartition if unset.
+	Duration *metav1.Duration `json:"duration,omitempty"`
+	// After delays the disruption from the start of the wait.
+	After *metav1.Duration `json:"after,omitempty"`
+}
+
+// DefaultPartition is how long a network partition lasts by default.
+const DefaultPartition = 30 * time.Second
+
+// PartitionOrDefault returns Duration, falling back to DefaultPartition.
+func (c *Chaos) PartitionOrDefault() time.Duration {
+	if c.Duration == nil || c.Duration.Duration <= 0 {
+		return DefaultPartition
+	}
+	return c.Duration.Duration
+}
+
+// Delay returns After, or zero when unset.
+func (c *Chaos) Delay() time.Duration {
+	if c.After == nil {
+		return 0
+	}
+	return c.After.Duration
+}
+
+// ResourcePatch merges Spec into the spec of an existing resource.
+type ResourcePatch struct {
+	ResourceRef `json:",inline"`
+	Spec        map[string]any `json:"spec"`
+}
+
+// ResourceRef identifies a single Kubernetes resource or, in the resource
+// of an expectation, the resources a label selector matches.
+type ResourceRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+	// LabelSelector selects the resources of the kind in the namespace
+	// whose labels match, in place of Name. Only expectations take it.
+	LabelSelector *metav1.LabelSelector `json:"labelSelector,omitempty"`
+}
+
+func (r ResourceRef) String() string {
+	if r.LabelSelector != nil {
+		return r.selectorString()
+	}
+	if r.Namespace == "" {
+		return fmt.Sprintf("%s/%s", r.Kind, r.Name)
+	}
+	return fmt.Sprintf("%s/%s/%s", r.Kind, r.Namespace, r.Name)
+}
+
+// Expectation is a state a resource must reach before the timeout, or,
+// with Absent, a resource that must not exist.
+type Expectation struct {
+	// ID identifies the expectation in output and reports.
+	ID string `json:"id,omitempty"`
+	// Description says what the expectation checks, such as "quota
+	// annotation applied"; output shows it in place of the resource.
+	Description string      `json:"description,omitempty"`
+	Resource    ResourceRef `json:"resource"`
+	Conditions  []Condition `json:"conditions,omitempty"`
+	// Matches is a partial object the resource must contain. Lists of
+	// objects match element by element on a merge key such as name or
+	// type; lists of scalars must contain the listed values.
+	Matches map[string]any `json:"matches,omitempty"`
+	// HPA is shorthand for conditions on the status of a
+	// HorizontalPodAutoscaler; see HPAStatus.
+	HPA *HPAStatus `json:"hpa,omitempty"`
+	// ObservedGeneration requires .status.observedGeneration to equal
+	// .metadata.generation: the resource's controller has processed its
+	// latest spec.
+	ObservedGeneration bool `json:"observedGeneration,omitempty"`
+	// GenerationStableFor requires the generation not to have changed for
+	// this long, measured from the first poll that saw it, so that agents
+	// still rewriting the spec do not pass.
+	GenerationStableFor *metav1.Duration `json:"generationStableFor,omitempty"`
+	// ConsistentlyFor requires the expectation, once met, to stay met at
+	// every poll for this long, so agents that reach the expected state
+	// and leave it again, such as by scaling up and straight back down,
+	// do not pass. It must be shorter than the expectation's timeout.
+	ConsistentlyFor *metav1.Duration `json:"consistentlyFor,omitempty"`
+	// Absent requires the resource not to exist by the timeout: never
+	// created, such as an object an agent must keep from being admitted,
+	// or deleted; with a label selector, no resource may match it. It
+	// cannot be combined with conditions, matches or the generation
+	// checks.
+	Absent bool `json:"absent,omitempty"`
+	// Aggregate says, for a resource given by label selector, which of the
+	// matching resources must meet the expectation: AggregateAll, the
+	// default, or AggregateAny. Either way at least one must match, unless
+	// Count allows none.
+	Aggregate string `json:"aggregate,omitempty"`
+	// Count, for a resource given by label selector, requires the number
+	// of matching resources to meet it. Conditions and matches, if any,
+	// still apply to the resources that match.
+	Count *Count `json:"count,omitempty"`
+	// RetryOn lists the error classes, of ErrorClasses, that keep reads
+	// of the resource polling. Reads failing with an error of another
+	// class fail the scenario at once; errors of no class are always
+	// retried. Every class is retried if unset.
+	RetryOn []string `json:"retryOn,omitempty"`
+	// Timeout bounds how long this expectation may take to be met, in
+	// place of the scenario's timeout, counted from the start of the wait.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// TimeoutOr returns the expectation's timeout, falling back to d.
+func (e Expectation) TimeoutOr(d time.Duration) time.Duration {
+	if e.Timeout == nil || e.Timeout.Duration <= 0 {
+		return d
+	}
+	return e.Timeout.Duration
+}
+
+// Label returns how output names the expectation: its description, ID,
+// or resource.
+func (e Expectation) Label() string {
+	switch {
+	case e.Description != "":
+		return e.Description
+	case e.ID != "":
+		return e.ID
+	}
+	return e.Resource.String()
+}
+
+// Condition compares the value at a JSONPath-like field path to Value, or
+// to the value ValueFrom sources, with Operator. Condition is shorthand for
+// the path and value of a status condition.
+type Condition struct {
+	// ID identifies the condition in output and reports.
+	ID string `json:"id,omitempty"`
+	// Description says what the condition checks; output shows it in
+	// place of the path.
+	Description string `json:"description,omitempty"`
+	// Path is a dotted field path such as .spec.replicas. List elements
+	// are selected by index, as in .status.conditions[0], or by a field,
+	// as in .status.conditions[?(@.type=="Ready")].
+	Path      string       `json:"path,omitempty"`
+	Value     any          `json:"value,omitempty"`
+	ValueFrom *ValueSource `json:"valueFrom,omitempty"`
+	// Operator is eq if unset; see Operator.
+	Operator  Operator         `json:"operator,omitempty"`
+	Condition *StatusCondition `json:"condition,omitempty"`
+}
+
+// Label returns how output names the condition: its description, ID, or
+// path.
+func (c Condition) Label() string {
+	switch {
+	case c.Description != "":
+		return c.Description
+	case c.ID != "":
+		return c.ID
+	case c.Condition != nil:
+		return c.Condition.Type + " condition"
+	}
+	return c.Path
+}
+
+// TimeoutOrDefault returns the scenario timeout, falling back to
+// DefaultTimeout.
+func (s *Scenario) TimeoutOrDefault() time.Duration {
+	if s.Timeout == nil || s.Timeout.Duration <= 0 {
+		return DefaultTimeout
+	}
+	return s.Timeout.Duration
+}
+
+// Validate checks the scenario for structural errors.
+func (s *Scenario) Validate() error {
+	var errs []error
+	if s.Name == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+	for _, dep := range s.DependsOn {
+		if dep == s.Name {
+			errs = append(errs, errors.New("dependsOn: scenario depends on itself"))
+		}
+	}
+	if s.Namespace != "" {
+		for _, msg := range validation.IsDNS1123Label(s.Namespace) {
+			errs = append(errs, fmt.Errorf("namespace: %s", msg))
+		}
+	}
+	if s.Preflight != nil {
+		if err := s.Preflight.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("preflight: %w", err))
+		}
+	}
+	if ns := s.Setup.ControlNamespace; ns != "" {
+		for _, msg := range validation.IsDNS1123Label(ns) {
+			errs = append(errs, fmt.Errorf("setup.controlNamespace: %s", msg))
+		}
+	}
+	if q := s.Setup.Quota; q != nil {
+		if err := q.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("setup.quota: %w", err))
+		}
+	}
+	if l := s.Setup.LimitRange; l != nil {
+		if err := l.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("setup.limitRange: %w", err))
+		}
+	}
+	for i := range s.Setup.Generate {
+		if err := s.Setup.Generate[i].validate(); err != nil {
+			errs = append(errs, fmt.Errorf("setup.generate[%d]: %w", i, err))
+		}
+	}
+	errs = append(errs, s.Setup.validateExports()...)
+	errs = append(errs, s.validateExpectations("setup.waitFor", s.Setup.WaitFor)...)
+	errs = append(errs, s.validateTrigger()...)
+	if len(s.APIFaults) > 0 && len(s.Agents) == 0 {
+		errs = append(errs, errors.New("apiFaults: the scenario has no agents to inject faults into"))
+	}
+	for i, sn := range s.Snapshots {
+		if err := sn.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("snapshots[%d]: %w", i, err))
+		}
+	}
+	for i := range s.ForbiddenMutations {
+		if err := s.ForbiddenMutations[i].validate(s); err != nil {
+			errs = append(errs, fmt.Errorf("forbiddenMutations[%d]: %w", i, err))
+		}
+	}
+	for i := range s.ExpectOrder {
+		if err := s.ExpectOrder[i].validate(s); err != nil {
+			errs = append(errs, fmt.Errorf("expectOrder[%d]: %w", i, err))
+		}
+	}
+	for i := range s.Churn {
+		if err := s.Churn[i].validate(); err != nil {
+			errs = append(errs, fmt.Errorf("churn[%d]: %w", i, err))
+		}
+	}
+	for i := range s.APIFaults {
+		if err := s.APIFaults[i].validate(); err != nil {
+			errs = append(errs, fmt.Errorf("apiFaults[%d]: %w", i, err))
+		}
+	}
+	if s.Tenants != nil {
+		if err := s.Tenants.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("tenants: %w", err))
+		}
+		errs = append(errs, s.tenantConflicts()...)
+	}
+	if s.Load != nil {
+		if err := s.Load.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("load: %w", err))
+		}
+		if s.Tenants != nil {
+			errs = append(errs, errors.New("tenants cannot be combined with load"))
+		}
+	}
+	errs = append(errs, s.validateExpect()...)
+	for i := range s.ExpectEvents {
+		if err := s.ExpectEvents[i].validate(); err != nil {
+			errs = append(errs, fmt.Errorf("expectEvents[%d]: %w", i, err))
+		}
+	}
+	for i := range s.ExpectMetrics {
+		errs = append(errs, s.ExpectMetrics[i].validate(s, fmt.Sprintf("expectMetrics[%d]", i))...)
+	}
+	for i := range s.ExpectDenied {
+		if err := s.ExpectDenied[i].validate(); err != nil {
+			errs = append(errs, fmt.Errorf("expectDenied[%d]: %w", i, err))
+		}
+	}
+	for i := range s.ExpectEvictions {
+		if err := s.ExpectEvictions[i].validate(); err != nil {
+			errs = append(errs, fmt.Errorf("expectEvictions[%d]: %w", i, err))
+		}
+	}
+	for i := range s.Steps {
+		errs = append(errs, s.Steps[i].validate(s, i)...)
+	}
+	if s.Teardown != nil {
+		errs = append(errs, s.Teardown.validate()...)
+	}
+	return errors.Join(errs...)
+}
+
+// validateTrigger checks the scenario's trigger, or each trigger of a
+// list.
+func (s *Scenario) validateTrigger() []error {
+	if s.Trigger == nil || s.Trigger.List == nil {
+		return s.Trigger.validate(s)
+	}
+	var errs []error
+	if len(s.Trigger.List) == 0 {
+		errs = append(errs, errors.New("trigger: the list is empty"))
+	}
+	chaos := 0
+	for i, t := range s.Trigger.Triggers() {
+		for _, err := range t.validate(s) {
+			errs = append(errs, fmt.Errorf("trigger[%d]: %w", i, err))
+		}
+		if t.Chaos != nil {
+			chaos++
+		}
+	}
+	if chaos > 1 {
+		errs = append(errs, errors.New("trigger: at most one trigger of the list may set chaos"))
+	}
+	return errs
+}
+
+// validate checks a single trigger, which may be nil.
+func (t *Trigger) validate(s *Scenario) []error {
+	var errs []error
+	if t == nil {
+		return nil
+	}
+	if t.Delay != nil && t.Delay.Duration < 0 {
+		errs = append(errs, errors.New("trigger.delay must not be negative"))
+	}
+	if t.Patch != nil {
+		if err := t.Patch.ResourceRef.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("trigger.patch: %w", err))
+		}
+	}
+	if t.Metadata != nil {
+		errs = append(errs, t.Metadata.validate()...)
+	}
+	if t.Scale != nil {
+		errs = append(errs, t.Scale.validate()...)
+	}
+	if t.HTTP != nil {
+		errs = append(errs, t.HTTP.validate(s)...)
+	}
+	if t.Exec != nil {
+		errs = append(errs, t.Exec.validate("trigger.exec")...)
+	}
+	if t.Event != nil {
+		errs = append(errs, t.Event.validate()...)
+	}
+	if t.AdvanceClock != nil && t.AdvanceClock.Duration <= 0 {
+		errs = append(errs, errors.New("trigger.advanceClock must be positive"))
+	}
+	if t.Drain != nil && t.Drain.Node == "" {
+		errs = append(errs, errors.New("trigger.drain.node is required"))
+	}
+	if t.Chaos != nil {
+		errs = append(errs, t.Chaos.validate(s)...)
+	}
+	return errs
+}
+
+// validateExpect checks the scenario's expectations.
+func (s *Scenario) validateExpect() []error {
+	return s.validateExpectations("expect", s.Expect)
+}
+
+// validateExpectations checks the expectations of field, such as
+// setup.waitFor.
+func (s *Scenario) validateExpectations(field string, expect []Expectation) []error {
+	var errs []error
+	ids := map[string]bool{}
+	unique := func(at, id string) {
+		if id == "" {
+			return
+		}
+		if ids[id] {
+			errs = append(errs, fmt.Errorf("%s.id: %q is used more than once", at, id))
+		}
+		ids[id] = true
+	}
+	for i, e := range expect {
+		unique(fmt.Sprintf("%s[%d]", field, i), e.ID)
+		if err := e.Resource.validateSelectable(); err != nil {
+			errs = append(errs, fmt.Errorf("%s[%d].resource: %w", field, i, err))
+		}
+		if err := e.validateAggregate(); err != nil {
+			errs = append(errs, fmt.Errorf("%s[%d].aggregate: %w", field, i, err))
+		}
+		if err := e.validateCount(); err != nil {
+			errs = append(errs, fmt.Errorf("%s[%d].count: %w", field, i, err))
+		}
+		for j, c := range e.Conditions {
+			unique(fmt.Sprintf("%s[%d].conditions[%d]", field, i, j), c.ID)
+			if err := c.validate(); err != nil {
+				errs = append(errs, fmt.Errorf("%s[%d].conditions[%d]: %w", field, i, j, err))
+			}
+		}
+		if e.HPA != nil {
+			if err := e.HPA.validate(e.Resource); err != nil {
+				errs = append(errs, fmt.Errorf("%s[%d].hpa: %w", field, i, err))
+			}
+		}
+		if d := e.GenerationStableFor; d != nil && d.Duration <= 0 {
+			errs = append(errs, fmt.Errorf("%s[%d].generationStableFor must be positive", field, i))
+		}
+		if d := e.Timeout; d != nil && d.Duration <= 0 {
+			errs = append(errs, fmt.Errorf("%s[%d].timeout must be positive", field, i))
+		}
+		if d := e.ConsistentlyFor; d != nil {
+			if timeout := e.TimeoutOr(s.TimeoutOrDefault()); d.Duration <= 0 || d.Duration >= timeout {
+				errs = append(errs, fmt.Errorf("%s[%d].consistentlyFor must be positive and shorter than the timeout of %s", field, i, timeout))
+			}
+		}
+		for _, err := range validateRetryOn(e.RetryOn) {
+			errs = append(errs, fmt.Errorf("%s[%d].%w", field, i, err))
+		}
+		if e.Absent && (len(e.Conditions) > 0 || e.Matches != nil || e.HPA != nil || e.ObservedGeneration || e.GenerationStableFor != nil) {
+			errs = append(errs, fmt.Errorf("%s[%d]: absent cannot be combined with conditions, matches, hpa, observedGeneration or generationStableFor", field, i))
+		}
+	}
+	return errs
+}
+
+// tenantConflicts reports the features that act on the cluster or the
+// agents as a whole, which tenants cannot each have a copy of.
+func (s *Scenario) tenantConflicts() []error {
+	var errs []error
+	conflict := func(field string) {
+		errs = append(errs, fmt.Errorf("tenants cannot be combined with %s", field))
+	}
+	if s.Setup.ControlNamespace != "" {
+		conflict("setup.controlNamespace")
+	}
+	if len(s.Setup.Exports) > 0 {
+		conflict("setup.exports")
+	}
+	if len(s.Setup.WaitFor) > 0 {
+		conflict("setup.waitFor")
+	}
+	if len(s.ExpectEvents) > 0 {
+		conflict("expectEvents")
+	}
+	if len(s.ExpectMetrics) > 0 {
+		conflict("expectMetrics")
+	}
+	if len(s.ExpectDenied) > 0 {
+		conflict("expectDenied")
+	}
+	if len(s.ExpectEvictions) > 0 {
+		conflict("expectEvictions")
+	}
+	if len(s.Churn) > 0 {
+		conflict("churn")
+	}
+	if len(s.ForbiddenMutations) > 0 {
+		conflict("forbiddenMutations")
+	}
+	if len(s.ExpectOrder) > 0 {
+		conflict("expectOrder")
+	}
+	if len(s.Steps) > 0 {
+		conflict("steps")
+	}
+	if len(s.Snapshots) > 0 {
+		conflict("snapshots")
+	}
+	if s.Teardown != nil {
+		conflict("teardown")
+	}
+	if t := s.Trigger; t != nil && t.List != nil {
+		conflict("a list of triggers")
+	}
+	if t := s.Trigger; t != nil {
+		if t.Delay != nil {
+			conflict("trigger.delay")
+		}
+		if t.Metadata != nil {
+			conflict("trigger.metadata")
+		}
+		if t.Scale != nil {
+			conflict("trigger.scale")
+		}
+		if t.HTTP != nil {
+			conflict("trigger.http")
+		}
+		if t.Exec != nil {
+			conflict("trigger.exec")
+		}
+		if t.Event != nil {
+			conflict("trigger.event")
+		}
+		if t.AdvanceClock != nil {
+			conflict("trigger.advanceClock")
+		}
+		if t.Drain != nil {
+			conflict("trigger.drain")
+		}
+		if t.Chaos != nil {
+			conflict("trigger.chaos")
+		}
+	}
+	return errs
+}
+
+func (c *Chaos) validate(s *Scenario) []error {
+	var errs []error
+	actions := []struct{ field, agent string }{
+		{"killAgentPod", c.KillAgentPod},
+		{"partitionAgent", c.PartitionAgent},
+	}
+	set := 0
+	for _, a := range actions {
+		field, agent := a.field, a.agent
+		if agent == "" {
+			continue
+		}
+		set++
+		if !slices.Contains(s.Agents, agent) {
+			errs = append(errs, fmt.Errorf("trigger.chaos.%s: %q is not one of the scenario's agents", field, agent))
+		}
+	}
+	if set != 1 {
+		errs = append(errs, errors.New("trigger.chaos: exactly one action must be set"))
+	}
+	disruption := c.Delay()
+	if c.PartitionAgent != "" {
+		disruption += c.PartitionOrDefault()
+	}
+	if disruption >= s.TimeoutOrDefault() {
+		errs = append(errs, errors.New("trigger.chaos: the disruption must end before the timeout"))
+	}
+	return errs
+}
+
+func (r ResourceRef) validate() error {
+	var errs []error
+	if r.APIVersion == "" {
+		errs = append(errs, errors.New("apiVersion is required"))
+	}
+	if r.Kind == "" {
+		errs = append(errs, errors.New("kind is required"))
+	}
+	if r.Name == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+	if r.LabelSelector != nil {
+		errs = append(errs, errors.New("labelSelector is only supported in the resource of expectations"))
+	}
+	return errors.Join(errs...)
+}
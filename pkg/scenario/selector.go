@@ -0,0 +1,70 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Aggregates of an expectation on the resources a label selector matches.
+const (
+	// AggregateAll requires every matching resource to meet the
+	// expectation.
+	AggregateAll = "all"
+	// AggregateAny requires one matching resource to meet it.
+	AggregateAny = "any"
+)
+
+// selectorString names the resources r selects.
+func (r ResourceRef) selectorString() string {
+	s := r.Kind
+	if r.Namespace != "" {
+		s += "/" + r.Namespace
+	}
+	return s + " matching " + metav1.FormatLabelSelector(r.LabelSelector)
+}
+
+// validateSelectable checks the resource of an expectation, which names a
+// resource or selects resources by label.
+func (r ResourceRef) validateSelectable() error {
+	if r.LabelSelector == nil {
+		return r.validate()
+	}
+	var errs []error
+	if r.APIVersion == "" {
+		errs = append(errs, errors.New("apiVersion is required"))
+	}
+	if r.Kind == "" {
+		errs = append(errs, errors.New("kind is required"))
+	}
+	if r.Name != "" {
+		errs = append(errs, errors.New("name and labelSelector are mutually exclusive"))
+	}
+	if _, err := metav1.LabelSelectorAsSelector(r.LabelSelector); err != nil {
+		errs = append(errs, fmt.Errorf("labelSelector: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// AggregateOrDefault returns Aggregate, falling back to AggregateAll.
+func (e Expectation) AggregateOrDefault() string {
+	if e.Aggregate == "" {
+		return AggregateAll
+	}
+	return e.Aggregate
+}
+
+func (e Expectation) validateAggregate() error {
+	switch {
+	case e.Aggregate == "":
+		return nil
+	case e.Resource.LabelSelector == nil:
+		return errors.New("needs resource.labelSelector")
+	case e.Absent:
+		return errors.New("cannot be combined with absent")
+	case e.Aggregate != AggregateAll && e.Aggregate != AggregateAny:
+		return fmt.Errorf("%q is not %s or %s", e.Aggregate, AggregateAll, AggregateAny)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package scenario
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateSelector(t *testing.T) {
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+	pods := ResourceRef{APIVersion: "v1", Kind: "Pod", Namespace: "test", LabelSelector: selector}
+	tests := []struct {
+		name string
+		exp  Expectation
+		err  string
+	}{
+		{name: "selector", exp: Expectation{Resource: pods}},
+		{name: "selector with aggregate any", exp: Expectation{Resource: pods, Aggregate: AggregateAny}},
+		{
+			name: "name and selector",
+			exp:  Expectation{Resource: ResourceRef{APIVersion: "v1", Kind: "Pod", Name: "web-1", LabelSelector: selector}},
+			err:  "name and labelSelector are mutually exclusive",
+		},
+		{
+			name: "invalid selector",
+			exp: Expectation{Resource: ResourceRef{APIVersion: "v1", Kind: "Pod", LabelSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "app", Operator: "Sometimes"}},
+			}}},
+			err: "labelSelector: ",
+		},
+		{
+			name: "aggregate without a selector",
+			exp:  Expectation{Resource: ResourceRef{APIVersion: "v1", Kind: "Pod", Name: "web-1"}, Aggregate: AggregateAll},
+			err:  "needs resource.labelSelector",
+		},
+		{name: "other aggregate", exp: Expectation{Resource: pods, Aggregate: "most"}, err: `"most" is not all or any`},
+		{name: "aggregate with absent", exp: Expectation{Resource: pods, Aggregate: AggregateAny, Absent: true}, err: "cannot be combined with absent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := (&Scenario{Name: "a", Expect: []Expectation{tt.exp}}).validateExpect()
+			if tt.err == "" {
+				if len(errs) > 0 {
+					t.Errorf("validateExpect() = %v, want no errors", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || !strings.Contains(errs[0].Error(), tt.err) {
+				t.Errorf("validateExpect() = %v, want one error with %q", errs, tt.err)
+			}
+		})
+	}
+
+	if got, want := pods.selectorString(), "Pod/test matching app=web"; got != want {
+		t.Errorf("selectorString() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,54 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// SnapshotDir is where golden files are kept by default, relative to the
+// scenario's directory.
+const SnapshotDir = "snapshots"
+
+// Snapshot compares a resource, once the expectations are met, with a
+// golden YAML file committed next to the scenario. Fields that change from
+// run to run, such as the UID, resource version, managed fields, and
+// condition timestamps, are stripped first. Running with snapshot updates
+// enabled rewrites the file instead, so changes to what the agents produce
+// can be reviewed as diffs.
+type Snapshot struct {
+	Resource ResourceRef `json:"resource"`
+	// File is the golden file; snapshots/<scenario>/<kind>-<name>.yaml,
+	// with the namespace before the name for namespaced resources, if
+	// unset. Relative paths are resolved like manifests.
+	File string `json:"file,omitempty"`
+	// Ignore lists more field paths to strip, e.g. .status.
+	Ignore []string `json:"ignore,omitempty"`
+}
+
+// SnapshotPath returns the golden file of sn.
+func (s *Scenario) SnapshotPath(sn Snapshot) string {
+	if sn.File != "" {
+		return s.ManifestPath(sn.File)
+	}
+	parts := []string{strings.ToLower(sn.Resource.Kind)}
+	if sn.Resource.Namespace != "" {
+		parts = append(parts, sn.Resource.Namespace)
+	}
+	parts = append(parts, sn.Resource.Name)
+	return s.ManifestPath(filepath.Join(SnapshotDir, s.Name, strings.Join(parts, "-")+".yaml"))
+}
+
+func (sn Snapshot) validate() error {
+	var errs []error
+	if err := sn.Resource.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("resource: %w", err))
+	}
+	for i, p := range sn.Ignore {
+		if p == "" {
+			errs = append(errs, fmt.Errorf("ignore[%d] is empty", i))
+		}
+	}
+	return errors.Join(errs...)
+}
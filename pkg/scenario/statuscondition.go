@@ -0,0 +1,76 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// StatusCondition is shorthand for the status of an entry of the standard
+// .status.conditions list, found by its type:
+//
+//	conditions:
+//	- condition: {type: Ready, status: "True"}
+//
+// stands for
+//
+//	conditions:
+//	- path: .status.conditions[?(@.type=="Ready")].status
+//	  value: "True"
+//
+// Other fields of the entry, such as its reason, can be compared the same
+// way with a path.
+type StatusCondition struct {
+	Type string `json:"type"`
+	// Status is True, False or Unknown.
+	Status metav1.ConditionStatus `json:"status"`
+}
+
+// Path returns the field path of the condition's status.
+func (sc *StatusCondition) Path() string {
+	return fmt.Sprintf(".status.conditions[?(@.type==%s)].status", strconv.Quote(sc.Type))
+}
+
+func (sc *StatusCondition) validate() error {
+	var errs []error
+	if sc.Type == "" {
+		errs = append(errs, errors.New("type is required"))
+	}
+	switch sc.Status {
+	case metav1.ConditionTrue, metav1.ConditionFalse, metav1.ConditionUnknown:
+	default:
+		errs = append(errs, fmt.Errorf("status: %q is not one of True, False and Unknown", sc.Status))
+	}
+	return errors.Join(errs...)
+}
+
+// Expand returns c with a status condition shorthand replaced by the path
+// and value it stands for, which is how the engine, exporters and matchers
+// evaluate it; other conditions are returned as is.
+func (c Condition) Expand() Condition {
+	if c.Condition == nil {
+		return c
+	}
+	if c.Description == "" && c.ID == "" {
+		c.Description = c.Condition.Type + " condition"
+	}
+	c.Path = c.Condition.Path()
+	c.Value = string(c.Condition.Status)
+	c.Condition = nil
+	return c
+}
+
+// ExpandConditions returns conds with each status condition shorthand
+// expanded; see Condition.Expand and Expectation.ExpandedConditions.
+func ExpandConditions(conds []Condition) []Condition {
+	if conds == nil {
+		return nil
+	}
+	out := make([]Condition, len(conds))
+	for i, c := range conds {
+		out[i] = c.Expand()
+	}
+	return out
+}
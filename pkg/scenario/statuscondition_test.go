@@ -0,0 +1,91 @@
+package scenario
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConditionExpand(t *testing.T) {
+	tests := []struct {
+		name string
+		c    Condition
+		want Condition
+	}{
+		{
+			name: "path condition",
+			c:    Condition{Path: ".spec.replicas", Value: float64(3)},
+			want: Condition{Path: ".spec.replicas", Value: float64(3)},
+		},
+		{
+			name: "status condition",
+			c:    Condition{Condition: &StatusCondition{Type: "Ready", Status: "True"}},
+			want: Condition{Path: `.status.conditions[?(@.type=="Ready")].status`, Value: "True", Description: "Ready condition"},
+		},
+		{
+			name: "described status condition",
+			c:    Condition{Condition: &StatusCondition{Type: "Available", Status: "False"}, Description: "the app is down"},
+			want: Condition{Path: `.status.conditions[?(@.type=="Available")].status`, Value: "False", Description: "the app is down"},
+		},
+		{
+			name: "status condition with an ID",
+			c:    Condition{Condition: &StatusCondition{Type: "Ready", Status: "Unknown"}, ID: "ready"},
+			want: Condition{Path: `.status.conditions[?(@.type=="Ready")].status`, Value: "Unknown", ID: "ready"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.c.Expand(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expand() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	conds := []Condition{tests[0].c, tests[1].c}
+	got := ExpandConditions(conds)
+	if want := []Condition{tests[0].want, tests[1].want}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ExpandConditions() = %+v, want %+v", got, want)
+	}
+	if conds[1].Condition == nil {
+		t.Error("ExpandConditions() changed its argument")
+	}
+	if ExpandConditions(nil) != nil {
+		t.Error("ExpandConditions(nil) is not nil")
+	}
+}
+
+func TestStatusConditionValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		c    Condition
+		err  string
+	}{
+		{name: "valid", c: Condition{Condition: &StatusCondition{Type: "Ready", Status: "True"}}},
+		{name: "no type", c: Condition{Condition: &StatusCondition{Status: "True"}}, err: "condition: type is required"},
+		{name: "other status", c: Condition{Condition: &StatusCondition{Type: "Ready", Status: "true"}}, err: `status: "true" is not one of True, False and Unknown`},
+		{
+			name: "combined with a path",
+			c:    Condition{Condition: &StatusCondition{Type: "Ready", Status: "True"}, Path: ".status.phase"},
+			err:  "condition cannot be combined with path, value, valueFrom or operator",
+		},
+		{
+			name: "combined with an operator",
+			c:    Condition{Condition: &StatusCondition{Type: "Ready", Status: "True"}, Operator: OperatorExists},
+			err:  "condition cannot be combined with path, value, valueFrom or operator",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.c.validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("validate() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("validate() = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Step is one phase of a multi-step scenario: a trigger and the state the
+// agents must converge to after it.
+type Step struct {
+	// Name labels the step in output; "step N" if unset.
+	Name    string        `json:"name,omitempty"`
+	Trigger *Trigger      `json:"trigger,omitempty"`
+	Expect  []Expectation `json:"expect"`
+	// Timeout bounds how long the step's expectations may take; the
+	// scenario's timeout if unset.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// StepName returns the name of step i, 0-based.
+func (s *Scenario) StepName(i int) string {
+	if name := s.Steps[i].Name; name != "" {
+		return name
+	}
+	return fmt.Sprintf("step %d", i+1)
+}
+
+// StepScenario returns s as step i sees it: the step's trigger,
+// expectations, and timeout in place of the scenario's, and no event,
+// metric, denial or eviction expectations.
+func (s *Scenario) StepScenario(i int) *Scenario {
+	st := s.Steps[i]
+	ss := *s
+	ss.Trigger = st.Trigger
+	ss.Expect = st.Expect
+	ss.ExpectEvents = nil
+	ss.ExpectMetrics = nil
+	ss.ExpectDenied = nil
+	ss.ExpectEvictions = nil
+	ss.Steps = nil
+	if st.Timeout != nil {
+		ss.Timeout = st.Timeout
+	}
+	return &ss
+}
+
+func (st *Step) validate(s *Scenario, i int) []error {
+	var errs []error
+	if len(st.Expect) == 0 {
+		errs = append(errs, errors.New("expect is required"))
+	}
+	if st.Timeout != nil && st.Timeout.Duration <= 0 {
+		errs = append(errs, errors.New("timeout must be positive"))
+	}
+	ss := s.StepScenario(i)
+	errs = append(errs, ss.validateTrigger()...)
+	errs = append(errs, ss.validateExpect()...)
+	for j, err := range errs {
+		errs[j] = fmt.Errorf("steps[%d].%w", i, err)
+	}
+	return errs
+}
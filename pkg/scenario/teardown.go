@@ -0,0 +1,58 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Teardown cleans up after a scenario once its expectations and checks are
+// done, whether they passed or not, so what setup created does not leak
+// into the scenarios that follow on a shared cluster:
+//
+//	teardown:
+//	  deleteSetup: true
+//	  manifests: [agent-created.yaml]
+//	  patches:
+//	  - {apiVersion: apps/v1, kind: Deployment, name: gateway, namespace: shop, spec: {replicas: 2}}
+//	  exec:
+//	  - {pod: db-0, namespace: shop, command: [psql, -c, "TRUNCATE orders"]}
+//
+// The patches and commands run first, in order, then the objects are
+// deleted. Objects already gone are not an error.
+type Teardown struct {
+	// DeleteSetup deletes the objects of the setup manifests, presets and
+	// generators, in the reverse of the order they were applied in, and
+	// CustomResourceDefinitions last.
+	DeleteSetup bool `json:"deleteSetup,omitempty"`
+	// Manifests are paths to YAML files whose objects are deleted, such as
+	// the ones agents create, relative to the scenario file.
+	Manifests []string `json:"manifests,omitempty"`
+	// Patches restore fixtures that the scenario changed.
+	Patches []ResourcePatch `json:"patches,omitempty"`
+	// Exec runs commands in workload pods.
+	Exec []ExecTrigger `json:"exec,omitempty"`
+}
+
+func (t *Teardown) validate() []error {
+	var errs []error
+	if !t.DeleteSetup && len(t.Manifests) == 0 && len(t.Patches) == 0 && len(t.Exec) == 0 {
+		errs = append(errs, errors.New("teardown: nothing to do"))
+	}
+	for i, m := range t.Manifests {
+		if m == "" {
+			errs = append(errs, fmt.Errorf("teardown.manifests[%d] is empty", i))
+		}
+	}
+	for i := range t.Patches {
+		if err := t.Patches[i].ResourceRef.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("teardown.patches[%d]: %w", i, err))
+		}
+		if len(t.Patches[i].Spec) == 0 {
+			errs = append(errs, fmt.Errorf("teardown.patches[%d].spec is required", i))
+		}
+	}
+	for i := range t.Exec {
+		errs = append(errs, t.Exec[i].validate(fmt.Sprintf("teardown.exec[%d]", i))...)
+	}
+	return errs
+}
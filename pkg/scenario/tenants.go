@@ -0,0 +1,113 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// DefaultTenantParallelism bounds how many tenants are set up at once when
+// Tenants does not set Parallelism.
+const DefaultTenantParallelism = 8
+
+// Tenants instantiates a scenario once per tenant namespace, against the
+// same agents, to check that the agents serve every tenant and serve them
+// fairly. The scenario is written against one namespace, From: each tenant
+// gets a copy of the setup objects, trigger patch, and expectations in it,
+// moved to the tenant's namespace. Cluster-scoped setup objects and those
+// in other namespaces are applied once and shared.
+//
+// Once every tenant is set up, all triggers fire together and each
+// tenant's convergence latency is measured from its trigger.
+type Tenants struct {
+	Count int `json:"count"`
+	// Namespace is the template of the tenant namespaces, evaluated with
+	// .Index like generator templates, e.g. "tenant-{{.Index}}".
+	Namespace string `json:"namespace"`
+	// From is the namespace the scenario is written against; the
+	// scenario's namespace, or "default", if unset. Namespaced objects that name no namespace are in it.
+	From string `json:"from,omitempty"`
+	// MaxSpread fails the scenario when the slowest tenant converged more
+	// than this after the fastest.
+	MaxSpread *metav1.Duration `json:"maxSpread,omitempty"`
+	// Parallelism bounds how many tenants are set up at once.
+	Parallelism int `json:"parallelism,omitempty"`
+}
+
+// FromOrDefault returns From, falling back to "default".
+func (t *Tenants) FromOrDefault() string {
+	if t.From == "" {
+		return "default"
+	}
+	return t.From
+}
+
+// ParallelismOrDefault returns Parallelism, falling back to
+// DefaultTenantParallelism.
+func (t *Tenants) ParallelismOrDefault() int {
+	if t.Parallelism <= 0 {
+		return DefaultTenantParallelism
+	}
+	return t.Parallelism
+}
+
+// Namespaces renders the Count tenant namespaces.
+func (t *Tenants) Namespaces() ([]string, error) {
+	render, err := compileValue(t.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	namespaces := make([]string, 0, t.Count)
+	for i := range t.Count {
+		v, err := render(i)
+		if err != nil {
+			return nil, fmt.Errorf("rendering tenant %d: %w", i, err)
+		}
+		namespaces = append(namespaces, fmt.Sprint(v))
+	}
+	return namespaces, nil
+}
+
+func (t *Tenants) validate() error {
+	var errs []error
+	if t.Count <= 0 {
+		errs = append(errs, errors.New("count must be positive"))
+	}
+	switch {
+	case t.Namespace == "":
+		errs = append(errs, errors.New("namespace is required"))
+	case t.Count > 1 && !strings.Contains(t.Namespace, "{{"):
+		errs = append(errs, errors.New("namespace must vary with .Index"))
+	}
+	for _, msg := range validation.IsDNS1123Label(t.FromOrDefault()) {
+		errs = append(errs, fmt.Errorf("from: %s", msg))
+	}
+	if t.MaxSpread != nil && t.MaxSpread.Duration <= 0 {
+		errs = append(errs, errors.New("maxSpread must be positive"))
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	namespaces, err := t.Namespaces()
+	if err != nil {
+		return fmt.Errorf("namespace: %w", err)
+	}
+	seen := map[string]bool{}
+	for _, ns := range namespaces {
+		for _, msg := range validation.IsDNS1123Label(ns) {
+			errs = append(errs, fmt.Errorf("namespace %q: %s", ns, msg))
+		}
+		if ns == t.FromOrDefault() {
+			errs = append(errs, fmt.Errorf("namespace %q is the from namespace", ns))
+		}
+		if seen[ns] {
+			errs = append(errs, fmt.Errorf("namespace %q is used by two tenants", ns))
+		}
+		seen[ns] = true
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,69 @@
+package scenario
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Triggers returns the triggers to fire in order: the entries of List, or
+// t itself. It returns nil for a nil t.
+func (t *Trigger) Triggers() []*Trigger {
+	if t == nil {
+		return nil
+	}
+	if t.List == nil {
+		return []*Trigger{t}
+	}
+	triggers := make([]*Trigger, len(t.List))
+	for i := range t.List {
+		triggers[i] = &t.List[i]
+	}
+	return triggers
+}
+
+// trigger has Trigger's fields without its methods, so entries of a list
+// cannot be lists themselves.
+type trigger Trigger
+
+// UnmarshalJSON decodes a single trigger or a list of them, e.g. to test
+// debouncing or rate limiting:
+//
+//	trigger:
+//	  - patch: {...}
+//	  - delay: 500ms
+//	    patch: {...}
+//
+// A list is decoded into List, leaving the other fields unset. Unknown
+// fields are rejected, as scenario files are decoded strictly.
+func (t *Trigger) UnmarshalJSON(data []byte) error {
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		var list []trigger
+		if err := strictUnmarshal(data, &list); err != nil {
+			return err
+		}
+		*t = Trigger{List: make([]Trigger, len(list))}
+		for i := range list {
+			t.List[i] = Trigger(list[i])
+		}
+		return nil
+	}
+	return strictUnmarshal(data, (*trigger)(t))
+}
+
+// MarshalJSON encodes a list as a list.
+func (t *Trigger) MarshalJSON() ([]byte, error) {
+	if t.List == nil {
+		return json.Marshal((*trigger)(t))
+	}
+	list := make([]trigger, len(t.List))
+	for i := range t.List {
+		list[i] = trigger(t.List[i])
+	}
+	return json.Marshal(list)
+}
+
+func strictUnmarshal(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
@@ -0,0 +1,71 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ValueSource sources the expected value of a condition at run time, for
+// values only known once the setup ran, such as generated names or quota
+// limits. Exactly one field is set.
+type ValueSource struct {
+	// ResourceField is the value at a path of another resource.
+	ResourceField *ResourceField `json:"resourceField,omitempty"`
+	// Env names an environment variable of the test process. Its value is
+	// decoded as YAML, so 3 compares as a number; quote it to compare as
+	// a string.
+	Env string `json:"env,omitempty"`
+}
+
+// ResourceField selects the value at Path of a resource.
+type ResourceField struct {
+	ResourceRef `json:",inline"`
+	// Path is a dotted field path such as .status.hard.pods.
+	Path string `json:"path"`
+}
+
+func (c Condition) validate() error {
+	var errs []error
+	switch {
+	case c.Condition != nil:
+		if c.Path != "" || c.Value != nil || c.ValueFrom != nil || c.Operator != "" {
+			errs = append(errs, errors.New("condition cannot be combined with path, value, valueFrom or operator"))
+		}
+		if err := c.Condition.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("condition: %w", err))
+		}
+	case c.Path == "":
+		errs = append(errs, errors.New("path is required"))
+	}
+	if c.ValueFrom != nil {
+		if c.Value != nil {
+			errs = append(errs, errors.New("value and valueFrom are mutually exclusive"))
+		}
+		if err := c.ValueFrom.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("valueFrom: %w", err))
+		}
+	}
+	if err := c.validateOperator(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (v *ValueSource) validate() error {
+	if (v.ResourceField == nil) == (v.Env == "") {
+		return errors.New("exactly one of resourceField and env must be set")
+	}
+	if f := v.ResourceField; f != nil {
+		var errs []error
+		if err := f.ResourceRef.validate(); err != nil {
+			errs = append(errs, err)
+		}
+		if f.Path == "" {
+			errs = append(errs, errors.New("path is required"))
+		}
+		if err := errors.Join(errs...); err != nil {
+			return fmt.Errorf("resourceField: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package scenario
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// ValueProvider resolves references to values kept out of scenario files,
+// such as registry tokens and API keys for agents. Scenario files use them
+// through the secret template function, with references of the form
+// scheme:ref, the scheme picking the provider:
+//
+//	trigger:
+//	  http:
+//	    service: gateway
+//	    namespace: shop
+//	    port: 8080
+//	    path: /orders
+//	    headers:
+//	      Authorization: 'Bearer {{ secret "vault:kv/data/ci/shop#token" }}'
+//
+// Resolved values are part of the loaded scenario like any other template
+// output, so keep them out of fields that output and reports show.
+type ValueProvider interface {
+	// Value returns the value ref refers to, ref being the reference
+	// without its scheme.
+	Value(ref string) (string, error)
+}
+
+// WithValueProviders makes providers, keyed by scheme, available to the
+// secret template function. Without them, files using it fail to load.
+func WithValueProviders(providers map[string]ValueProvider) LoadOption {
+	return func(o *loadOptions) { o.providers = providers }
+}
+
+// valueResolver resolves the secret references of one load, asking the
+// providers once per reference.
+type valueResolver struct {
+	providers map[string]ValueProvider
+	values    map[string]string
+}
+
+func newValueResolver(providers map[string]ValueProvider) *valueResolver {
+	return &valueResolver{providers: providers, values: map[string]string{}}
+}
+
+func (r *valueResolver) resolve(ref string) (string, error) {
+	if v, ok := r.values[ref]; ok {
+		return v, nil
+	}
+	scheme, rest, ok := strings.Cut(ref, ":")
+	if !ok || scheme == "" {
+		return "", fmt.Errorf("secret %q: want scheme:ref", ref)
+	}
+	p, ok := r.providers[scheme]
+	if !ok {
+		schemes := slices.Sorted(maps.Keys(r.providers))
+		if len(schemes) == 0 {
+			return "", fmt.Errorf("secret %q: no value providers configured", ref)
+		}
+		return "", fmt.Errorf("secret %q: unknown scheme %q, want one of %s", ref, scheme, strings.Join(schemes, ", "))
+	}
+	v, err := p.Value(rest)
+	if err != nil {
+		return "", fmt.Errorf("secret %q: %w", ref, err)
+	}
+	r.values[ref] = v
+	return v, nil
+}
@@ -0,0 +1,95 @@
+package scenario
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"text/template"
+
+	"sigs.k8s.io/yaml"
+)
+
+// TemplateData is what scenario files are executed with as templates.
+type TemplateData struct {
+	Vars map[string]string
+	// Generated holds the names generated for setup objects with
+	// metadata.generateName. They are only known once setup has run, so
+	// references to them are left in place at load time; see
+	// RenderSetupValues.
+	Generated map[string]string
+	// Exports holds the values of Setup.Exports, which like Generated are
+	// only known once setup has run.
+	Exports map[string]string
+}
+
+// LoadOption configures how scenario files are loaded.
+type LoadOption func(*loadOptions)
+
+type loadOptions struct {
+	vars      map[string]string
+	providers map[string]ValueProvider
+}
+
+// WithVars supplies template variables, which take precedence over the
+// defaults in a file's vars block.
+func WithVars(vars map[string]string) LoadOption {
+	return func(o *loadOptions) { o.vars = vars }
+}
+
+// expand executes a scenario file as a text/template, so values such as
+// namespaces and image tags can be given at load time:
+//
+//	vars:
+//	  namespace: team-a
+//	namespace: {{ .Vars.namespace }}
+//
+// The secret function resolves references with values, such as
+// {{ secret "env:REGISTRY_TOKEN" }}; see ValueProvider.
+//
+// The vars block holds defaults for the variables; it is read from the
+// file rendered with the supplied variables alone, missing ones left
+// empty, so it cannot itself use variables. Referencing a variable that
+// is neither supplied nor defaulted is an error. Files without "{{" are
+// returned as they are; a literal "{{" is written {{"{{"}}. expand returns
+// the variables the file was rendered with.
+func expand(data []byte, supplied map[string]string, values *valueResolver) ([]byte, map[string]string, error) {
+	if !bytes.Contains(data, []byte("{{")) {
+		return data, nil, nil
+	}
+	t, err := template.New("scenario").Funcs(template.FuncMap{"secret": values.resolve}).Parse(string(data))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var first bytes.Buffer
+	generated, exports := passThroughSetupValues(data)
+	if err := t.Option("missingkey=zero").Execute(&first, TemplateData{Vars: emptyVars(supplied), Generated: generated, Exports: exports}); err != nil {
+		return nil, nil, err
+	}
+	var defaults struct {
+		Vars map[string]string `json:"vars"`
+	}
+	if err := yaml.Unmarshal(first.Bytes(), &defaults); err != nil {
+		return nil, nil, fmt.Errorf("reading vars: %w", err)
+	}
+	vars := maps.Clone(defaults.Vars)
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	maps.Copy(vars, supplied)
+
+	var out bytes.Buffer
+	if err := t.Option("missingkey=error").Execute(&out, TemplateData{Vars: vars, Generated: generated, Exports: exports}); err != nil {
+		return nil, nil, err
+	}
+	return out.Bytes(), vars, nil
+}
+
+// emptyVars returns vars, or an empty map in its place, so lookups of
+// missing variables yield "".
+func emptyVars(vars map[string]string) map[string]string {
+	if vars == nil {
+		return map[string]string{}
+	}
+	return vars
+}
@@ -0,0 +1,121 @@
+package scenario
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// countingProvider returns ref upper-cased and counts its calls.
+type countingProvider struct{ calls int }
+
+func (p *countingProvider) Value(ref string) (string, error) {
+	p.calls++
+	if ref == "missing" {
+		return "", errors.New("not found")
+	}
+	return strings.ToUpper(ref), nil
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		supplied map[string]string
+		want     string
+		vars     map[string]string
+		err      string
+	}{
+		{
+			name: "not a template",
+			data: "name: app\n",
+			want: "name: app\n",
+		},
+		{
+			name: "defaults",
+			data: "vars:\n  ns: team-a\nnamespace: {{ .Vars.ns }}\n",
+			want: "vars:\n  ns: team-a\nnamespace: team-a\n",
+			vars: map[string]string{"ns": "team-a"},
+		},
+		{
+			name:     "supplied variables override defaults",
+			data:     "vars:\n  ns: team-a\nnamespace: {{ .Vars.ns }}\n",
+			supplied: map[string]string{"ns": "team-b", "unused": "x"},
+			want:     "vars:\n  ns: team-a\nnamespace: team-b\n",
+			vars:     map[string]string{"ns": "team-b", "unused": "x"},
+		},
+		{
+			name: "undefined variable",
+			data: "namespace: {{ .Vars.ns }}\n",
+			err:  `no entry for key "ns"`,
+		},
+		{
+			name: "literal braces",
+			data: `command: '{{"{{"}} .x }}'` + "\n",
+			want: "command: '{{ .x }}'\n",
+			vars: map[string]string{},
+		},
+		{
+			name: "setup values are left for later",
+			data: "name: '{{ .Generated.job }}'\nvalue: '{{ index .Exports \"node\" }}'\n",
+			want: "name: '{{ index .Generated `job` }}'\nvalue: '{{ index .Exports `node` }}'\n",
+			vars: map[string]string{},
+		},
+		{
+			name: "secrets",
+			data: "token: {{ secret \"test:abc\" }}{{ secret \"test:abc\" }}\n",
+			want: "token: ABCABC\n",
+			vars: map[string]string{},
+		},
+		{
+			name: "secret without a scheme",
+			data: "token: {{ secret \"abc\" }}\n",
+			err:  `secret "abc": want scheme:ref`,
+		},
+		{
+			name: "unknown secret scheme",
+			data: "token: {{ secret \"vault:abc\" }}\n",
+			err:  `unknown scheme "vault", want one of test`,
+		},
+		{
+			name: "failing provider",
+			data: "token: {{ secret \"test:missing\" }}\n",
+			err:  `secret "test:missing": not found`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &countingProvider{}
+			values := newValueResolver(map[string]ValueProvider{"test": p})
+			got, vars, err := expand([]byte(tt.data), tt.supplied, values)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expand() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expand() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(vars, tt.vars) {
+				t.Errorf("vars = %v, want %v", vars, tt.vars)
+			}
+			// Both passes share the resolver, so each reference is asked for
+			// once.
+			if p.calls > 1 {
+				t.Errorf("provider called %d times, want at most once", p.calls)
+			}
+		})
+	}
+}
+
+func TestExpandWithoutProviders(t *testing.T) {
+	_, _, err := expand([]byte(`token: {{ secret "env:X" }}`), nil, newValueResolver(nil))
+	if err == nil || !strings.Contains(err.Error(), "no value providers configured") {
+		t.Errorf("expand() error = %v, want no value providers configured", err)
+	}
+}
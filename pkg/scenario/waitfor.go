@@ -0,0 +1,16 @@
+package scenario
+
+// WaitForScenario returns s as the wait for setup.waitFor sees it: those
+// states in place of the expectations, and no trigger, steps, or event,
+// metric, denial or eviction expectations.
+func (s *Scenario) WaitForScenario() *Scenario {
+	ws := *s
+	ws.Trigger = nil
+	ws.Expect = s.Setup.WaitFor
+	ws.ExpectEvents = nil
+	ws.ExpectMetrics = nil
+	ws.ExpectDenied = nil
+	ws.ExpectEvictions = nil
+	ws.Steps = nil
+	return &ws
+}
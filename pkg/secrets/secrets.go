@@ -0,0 +1,184 @@
+// Package secrets provides the value providers scenario files resolve
+// credentials with, through the secret template function: environment
+// variables, files, Kubernetes Secrets and Vault. See
+// scenario.ValueProvider.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/kube"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// Timeout bounds each lookup of the providers that go over the network.
+const Timeout = 30 * time.Second
+
+// Defaults returns the providers by their usual schemes: env, file, and
+// k8s for Secrets of the cluster of the kubeconfig at path with the given
+// context, the standard loading rules if path is empty, and vault. The
+// cluster and Vault are only contacted when a reference needs them.
+func Defaults(kubeconfig, kubeContext string) map[string]scenario.ValueProvider {
+	return map[string]scenario.ValueProvider{
+		"env":   Env{},
+		"file":  File{},
+		"k8s":   &Kubernetes{Kubeconfig: kubeconfig, Context: kubeContext},
+		"vault": &Vault{},
+	}
+}
+
+// Env resolves references to environment variables by name, as in
+// env:REGISTRY_TOKEN. Unset variables are an error.
+type Env struct{}
+
+// Value returns the value of the environment variable ref.
+func (Env) Value(ref string) (string, error) {
+	v, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", ref)
+	}
+	return v, nil
+}
+
+// File resolves references to files by path, as in file:/run/secrets/token,
+// relative paths being relative to the working directory. A trailing
+// newline is dropped.
+type File struct{}
+
+// Value returns the content of the file ref.
+func (File) Value(ref string) (string, error) {
+	data, err := os.ReadFile(ref)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r"), nil
+}
+
+// Kubernetes resolves references to keys of Secrets, as in
+// k8s:ci/registry#token.
+type Kubernetes struct {
+	// Kubeconfig and Context select the cluster; see kube.ForKubeconfig.
+	Kubeconfig, Context string
+}
+
+// Value returns the key of the Secret ref, written namespace/name#key.
+func (k *Kubernetes) Value(ref string) (string, error) {
+	name, key, ok := strings.Cut(ref, "#")
+	namespace, name, ok2 := strings.Cut(name, "/")
+	if !ok || !ok2 || namespace == "" || name == "" || key == "" {
+		return "", errors.New("want namespace/name#key")
+	}
+	clients, err := kube.ForKubeconfig(k.Kubeconfig, k.Context)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	secret, err := clients.Kubernetes.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	v, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s/%s has no key %q", namespace, name, key)
+	}
+	return string(v), nil
+}
+
+// Vault resolves references to fields of Vault secrets, as in
+// vault:kv/data/ci/registry#token, read with the HTTP API. Both KV version
+// 1 and 2 paths work; version 2 paths include their data segment.
+type Vault struct {
+	// Addr is the address of the server; VAULT_ADDR if empty.
+	Addr string
+	// Token authenticates the reads; VAULT_TOKEN if empty.
+	Token string
+	// Namespace is the Vault Enterprise namespace; VAULT_NAMESPACE if
+	// empty.
+	Namespace string
+	// Client makes the requests; http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Value returns the field of the secret ref, written path#field.
+func (v *Vault) Value(ref string) (string, error) {
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || field == "" {
+		return "", errors.New("want path#field")
+	}
+	addr := cmpOrEnv(v.Addr, "VAULT_ADDR")
+	if addr == "" {
+		return "", errors.New("no Vault address: set VAULT_ADDR")
+	}
+	u, err := url.JoinPath(addr, "v1", path)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	if token := cmpOrEnv(v.Token, "VAULT_TOKEN"); token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if ns := cmpOrEnv(v.Namespace, "VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("reading %s: %s", path, resp.Status)
+	}
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("reading %s: %w", path, err)
+	}
+	data := body.Data
+	// KV version 2 nests the fields, next to the version's metadata.
+	if inner, ok := data["data"].(map[string]any); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+	value, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("%s has no field %q", path, field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	out, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// cmpOrEnv returns v, or the environment variable name if v is empty.
+func cmpOrEnv(v, name string) string {
+	if v != "" {
+		return v
+	}
+	return os.Getenv(name)
+}
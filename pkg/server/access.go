@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario/loader"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario/remote"
+)
+
+// WithToken sets the bearer token clients must send in the Authorization
+// header. Without one, the API refuses every request: runs execute
+// manifests and commands with the server's cluster credentials.
+func WithToken(token string) Option {
+	return func(s *Server) { s.token = token }
+}
+
+// WithRoot sets the directory local scenario sources, and the files
+// inline scenarios and local scenario files refer to, must be in. Inline
+// scenarios resolve their file paths against it. Without a root, only
+// remote sources and inline scenarios that refer to no files are
+// accepted.
+func WithRoot(dir string) Option {
+	return func(s *Server) { s.root = dir }
+}
+
+var errUnauthorized = errors.New("missing or invalid bearer token")
+
+// authenticate answers 401 to requests without the server's bearer token.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if s.token == "" || !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kube-agents-server"`)
+			writeError(w, http.StatusUnauthorized, errUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// load loads the scenarios of req, refusing local sources outside the
+// root and scenarios that refer to files outside the root or, for remote
+// sources, outside their bundle.
+func (s *Server) load(ctx context.Context, req *Request) ([]*scenario.Scenario, error) {
+	fetcher := s.fetcher
+	if fetcher == nil {
+		fetcher = remote.New()
+	}
+	var all []*scenario.Scenario
+	for _, src := range req.Sources {
+		base, path := s.root, src
+		if remote.IsRemote(src) {
+			dir, err := fetcher.Fetch(ctx, src)
+			if err != nil {
+				return nil, err
+			}
+			base, path = dir, dir
+		} else if !s.inRoot(src) {
+			return nil, fmt.Errorf("source %s: not in the server's scenario root", src)
+		}
+		scenarios, err := loader.LoadWithVars(ctx, fetcher, req.Vars, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, sc := range scenarios {
+			if err := confined(sc, base); err != nil {
+				return nil, fmt.Errorf("%s: %w", sc.Name, err)
+			}
+		}
+		all = append(all, scenarios...)
+	}
+	for _, sc := range req.Scenarios {
+		sc.Dir = s.root
+		if err := sc.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", sc.Name, err)
+		}
+		if err := confined(sc, s.root); err != nil {
+			return nil, fmt.Errorf("%s: %w", sc.Name, err)
+		}
+	}
+	return append(all, req.Scenarios...), nil
+}
+
+// inRoot reports whether path, relative to the working directory, is in
+// the server's root.
+func (s *Server) inRoot(path string) bool {
+	return s.root != "" && within(s.root, path)
+}
+
+// confined fails if sc refers to files outside base: setup and teardown
+// manifests and snapshot golden files. An empty base admits no files.
+func confined(sc *scenario.Scenario, base string) error {
+	var files []string
+	for _, m := range sc.Setup.Manifests {
+		files = append(files, sc.ManifestPath(m))
+	}
+	if sc.Teardown != nil {
+		for _, m := range sc.Teardown.Manifests {
+			files = append(files, sc.ManifestPath(m))
+		}
+	}
+	for _, sn := range sc.Snapshots {
+		files = append(files, sc.SnapshotPath(sn))
+	}
+	for _, f := range files {
+		if base == "" || !within(base, f) {
+			return fmt.Errorf("%s: not in the server's scenario root", f)
+		}
+	}
+	return nil
+}
+
+// within reports whether path is base or below it, once both are absolute
+// and their symbolic links, where they exist, are resolved.
+func within(base, path string) bool {
+	base, err := resolvePath(base)
+	if err != nil {
+		return false
+	}
+	path, err = resolvePath(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(base, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// resolvePath makes path absolute and resolves the symbolic links of the
+// longest part of it that exists.
+func resolvePath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// maxRequestBytes bounds the size of a submitted Request.
+const maxRequestBytes = 8 << 20
+
+// Handler returns the server's HTTP API, which answers 401 to requests
+// without the bearer token.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/runs", s.handleSubmit)
+	mux.HandleFunc("GET /v1/runs", s.handleList)
+	mux.HandleFunc("GET /v1/runs/{id}", s.withRun(s.handleGet))
+	mux.HandleFunc("DELETE /v1/runs/{id}", s.withRun(s.handleCancel))
+	mux.HandleFunc("GET /v1/runs/{id}/events", s.withRun(s.handleEvents))
+	mux.HandleFunc("GET /v1/runs/{id}/artifacts", s.withRun(s.handleArtifacts))
+	return s.authenticate(mux)
+}
+
+func (s *Server) handleSubmit(w http.ResponseWriter, req *http.Request) {
+	var body Request
+	dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxRequestBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decoding request: %w", err))
+		return
+	}
+	r, err := s.submit(req.Context(), &body)
+	switch {
+	case errors.Is(err, errQueueFull):
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set("Location", "/v1/runs/"+r.id)
+	writeJSON(w, http.StatusAccepted, r.snapshot())
+}
+
+func (s *Server) handleList(w http.ResponseWriter, _ *http.Request) {
+	runs := []Run{}
+	for _, r := range s.list() {
+		v := r.snapshot()
+		v.Results = nil
+		runs = append(runs, v)
+	}
+	writeJSON(w, http.StatusOK, runs)
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, _ *http.Request, r *run) {
+	writeJSON(w, http.StatusOK, r.snapshot())
+}
+
+func (s *Server) handleCancel(w http.ResponseWriter, _ *http.Request, r *run) {
+	if !r.stop() {
+		writeError(w, http.StatusConflict, fmt.Errorf("run %s already finished", r.id))
+		return
+	}
+	s.log.Info("run cancelled", "run", r.id)
+	writeJSON(w, http.StatusOK, r.snapshot())
+}
+
+// handleEvents streams the run's events as server-sent events, replaying
+// those already emitted, until the run is done or the client goes away.
+func (s *Server) handleEvents(w http.ResponseWriter, req *http.Request, r *run) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	sent := 0
+	for {
+		events, done, changed := r.eventsFrom(sent)
+		for _, e := range events {
+			data, err := json.Marshal(e)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+				return
+			}
+		}
+		sent += len(events)
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		if done {
+			return
+		}
+		select {
+		case <-changed:
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+// handleArtifacts sends the run's artifact directory as a gzipped tarball.
+func (s *Server) handleArtifacts(w http.ResponseWriter, _ *http.Request, r *run) {
+	r.mu.Lock()
+	dir, done := r.artifactsDir, r.done()
+	r.mu.Unlock()
+	if !done {
+		writeError(w, http.StatusConflict, fmt.Errorf("run %s has not finished", r.id))
+		return
+	}
+	if dir == "" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run %s has no artifacts", r.id))
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", r.id+".tar.gz"))
+	if err := writeTarball(w, dir, r.id); err != nil {
+		// The status line is already sent; all we can do is cut the
+		// stream short so the client sees a truncated archive.
+		s.log.Error("writing artifacts", "run", r.id, "error", err)
+	}
+}
+
+// withRun resolves the {id} path value to a run, answering 404 when there
+// is none.
+func (s *Server) withRun(h func(http.ResponseWriter, *http.Request, *run)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r := s.get(req.PathValue("id"))
+		if r == nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("run %s not found", req.PathValue("id")))
+			return
+		}
+		h(w, req, r)
+	}
+}
+
+// writeTarball writes the files under dir to w as a gzipped tar, with
+// paths under prefix.
+func writeTarball(w io.Writer, dir, prefix string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(filepath.Join(prefix, rel))
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
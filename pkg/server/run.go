@@ -0,0 +1,358 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/engine"
+	"github.com/aslakknutsen/kube-agents-test/pkg/fingerprint"
+	"github.com/aslakknutsen/kube-agents-test/pkg/runner"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// State is where a run is in its lifecycle.
+type State string
+
+// Run states.
+const (
+	StateQueued    State = "queued"
+	StateRunning   State = "running"
+	StatePassed    State = "passed"
+	StateFailed    State = "failed"
+	StateCancelled State = "cancelled"
+)
+
+// Run is the API view of a submitted run.
+type Run struct {
+	ID          string     `json:"id"`
+	State       State      `json:"state"`
+	Scenarios   []string   `json:"scenarios"`
+	SubmittedAt time.Time  `json:"submittedAt"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+	// Error reports why the suite could not run, e.g. a dependency cycle;
+	// scenario failures are in Results.
+	Error   string   `json:"error,omitempty"`
+	Results []Result `json:"results,omitempty"`
+	// Fingerprint is the environment the run executed in, once finished.
+	Fingerprint *fingerprint.Fingerprint `json:"fingerprint,omitempty"`
+}
+
+// Result is the API view of a scenario's outcome.
+type Result struct {
+	Scenario    string            `json:"scenario"`
+	Passed      bool              `json:"passed"`
+	Skipped     bool              `json:"skipped,omitempty"`
+	SkipReason  string            `json:"skipReason,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	StartedAt   time.Time         `json:"startedAt"`
+	Duration    string            `json:"duration"`
+	AgentImages map[string]string `json:"agentImages,omitempty"`
+	Dimensions  map[string]string `json:"dimensions,omitempty"`
+	// Expectations holds the outcome of each expectation.
+	Expectations []Expectation `json:"expectations,omitempty"`
+	// Agents holds the readiness of each deployed agent.
+	Agents []AgentHealth `json:"agents,omitempty"`
+	// Churn counts the changes to the resources of the churn limits.
+	Churn []ChurnCount `json:"churn,omitempty"`
+	// Denials holds the answers to the mutations admission must deny.
+	Denials []Denial `json:"denials,omitempty"`
+	// Evictions holds the answers to the evictions that must be blocked
+	// or allowed.
+	Evictions []Eviction `json:"evictions,omitempty"`
+}
+
+// ChurnCount is the API view of how often a resource changed.
+type ChurnCount struct {
+	Resource string `json:"resource"`
+	Creates  int    `json:"creates,omitempty"`
+	Updates  int    `json:"updates,omitempty"`
+	Deletes  int    `json:"deletes,omitempty"`
+}
+
+// Denial is the API view of the answer to a mutation admission must deny.
+type Denial struct {
+	ID          string `json:"id,omitempty"`
+	Description string `json:"description,omitempty"`
+	Operation   string `json:"operation"`
+	Resource    string `json:"resource"`
+	Denied      bool   `json:"denied"`
+	Allowed     bool   `json:"allowed,omitempty"`
+	Code        int32  `json:"code,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	Message     string `json:"message,omitempty"`
+}
+
+// Eviction is the API view of the answer to an eviction that must be
+// blocked or allowed.
+type Eviction struct {
+	ID          string `json:"id,omitempty"`
+	Description string `json:"description,omitempty"`
+	Pod         string `json:"pod,omitempty"`
+	Outcome     string `json:"outcome"`
+	Met         bool   `json:"met"`
+	Blocked     bool   `json:"blocked,omitempty"`
+	Allowed     bool   `json:"allowed,omitempty"`
+	Code        int32  `json:"code,omitempty"`
+	Message     string `json:"message,omitempty"`
+}
+
+// AgentHealth is the API view of a deployed agent's readiness.
+type AgentHealth struct {
+	Agent       string `json:"agent"`
+	TimeToReady string `json:"timeToReady,omitempty"`
+	ImageID     string `json:"imageID,omitempty"`
+	Flaps       []Flap `json:"flaps,omitempty"`
+}
+
+// Flap is a period in which an agent was not ready.
+type Flap struct {
+	At time.Time `json:"at"`
+	// Duration is empty if the agent did not become ready again.
+	Duration string `json:"duration,omitempty"`
+}
+
+// Expectation is the API view of an expectation's outcome.
+type Expectation struct {
+	Step        string `json:"step,omitempty"`
+	Resource    string `json:"resource"`
+	ID          string `json:"id,omitempty"`
+	Description string `json:"description,omitempty"`
+	Met         bool   `json:"met"`
+	// MetAfter is how long into the wait the expectation was met.
+	MetAfter string `json:"metAfter,omitempty"`
+	Message  string `json:"message,omitempty"`
+	// Diffs are the mismatches found by the last evaluation.
+	Diffs []Diff `json:"diffs,omitempty"`
+}
+
+// Diff is the API view of an unmet condition.
+type Diff struct {
+	Path        string `json:"path"`
+	Description string `json:"description,omitempty"`
+	Expected    any    `json:"expected"`
+	Actual      any    `json:"actual"`
+}
+
+// Event is a runner.Event as streamed to clients.
+type Event struct {
+	runner.Event
+	Result *Result `json:"result,omitempty"`
+}
+
+func newResult(res *engine.Result) Result {
+	var expectations []Expectation
+	for _, o := range res.Expectations {
+		exp := Expectation{
+			Step:        o.Step,
+			Resource:    o.Resource,
+			ID:          o.ID,
+			Description: o.Description,
+			Met:         o.Met,
+			Message:     o.Message,
+		}
+		if o.Met {
+			exp.MetAfter = o.MetAfter.String()
+		}
+		for _, d := range o.Diffs {
+			exp.Diffs = append(exp.Diffs, Diff{Path: d.Path, Description: d.Description, Expected: d.Expected, Actual: d.Actual})
+		}
+		expectations = append(expectations, exp)
+	}
+	var agents []AgentHealth
+	for _, h := range res.Agents {
+		a := AgentHealth{Agent: h.Agent, ImageID: h.ImageID}
+		if h.TimeToReady > 0 {
+			a.TimeToReady = h.TimeToReady.String()
+		}
+		for _, f := range h.Flaps {
+			flap := Flap{At: f.At}
+			if f.Duration > 0 {
+				flap.Duration = f.Duration.String()
+			}
+			a.Flaps = append(a.Flaps, flap)
+		}
+		agents = append(agents, a)
+	}
+	var churn []ChurnCount
+	for _, c := range res.Churn {
+		churn = append(churn, ChurnCount{Resource: c.Resource, Creates: c.Creates, Updates: c.Updates, Deletes: c.Deletes})
+	}
+	var denials []Denial
+	for _, d := range res.Denials {
+		denials = append(denials, Denial(d))
+	}
+	var evictions []Eviction
+	for _, x := range res.Evictions {
+		evictions = append(evictions, Eviction(x))
+	}
+	return Result{
+		Scenario:    res.Scenario,
+		Passed:      res.Passed,
+		Skipped:     res.Skipped,
+		SkipReason:  res.SkipReason,
+		Error:       res.Error,
+		StartedAt:   res.StartedAt,
+		Duration:    res.Duration.String(),
+		AgentImages: res.AgentImages,
+		Dimensions:  res.Dimensions,
+
+		Expectations: expectations,
+		Agents:       agents,
+		Churn:        churn,
+		Denials:      denials,
+		Evictions:    evictions,
+	}
+}
+
+// run tracks a submitted run. Its events are kept for the life of the
+// server so late subscribers can replay them.
+type run struct {
+	id        string
+	scenarios []*scenario.Scenario
+
+	mu           sync.Mutex
+	view         Run
+	events       []Event
+	changed      chan struct{}
+	cancel       context.CancelFunc
+	artifactsDir string
+	suite        *runner.SuiteResult
+	err          error
+}
+
+func newRun(id string, scenarios []*scenario.Scenario) *run {
+	r := &run{
+		id:        id,
+		scenarios: scenarios,
+		changed:   make(chan struct{}),
+		view:      Run{ID: id, State: StateQueued, SubmittedAt: time.Now()},
+	}
+	for _, s := range scenarios {
+		r.view.Scenarios = append(r.view.Scenarios, s.Name)
+	}
+	return r
+}
+
+// snapshot returns the run's current view.
+func (r *run) snapshot() Run {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v := r.view
+	v.Results = append([]Result(nil), r.view.Results...)
+	return v
+}
+
+// eventsFrom returns the events after the first n, whether the run is
+// done, and a channel closed when either changes.
+func (r *run) eventsFrom(n int) ([]Event, bool, <-chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.events[n:], r.done(), r.changed
+}
+
+func (r *run) done() bool {
+	switch r.view.State {
+	case StatePassed, StateFailed, StateCancelled:
+		return true
+	}
+	return false
+}
+
+// start marks the run as running, reporting false when it was cancelled
+// while queued.
+func (r *run) start(cancel context.CancelFunc) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.view.State == StateCancelled {
+		return false
+	}
+	r.view.State = StateRunning
+	r.cancel = cancel
+	r.notify()
+	return true
+}
+
+// observe records a progress event from the runner.
+func (r *run) observe(e runner.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ev := Event{Event: e}
+	if e.Result != nil {
+		res := newResult(e.Result)
+		ev.Result = &res
+		r.view.Results = append(r.view.Results, res)
+	}
+	r.events = append(r.events, ev)
+	r.notify()
+}
+
+// finish records the suite's outcome.
+func (r *run) finish(suite *runner.SuiteResult, err error, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.view.FinishedAt = &at
+	if suite != nil {
+		r.artifactsDir = suite.ArtifactsDir
+		r.view.Fingerprint = suite.Fingerprint
+	}
+	r.suite, r.err = suite, err
+	switch {
+	case r.view.State == StateCancelled:
+	case err != nil:
+		r.view.State = StateFailed
+		r.view.Error = err.Error()
+	case suite.Passed():
+		r.view.State = StatePassed
+	default:
+		r.view.State = StateFailed
+	}
+	r.notify()
+}
+
+// wait blocks until the run has finished, or was cancelled while queued,
+// and returns the suite's outcome.
+func (r *run) wait(ctx context.Context) (*runner.SuiteResult, error) {
+	for {
+		r.mu.Lock()
+		finished, changed := r.done() && r.view.FinishedAt != nil, r.changed
+		suite, err := r.suite, r.err
+		if finished && suite == nil && err == nil {
+			err = context.Canceled
+		}
+		r.mu.Unlock()
+		if finished {
+			return suite, err
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// stop cancels the run, reporting false when it already finished.
+func (r *run) stop() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done() {
+		return false
+	}
+	if r.view.State == StateQueued {
+		now := time.Now()
+		r.view.FinishedAt = &now
+	}
+	r.view.State = StateCancelled
+	if r.cancel != nil {
+		r.cancel()
+	}
+	r.notify()
+	return true
+}
+
+// notify wakes everyone waiting on changed. r.mu must be held.
+func (r *run) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
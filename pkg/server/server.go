@@ -0,0 +1,185 @@
+// Package server exposes the framework over HTTP, so dashboards and other
+// services can submit scenario runs, follow their progress, and fetch
+// results and diagnostics without shelling into CI:
+//
+//	POST   /v1/runs                 submit a Request; answers 202 with the Run
+//	GET    /v1/runs                 list runs, newest first
+//	GET    /v1/runs/{id}            a run's state and results
+//	GET    /v1/runs/{id}/events     progress as server-sent events
+//	GET    /v1/runs/{id}/artifacts  the run's artifacts as a .tar.gz
+//	DELETE /v1/runs/{id}            cancel a queued or running run
+//
+// Runs share the server's cluster, so they execute one at a time in
+// submission order. Every request needs the server's bearer token, see
+// WithToken, and local files are confined to its root, see WithRoot.
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/runner"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario/remote"
+)
+
+// DefaultQueueSize bounds how many runs may wait to execute.
+const DefaultQueueSize = 64
+
+// Server queues and executes submitted runs.
+type Server struct {
+	exec          runner.Executor
+	runnerOpts    []runner.Option
+	artifactsRoot string
+	fetcher       *remote.Fetcher
+	token         string
+	root          string
+	log           *slog.Logger
+
+	mu    sync.Mutex
+	runs  map[string]*run
+	order []string
+	queue chan *run
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithArtifacts sets where run artifacts are written; a directory under
+// the system's temporary directory by default.
+func WithArtifacts(root string) Option {
+	return func(s *Server) { s.artifactsRoot = root }
+}
+
+// WithRunnerOptions adds options to the runner of every run, e.g. a
+// history store.
+func WithRunnerOptions(opts ...runner.Option) Option {
+	return func(s *Server) { s.runnerOpts = append(s.runnerOpts, opts...) }
+}
+
+// WithFetcher sets how remote scenario sources are fetched.
+func WithFetcher(f *remote.Fetcher) Option {
+	return func(s *Server) { s.fetcher = f }
+}
+
+// WithLogger sets the logger for progress messages.
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Server) { s.log = l }
+}
+
+// New returns a Server executing scenarios with exec. Call Start to begin
+// executing submitted runs.
+func New(exec runner.Executor, opts ...Option) *Server {
+	s := &Server{
+		exec:          exec,
+		artifactsRoot: filepath.Join(os.TempDir(), "kube-agents-server"),
+		log:           slog.New(slog.DiscardHandler),
+		runs:          map[string]*run{},
+		queue:         make(chan *run, DefaultQueueSize),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Start executes queued runs until ctx is done.
+func (s *Server) Start(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case r := <-s.queue:
+			s.execute(ctx, r)
+		}
+	}
+}
+
+// Request is the body of POST /v1/runs.
+type Request struct {
+	// Sources are scenario files, directories, or remote bundles, as
+	// accepted by kube-agents-test run. Local paths are on the server,
+	// in its root.
+	Sources []string `json:"sources,omitempty"`
+	// Scenarios are given inline. Setup manifest paths resolve against
+	// the server's root.
+	Scenarios []*scenario.Scenario `json:"scenarios,omitempty"`
+	// Vars are template variables for the scenario files of Sources.
+	Vars map[string]string `json:"vars,omitempty"`
+}
+
+var errQueueFull = errors.New("too many runs queued")
+
+// submit loads the scenarios of req and queues a run of them.
+func (s *Server) submit(ctx context.Context, req *Request) (*run, error) {
+	scenarios, err := s.load(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(scenarios) == 0 {
+		return nil, errors.New("no scenarios given")
+	}
+
+	r := newRun(runner.NewRunID(), scenarios)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case s.queue <- r:
+	default:
+		return nil, errQueueFull
+	}
+	s.runs[r.id] = r
+	s.order = append(s.order, r.id)
+	s.log.Info("run queued", "run", r.id, "scenarios", len(scenarios))
+	return r, nil
+}
+
+// Run submits req like POST /v1/runs and waits for the run to finish, so
+// runs started by the server's own process, such as scheduled soak runs,
+// queue behind submitted ones and show up in the API.
+func (s *Server) Run(ctx context.Context, req *Request) (*runner.SuiteResult, error) {
+	r, err := s.submit(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return r.wait(ctx)
+}
+
+func (s *Server) get(id string) *run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.runs[id]
+}
+
+func (s *Server) list() []*run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs := make([]*run, 0, len(s.order))
+	for i := len(s.order) - 1; i >= 0; i-- {
+		runs = append(runs, s.runs[s.order[i]])
+	}
+	return runs
+}
+
+// execute runs r's suite unless it was cancelled while queued.
+func (s *Server) execute(ctx context.Context, r *run) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if !r.start(cancel) {
+		return
+	}
+	s.log.Info("run started", "run", r.id)
+	opts := append([]runner.Option{
+		runner.WithArtifacts(s.artifactsRoot),
+		runner.WithLogger(s.log),
+	}, s.runnerOpts...)
+	opts = append(opts, runner.WithRunID(r.id), runner.WithObserver(r.observe))
+	suite, err := runner.New(s.exec, opts...).RunSuite(ctx, r.scenarios)
+	r.finish(suite, err, time.Now())
+	s.log.Info("run finished", "run", r.id, "error", err)
+}
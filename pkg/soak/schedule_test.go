@@ -0,0 +1,78 @@
+package soak
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	// A Wednesday.
+	from := time.Date(2024, time.January, 3, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{spec: "* * * * *", next: time.Date(2024, time.January, 3, 10, 8, 0, 0, time.UTC)},
+		{spec: "*/15 * * * *", next: time.Date(2024, time.January, 3, 10, 15, 0, 0, time.UTC)},
+		{spec: "5,20 * * * *", next: time.Date(2024, time.January, 3, 10, 20, 0, 0, time.UTC)},
+		{spec: "0 8-9 * * *", next: time.Date(2024, time.January, 4, 8, 0, 0, 0, time.UTC)},
+		{spec: "30 12 * * 1-5", next: time.Date(2024, time.January, 3, 12, 30, 0, 0, time.UTC)},
+		{spec: "0 0 * * 7", next: time.Date(2024, time.January, 7, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 * * 0", next: time.Date(2024, time.January, 7, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 1 * *", next: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either one matches.
+		{spec: "0 0 15 * 5", next: time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 29 2 *", next: time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{spec: "10/20 * * * *", next: time.Date(2024, time.January, 3, 10, 10, 0, 0, time.UTC)},
+		{spec: "  @hourly ", next: time.Date(2024, time.January, 3, 11, 0, 0, 0, time.UTC)},
+		{spec: "@daily", next: time.Date(2024, time.January, 4, 0, 0, 0, 0, time.UTC)},
+		{spec: "@midnight", next: time.Date(2024, time.January, 4, 0, 0, 0, 0, time.UTC)},
+		{spec: "@weekly", next: time.Date(2024, time.January, 7, 0, 0, 0, 0, time.UTC)},
+		{spec: "@every 90s", next: from.Add(90 * time.Second)},
+		{spec: "0 0 31 2 *", next: time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := ParseSchedule(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseSchedule(%q) error = %v", tt.spec, err)
+			}
+			if got := s.Next(from); !got.Equal(tt.next) {
+				t.Errorf("Next(%v) = %v, want %v", from, got, tt.next)
+			}
+		})
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	tests := []struct {
+		spec string
+		err  string
+	}{
+		{spec: "", err: "want 5 fields, got 0"},
+		{spec: "* * * *", err: "want 5 fields, got 4"},
+		{spec: "* * * * * *", err: "want 5 fields, got 6"},
+		{spec: "60 * * * *", err: "field 1: \"60\" is out of range 0-59"},
+		{spec: "* 24 * * *", err: "field 2: \"24\" is out of range 0-23"},
+		{spec: "* * 0 * *", err: "field 3: \"0\" is out of range 1-31"},
+		{spec: "* * * 13 *", err: "field 4: \"13\" is out of range 1-12"},
+		{spec: "* * * * 8", err: "field 5: \"8\" is out of range 0-7"},
+		{spec: "5-1 * * * *", err: "\"5-1\" is out of range"},
+		{spec: "*/0 * * * *", err: "invalid step \"0\""},
+		{spec: "*/x * * * *", err: "invalid step \"x\""},
+		{spec: "a * * * *", err: "invalid value \"a\""},
+		{spec: "1-b * * * *", err: "invalid value \"b\""},
+		{spec: "@yearly", err: "want 5 fields, got 1"},
+		{spec: "@every soon", err: "invalid duration"},
+		{spec: "@every 500ms", err: "interval must be at least 1s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := ParseSchedule(tt.spec)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseSchedule(%q) error = %v, want %q", tt.spec, err, tt.err)
+			}
+		})
+	}
+}
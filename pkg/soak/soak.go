@@ -0,0 +1,179 @@
+// Package soak runs a suite over and over on a schedule against a
+// persistent cluster, such as staging, and alerts when scenarios start
+// failing: continuous verification that the agents keep working as the
+// environment around them changes.
+package soak
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/history"
+	"github.com/aslakknutsen/kube-agents-test/pkg/notify"
+	"github.com/aslakknutsen/kube-agents-test/pkg/runner"
+)
+
+// notifyTimeout bounds delivering one alert.
+const notifyTimeout = 30 * time.Second
+
+// RunFunc runs the suite once. Results go to the run history store through
+// the runner's own history option.
+type RunFunc func(ctx context.Context) (*runner.SuiteResult, error)
+
+// Scheduler runs a suite on a Schedule.
+type Scheduler struct {
+	schedule   Schedule
+	run        RunFunc
+	history    *history.Store
+	notifier   notify.Notifier
+	runOnStart bool
+	log        *slog.Logger
+
+	// passed holds each scenario's latest outcome.
+	passed  map[string]bool
+	lastErr string
+}
+
+// Option configures a Scheduler.
+type Option func(*Scheduler)
+
+// WithHistory seeds each scenario's previous outcome from the latest
+// record in store, so a failure that was already known before a restart
+// is not reported as new.
+func WithHistory(store *history.Store) Option {
+	return func(s *Scheduler) { s.history = store }
+}
+
+// WithNotifier sets where alerts go; without one, they are only logged.
+func WithNotifier(n notify.Notifier) Option {
+	return func(s *Scheduler) { s.notifier = n }
+}
+
+// WithRunOnStart runs the suite as soon as Run is called, rather than at
+// the first activation of the schedule.
+func WithRunOnStart(enabled bool) Option {
+	return func(s *Scheduler) { s.runOnStart = enabled }
+}
+
+// WithLogger sets the logger for progress messages.
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Scheduler) { s.log = l }
+}
+
+// New returns a Scheduler calling run on schedule.
+func New(schedule Schedule, run RunFunc, opts ...Option) *Scheduler {
+	s := &Scheduler{
+		schedule: schedule,
+		run:      run,
+		log:      slog.New(slog.DiscardHandler),
+		passed:   map[string]bool{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Run runs the suite at every activation of the schedule until ctx is
+// done. Activations missed while a run was in progress are skipped.
+func (s *Scheduler) Run(ctx context.Context) error {
+	if err := s.seed(); err != nil {
+		return err
+	}
+	next := time.Now()
+	if !s.runOnStart {
+		next = s.schedule.Next(next)
+	}
+	for {
+		if next.IsZero() {
+			return fmt.Errorf("schedule has no further activations")
+		}
+		s.log.Info("next soak run", "at", next)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+		s.once(ctx)
+		next = s.schedule.Next(time.Now())
+	}
+}
+
+// seed loads each scenario's latest outcome from the history store.
+func (s *Scheduler) seed() error {
+	if s.history == nil {
+		return nil
+	}
+	records, err := s.history.Records(history.Filter{})
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		s.passed[r.Scenario] = r.Passed
+	}
+	return nil
+}
+
+// once runs the suite and alerts on changes.
+func (s *Scheduler) once(ctx context.Context) {
+	suite, err := s.run(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	alert := notify.Alert{Time: time.Now()}
+	if suite != nil {
+		alert = s.compare(suite)
+	}
+	if err != nil {
+		s.log.Warn("soak run failed", "run", alert.RunID, "error", err)
+		// Report a broken suite once, not on every activation.
+		if err.Error() != s.lastErr {
+			alert.Error = err.Error()
+		}
+		s.lastErr = err.Error()
+	} else {
+		s.lastErr = ""
+	}
+	s.log.Info("soak run finished", "run", alert.RunID, "failing", alert.Failing, "total", alert.Total,
+		"newFailures", len(alert.NewFailures), "recovered", len(alert.Recovered))
+	if len(alert.NewFailures) == 0 && len(alert.Recovered) == 0 && alert.Error == "" {
+		return
+	}
+	if s.notifier == nil {
+		s.log.Warn("soak alert", "text", alert.Text())
+		return
+	}
+	nctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	if err := s.notifier.Notify(nctx, alert); err != nil {
+		s.log.Warn("sending alert", "run", alert.RunID, "error", err)
+	}
+}
+
+// compare records the suite's outcomes and returns the alert describing
+// what changed since the previous run.
+func (s *Scheduler) compare(suite *runner.SuiteResult) notify.Alert {
+	alert := notify.Alert{RunID: suite.RunID, Time: time.Now()}
+	for _, res := range suite.Results {
+		if res.Skipped {
+			continue
+		}
+		alert.Total++
+		prev, seen := s.passed[res.Scenario]
+		switch {
+		case !res.Passed && (!seen || prev):
+			alert.NewFailures = append(alert.NewFailures, notify.Failure{Scenario: res.Scenario, Error: res.Error})
+		case res.Passed && seen && !prev:
+			alert.Recovered = append(alert.Recovered, res.Scenario)
+		}
+		if !res.Passed {
+			alert.Failing++
+		}
+		s.passed[res.Scenario] = res.Passed
+	}
+	return alert
+}
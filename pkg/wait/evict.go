@@ -0,0 +1,66 @@
+package wait
+
+import (
+	"context"
+	"fmt"
+
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// WithDryRun makes WaitForEvictionBlocked and WaitForEvictionAllowed evict
+// as dry runs, which PodDisruptionBudgets are checked against too, so
+// evictions that go through leave the pod running.
+func WithDryRun() Option {
+	return func(o *options) { o.dryRun = true }
+}
+
+// WaitForEvictionBlocked attempts to evict pod until the API server refuses,
+// as it does when the eviction would violate a PodDisruptionBudget, and
+// returns the refusal's message. Unless WithDryRun is given, an eviction
+// that goes through ends the wait with an error, since the pod is gone.
+func WaitForEvictionBlocked(ctx context.Context, client kubernetes.Interface, namespace, pod string, opts ...Option) (string, error) {
+	o := newOptions(opts)
+	var message string
+	err := o.poll(ctx, fmt.Sprintf("waiting for eviction of pod %s/%s to be blocked", namespace, pod), func(ctx context.Context) (bool, string, error) {
+		err := o.evict(ctx, client, namespace, pod)
+		switch {
+		case err == nil && o.dryRun:
+			return false, "eviction allowed", nil
+		case err == nil:
+			return false, "", fmt.Errorf("pod %s/%s evicted", namespace, pod)
+		case apierrors.IsTooManyRequests(err):
+			message = err.Error()
+			return true, "", nil
+		}
+		return false, err.Error(), o.readFailure(err)
+	})
+	return message, err
+}
+
+// WaitForEvictionAllowed attempts to evict pod until the API server lets
+// the eviction through, retrying while a PodDisruptionBudget refuses it.
+func WaitForEvictionAllowed(ctx context.Context, client kubernetes.Interface, namespace, pod string, opts ...Option) error {
+	o := newOptions(opts)
+	return o.poll(ctx, fmt.Sprintf("waiting for eviction of pod %s/%s to be allowed", namespace, pod), func(ctx context.Context) (bool, string, error) {
+		err := o.evict(ctx, client, namespace, pod)
+		switch {
+		case err == nil:
+			return true, "", nil
+		case apierrors.IsTooManyRequests(err):
+			return false, err.Error(), nil
+		}
+		return false, err.Error(), o.readFailure(err)
+	})
+}
+
+// evict creates an Eviction for pod, as a dry run if so configured.
+func (o options) evict(ctx context.Context, client kubernetes.Interface, namespace, pod string) error {
+	eviction := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Name: pod, Namespace: namespace}}
+	if o.dryRun {
+		eviction.DeleteOptions = &metav1.DeleteOptions{DryRun: []string{metav1.DryRunAll}}
+	}
+	return client.CoreV1().Pods(namespace).EvictV1(ctx, eviction)
+}
@@ -0,0 +1,58 @@
+package wait
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// WithContainer sets the container whose logs WaitForLogLine reads; unset,
+// the pod must have a single container.
+func WithContainer(name string) Option {
+	return func(o *options) { o.container = name }
+}
+
+// WithSince makes WaitForLogLine only match lines logged at or after t.
+// Unset, it matches every line of the container's current run.
+func WithSince(t time.Time) Option {
+	return func(o *options) { o.since = t }
+}
+
+// WaitForLogLine follows the logs of pod until a line matches pattern, and
+// returns the line. Until the container is running, and whenever the log
+// stream ends early, such as when the container restarts, it tries again
+// at the poll interval.
+func WaitForLogLine(ctx context.Context, client kubernetes.Interface, namespace, pod string, pattern *regexp.Regexp, opts ...Option) (string, error) {
+	o := newOptions(opts)
+	logOpts := &corev1.PodLogOptions{Container: o.container, Follow: true}
+	if !o.since.IsZero() {
+		logOpts.SinceTime = &metav1.Time{Time: o.since}
+	}
+	var line string
+	err := o.poll(ctx, fmt.Sprintf("waiting for pod %s/%s to log %q", namespace, pod, pattern), func(ctx context.Context) (bool, string, error) {
+		stream, err := client.CoreV1().Pods(namespace).GetLogs(pod, logOpts).Stream(ctx)
+		if err != nil {
+			return false, err.Error(), o.readFailure(err)
+		}
+		defer stream.Close()
+		scanner := bufio.NewScanner(stream)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			if pattern.MatchString(scanner.Text()) {
+				line = scanner.Text()
+				return true, "", nil
+			}
+		}
+		if err := scanner.Err(); err != nil && ctx.Err() == nil {
+			return false, fmt.Sprintf("reading logs: %v", err), nil
+		}
+		return false, "no matching line", nil
+	})
+	return line, err
+}
@@ -0,0 +1,183 @@
+package wait
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+// Matcher has the method set of Gomega's types.GomegaMatcher, so the
+// matchers built here work with Expect and Eventually, and Gomega's
+// matchers convert to Conditions, without this package depending on
+// Gomega:
+//
+//	Expect(deployment).To(wait.ConditionMatcher(c))
+//	wait.WaitForCondition(ctx, client, "web", wait.FieldMatches(".spec.replicas", BeNumerically(">=", 2)))
+type Matcher interface {
+	Match(actual any) (success bool, err error)
+	FailureMessage(actual any) (message string)
+	NegatedFailureMessage(actual any) (message string)
+}
+
+// ConditionMatcher returns a matcher for objects that meet the scenario
+// conditions: the value at each condition's path compares with its value,
+// or the one its valueFrom.env names, as its operator requires, and status
+// condition shorthands hold. Conditions sourcing their value from
+// another resource need a cluster to read it from and are rejected; use
+// WaitForCondition for those.
+func ConditionMatcher(conditions ...scenario.Condition) (Matcher, error) {
+	var all []Condition
+	var errs []error
+	for i, c := range scenario.ExpandConditions(conditions) {
+		want, err := conditionValue(c)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("conditions[%d]: %w", i, err))
+			continue
+		}
+		if c.OperatorOrDefault() == scenario.OperatorEq {
+			all = append(all, FieldEquals(c.Path, want))
+			continue
+		}
+		all = append(all, fieldCompares(c, want))
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return ObjectMatcher(All(all...)), nil
+}
+
+// fieldCompares is met when the field at the path of c compares with want
+// as the operator of c requires.
+func fieldCompares(c scenario.Condition, want any) Condition {
+	return func(obj *unstructured.Unstructured) (bool, string, error) {
+		actual, found, err := Lookup(obj.Object, c.Path)
+		if err != nil {
+			return false, "", err
+		}
+		met, err := c.Compare(want, actual, found)
+		if err != nil {
+			return false, "", fmt.Errorf("%s: %w", c.Path, err)
+		}
+		if !met {
+			return false, fmt.Sprintf("%s: expected %v, got %v", c.Path, c.Want(want), actual), nil
+		}
+		return true, "", nil
+	}
+}
+
+// conditionValue returns the value c expects, read from the environment
+// as the engine does if it names a variable.
+func conditionValue(c scenario.Condition) (any, error) {
+	switch {
+	case c.ValueFrom == nil:
+		return c.Value, nil
+	case c.ValueFrom.ResourceField != nil:
+		return nil, errors.New("valueFrom.resourceField is only resolved against a cluster")
+	}
+	raw, ok := os.LookupEnv(c.ValueFrom.Env)
+	if !ok {
+		return nil, fmt.Errorf("valueFrom: environment variable %s is not set", c.ValueFrom.Env)
+	}
+	var v any
+	if err := yaml.Unmarshal([]byte(raw), &v); err != nil {
+		return nil, fmt.Errorf("valueFrom: environment variable %s: %w", c.ValueFrom.Env, err)
+	}
+	return v, nil
+}
+
+// ObjectMatcher returns a matcher for objects that meet cond. It matches
+// unstructured objects, their contents as a map, and typed API objects.
+func ObjectMatcher(cond Condition) Matcher {
+	return &objectMatcher{cond: cond}
+}
+
+type objectMatcher struct {
+	cond Condition
+	// reason is why the last match failed.
+	reason string
+}
+
+var _ Matcher = (*objectMatcher)(nil)
+
+func (m *objectMatcher) Match(actual any) (bool, error) {
+	obj, err := toUnstructured(actual)
+	if err != nil {
+		return false, err
+	}
+	met, reason, err := m.cond(obj)
+	m.reason = reason
+	return met, err
+}
+
+func (m *objectMatcher) FailureMessage(actual any) string {
+	return fmt.Sprintf("Expected\n\t%s\nto meet the conditions: %s", describeObject(actual), m.reason)
+}
+
+func (m *objectMatcher) NegatedFailureMessage(actual any) string {
+	return fmt.Sprintf("Expected\n\t%s\nnot to meet the conditions", describeObject(actual))
+}
+
+// FieldMatches returns a Condition met when the field at path, a dotted path
+// such as .status.conditions[0].type, is set and satisfies m, such as a
+// Gomega matcher.
+func FieldMatches(path string, m Matcher) Condition {
+	return func(obj *unstructured.Unstructured) (bool, string, error) {
+		actual, found, err := Lookup(obj.Object, path)
+		if err != nil {
+			return false, "", err
+		}
+		if !found {
+			return false, fmt.Sprintf("%s: field not set", path), nil
+		}
+		ok, err := m.Match(actual)
+		if err != nil {
+			return false, "", fmt.Errorf("%s: %w", path, err)
+		}
+		if !ok {
+			return false, fmt.Sprintf("%s: %s", path, m.FailureMessage(actual)), nil
+		}
+		return true, "", nil
+	}
+}
+
+// toUnstructured returns actual as an unstructured object.
+func toUnstructured(actual any) (*unstructured.Unstructured, error) {
+	switch obj := actual.(type) {
+	case *unstructured.Unstructured:
+		return obj, nil
+	case unstructured.Unstructured:
+		return &obj, nil
+	case map[string]any:
+		return &unstructured.Unstructured{Object: obj}, nil
+	case runtime.Object:
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+		return &unstructured.Unstructured{Object: content}, nil
+	}
+	return nil, fmt.Errorf("expected an API object, got %T", actual)
+}
+
+// describeObject names actual in failure messages by its kind and name.
+func describeObject(actual any) string {
+	obj, err := toUnstructured(actual)
+	if err != nil {
+		return fmt.Sprintf("%T", actual)
+	}
+	// Typed objects from clientsets leave their kind unset.
+	kind := obj.GetKind()
+	if kind == "" {
+		kind = fmt.Sprintf("%T", actual)
+	}
+	if ns := obj.GetNamespace(); ns != "" {
+		return fmt.Sprintf("%s %s/%s", kind, ns, obj.GetName())
+	}
+	return fmt.Sprintf("%s %s", kind, obj.GetName())
+}
@@ -0,0 +1,248 @@
+// Package wait is the waiting machinery of the engine as a library, for Go
+// tests that drive a cluster without scenario files: it polls objects until
+// a condition holds or they are gone, pod logs until a line matches, and
+// evictions until a PodDisruptionBudget blocks or allows them, retrying
+// transient read errors as expectations do. Its conditions convert to and
+// from Gomega matchers; see Matcher.
+//
+//	deployments := dyn.Resource(appsv1.SchemeGroupVersion.WithResource("deployments")).Namespace("demo")
+//	obj, err := wait.WaitForCondition(ctx, deployments, "web",
+//		wait.FieldEquals(".status.readyReplicas", 3), wait.WithTimeout(time.Minute))
+package wait
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8swait "k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/jsonpath"
+
+	"github.com/aslakknutsen/kube-agents-test/pkg/scenario"
+)
+
+const (
+	// DefaultInterval is how often waits poll, as the engine does.
+	DefaultInterval = 2 * time.Second
+	// DefaultTimeout is how long waits last, as long as a scenario's.
+	DefaultTimeout = scenario.DefaultTimeout
+)
+
+// Option configures a wait.
+type Option func(*options)
+
+type options struct {
+	interval  time.Duration
+	timeout   time.Duration
+	retryOn   []string
+	container string
+	since     time.Time
+	dryRun    bool
+}
+
+// WithInterval sets how often the wait polls.
+func WithInterval(d time.Duration) Option {
+	return func(o *options) { o.interval = d }
+}
+
+// WithTimeout sets how long the wait lasts.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) { o.timeout = d }
+}
+
+// WithRetryOn limits the read errors that keep the wait polling to those
+// of the given classes, from scenario.ErrorClasses; others end it at once.
+// By default every read error is retried.
+func WithRetryOn(classes ...string) Option {
+	return func(o *options) { o.retryOn = classes }
+}
+
+func newOptions(opts []Option) options {
+	o := options{interval: DefaultInterval, timeout: DefaultTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// retries reports whether a read error of class keeps the wait polling.
+func (o options) retries(class string) bool {
+	return o.retryOn == nil || slices.Contains(o.retryOn, class)
+}
+
+// poll runs check every interval until it reports done, fails with an
+// error, or the timeout passes. check returns why it is not done yet, which
+// the timeout error reports.
+func (o options) poll(ctx context.Context, what string, check func(ctx context.Context) (done bool, reason string, err error)) error {
+	ctx, cancel := context.WithTimeout(ctx, o.timeout)
+	defer cancel()
+	var reason string
+	err := k8swait.PollUntilContextCancel(ctx, o.interval, true, func(ctx context.Context) (bool, error) {
+		done, r, err := check(ctx)
+		reason = r
+		return done, err
+	})
+	if err == nil || !k8swait.Interrupted(err) {
+		return err
+	}
+	if reason == "" {
+		return fmt.Errorf("%s: not done within %s", what, o.timeout)
+	}
+	return fmt.Errorf("%s: not done within %s: %s", what, o.timeout, reason)
+}
+
+// Condition reports whether obj is in the state a wait is for. When it is
+// not, reason says why; a non-nil error ends the wait.
+type Condition func(obj *unstructured.Unstructured) (met bool, reason string, err error)
+
+// FieldEquals is met when the field at path, a dotted path such as
+// .status.conditions[0].type, equals value. The two are compared in their
+// JSON form, so numbers compare by value whatever their Go type.
+func FieldEquals(path string, value any) Condition {
+	want, wantErr := json.Marshal(value)
+	return func(obj *unstructured.Unstructured) (bool, string, error) {
+		if wantErr != nil {
+			return false, "", fmt.Errorf("%s: %w", path, wantErr)
+		}
+		actual, found, err := Lookup(obj.Object, path)
+		if err != nil {
+			return false, "", err
+		}
+		if !found {
+			return false, fmt.Sprintf("%s: expected %s, field not set", path, want), nil
+		}
+		got, err := json.Marshal(actual)
+		if err != nil {
+			return false, "", fmt.Errorf("%s: %w", path, err)
+		}
+		if string(got) != string(want) {
+			return false, fmt.Sprintf("%s: expected %s, got %s", path, want, got), nil
+		}
+		return true, "", nil
+	}
+}
+
+// HasCondition is met when the object's status has a condition of type
+// conditionType with the given status, such as Available and True.
+func HasCondition(conditionType string, status metav1.ConditionStatus) Condition {
+	return func(obj *unstructured.Unstructured) (bool, string, error) {
+		conditions, _, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+		if err != nil {
+			return false, "", err
+		}
+		for _, c := range conditions {
+			c, ok := c.(map[string]any)
+			if !ok || c["type"] != conditionType {
+				continue
+			}
+			if c["status"] == string(status) {
+				return true, "", nil
+			}
+			return false, fmt.Sprintf("condition %s is %v, expected %s", conditionType, c["status"], status), nil
+		}
+		return false, fmt.Sprintf("no condition %s", conditionType), nil
+	}
+}
+
+// All is met when every one of conditions is.
+func All(conditions ...Condition) Condition {
+	return func(obj *unstructured.Unstructured) (bool, string, error) {
+		var reasons []string
+		for _, c := range conditions {
+			met, reason, err := c(obj)
+			if err != nil {
+				return false, "", err
+			}
+			if !met {
+				reasons = append(reasons, reason)
+			}
+		}
+		return len(reasons) == 0, strings.Join(reasons, "; "), nil
+	}
+}
+
+// Lookup returns the value at path, a dotted path such as
+// .status.conditions[0].type, in obj.
+func Lookup(obj map[string]any, path string) (any, bool, error) {
+	jp := jsonpath.New(path)
+	if err := jp.Parse("{" + path + "}"); err != nil {
+		return nil, false, fmt.Errorf("path %q: %w", path, err)
+	}
+	results, err := jp.FindResults(obj)
+	if err != nil || len(results) == 0 || len(results[0]) == 0 {
+		// jsonpath reports missing keys and indexes out of range as
+		// errors.
+		return nil, false, nil
+	}
+	return results[0][0].Interface(), true, nil
+}
+
+// WaitForCondition polls the object name of client until cond is met, and
+// returns it. Combine conditions with All.
+func WaitForCondition(ctx context.Context, client dynamic.ResourceInterface, name string, cond Condition, opts ...Option) (*unstructured.Unstructured, error) {
+	o := newOptions(opts)
+	var last *unstructured.Unstructured
+	err := o.poll(ctx, "waiting for "+name, func(ctx context.Context) (bool, string, error) {
+		obj, err := client.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err.Error(), o.readFailure(err)
+		}
+		met, reason, err := cond(obj)
+		last = obj
+		return met, reason, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return last, nil
+}
+
+// WaitForDeleted polls until the object name of client is gone.
+func WaitForDeleted(ctx context.Context, client dynamic.ResourceInterface, name string, opts ...Option) error {
+	o := newOptions(opts)
+	return o.poll(ctx, "waiting for "+name+" to be deleted", func(ctx context.Context) (bool, string, error) {
+		obj, err := client.Get(ctx, name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			return true, "", nil
+		case err != nil:
+			return false, err.Error(), o.readFailure(err)
+		case obj.GetDeletionTimestamp() != nil:
+			return false, "still terminating", nil
+		}
+		return false, "still exists", nil
+	})
+}
+
+// readFailure returns nil for read errors the wait retries, and err for
+// those that end it.
+func (o options) readFailure(err error) error {
+	if class := ErrorClass(err); class != "" && !o.retries(class) {
+		return fmt.Errorf("%w (%s is not retried)", err, class)
+	}
+	return nil
+}
+
+// ErrorClass returns the scenario.ErrorClasses class of a read error, or
+// "" if it has none.
+func ErrorClass(err error) string {
+	var netErr net.Error
+	switch {
+	case apierrors.IsNotFound(err):
+		return scenario.ErrorNotFound
+	case apierrors.IsForbidden(err):
+		return scenario.ErrorForbidden
+	case apierrors.IsTimeout(err), apierrors.IsServerTimeout(err), errors.As(err, &netErr) && netErr.Timeout():
+		return scenario.ErrorTimeout
+	}
+	return ""
+}